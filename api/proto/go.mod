@@ -0,0 +1,5 @@
+module platform/api/proto
+
+go 1.21
+
+require google.golang.org/protobuf v1.33.0
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Token validation failures, used as the reason label on auth metrics
+var (
+	errMissingToken     = errors.New("missing bearer token")
+	errMalformedToken   = errors.New("malformed token")
+	errUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	errInvalidSignature = errors.New("invalid signature")
+	errExpiredToken     = errors.New("token expired")
+	errInvalidClaims    = errors.New("invalid claims")
+	errOtherUser        = errors.New("path of another user")
+	errNotAdmin         = errors.New("admin route")
+)
+
+// Claims are the JWT claims the gateway checks and forwards
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	Tenant    string
+	Roles     []string
+}
+
+// IsAdmin reports whether the token carries the admin role, which may act on
+// any user's paths and call admin routes
+func (v *verifier) IsAdmin(claims Claims) bool {
+	return v.cfg.AdminRole != "" && contains(claims.Roles, v.cfg.AdminRole)
+}
+
+// verifier validates HS256 and RS256 bearer tokens
+type verifier struct {
+	cfg       AuthConfig
+	publicKey *rsa.PublicKey
+	now       func() time.Time
+}
+
+func newVerifier(cfg AuthConfig) (*verifier, error) {
+	v := &verifier{cfg: cfg, now: time.Now}
+	if cfg.PublicKeyFile == "" {
+		return v, nil
+	}
+
+	data, err := os.ReadFile(cfg.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWT public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("JWT public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing JWT public key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("JWT public key is not an RSA key")
+	}
+	v.publicKey = rsaKey
+	return v, nil
+}
+
+// Verify checks the token from an Authorization header value
+func (v *verifier) Verify(authorization string) (Claims, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return Claims{}, errMissingToken
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errMalformedToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, errMalformedToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, errMalformedToken
+	}
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return Claims{}, err
+	}
+
+	var raw map[string]any
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return Claims{}, errMalformedToken
+	}
+	claims := v.parseClaims(raw)
+	return claims, v.validateClaims(claims)
+}
+
+// verifySignature only accepts algorithms that have a configured key, so
+// "none" and HS256-signed-with-the-public-key tokens are rejected
+func (v *verifier) verifySignature(alg, signed string, signature []byte) error {
+	switch {
+	case alg == "HS256" && v.cfg.HMACSecret != "":
+		mac := hmac.New(sha256.New, []byte(v.cfg.HMACSecret))
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errInvalidSignature
+		}
+		return nil
+	case alg == "RS256" && v.publicKey != nil:
+		digest := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(v.publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return errInvalidSignature
+		}
+		return nil
+	default:
+		return errUnsupportedAlg
+	}
+}
+
+func (v *verifier) parseClaims(raw map[string]any) Claims {
+	claims := Claims{}
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Issuer, _ = raw["iss"].(string)
+	claims.Tenant, _ = raw[v.cfg.TenantClaim].(string)
+	claims.Audience = stringList(raw["aud"])
+	claims.Roles = stringList(raw[v.cfg.RolesClaim])
+	if exp, ok := raw["exp"].(float64); ok {
+		claims.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	if nbf, ok := raw["nbf"].(float64); ok {
+		claims.NotBefore = time.Unix(int64(nbf), 0)
+	}
+	return claims
+}
+
+func (v *verifier) validateClaims(claims Claims) error {
+	now := v.now()
+	if claims.ExpiresAt.IsZero() || now.After(claims.ExpiresAt.Add(v.cfg.Leeway)) {
+		return errExpiredToken
+	}
+	if !claims.NotBefore.IsZero() && now.Add(v.cfg.Leeway).Before(claims.NotBefore) {
+		return errInvalidClaims
+	}
+	if claims.Subject == "" {
+		return errInvalidClaims
+	}
+	if v.cfg.Issuer != "" && claims.Issuer != v.cfg.Issuer {
+		return errInvalidClaims
+	}
+	if v.cfg.Audience != "" && !contains(claims.Audience, v.cfg.Audience) {
+		return errInvalidClaims
+	}
+	return nil
+}
+
+// stringList reads a claim that may be a single string or an array of them
+func stringList(claim any) []string {
+	switch claim := claim.(type) {
+	case string:
+		return []string{claim}
+	case []any:
+		var values []string
+		for _, c := range claim {
+			if s, ok := c.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func decodeSegment(segment string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
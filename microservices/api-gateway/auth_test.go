@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// signedToken builds a token with the given header algorithm, signed by sign
+func signedToken(alg string, claims map[string]any, sign func(signed string) []byte) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(signed))
+}
+
+func hmacSigner(secret []byte) func(string) []byte {
+	return func(signed string) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		return mac.Sum(nil)
+	}
+}
+
+func rsaSigner(key *rsa.PrivateKey) func(string) []byte {
+	return func(signed string) []byte {
+		digest := sha256.Sum256([]byte(signed))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return signature
+	}
+}
+
+// tampered swaps the claims of token, keeping its signature
+func tampered(token string, claims map[string]any) string {
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(claims)
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub":    "alice",
+		"iss":    "platform",
+		"aud":    []string{"api"},
+		"exp":    testNow.Add(time.Hour).Unix(),
+		"tenant": "acme",
+		"roles":  "admin",
+	}
+}
+
+func with(claims map[string]any, key string, value any) map[string]any {
+	claims[key] = value
+	return claims
+}
+
+func TestVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicPEM})
+
+	cfg := defaultConfig().Auth
+	cfg.HMACSecret, cfg.Issuer, cfg.Audience = "secret", "platform", "api"
+	hs := &verifier{cfg: cfg, now: func() time.Time { return testNow }}
+	rsOnly := cfg
+	rsOnly.HMACSecret = ""
+	rs := &verifier{cfg: rsOnly, publicKey: &key.PublicKey, now: func() time.Time { return testNow }}
+
+	for _, tc := range []struct {
+		name     string
+		verifier *verifier
+		token    string
+		err      error
+	}{
+		{"hs256", hs, signedToken("HS256", validClaims(), hmacSigner([]byte("secret"))), nil},
+		{"rs256", rs, signedToken("RS256", validClaims(), rsaSigner(key)), nil},
+		{"wrong secret", hs, signedToken("HS256", validClaims(), hmacSigner([]byte("guess"))), errInvalidSignature},
+		{"tampered claims", rs, tampered(signedToken("RS256", validClaims(), rsaSigner(key)), with(validClaims(), "sub", "mallory")), errInvalidSignature},
+		// The public key is no HMAC secret, so it cannot sign HS256 tokens
+		{"alg confusion", rs, signedToken("HS256", validClaims(), hmacSigner(publicPEM)), errUnsupportedAlg},
+		{"alg none", hs, signedToken("none", validClaims(), func(string) []byte { return nil }), errUnsupportedAlg},
+		{"rs256 without a key", hs, signedToken("RS256", validClaims(), rsaSigner(key)), errUnsupportedAlg},
+		{"expired", hs, signedToken("HS256", with(validClaims(), "exp", testNow.Add(-time.Minute).Unix()), hmacSigner([]byte("secret"))), errExpiredToken},
+		{"expired within leeway", hs, signedToken("HS256", with(validClaims(), "exp", testNow.Add(-10*time.Second).Unix()), hmacSigner([]byte("secret"))), nil},
+		{"no expiry", hs, signedToken("HS256", with(validClaims(), "exp", nil), hmacSigner([]byte("secret"))), errExpiredToken},
+		{"not yet valid", hs, signedToken("HS256", with(validClaims(), "nbf", testNow.Add(time.Hour).Unix()), hmacSigner([]byte("secret"))), errInvalidClaims},
+		{"other issuer", hs, signedToken("HS256", with(validClaims(), "iss", "elsewhere"), hmacSigner([]byte("secret"))), errInvalidClaims},
+		{"other audience", hs, signedToken("HS256", with(validClaims(), "aud", "web"), hmacSigner([]byte("secret"))), errInvalidClaims},
+		{"no subject", hs, signedToken("HS256", with(validClaims(), "sub", ""), hmacSigner([]byte("secret"))), errInvalidClaims},
+		{"not three parts", hs, "abc.def", errMalformedToken},
+	} {
+		claims, err := tc.verifier.Verify("Bearer " + tc.token)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: Verify returned %v, want %v", tc.name, err, tc.err)
+			continue
+		}
+		if err == nil && (claims.Subject != "alice" || claims.Tenant != "acme" || !tc.verifier.IsAdmin(claims)) {
+			t.Errorf("%s: claims = %+v", tc.name, claims)
+		}
+	}
+
+	if _, err := hs.Verify(""); !errors.Is(err, errMissingToken) {
+		t.Errorf("Verify without a token returned %v, want errMissingToken", err)
+	}
+}
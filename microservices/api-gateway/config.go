@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the gateway configuration
+//
+// The route table comes from the YAML file named by ROUTES_FILE (usually a
+// mounted ConfigMap) or the defaults below; secrets come from the environment.
+type Config struct {
+	Port            string        `yaml:"port"`
+	LogLevel        string        `yaml:"log_level"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	Auth            AuthConfig    `yaml:"auth"`
+	Routes          []RouteConfig `yaml:"routes"`
+	// TrustedProxies are the addresses or CIDRs whose X-Forwarded-For entries
+	// are believed; without any the peer address identifies the client
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// AuthConfig configures JWT validation at the edge
+type AuthConfig struct {
+	// HMACSecret verifies HS256 tokens
+	HMACSecret string `yaml:"-"`
+	// PublicKeyFile is a PEM RSA public key verifying RS256 tokens
+	PublicKeyFile string        `yaml:"public_key_file"`
+	Issuer        string        `yaml:"issuer"`
+	Audience      string        `yaml:"audience"`
+	Leeway        time.Duration `yaml:"leeway"`
+	// TenantClaim names the claim forwarded as X-Tenant-ID
+	TenantClaim string `yaml:"tenant_claim"`
+	// RolesClaim names the claim listing the token's roles; AdminRole among
+	// them lets a token act on /api/users/<id> paths of other users and call
+	// admin routes
+	RolesClaim string `yaml:"roles_claim"`
+	AdminRole  string `yaml:"admin_role"`
+}
+
+// RouteConfig maps a path prefix to an upstream service
+type RouteConfig struct {
+	Name string `yaml:"name"`
+	// Prefix may use * to match a single path segment, e.g. /api/users/*/notifications
+	Prefix string `yaml:"prefix"`
+	// Exact routes match only Prefix itself, not the paths below it
+	Exact    bool   `yaml:"exact"`
+	Upstream string `yaml:"upstream"`
+	Public   bool   `yaml:"public"`
+	// Admin routes are only for tokens with the admin role
+	Admin   bool          `yaml:"admin"`
+	Timeout time.Duration `yaml:"timeout"`
+	// RateLimit is requests per minute per client; 0 disables limiting
+	RateLimit int `yaml:"rate_limit"`
+	Burst     int `yaml:"burst"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Port:            "8080",
+		LogLevel:        "info",
+		ShutdownTimeout: 20 * time.Second,
+		Auth: AuthConfig{
+			Leeway:      30 * time.Second,
+			TenantClaim: "tenant",
+			RolesClaim:  "roles",
+			AdminRole:   "admin",
+		},
+		Routes: []RouteConfig{
+			{Name: "users", Prefix: "/api/users", Upstream: "http://user-service:3001", RateLimit: 100},
+			{Name: "orders", Prefix: "/api/orders", Upstream: "http://order-service:3002", RateLimit: 50},
+			// Listing and creating notifications reach every user's; users read theirs under /api/users/<id>
+			{Name: "notification-list", Prefix: "/api/notifications", Exact: true, Upstream: "http://notification-service:3003", Admin: true, RateLimit: 200},
+			{Name: "notifications", Prefix: "/api/notifications", Upstream: "http://notification-service:3003", RateLimit: 200},
+			{Name: "user-notifications", Prefix: "/api/users/*/notifications", Upstream: "http://notification-service:3003", RateLimit: 200},
+			{Name: "notification-stream", Prefix: "/api/users/*/notifications/stream", Upstream: "http://notification-service:3003", RateLimit: 20},
+			{Name: "notification-websocket", Prefix: "/api/users/*/notifications/ws", Upstream: "http://notification-service:3003", RateLimit: 20},
+			{Name: "send", Prefix: "/api/send", Upstream: "http://notification-service:3003", Admin: true, RateLimit: 200},
+			{Name: "templates", Prefix: "/api/templates", Upstream: "http://notification-service:3003", RateLimit: 50},
+			{Name: "user-suppressions", Prefix: "/api/users/*/suppressions", Upstream: "http://notification-service:3003", RateLimit: 50},
+			{Name: "webhooks", Prefix: "/api/webhooks", Upstream: "http://notification-service:3003", Public: true, RateLimit: 600},
+			{Name: "unsubscribe", Prefix: "/unsubscribe", Upstream: "http://notification-service:3003", Public: true, RateLimit: 20},
+		},
+	}
+}
+
+// loadConfig resolves the configuration from defaults, the routes file and the environment
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// The ConfigMap is optional
+		case err != nil:
+			return cfg, fmt.Errorf("reading %s: %w", path, err)
+		default:
+			decoder := yaml.NewDecoder(bytes.NewReader(data))
+			decoder.KnownFields(true)
+			if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+				return cfg, fmt.Errorf("parsing %s: %w", path, err)
+			}
+		}
+	}
+
+	var errs []error
+	if value, ok := os.LookupEnv("PORT"); ok {
+		cfg.Port = value
+	}
+	if value, ok := os.LookupEnv("LOG_LEVEL"); ok {
+		cfg.LogLevel = value
+	}
+	if value, ok := os.LookupEnv("SHUTDOWN_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SHUTDOWN_TIMEOUT: %w", err))
+		} else {
+			cfg.ShutdownTimeout = timeout
+		}
+	}
+	cfg.Auth.HMACSecret = os.Getenv("JWT_SECRET")
+	if value, ok := os.LookupEnv("JWT_PUBLIC_KEY_FILE"); ok {
+		cfg.Auth.PublicKeyFile = value
+	}
+	if value, ok := os.LookupEnv("JWT_ISSUER"); ok {
+		cfg.Auth.Issuer = value
+	}
+	if value, ok := os.LookupEnv("JWT_AUDIENCE"); ok {
+		cfg.Auth.Audience = value
+	}
+	if value, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		cfg.TrustedProxies = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	return cfg, errors.Join(append(errs, cfg.Validate())...)
+}
+
+// Validate reports every invalid setting in cfg
+func (cfg Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %q is not a valid port", cfg.Port))
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout: must be positive"))
+	}
+
+	names := make(map[string]bool)
+	needsAuth := false
+	for i, route := range cfg.Routes {
+		prefix := fmt.Sprintf("routes[%d]", i)
+		if route.Name == "" || names[route.Name] {
+			errs = append(errs, fmt.Errorf("%s.name: must be unique and not empty", prefix))
+		}
+		names[route.Name] = true
+		if !strings.HasPrefix(route.Prefix, "/") {
+			errs = append(errs, fmt.Errorf("%s.prefix: must start with /", prefix))
+		}
+		if u, err := url.Parse(route.Upstream); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s.upstream: %q is not an absolute URL", prefix, route.Upstream))
+		}
+		if route.Admin && route.Public {
+			errs = append(errs, fmt.Errorf("%s: admin routes cannot be public", prefix))
+		}
+		if route.RateLimit < 0 || route.Burst < 0 || route.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s: rate_limit, burst and timeout must not be negative", prefix))
+		}
+		needsAuth = needsAuth || !route.Public
+	}
+
+	if _, err := parsePrefixes(cfg.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("trusted_proxies: %w", err))
+	}
+
+	if needsAuth && cfg.Auth.HMACSecret == "" && cfg.Auth.PublicKeyFile == "" {
+		errs = append(errs, errors.New("auth: JWT_SECRET or JWT_PUBLIC_KEY_FILE is required for non-public routes"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// parsePrefixes parses addresses and CIDRs, a bare address matching only itself
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR", value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func main() {
+	logLevel := new(slog.LevelVar)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})).
+		With("service", "api-gateway")
+	slog.SetDefault(logger)
+
+	cfg, err := loadConfig(os.Getenv("ROUTES_FILE"))
+	if err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	if err := logLevel.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		logger.Warn("unknown log level, using info", "level", cfg.LogLevel)
+	}
+
+	verifier, err := newVerifier(cfg.Auth)
+	if err != nil {
+		logger.Error("invalid JWT configuration", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	gateway := newGateway(cfg, verifier)
+	go gateway.SweepLimiters(ctx, time.Minute)
+
+	var draining atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":    "healthy",
+			"service":   "api-gateway",
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "shutting_down", "service": "api-gateway"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ready", "service": "api-gateway"})
+	})
+	// OpenMetrics, when asked for, carries the trace exemplars on request durations
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	mux.Handle("/", requestIDMiddleware(gateway, gateway.clientIP))
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	logger.Info("API gateway running", "port", cfg.Port, "routes", len(cfg.Routes))
+
+	select {
+	case err := <-errCh:
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutdown signal received, draining", "timeout", cfg.ShutdownTimeout.String())
+	draining.Store(true)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("server did not shut down cleanly", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("shutdown complete")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body map[string]any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/reqctx"
+)
+
+// Gateway metrics, labelled by route so every service's edge traffic is in one place
+var (
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_requests_total",
+			Help: "Total number of requests handled by the gateway",
+		},
+		[]string{"route", "method", "status"},
+	)
+
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_request_duration_seconds",
+			Help:    "Request duration at the gateway, including the upstream call",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route", "method"},
+	)
+
+	upstreamErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_errors_total",
+			Help: "Total number of requests that failed to reach the upstream service",
+		},
+		[]string{"route"},
+	)
+
+	rateLimitedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_rate_limited_total",
+			Help: "Total number of requests rejected by the per-route rate limit",
+		},
+		[]string{"route"},
+	)
+
+	authFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_auth_failures_total",
+			Help: "Total number of requests rejected by JWT validation",
+		},
+		[]string{"route", "reason"},
+	)
+)
+
+// methodLabel returns method for the standard HTTP methods and OTHER for
+// anything else, so scanners sending made-up methods cannot add series
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// observeWithTrace records v, attaching the trace r is part of as an exemplar when the mesh traced it
+func observeWithTrace(obs prometheus.Observer, v float64, r *http.Request) {
+	if exemplars, ok := obs.(prometheus.ExemplarObserver); ok {
+		if id := reqctx.TraceIDFromHeader(r.Header); id != "" {
+			exemplars.ObserveWithExemplar(v, prometheus.Labels{"trace_id": id})
+			return
+		}
+	}
+	obs.Observe(v)
+}
+
+func init() {
+	prometheus.MustRegister(requestsTotal)
+	prometheus.MustRegister(requestDuration)
+	prometheus.MustRegister(upstreamErrorsTotal)
+	prometheus.MustRegister(rateLimitedTotal)
+	prometheus.MustRegister(authFailuresTotal)
+}
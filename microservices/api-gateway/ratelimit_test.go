@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter(60, 3)
+
+	for i := 2; i >= 0; i-- {
+		if allowed, remaining, _ := l.Allow("alice", now); !allowed || remaining != i {
+			t.Fatalf("request %d: allowed %v with %d remaining, want %d", 3-i, allowed, remaining, i)
+		}
+	}
+	allowed, _, wait := l.Allow("alice", now)
+	if allowed || wait != time.Second {
+		t.Errorf("fourth request: allowed %v, wait %v; want a one second wait", allowed, wait)
+	}
+	// Each client has its own bucket
+	if allowed, _, _ := l.Allow("bob", now); !allowed {
+		t.Error("another client was limited")
+	}
+
+	// A token a second refills the bucket
+	if allowed, _, _ := l.Allow("alice", now.Add(time.Second)); !allowed {
+		t.Error("request after the refill was limited")
+	}
+
+	l.Sweep(now.Add(2 * time.Second))
+	if _, ok := l.buckets["alice"]; !ok {
+		t.Error("swept a bucket that has not refilled")
+	}
+	l.Sweep(now.Add(time.Minute))
+	if len(l.buckets) != 0 {
+		t.Errorf("%d buckets left after they all refilled", len(l.buckets))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader     = "X-Request-ID"
+	correlationIDHeader = "X-Correlation-ID"
+)
+
+type loggerKey struct{}
+
+// loggerFrom returns the request-scoped logger stored in ctx, or the default logger
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// requestIDMiddleware makes sure every request entering the platform has an ID
+//
+// A client-supplied ID is kept so callers can correlate their own logs; it
+// is forwarded upstream under both header names and echoed on the response.
+// Each request is logged once it completes, with the client clientIP finds.
+func requestIDMiddleware(next http.Handler, clientIP func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			id = r.Header.Get(correlationIDHeader)
+		}
+		if id == "" {
+			id = uuid.New().String()
+		}
+		r.Header.Set(requestIDHeader, id)
+		r.Header.Set(correlationIDHeader, id)
+		w.Header().Set(requestIDHeader, id)
+		w.Header().Set(correlationIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		r = r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger))
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		logger.Info("request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", clientIP(r),
+		)
+	})
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers the gateway sets from the validated token; clients may not supply them
+var identityHeaders = []string{"X-User-ID", "X-User-Admin", "X-Tenant-ID", "X-Consumer-Username", "X-Token-Expires"}
+
+// route is a compiled RouteConfig
+type route struct {
+	cfg      RouteConfig
+	segments []string
+	proxy    *httputil.ReverseProxy
+	limiter  *rateLimiter
+}
+
+// matches reports whether path falls under the route prefix
+func (rt *route) matches(path string) bool {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < len(rt.segments) || rt.cfg.Exact && len(parts) != len(rt.segments) {
+		return false
+	}
+	for i, segment := range rt.segments {
+		if segment != "*" && segment != parts[i] {
+			return false
+		}
+		if segment == "*" && parts[i] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (rt *route) wildcards() int {
+	n := 0
+	for _, segment := range rt.segments {
+		if segment == "*" {
+			n++
+		}
+	}
+	return n
+}
+
+// Gateway routes requests to upstream services after authentication and rate limiting
+type Gateway struct {
+	routes   []*route
+	verifier *verifier
+	trusted  []netip.Prefix
+}
+
+func newGateway(cfg Config, verifier *verifier) *Gateway {
+	// Validate has already rejected malformed proxies
+	trusted, _ := parsePrefixes(cfg.TrustedProxies)
+	g := &Gateway{verifier: verifier, trusted: trusted}
+	for _, rc := range cfg.Routes {
+		upstream, _ := url.Parse(rc.Upstream)
+		rt := &route{
+			cfg:      rc,
+			segments: strings.Split(strings.Trim(rc.Prefix, "/"), "/"),
+			proxy:    newProxy(rc.Name, upstream),
+		}
+		if rc.RateLimit > 0 {
+			rt.limiter = newRateLimiter(rc.RateLimit, rc.Burst)
+		}
+		g.routes = append(g.routes, rt)
+	}
+
+	// Most specific route first: more segments, then fewer wildcards, then exact
+	sort.SliceStable(g.routes, func(i, j int) bool {
+		a, b := g.routes[i], g.routes[j]
+		if len(a.segments) != len(b.segments) {
+			return len(a.segments) > len(b.segments)
+		}
+		if a.wildcards() != b.wildcards() {
+			return a.wildcards() < b.wildcards()
+		}
+		return a.cfg.Exact && !b.cfg.Exact
+	})
+	return g
+}
+
+func newProxy(name string, upstream *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.SetXForwarded()
+			r.Out.Host = r.In.Host
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			upstreamErrorsTotal.WithLabelValues(name).Inc()
+			status := http.StatusBadGateway
+			if r.Context().Err() == context.DeadlineExceeded {
+				status = http.StatusGatewayTimeout
+			}
+			loggerFrom(r.Context()).Warn("upstream request failed", "route", name, "error", err)
+			writeError(w, status, http.StatusText(status))
+		},
+	}
+}
+
+func (g *Gateway) match(path string) *route {
+	for _, rt := range g.routes {
+		if rt.matches(path) {
+			return rt
+		}
+	}
+	return nil
+}
+
+// SweepLimiters periodically frees idle rate limit buckets until ctx is cancelled
+func (g *Gateway) SweepLimiters(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, rt := range g.routes {
+				if rt.limiter != nil {
+					rt.limiter.Sweep(now)
+				}
+			}
+		}
+	}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt := g.match(r.URL.Path)
+	if rt == nil {
+		requestsTotal.WithLabelValues("unmatched", methodLabel(r.Method), "404").Inc()
+		writeError(w, http.StatusNotFound, "Route not found")
+		return
+	}
+
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		method := methodLabel(r.Method)
+		requestsTotal.WithLabelValues(rt.cfg.Name, method, strconv.Itoa(recorder.status)).Inc()
+		observeWithTrace(requestDuration.WithLabelValues(rt.cfg.Name, method), time.Since(start).Seconds(), r)
+	}()
+	g.serveRoute(recorder, r, rt)
+}
+
+func (g *Gateway) serveRoute(w http.ResponseWriter, r *http.Request, rt *route) {
+	for _, header := range identityHeaders {
+		r.Header.Del(header)
+	}
+
+	client := g.clientIP(r)
+	if !rt.cfg.Public {
+		claims, err := g.verifier.Verify(authorization(r))
+		if err != nil {
+			authFailuresTotal.WithLabelValues(rt.cfg.Name, err.Error()).Inc()
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		admin := g.verifier.IsAdmin(claims)
+		if rt.cfg.Admin && !admin {
+			authFailuresTotal.WithLabelValues(rt.cfg.Name, errNotAdmin.Error()).Inc()
+			writeError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		// A user's paths are only theirs to call, unless the token is an admin's
+		if userID, ok := pathUser(r.URL.Path); ok && userID != claims.Subject && !admin {
+			authFailuresTotal.WithLabelValues(rt.cfg.Name, errOtherUser.Error()).Inc()
+			writeError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		client = claims.Subject
+		r.Header.Set("X-User-ID", claims.Subject)
+		// Upstreams check ownership of what they serve by ID, which admins may bypass
+		if admin {
+			r.Header.Set("X-User-Admin", "true")
+		}
+		r.Header.Set("X-Consumer-Username", claims.Subject)
+		if claims.Tenant != "" {
+			r.Header.Set("X-Tenant-ID", claims.Tenant)
+		}
+		// Long-lived connections are closed upstream once the token expires
+		if !claims.ExpiresAt.IsZero() {
+			r.Header.Set("X-Token-Expires", strconv.FormatInt(claims.ExpiresAt.Unix(), 10))
+		}
+	}
+
+	if rt.limiter != nil {
+		allowed, remaining, wait := rt.limiter.Allow(client, time.Now())
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rt.cfg.RateLimit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			rateLimitedTotal.WithLabelValues(rt.cfg.Name).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			writeError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+	}
+
+	if rt.cfg.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), rt.cfg.Timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	rt.proxy.ServeHTTP(w, r)
+}
+
+// authorization returns the Authorization header of r
+//
+// Browsers cannot set headers on WebSocket handshakes, so those may carry the
+// bearer token as the access_token query parameter instead. It is removed
+// before the request is proxied so it does not reach upstream logs.
+func authorization(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return header
+	}
+	query := r.URL.Query()
+	token := query.Get("access_token")
+	if token == "" {
+		return ""
+	}
+	query.Del("access_token")
+	r.URL.RawQuery = query.Encode()
+	return "Bearer " + token
+}
+
+// pathUser returns the user ID of /api/users/<id> paths and those below them
+//
+// The mux has already cleaned the path, so dot segments cannot smuggle in another ID.
+func pathUser(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, "/api/users/")
+	if !ok {
+		return "", false
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	return id, id != ""
+}
+
+// clientIP identifies anonymous clients for rate limiting
+//
+// X-Forwarded-For is only believed from trusted proxies. Each of them appends
+// the peer it saw, so walking the header back from the peer of this request,
+// the first address that is not a trusted proxy is the client; anything to
+// its left could be forged.
+func (g *Gateway) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !g.trustedProxy(host) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !g.trustedProxy(hops[i]) {
+			return hops[i]
+		}
+		host = hops[i]
+	}
+	return host
+}
+
+func (g *Gateway) trustedProxy(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range g.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// statusRecorder captures the response status for metrics and logs
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses working through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through the recorder
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"success": false,
+		"error":   message,
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	g := newGateway(Config{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}}, nil)
+	for _, tc := range []struct {
+		name      string
+		peer      string
+		forwarded []string
+		want      string
+	}{
+		{"direct", "203.0.113.7:4000", nil, "203.0.113.7"},
+		// Only a trusted proxy may say who the client is
+		{"untrusted peer", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"through the ingress", "10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"forged entries", "10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of proxies", "10.1.2.3:4000", []string{"198.51.100.1, 192.0.2.1", "10.9.9.9"}, "198.51.100.1"},
+		{"only proxies", "10.1.2.3:4000", []string{"10.4.4.4"}, "10.4.4.4"},
+		{"ipv4 mapped peer", "[::ffff:10.1.2.3]:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+		r.RemoteAddr = tc.peer
+		for _, value := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := g.clientIP(r); got != tc.want {
+			t.Errorf("%s: clientIP = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	// Without trusted proxies the header is ignored
+	r := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+	r.RemoteAddr = "10.1.2.3:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := newGateway(Config{}, nil).clientIP(r); got != "10.1.2.3" {
+		t.Errorf("clientIP without trusted proxies = %s, want the peer", got)
+	}
+}
+
+func TestUserPaths(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-User-ID")))
+	}))
+	defer upstream.Close()
+
+	cfg := defaultConfig()
+	cfg.Auth.HMACSecret = "secret"
+	cfg.Routes = []RouteConfig{
+		{Name: "users", Prefix: "/api/users", Upstream: upstream.URL},
+		{Name: "user-notifications", Prefix: "/api/users/*/notifications", Upstream: upstream.URL},
+	}
+	v := &verifier{cfg: cfg.Auth, now: func() time.Time { return testNow }}
+	g := newGateway(cfg, v)
+
+	alice := signedToken("HS256", with(validClaims(), "roles", []string{"member"}), hmacSigner([]byte("secret")))
+	admin := signedToken("HS256", with(with(validClaims(), "sub", "ops"), "roles", []string{"member", "admin"}), hmacSigner([]byte("secret")))
+	for _, tc := range []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"own notifications", "/api/users/alice/notifications", alice, http.StatusOK},
+		{"own profile", "/api/users/alice", alice, http.StatusOK},
+		{"another user's notifications", "/api/users/bob/notifications", alice, http.StatusForbidden},
+		{"another user's profile", "/api/users/bob", alice, http.StatusForbidden},
+		{"user list", "/api/users", alice, http.StatusOK},
+		{"admin", "/api/users/bob/notifications", admin, http.StatusOK},
+		{"no token", "/api/users/alice/notifications", "", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s: GET %s = %d, want %d", tc.name, tc.path, w.Code, tc.want)
+		}
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-User-Admin")))
+	}))
+	defer upstream.Close()
+
+	cfg := defaultConfig()
+	cfg.Auth.HMACSecret = "secret"
+	for i := range cfg.Routes {
+		cfg.Routes[i].Upstream = upstream.URL
+	}
+	v := &verifier{cfg: cfg.Auth, now: func() time.Time { return testNow }}
+	g := newGateway(cfg, v)
+
+	alice := signedToken("HS256", with(validClaims(), "roles", []string{"member"}), hmacSigner([]byte("secret")))
+	admin := signedToken("HS256", with(with(validClaims(), "sub", "ops"), "roles", []string{"member", "admin"}), hmacSigner([]byte("secret")))
+	for _, tc := range []struct {
+		name      string
+		method    string
+		path      string
+		token     string
+		want      int
+		wantAdmin string
+	}{
+		// Listing, creating and sending reach every user's notifications
+		{"list", http.MethodGet, "/api/notifications", alice, http.StatusForbidden, ""},
+		{"create", http.MethodPost, "/api/notifications", alice, http.StatusForbidden, ""},
+		{"send", http.MethodPost, "/api/send", alice, http.StatusForbidden, ""},
+		{"admin list", http.MethodGet, "/api/notifications", admin, http.StatusOK, "true"},
+		{"admin send", http.MethodPost, "/api/send", admin, http.StatusOK, "true"},
+		// Single notifications pass through, for the service to check their owner
+		{"by ID", http.MethodGet, "/api/notifications/n1", alice, http.StatusOK, ""},
+		{"deliveries", http.MethodGet, "/api/notifications/n1/deliveries", alice, http.StatusOK, ""},
+		{"admin by ID", http.MethodDelete, "/api/notifications/n1", admin, http.StatusOK, "true"},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		r.Header.Set("Authorization", "Bearer "+tc.token)
+		// Clients cannot claim to be admins themselves
+		r.Header.Set("X-User-Admin", "true")
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s: %s %s = %d, want %d", tc.name, tc.method, tc.path, w.Code, tc.want)
+			continue
+		}
+		if w.Code == http.StatusOK && w.Body.String() != tc.wantAdmin {
+			t.Errorf("%s: upstream saw X-User-Admin %q, want %q", tc.name, w.Body.String(), tc.wantAdmin)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/logging"
+)
+
+const redactedValue = "[REDACTED]"
+
+// accessLogRoute controls access logging for a single route
+type accessLogRoute struct {
+	Disabled       bool
+	BodySampleRate float64
+}
+
+// accessLogConfig controls what the access log records
+type accessLogConfig struct {
+	defaults     accessLogRoute
+	routes       map[string]accessLogRoute
+	redactFields map[string]bool
+	redactRegexp *regexp.Regexp
+	maxBodyBytes int
+}
+
+// newAccessLogConfig compiles the access log settings
+//
+// Routes override the defaults per route, keyed by method and route pattern:
+// "POST /api/send" => "0.5", "GET /api/notifications" => "off".
+func newAccessLogConfig(settings AccessLogConfig) *accessLogConfig {
+	cfg := &accessLogConfig{
+		defaults:     accessLogRoute{BodySampleRate: settings.BodySampleRate},
+		routes:       map[string]accessLogRoute{},
+		redactFields: map[string]bool{},
+		maxBodyBytes: settings.MaxBodyBytes,
+	}
+
+	for route, value := range settings.Routes {
+		if value == "off" {
+			cfg.routes[route] = accessLogRoute{Disabled: true}
+			continue
+		}
+		// Validated with the rest of the configuration
+		rate, _ := strconv.ParseFloat(value, 64)
+		cfg.routes[route] = accessLogRoute{BodySampleRate: rate}
+	}
+
+	quoted := make([]string, 0, len(settings.RedactFields))
+	for _, field := range settings.RedactFields {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		cfg.redactFields[field] = true
+		quoted = append(quoted, regexp.QuoteMeta(field))
+	}
+	if len(quoted) > 0 {
+		// Fallback for bodies that are not valid JSON
+		cfg.redactRegexp = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"|[^,}\s]+)`)
+	}
+	return cfg
+}
+
+func (cfg *accessLogConfig) route(method, path string) accessLogRoute {
+	if route, ok := cfg.routes[method+" "+path]; ok {
+		return route
+	}
+	return cfg.defaults
+}
+
+// redactBody returns body with PII fields masked
+func (cfg *accessLogConfig) redactBody(body []byte) any {
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		raw := string(body)
+		if cfg.redactRegexp != nil {
+			raw = cfg.redactRegexp.ReplaceAllString(raw, `${1}"`+redactedValue+`"`)
+		}
+		return raw
+	}
+	return cfg.redactValue(payload)
+}
+
+func (cfg *accessLogConfig) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, nested := range v {
+			if cfg.redactFields[strings.ToLower(key)] {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = cfg.redactValue(nested)
+		}
+	case []any:
+		for i, nested := range v {
+			v[i] = cfg.redactValue(nested)
+		}
+	}
+	return value
+}
+
+// Access log middleware
+//
+// The configuration is read through an atomic pointer so it can be swapped on
+// config reload.
+func accessLogMiddleware(config *atomic.Pointer[accessLogConfig]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.Load()
+		route := cfg.route(c.Request.Method, c.FullPath())
+		if route.Disabled {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+
+		var body []byte
+		truncated := false
+		if route.BodySampleRate > 0 && c.Request.Body != nil && rand.Float64() < route.BodySampleRate {
+			body, _ = io.ReadAll(io.LimitReader(c.Request.Body, int64(cfg.maxBodyBytes)+1))
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+			if len(body) > cfg.maxBodyBytes {
+				body = body[:cfg.maxBodyBytes]
+				truncated = true
+			}
+		}
+
+		c.Next()
+
+		// Probe and scrape traffic is only interesting when debugging
+		level := slog.LevelInfo
+		switch c.FullPath() {
+		case "/health", "/ready", "/metrics":
+			level = slog.LevelDebug
+		}
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"response_bytes", c.Writer.Size(),
+		}
+		if consumer := c.GetHeader("X-Consumer-Username"); consumer != "" {
+			attrs = append(attrs, "consumer", consumer)
+		}
+		if len(body) > 0 {
+			attrs = append(attrs, "request_body", cfg.redactBody(body))
+			if truncated {
+				attrs = append(attrs, "request_body_truncated", true)
+			}
+		}
+
+		logging.FromContext(c.Request.Context()).Log(c.Request.Context(), level, "request completed", attrs...)
+	}
+}
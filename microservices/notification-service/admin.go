@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// minAdminKeyLength is the shortest accepted admin API key, in bytes
+const minAdminKeyLength = 16
+
+// adminAuth lets a request through when it carries apiKey, as a bearer token or in X-API-Key
+//
+// An empty apiKey leaves the admin API open, as it was before keys existed.
+func adminAuth(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey == "" {
+			c.Next()
+			return
+		}
+		key := c.GetHeader("X-API-Key")
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			key = bearer
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Invalid or missing API key",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// redriveResult is what a redrive queued, and what it left dead-lettered
+type redriveResult struct {
+	Redriven  int `json:"redriven"`
+	Remaining int `json:"remaining"`
+}
+
+// templateCheck is the outcome of validating one template
+type templateCheck struct {
+	Name    string `json:"name"`
+	Valid   bool   `json:"valid"`
+	Error   string `json:"error,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// checkTemplates compiles each NotificationTemplate resource and renders it against its sample data
+func checkTemplates(resources []templateResource) []templateCheck {
+	checks := make([]templateCheck, len(resources))
+	for i, resource := range resources {
+		check := templateCheck{Name: resource.Metadata.Name}
+		t, err := validateTemplate(resource)
+		if err == nil && check.Name == "" {
+			err = errors.New("metadata.name is required")
+		}
+		if err == nil && resource.Spec.SampleData != nil {
+			check.Title, check.Message, err = t.Render(resource.Spec.SampleData)
+		}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		check.Valid = err == nil
+		checks[i] = check
+	}
+	return checks
+}
+
+// registerAdminRoutes adds the operator endpoints notifyctl talks to
+func registerAdminRoutes(admin *gin.RouterGroup, service *notificationService) {
+	admin.GET("/dead-letters", func(c *gin.Context) {
+		jobs := service.dispatcher.DeadLetters()
+		if id := c.Query("notification_id"); id != "" {
+			matching := []deliveryJob{}
+			for _, job := range jobs {
+				if job.Notification.ID == id {
+					matching = append(matching, job)
+				}
+			}
+			jobs = matching
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    jobs,
+			"count":   len(jobs),
+		})
+	})
+
+	// Queue dead letters again, all of them or one notification's
+	admin.POST("/dead-letters/redrive", func(c *gin.Context) {
+		redriven, err := service.dispatcher.Redrive(c.Query("notification_id"))
+		// A partial redrive still succeeded; the rest can be redriven once the queue drains
+		if err != nil && redriven == 0 {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": redriveResult{
+				Redriven:  redriven,
+				Remaining: len(service.dispatcher.DeadLetters()),
+			},
+		})
+	})
+
+	// Remove notifications older than ?older_than, except pinned ones, and expired broadcasts
+	admin.POST("/purge", func(c *gin.Context) {
+		olderThan, err := time.ParseDuration(c.Query("older_than"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "older_than must be a duration, e.g. 720h",
+			})
+			return
+		}
+		result, err := service.Purge(c.Request.Context(), olderThan)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    result,
+		})
+	})
+
+	// Check NotificationTemplate resources before they are applied
+	admin.POST("/templates/validate", func(c *gin.Context) {
+		var req struct {
+			Templates []templateResource `json:"templates" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		checks := checkTemplates(req.Templates)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    checks,
+			"count":   len(checks),
+		})
+	})
+}
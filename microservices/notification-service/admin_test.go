@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/admin/ping", adminAuth("0123456789abcdef"), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	open := gin.New()
+	open.GET("/api/admin/ping", adminAuth(""), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, tc := range []struct {
+		name   string
+		router *gin.Engine
+		header string
+		value  string
+		want   int
+	}{
+		{"bearer", r, "Authorization", "Bearer 0123456789abcdef", http.StatusNoContent},
+		{"header", r, "X-API-Key", "0123456789abcdef", http.StatusNoContent},
+		{"wrong key", r, "Authorization", "Bearer 0123456789abcdeX", http.StatusUnauthorized},
+		{"no key", r, "", "", http.StatusUnauthorized},
+		{"open", open, "", "", http.StatusNoContent},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/ping", nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		rec := httptest.NewRecorder()
+		tc.router.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(2, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	for _, id := range []string{"n1", "n2", "n3", "n4"} {
+		dispatcher.deadLetters = append(dispatcher.deadLetters, deliveryJob{
+			Notification: testNotification(id, "alice"),
+			Channel:      channelEmail,
+			Attempt:      cfg.Delivery.MaxAttempts,
+			LastError:    "provider down",
+		})
+	}
+
+	if n, err := dispatcher.Redrive("n3"); n != 1 || err != nil {
+		t.Fatalf("Redrive(n3) = %d, %v; want 1, nil", n, err)
+	}
+	job := <-dispatcher.standard.queue
+	dispatcher.pending.Done()
+	if job.Notification.ID != "n3" || job.Attempt != 1 || job.LastError != "" {
+		t.Errorf("redriven job = %+v", job)
+	}
+
+	// The queue holds two, so the third is left dead-lettered
+	n, err := dispatcher.Redrive("")
+	if n != 2 || !errors.Is(err, errQueueFull) {
+		t.Fatalf("Redrive() = %d, %v; want 2, errQueueFull", n, err)
+	}
+	left := dispatcher.DeadLetters()
+	if len(left) != 1 || left[0].Notification.ID != "n4" || left[0].LastError != "provider down" {
+		t.Errorf("dead letters left = %+v", left)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	old, pinned, recent := testNotification("old", "alice"), testNotification("pinned", "alice"), testNotification("recent", "bob")
+	old.CreatedAt, pinned.CreatedAt, recent.CreatedAt = now.Add(-48*time.Hour), now.Add(-48*time.Hour), now.Add(-time.Hour)
+	pinned.Pinned = true
+	store := newNotificationStore(old, pinned, recent)
+
+	broadcasts := newBroadcastStore()
+	expired, current := now.Add(-time.Minute), now.Add(time.Hour)
+	broadcasts.Add(broadcast{ID: "bc-expired", Type: "system", ExpiresAt: &expired})
+	broadcasts.Add(broadcast{ID: "bc-current", Type: "system", ExpiresAt: &current})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAdminRoutes(r.Group("/api/admin"), testService(store, broadcasts, newFakeClock(now)))
+	purge := func(query string) (int, purgeResult) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/admin/purge"+query, nil))
+		var resp struct {
+			Data purgeResult `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Data
+	}
+
+	code, result := purge("?older_than=24h")
+	if code != http.StatusOK || result.Notifications != 1 || result.Broadcasts != 1 || !result.Cutoff.Equal(now.Add(-24*time.Hour)) {
+		t.Fatalf("purge returned %d, %+v", code, result)
+	}
+	if got := ids(store.List()); got != "pinned,recent" {
+		t.Errorf("notifications left = %s, want pinned,recent", got)
+	}
+	if list := broadcasts.List(); len(list) != 1 || list[0].ID != "bc-current" {
+		t.Errorf("broadcasts left = %+v", list)
+	}
+
+	for _, query := range []string{"", "?older_than=soon", "?older_than=-1h"} {
+		if code, _ := purge(query); code != http.StatusBadRequest {
+			t.Errorf("purge%s returned %d, want 400", query, code)
+		}
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAdminRoutes(r.Group("/api/admin"), testService(newNotificationStore(), newBroadcastStore(), systemClock{}))
+
+	body := `{"templates":[
+		{"metadata":{"name":"order-shipped"},"spec":{"subject":"Order #{{ .order_id }} shipped","body":"On its way","sampleData":{"order_id":"42"}}},
+		{"metadata":{"name":"broken"},"spec":{"subject":"{{ .order_id","body":"x"}},
+		{"metadata":{"name":"missing-field"},"spec":{"subject":"{{ .order_id }}","body":"x","sampleData":{}}}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/templates/validate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var resp struct {
+		Data []templateCheck `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Data) != 3 {
+		t.Fatalf("validate returned %d, %s", rec.Code, rec.Body)
+	}
+	if ok := resp.Data[0]; !ok.Valid || ok.Title != "Order #42 shipped" {
+		t.Errorf("valid template = %+v", ok)
+	}
+	for _, check := range resp.Data[1:] {
+		if check.Valid || check.Error == "" {
+			t.Errorf("invalid template %s passed: %+v", check.Name, check)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminUI is the single-page triage console served under /admin
+//
+//go:embed adminui
+var adminUI embed.FS
+
+// maxRecentNotifications bounds how many notifications the console lists
+const maxRecentNotifications = 500
+
+// adminUIPolicy keeps the console to its own assets and API
+const adminUIPolicy = "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+// queueStatus is the delivery queue and event consumers at a glance
+type queueStatus struct {
+	Depth       int                          `json:"depth"`
+	Capacity    int                          `json:"capacity"`
+	InFlight    int                          `json:"in_flight"`
+	Workers     int                          `json:"workers"`
+	Lanes       map[string]int               `json:"lanes"`
+	DeadLetters int                          `json:"dead_letters"`
+	ConsumerLag map[string]consumerLagStatus `json:"consumer_lag"`
+}
+
+// consumerLagStatus is one event pipeline's lag as of its last fetch
+type consumerLagStatus struct {
+	Messages int64  `json:"messages"`
+	Delay    string `json:"delay,omitempty"`
+}
+
+// readQueueStatus reads the queue gauges off dispatcher and lag
+func readQueueStatus(dispatcher *Dispatcher, lag *consumerLag) queueStatus {
+	s := queueStatus{
+		Depth:       dispatcher.QueueDepth(),
+		Capacity:    dispatcher.QueueCapacity(),
+		InFlight:    dispatcher.InFlight(),
+		Workers:     dispatcher.Workers(),
+		Lanes:       make(map[string]int),
+		DeadLetters: len(dispatcher.DeadLetters()),
+		ConsumerLag: make(map[string]consumerLagStatus),
+	}
+	for _, lane := range dispatcher.Lanes() {
+		s.Lanes[lane] = dispatcher.LaneDepth(lane)
+	}
+	for pipeline, l := range lag.Pipelines() {
+		pipelineStatus := consumerLagStatus{Messages: l.messages}
+		if l.delay > 0 {
+			pipelineStatus.Delay = l.delay.Round(time.Second).String()
+		}
+		s.ConsumerLag[pipeline] = pipelineStatus
+	}
+	return s
+}
+
+// registerAdminUI serves the console's page and assets under /admin
+//
+// The page itself is public; it asks for the admin API key and sends it
+// with every call to the admin API, which stays the only thing guarded.
+func registerAdminUI(r *gin.Engine) {
+	assets, err := fs.Sub(adminUI, "adminui")
+	if err != nil {
+		panic(err)
+	}
+	serve := func(c *gin.Context, name, contentType string) {
+		body, err := fs.ReadFile(assets, name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Not found",
+			})
+			return
+		}
+		c.Header("Content-Security-Policy", adminUIPolicy)
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, contentType, body)
+	}
+
+	r.GET("/admin", func(c *gin.Context) {
+		serve(c, "index.html", "text/html; charset=utf-8")
+	})
+	r.GET("/admin/app.js", func(c *gin.Context) {
+		serve(c, "app.js", "text/javascript; charset=utf-8")
+	})
+	r.GET("/admin/app.css", func(c *gin.Context) {
+		serve(c, "app.css", "text/css; charset=utf-8")
+	})
+}
+
+// registerTriageRoutes adds the admin endpoints behind the console that the
+// rest of the admin API does not already cover
+func registerTriageRoutes(admin *gin.RouterGroup, service *notificationService, lag *consumerLag) {
+	admin.GET("/queue", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    readQueueStatus(service.dispatcher, lag),
+		})
+	})
+
+	// Failed attempts, newest first, whether they were retried or dead-lettered
+	admin.GET("/failures", func(c *gin.Context) {
+		failures := service.dispatcher.RecentFailures()
+		slices.Reverse(failures)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    failures,
+			"count":   len(failures),
+		})
+	})
+
+	// The latest notifications, newest first; ?limit= defaults to 50
+	admin.GET("/notifications/recent", func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > maxRecentNotifications {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "limit must be between 1 and " + strconv.Itoa(maxRecentNotifications),
+			})
+			return
+		}
+		// Scan's order only holds within a shard, so the newest are picked by creation time
+		recent := make([]Notification, 0, limit)
+		service.repo.Scan(func(notification Notification) error {
+			recent = keepNewest(recent, notification, limit)
+			return nil
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    recent,
+			"count":   len(recent),
+		})
+	})
+}
+
+// keepNewest inserts notification into recent, which is sorted newest first,
+// keeping at most limit notifications
+func keepNewest(recent []Notification, notification Notification, limit int) []Notification {
+	i := sort.Search(len(recent), func(i int) bool { return !recent[i].CreatedAt.After(notification.CreatedAt) })
+	if i == limit {
+		return recent
+	}
+	if len(recent) == limit {
+		recent = recent[:limit-1]
+	}
+	return slices.Insert(recent, i, notification)
+}
@@ -0,0 +1,190 @@
+// Triage console for the notification service, backed by the admin API.
+//
+// The admin API key is kept in sessionStorage, so it is gone when the tab
+// closes; every call sends it as X-API-Key.
+"use strict";
+
+const refreshInterval = 10000;
+const keyStorage = "notification-service-admin-key";
+
+let timer = null;
+
+function apiKey() {
+  return sessionStorage.getItem(keyStorage) || "";
+}
+
+async function api(method, path) {
+  const headers = {};
+  if (apiKey()) {
+    headers["X-API-Key"] = apiKey();
+  }
+  const resp = await fetch(path, { method, headers });
+  const body = await resp.json().catch(() => ({}));
+  if (!resp.ok || body.success === false) {
+    throw new Error(`${method} ${path}: ${body.error || resp.status}`);
+  }
+  return body.data;
+}
+
+// row builds a table row, cells being text or {text, className}
+function row(cells) {
+  const tr = document.createElement("tr");
+  for (const cell of cells) {
+    const td = document.createElement("td");
+    if (cell instanceof Node) {
+      td.append(cell);
+    } else if (cell && typeof cell === "object") {
+      td.textContent = cell.text;
+      td.className = cell.className;
+    } else {
+      td.textContent = cell ?? "";
+    }
+    tr.append(td);
+  }
+  return tr;
+}
+
+function fill(id, columns, rows) {
+  const body = document.getElementById(id);
+  if (rows.length === 0) {
+    const empty = row([{ text: "None", className: "empty" }]);
+    empty.firstChild.colSpan = columns;
+    body.replaceChildren(empty);
+    return;
+  }
+  body.replaceChildren(...rows);
+}
+
+function when(timestamp) {
+  return timestamp ? new Date(timestamp).toLocaleString() : "";
+}
+
+function renderQueue(queue) {
+  const gauges = [
+    ["Queued", `${queue.depth} / ${queue.capacity}`],
+    ["In flight", queue.in_flight],
+    ["Workers", queue.workers],
+    ["Dead letters", queue.dead_letters],
+  ];
+  for (const [lane, depth] of Object.entries(queue.lanes)) {
+    gauges.push([`Lane ${lane}`, depth]);
+  }
+  document.getElementById("gauges").replaceChildren(...gauges.map(([name, value]) => {
+    const div = document.createElement("div");
+    const dt = document.createElement("dt");
+    const dd = document.createElement("dd");
+    dt.textContent = name;
+    dd.textContent = value;
+    div.append(dt, dd);
+    return div;
+  }));
+  fill("lag", 3, Object.entries(queue.consumer_lag).map(([pipeline, lag]) =>
+    row([pipeline, lag.messages, lag.delay])));
+}
+
+function redriveButton(notificationID) {
+  const button = document.createElement("button");
+  button.type = "button";
+  button.textContent = "Redrive";
+  button.addEventListener("click", () => redrive(notificationID));
+  return button;
+}
+
+function renderDeadLetters(jobs) {
+  fill("dead-letters", 6, jobs.slice().reverse().map((job) => row([
+    job.notification.id,
+    job.channel,
+    job.attempt,
+    { text: job.last_error, className: "error" },
+    when(job.enqueued_at),
+    redriveButton(job.notification.id),
+  ])));
+}
+
+function renderFailures(jobs) {
+  fill("failures", 5, jobs.map((job) => row([
+    job.notification.id,
+    job.channel,
+    job.attempt,
+    { text: job.last_error, className: "error" },
+    when(job.enqueued_at),
+  ])));
+}
+
+function renderNotifications(notifications) {
+  fill("notifications", 7, notifications.map((n) => row([
+    when(n.created_at),
+    n.id,
+    n.user_id,
+    n.type,
+    n.title,
+    n.status,
+    n.template ? `${n.template} v${n.template_version}` : "",
+  ])));
+}
+
+function renderTemplates(templates) {
+  templates.sort((a, b) => a.name.localeCompare(b.name));
+  fill("templates", 4, templates.map((t) => row([t.name, t.version, t.subject, t.source])));
+}
+
+function showError(err) {
+  const box = document.getElementById("error");
+  box.textContent = err ? err.message : "";
+  box.hidden = !err;
+}
+
+async function refresh() {
+  try {
+    const [queue, deadLetters, failures, notifications, templates] = await Promise.all([
+      api("GET", "/api/admin/queue"),
+      api("GET", "/api/admin/dead-letters"),
+      api("GET", "/api/admin/failures"),
+      api("GET", "/api/admin/notifications/recent?limit=50"),
+      api("GET", "/api/templates"),
+    ]);
+    renderQueue(queue);
+    renderDeadLetters(deadLetters);
+    renderFailures(failures);
+    renderNotifications(notifications);
+    renderTemplates(templates);
+    document.getElementById("updated").textContent = `Updated ${new Date().toLocaleTimeString()}`;
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function redrive(notificationID) {
+  const what = notificationID ? `the dead letters of ${notificationID}` : "every dead letter";
+  if (!confirm(`Queue ${what} again?`)) {
+    return;
+  }
+  const query = notificationID ? `?notification_id=${encodeURIComponent(notificationID)}` : "";
+  try {
+    await api("POST", `/api/admin/dead-letters/redrive${query}`);
+  } catch (err) {
+    showError(err);
+    return;
+  }
+  refresh();
+}
+
+function schedule() {
+  clearInterval(timer);
+  timer = document.getElementById("auto").checked ? setInterval(refresh, refreshInterval) : null;
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  document.getElementById("key").value = apiKey();
+  document.getElementById("auth").addEventListener("submit", (event) => {
+    event.preventDefault();
+    sessionStorage.setItem(keyStorage, document.getElementById("key").value.trim());
+    refresh();
+  });
+  document.getElementById("refresh").addEventListener("click", refresh);
+  document.getElementById("redrive").addEventListener("click", () => redrive(""));
+  document.getElementById("auto").addEventListener("change", schedule);
+  refresh();
+  schedule();
+});
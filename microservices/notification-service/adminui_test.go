@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestAdminUI(t *testing.T) {
+	r := gin.New()
+	registerAdminUI(r)
+	for path, contentType := range map[string]string{
+		"/admin":         "text/html",
+		"/admin/app.js":  "text/javascript",
+		"/admin/app.css": "text/css",
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), contentType) || rec.Body.Len() == 0 {
+			t.Errorf("%s returned %d %q", path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if rec.Header().Get("Content-Security-Policy") == "" {
+			t.Errorf("%s has no content security policy", path)
+		}
+	}
+}
+
+func TestTriageRoutes(t *testing.T) {
+	store := newNotificationStore(testNotification("n1", "alice"), testNotification("n2", "alice"), testNotification("n3", "alice"))
+	service := testService(store, newBroadcastStore(), systemClock{})
+	service.dispatcher.fail(context.Background(), deliveryJob{Notification: testNotification("n1", "alice"), Channel: channelEmail, Attempt: 1}, errors.New("provider down"))
+	service.dispatcher.deadLetters = append(service.dispatcher.deadLetters, deliveryJob{Notification: testNotification("n2", "alice"), Channel: channelSMS})
+	lag := newConsumerLag()
+	lag.Observe("orders", 42, kafka.Message{Time: time.Now().Add(-time.Minute)}, time.Now())
+
+	r := gin.New()
+	registerTriageRoutes(r.Group("/api/admin"), service, lag)
+	get := func(path string, data any) int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		json.Unmarshal(rec.Body.Bytes(), &struct {
+			Data any `json:"data"`
+		}{data})
+		return rec.Code
+	}
+
+	var queue queueStatus
+	if code := get("/api/admin/queue", &queue); code != http.StatusOK || queue.DeadLetters != 1 || queue.ConsumerLag["orders"].Messages != 42 || queue.ConsumerLag["orders"].Delay != "1m0s" {
+		t.Errorf("queue returned %d: %+v", code, queue)
+	}
+	var failures []deliveryJob
+	if code := get("/api/admin/failures", &failures); code != http.StatusOK || len(failures) != 1 || failures[0].LastError != "provider down" {
+		t.Errorf("failures returned %d: %+v", code, failures)
+	}
+	var recent []Notification
+	if code := get("/api/admin/notifications/recent?limit=2", &recent); code != http.StatusOK || len(recent) != 2 || recent[0].ID != "n3" || recent[1].ID != "n2" {
+		t.Errorf("recent notifications returned %d: %+v", code, recent)
+	}
+	if code := get("/api/admin/notifications/recent?limit=0", nil); code != http.StatusBadRequest {
+		t.Errorf("limit=0 returned %d, want 400", code)
+	}
+}
+
+func TestRecentNotificationsNewestFirst(t *testing.T) {
+	// Stored out of creation order, as imports and peer regions do, and across users
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	var notifications []Notification
+	for i, offset := range []int{3, 1, 2, 0, 4} {
+		notification := testNotification(fmt.Sprintf("n%d", i), fmt.Sprintf("user-%d", i))
+		notification.CreatedAt = start.Add(time.Duration(offset) * time.Minute)
+		notifications = append(notifications, notification)
+	}
+	service := testService(newNotificationStore(notifications...), newBroadcastStore(), systemClock{})
+	r := gin.New()
+	registerTriageRoutes(r.Group("/api/admin"), service, newConsumerLag())
+
+	for _, tc := range []struct {
+		limit int
+		want  string
+	}{
+		{1, "n4"},
+		{3, "n4,n0,n2"},
+		{10, "n4,n0,n2,n1,n3"},
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/admin/notifications/recent?limit=%d", tc.limit), nil))
+		var resp struct {
+			Data []Notification `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		got := make([]string, len(resp.Data))
+		for i, notification := range resp.Data {
+			got[i] = notification.ID
+		}
+		if strings.Join(got, ",") != tc.want {
+			t.Errorf("limit %d: recent = %v, want %s", tc.limit, got, tc.want)
+		}
+	}
+}
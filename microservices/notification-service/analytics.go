@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Lifecycle stages counted by the analytics rollups
+const (
+	analyticsCreated   = "created"
+	analyticsDelivered = "delivered"
+	analyticsRead      = "read"
+	analyticsFailed    = "failed"
+)
+
+// maxAnalyticsBuckets bounds the buckets one analytics query returns
+const maxAnalyticsBuckets = 1500
+
+// rollupGranularity is one bucket width the analytics are pre-aggregated at
+type rollupGranularity struct {
+	name  string
+	width time.Duration
+	// retention is how far back buckets of this width are kept
+	retention time.Duration
+}
+
+// Finer rollups are kept for less time, so the rollups stay small
+var rollupGranularities = []rollupGranularity{
+	{"minute", time.Minute, 24 * time.Hour},
+	{"hour", time.Hour, 31 * 24 * time.Hour},
+	{"day", 24 * time.Hour, 400 * 24 * time.Hour},
+}
+
+var errInvalidAnalyticsQuery = errors.New("Invalid analytics query")
+
+// rollupKey identifies one counter: a bucket and the type, channel and stage counted in it
+type rollupKey struct {
+	start   int64
+	kind    string
+	channel string
+	status  string
+}
+
+// rollup counts notifications in buckets of one width
+type rollup struct {
+	granularity rollupGranularity
+	counts      map[rollupKey]int
+	// latest is the start of the newest bucket; older ones are pruned when it moves
+	latest int64
+}
+
+// analyticsCount is the number of notifications of a type that reached a stage in a bucket
+type analyticsCount struct {
+	Type string `json:"type"`
+	// Channel is set for deliveries and failures, which happen per channel
+	Channel string `json:"channel,omitempty"`
+	Status  string `json:"status"`
+	Count   int    `json:"count"`
+}
+
+// analyticsBucket is the counts of one bucket
+type analyticsBucket struct {
+	Start time.Time `json:"start"`
+	// Totals sums Counts by status
+	Totals map[string]int   `json:"totals"`
+	Counts []analyticsCount `json:"counts"`
+}
+
+// analyticsQuery selects the buckets of a granularity in [From, To), optionally filtered
+type analyticsQuery struct {
+	Granularity string
+	From, To    time.Time
+	Type        string
+	Channel     string
+	Status      string
+}
+
+// analyticsReport answers an analyticsQuery
+type analyticsReport struct {
+	Granularity string            `json:"granularity"`
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	Buckets     []analyticsBucket `json:"buckets"`
+}
+
+// analyticsRollups pre-aggregates notification lifecycle counts by type, channel and stage
+//
+// Every event is added to a minute, hour and day bucket as it happens, so
+// queries read a bounded number of counters instead of scanning
+// notifications. Like the rest of the service's state, the rollups live
+// in memory on each replica.
+type analyticsRollups struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	rollups []*rollup
+}
+
+func newAnalyticsRollups() *analyticsRollups {
+	a := &analyticsRollups{now: time.Now}
+	for _, granularity := range rollupGranularities {
+		a.rollups = append(a.rollups, &rollup{granularity: granularity, counts: make(map[rollupKey]int)})
+	}
+	return a
+}
+
+// Created counts a new notification
+func (a *analyticsRollups) Created(notification Notification) {
+	a.record(notification.Type, "", analyticsCreated)
+}
+
+// Delivered counts a delivery of notification on channel
+func (a *analyticsRollups) Delivered(notification Notification, channel string) {
+	a.record(notification.Type, channel, analyticsDelivered)
+}
+
+// Read counts a notification being read
+func (a *analyticsRollups) Read(notification Notification) {
+	a.record(notification.Type, "", analyticsRead)
+}
+
+// Failed counts a delivery of notification on channel that was given up on
+func (a *analyticsRollups) Failed(notification Notification, channel string) {
+	a.record(notification.Type, channel, analyticsFailed)
+}
+
+func (a *analyticsRollups) record(kind, channel, status string) {
+	if a == nil {
+		return
+	}
+	now := a.now().UTC()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, r := range a.rollups {
+		start := now.Truncate(r.granularity.width).Unix()
+		if start > r.latest {
+			r.latest = start
+			r.prune(now)
+		}
+		r.counts[rollupKey{start: start, kind: kind, channel: channel, status: status}]++
+	}
+}
+
+// prune drops the buckets that have aged out of the rollup's retention
+func (r *rollup) prune(now time.Time) {
+	oldest := now.Add(-r.granularity.retention).Unix()
+	for key := range r.counts {
+		if key.start < oldest {
+			delete(r.counts, key)
+		}
+	}
+}
+
+// Query returns the buckets q asks for, including empty ones, oldest first
+func (a *analyticsRollups) Query(q analyticsQuery) (analyticsReport, error) {
+	var r *rollup
+	for _, candidate := range a.rollups {
+		if candidate.granularity.name == q.Granularity {
+			r = candidate
+		}
+	}
+	if r == nil {
+		return analyticsReport{}, fmt.Errorf("%w: granularity must be minute, hour or day", errInvalidAnalyticsQuery)
+	}
+	width := r.granularity.width
+	from, to := q.From.UTC().Truncate(width), q.To.UTC()
+	if !from.Before(to) {
+		return analyticsReport{}, fmt.Errorf("%w: from must be before to", errInvalidAnalyticsQuery)
+	}
+	if from.Before(a.now().Add(-r.granularity.retention).Truncate(width)) {
+		return analyticsReport{}, fmt.Errorf("%w: %s buckets are kept for %s", errInvalidAnalyticsQuery, r.granularity.name, r.granularity.retention)
+	}
+	if to.Sub(from) > time.Duration(maxAnalyticsBuckets)*width {
+		return analyticsReport{}, fmt.Errorf("%w: at most %d buckets, use a coarser granularity", errInvalidAnalyticsQuery, maxAnalyticsBuckets)
+	}
+
+	report := analyticsReport{Granularity: r.granularity.name, From: from, To: to, Buckets: []analyticsBucket{}}
+	index := make(map[int64]int)
+	for start := from; start.Before(to); start = start.Add(width) {
+		index[start.Unix()] = len(report.Buckets)
+		report.Buckets = append(report.Buckets, analyticsBucket{Start: start, Totals: map[string]int{}, Counts: []analyticsCount{}})
+	}
+
+	a.mu.Lock()
+	for key, count := range r.counts {
+		i, ok := index[key.start]
+		if !ok || (q.Type != "" && key.kind != q.Type) || (q.Channel != "" && key.channel != q.Channel) || (q.Status != "" && key.status != q.Status) {
+			continue
+		}
+		bucket := &report.Buckets[i]
+		bucket.Totals[key.status] += count
+		bucket.Counts = append(bucket.Counts, analyticsCount{Type: key.kind, Channel: key.channel, Status: key.status, Count: count})
+	}
+	a.mu.Unlock()
+
+	for _, bucket := range report.Buckets {
+		sort.Slice(bucket.Counts, func(i, j int) bool {
+			x, y := bucket.Counts[i], bucket.Counts[j]
+			if x.Type != y.Type {
+				return x.Type < y.Type
+			}
+			if x.Status != y.Status {
+				return x.Status < y.Status
+			}
+			return x.Channel < y.Channel
+		})
+	}
+	return report, nil
+}
+
+// registerAnalyticsRoutes adds the admin endpoint for lifecycle analytics
+//
+// GET /analytics takes from and to as RFC 3339 times, by default the last
+// day, granularity minute, hour (the default) or day, and optional type,
+// channel and status filters.
+func registerAnalyticsRoutes(admin *gin.RouterGroup, analytics *analyticsRollups) {
+	admin.GET("/analytics", func(c *gin.Context) {
+		now := analytics.now()
+		q := analyticsQuery{
+			Granularity: c.DefaultQuery("granularity", "hour"),
+			From:        now.Add(-24 * time.Hour),
+			To:          now,
+			Type:        c.Query("type"),
+			Channel:     c.Query("channel"),
+			Status:      c.Query("status"),
+		}
+		for param, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+			value := c.Query(param)
+			if value == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"error":   fmt.Sprintf("%s: %s must be an RFC 3339 time", errInvalidAnalyticsQuery, param),
+				})
+				return
+			}
+			*t = parsed
+		}
+
+		report, err := analytics.Query(q)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    report,
+		})
+	})
+}
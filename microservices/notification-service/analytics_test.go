@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAnalyticsRollups(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 15, 0, 0, time.UTC)
+	analytics := newAnalyticsRollups()
+	analytics.now = func() time.Time { return now }
+
+	order := Notification{Type: "order_status"}
+	analytics.Created(order)
+	analytics.Delivered(order, channelEmail)
+	analytics.Delivered(order, channelPush)
+	now = now.Add(time.Hour)
+	analytics.Created(order)
+	analytics.Failed(order, channelSMS)
+	analytics.Read(order)
+	analytics.Created(Notification{Type: "security"})
+
+	report, err := analytics.Query(analyticsQuery{Granularity: "hour", From: now.Add(-2 * time.Hour), To: now.Truncate(time.Hour).Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Buckets) != 3 {
+		t.Fatalf("got %d buckets, want 3 including the empty one", len(report.Buckets))
+	}
+	if empty := report.Buckets[0]; len(empty.Counts) != 0 || !empty.Start.Equal(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("first bucket = %+v, want an empty 09:00 bucket", empty)
+	}
+	if totals := report.Buckets[1].Totals; totals[analyticsCreated] != 1 || totals[analyticsDelivered] != 2 {
+		t.Errorf("10:00 totals = %v", totals)
+	}
+	if totals := report.Buckets[2].Totals; totals[analyticsCreated] != 2 || totals[analyticsFailed] != 1 || totals[analyticsRead] != 1 {
+		t.Errorf("11:00 totals = %v", totals)
+	}
+
+	// Filters narrow the counts, and the day rollup sums the hours
+	report, _ = analytics.Query(analyticsQuery{Granularity: "day", From: now.Add(-time.Hour), To: now, Channel: channelPush})
+	if counts := report.Buckets[0].Counts; len(counts) != 1 || counts[0] != (analyticsCount{Type: "order_status", Channel: channelPush, Status: analyticsDelivered, Count: 1}) {
+		t.Errorf("push counts for the day = %+v", counts)
+	}
+	report, _ = analytics.Query(analyticsQuery{Granularity: "day", From: now, To: now.Add(time.Minute), Status: analyticsCreated})
+	if totals := report.Buckets[0].Totals; totals[analyticsCreated] != 3 || len(totals) != 1 {
+		t.Errorf("created totals for the day = %v", totals)
+	}
+
+	for _, q := range []analyticsQuery{
+		{Granularity: "week", From: now.Add(-time.Hour), To: now},
+		{Granularity: "hour", From: now, To: now.Add(-time.Hour)},
+		{Granularity: "minute", From: now.Add(-48 * time.Hour), To: now},
+		{Granularity: "minute", From: now.Add(-23 * time.Hour), To: now.Add(24 * time.Hour)},
+	} {
+		if _, err := analytics.Query(q); err == nil {
+			t.Errorf("query %+v accepted", q)
+		}
+	}
+
+	// Buckets past their retention are dropped as time moves on
+	now = now.Add(48 * time.Hour)
+	analytics.Created(order)
+	for key := range analytics.rollups[0].counts {
+		if key.start < now.Add(-24*time.Hour).Unix() {
+			t.Errorf("minute bucket %v kept past its retention", time.Unix(key.start, 0).UTC())
+		}
+	}
+}
+
+func TestAnalyticsEndpoint(t *testing.T) {
+	analytics := newAnalyticsRollups()
+	analytics.Created(Notification{Type: "info"})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAnalyticsRoutes(r.Group("/api/admin"), analytics)
+	get := func(query string) (int, analyticsReport) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/analytics"+query, nil))
+		var resp struct {
+			Data analyticsReport `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Data
+	}
+
+	code, report := get("")
+	if code != http.StatusOK || report.Granularity != "hour" || len(report.Buckets) < 24 {
+		t.Fatalf("default query returned %d with %d %s buckets", code, len(report.Buckets), report.Granularity)
+	}
+	if last := report.Buckets[len(report.Buckets)-1]; last.Totals[analyticsCreated] != 1 {
+		t.Errorf("latest bucket = %+v, want the created notification", last)
+	}
+	if code, _ := get("?from=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("unparseable from returned %d, want 400", code)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/logging"
+)
+
+// What a volume is counted by
+const (
+	volumeByType   = "type"
+	volumeByTenant = "tenant"
+)
+
+const (
+	// anomalyWarmup is how many intervals are counted before a baseline can be spiked past
+	anomalyWarmup = 5
+	// anomalyHistory bounds how many anomalies are kept after they end
+	anomalyHistory = 100
+	// typeVolumeAnomaly is the type of the notifications telling operators about a spike
+	typeVolumeAnomaly = "volume_anomaly"
+)
+
+var (
+	volumeAnomaly = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "notification_volume_anomaly",
+			Help: "1 while a notification type or tenant is creating notifications far above its baseline",
+		},
+		[]string{"dimension", "key"},
+	)
+	volumeAnomaliesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_volume_anomalies_total",
+			Help: "Total number of notification volume spikes detected, by dimension",
+		},
+		[]string{"dimension"},
+	)
+	volumeThrottledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_volume_throttled_total",
+			Help: "Total number of creates and sends rejected because their type was throttled after a spike",
+		},
+		[]string{"type"},
+	)
+)
+
+// errThrottled is returned for creates and sends of a type throttled after a spike
+var errThrottled = errors.New("Notification type is throttled after a volume spike")
+
+// throttleError says which type is throttled and when to retry
+type throttleError struct {
+	notificationType string
+	retryAfter       time.Duration
+}
+
+func (e *throttleError) Error() string {
+	return fmt.Sprintf("%s: %s", errThrottled, e.notificationType)
+}
+
+func (e *throttleError) Is(target error) bool { return target == errThrottled }
+
+// volumeSpike is a spike in one type's or tenant's notifications
+type volumeSpike struct {
+	Dimension string `json:"dimension"`
+	Key       string `json:"key"`
+	// Count is the most notifications created in one interval during the spike
+	Count     int        `json:"count"`
+	Baseline  float64    `json:"baseline"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	// ThrottledUntil is set when the spiking type was throttled
+	ThrottledUntil *time.Time `json:"throttled_until,omitempty"`
+}
+
+// volumeKey is a type or tenant whose volume is counted
+type volumeKey struct {
+	dimension string
+	key       string
+}
+
+// volumeRate is the count of one key in the current interval and its baseline
+type volumeRate struct {
+	count int
+	// baseline is a moving average of the count per interval
+	baseline  float64
+	intervals int
+	spike     *volumeSpike
+}
+
+// typeThrottle caps one type's notifications per interval until it expires
+type typeThrottle struct {
+	limit    int
+	admitted int
+	until    time.Time
+}
+
+// anomalyDetector flags types and tenants creating notifications far above their usual rate
+//
+// Admit counts every create and send and Check, once per interval, compares
+// each count with its baseline. A spike sets the volume anomaly gauge and
+// notifies the configured users; with auto-throttling, the spiking type is
+// also capped at what would not have been a spike until the throttle
+// expires or is lifted. Counts and throttles live in memory on each
+// replica, which with requests spread evenly sees the same spikes.
+type anomalyDetector struct {
+	cfg    atomic.Pointer[AnomalyConfig]
+	now    func() time.Time
+	notify func(ctx context.Context, notification Notification) error
+
+	mu        sync.Mutex
+	rates     map[volumeKey]*volumeRate
+	throttles map[string]*typeThrottle
+	// spikes holds the active spikes and the latest ended ones, oldest first
+	spikes []*volumeSpike
+}
+
+func newAnomalyDetector(cfg AnomalyConfig, notify func(ctx context.Context, notification Notification) error) *anomalyDetector {
+	d := &anomalyDetector{
+		now:       time.Now,
+		notify:    notify,
+		rates:     make(map[volumeKey]*volumeRate),
+		throttles: make(map[string]*typeThrottle),
+	}
+	d.SetConfig(cfg)
+	return d
+}
+
+// SetConfig replaces the thresholds and throttling; counts and baselines are kept
+func (d *anomalyDetector) SetConfig(cfg AnomalyConfig) {
+	d.cfg.Store(&cfg)
+}
+
+// Admit counts notification, or returns an error matching errThrottled when its type is throttled
+//
+// Throttled notifications are counted too, so a spike lasts as long as the
+// demand behind it.
+func (d *anomalyDetector) Admit(notification Notification) error {
+	if d == nil || !d.cfg.Load().Enabled {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.observeLocked(notification)
+
+	throttle, ok := d.throttles[notification.Type]
+	if !ok {
+		return nil
+	}
+	if !d.now().Before(throttle.until) {
+		delete(d.throttles, notification.Type)
+		return nil
+	}
+	if throttle.admitted >= throttle.limit {
+		volumeThrottledTotal.WithLabelValues(notification.Type).Inc()
+		return &throttleError{notificationType: notification.Type, retryAfter: d.cfg.Load().Interval}
+	}
+	throttle.admitted++
+	return nil
+}
+
+// Observe counts notification towards its type's and tenant's volume without throttling it
+func (d *anomalyDetector) Observe(notification Notification) {
+	if d == nil || !d.cfg.Load().Enabled {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.observeLocked(notification)
+}
+
+func (d *anomalyDetector) observeLocked(notification Notification) {
+	d.rateLocked(volumeKey{volumeByType, notification.Type}).count++
+	if notification.Tenant != "" {
+		d.rateLocked(volumeKey{volumeByTenant, notification.Tenant}).count++
+	}
+}
+
+func (d *anomalyDetector) rateLocked(key volumeKey) *volumeRate {
+	rate, ok := d.rates[key]
+	if !ok {
+		rate = &volumeRate{}
+		d.rates[key] = rate
+	}
+	return rate
+}
+
+// Check ends the current interval, flagging the counts that spiked past their baseline
+func (d *anomalyDetector) Check(ctx context.Context) {
+	cfg := d.cfg.Load()
+	now := d.now()
+	// Each interval moves the baseline this far towards its count
+	weight := math.Min(1, float64(cfg.Interval)/float64(cfg.Baseline))
+
+	var started []*volumeSpike
+	d.mu.Lock()
+	for key, rate := range d.rates {
+		count := rate.count
+		rate.count = 0
+		spiking := rate.intervals >= anomalyWarmup && count >= cfg.MinCount && float64(count) > cfg.Threshold*rate.baseline
+
+		switch {
+		case spiking && rate.spike == nil:
+			rate.spike = &volumeSpike{Dimension: key.dimension, Key: key.key, Count: count, Baseline: rate.baseline, StartedAt: now}
+			if key.dimension == volumeByType && cfg.AutoThrottle {
+				until := now.Add(cfg.ThrottleFor)
+				d.throttles[key.key] = &typeThrottle{limit: max(1, int(cfg.Threshold*rate.baseline)), until: until}
+				rate.spike.ThrottledUntil = &until
+			}
+			d.spikes = append(d.spikes, rate.spike)
+			started = append(started, rate.spike)
+			volumeAnomaly.WithLabelValues(key.dimension, key.key).Set(1)
+			volumeAnomaliesTotal.WithLabelValues(key.dimension).Inc()
+		case spiking:
+			rate.spike.Count = max(rate.spike.Count, count)
+		case rate.spike != nil:
+			rate.spike.EndedAt = &now
+			rate.spike = nil
+			volumeAnomaly.DeleteLabelValues(key.dimension, key.key)
+		}
+
+		if rate.intervals == 0 {
+			rate.baseline = float64(count)
+		} else {
+			rate.baseline += weight * (float64(count) - rate.baseline)
+		}
+		rate.intervals++
+		// Keys that have gone quiet are forgotten
+		if rate.baseline < 0.01 && rate.spike == nil {
+			delete(d.rates, key)
+		}
+	}
+	for _, throttle := range d.throttles {
+		throttle.admitted = 0
+	}
+	d.trimLocked()
+	d.mu.Unlock()
+
+	for _, spike := range started {
+		d.alert(ctx, spike, cfg)
+	}
+}
+
+// trimLocked forgets the oldest ended spikes beyond anomalyHistory
+func (d *anomalyDetector) trimLocked() {
+	ended := 0
+	for _, spike := range d.spikes {
+		if spike.EndedAt != nil {
+			ended++
+		}
+	}
+	kept := d.spikes[:0]
+	for _, spike := range d.spikes {
+		if spike.EndedAt != nil && ended > anomalyHistory {
+			ended--
+			continue
+		}
+		kept = append(kept, spike)
+	}
+	d.spikes = kept
+}
+
+// alert logs spike and notifies the configured users of it
+func (d *anomalyDetector) alert(ctx context.Context, spike *volumeSpike, cfg *AnomalyConfig) {
+	logger := logging.FromContext(ctx)
+	logger.Warn("notification volume spike", "dimension", spike.Dimension, "key", spike.Key, "count", spike.Count, "baseline", spike.Baseline, "throttled", spike.ThrottledUntil != nil)
+
+	message := fmt.Sprintf("%d notifications in the last %s, against a baseline of %.1f.", spike.Count, cfg.Interval, spike.Baseline)
+	if spike.ThrottledUntil != nil {
+		message += " The type is throttled until " + spike.ThrottledUntil.UTC().Format(time.RFC3339) + "."
+	}
+	for _, userID := range cfg.NotifyUsers {
+		notification := Notification{
+			ID:       uuid.New().String(),
+			UserID:   userID,
+			Type:     typeVolumeAnomaly,
+			Title:    fmt.Sprintf("Notification volume spike for %s %s", spike.Dimension, spike.Key),
+			Message:  message,
+			Status:   "unread",
+			Category: categorySystem,
+			Data: map[string]any{
+				"dimension": spike.Dimension,
+				"key":       spike.Key,
+				"count":     spike.Count,
+				"baseline":  spike.Baseline,
+			},
+			CreatedAt: d.now(),
+		}
+		if err := d.notify(ctx, notification); err != nil {
+			logger.Error("notifying of a volume spike failed", "user_id", userID, "error", err)
+		}
+	}
+}
+
+// Spikes returns the active and recently ended spikes, newest first
+func (d *anomalyDetector) Spikes() []volumeSpike {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]volumeSpike, len(d.spikes))
+	for i, spike := range d.spikes {
+		list[len(list)-1-i] = *spike
+	}
+	return list
+}
+
+// Unthrottle lifts the throttle on notificationType, reporting whether there was one
+func (d *anomalyDetector) Unthrottle(notificationType string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.throttles[notificationType]
+	delete(d.throttles, notificationType)
+	return ok
+}
+
+// Run checks for spikes every interval until ctx is cancelled
+func (d *anomalyDetector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Load().Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Check(ctx)
+		}
+	}
+}
+
+// registerAnomalyRoutes adds the admin endpoints for volume spikes and the throttles they set
+func registerAnomalyRoutes(admin *gin.RouterGroup, anomalies *anomalyDetector) {
+	admin.GET("/anomalies", func(c *gin.Context) {
+		spikes := anomalies.Spikes()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    spikes,
+			"count":   len(spikes),
+		})
+	})
+
+	// Lifts a throttle early, e.g. once the spike turned out to be expected
+	admin.DELETE("/anomalies/throttles/:type", func(c *gin.Context) {
+		if !anomalies.Unthrottle(c.Param("type")) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Type is not throttled",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+}
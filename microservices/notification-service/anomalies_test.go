@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVolumeAnomalies(t *testing.T) {
+	cfg := defaultConfig().Anomalies
+	cfg.Enabled, cfg.AutoThrottle, cfg.MinCount, cfg.NotifyUsers = true, true, 20, []string{"oncall"}
+	var alerts []Notification
+	detector := newAnomalyDetector(cfg, func(_ context.Context, notification Notification) error {
+		alerts = append(alerts, notification)
+		return nil
+	})
+	now := time.Date(2026, 7, 1, 9, 0, 0, 0, time.UTC)
+	detector.now = func() time.Time { return now }
+	interval := func(count int) (rejected int) {
+		for i := 0; i < count; i++ {
+			if err := detector.Admit(Notification{Type: "order_status", Tenant: "acme"}); errors.Is(err, errThrottled) {
+				rejected++
+			}
+		}
+		detector.Check(context.Background())
+		now = now.Add(cfg.Interval)
+		return rejected
+	}
+
+	// A steady 10 a minute is the baseline; doubling it is not a spike
+	for i := 0; i < anomalyWarmup; i++ {
+		interval(10)
+	}
+	interval(20)
+	if spikes := detector.Spikes(); len(spikes) != 0 {
+		t.Fatalf("spikes = %+v, want none below the threshold", spikes)
+	}
+
+	// Ten times the baseline flags the type and the tenant and throttles the type
+	interval(100)
+	spikes := detector.Spikes()
+	if len(spikes) != 2 || spikes[0].EndedAt != nil || spikes[1].EndedAt != nil {
+		t.Fatalf("spikes = %+v, want the type and tenant spiking", spikes)
+	}
+	if len(alerts) != 2 || alerts[0].UserID != "oncall" || alerts[0].Type != typeVolumeAnomaly {
+		t.Errorf("alerts = %+v, want one per spike for oncall", alerts)
+	}
+	if rejected := interval(100); rejected == 0 || rejected == 100 {
+		t.Errorf("throttle rejected %d of 100, want the excess over the cap", rejected)
+	}
+
+	// Lifting the throttle admits everything again, and the spike ends once the volume drops
+	r := gin.New()
+	registerAnomalyRoutes(r.Group("/api/admin"), detector)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/admin/anomalies/throttles/order_status", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("lifting the throttle returned %d", rec.Code)
+	}
+	if rejected := interval(100); rejected != 0 {
+		t.Errorf("%d rejected after the throttle was lifted", rejected)
+	}
+	interval(10)
+	for _, spike := range detector.Spikes() {
+		if spike.EndedAt == nil || spike.Count != 100 {
+			t.Errorf("spike = %+v, want it ended with a peak of 100", spike)
+		}
+	}
+}
+
+func TestThrottledSendIsRejected(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	respondError(c, &throttleError{notificationType: "order_status", retryAfter: time.Minute})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("throttled create returned %d with Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
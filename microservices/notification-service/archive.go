@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/logging"
+)
+
+var (
+	notificationsArchivedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "notifications_archived_total",
+			Help: "Total number of notifications moved to cold storage",
+		},
+	)
+	archiveUploadFailuresTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "archive_upload_failures_total",
+			Help: "Total number of archive objects that could not be written to cold storage",
+		},
+	)
+	archiveObjectsExpiredTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "archive_objects_expired_total",
+			Help: "Total number of archive objects deleted once their notifications were past retention",
+		},
+	)
+)
+
+// untenantedPartition is the tenant partition of notifications created without a tenant
+const untenantedPartition = "_none"
+
+// maxArchiveLookupResults bounds the notifications one archive lookup returns
+const maxArchiveLookupResults = 1000
+
+var errInvalidArchiveQuery = errors.New("Invalid archive query")
+
+// archiver moves notifications older than the archive window into cold storage
+//
+// Notifications are written as gzipped NDJSON, one object per UTC creation
+// date, tenant and retention per run, under
+// <prefix>/date=YYYY-MM-DD/tenant=<tenant>/<unix nanos>-<instance>.ndjson.gz,
+// and are only deleted from the store once their object is written. Each
+// replica archives the notifications in its own store, so instance keeps
+// replicas from overwriting each other's objects.
+//
+// Notifications with a retention are archived in objects named
+// <unix nanos>-<instance>.expires-<unix>.ndjson.gz, deleted once every
+// notification in them is past its retention. Lookups also leave out
+// notifications past their current retention, should it have been shortened
+// since they were archived.
+type archiver struct {
+	cfg      ArchiveConfig
+	objects  objectStore
+	repo     Repository
+	types    *typeRegistry
+	instance string
+	now      func() time.Time
+}
+
+func newArchiver(cfg ArchiveConfig, objects objectStore, repo Repository, types *typeRegistry, instance string) *archiver {
+	return &archiver{cfg: cfg, objects: objects, repo: repo, types: types, instance: instance, now: time.Now}
+}
+
+// archivePartition is one date, tenant and retention of archived notifications
+type archivePartition struct {
+	date   string
+	tenant string
+	// retention is the notifications' retention, 0 when they are kept forever
+	retention time.Duration
+}
+
+// expires returns when every notification of the partition is past its retention, zero for never
+func (p archivePartition) expires() time.Time {
+	if p.retention <= 0 {
+		return time.Time{}
+	}
+	day, _ := time.Parse(time.DateOnly, p.date)
+	return day.Add(24*time.Hour + p.retention)
+}
+
+// archiveExpires returns when the object key can be deleted, false when it is kept forever
+func archiveExpires(key string) (time.Time, bool) {
+	name := strings.TrimSuffix(path.Base(key), ".ndjson.gz")
+	i := strings.LastIndex(name, ".expires-")
+	if i < 0 {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(name[i+len(".expires-"):], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+func (a *archiver) partitionPrefix(p archivePartition) string {
+	return path.Join(a.cfg.Prefix, "date="+p.date, "tenant="+p.tenant) + "/"
+}
+
+// Run archives every cfg.Interval until ctx is cancelled
+func (a *archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := a.Archive(ctx); err != nil {
+				logging.FromContext(ctx).Warn("archiving notifications failed", "error", err)
+			}
+			if _, err := a.Expire(ctx); err != nil {
+				logging.FromContext(ctx).Warn("deleting expired archives failed", "error", err)
+			}
+		}
+	}
+}
+
+// Archive moves unpinned notifications created before the archive window to cold storage, returning how many
+//
+// A partition whose object cannot be written keeps its notifications in the
+// store for the next run. Notifications already past their retention are
+// left for the retention job to delete.
+func (a *archiver) Archive(ctx context.Context) (int, error) {
+	now := a.now()
+	cutoff := now.Add(-a.cfg.After)
+	partitions := make(map[archivePartition][]Notification)
+	a.repo.Scan(func(notification Notification) error {
+		if notification.Pinned || !notification.CreatedAt.Before(cutoff) || a.types.Expired(notification, now) {
+			return nil
+		}
+		p := archivePartition{
+			date:      notification.CreatedAt.UTC().Format(time.DateOnly),
+			tenant:    notification.Tenant,
+			retention: a.types.Retention(notification),
+		}
+		if p.tenant == "" {
+			p.tenant = untenantedPartition
+		}
+		partitions[p] = append(partitions[p], notification)
+		return nil
+	})
+
+	archived := 0
+	var errs []error
+	for p, notifications := range partitions {
+		body, err := encodeArchive(notifications)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		name := fmt.Sprintf("%d-%s", now.UnixNano(), a.instance)
+		if expires := p.expires(); !expires.IsZero() {
+			name += fmt.Sprintf(".expires-%d", expires.Unix())
+		}
+		key := a.partitionPrefix(p) + name + ".ndjson.gz"
+		if err := a.objects.Put(ctx, key, body, "application/gzip"); err != nil {
+			archiveUploadFailuresTotal.Inc()
+			errs = append(errs, fmt.Errorf("writing %s: %w", key, err))
+			continue
+		}
+		for _, notification := range notifications {
+			if _, ok := a.repo.Delete(notification.ID); ok {
+				archived++
+			}
+		}
+	}
+	notificationsArchivedTotal.Add(float64(archived))
+	if archived > 0 {
+		logging.FromContext(ctx).Info("archived notifications", "cutoff", cutoff, "notifications", archived)
+	}
+	return archived, errors.Join(errs...)
+}
+
+// Expire deletes the archive objects whose notifications are all past their retention, returning how many
+func (a *archiver) Expire(ctx context.Context) (int, error) {
+	keys, err := a.objects.List(ctx, a.cfg.Prefix+"/")
+	if err != nil {
+		return 0, err
+	}
+	now := a.now()
+	deleted := 0
+	var errs []error
+	for _, key := range keys {
+		if expires, ok := archiveExpires(key); !ok || expires.After(now) {
+			continue
+		}
+		if err := a.objects.Delete(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("deleting %s: %w", key, err))
+			continue
+		}
+		deleted++
+	}
+	archiveObjectsExpiredTotal.Add(float64(deleted))
+	if deleted > 0 {
+		logging.FromContext(ctx).Info("deleted expired archives", "objects", deleted)
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// encodeArchive writes notifications as gzipped NDJSON
+func encodeArchive(notifications []Notification) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, notification := range notifications {
+		if err := enc.Encode(notification); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// archiveQuery selects archived notifications created on Date, optionally narrowed down
+type archiveQuery struct {
+	Date string
+	// Tenant is a single tenant, or every tenant when empty
+	Tenant string
+	UserID string
+	ID     string
+}
+
+// Lookup reads the archived notifications q asks for, oldest first, at most maxArchiveLookupResults of them
+func (a *archiver) Lookup(ctx context.Context, q archiveQuery) ([]Notification, error) {
+	if _, err := time.Parse(time.DateOnly, q.Date); err != nil {
+		return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", errInvalidArchiveQuery)
+	}
+	prefix := path.Join(a.cfg.Prefix, "date="+q.Date) + "/"
+	if q.Tenant != "" {
+		prefix = a.partitionPrefix(archivePartition{date: q.Date, tenant: q.Tenant})
+	}
+	keys, err := a.objects.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.now()
+	found := []Notification{}
+	for _, key := range keys {
+		if expires, ok := archiveExpires(key); ok && !expires.After(now) {
+			continue
+		}
+		body, err := a.objects.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		notifications, err := decodeArchive(body)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", key, err)
+		}
+		for _, notification := range notifications {
+			if (q.UserID != "" && notification.UserID != q.UserID) || (q.ID != "" && notification.ID != q.ID) || a.types.Expired(notification, now) {
+				continue
+			}
+			found = append(found, notification)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].CreatedAt.Before(found[j].CreatedAt) })
+	if len(found) > maxArchiveLookupResults {
+		found = found[:maxArchiveLookupResults]
+	}
+	return found, nil
+}
+
+// decodeArchive reads an object written by encodeArchive
+func decodeArchive(body []byte) ([]Notification, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var notifications []Notification
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var notification Notification
+		if err := json.Unmarshal(line, &notification); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, scanner.Err()
+}
+
+// registerArchiveRoutes adds the admin endpoint for looking up archived notifications
+//
+// GET /archive/notifications takes the UTC creation date as date=YYYY-MM-DD
+// and optional tenant, user_id and id filters. Every object of the date, or
+// of the date and tenant, is read, so lookups are meant for audits rather
+// than for serving inboxes.
+func registerArchiveRoutes(admin *gin.RouterGroup, archive *archiver) {
+	admin.GET("/archive/notifications", func(c *gin.Context) {
+		notifications, err := archive.Lookup(c.Request.Context(), archiveQuery{
+			Date:   c.Query("date"),
+			Tenant: strings.TrimSpace(c.Query("tenant")),
+			UserID: c.Query("user_id"),
+			ID:     c.Query("id"),
+		})
+		if errors.Is(err, errInvalidArchiveQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("archive lookup failed", "error", err)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"success": false,
+				"error":   "Archive unavailable",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    notifications,
+			"count":   len(notifications),
+		})
+	})
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryObjects is an objectStore in memory
+type memoryObjects struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	failPut bool
+}
+
+func (m *memoryObjects) Put(_ context.Context, key string, body []byte, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failPut {
+		return errors.New("bucket unavailable")
+	}
+	if m.objects == nil {
+		m.objects = make(map[string][]byte)
+	}
+	m.objects[key] = body
+	return nil
+}
+
+func (m *memoryObjects) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	body, ok := m.objects[key]
+	if !ok {
+		return nil, errObjectNotFound
+	}
+	return body, nil
+}
+
+func (m *memoryObjects) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memoryObjects) List(_ context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func TestArchive(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := newNotificationStore()
+	old := now.Add(-100 * 24 * time.Hour)
+	for _, n := range []Notification{
+		{ID: "a1", UserID: "alice", Type: "info", Tenant: "acme", CreatedAt: old},
+		{ID: "a2", UserID: "bob", Type: "info", Tenant: "acme", CreatedAt: old.Add(time.Hour)},
+		{ID: "g1", UserID: "alice", Type: "info", CreatedAt: old},
+		{ID: "pinned", UserID: "alice", Type: "info", Pinned: true, CreatedAt: old},
+		{ID: "recent", UserID: "alice", Type: "info", CreatedAt: now.Add(-time.Hour)},
+	} {
+		store.Add(n)
+	}
+	objects := &memoryObjects{failPut: true}
+	archive := newArchiver(ArchiveConfig{After: 90 * 24 * time.Hour, Prefix: "notifications"}, objects, store, newTypeRegistry(defaultConfig().Types), "pod-0")
+	archive.now = func() time.Time { return now }
+
+	// Nothing leaves the store until it is written
+	if n, err := archive.Archive(context.Background()); n != 0 || err == nil {
+		t.Fatalf("archive with the bucket down = %d, %v", n, err)
+	}
+	if store.Len() != 5 {
+		t.Fatalf("store holds %d notifications after a failed upload, want 5", store.Len())
+	}
+
+	objects.failPut = false
+	if n, err := archive.Archive(context.Background()); n != 3 || err != nil {
+		t.Fatalf("archive = %d, %v; want 3", n, err)
+	}
+	if _, ok := store.Get("pinned"); !ok {
+		t.Error("pinned notification archived")
+	}
+	if _, ok := store.Get("recent"); !ok {
+		t.Error("recent notification archived")
+	}
+	keys, _ := objects.List(context.Background(), "")
+	date := old.Format(time.DateOnly)
+	if len(keys) != 2 || !strings.HasPrefix(keys[0], "notifications/date="+date+"/tenant=_none/") ||
+		!strings.HasPrefix(keys[1], "notifications/date="+date+"/tenant=acme/") || !strings.HasSuffix(keys[1], "-pod-0.ndjson.gz") {
+		t.Errorf("objects = %v, want one per tenant partition", keys)
+	}
+
+	found, err := archive.Lookup(context.Background(), archiveQuery{Date: date, UserID: "alice"})
+	if err != nil || len(found) != 2 {
+		t.Fatalf("lookup for alice = %v, %v; want both tenants' notifications", found, err)
+	}
+	found, _ = archive.Lookup(context.Background(), archiveQuery{Date: date, Tenant: "acme"})
+	if len(found) != 2 || found[0].ID != "a1" || found[1].ID != "a2" {
+		t.Errorf("lookup for acme = %+v, want a1 then a2", found)
+	}
+	if _, err := archive.Lookup(context.Background(), archiveQuery{Date: "June 1st"}); !errors.Is(err, errInvalidArchiveQuery) {
+		t.Errorf("lookup with a bad date returned %v", err)
+	}
+}
+
+func TestArchiveRetention(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := newNotificationStore()
+	old := now.Add(-100 * 24 * time.Hour)
+	for _, n := range []Notification{
+		{ID: "promo", UserID: "alice", Type: "promo", CreatedAt: old},
+		{ID: "alert", UserID: "alice", Type: "security_alert", CreatedAt: old},
+		{ID: "acme-alert", UserID: "bob", Type: "security_alert", Tenant: "acme", CreatedAt: old},
+		{ID: "info", UserID: "alice", Type: "info", CreatedAt: old},
+	} {
+		store.Add(n)
+	}
+	types := newTypeRegistry(defaultConfig().Types)
+	types.Put(NotificationType{Name: "promo", Retention: "720h"})
+	types.Put(NotificationType{Name: "security_alert", Retention: "17520h", TenantRetention: map[string]string{"acme": "2400h"}})
+	objects := &memoryObjects{}
+	archive := newArchiver(ArchiveConfig{After: 90 * 24 * time.Hour, Prefix: "notifications"}, objects, store, types, "pod-0")
+	archive.now = func() time.Time { return now }
+
+	// The promotion is past its retention, so it is left for the retention job rather than archived
+	if n, err := archive.Archive(context.Background()); n != 3 || err != nil {
+		t.Fatalf("archive = %d, %v; want 3", n, err)
+	}
+	if _, ok := store.Get("promo"); !ok {
+		t.Error("notification past its retention archived")
+	}
+	keys, _ := objects.List(context.Background(), "")
+	if len(keys) != 3 {
+		t.Fatalf("objects = %v, want one per tenant and retention", keys)
+	}
+	expiring := 0
+	for _, key := range keys {
+		if _, ok := archiveExpires(key); ok {
+			expiring++
+		}
+	}
+	if expiring != 2 {
+		t.Errorf("objects = %v, want the two security alert objects to expire", keys)
+	}
+
+	// acme's shorter retention runs out first; the others are kept
+	archive.now = func() time.Time { return old.Add(2400*time.Hour + 48*time.Hour) }
+	if n, err := archive.Expire(context.Background()); n != 1 || err != nil {
+		t.Fatalf("expire = %d, %v; want acme's object", n, err)
+	}
+	found, _ := archive.Lookup(context.Background(), archiveQuery{Date: old.Format(time.DateOnly)})
+	if len(found) != 2 || found[0].ID == "acme-alert" || found[1].ID == "acme-alert" {
+		t.Errorf("lookup = %+v, want alert and info", found)
+	}
+
+	// A retention shortened since archiving hides notifications past it
+	types.Put(NotificationType{Name: "security_alert", Retention: "720h"})
+	found, _ = archive.Lookup(context.Background(), archiveQuery{Date: old.Format(time.DateOnly)})
+	if len(found) != 1 || found[0].ID != "info" {
+		t.Errorf("lookup after shortening the retention = %+v, want info", found)
+	}
+}
+
+func TestArchiveEndpoint(t *testing.T) {
+	objects := &memoryObjects{}
+	body, _ := encodeArchive([]Notification{{ID: "n1", UserID: "alice", Type: "info"}})
+	objects.Put(context.Background(), "notifications/date=2026-01-02/tenant=acme/1-pod-0.ndjson.gz", body, "application/gzip")
+	archive := newArchiver(ArchiveConfig{Prefix: "notifications"}, objects, newNotificationStore(), newTypeRegistry(defaultConfig().Types), "pod-0")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerArchiveRoutes(r.Group("/api/admin"), archive)
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/archive/notifications"+query, nil))
+		return rec
+	}
+
+	rec := get("?date=2026-01-02&id=n1")
+	var resp struct {
+		Count int `json:"count"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp.Count != 1 {
+		t.Errorf("lookup returned %d with %d notifications: %s", rec.Code, resp.Count, rec.Body)
+	}
+	if rec := get(""); rec.Code != http.StatusBadRequest {
+		t.Errorf("lookup without a date returned %d, want 400", rec.Code)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	objects := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20260601/eu-central-1/s3/aws4_request, SignedHeaders=") ||
+			r.Header.Get("X-Amz-Content-Sha256") == "" {
+			http.Error(w, "unsigned request "+auth, http.StatusForbidden)
+			return
+		}
+		key, ok := strings.CutPrefix(r.URL.EscapedPath(), "/archive/")
+		if !ok {
+			http.Error(w, "wrong bucket", http.StatusNotFound)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut:
+			objects[key], _ = io.ReadAll(r.Body)
+		case key == "" && r.URL.Query().Get("list-type") == "2":
+			fmt.Fprint(w, `<ListBucketResult>`)
+			for k := range objects {
+				if strings.HasPrefix(k, s3EscapePath(r.URL.Query().Get("prefix"))) {
+					fmt.Fprintf(w, `<Contents><Key>%s</Key></Contents>`, k)
+				}
+			}
+			fmt.Fprint(w, `<IsTruncated>false</IsTruncated></ListBucketResult>`)
+		default:
+			body, ok := objects[key]
+			if !ok {
+				http.Error(w, "NoSuchKey", http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		}
+	}))
+	defer srv.Close()
+
+	store := newS3Store(ArchiveConfig{Endpoint: srv.URL + "/", Region: "eu-central-1", Bucket: "archive", AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	store.now = func() time.Time { return time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+	key := "notifications/date=2026-06-01/tenant=acme/1-pod-0.ndjson.gz"
+	if err := store.Put(ctx, key, []byte("body"), "application/gzip"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objects["notifications/date%3D2026-06-01/tenant%3Dacme/1-pod-0.ndjson.gz"]; !ok {
+		t.Errorf("stored keys %v, want the key escaped as it was signed", objects)
+	}
+	if body, err := store.Get(ctx, key); err != nil || string(body) != "body" {
+		t.Errorf("get = %q, %v", body, err)
+	}
+	if keys, err := store.List(ctx, "notifications/date=2026-06-01/"); err != nil || len(keys) != 1 {
+		t.Errorf("list = %v, %v", keys, err)
+	}
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, errObjectNotFound) {
+		t.Errorf("get of a missing key returned %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/server"
+)
+
+// Stored notifications and users the hot-path benchmarks run against
+const (
+	benchNotifications = 100000
+	benchUsers         = 1000
+)
+
+// benchRouter returns the API with benchNotifications seeded across benchUsers
+func benchRouter(b *testing.B, writes WriteBehindConfig) *gin.Engine {
+	b.Helper()
+	gin.SetMode(gin.ReleaseMode)
+
+	store := newNotificationStore()
+	created := time.Now()
+	for i := 0; i < benchNotifications; i++ {
+		store.Add(Notification{
+			ID:        "bench-" + strconv.Itoa(i),
+			UserID:    "user-" + strconv.Itoa(i%benchUsers),
+			Type:      "info",
+			Title:     "Benchmark",
+			Message:   "Seeded for benchmarks",
+			Status:    "unread",
+			CreatedAt: created,
+		})
+	}
+
+	r := server.NewEngine(server.Options{})
+	service := testService(store, newBroadcastStore(), systemClock{})
+	service.writer = newNotificationWriter(writes, store, service.hub)
+	b.Cleanup(func() { service.writer.Close(context.Background()) })
+	registerAPIRoutes(r.Group("/api"), context.Background(), service, newTemplateStore(), defaultConfig().Responses.StreamThreshold)
+	return r
+}
+
+// serveBench runs each request built by next through r, failing on an unexpected status
+func serveBench(b *testing.B, r *gin.Engine, want int, next func(i int) *http.Request) {
+	b.Helper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, next(i))
+		if rec.Code != want {
+			b.Fatalf("status = %d, want %d: %s", rec.Code, want, rec.Body)
+		}
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "req/s")
+}
+
+func BenchmarkCreate(b *testing.B) {
+	r := benchRouter(b, WriteBehindConfig{})
+	body := `{"user_id":"user-1","type":"info","title":"Benchmark","message":"Created by BenchmarkCreate"}`
+	serveBench(b, r, http.StatusCreated, func(int) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/notifications", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	})
+}
+
+// BenchmarkCreateParallel compares writing each notification as it arrives
+// with batching them under concurrent load
+func BenchmarkCreateParallel(b *testing.B) {
+	writeBehind := defaultConfig().WriteBehind
+	writeBehind.Enabled = true
+	for _, bc := range []struct {
+		name   string
+		writes WriteBehindConfig
+	}{
+		{"direct", WriteBehindConfig{}},
+		{"write-behind", writeBehind},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			r := benchRouter(b, bc.writes)
+			body := `{"user_id":"user-1","type":"info","title":"Benchmark","message":"Created by BenchmarkCreateParallel"}`
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					req := httptest.NewRequest(http.MethodPost, "/api/notifications", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					rec := httptest.NewRecorder()
+					r.ServeHTTP(rec, req)
+					if rec.Code != http.StatusCreated {
+						b.Errorf("status = %d: %s", rec.Code, rec.Body)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "req/s")
+		})
+	}
+}
+
+func BenchmarkListByUser(b *testing.B) {
+	r := benchRouter(b, WriteBehindConfig{})
+	serveBench(b, r, http.StatusOK, func(i int) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/api/users/user-"+strconv.Itoa(i%benchUsers)+"/notifications", nil)
+	})
+}
+
+func BenchmarkMarkRead(b *testing.B) {
+	r := benchRouter(b, WriteBehindConfig{})
+	serveBench(b, r, http.StatusOK, func(i int) *http.Request {
+		// Spread across the store so lookups are not always near the front
+		id := "bench-" + strconv.Itoa(i*7919%benchNotifications)
+		return httptest.NewRequest(http.MethodPatch, "/api/notifications/"+id+"/read", nil)
+	})
+}
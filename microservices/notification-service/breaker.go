@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+)
+
+// errCircuitOpen is returned instead of calling a provider whose breaker is open
+var errCircuitOpen = errors.New("provider circuit breaker is open")
+
+// Circuit breaker metrics
+var (
+	circuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "Provider circuit breaker state: 0 closed, 1 half-open, 2 open",
+		},
+		[]string{"provider"},
+	)
+
+	circuitBreakerTransitionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_transitions_total",
+			Help: "Total number of provider circuit breaker state changes",
+		},
+		[]string{"provider", "to"},
+	)
+)
+
+// breakerSender guards a provider with a send timeout and a circuit breaker
+//
+// Slow sends count as failures, so a hanging provider trips its breaker
+// instead of tying up every delivery worker.
+type breakerSender struct {
+	next    Sender
+	timeout time.Duration
+	cb      *gobreaker.CircuitBreaker
+}
+
+func newBreakerSender(provider string, next Sender, cfg BreakerConfig) *breakerSender {
+	circuitBreakerState.WithLabelValues(provider).Set(0)
+
+	return &breakerSender{
+		next:    next,
+		timeout: cfg.SendTimeout,
+		cb: gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:        provider,
+			MaxRequests: uint32(cfg.HalfOpenRequests),
+			Interval:    cfg.Interval,
+			Timeout:     cfg.OpenTimeout,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				if counts.ConsecutiveFailures >= uint32(cfg.ConsecutiveFailures) {
+					return true
+				}
+				return counts.Requests >= uint32(cfg.MinRequests) &&
+					float64(counts.TotalFailures)/float64(counts.Requests) >= cfg.FailureRatio
+			},
+			OnStateChange: func(name string, from, to gobreaker.State) {
+				circuitBreakerState.WithLabelValues(name).Set(float64(to))
+				circuitBreakerTransitionsTotal.WithLabelValues(name, to.String()).Inc()
+				slog.Warn("circuit breaker state changed", "provider", name, "from", from.String(), "to", to.String())
+			},
+		}),
+	}
+}
+
+func (s *breakerSender) Send(ctx context.Context, notification Notification, to recipient) error {
+	_, err := s.cb.Execute(func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+		return nil, s.next.Send(ctx, notification, to)
+	})
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return fmt.Errorf("%s: %w", s.cb.Name(), errCircuitOpen)
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// scriptedSender fails while fail is set, and blocks until the context ends while hang is set
+type scriptedSender struct {
+	fail, hang bool
+	calls      int
+}
+
+func (s *scriptedSender) Send(ctx context.Context, _ Notification, _ recipient) error {
+	s.calls++
+	if s.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if s.fail {
+		return errors.New("provider unavailable")
+	}
+	return nil
+}
+
+func TestBreakerSender(t *testing.T) {
+	cfg := BreakerConfig{SendTimeout: 10 * time.Millisecond, ConsecutiveFailures: 2, FailureRatio: 1, MinRequests: 100, Interval: time.Minute, OpenTimeout: time.Hour, HalfOpenRequests: 1}
+	for _, tc := range []struct {
+		name   string
+		sender *scriptedSender
+		open   bool
+	}{
+		{"healthy", &scriptedSender{}, false},
+		{"failing", &scriptedSender{fail: true}, true},
+		// Slow sends time out and count as failures
+		{"hanging", &scriptedSender{hang: true}, true},
+	} {
+		breaker := newBreakerSender("test-"+tc.name, tc.sender, cfg)
+		for i := 0; i < 2; i++ {
+			breaker.Send(context.Background(), Notification{ID: "n1"}, recipient{})
+		}
+		err := breaker.Send(context.Background(), Notification{ID: "n1"}, recipient{})
+		if errors.Is(err, errCircuitOpen) != tc.open {
+			t.Errorf("%s: third send returned %v, want the breaker open: %v", tc.name, err, tc.open)
+		}
+		if tc.open && tc.sender.calls != 2 {
+			t.Errorf("%s: provider called %d times, want none once open", tc.name, tc.sender.calls)
+		}
+	}
+}
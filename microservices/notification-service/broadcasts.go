@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// broadcastIDPrefix marks the IDs of broadcasts and of their per-user copies
+const broadcastIDPrefix = "broadcast-"
+
+// broadcast is an announcement for every user, or every user of one tenant
+type broadcast struct {
+	ID       string `json:"id"`
+	Tenant   string `json:"tenant,omitempty"`
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Category string `json:"category"`
+	// Reads counts the users who have read the broadcast
+	Reads     int        `json:"reads"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// broadcastRequest is the admin request to announce something to everyone
+type broadcastRequest struct {
+	// Tenant limits the broadcast to users of one tenant; empty reaches everyone
+	Tenant    string     `json:"tenant"`
+	Type      string     `json:"type" binding:"required"`
+	Title     string     `json:"title" binding:"required"`
+	Message   string     `json:"message" binding:"required"`
+	Category  string     `json:"category"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// broadcastStore keeps broadcasts once rather than copying them to every user
+//
+// Users see a broadcast as a notification in their inbox, materialized when
+// the inbox is listed, with ID "<broadcast ID>:<user ID>". Only whether and
+// when each user read it is stored per user.
+type broadcastStore struct {
+	mu    sync.RWMutex
+	list  []*broadcast
+	reads map[string]map[string]time.Time
+	// version changes whenever a broadcast is added or read, for inbox ETags
+	version uint64
+}
+
+func newBroadcastStore() *broadcastStore {
+	return &broadcastStore{reads: make(map[string]map[string]time.Time)}
+}
+
+// Add stores a broadcast
+func (s *broadcastStore) Add(b broadcast) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, &b)
+	s.reads[b.ID] = make(map[string]time.Time)
+	s.version++
+}
+
+// PurgeExpired removes the broadcasts that expired before now, and who read them, returning how many it removed
+func (s *broadcastStore) PurgeExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.list[:0]
+	for _, b := range s.list {
+		if b.ExpiresAt != nil && b.ExpiresAt.Before(now) {
+			delete(s.reads, b.ID)
+			continue
+		}
+		kept = append(kept, b)
+	}
+	purged := len(s.list) - len(kept)
+	clear(s.list[len(kept):])
+	s.list = kept
+	if purged > 0 {
+		s.version++
+	}
+	return purged
+}
+
+// List returns every broadcast, oldest first, with its read count
+func (s *broadcastStore) List() []broadcast {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]broadcast, len(s.list))
+	for i, b := range s.list {
+		list[i] = *b
+		list[i].Reads = len(s.reads[b.ID])
+	}
+	return list
+}
+
+// Version identifies the current state of all broadcasts and their reads
+func (s *broadcastStore) Version() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return strconv.FormatUint(s.version, 10)
+}
+
+// For returns userID's copies of the broadcasts reaching tenant at now, oldest first
+func (s *broadcastStore) For(userID, tenant string, now time.Time) []Notification {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var copies []Notification
+	for _, b := range s.list {
+		if !b.reaches(tenant, now) {
+			continue
+		}
+		notification := b.copyFor(userID)
+		if readAt, ok := s.reads[b.ID][userID]; ok {
+			notification.Status = "read"
+			notification.ReadAt = &readAt
+		}
+		copies = append(copies, notification)
+	}
+	return copies
+}
+
+// MarkRead marks a user's copy of a broadcast, by its ID, as read
+func (s *broadcastStore) MarkRead(id string, at time.Time) (Notification, bool) {
+	broadcastID, userID, ok := strings.Cut(id, ":")
+	if !ok || !strings.HasPrefix(broadcastID, broadcastIDPrefix) || userID == "" {
+		return Notification{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.list {
+		if b.ID != broadcastID {
+			continue
+		}
+		if readAt, ok := s.reads[b.ID][userID]; ok {
+			at = readAt
+		} else {
+			s.reads[b.ID][userID] = at
+			s.version++
+		}
+		notification := b.copyFor(userID)
+		notification.Status = "read"
+		notification.ReadAt = &at
+		return notification, true
+	}
+	return Notification{}, false
+}
+
+// MarkAllRead marks every broadcast reaching userID in tenant as read, returning how many changed
+func (s *broadcastStore) MarkAllRead(userID, tenant string, at time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	marked := 0
+	for _, b := range s.list {
+		if _, ok := s.reads[b.ID][userID]; ok || !b.reaches(tenant, at) {
+			continue
+		}
+		s.reads[b.ID][userID] = at
+		marked++
+	}
+	if marked > 0 {
+		s.version++
+	}
+	return marked
+}
+
+// copyFor returns userID's unread copy of the broadcast
+func (b *broadcast) copyFor(userID string) Notification {
+	return Notification{
+		ID:        b.ID + ":" + userID,
+		UserID:    userID,
+		Type:      b.Type,
+		Title:     b.Title,
+		Message:   b.Message,
+		Status:    "unread",
+		Category:  b.Category,
+		CreatedAt: b.CreatedAt,
+	}
+}
+
+func (b *broadcast) reaches(tenant string, now time.Time) bool {
+	return (b.Tenant == "" || b.Tenant == tenant) && (b.ExpiresAt == nil || now.Before(*b.ExpiresAt))
+}
+
+// withBroadcasts merges copies, in creation order, into list by creation time
+func (list listing) withBroadcasts(copies []Notification) listing {
+	if len(copies) == 0 {
+		return list
+	}
+	all, scan := list.all, list.scan
+	return listing{
+		count: list.count + len(copies),
+		all: func() []Notification {
+			merged := append(all(), copies...)
+			sort.SliceStable(merged, func(i, j int) bool { return merged[i].CreatedAt.Before(merged[j].CreatedAt) })
+			return merged
+		},
+		scan: func(fn func(Notification) error) error {
+			pending := copies
+			err := scan(func(notification Notification) error {
+				for len(pending) > 0 && !notification.CreatedAt.Before(pending[0].CreatedAt) {
+					if err := fn(pending[0]); err != nil {
+						return err
+					}
+					pending = pending[1:]
+				}
+				return fn(notification)
+			})
+			if err != nil {
+				return err
+			}
+			for _, notification := range pending {
+				if err := fn(notification); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// registerBroadcastRoutes adds the admin endpoints announcing to all users
+func registerBroadcastRoutes(admin *gin.RouterGroup, service *notificationService) {
+	admin.POST("/broadcasts", func(c *gin.Context) {
+		var req broadcastRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		b, err := service.Broadcast(c.Request.Context(), req)
+		if errors.Is(err, errTypeQuarantined) {
+			// Held for review rather than announced
+			c.JSON(http.StatusAccepted, gin.H{
+				"success":     true,
+				"data":        b,
+				"quarantined": true,
+			})
+			return
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"success": true,
+			"data":    b,
+		})
+	})
+
+	admin.GET("/broadcasts", func(c *gin.Context) {
+		list := service.broadcasts.List()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/reqctx"
+	"platform/pkg/server"
+)
+
+const testAdminKey = "admin-key"
+
+func broadcastRouter(t *testing.T, store *notificationStore, broadcasts *broadcastStore, threshold int) *gin.Engine {
+	t.Helper()
+	return broadcastRouterFor(testService(store, broadcasts, systemClock{}), threshold)
+}
+
+func broadcastRouterFor(service *notificationService, threshold int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := server.NewEngine(server.Options{})
+	registerBroadcastRoutes(r.Group("/api/admin", adminAuth(testAdminKey)), service)
+	registerAPIRoutes(r.Group("/api"), context.Background(), service, newTemplateStore(), threshold)
+	return r
+}
+
+func TestBroadcastsReachEveryInbox(t *testing.T) {
+	store := newNotificationStore(testNotification("a1", "alice"), testNotification("b1", "bob"))
+	broadcasts := newBroadcastStore()
+	r := broadcastRouter(t, store, broadcasts, 1000)
+	do := func(method, path, tenant, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", testAdminKey)
+		if tenant != "" {
+			req.Header.Set(reqctx.TenantHeader, tenant)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	announce := func(body string) string {
+		rec := do(http.MethodPost, "/api/admin/broadcasts", "", body)
+		var resp struct {
+			Data broadcast `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusCreated {
+			t.Fatalf("broadcast returned %d: %s", rec.Code, rec.Body)
+		}
+		return resp.Data.ID
+	}
+	inbox := func(userID, tenant string, threshold int) []Notification {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/"+userID+"/notifications", nil)
+		if tenant != "" {
+			req.Header.Set(reqctx.TenantHeader, tenant)
+		}
+		rec := httptest.NewRecorder()
+		broadcastRouter(t, store, broadcasts, threshold).ServeHTTP(rec, req)
+		var resp listEnvelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	etag := do(http.MethodGet, "/api/users/alice/notifications", "", "").Header().Get("ETag")
+	everyone := announce(`{"type":"maintenance","title":"Downtime","message":"Sunday 2am"}`)
+	acme := announce(`{"tenant":"acme","type":"maintenance","title":"Acme","message":"Acme only","category":"security"}`)
+	if got := do(http.MethodGet, "/api/users/alice/notifications", "", "").Header().Get("ETag"); got == etag {
+		t.Error("inbox ETag unchanged by a broadcast")
+	}
+	if code := do(http.MethodPost, "/api/admin/broadcasts", "", `{"type":"x","title":"T","message":"M","category":"newsletter"}`).Code; code != http.StatusBadRequest {
+		t.Errorf("broadcast with unknown category returned %d, want 400", code)
+	}
+
+	for _, threshold := range []int{1000, 0} {
+		if got := ids(inbox("alice", "", threshold)); got != "a1,"+everyone+":alice" {
+			t.Errorf("threshold %d: alice's inbox = %s", threshold, got)
+		}
+		if got := ids(inbox("bob", "acme", threshold)); got != "b1,"+everyone+":bob,"+acme+":bob" {
+			t.Errorf("threshold %d: bob's acme inbox = %s", threshold, got)
+		}
+	}
+
+	rec := do(http.MethodPatch, "/api/notifications/"+everyone+":alice/read", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reading alice's copy returned %d", rec.Code)
+	}
+	for user, want := range map[string]string{"alice": "read", "bob": "unread"} {
+		if copies := inbox(user, "", 1000); copies[1].Status != want {
+			t.Errorf("%s's copy is %s, want %s", user, copies[1].Status, want)
+		}
+	}
+	if code := do(http.MethodPatch, "/api/notifications/"+broadcastIDPrefix+"missing:alice/read", "", "").Code; code != http.StatusNotFound {
+		t.Errorf("reading an unknown broadcast returned %d, want 404", code)
+	}
+
+	do(http.MethodPatch, "/api/users/bob/notifications/read", "acme", "")
+	var list struct {
+		Data []broadcast `json:"data"`
+	}
+	json.Unmarshal(do(http.MethodGet, "/api/admin/broadcasts", "", "").Body.Bytes(), &list)
+	if len(list.Data) != 2 || list.Data[0].Reads != 2 || list.Data[1].Reads != 1 {
+		t.Errorf("broadcasts = %+v, want 2 and 1 reads", list.Data)
+	}
+}
+
+func TestBroadcastsAreCheckedLikeNotifications(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Quotas.Enabled = true
+	cfg.Quotas.Tenants = map[string]QuotaConfig{"acme": {Daily: QuotaLimits{Notifications: 1}}}
+	service := testService(newNotificationStore(), newBroadcastStore(), systemClock{})
+	service.quotas = newQuotaMeter(cfg.Quotas)
+	service.types.Put(NotificationType{Name: "maintenance"})
+	r := broadcastRouterFor(service, 1000)
+	announce := func(key, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/broadcasts", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := announce("", `{"type":"maintenance","title":"T","message":"M"}`); code != http.StatusUnauthorized {
+		t.Errorf("broadcast without the admin key returned %d, want 401", code)
+	}
+	if code := announce(testAdminKey, `{"tenant":"acme","type":"maintenance","title":"T","message":"M"}`); code != http.StatusCreated {
+		t.Errorf("broadcast returned %d, want 201", code)
+	}
+	if code := announce(testAdminKey, `{"tenant":"acme","type":"maintenance","title":"T","message":"M"}`); code != http.StatusTooManyRequests {
+		t.Errorf("broadcast past the tenant's quota returned %d, want 429", code)
+	}
+
+	service.types.SetUnknown(unknownTypesReject)
+	if code := announce(testAdminKey, `{"type":"made-up","title":"T","message":"M"}`); code != http.StatusBadRequest {
+		t.Errorf("broadcast of a rejected type returned %d, want 400", code)
+	}
+	service.types.SetUnknown(unknownTypesQuarantine)
+	if code := announce(testAdminKey, `{"type":"made-up","title":"T","message":"M"}`); code != http.StatusAccepted || len(service.types.Quarantined()) != 1 {
+		t.Errorf("broadcast of a quarantined type returned %d with %d held", code, len(service.types.Quarantined()))
+	}
+	if list := service.broadcasts.List(); len(list) != 1 {
+		t.Errorf("%d broadcasts announced, want only the first", len(list))
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"platform/pkg/logging"
+)
+
+// sendScheduled is the status of a campaign whose send has not started yet
+const sendScheduled = "scheduled"
+
+// campaignRequest creates a campaign: a template rendered once and sent to a segment at a scheduled time
+type campaignRequest struct {
+	// Name labels the campaign's notifications and click metrics, e.g. spring-sale-2026
+	Name string `json:"name" binding:"required,max=64"`
+	// Template is the campaign's content, unless it is A/B tested with Variants
+	Template string            `json:"template" binding:"required_without=Variants"`
+	Variants []campaignVariant `json:"variants" binding:"omitempty,dive"`
+	// Type defaults to Template, or to Name when there are variants
+	Type     string               `json:"type"`
+	Data     map[string]any       `json:"data"`
+	Segment  string               `json:"segment" binding:"required"`
+	Category string               `json:"category"`
+	Channels []string             `json:"channels"`
+	Actions  []NotificationAction `json:"actions"`
+	// ScheduledAt defaults to now
+	ScheduledAt *time.Time `json:"scheduled_at"`
+	// LocalTime, e.g. 09:00, sends to each user the first time it is that
+	// time in their timezone from ScheduledAt on
+	LocalTime string `json:"local_time"`
+}
+
+// campaignVariant is one template of an A/B tested campaign
+//
+// Each user is assigned a variant with probability Weight over the sum of
+// the weights.
+type campaignVariant struct {
+	Name     string `json:"name" binding:"required,max=32"`
+	Template string `json:"template" binding:"required"`
+	Weight   int    `json:"weight" binding:"required,min=1"`
+}
+
+// campaign is a scheduled send to a segment
+type campaign struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Template    string            `json:"template,omitempty"`
+	Variants    []campaignVariant `json:"variants,omitempty"`
+	Segment     string            `json:"segment"`
+	Status      string            `json:"status"`
+	ScheduledAt time.Time         `json:"scheduled_at"`
+	// SendID is the segment send started at ScheduledAt
+	SendID    string    `json:"send_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	send segmentSendRequest
+}
+
+// campaignStats is how far a campaign's notifications got
+type campaignStats struct {
+	CampaignID string `json:"campaign_id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Matched    int    `json:"matched"`
+	engagementCounts
+	Variants []variantStats `json:"variants,omitempty"`
+}
+
+// variantStats is how far the notifications of one campaign variant got
+type variantStats struct {
+	Variant string `json:"variant"`
+	Weight  int    `json:"weight"`
+	engagementCounts
+}
+
+// engagementCounts counts notifications sent and reaching each later stage
+//
+// Delivered, Read and Clicked count notifications, not deliveries, reads or
+// clicks, so they never exceed Sent.
+type engagementCounts struct {
+	Sent         int     `json:"sent"`
+	Delivered    int     `json:"delivered"`
+	Read         int     `json:"read"`
+	Clicked      int     `json:"clicked"`
+	DeliveryRate float64 `json:"delivery_rate"`
+	ReadRate     float64 `json:"read_rate"`
+	ClickRate    float64 `json:"click_rate"`
+}
+
+// withRates fills in the rates from the counts
+func (c engagementCounts) withRates() engagementCounts {
+	if c.Sent > 0 {
+		sent := float64(c.Sent)
+		c.DeliveryRate = float64(c.Delivered) / sent
+		c.ReadRate = float64(c.Read) / sent
+		c.ClickRate = float64(c.Clicked) / sent
+	}
+	return c
+}
+
+// campaignEngagement maps the campaign's notifications that reached each stage to their variant
+type campaignEngagement struct {
+	delivered, read, clicked map[string]string
+}
+
+// count counts the notifications of variant in stage; an empty variant counts them all
+func count(stage map[string]string, variant string) int {
+	if variant == "" {
+		return len(stage)
+	}
+	n := 0
+	for _, v := range stage {
+		if v == variant {
+			n++
+		}
+	}
+	return n
+}
+
+// campaignManager schedules campaigns and tracks what happens to their notifications
+//
+// Campaign notifications carry the campaign name, which is how deliveries,
+// reads and clicks are attributed. Campaigns are only created on the leader
+// and live in memory there; one still scheduled when the lease is lost is
+// cancelled.
+type campaignManager struct {
+	templates *templateStore
+	sender    *segmentSender
+	leader    leaderContext
+
+	mu         sync.Mutex
+	campaigns  map[string]*campaign
+	order      []string
+	engagement map[string]*campaignEngagement
+}
+
+func newCampaignManager(templates *templateStore, sender *segmentSender) *campaignManager {
+	return &campaignManager{
+		templates:  templates,
+		sender:     sender,
+		campaigns:  make(map[string]*campaign),
+		engagement: make(map[string]*campaignEngagement),
+	}
+}
+
+// Create validates req, renders its templates and schedules the send
+func (m *campaignManager) Create(ctx context.Context, req campaignRequest) (campaign, error) {
+	send, err := m.prepare(req)
+	if err != nil {
+		return campaign{}, err
+	}
+	leaderCtx, err := m.leader.Get()
+	if err != nil {
+		return campaign{}, err
+	}
+
+	now := time.Now()
+	scheduledAt := scheduleFor(req, now)
+	c := &campaign{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Template:    req.Template,
+		Variants:    req.Variants,
+		Segment:     req.Segment,
+		Status:      sendScheduled,
+		ScheduledAt: scheduledAt,
+		CreatedAt:   now,
+		send:        send,
+	}
+
+	m.mu.Lock()
+	if _, taken := m.engagement[c.Name]; taken {
+		m.mu.Unlock()
+		return campaign{}, errors.New("Campaign name is already used: " + c.Name)
+	}
+	m.campaigns[c.ID] = c
+	m.order = append(m.order, c.ID)
+	m.engagement[c.Name] = &campaignEngagement{
+		delivered: make(map[string]string),
+		read:      make(map[string]string),
+		clicked:   make(map[string]string),
+	}
+	snapshot := *c
+	m.mu.Unlock()
+
+	logger := logging.FromContext(ctx).With("campaign_id", c.ID, "campaign", c.Name)
+	time.AfterFunc(scheduledAt.Sub(now), func() { m.launch(logging.NewContext(leaderCtx, logger), c) })
+	return snapshot, nil
+}
+
+// scheduleFor returns when the campaign req asks for starts sending: its schedule, or now if that has passed
+func scheduleFor(req campaignRequest, now time.Time) time.Time {
+	if req.ScheduledAt != nil && req.ScheduledAt.After(now) {
+		return *req.ScheduledAt
+	}
+	return now
+}
+
+// prepare renders the templates of req into the segment send it stands for
+func (m *campaignManager) prepare(req campaignRequest) (segmentSendRequest, error) {
+	send := segmentSendRequest{
+		Segment:  req.Segment,
+		Type:     req.Type,
+		Category: req.Category,
+		Campaign: req.Name,
+		Channels: req.Channels,
+		Actions:  req.Actions,
+
+		LocalTime: req.LocalTime,
+	}
+	if len(req.Variants) == 0 {
+		tmpl, title, message, err := m.render(req.Template, req.Data)
+		if err != nil {
+			return segmentSendRequest{}, err
+		}
+		send.Title, send.Message = title, message
+		send.template, send.templateVersion = tmpl.Name, tmpl.Version
+		if send.Type == "" {
+			send.Type = req.Template
+		}
+	} else {
+		if req.Template != "" {
+			return segmentSendRequest{}, errors.New("A campaign has either a template or variants")
+		}
+		seen := make(map[string]bool, len(req.Variants))
+		for _, variant := range req.Variants {
+			if seen[variant.Name] {
+				return segmentSendRequest{}, errors.New("Duplicate variant: " + variant.Name)
+			}
+			seen[variant.Name] = true
+			tmpl, title, message, err := m.render(variant.Template, req.Data)
+			if err != nil {
+				return segmentSendRequest{}, errors.New("Variant " + variant.Name + ": " + err.Error())
+			}
+			send.variants = append(send.variants, sendVariant{
+				Name: variant.Name, Weight: variant.Weight, Title: title, Message: message,
+				Template: tmpl.Name, TemplateVersion: tmpl.Version,
+			})
+		}
+		if send.Type == "" {
+			send.Type = req.Name
+		}
+	}
+	return m.sender.validate(send)
+}
+
+// render renders the named template with data, returning the version it rendered
+func (m *campaignManager) render(name string, data map[string]any) (*NotificationTemplate, string, string, error) {
+	tmpl, err := m.templates.Get(name)
+	if err != nil {
+		return nil, "", "", err
+	}
+	title, message, err := tmpl.Render(data)
+	if err != nil {
+		return nil, "", "", errors.New("Rendering template: " + err.Error())
+	}
+	return tmpl, title, message, nil
+}
+
+// launch starts the campaign's segment send
+func (m *campaignManager) launch(ctx context.Context, c *campaign) {
+	if ctx.Err() != nil {
+		m.mu.Lock()
+		c.Status = sendCancelled
+		m.mu.Unlock()
+		return
+	}
+	send, err := m.sender.Start(ctx, c.send)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		logging.FromContext(ctx).Error("campaign send failed to start", "error", err)
+		c.Status = sendFailed
+		c.Error = err.Error()
+		return
+	}
+	c.SendID = send.ID
+}
+
+// Get returns the campaign with the given ID
+func (m *campaignManager) Get(id string) (campaign, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.campaigns[id]
+	if !ok {
+		return campaign{}, false
+	}
+	return m.viewLocked(c), true
+}
+
+// List returns every campaign, oldest first
+func (m *campaignManager) List() []campaign {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]campaign, len(m.order))
+	for i, id := range m.order {
+		list[i] = m.viewLocked(m.campaigns[id])
+	}
+	return list
+}
+
+// Stats returns the delivery statistics of the campaign with the given ID
+func (m *campaignManager) Stats(id string) (campaignStats, bool) {
+	m.mu.Lock()
+	c, ok := m.campaigns[id]
+	if !ok {
+		m.mu.Unlock()
+		return campaignStats{}, false
+	}
+	defer m.mu.Unlock()
+	send, _ := m.sender.Get(c.SendID)
+	engagement := m.engagement[c.Name]
+	counts := func(variant string, sent int) engagementCounts {
+		return engagementCounts{
+			Sent:      sent,
+			Delivered: count(engagement.delivered, variant),
+			Read:      count(engagement.read, variant),
+			Clicked:   count(engagement.clicked, variant),
+		}.withRates()
+	}
+
+	stats := campaignStats{
+		CampaignID:       c.ID,
+		Name:             c.Name,
+		Status:           m.viewLocked(c).Status,
+		Matched:          send.Matched,
+		engagementCounts: counts("", send.Sent),
+	}
+	for _, variant := range c.Variants {
+		stats.Variants = append(stats.Variants, variantStats{
+			Variant:          variant.Name,
+			Weight:           variant.Weight,
+			engagementCounts: counts(variant.Name, send.SentByVariant[variant.Name]),
+		})
+	}
+	return stats, true
+}
+
+// Delivered records that a campaign notification was delivered on some channel
+func (m *campaignManager) Delivered(notification Notification) {
+	m.record(notification, func(e *campaignEngagement) map[string]string { return e.delivered })
+}
+
+// Read records that a campaign notification was read
+func (m *campaignManager) Read(notification Notification) {
+	m.record(notification, func(e *campaignEngagement) map[string]string { return e.read })
+}
+
+// Clicked records that one of a campaign notification's actions was clicked
+func (m *campaignManager) Clicked(notification Notification) {
+	m.record(notification, func(e *campaignEngagement) map[string]string { return e.clicked })
+}
+
+func (m *campaignManager) record(notification Notification, stage func(*campaignEngagement) map[string]string) {
+	if notification.Campaign == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Notifications labelled with a campaign name no campaign uses are not tracked
+	if engagement, ok := m.engagement[notification.Campaign]; ok {
+		stage(engagement)[notification.ID] = notification.Variant
+	}
+}
+
+// viewLocked returns c with the status of its send once it has started
+func (m *campaignManager) viewLocked(c *campaign) campaign {
+	view := *c
+	if send, ok := m.sender.Get(c.SendID); ok {
+		view.Status = send.Status
+	}
+	return view
+}
+
+// registerCampaignRoutes adds the admin endpoints for campaigns
+func registerCampaignRoutes(admin *gin.RouterGroup, campaigns *campaignManager) {
+	admin.POST("/campaigns", func(c *gin.Context) {
+		var req campaignRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		if c.Query("dry_run") == "true" {
+			preview, err := campaigns.Preview(c.Request.Context(), req)
+			respondPreview(c, preview, err)
+			return
+		}
+		created, err := campaigns.Create(c.Request.Context(), req)
+		if errors.Is(err, errUsersDisabled) || errors.Is(err, errNotLeader) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"success": true,
+			"data":    created,
+		})
+	})
+
+	admin.GET("/campaigns", func(c *gin.Context) {
+		list := campaigns.List()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	})
+
+	admin.GET("/campaigns/:id", func(c *gin.Context) {
+		if found, ok := campaigns.Get(c.Param("id")); ok {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data":    found,
+			})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Campaign not found",
+		})
+	})
+
+	admin.GET("/campaigns/:id/stats", func(c *gin.Context) {
+		if stats, ok := campaigns.Stats(c.Param("id")); ok {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data":    stats,
+			})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Campaign not found",
+		})
+	})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func campaignRouter(t *testing.T, users []userProfile) (*gin.Engine, *campaignManager, *notificationStore) {
+	t.Helper()
+	segments := map[string]SegmentConfig{"pro": {Plans: []string{planPro}}}
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	store := newNotificationStore()
+	writer := newNotificationWriter(WriteBehindConfig{}, store, newNotificationHub())
+	templates := newTemplateStore()
+	for _, tmpl := range []NotificationTemplate{
+		{Name: "spring-sale", Subject: "{{.discount}}% off", Body: "Until {{.until}}"},
+		{Name: "spring-sale-urgent", Subject: "Last chance: {{.discount}}% off", Body: "Ends {{.until}}"},
+	} {
+		if err := templates.Put(tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sender := newSegmentSender(segments, staticProfiles{users: users}, dispatcher, writer, newContentValidator(cfg.Content))
+	sender.leader.set(context.Background())
+	campaigns := newCampaignManager(templates, sender)
+	campaigns.leader.set(context.Background())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerCampaignRoutes(r.Group("/api/admin"), campaigns)
+	return r, campaigns, store
+}
+
+func postCampaign(r *gin.Engine, body string) (int, campaign) {
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/campaigns", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var resp struct {
+		Data campaign `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp.Data
+}
+
+func getCampaignStats(r *gin.Engine, id string) (int, campaignStats) {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/campaigns/"+id+"/stats", nil))
+	var resp struct {
+		Data campaignStats `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp.Data
+}
+
+// waitForCampaign polls the stats of campaign id until its send completes
+func waitForCampaign(t *testing.T, r *gin.Engine, id string) campaignStats {
+	t.Helper()
+	var stats campaignStats
+	deadline := time.Now().Add(5 * time.Second)
+	for stats.Status != sendCompleted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		_, stats = getCampaignStats(r, id)
+	}
+	if stats.Status != sendCompleted {
+		t.Fatalf("campaign %s did not complete: %+v", id, stats)
+	}
+	return stats
+}
+
+func TestCampaignStats(t *testing.T) {
+	now := time.Now()
+	r, campaigns, store := campaignRouter(t, []userProfile{
+		{ID: "pro-1", Plan: planPro, CreatedAt: now},
+		{ID: "pro-2", Plan: planPro, CreatedAt: now},
+		{ID: "pro-3", Plan: planPro, CreatedAt: now},
+		{ID: "pro-4", Plan: planPro, CreatedAt: now},
+		{ID: "free-1", Plan: planFree, CreatedAt: now},
+	})
+	post := func(body string) (int, campaign) { return postCampaign(r, body) }
+	stats := func(id string) campaignStats {
+		_, stats := getCampaignStats(r, id)
+		return stats
+	}
+
+	scheduled := now.Add(200 * time.Millisecond).Format(time.RFC3339Nano)
+	code, created := post(`{"name":"spring","template":"spring-sale","data":{"discount":20,"until":"Friday"},"segment":"pro","category":"promotions","scheduled_at":"` + scheduled + `"}`)
+	if code != http.StatusCreated || created.Status != sendScheduled {
+		t.Fatalf("campaign returned %d with %+v", code, created)
+	}
+	for _, body := range []string{
+		`{"name":"spring","template":"spring-sale","data":{"discount":20,"until":"Friday"},"segment":"pro"}`,
+		`{"name":"other","template":"missing","segment":"pro"}`,
+		`{"name":"other","template":"spring-sale","data":{"discount":20},"segment":"pro"}`,
+		`{"name":"other","template":"spring-sale","data":{"discount":20,"until":"Friday"},"segment":"missing"}`,
+	} {
+		if code, _ := post(body); code != http.StatusBadRequest {
+			t.Errorf("campaign %s returned %d, want 400", body, code)
+		}
+	}
+	if got := stats(created.ID); got.Status != sendScheduled || got.Sent != 0 {
+		t.Errorf("stats before the schedule = %+v", got)
+	}
+
+	got := waitForCampaign(t, r, created.ID)
+	if got.Matched != 4 || got.Sent != 4 {
+		t.Fatalf("stats after the send = %+v, want 4 matched and sent", got)
+	}
+
+	sent := store.List()
+	if sent[0].Title != "20% off" || sent[0].Campaign != "spring" {
+		t.Errorf("stored %+v", sent[0])
+	}
+	for _, n := range sent[:3] {
+		campaigns.Delivered(n)
+		campaigns.Delivered(n)
+	}
+	campaigns.Read(sent[0])
+	campaigns.Read(sent[1])
+	campaigns.Clicked(sent[0])
+	campaigns.Read(Notification{ID: "unrelated", Campaign: "winter"})
+
+	got = stats(created.ID)
+	if got.Delivered != 3 || got.Read != 2 || got.Clicked != 1 || got.DeliveryRate != 0.75 || got.ReadRate != 0.5 || got.ClickRate != 0.25 {
+		t.Errorf("stats = %+v, want 3 delivered, 2 read and 1 clicked of 4", got)
+	}
+	if code, _ := getCampaignStats(r, "missing"); code != http.StatusNotFound {
+		t.Errorf("stats of an unknown campaign returned %d, want 404", code)
+	}
+}
+
+func TestCampaignVariants(t *testing.T) {
+	now := time.Now()
+	var users []userProfile
+	for i := 0; i < 200; i++ {
+		users = append(users, userProfile{ID: "pro-" + strconv.Itoa(i), Plan: planPro, CreatedAt: now})
+	}
+	r, campaigns, store := campaignRouter(t, users)
+
+	for _, body := range []string{
+		`{"name":"both","template":"spring-sale","variants":[{"name":"a","template":"spring-sale","weight":1}],"segment":"pro"}`,
+		`{"name":"neither","segment":"pro"}`,
+		`{"name":"weightless","variants":[{"name":"a","template":"spring-sale"}],"segment":"pro"}`,
+		`{"name":"duplicate","variants":[{"name":"a","template":"spring-sale","weight":1},{"name":"a","template":"spring-sale-urgent","weight":1}],"data":{"discount":20,"until":"Friday"},"segment":"pro"}`,
+		`{"name":"unknown","variants":[{"name":"a","template":"missing","weight":1}],"segment":"pro"}`,
+	} {
+		if code, _ := postCampaign(r, body); code != http.StatusBadRequest {
+			t.Errorf("campaign %s returned %d, want 400", body, code)
+		}
+	}
+
+	code, created := postCampaign(r, `{"name":"spring-ab","variants":[{"name":"control","template":"spring-sale","weight":3},{"name":"urgent","template":"spring-sale-urgent","weight":1}],"data":{"discount":20,"until":"Friday"},"segment":"pro"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("campaign returned %d", code)
+	}
+	waitForCampaign(t, r, created.ID)
+
+	titles := map[string]string{"control": "20% off", "urgent": "Last chance: 20% off"}
+	templates := map[string]string{"control": "spring-sale", "urgent": "spring-sale-urgent"}
+	for _, n := range store.List() {
+		if n.Type != "spring-ab" || n.Title != titles[n.Variant] {
+			t.Fatalf("stored %+v", n)
+		}
+		if n.Template != templates[n.Variant] || n.TemplateVersion != 1 {
+			t.Errorf("%s was rendered by %s version %d, want %s version 1", n.ID, n.Template, n.TemplateVersion, templates[n.Variant])
+		}
+		if want := variantFor([]sendVariant{{Name: "control", Weight: 3}, {Name: "urgent", Weight: 1}}, "spring-ab", n.UserID); n.Variant != want.Name {
+			t.Errorf("%s got variant %s, then %s", n.UserID, n.Variant, want.Name)
+		}
+		if n.Variant == "urgent" {
+			campaigns.Read(n)
+			campaigns.Clicked(n)
+		}
+	}
+
+	_, stats := getCampaignStats(r, created.ID)
+	if len(stats.Variants) != 2 {
+		t.Fatalf("variant stats = %+v", stats.Variants)
+	}
+	control, urgent := stats.Variants[0], stats.Variants[1]
+	if control.Sent+urgent.Sent != 200 || control.Sent < 120 || control.Sent > 180 {
+		t.Errorf("sent %d control and %d urgent, want about 3:1", control.Sent, urgent.Sent)
+	}
+	if control.ReadRate != 0 || urgent.ReadRate != 1 || urgent.ClickRate != 1 || stats.Read != urgent.Sent {
+		t.Errorf("stats = %+v, want only the urgent variant read and clicked", stats)
+	}
+}
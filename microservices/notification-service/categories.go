@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Categories group notifications into inbox tabs; unlike the free-form type
+// they are a fixed set clients can rely on
+const (
+	categoryOrders     = "orders"
+	categoryPayments   = "payments"
+	categoryPromotions = "promotions"
+	categorySecurity   = "security"
+	categorySystem     = "system"
+)
+
+var categories = []string{categoryOrders, categoryPayments, categoryPromotions, categorySecurity, categorySystem}
+
+const (
+	maxTags           = 10
+	maxTagLength      = 32
+	maxCampaignLength = 64
+)
+
+var errInvalidTags = errors.New("at most 10 tags of up to 32 characters")
+
+// mandatoryCategory reports whether notifications in category are notices
+// users must get, which quotas and throttles never hold back
+func mandatoryCategory(category string) bool {
+	return category == categorySecurity
+}
+
+// validCategory reports whether category is one of the known categories
+func validCategory(category string) bool {
+	return slices.Contains(categories, category)
+}
+
+// normalizeTags lowercases and trims tags, dropping empty and repeated ones
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, errInvalidTags
+		}
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, errInvalidTags
+	}
+	return normalized, nil
+}
+
+// classification validates req's category, tags and campaign, defaulting the category to system
+func (req CreateNotificationRequest) classification() (string, []string, error) {
+	category := req.Category
+	if category == "" {
+		category = categorySystem
+	}
+	if !validCategory(category) {
+		return "", nil, errors.New("Unknown category: " + category)
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return "", nil, errors.New("Invalid tags: " + err.Error())
+	}
+	// Campaigns label click-through metrics, so they are kept short
+	if len(req.Campaign) > maxCampaignLength {
+		return "", nil, errors.New("Campaign must be at most 64 characters")
+	}
+	return category, tags, nil
+}
+
+// notificationFilter narrows a listing by category and tags
+type notificationFilter struct {
+	// Categories matches notifications in any of them; empty matches all
+	Categories []string
+	// Tags matches notifications carrying every one of them
+	Tags []string
+	// AwakeAt, when set, hides notifications snoozed past it
+	AwakeAt time.Time
+}
+
+// parseFilter reads ?category=orders,payments&tag=a&tag=b
+func parseFilter(categoryParams, tagParams []string) (notificationFilter, error) {
+	var filter notificationFilter
+	for _, param := range categoryParams {
+		for _, category := range strings.Split(param, ",") {
+			if category = strings.TrimSpace(category); category == "" {
+				continue
+			}
+			if !validCategory(category) {
+				return notificationFilter{}, errors.New("Unknown category: " + category)
+			}
+			filter.Categories = append(filter.Categories, category)
+		}
+	}
+	tags, err := normalizeTags(tagParams)
+	if err != nil {
+		return notificationFilter{}, errors.New("Invalid tag filter: " + err.Error())
+	}
+	filter.Tags = tags
+	return filter, nil
+}
+
+func (f notificationFilter) empty() bool {
+	return len(f.Categories) == 0 && len(f.Tags) == 0 && f.AwakeAt.IsZero()
+}
+
+func (f notificationFilter) match(notification Notification) bool {
+	if len(f.Categories) > 0 && !slices.Contains(f.Categories, notification.Category) {
+		return false
+	}
+	if !f.AwakeAt.IsZero() && notification.SnoozedUntil != nil && notification.SnoozedUntil.After(f.AwakeAt) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !slices.Contains(notification.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
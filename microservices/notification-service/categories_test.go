@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCreateClassifiesNotifications(t *testing.T) {
+	store := newNotificationStore()
+	r := listingRouter(t, store, 1000)
+	create := func(body string) (int, Notification) {
+		req := httptest.NewRequest(http.MethodPost, "/api/notifications", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		var resp struct {
+			Data Notification `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Data
+	}
+
+	code, n := create(`{"user_id":"1","type":"info","title":"T","message":"M"}`)
+	if code != http.StatusCreated || n.Category != categorySystem || n.Tags != nil {
+		t.Errorf("unclassified create: %d, category %q, tags %v", code, n.Category, n.Tags)
+	}
+	code, n = create(`{"user_id":"1","type":"promo","title":"T","message":"M","category":"promotions","tags":[" Sale","sale","Spring "]}`)
+	if code != http.StatusCreated || n.Category != categoryPromotions || !slices.Equal(n.Tags, []string{"sale", "spring"}) {
+		t.Errorf("classified create: %d, category %q, tags %v", code, n.Category, n.Tags)
+	}
+
+	for _, body := range []string{
+		`{"user_id":"1","type":"info","title":"T","message":"M","category":"newsletter"}`,
+		`{"user_id":"1","type":"info","title":"T","message":"M","tags":["` + strings.Repeat("x", maxTagLength+1) + `"]}`,
+		`{"user_id":"1","type":"info","title":"T","message":"M","tags":["1","2","3","4","5","6","7","8","9","10","11"]}`,
+	} {
+		if code, _ := create(body); code != http.StatusBadRequest {
+			t.Errorf("create %s returned %d, want 400", body, code)
+		}
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	classified := func(id, category string, tags ...string) Notification {
+		n := testNotification(id, "alice")
+		n.Category, n.Tags = category, tags
+		return n
+	}
+	store := newNotificationStore(
+		classified("o1", categoryOrders, "shipping"),
+		classified("o2", categoryOrders),
+		classified("p1", categoryPromotions, "sale", "spring"),
+		classified("p2", categoryPromotions, "sale"),
+		classified("s1", categorySystem),
+	)
+
+	for _, threshold := range []int{1000, 0} {
+		r := listingRouter(t, store, threshold)
+		for query, want := range map[string]string{
+			"":                                 "o1,o2,p1,p2,s1",
+			"?category=orders":                 "o1,o2",
+			"?category=orders,system":          "o1,o2,s1",
+			"?category=orders&category=system": "o1,o2,s1",
+			"?tag=sale":                        "p1,p2",
+			"?tag=sale&tag=Spring":             "p1",
+			"?category=orders&tag=sale":        "",
+		} {
+			for _, path := range []string{"/api/notifications", "/api/users/alice/notifications"} {
+				var resp listEnvelope
+				if err := json.Unmarshal(getListing(r, path+query, "").Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if ids(resp.Data) != want || resp.Count != len(resp.Data) {
+					t.Errorf("threshold %d: GET %s%s = %s (count %d), want %s", threshold, path, query, ids(resp.Data), resp.Count, want)
+				}
+			}
+		}
+	}
+
+	if code := getListing(listingRouter(t, store, 1000), "/api/notifications?category=newsletter", "").Code; code != http.StatusBadRequest {
+		t.Errorf("unknown category filter returned %d, want 400", code)
+	}
+}
+
+func TestCategoryOptOuts(t *testing.T) {
+	h := &eventHandler{}
+	contact := userContact{UserID: "1", CategoryOptOuts: []string{categoryPayments}}
+
+	refund := EventMapping{Category: categoryPayments, Channels: []string{channelEmail}}
+	if got := h.channelsFor(context.Background(), refund, contact); len(got) != 0 {
+		t.Errorf("opted-out category delivered over %v", got)
+	}
+
+	failed := EventMapping{Category: categoryPayments, Channels: []string{channelEmail, channelPush}, MandatoryChannels: []string{channelEmail}}
+	if got := h.channelsFor(context.Background(), failed, contact); !slices.Equal(got, []string{channelEmail}) {
+		t.Errorf("mandatory notice in opted-out category delivered over %v, want [email]", got)
+	}
+
+	shipped := EventMapping{Category: categoryOrders, Channels: []string{channelEmail, channelPush}}
+	if got := h.channelsFor(context.Background(), shipped, contact); !slices.Equal(got, []string{channelEmail, channelPush}) {
+		t.Errorf("other category delivered over %v", got)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/logging"
+)
+
+// Components faults can be injected into, besides routes
+const (
+	// chaosEvents is the event consumers: failed events are redelivered, dropped ones committed unhandled
+	chaosEvents = "events"
+	// chaosProvider is deliveries to providers: failed ones are retried like any failed delivery
+	chaosProvider = "provider"
+	// chaosStore is batched notification writes: failed ones are spooled to
+	// disk when write-behind has a spool, and retried in memory otherwise
+	chaosStore = "store"
+)
+
+// maxChaosLatency bounds injected latency, so a typo cannot hang requests for hours
+const maxChaosLatency = time.Minute
+
+// chaosPathPrefix is never faulted, so operators can always turn faults off again
+const chaosPathPrefix = "/api/admin/chaos"
+
+var chaosFaultsInjectedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "chaos_faults_injected_total",
+		Help: "Faults injected in chaos mode, by route or component and kind of fault",
+	},
+	[]string{"target", "fault"},
+)
+
+// errChaosInjected is the error of operations failed by chaos mode
+var errChaosInjected = errors.New("fault injected by chaos mode")
+
+// chaosFault is what chaos mode injects into one route or component
+type chaosFault struct {
+	// Latency is added before every request or operation, e.g. 250ms
+	Latency string `json:"latency,omitempty"`
+	// ErrorRate is the share of requests or operations failed, from 0 to 1
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	// Status is what failed requests answer with; 503 by default
+	Status int `json:"status,omitempty"`
+	// DropRate is the share of broker messages dropped, from 0 to 1; events only
+	DropRate float64 `json:"drop_rate,omitempty"`
+
+	latency time.Duration
+}
+
+// chaosRules are every fault chaos mode injects
+type chaosRules struct {
+	// Routes are keyed by method and route pattern, e.g. "GET /api/notifications/:id"
+	Routes map[string]chaosFault `json:"routes"`
+	// Components are keyed by name: events, provider or store
+	Components map[string]chaosFault `json:"components"`
+}
+
+// validate checks rules and parses their latencies
+func (r *chaosRules) validate() error {
+	for route, fault := range r.Routes {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || method == "" || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("route %q: want a method and route pattern, e.g. GET /api/notifications/:id", route)
+		}
+		if strings.HasPrefix(path, chaosPathPrefix) {
+			return fmt.Errorf("route %q: the chaos endpoints cannot be faulted", route)
+		}
+		if fault.DropRate != 0 {
+			return fmt.Errorf("route %q: drop_rate only applies to the events component", route)
+		}
+		if err := fault.parse(); err != nil {
+			return fmt.Errorf("route %q: %w", route, err)
+		}
+		r.Routes[route] = fault
+	}
+	for component, fault := range r.Components {
+		if component != chaosEvents && component != chaosProvider && component != chaosStore {
+			return fmt.Errorf("component %q: must be events, provider or store", component)
+		}
+		if fault.DropRate != 0 && component != chaosEvents {
+			return fmt.Errorf("component %q: drop_rate only applies to events", component)
+		}
+		if fault.Status != 0 {
+			return fmt.Errorf("component %q: status only applies to routes", component)
+		}
+		if err := fault.parse(); err != nil {
+			return fmt.Errorf("component %q: %w", component, err)
+		}
+		r.Components[component] = fault
+	}
+	return nil
+}
+
+// parse checks the fault's rates and status and parses its latency
+func (f *chaosFault) parse() error {
+	if f.Latency != "" {
+		latency, err := time.ParseDuration(f.Latency)
+		if err != nil || latency < 0 || latency > maxChaosLatency {
+			return fmt.Errorf("latency %q must be a duration up to %s", f.Latency, maxChaosLatency)
+		}
+		f.latency = latency
+	}
+	if f.ErrorRate < 0 || f.ErrorRate > 1 || f.DropRate < 0 || f.DropRate > 1 {
+		return errors.New("error_rate and drop_rate must be between 0 and 1")
+	}
+	if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+		return fmt.Errorf("status %d must be an error status", f.Status)
+	}
+	return nil
+}
+
+// chaosInjector injects the faults operators set into routes and components
+//
+// A nil injector, as when chaos mode is off, injects nothing.
+type chaosInjector struct {
+	rules atomic.Pointer[chaosRules]
+	// roll returns a number in [0, 1) deciding whether a fault fires
+	roll func() float64
+}
+
+func newChaosInjector() *chaosInjector {
+	c := &chaosInjector{roll: rand.Float64}
+	c.rules.Store(&chaosRules{})
+	return c
+}
+
+// Rules returns the faults being injected
+func (c *chaosInjector) Rules() chaosRules {
+	return *c.rules.Load()
+}
+
+// SetRules replaces the faults being injected; rules must have been validated
+func (c *chaosInjector) SetRules(rules chaosRules) {
+	c.rules.Store(&rules)
+}
+
+// delay waits out fault's latency, returning false if ctx ended first
+func (c *chaosInjector) delay(ctx context.Context, target string, fault chaosFault) bool {
+	if fault.latency <= 0 {
+		return true
+	}
+	chaosFaultsInjectedTotal.WithLabelValues(target, "latency").Inc()
+	return sleepCtx(ctx, fault.latency)
+}
+
+// fails reports whether fault fails this request or operation
+func (c *chaosInjector) fails(target string, fault chaosFault) bool {
+	if fault.ErrorRate <= 0 || c.roll() >= fault.ErrorRate {
+		return false
+	}
+	chaosFaultsInjectedTotal.WithLabelValues(target, "error").Inc()
+	return true
+}
+
+// Middleware injects the faults set for each request's route
+func (c *chaosInjector) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		target := ctx.Request.Method + " " + ctx.FullPath()
+		fault, ok := c.rules.Load().Routes[target]
+		if !ok {
+			ctx.Next()
+			return
+		}
+		if !c.delay(ctx.Request.Context(), target, fault) {
+			ctx.Abort()
+			return
+		}
+		if c.fails(target, fault) {
+			status := fault.Status
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			ctx.Header("X-Chaos-Fault", "error")
+			ctx.AbortWithStatusJSON(status, gin.H{
+				"success": false,
+				"error":   "Fault injected by chaos mode",
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// Inject delays an operation of component and fails it, as its faults say
+func (c *chaosInjector) Inject(ctx context.Context, component string) error {
+	if c == nil {
+		return nil
+	}
+	fault, ok := c.rules.Load().Components[component]
+	if !ok {
+		return nil
+	}
+	if !c.delay(ctx, component, fault) {
+		return ctx.Err()
+	}
+	if c.fails(component, fault) {
+		return fmt.Errorf("%s: %w", component, errChaosInjected)
+	}
+	return nil
+}
+
+// Drop reports whether a broker message for component should be dropped
+func (c *chaosInjector) Drop(component string) bool {
+	if c == nil {
+		return false
+	}
+	fault, ok := c.rules.Load().Components[component]
+	if !ok || fault.DropRate <= 0 || c.roll() >= fault.DropRate {
+		return false
+	}
+	chaosFaultsInjectedTotal.WithLabelValues(component, "drop").Inc()
+	return true
+}
+
+// chaosSender injects the provider faults before handing deliveries on
+type chaosSender struct {
+	chaos *chaosInjector
+	next  Sender
+}
+
+func (s chaosSender) Send(ctx context.Context, notification Notification, to recipient) error {
+	if err := s.chaos.Inject(ctx, chaosProvider); err != nil {
+		return err
+	}
+	return s.next.Send(ctx, notification, to)
+}
+
+// Chaos injects chaos's provider faults into every channel's deliveries; call it before Start
+func (d *Dispatcher) Chaos(chaos *chaosInjector) {
+	for channel := range d.senders {
+		d.senders[channel] = chaosSender{chaos: chaos, next: d.senders[channel]}
+	}
+}
+
+// registerChaosRoutes adds the admin endpoints setting the faults chaos mode injects
+func registerChaosRoutes(admin *gin.RouterGroup, chaos *chaosInjector) {
+	admin.GET("/chaos", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    chaos.Rules(),
+		})
+	})
+
+	// Replace every fault; an empty body of rules stops injecting
+	admin.PUT("/chaos", func(c *gin.Context) {
+		var rules chaosRules
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		if err := rules.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		chaos.SetRules(rules)
+		logging.FromContext(c.Request.Context()).Warn("chaos faults set", "routes", len(rules.Routes), "components", len(rules.Components))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    rules,
+		})
+	})
+
+	admin.DELETE("/chaos", func(c *gin.Context) {
+		chaos.SetRules(chaosRules{})
+		logging.FromContext(c.Request.Context()).Warn("chaos faults cleared")
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+}
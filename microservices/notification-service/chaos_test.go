@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChaosRoutes(t *testing.T) {
+	chaos := newChaosInjector()
+	roll := 0.0
+	chaos.roll = func() float64 { return roll }
+	r := gin.New()
+	r.Use(chaos.Middleware())
+	admin := r.Group("/api/admin", adminAuth("0123456789abcdef"))
+	registerChaosRoutes(admin, chaos)
+	r.GET("/api/notifications/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "0123456789abcdef")
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{
+		`{"routes":{"/api/notifications/:id":{"error_rate":0.5}}}`,
+		`{"routes":{"GET /api/notifications/:id":{"error_rate":2}}}`,
+		`{"routes":{"GET /api/notifications/:id":{"latency":"2h"}}}`,
+		`{"routes":{"PUT /api/admin/chaos":{"error_rate":1}}}`,
+		`{"components":{"database":{"error_rate":1}}}`,
+		`{"components":{"provider":{"drop_rate":0.5}}}`,
+	} {
+		if rec := do(http.MethodPut, "/api/admin/chaos", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("faults %s returned %d, want 400", body, rec.Code)
+		}
+	}
+
+	if rec := do(http.MethodPut, "/api/admin/chaos", `{"routes":{"GET /api/notifications/:id":{"latency":"1ms","error_rate":0.5,"status":502}}}`); rec.Code != http.StatusOK {
+		t.Fatalf("setting faults returned %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/api/notifications/n1", ""); rec.Code != http.StatusBadGateway || rec.Header().Get("X-Chaos-Fault") != "error" {
+		t.Errorf("faulted request returned %d, want an injected 502", rec.Code)
+	}
+	roll = 0.9
+	if rec := do(http.MethodGet, "/api/notifications/n1", ""); rec.Code != http.StatusOK {
+		t.Errorf("request past the error rate returned %d, want 200", rec.Code)
+	}
+
+	roll = 0
+	if rec := do(http.MethodDelete, "/api/admin/chaos", ""); rec.Code != http.StatusOK {
+		t.Fatalf("clearing faults returned %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/notifications/n1", ""); rec.Code != http.StatusOK {
+		t.Errorf("request after clearing faults returned %d, want 200", rec.Code)
+	}
+}
+
+func TestChaosComponents(t *testing.T) {
+	var off *chaosInjector
+	if err := off.Inject(context.Background(), chaosProvider); err != nil || off.Drop(chaosEvents) {
+		t.Errorf("chaos mode off injected %v", err)
+	}
+
+	chaos := newChaosInjector()
+	chaos.roll = func() float64 { return 0.25 }
+	rules := chaosRules{Components: map[string]chaosFault{
+		chaosProvider: {ErrorRate: 0.5},
+		chaosEvents:   {DropRate: 0.1},
+		chaosStore:    {ErrorRate: 0.5},
+	}}
+	if err := rules.validate(); err != nil {
+		t.Fatal(err)
+	}
+	chaos.SetRules(rules)
+
+	sender := chaosSender{chaos: chaos, next: logSender{}}
+	if err := sender.Send(context.Background(), Notification{ID: "n1"}, recipient{}); !errors.Is(err, errChaosInjected) {
+		t.Errorf("send returned %v, want an injected failure", err)
+	}
+	// Failed writes of the store are what the write-behind spool takes over
+	store := newNotificationStore()
+	store.Chaos(chaos)
+	if err := store.WriteBatch(context.Background(), []Notification{testNotification("n1", "user-1")}); !errors.Is(err, errChaosInjected) || store.Len() != 0 {
+		t.Errorf("store write returned %v and kept %d notifications, want an injected failure", err, store.Len())
+	}
+	if err := chaos.Inject(context.Background(), chaosEvents); err != nil {
+		t.Errorf("events without an error rate failed with %v", err)
+	}
+	if chaos.Drop(chaosEvents) {
+		t.Error("an event was dropped past the drop rate")
+	}
+}
+
+func TestChaosNeedsAdminKey(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Chaos.Enabled = true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "chaos.enabled") {
+		t.Errorf("chaos mode without an admin key validated with %v", err)
+	}
+	cfg.Admin.APIKey = "0123456789abcdef"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("chaos mode with an admin key failed with %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Click-through metrics; the click-through rate of a type or campaign is
+// rate(clicks) / rate(offered)
+var (
+	actionsOfferedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_actions_offered_total",
+			Help: "Total number of notifications created with at least one action",
+		},
+		[]string{"type", "campaign"},
+	)
+
+	actionClicksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_action_clicks_total",
+			Help: "Total number of notification action clicks reported by clients",
+		},
+		[]string{"type", "campaign"},
+	)
+)
+
+// maxClickEvents is how many recent click events are kept for inspection
+const maxClickEvents = 10000
+
+// clickEvent is one tap on a notification action
+type clickEvent struct {
+	NotificationID string    `json:"notification_id"`
+	ActionID       string    `json:"action_id"`
+	UserID         string    `json:"user_id"`
+	Type           string    `json:"type"`
+	Campaign       string    `json:"campaign,omitempty"`
+	ClickedAt      time.Time `json:"clicked_at"`
+}
+
+// clickKey groups click-through statistics
+type clickKey struct {
+	Type     string
+	Campaign string
+}
+
+// clickSummary is the click-through of one type and campaign since startup
+type clickSummary struct {
+	Type     string `json:"type"`
+	Campaign string `json:"campaign,omitempty"`
+	// Offered counts notifications created with actions
+	Offered int `json:"offered"`
+	Clicks  int `json:"clicks"`
+	// Clicked counts notifications with at least one click
+	Clicked          int     `json:"clicked"`
+	ClickThroughRate float64 `json:"click_through_rate"`
+}
+
+// clickTracker records action clicks and aggregates them by type and campaign
+//
+// Aggregates cover everything since startup; individual events are kept in
+// a ring of the most recent maxClickEvents.
+type clickTracker struct {
+	mu      sync.Mutex
+	events  []clickEvent
+	next    int
+	stats   map[clickKey]*clickSummary
+	clicked map[string]bool
+}
+
+func newClickTracker() *clickTracker {
+	return &clickTracker{
+		stats:   make(map[clickKey]*clickSummary),
+		clicked: make(map[string]bool),
+	}
+}
+
+// Offered counts a newly created notification towards its click-through rate
+//
+// Notifications without actions cannot be clicked and are ignored.
+func (t *clickTracker) Offered(notification Notification) {
+	if len(notification.Actions) == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.summaryLocked(notification).Offered++
+	t.mu.Unlock()
+	actionsOfferedTotal.WithLabelValues(notification.Type, notification.Campaign).Inc()
+}
+
+// Click records a click on the action with the given ID, which must be one of notification's
+func (t *clickTracker) Click(notification Notification, actionID string, at time.Time) clickEvent {
+	event := clickEvent{
+		NotificationID: notification.ID,
+		ActionID:       actionID,
+		UserID:         notification.UserID,
+		Type:           notification.Type,
+		Campaign:       notification.Campaign,
+		ClickedAt:      at,
+	}
+
+	t.mu.Lock()
+	if len(t.events) < maxClickEvents {
+		t.events = append(t.events, event)
+	} else {
+		t.events[t.next] = event
+	}
+	t.next = (t.next + 1) % maxClickEvents
+
+	summary := t.summaryLocked(notification)
+	summary.Clicks++
+	if !t.clicked[notification.ID] {
+		t.clicked[notification.ID] = true
+		summary.Clicked++
+	}
+	t.mu.Unlock()
+
+	actionClicksTotal.WithLabelValues(notification.Type, notification.Campaign).Inc()
+	return event
+}
+
+// Events returns the retained clicks on notificationID, oldest first
+func (t *clickTracker) Events(notificationID string) []clickEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var events []clickEvent
+	// Once the ring is full, t.next is its oldest entry
+	for i := range t.events {
+		if event := t.events[(t.next+i)%len(t.events)]; event.NotificationID == notificationID {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Summary returns click-through per type and campaign, sorted by both
+func (t *clickTracker) Summary() []clickSummary {
+	t.mu.Lock()
+	summaries := make([]clickSummary, 0, len(t.stats))
+	for _, summary := range t.stats {
+		s := *summary
+		if s.Offered > 0 {
+			s.ClickThroughRate = float64(s.Clicked) / float64(s.Offered)
+		}
+		summaries = append(summaries, s)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Type != summaries[j].Type {
+			return summaries[i].Type < summaries[j].Type
+		}
+		return summaries[i].Campaign < summaries[j].Campaign
+	})
+	return summaries
+}
+
+func (t *clickTracker) summaryLocked(notification Notification) *clickSummary {
+	key := clickKey{Type: notification.Type, Campaign: notification.Campaign}
+	summary, ok := t.stats[key]
+	if !ok {
+		summary = &clickSummary{Type: key.Type, Campaign: key.Campaign}
+		t.stats[key] = summary
+	}
+	return summary
+}
+
+// hasAction reports whether notification offers an action with the given ID
+func hasAction(notification Notification, actionID string) bool {
+	return slices.ContainsFunc(notification.Actions, func(action NotificationAction) bool { return action.ID == actionID })
+}
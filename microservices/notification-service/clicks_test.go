@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestActionClickTracking(t *testing.T) {
+	store := newNotificationStore()
+	r := listingRouter(t, store, 1000)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	create := func(campaign string) string {
+		rec := do(http.MethodPost, "/api/notifications", `{"user_id":"1","type":"promo","title":"Sale","message":"Now on",
+			"campaign":"`+campaign+`","actions":[{"id":"shop","label":"Shop","url":"shop://sale"},{"id":"later","label":"Later","intent":"snooze"}]}`)
+		var resp struct {
+			Data Notification `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusCreated {
+			t.Fatalf("create returned %d: %s", rec.Code, rec.Body)
+		}
+		return resp.Data.ID
+	}
+
+	first, second := create("spring"), create("spring")
+	create("summer")
+	do(http.MethodPost, "/api/notifications", `{"user_id":"1","type":"promo","title":"Plain","message":"No actions","campaign":"spring"}`)
+
+	for _, click := range []struct {
+		id, action string
+		want       int
+	}{
+		{first, "shop", http.StatusCreated},
+		{first, "later", http.StatusCreated},
+		{second, "shop", http.StatusCreated},
+		{second, "unknown", http.StatusNotFound},
+		{"missing", "shop", http.StatusNotFound},
+	} {
+		if rec := do(http.MethodPost, "/api/notifications/"+click.id+"/actions/"+click.action+"/click", ""); rec.Code != click.want {
+			t.Errorf("click %s/%s returned %d, want %d", click.id, click.action, rec.Code, click.want)
+		}
+	}
+
+	var events struct {
+		Data []clickEvent `json:"data"`
+	}
+	json.Unmarshal(do(http.MethodGet, "/api/notifications/"+first+"/clicks", "").Body.Bytes(), &events)
+	if len(events.Data) != 2 || events.Data[0].ActionID != "shop" || events.Data[1].ActionID != "later" || events.Data[0].Campaign != "spring" {
+		t.Errorf("clicks on %s = %+v", first, events.Data)
+	}
+
+	var summary struct {
+		Data []clickSummary `json:"data"`
+	}
+	json.Unmarshal(do(http.MethodGet, "/api/clicks/summary", "").Body.Bytes(), &summary)
+	want := []clickSummary{
+		{Type: "promo", Campaign: "spring", Offered: 2, Clicks: 3, Clicked: 2, ClickThroughRate: 1},
+		{Type: "promo", Campaign: "summer", Offered: 1},
+	}
+	if len(summary.Data) != len(want) || summary.Data[0] != want[0] || summary.Data[1] != want[1] {
+		t.Errorf("summary = %+v, want %+v", summary.Data, want)
+	}
+}
+
+func TestClickEventsAreBounded(t *testing.T) {
+	clicks := newClickTracker()
+	n := testNotification("n", "alice")
+	n.Actions = []NotificationAction{{ID: "open", Label: "Open", Intent: "open"}}
+	for i := 0; i < maxClickEvents+5; i++ {
+		clicks.Click(n, "open", n.CreatedAt)
+	}
+	if got := len(clicks.Events("n")); got != maxClickEvents {
+		t.Errorf("retained %d events, want %d", got, maxClickEvents)
+	}
+	if s := clicks.Summary(); len(s) != 1 || s[0].Clicks != maxClickEvents+5 || s[0].Clicked != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+}
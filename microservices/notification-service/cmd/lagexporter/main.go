@@ -0,0 +1,201 @@
+// Command lagexporter reports how far the notification service's event
+// consumer groups are behind their topics, for Prometheus and, through
+// prometheus-adapter, for the HorizontalPodAutoscaler.
+//
+// The service's own event_consumer_lag_messages comes from the consumers, so
+// it stops moving when they are stuck or scaled away; this reads committed
+// offsets from the brokers instead, and keeps reporting the backlog.
+//
+//	lagexporter -brokers kafka:9092 -groups notification-service-orders=order-events
+//
+// -brokers and -groups default to $KAFKA_BROKERS and $LAG_EXPORTER_GROUPS,
+// both comma-separated.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/segmentio/kafka-go"
+)
+
+// The groups the service's event pipelines consume with, see runEventConsumer
+const defaultGroups = "notification-service-orders=order-events," +
+	"notification-service-payments=payment-events," +
+	"notification-service-security=security-events"
+
+var (
+	consumerGroupLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "event_consumer_group_lag_messages",
+			Help: "Messages on the topic past the consumer group's committed offsets, as read from the brokers",
+		},
+		[]string{"group", "topic"},
+	)
+
+	lagReadFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "event_consumer_group_lag_read_failures_total",
+			Help: "Times the lag of a consumer group could not be read from the brokers",
+		},
+		[]string{"group", "topic"},
+	)
+)
+
+// consumerGroup is a group and the topic it consumes
+type consumerGroup struct {
+	group string
+	topic string
+}
+
+func main() {
+	listen := flag.String("listen", ":9308", "address to serve /metrics and /health on")
+	brokers := flag.String("brokers", os.Getenv("KAFKA_BROKERS"), "comma-separated Kafka brokers")
+	groupList := flag.String("groups", envOr("LAG_EXPORTER_GROUPS", defaultGroups), "comma-separated group=topic pairs")
+	interval := flag.Duration("interval", 15*time.Second, "how often lag is read")
+	timeout := flag.Duration("timeout", 10*time.Second, "time limit for each read from the brokers")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	groups, err := parseGroups(*groupList)
+	if err == nil && *brokers == "" {
+		err = errors.New("no brokers: set -brokers or KAFKA_BROKERS")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "lagexporter:", err)
+		os.Exit(2)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(consumerGroupLag, lagReadFailuresTotal)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("serving metrics failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	client := &kafka.Client{Addr: kafka.TCP(strings.Split(*brokers, ",")...), Timeout: *timeout}
+	logger.Info("lag exporter running", "listen", *listen, "brokers", *brokers, "groups", len(groups))
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		for _, g := range groups {
+			lag, err := readLag(ctx, client, g)
+			if err != nil {
+				lagReadFailuresTotal.WithLabelValues(g.group, g.topic).Inc()
+				logger.Warn("reading consumer group lag failed", "group", g.group, "topic", g.topic, "error", err)
+				continue
+			}
+			consumerGroupLag.WithLabelValues(g.group, g.topic).Set(float64(lag))
+		}
+		select {
+		case <-ctx.Done():
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdown)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseGroups parses comma-separated group=topic pairs
+func parseGroups(list string) ([]consumerGroup, error) {
+	var groups []consumerGroup
+	for _, pair := range strings.Split(list, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		group, topic, ok := strings.Cut(pair, "=")
+		if !ok || group == "" || topic == "" {
+			return nil, fmt.Errorf("group %q: want group=topic", pair)
+		}
+		groups = append(groups, consumerGroup{group: group, topic: topic})
+	}
+	if len(groups) == 0 {
+		return nil, errors.New("no consumer groups to report on")
+	}
+	return groups, nil
+}
+
+// readLag returns how many messages on g's topic are past g's committed offsets
+//
+// A partition the group never committed on counts from its first offset.
+func readLag(ctx context.Context, client *kafka.Client, g consumerGroup) (int64, error) {
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{g.topic}})
+	if err != nil {
+		return 0, err
+	}
+	if len(metadata.Topics) != 1 {
+		return 0, fmt.Errorf("topic %s not found", g.topic)
+	}
+	if err := metadata.Topics[0].Error; err != nil {
+		return 0, err
+	}
+	var partitions []int
+	var requests []kafka.OffsetRequest
+	for _, p := range metadata.Topics[0].Partitions {
+		partitions = append(partitions, p.ID)
+		requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{g.topic: requests}})
+	if err != nil {
+		return 0, err
+	}
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: g.group, Topics: map[string][]int{g.topic: partitions}})
+	if err != nil {
+		return 0, err
+	}
+	if committed.Error != nil {
+		return 0, committed.Error
+	}
+	positions := make(map[int]int64, len(partitions))
+	for _, p := range committed.Topics[g.topic] {
+		if p.Error != nil {
+			return 0, fmt.Errorf("partition %d: %w", p.Partition, p.Error)
+		}
+		positions[p.Partition] = p.CommittedOffset
+	}
+
+	var lag int64
+	for _, p := range offsets.Topics[g.topic] {
+		if p.Error != nil {
+			return 0, fmt.Errorf("partition %d: %w", p.Partition, p.Error)
+		}
+		position, ok := positions[p.Partition]
+		if !ok || position < 0 {
+			position = p.FirstOffset
+		}
+		lag += max(p.LastOffset-position, 0)
+	}
+	return lag, nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
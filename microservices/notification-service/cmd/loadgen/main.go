@@ -0,0 +1,276 @@
+// Command loadgen drives a notification service at a fixed request rate and
+// reports throughput and latency per operation.
+//
+// Requests are issued open-loop: a slow service does not slow the generator
+// down, so latency includes queueing. When every worker is busy the request
+// is counted as dropped, which means the client, not the service, is the
+// bottleneck and -workers should be raised.
+//
+//	go run ./cmd/loadgen -url http://localhost:3003 -rate 10000 -duration 1m
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"platform/pkg/notificationclient"
+)
+
+// Operations in the mix
+const (
+	opCreate = "create"
+	opList   = "list"
+	opRead   = "read"
+)
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:3003", "notification service base URL")
+	rate := flag.Int("rate", 1000, "requests per second across all operations")
+	duration := flag.Duration("duration", 30*time.Second, "how long to generate load")
+	workers := flag.Int("workers", 256, "maximum concurrent requests")
+	users := flag.Int("users", 1000, "distinct user IDs to spread notifications over")
+	mix := flag.String("mix", "create=50,list=40,read=10", "relative weight of each operation")
+	timeout := flag.Duration("timeout", 5*time.Second, "per-request timeout")
+	flag.Parse()
+
+	weights, err := parseMix(*mix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "loadgen:", err)
+		os.Exit(2)
+	}
+
+	// Retries would hide errors and distort latency, so every attempt counts once
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = *workers
+	transport.MaxIdleConnsPerHost = *workers
+	client := notificationclient.New(*baseURL, notificationclient.Options{
+		HTTPClient:  &http.Client{Transport: transport, Timeout: *timeout},
+		MaxAttempts: 1,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	gen := &generator{
+		client:  client,
+		users:   *users,
+		weights: weights,
+		stats:   map[string]*opStats{opCreate: {}, opList: {}, opRead: {}},
+	}
+	fmt.Printf("loadgen: %d req/s for %s against %s (mix %s)\n", *rate, *duration, *baseURL, *mix)
+	elapsed := gen.run(ctx, *rate, *duration, *workers)
+	gen.report(os.Stdout, elapsed)
+}
+
+// parseMix parses "create=50,list=40,read=10" into cumulative weights
+func parseMix(mix string) ([]weightedOp, error) {
+	var ops []weightedOp
+	total := 0
+	for _, entry := range strings.Split(mix, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid mix entry %q", entry)
+		}
+		switch name {
+		case opCreate, opList, opRead:
+		default:
+			return nil, fmt.Errorf("unknown operation %q", name)
+		}
+		total += weight
+		ops = append(ops, weightedOp{name: name, upTo: total})
+	}
+	if total == 0 {
+		return nil, errors.New("mix has no weight")
+	}
+	return ops, nil
+}
+
+type weightedOp struct {
+	name string
+	upTo int
+}
+
+// opStats collects the outcome of every request of one operation
+type opStats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+}
+
+func (s *opStats) record(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+type generator struct {
+	client  *notificationclient.Client
+	users   int
+	weights []weightedOp
+	stats   map[string]*opStats
+	dropped atomic.Int64
+
+	// created holds recent notification IDs for mark-read requests
+	mu      sync.Mutex
+	created []string
+}
+
+// maxCreatedIDs bounds the IDs kept for mark-read requests
+const maxCreatedIDs = 100000
+
+// run issues requests at rate until duration passes, returning the time taken
+func (g *generator) run(ctx context.Context, rate int, duration time.Duration, workers int) time.Duration {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	// Tick at most every millisecond and issue the requests due since the last tick
+	interval := max(time.Second/time.Duration(rate), time.Millisecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	issued := 0
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case now := <-ticker.C:
+			due := int(now.Sub(start).Seconds()*float64(rate)) - issued
+			for ; due > 0; due-- {
+				issued++
+				select {
+				case slots <- struct{}{}:
+				default:
+					g.dropped.Add(1)
+					continue
+				}
+				wg.Add(1)
+				go func() {
+					defer func() { <-slots; wg.Done() }()
+					g.issue()
+				}()
+			}
+		}
+	}
+
+	wg.Wait()
+	return time.Since(start)
+}
+
+// issue sends one request picked from the mix
+func (g *generator) issue() {
+	pick := rand.Intn(g.weights[len(g.weights)-1].upTo)
+	op := g.weights[0].name
+	for _, w := range g.weights {
+		if pick < w.upTo {
+			op = w.name
+			break
+		}
+	}
+
+	// Requests started before the deadline are allowed to finish
+	ctx := context.Background()
+	userID := "load-" + strconv.Itoa(rand.Intn(g.users))
+	start := time.Now()
+	var err error
+	switch op {
+	case opCreate:
+		var n *notificationclient.Notification
+		n, err = g.client.Create(ctx, notificationclient.CreateRequest{
+			UserID:  userID,
+			Type:    "load_test",
+			Title:   "Load test",
+			Message: "Generated by loadgen",
+		})
+		if err == nil {
+			g.remember(n.ID)
+		}
+	case opList:
+		_, err = g.client.ListByUser(ctx, userID)
+	case opRead:
+		id, ok := g.randomCreated()
+		if !ok {
+			// Nothing to mark yet; count it as a create instead of skewing read latency
+			_, err = g.client.Create(ctx, notificationclient.CreateRequest{UserID: userID, Type: "load_test", Title: "Load test", Message: "Generated by loadgen"})
+			op = opCreate
+			break
+		}
+		_, err = g.client.MarkRead(ctx, id)
+	}
+	g.stats[op].record(time.Since(start), err)
+}
+
+func (g *generator) remember(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.created) >= maxCreatedIDs {
+		g.created[rand.Intn(len(g.created))] = id
+		return
+	}
+	g.created = append(g.created, id)
+}
+
+func (g *generator) randomCreated() (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.created) == 0 {
+		return "", false
+	}
+	return g.created[rand.Intn(len(g.created))], true
+}
+
+// report prints throughput and latency percentiles per operation
+func (g *generator) report(out *os.File, elapsed time.Duration) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "op\tok\terrors\treq/s\tp50\tp90\tp99\tmax\t")
+
+	totalOK, totalErrors := 0, 0
+	for _, op := range []string{opCreate, opList, opRead} {
+		s := g.stats[op]
+		sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+		totalOK += len(s.latencies)
+		totalErrors += s.errors
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.0f\t%s\t%s\t%s\t%s\t\n",
+			op, len(s.latencies), s.errors,
+			float64(len(s.latencies)+s.errors)/elapsed.Seconds(),
+			percentile(s.latencies, 0.50), percentile(s.latencies, 0.90),
+			percentile(s.latencies, 0.99), percentile(s.latencies, 1),
+		)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\n%d ok, %d errors, %d dropped in %s: %.0f req/s achieved\n",
+		totalOK, totalErrors, g.dropped.Load(), elapsed.Round(time.Millisecond),
+		float64(totalOK+totalErrors)/elapsed.Seconds())
+}
+
+// percentile returns the q-th quantile of sorted latencies
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))) - 1
+	i = min(max(i, 0), len(sorted)-1)
+	return sorted[i].Round(time.Microsecond)
+}
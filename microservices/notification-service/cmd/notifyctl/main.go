@@ -0,0 +1,464 @@
+// Command notifyctl runs operator tasks against a notification service
+// through its admin API.
+//
+//	notifyctl [-url URL] [-api-key KEY] <command> [flags]
+//
+// Commands:
+//
+//	send                send a test notification to a user
+//	dead-letters        list dead-lettered deliveries
+//	redrive             queue dead-lettered deliveries again
+//	inbox               show a user's inbox
+//	purge               remove old notifications and expired broadcasts
+//	validate-templates  check NotificationTemplate manifests without applying them
+//	log-level           show the log level, or change it with -set
+//	flags               show the feature flag decisions for a tenant
+//
+// -url and -api-key default to $NOTIFYCTL_URL and $NOTIFYCTL_API_KEY; the
+// key must match the service's ADMIN_API_KEY.
+//
+//	go run ./cmd/notifyctl -url http://localhost:3003 purge -older-than 720h
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// errInvalid makes notifyctl exit 1 without printing anything more
+var errInvalid = errors.New("invalid")
+
+// command is a notifyctl subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, c *client, args []string) error
+}
+
+var commands = []command{
+	{"send", "send a test notification to a user", runSend},
+	{"dead-letters", "list dead-lettered deliveries", runDeadLetters},
+	{"redrive", "queue dead-lettered deliveries again", runRedrive},
+	{"inbox", "show a user's inbox", runInbox},
+	{"purge", "remove old notifications and expired broadcasts", runPurge},
+	{"validate-templates", "check NotificationTemplate manifests without applying them", runValidateTemplates},
+	{"log-level", "show the log level, or change it with -set", runLogLevel},
+	{"flags", "show the feature flag decisions for a tenant", runFlags},
+}
+
+func main() {
+	baseURL := flag.String("url", envOr("NOTIFYCTL_URL", "http://localhost:3003"), "notification service base URL")
+	apiKey := flag.String("api-key", os.Getenv("NOTIFYCTL_API_KEY"), "admin API key")
+	timeout := flag.Duration("timeout", 10*time.Second, "per-request timeout")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		c := &client{
+			baseURL: strings.TrimRight(*baseURL, "/"),
+			apiKey:  *apiKey,
+			http:    &http.Client{Timeout: *timeout},
+		}
+		if err := cmd.run(ctx, c, args); err != nil {
+			if !errors.Is(err, errInvalid) {
+				fmt.Fprintln(os.Stderr, "notifyctl:", err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintln(os.Stderr, "notifyctl: unknown command", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: notifyctl [-url URL] [-api-key KEY] <command> [flags]")
+	fmt.Fprintln(out, "\ncommands:")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// parseFlags parses a subcommand's flags, exiting like the flag package on bad input
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "notifyctl %s: unexpected argument %q\n", fs.Name(), fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func runSend(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	user := fs.String("user", "", "user ID to notify (required)")
+	typ := fs.String("type", "test", "notification type")
+	title := fs.String("title", "Test notification", "notification title")
+	message := fs.String("message", "Sent by notifyctl", "notification message")
+	channels := fs.String("channels", "email", "comma-separated delivery channels")
+	dryRun := fs.Bool("dry-run", false, "show what would be delivered without sending")
+	parseFlags(fs, args)
+	if *user == "" {
+		return errors.New("send: -user is required")
+	}
+
+	path := "/api/send"
+	if *dryRun {
+		path += "?dry_run=true"
+	}
+	body := map[string]any{
+		"user_id":  *user,
+		"type":     *typ,
+		"title":    *title,
+		"message":  *message,
+		"channels": strings.Split(*channels, ","),
+	}
+	var data json.RawMessage
+	if err := c.do(ctx, http.MethodPost, path, body, &data); err != nil {
+		return err
+	}
+	return printJSON(data)
+}
+
+// deadLetter is the part of a dead-lettered delivery notifyctl shows
+type deadLetter struct {
+	Notification struct {
+		ID     string `json:"id"`
+		UserID string `json:"user_id"`
+		Type   string `json:"type"`
+	} `json:"notification"`
+	Channel    string    `json:"channel"`
+	Attempt    int       `json:"attempt"`
+	LastError  string    `json:"last_error"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+func runDeadLetters(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("dead-letters", flag.ExitOnError)
+	notification := fs.String("notification", "", "only list this notification's deliveries")
+	parseFlags(fs, args)
+
+	var jobs []deadLetter
+	if err := c.do(ctx, http.MethodGet, "/api/admin/dead-letters"+query("notification_id", *notification), nil, &jobs); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NOTIFICATION\tUSER\tTYPE\tCHANNEL\tATTEMPTS\tERROR")
+	for _, job := range jobs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", job.Notification.ID, job.Notification.UserID,
+			job.Notification.Type, job.Channel, job.Attempt, job.LastError)
+	}
+	return w.Flush()
+}
+
+func runRedrive(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("redrive", flag.ExitOnError)
+	notification := fs.String("notification", "", "only redrive this notification's deliveries")
+	parseFlags(fs, args)
+
+	var result struct {
+		Redriven  int `json:"redriven"`
+		Remaining int `json:"remaining"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/admin/dead-letters/redrive"+query("notification_id", *notification), nil, &result); err != nil {
+		return err
+	}
+	fmt.Printf("redriven: %d, still dead-lettered: %d\n", result.Redriven, result.Remaining)
+	return nil
+}
+
+func runInbox(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("inbox", flag.ExitOnError)
+	user := fs.String("user", "", "user ID (required)")
+	category := fs.String("category", "", "only show notifications in this category")
+	unread := fs.Bool("unread", false, "only show unread notifications")
+	snoozed := fs.Bool("include-snoozed", true, "include snoozed notifications")
+	parseFlags(fs, args)
+	if *user == "" {
+		return errors.New("inbox: -user is required")
+	}
+
+	params := url.Values{}
+	if *category != "" {
+		params.Set("category", *category)
+	}
+	if *snoozed {
+		params.Set("include_snoozed", "true")
+	}
+	path := "/api/users/" + url.PathEscape(*user) + "/notifications"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	var list []struct {
+		ID           string     `json:"id"`
+		Type         string     `json:"type"`
+		Title        string     `json:"title"`
+		Status       string     `json:"status"`
+		Pinned       bool       `json:"pinned"`
+		SnoozedUntil *time.Time `json:"snoozed_until"`
+		CreatedAt    time.Time  `json:"created_at"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tSTATUS\tCREATED\tTITLE")
+	for _, n := range list {
+		if *unread && n.Status != "unread" {
+			continue
+		}
+		state := n.Status
+		if n.Pinned {
+			state += ",pinned"
+		}
+		if n.SnoozedUntil != nil && n.SnoozedUntil.After(time.Now()) {
+			state += ",snoozed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", n.ID, n.Type, state, n.CreatedAt.Format(time.RFC3339), n.Title)
+	}
+	return w.Flush()
+}
+
+func runPurge(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	olderThan := fs.Duration("older-than", 0, "remove notifications created longer ago than this, e.g. 720h (required)")
+	parseFlags(fs, args)
+	if *olderThan <= 0 {
+		return errors.New("purge: -older-than must be a positive duration")
+	}
+
+	var result struct {
+		Cutoff        time.Time `json:"cutoff"`
+		Notifications int       `json:"notifications"`
+		Broadcasts    int       `json:"broadcasts"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/admin/purge"+query("older_than", olderThan.String()), nil, &result); err != nil {
+		return err
+	}
+	fmt.Printf("purged %d notifications created before %s and %d expired broadcasts\n",
+		result.Notifications, result.Cutoff.Format(time.RFC3339), result.Broadcasts)
+	return nil
+}
+
+func runValidateTemplates(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("validate-templates", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: notifyctl validate-templates <manifest.yaml>...")
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var resources []map[string]any
+	for _, path := range fs.Args() {
+		found, err := readTemplates(path)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, found...)
+	}
+	if len(resources) == 0 {
+		return errors.New("validate-templates: no NotificationTemplate resources found")
+	}
+
+	var checks []struct {
+		Name  string `json:"name"`
+		Valid bool   `json:"valid"`
+		Error string `json:"error"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/admin/templates/validate", map[string]any{"templates": resources}, &checks); err != nil {
+		return err
+	}
+	invalid := 0
+	for _, check := range checks {
+		if check.Valid {
+			fmt.Printf("ok       %s\n", check.Name)
+			continue
+		}
+		invalid++
+		fmt.Printf("invalid  %s: %s\n", check.Name, check.Error)
+	}
+	if invalid > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d templates are invalid\n", invalid, len(checks))
+		return errInvalid
+	}
+	return nil
+}
+
+func runLogLevel(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("log-level", flag.ExitOnError)
+	set := fs.String("set", "", "change the level to debug, info, warn or error")
+	parseFlags(fs, args)
+
+	var result struct {
+		Level string `json:"level"`
+	}
+	if *set == "" {
+		if err := c.do(ctx, http.MethodGet, "/api/admin/log-level", nil, &result); err != nil {
+			return err
+		}
+	} else if err := c.do(ctx, http.MethodPut, "/api/admin/log-level", map[string]string{"level": *set}, &result); err != nil {
+		return err
+	}
+	fmt.Println(result.Level)
+	return nil
+}
+
+func runFlags(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("flags", flag.ExitOnError)
+	tenant := fs.String("tenant", "", "tenant to evaluate the flags for (default: no tenant)")
+	parseFlags(fs, args)
+
+	var result struct {
+		Tenant string          `json:"tenant"`
+		Flags  map[string]bool `json:"flags"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/admin/feature-flags"+query("tenant", *tenant), nil, &result); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(result.Flags))
+	for name := range result.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FLAG\tENABLED")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%v\n", name, result.Flags[name])
+	}
+	return w.Flush()
+}
+
+// readTemplates returns the NotificationTemplate resources in a multi-document YAML file
+func readTemplates(path string) ([]map[string]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var resources []map[string]any
+	decoder := yaml.NewDecoder(f)
+	for {
+		var doc map[string]any
+		if err := decoder.Decode(&doc); errors.Is(err, io.EOF) {
+			return resources, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if doc["kind"] == "NotificationTemplate" {
+			resources = append(resources, doc)
+		}
+	}
+}
+
+func query(key, value string) string {
+	if value == "" {
+		return ""
+	}
+	return "?" + url.Values{key: {value}}.Encode()
+}
+
+func printJSON(data json.RawMessage) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+// client calls the service, sending the admin API key with every request
+type client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// do sends body as JSON and decodes the data of the service's response envelope into out
+//
+// Responses without data, like the log level, are decoded into out whole.
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	var envelope struct {
+		Success bool            `json:"success"`
+		Error   string          `json:"error"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil || json.Unmarshal(raw, &envelope) != nil {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if !envelope.Success {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, envelope.Error)
+	}
+	if envelope.Data == nil {
+		return json.Unmarshal(raw, out)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// encoder compresses a response body; encoders are pooled and Reset per response
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	encodingGzip: {New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}},
+	encodingZstd: {New: func() any {
+		// One goroutine per encoder; concurrency comes from concurrent requests
+		w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return w
+	}},
+}
+
+// Compression middleware
+//
+// Compresses responses with the encoding the client prefers among those
+// configured, ties going to the configured order. Responses are buffered
+// until they reach MinSize, so small bodies go out uncompressed, and
+// excluded paths, server-sent events, WebSocket handshakes and responses
+// already carrying a Content-Encoding are left alone. /metrics is excluded by default because
+// promhttp negotiates its own compression.
+func compressionMiddleware(cfg CompressionConfig) gin.HandlerFunc {
+	excluded := make(map[string]bool, len(cfg.ExcludePaths))
+	for _, path := range cfg.ExcludePaths {
+		excluded[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if len(cfg.Encodings) == 0 || c.Request.Method == http.MethodHead || excluded[c.Request.URL.Path] || isWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+		c.Header("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), cfg.Encodings)
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: cfg.MinSize}
+		c.Writer = w
+		defer w.close()
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks the supported encoding with the highest q-value in header
+func negotiateEncoding(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		quality[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := quality[encoding]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of a response to decide whether to compress it
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+
+	buf     []byte
+	decided bool
+	encoder encoder
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		if len(w.buf)+len(data) < w.minSize {
+			w.buf = append(w.buf, data...)
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what is buffered; a response flushed before reaching minSize is streaming, so is sent as is
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide chooses between compressing and passing through, then writes the buffered start
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	header := w.Header()
+	status := w.Status()
+	compress := large &&
+		header.Get("Content-Encoding") == "" &&
+		!strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") &&
+		status != http.StatusNoContent && status != http.StatusNotModified
+
+	buffered := w.buf
+	w.buf = nil
+	if !compress {
+		if len(buffered) == 0 {
+			return nil
+		}
+		_, err := w.ResponseWriter.Write(buffered)
+		return err
+	}
+
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	w.encoder = encoderPools[w.encoding].Get().(encoder)
+	w.encoder.Reset(w.ResponseWriter)
+	_, err := w.encoder.Write(buffered)
+	return err
+}
+
+// close writes out a response that stayed below minSize and finishes the compressed stream
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.encoder == nil {
+		return
+	}
+	w.encoder.Close()
+	w.encoder.Reset(io.Discard)
+	encoderPools[w.encoding].Put(w.encoder)
+	w.encoder = nil
+}
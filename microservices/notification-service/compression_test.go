@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{encodingZstd, encodingGzip}
+	for header, want := range map[string]string{
+		"":                          "",
+		"identity":                  "",
+		"gzip":                      encodingGzip,
+		"gzip, deflate, br, zstd":   encodingZstd,
+		"gzip;q=1.0, zstd;q=0.5":    encodingGzip,
+		"zstd;q=0, gzip":            encodingGzip,
+		"*":                         encodingZstd,
+		"*;q=0.1, GZIP":             encodingGzip,
+		"gzip;q=0, zstd;q=0, br":    "",
+		"gzip;q=oops, zstd;q=0.001": encodingZstd,
+	} {
+		if got := negotiateEncoding(header, supported); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func compressionRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := defaultConfig().Responses.Compression
+	r := gin.New()
+	r.Use(compressionMiddleware(cfg))
+
+	large := strings.Repeat(`{"title":"Order shipped","message":"Your order is on its way"}`, 100)
+	r.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	r.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/metrics", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	r.GET("/events", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.String(http.StatusOK, large)
+	})
+	r.GET("/chunked", func(c *gin.Context) {
+		for i := 0; i < 100; i++ {
+			c.Writer.WriteString(`{"title":"Order shipped"}` + "\n")
+		}
+	})
+	return r
+}
+
+func getEncoded(r *gin.Engine, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var reader io.Reader
+	switch rec.Header().Get("Content-Encoding") {
+	case encodingGzip:
+		gz, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = gz
+	case encodingZstd:
+		zr, err := zstd.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		reader = rec.Body
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestCompressesLargeResponses(t *testing.T) {
+	r := compressionRouter()
+	plain := getEncoded(r, "/large", "").Body.String()
+
+	for _, encoding := range []string{encodingGzip, encodingZstd} {
+		// Run twice so the second response reuses a pooled encoder
+		for i := 0; i < 2; i++ {
+			rec := getEncoded(r, "/large", encoding)
+			if got := rec.Header().Get("Content-Encoding"); got != encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, encoding)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Error("Vary: Accept-Encoding missing")
+			}
+			if rec.Body.Len() >= len(plain) {
+				t.Errorf("%s body is %d bytes, not smaller than %d", encoding, rec.Body.Len(), len(plain))
+			}
+			if decode(t, rec) != plain {
+				t.Errorf("%s body does not decode to the original", encoding)
+			}
+		}
+	}
+}
+
+func TestCompressesResponsesWrittenInPieces(t *testing.T) {
+	rec := getEncoded(compressionRouter(), "/chunked", encodingGzip)
+	if rec.Header().Get("Content-Encoding") != encodingGzip {
+		t.Fatal("response crossing the size threshold was not compressed")
+	}
+	if got := decode(t, rec); got != strings.Repeat(`{"title":"Order shipped"}`+"\n", 100) {
+		t.Errorf("decoded body = %q", got)
+	}
+}
+
+func TestLeavesResponsesUncompressed(t *testing.T) {
+	r := compressionRouter()
+	for _, tc := range []struct{ path, acceptEncoding string }{
+		{"/small", "gzip"},
+		{"/metrics", "gzip"},
+		{"/events", "gzip"},
+		{"/large", "br"},
+	} {
+		rec := getEncoded(r, tc.path, tc.acceptEncoding)
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("GET %s with Accept-Encoding %q was encoded as %q", tc.path, tc.acceptEncoding, got)
+		}
+	}
+	if got := getEncoded(r, "/small", "gzip").Body.String(); got != "ok" {
+		t.Errorf("small body = %q", got)
+	}
+}
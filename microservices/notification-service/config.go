@@ -0,0 +1,1696 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"notification-service/internal/featureflags"
+	"platform/pkg/middleware"
+	"platform/pkg/server"
+)
+
+// Config is the complete service configuration
+//
+// Values are resolved as defaults, then the optional YAML file named by
+// CONFIG_FILE (usually a mounted ConfigMap), then environment variables.
+// Settings tagged reload:"true" are applied when the file changes; the rest
+// are only read at startup.
+type Config struct {
+	Port            string               `yaml:"port"`
+	LogLevel        string               `yaml:"log_level" reload:"true"`
+	ShutdownTimeout time.Duration        `yaml:"shutdown_timeout"`
+	Server          ServerConfig         `yaml:"server"`
+	Delivery        DeliveryConfig       `yaml:"delivery"`
+	Health          HealthConfig         `yaml:"health"`
+	AccessLog       AccessLogConfig      `yaml:"access_log" reload:"true"`
+	Metrics         MetricsConfig        `yaml:"metrics"`
+	SLO             SLOConfig            `yaml:"slo" reload:"true"`
+	Diagnostics     DiagnosticsConfig    `yaml:"diagnostics"`
+	ErrorReporting  ErrorReportConfig    `yaml:"error_reporting"`
+	LeaderElection  LeaderElectionConfig `yaml:"leader_election"`
+	FeatureFlags    FeatureFlagConfig    `yaml:"feature_flags"`
+	Discovery       DiscoveryConfig      `yaml:"discovery"`
+	CircuitBreakers CircuitBreakerConfig `yaml:"circuit_breakers"`
+	Templates       TemplateConfig       `yaml:"templates"`
+	Types           TypesConfig          `yaml:"types"`
+	Users           UserLookupConfig     `yaml:"users"`
+	Events          EventsConfig         `yaml:"events"`
+	WriteBehind     WriteBehindConfig    `yaml:"write_behind"`
+	Responses       ResponseConfig       `yaml:"responses"`
+	Storage         StorageConfig        `yaml:"storage"`
+	Content         ContentConfig        `yaml:"content"`
+	// Segments are named audiences for targeted sends
+	Segments    map[string]SegmentConfig `yaml:"segments"`
+	Unsubscribe UnsubscribeConfig        `yaml:"unsubscribe"`
+	Webhooks    WebhookConfig            `yaml:"webhooks"`
+	Sandbox     SandboxConfig            `yaml:"sandbox"`
+	Admin       AdminConfig              `yaml:"admin"`
+	Chaos       ChaosConfig              `yaml:"chaos"`
+	Providers   ProviderConfig           `yaml:"providers"`
+	// LoadShedding can be changed without a restart
+	LoadShedding LoadSheddingConfig `yaml:"load_shedding" reload:"true"`
+	// Quotas can be changed without a restart
+	Quotas QuotasConfig `yaml:"quotas" reload:"true"`
+	// Anomalies can be changed without a restart, apart from Enabled and Interval
+	Anomalies AnomalyConfig  `yaml:"anomalies"`
+	Archive   ArchiveConfig  `yaml:"archive"`
+	Realtime  RealtimeConfig `yaml:"realtime"`
+	// Replication mirrors writes to and from peer regions in an active-active deployment
+	Replication ReplicationConfig `yaml:"replication"`
+	// SeedData loads fixture notifications, templates and preferences at startup, for development
+	SeedData bool `yaml:"seed_data"`
+}
+
+// ServerConfig configures the HTTP listener
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	// ReadTimeout and WriteTimeout also end notification streams once they
+	// pass, so they stay 0 (none) unless streaming is not used
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// HTTP2 is negotiated with clients when serving TLS
+	HTTP2 bool      `yaml:"http2"`
+	TLS   TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig terminates TLS at the pod, from certificate files or with ACME
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// AutocertHosts obtains certificates for these hosts from Let's Encrypt instead
+	AutocertHosts    []string `yaml:"autocert_hosts"`
+	AutocertCacheDir string   `yaml:"autocert_cache_dir"`
+	AutocertEmail    string   `yaml:"autocert_email"`
+}
+
+// Options returns the listener options for the configuration
+func (c ServerConfig) Options() server.TLSOptions {
+	return server.TLSOptions{
+		CertFile:         c.TLS.CertFile,
+		KeyFile:          c.TLS.KeyFile,
+		AutocertHosts:    c.TLS.AutocertHosts,
+		AutocertCacheDir: c.TLS.AutocertCacheDir,
+		AutocertEmail:    c.TLS.AutocertEmail,
+		DisableHTTP2:     !c.HTTP2,
+	}
+}
+
+// DeliveryConfig configures the send queue and its workers
+//
+// Workers and QueueSize size the standard lane. Critical and bulk
+// deliveries have lanes of their own, each with its own queue and workers,
+// so a flood of bulk sends cannot hold up critical ones.
+type DeliveryConfig struct {
+	Workers     int                `yaml:"workers"`
+	QueueSize   int                `yaml:"queue_size"`
+	MaxAttempts int                `yaml:"max_attempts"`
+	RetryDelay  time.Duration      `yaml:"retry_delay"`
+	Critical    DeliveryLaneConfig `yaml:"critical"`
+	Bulk        DeliveryLaneConfig `yaml:"bulk"`
+	// Watchdog takes back deliveries stuck with a provider past a deadline
+	Watchdog DeliveryWatchdogConfig `yaml:"watchdog"`
+}
+
+// Watchdog policies for a stuck delivery
+const (
+	// watchdogRetry counts it as a failed attempt, retrying it until attempts run out
+	watchdogRetry = "retry"
+	// watchdogDeadLetter gives up on it straight away
+	watchdogDeadLetter = "dead_letter"
+)
+
+// DeliveryWatchdogConfig decides when an in-flight delivery is stuck and what happens to it
+type DeliveryWatchdogConfig struct {
+	// Deadline is how long a delivery may stay with a provider; 0 turns the watchdog off
+	Deadline time.Duration `yaml:"deadline"`
+	// Interval is how often in-flight deliveries are checked
+	Interval time.Duration `yaml:"interval"`
+	// Policy is retry or dead_letter
+	Policy string `yaml:"policy"`
+}
+
+// DeliveryLaneConfig sizes a priority lane and picks the notifications it carries
+type DeliveryLaneConfig struct {
+	// A lane without workers is off, and its notifications use the standard lane
+	Workers   int `yaml:"workers"`
+	QueueSize int `yaml:"queue_size"`
+	// Priorities and Categories pick notifications by their type's priority and their category
+	Priorities []string `yaml:"priorities"`
+	Categories []string `yaml:"categories"`
+	// Campaigns picks notifications sent by campaigns
+	Campaigns bool `yaml:"campaigns"`
+}
+
+// HealthConfig lists the dependencies probed by the readiness check
+type HealthConfig struct {
+	CheckTimeout time.Duration `yaml:"check_timeout"`
+	DatabaseAddr string        `yaml:"database_addr"`
+	CacheAddr    string        `yaml:"cache_addr"`
+	BrokerAddr   string        `yaml:"broker_addr"`
+	// The pod reports not ready past these; 0 turns a check off
+	MaxQueueBacklog  int           `yaml:"max_queue_backlog"`
+	MaxConsumerLag   int           `yaml:"max_consumer_lag"`
+	MaxConsumerDelay time.Duration `yaml:"max_consumer_delay"`
+}
+
+// AccessLogConfig configures request logging
+type AccessLogConfig struct {
+	BodySampleRate float64 `yaml:"body_sample_rate"`
+	// Routes maps "METHOD /route" to a body sample rate or "off"
+	Routes       map[string]string `yaml:"routes"`
+	RedactFields []string          `yaml:"redact_fields"`
+	MaxBodyBytes int               `yaml:"max_body_bytes"`
+}
+
+// MetricsConfig bounds the labels of the HTTP request metrics
+type MetricsConfig struct {
+	// StatusClasses records status as 2xx..5xx instead of the exact code
+	StatusClasses bool `yaml:"status_classes"`
+	// MaxSeries caps the method, endpoint and status combinations; 0 means no cap
+	MaxSeries int `yaml:"max_series"`
+	// DisabledLabels are dropped from the series: method, endpoint or status
+	DisabledLabels []string `yaml:"disabled_labels"`
+}
+
+// Options returns the middleware options for the configuration
+func (c MetricsConfig) Options() middleware.MetricsOptions {
+	return middleware.MetricsOptions{StatusClasses: c.StatusClasses, MaxSeries: c.MaxSeries, DisabledLabels: c.DisabledLabels}
+}
+
+// SLOConfig holds the per-channel delivery latency objectives
+type SLOConfig struct {
+	Objectives       map[string]time.Duration `yaml:"objectives"`
+	DefaultObjective time.Duration            `yaml:"default_objective"`
+	Target           float64                  `yaml:"target"`
+}
+
+// DiagnosticsConfig controls the internal pprof/expvar listener
+type DiagnosticsConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Addr          string `yaml:"addr"`
+	MutexFraction int    `yaml:"mutex_fraction"`
+	BlockRate     int    `yaml:"block_rate"`
+}
+
+// ErrorReportConfig configures the external error tracker
+type ErrorReportConfig struct {
+	SentryDSN   string `yaml:"sentry_dsn"`
+	Environment string `yaml:"environment"`
+}
+
+// LeaderElectionConfig controls which replica runs singleton background jobs
+type LeaderElectionConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	LeaseName     string        `yaml:"lease_name"`
+	Namespace     string        `yaml:"namespace"`
+	Identity      string        `yaml:"identity"`
+	LeaseDuration time.Duration `yaml:"lease_duration"`
+	RenewDeadline time.Duration `yaml:"renew_deadline"`
+	RetryPeriod   time.Duration `yaml:"retry_period"`
+}
+
+// FeatureFlagConfig holds the static flags and the optional Unleash server
+type FeatureFlagConfig struct {
+	Flags   featureflags.Static        `yaml:"flags" reload:"true"`
+	Unleash featureflags.UnleashConfig `yaml:"unleash"`
+}
+
+// DiscoveryConfig controls how sibling services are located
+type DiscoveryConfig struct {
+	// Provider is "kubernetes" (cluster DNS) or "consul"
+	Provider  string `yaml:"provider"`
+	Namespace string `yaml:"namespace"`
+	// Services maps service names to their port for DNS discovery
+	Services       map[string]int `yaml:"services"`
+	ConsulAddr     string         `yaml:"consul_addr"`
+	ConsulToken    string         `yaml:"consul_token"`
+	CacheTTL       time.Duration  `yaml:"cache_ttl"`
+	EjectionPeriod time.Duration  `yaml:"ejection_period"`
+}
+
+// TemplateConfig controls syncing NotificationTemplate resources
+type TemplateConfig struct {
+	ControllerEnabled bool `yaml:"controller_enabled"`
+	// Namespace to watch; empty means the pod's own namespace
+	Namespace string `yaml:"namespace"`
+}
+
+// TypesConfig controls the registry of notification types synced from NotificationType resources
+type TypesConfig struct {
+	ControllerEnabled bool `yaml:"controller_enabled"`
+	// Namespace to watch; empty means the pod's own namespace
+	Namespace string `yaml:"namespace"`
+	// Unknown is what happens to notifications of unregistered types: allow,
+	// reject or quarantine; it changes without a restart. It defaults to
+	// reject, so every type in use must be declared
+	Unknown string `yaml:"unknown" reload:"true"`
+	// QuarantineSize bounds the quarantined notifications kept for review
+	QuarantineSize int `yaml:"quarantine_size"`
+}
+
+// UserLookupConfig controls resolving delivery targets through the user service
+type UserLookupConfig struct {
+	// When disabled, senders receive only the user ID
+	Enabled  bool          `yaml:"enabled"`
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// CacheSize bounds the number of cached contacts
+	CacheSize int `yaml:"cache_size"`
+}
+
+// WriteBehindConfig controls batching of notification writes and delivery log appends under burst load
+type WriteBehindConfig struct {
+	// When disabled, notifications and sends are written one by one as they happen
+	Enabled bool `yaml:"enabled"`
+	// BatchSize is the most notifications written in one batch
+	BatchSize int `yaml:"batch_size"`
+	// FlushInterval bounds how long a notification waits to be written
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// BufferSize bounds notifications accepted but not yet written
+	BufferSize int `yaml:"buffer_size"`
+	// MaxWait is how long a create waits for room in a full buffer before failing
+	MaxWait time.Duration `yaml:"max_wait"`
+	// SpoolDir is where batches the store fails to write are queued until it
+	// recovers; without it they are retried in memory
+	SpoolDir string `yaml:"spool_dir"`
+}
+
+// ContentConfig bounds the rich content of notifications created through the API
+type ContentConfig struct {
+	MaxActions   int `yaml:"max_actions"`
+	MaxDataBytes int `yaml:"max_data_bytes"`
+	// Schemas maps a notification type to the fields its data must carry
+	Schemas map[string]ContentSchema `yaml:"schemas"`
+	// JSONSchemas maps a notification type to a JSON Schema (draft 2020-12)
+	// its data must match, on creates and on events; they reload without a restart
+	JSONSchemas map[string]map[string]any `yaml:"json_schemas" reload:"true"`
+}
+
+// ContentSchema lists the data fields of one notification type
+type ContentSchema struct {
+	Fields map[string]ContentField `yaml:"fields"`
+}
+
+// ContentField is a data field of type string, number, boolean or url
+type ContentField struct {
+	Type     string `yaml:"type"`
+	Required bool   `yaml:"required"`
+}
+
+// UnsubscribeConfig controls the signed one-click unsubscribe links in emails
+type UnsubscribeConfig struct {
+	// SigningKey signs unsubscribe tokens and is only read from the environment;
+	// without it emails carry no unsubscribe link
+	SigningKey string `yaml:"-"`
+	// URL is where users reach GET /unsubscribe, e.g. https://example.com/unsubscribe
+	URL string `yaml:"url"`
+	// MaxAge is how long a link works after the email was sent; at least 720h
+	MaxAge time.Duration `yaml:"max_age"`
+	// Topic is the compacted Kafka topic, on the events brokers, suppressions
+	// are kept on; without brokers they only last as long as the replica
+	Topic string `yaml:"topic"`
+}
+
+// WebhookConfig holds what verifies the delivery callbacks of each provider
+//
+// Secrets are only read from the environment. A provider's webhook is
+// disabled until its secret is set.
+type WebhookConfig struct {
+	// SendGridPublicKey is the base64 encoded ECDSA key of the SendGrid event webhook
+	SendGridPublicKey string `yaml:"-"`
+	TwilioAuthToken   string `yaml:"-"`
+	// TwilioURL is the public URL Twilio calls back, which its signatures cover
+	TwilioURL string `yaml:"twilio_url"`
+	// FCMSecret is shared with the relay reporting push delivery receipts
+	FCMSecret string `yaml:"-"`
+}
+
+// SandboxConfig captures every delivery instead of handing it to a provider
+//
+// For staging and other non-production environments, so they never reach
+// real customers. Captured messages are kept in memory, newest last.
+type SandboxConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// OutboxSize is how many captured messages are kept; older ones are dropped
+	OutboxSize int `yaml:"outbox_size"`
+}
+
+// AdminConfig protects the /api/admin endpoints used by operators and notifyctl
+type AdminConfig struct {
+	// APIKey is only read from the environment; without it the admin API is open
+	APIKey string `yaml:"-"`
+}
+
+// ChaosConfig allows faults to be injected at runtime through /api/admin/chaos
+//
+// For resilience testing in non-production environments. Faults are only
+// injected once an operator sets them; enabling chaos mode needs an admin
+// API key, so nobody else can.
+type ChaosConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// LoadSheddingConfig rejects non-critical creates and sends while the service is saturated
+//
+// The send queue and, under write-behind, the write buffer are watched.
+// Health, readiness and metrics are never shed.
+type LoadSheddingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// HighWaterMark is the fraction of a queue or buffer's capacity past which load is shed
+	HighWaterMark float64 `yaml:"high_water_mark"`
+	// RetryAfter is what rejected clients are told to wait before retrying
+	RetryAfter time.Duration `yaml:"retry_after"`
+	// CriticalCategories are still accepted while load is shed
+	CriticalCategories []string `yaml:"critical_categories"`
+}
+
+// RealtimeConfig configures notification streams and WebSocket sessions
+type RealtimeConfig struct {
+	// AllowedOrigins are the browser origins, e.g. https://app.example.com, that may
+	// open WebSocket sessions; when empty only the service's own host may
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// SkipPushWhenConnected drops push deliveries to users with a stream or
+	// session open on the delivering replica; can be changed without a restart
+	SkipPushWhenConnected bool `yaml:"skip_push_when_connected" reload:"true"`
+}
+
+// ReplicationConfig publishes this region's notification writes to a Kafka topic
+// and applies the writes peer regions publish to theirs
+type ReplicationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Region names this region, e.g. eu-west-1, and is stamped on the writes it publishes
+	Region string `yaml:"region"`
+	// Brokers are the Kafka cluster the regions' topics are mirrored across
+	Brokers []string `yaml:"brokers"`
+	// Topic is where this region publishes its writes
+	Topic string `yaml:"topic"`
+	// PeerTopics are the topics of the other regions, applied to this region's store
+	PeerTopics []string `yaml:"peer_topics"`
+	// GroupID is suffixed with the region, so each region consumes every peer change
+	GroupID string `yaml:"group_id"`
+}
+
+// ArchiveConfig moves old notifications out of the store into compressed objects on S3 or GCS
+type ArchiveConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// After is how old a notification is when it is archived; pinned ones stay
+	After    time.Duration `yaml:"after"`
+	Interval time.Duration `yaml:"interval"`
+	// Endpoint is the S3 API, e.g. https://s3.eu-central-1.amazonaws.com, or
+	// https://storage.googleapis.com for GCS with HMAC keys
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// Prefix is prepended to every object key
+	Prefix string `yaml:"prefix"`
+	// The credentials are only read from the environment
+	AccessKeyID     string `yaml:"-"`
+	SecretAccessKey string `yaml:"-"`
+}
+
+// QuotasConfig caps what each tenant may create and have delivered per day and per month
+//
+// Days and months are counted in UTC. A zero limit is unlimited. Limits are
+// enforced by each replica on its own count, so with N replicas a tenant can
+// create up to N times a limit; set them for one replica's share of the
+// traffic. Security notices and mandatory event deliveries are never refused.
+type QuotasConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Default applies to tenants without an entry in Tenants
+	Default QuotaConfig            `yaml:"default"`
+	Tenants map[string]QuotaConfig `yaml:"tenants"`
+}
+
+// AnomalyConfig flags notification types and tenants creating far more notifications than usual
+//
+// Each replica counts the creates and sends of every type and tenant over
+// Interval and compares the count with a rolling baseline reaching back
+// about Baseline.
+type AnomalyConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+	Baseline time.Duration `yaml:"baseline" reload:"true"`
+	// Threshold is the multiple of the baseline a count must pass to be a spike
+	Threshold float64 `yaml:"threshold" reload:"true"`
+	// MinCount is the fewest notifications in an interval that can be a spike,
+	// so quiet types and tenants do not alarm on noise
+	MinCount int `yaml:"min_count" reload:"true"`
+	// NotifyUsers, e.g. the on-call operators, get a notification of every spike
+	NotifyUsers []string `yaml:"notify_users" reload:"true"`
+	// AutoThrottle caps a spiking type at Threshold times its baseline per
+	// interval for ThrottleFor, rejecting the rest. The cap applies on each
+	// replica, and security notices and mandatory event deliveries pass it.
+	AutoThrottle bool          `yaml:"auto_throttle" reload:"true"`
+	ThrottleFor  time.Duration `yaml:"throttle_for" reload:"true"`
+}
+
+// QuotaConfig is one tenant's daily and monthly limits
+type QuotaConfig struct {
+	Daily   QuotaLimits `yaml:"daily"`
+	Monthly QuotaLimits `yaml:"monthly"`
+}
+
+// QuotaLimits caps the notifications created, and messages delivered on each channel, in one period
+type QuotaLimits struct {
+	Notifications int            `yaml:"notifications"`
+	Deliveries    map[string]int `yaml:"deliveries"`
+}
+
+// For returns the quota of tenant
+func (c QuotasConfig) For(tenant string) QuotaConfig {
+	if quota, ok := c.Tenants[tenant]; ok {
+		return quota
+	}
+	return c.Default
+}
+
+// ProviderConfig picks what delivers notifications on every channel
+type ProviderConfig struct {
+	// Name is log, which only logs deliveries, or mock, which simulates a
+	// provider for local development
+	Name string             `yaml:"name"`
+	Mock MockProviderConfig `yaml:"mock"`
+	// Shadow copies deliveries to a second provider to compare it with the first
+	Shadow ShadowProviderConfig `yaml:"shadow"`
+}
+
+// ShadowProviderConfig sends a sample of deliveries to a second provider as well
+//
+// Shadow sends are made once, without retries, and their results are only
+// recorded for comparison: they never fail, delay or dead-letter the real
+// delivery. Point a real vendor at its test mode, so users get no copies.
+type ShadowProviderConfig struct {
+	// Name is the shadow provider, log or mock; empty turns shadowing off
+	Name string             `yaml:"name"`
+	Mock MockProviderConfig `yaml:"mock"`
+	// Channels are the channels shadowed, e.g. [email]
+	Channels []string `yaml:"channels"`
+	// SampleRate is the fraction of deliveries copied, from 0 to 1
+	SampleRate float64 `yaml:"sample_rate"`
+	// MaxInFlight bounds concurrent shadow sends; deliveries past it are not copied
+	MaxInFlight int `yaml:"max_in_flight"`
+}
+
+// MockProviderConfig shapes the latency, failures and receipts of the mock provider
+type MockProviderConfig struct {
+	// Latency is how long a send takes, plus up to Jitter more
+	Latency time.Duration `yaml:"latency"`
+	Jitter  time.Duration `yaml:"jitter"`
+	// FailureRate is the fraction of sends that fail and are retried
+	FailureRate float64 `yaml:"failure_rate"`
+	// CallbackDelay is how long after a send its delivery receipt arrives
+	CallbackDelay time.Duration `yaml:"callback_delay"`
+	// BounceRate is the fraction of receipts reporting a bounce instead of a delivery
+	BounceRate float64 `yaml:"bounce_rate"`
+}
+
+// SegmentConfig selects users by the attributes the user service keeps
+//
+// A user is in the segment when every set criterion matches; an empty
+// segment matches every user.
+type SegmentConfig struct {
+	// Locales match exactly or by language, so "en" matches "en-GB"
+	Locales []string `yaml:"locales"`
+	Plans   []string `yaml:"plans"`
+	// MinAccountAge and MaxAccountAge bound how long ago the user signed up
+	MinAccountAge time.Duration `yaml:"min_account_age"`
+	MaxAccountAge time.Duration `yaml:"max_account_age"`
+}
+
+// StorageConfig is the shard map notifications are spread over by user ID
+type StorageConfig struct {
+	// Shards are placed on a consistent-hash ring by name, so adding one
+	// moves only about 1/n of the users
+	Shards []string `yaml:"shards"`
+	// VirtualNodes is how many points each shard has on the ring; more
+	// points spread users more evenly
+	VirtualNodes int `yaml:"virtual_nodes"`
+}
+
+// ResponseConfig controls how list responses are written
+type ResponseConfig struct {
+	// Listings with more than StreamThreshold notifications are streamed as
+	// a chunked JSON array instead of being encoded in memory first
+	StreamThreshold int               `yaml:"stream_threshold"`
+	Compression     CompressionConfig `yaml:"compression"`
+}
+
+// CompressionConfig controls response compression negotiated via Accept-Encoding
+type CompressionConfig struct {
+	// Encodings lists gzip and zstd in order of preference; empty disables compression
+	Encodings []string `yaml:"encodings"`
+	// MinSize is the smallest response body worth compressing, in bytes
+	MinSize      int      `yaml:"min_size"`
+	ExcludePaths []string `yaml:"exclude_paths"`
+}
+
+// EventsConfig configures the Kafka consumers that turn platform events into notifications
+type EventsConfig struct {
+	// The consumers only start when brokers are configured
+	Brokers  []string            `yaml:"brokers"`
+	GroupID  string              `yaml:"group_id"`
+	Orders   EventPipelineConfig `yaml:"orders"`
+	Payments EventPipelineConfig `yaml:"payments"`
+	Security EventPipelineConfig `yaml:"security"`
+	// LifecycleTopic receives a NotificationEvent as each notification is
+	// created, delivered, given up on, read or deleted
+	LifecycleTopic string `yaml:"lifecycle_topic"`
+}
+
+// EventPipelineConfig configures the consumer for one event topic
+type EventPipelineConfig struct {
+	Topic string `yaml:"topic"`
+	// Mappings maps event types such as order.shipped to the notification they produce
+	Mappings map[string]EventMapping `yaml:"mappings"`
+}
+
+// EventMapping describes the notification produced for one event type
+type EventMapping struct {
+	Template string `yaml:"template"`
+	Type     string `yaml:"type"`
+	// Category and Tags classify the notification; the category defaults to system
+	Category string   `yaml:"category"`
+	Tags     []string `yaml:"tags"`
+	Channels []string `yaml:"channels"`
+	// MandatoryChannels are delivered even if the user opted out of them,
+	// for notices the law requires us to send
+	MandatoryChannels []string `yaml:"mandatory_channels"`
+}
+
+// CircuitBreakerConfig holds the breaker settings for each delivery provider
+type CircuitBreakerConfig struct {
+	Default BreakerConfig `yaml:"default"`
+	// Providers overrides individual settings per channel
+	Providers map[string]BreakerConfig `yaml:"providers"`
+}
+
+// BreakerConfig configures a single provider's circuit breaker
+type BreakerConfig struct {
+	SendTimeout time.Duration `yaml:"send_timeout"`
+	// The breaker opens after ConsecutiveFailures, or once FailureRatio of
+	// at least MinRequests within Interval have failed
+	ConsecutiveFailures int           `yaml:"consecutive_failures"`
+	FailureRatio        float64       `yaml:"failure_ratio"`
+	MinRequests         int           `yaml:"min_requests"`
+	Interval            time.Duration `yaml:"interval"`
+	// OpenTimeout is how long the breaker stays open before half-open probing
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+	HalfOpenRequests int           `yaml:"half_open_requests"`
+}
+
+// For returns the settings for provider, falling back to the defaults for unset fields
+func (c CircuitBreakerConfig) For(provider string) BreakerConfig {
+	cfg := c.Default
+	override := c.Providers[provider]
+	if override.SendTimeout != 0 {
+		cfg.SendTimeout = override.SendTimeout
+	}
+	if override.ConsecutiveFailures != 0 {
+		cfg.ConsecutiveFailures = override.ConsecutiveFailures
+	}
+	if override.FailureRatio != 0 {
+		cfg.FailureRatio = override.FailureRatio
+	}
+	if override.MinRequests != 0 {
+		cfg.MinRequests = override.MinRequests
+	}
+	if override.Interval != 0 {
+		cfg.Interval = override.Interval
+	}
+	if override.OpenTimeout != 0 {
+		cfg.OpenTimeout = override.OpenTimeout
+	}
+	if override.HalfOpenRequests != 0 {
+		cfg.HalfOpenRequests = override.HalfOpenRequests
+	}
+	return cfg
+}
+
+func defaultConfig() Config {
+	hostname, _ := os.Hostname()
+
+	return Config{
+		Port:            "3003",
+		LogLevel:        "info",
+		ShutdownTimeout: 25 * time.Second,
+		Server: ServerConfig{
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			HTTP2:             true,
+		},
+		Delivery: DeliveryConfig{
+			Workers:     4,
+			QueueSize:   1000,
+			MaxAttempts: 3,
+			RetryDelay:  2 * time.Second,
+			Critical: DeliveryLaneConfig{
+				Workers:    2,
+				QueueSize:  500,
+				Priorities: []string{priorityUrgent},
+				Categories: []string{categorySecurity},
+			},
+			Bulk: DeliveryLaneConfig{
+				Workers:    2,
+				QueueSize:  5000,
+				Priorities: []string{priorityLow},
+				Campaigns:  true,
+			},
+			Watchdog: DeliveryWatchdogConfig{
+				Deadline: 2 * time.Minute,
+				Interval: 15 * time.Second,
+				Policy:   watchdogRetry,
+			},
+		},
+		Health: HealthConfig{
+			CheckTimeout: 2 * time.Second,
+		},
+		AccessLog: AccessLogConfig{
+			Routes:       map[string]string{},
+			RedactFields: []string{"email", "phone", "message", "title", "password", "token", "device_token", "address"},
+			MaxBodyBytes: 4096,
+		},
+		Metrics: MetricsConfig{
+			MaxSeries: 1000,
+		},
+		SLO: SLOConfig{
+			Objectives: map[string]time.Duration{
+				channelPush:  30 * time.Second,
+				channelSMS:   time.Minute,
+				channelEmail: 5 * time.Minute,
+			},
+			DefaultObjective: time.Minute,
+			Target:           0.99,
+		},
+		Diagnostics: DiagnosticsConfig{
+			Addr: ":6060",
+		},
+		ErrorReporting: ErrorReportConfig{
+			Environment: "production",
+		},
+		LeaderElection: LeaderElectionConfig{
+			LeaseName:     "notification-service-leader",
+			Identity:      hostname,
+			LeaseDuration: 15 * time.Second,
+			RenewDeadline: 10 * time.Second,
+			RetryPeriod:   2 * time.Second,
+		},
+		FeatureFlags: FeatureFlagConfig{
+			Flags: featureflags.Static{
+				flagDigestMode:         {},
+				flagOrderEventConsumer: {},
+			},
+			Unleash: featureflags.UnleashConfig{
+				AppName:         "notification-service",
+				RefreshInterval: 15 * time.Second,
+			},
+		},
+		Discovery: DiscoveryConfig{
+			Provider: "kubernetes",
+			Services: map[string]int{
+				serviceUser:  3001,
+				serviceOrder: 3002,
+			},
+			CacheTTL:       10 * time.Second,
+			EjectionPeriod: 30 * time.Second,
+		},
+		CircuitBreakers: CircuitBreakerConfig{
+			Default: BreakerConfig{
+				SendTimeout:         10 * time.Second,
+				ConsecutiveFailures: 5,
+				FailureRatio:        0.5,
+				MinRequests:         20,
+				Interval:            time.Minute,
+				OpenTimeout:         30 * time.Second,
+				HalfOpenRequests:    1,
+			},
+			Providers: map[string]BreakerConfig{
+				// SMTP relays are slow to accept but rarely down for long
+				channelEmail: {SendTimeout: 30 * time.Second},
+			},
+		},
+		Types: TypesConfig{
+			Unknown:        unknownTypesReject,
+			QuarantineSize: 1000,
+		},
+		Users: UserLookupConfig{
+			CacheTTL:  time.Minute,
+			CacheSize: 10000,
+		},
+		WriteBehind: WriteBehindConfig{
+			BatchSize:     500,
+			FlushInterval: 50 * time.Millisecond,
+			BufferSize:    10000,
+			MaxWait:       2 * time.Second,
+		},
+		Content: ContentConfig{
+			MaxActions:   3,
+			MaxDataBytes: 4096,
+			Schemas: map[string]ContentSchema{
+				"order_status": {Fields: map[string]ContentField{
+					"order_id":     {Type: fieldString, Required: true},
+					"tracking_url": {Type: fieldURL},
+				}},
+			},
+		},
+		Segments: map[string]SegmentConfig{
+			"new_users": {MaxAccountAge: 30 * 24 * time.Hour},
+		},
+		Unsubscribe: UnsubscribeConfig{
+			MaxAge: 90 * 24 * time.Hour,
+			Topic:  "notification-suppressions",
+		},
+		Sandbox: SandboxConfig{
+			OutboxSize: 1000,
+		},
+		Replication: ReplicationConfig{
+			GroupID: "notification-service-replication",
+		},
+		Archive: ArchiveConfig{
+			After:    90 * 24 * time.Hour,
+			Interval: time.Hour,
+			Region:   "us-east-1",
+			Prefix:   "notifications",
+		},
+		Anomalies: AnomalyConfig{
+			Interval:    time.Minute,
+			Baseline:    time.Hour,
+			Threshold:   5,
+			MinCount:    100,
+			ThrottleFor: 15 * time.Minute,
+		},
+		LoadShedding: LoadSheddingConfig{
+			Enabled:            true,
+			HighWaterMark:      0.8,
+			RetryAfter:         5 * time.Second,
+			CriticalCategories: []string{categorySecurity},
+		},
+		Providers: ProviderConfig{
+			Name: providerLog,
+			Mock: MockProviderConfig{
+				Latency:       50 * time.Millisecond,
+				Jitter:        100 * time.Millisecond,
+				FailureRate:   0.1,
+				CallbackDelay: 2 * time.Second,
+				BounceRate:    0.02,
+			},
+			Shadow: ShadowProviderConfig{
+				SampleRate:  1,
+				MaxInFlight: 100,
+			},
+		},
+		Storage: StorageConfig{
+			Shards:       []string{"shard-0"},
+			VirtualNodes: 128,
+		},
+		Responses: ResponseConfig{
+			StreamThreshold: 1000,
+			Compression: CompressionConfig{
+				Encodings:    []string{encodingZstd, encodingGzip},
+				MinSize:      1024,
+				ExcludePaths: []string{"/metrics"},
+			},
+		},
+		Events: EventsConfig{
+			GroupID:        "notification-service",
+			LifecycleTopic: "notification-lifecycle",
+			Orders: EventPipelineConfig{
+				Topic: "order-events",
+				Mappings: map[string]EventMapping{
+					"order.confirmed": {Template: "order-confirmed", Type: "order", Category: categoryOrders, Channels: []string{channelEmail, channelPush}},
+					"order.shipped":   {Template: "order-shipped", Type: "order", Category: categoryOrders, Tags: []string{"shipping"}, Channels: []string{channelEmail, channelPush}},
+					"order.delivered": {Template: "order-delivered", Type: "order", Category: categoryOrders, Tags: []string{"shipping"}, Channels: []string{channelPush}},
+				},
+			},
+			Payments: EventPipelineConfig{
+				Topic: "payment-events",
+				Mappings: map[string]EventMapping{
+					"payment.failed": {Template: "payment-failed", Type: "payment", Category: categoryPayments, Channels: []string{channelEmail, channelPush}, MandatoryChannels: []string{channelEmail}},
+					"refund.issued":  {Template: "refund-issued", Type: "payment", Category: categoryPayments, Tags: []string{"refund"}, Channels: []string{channelEmail}},
+				},
+			},
+			Security: EventPipelineConfig{
+				Topic: "security-events",
+				Mappings: map[string]EventMapping{
+					"security.new_login":        {Template: "new-login", Type: "security", Category: categorySecurity, Channels: []string{channelEmail, channelPush}, MandatoryChannels: []string{channelEmail}},
+					"security.password_changed": {Template: "password-changed", Type: "security", Category: categorySecurity, Channels: []string{channelEmail}, MandatoryChannels: []string{channelEmail}},
+				},
+			},
+		},
+	}
+}
+
+// loadConfig resolves the configuration from defaults, the config file and the environment
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// The ConfigMap is optional
+		case err != nil:
+			return cfg, fmt.Errorf("reading %s: %w", path, err)
+		default:
+			decoder := yaml.NewDecoder(bytes.NewReader(data))
+			decoder.KnownFields(true)
+			if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+				return cfg, fmt.Errorf("parsing %s: %w", path, err)
+			}
+		}
+	}
+
+	return cfg, errors.Join(applyEnv(&cfg), cfg.Validate())
+}
+
+// applyEnv overrides cfg with any configuration set in the environment
+func applyEnv(cfg *Config) error {
+	var errs []error
+
+	str := func(key string, dst *string) {
+		if value, ok := os.LookupEnv(key); ok {
+			*dst = value
+		}
+	}
+	integer := func(key string, dst *int) {
+		if value, ok := os.LookupEnv(key); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = parsed
+		}
+	}
+	float := func(key string, dst *float64) {
+		if value, ok := os.LookupEnv(key); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = parsed
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if value, ok := os.LookupEnv(key); ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = parsed
+		}
+	}
+	duration := func(key string, dst *time.Duration) {
+		if value, ok := os.LookupEnv(key); ok {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = parsed
+		}
+	}
+
+	str("PORT", &cfg.Port)
+	str("LOG_LEVEL", &cfg.LogLevel)
+	duration("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	duration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	duration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	duration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	boolean("SERVER_HTTP2", &cfg.Server.HTTP2)
+	str("TLS_CERT_FILE", &cfg.Server.TLS.CertFile)
+	str("TLS_KEY_FILE", &cfg.Server.TLS.KeyFile)
+	if value, ok := os.LookupEnv("TLS_AUTOCERT_HOSTS"); ok {
+		cfg.Server.TLS.AutocertHosts = splitList(value)
+	}
+	str("TLS_AUTOCERT_CACHE_DIR", &cfg.Server.TLS.AutocertCacheDir)
+	str("TLS_AUTOCERT_EMAIL", &cfg.Server.TLS.AutocertEmail)
+
+	integer("DELIVERY_WORKERS", &cfg.Delivery.Workers)
+	integer("DELIVERY_QUEUE_SIZE", &cfg.Delivery.QueueSize)
+	integer("DELIVERY_MAX_ATTEMPTS", &cfg.Delivery.MaxAttempts)
+	duration("DELIVERY_RETRY_DELAY", &cfg.Delivery.RetryDelay)
+	integer("DELIVERY_CRITICAL_WORKERS", &cfg.Delivery.Critical.Workers)
+	integer("DELIVERY_CRITICAL_QUEUE_SIZE", &cfg.Delivery.Critical.QueueSize)
+	integer("DELIVERY_BULK_WORKERS", &cfg.Delivery.Bulk.Workers)
+	integer("DELIVERY_BULK_QUEUE_SIZE", &cfg.Delivery.Bulk.QueueSize)
+	duration("DELIVERY_WATCHDOG_DEADLINE", &cfg.Delivery.Watchdog.Deadline)
+	duration("DELIVERY_WATCHDOG_INTERVAL", &cfg.Delivery.Watchdog.Interval)
+	str("DELIVERY_WATCHDOG_POLICY", &cfg.Delivery.Watchdog.Policy)
+
+	duration("HEALTH_CHECK_TIMEOUT", &cfg.Health.CheckTimeout)
+	integer("HEALTH_MAX_QUEUE_BACKLOG", &cfg.Health.MaxQueueBacklog)
+	integer("HEALTH_MAX_CONSUMER_LAG", &cfg.Health.MaxConsumerLag)
+	duration("HEALTH_MAX_CONSUMER_DELAY", &cfg.Health.MaxConsumerDelay)
+	str("DATABASE_ADDR", &cfg.Health.DatabaseAddr)
+	str("CACHE_ADDR", &cfg.Health.CacheAddr)
+	str("BROKER_ADDR", &cfg.Health.BrokerAddr)
+
+	float("ACCESS_LOG_BODY_SAMPLE_RATE", &cfg.AccessLog.BodySampleRate)
+	integer("ACCESS_LOG_MAX_BODY_BYTES", &cfg.AccessLog.MaxBodyBytes)
+	if value, ok := os.LookupEnv("ACCESS_LOG_ROUTES"); ok {
+		for _, entry := range splitList(value) {
+			route, setting, ok := strings.Cut(entry, "=")
+			if !ok {
+				errs = append(errs, fmt.Errorf("ACCESS_LOG_ROUTES: invalid entry %q", entry))
+				continue
+			}
+			cfg.AccessLog.Routes[route] = setting
+		}
+	}
+	if value, ok := os.LookupEnv("ACCESS_LOG_REDACT_FIELDS"); ok {
+		cfg.AccessLog.RedactFields = splitList(value)
+	}
+
+	boolean("METRICS_STATUS_CLASSES", &cfg.Metrics.StatusClasses)
+	integer("METRICS_MAX_SERIES", &cfg.Metrics.MaxSeries)
+	if value, ok := os.LookupEnv("METRICS_DISABLED_LABELS"); ok {
+		cfg.Metrics.DisabledLabels = splitList(value)
+	}
+
+	duration("SLO_DEFAULT_OBJECTIVE", &cfg.SLO.DefaultObjective)
+	float("SLO_TARGET", &cfg.SLO.Target)
+	if value, ok := os.LookupEnv("SLO_OBJECTIVES"); ok {
+		for _, entry := range splitList(value) {
+			channel, setting, ok := strings.Cut(entry, "=")
+			objective, err := time.ParseDuration(setting)
+			if !ok || err != nil {
+				errs = append(errs, fmt.Errorf("SLO_OBJECTIVES: invalid entry %q", entry))
+				continue
+			}
+			cfg.SLO.Objectives[channel] = objective
+		}
+	}
+
+	boolean("PPROF_ENABLED", &cfg.Diagnostics.Enabled)
+	str("PPROF_ADDR", &cfg.Diagnostics.Addr)
+	integer("PPROF_MUTEX_FRACTION", &cfg.Diagnostics.MutexFraction)
+	integer("PPROF_BLOCK_RATE", &cfg.Diagnostics.BlockRate)
+
+	str("SENTRY_DSN", &cfg.ErrorReporting.SentryDSN)
+	str("ENVIRONMENT", &cfg.ErrorReporting.Environment)
+
+	boolean("LEADER_ELECTION_ENABLED", &cfg.LeaderElection.Enabled)
+	str("LEADER_ELECTION_LEASE_NAME", &cfg.LeaderElection.LeaseName)
+	str("POD_NAMESPACE", &cfg.LeaderElection.Namespace)
+	str("POD_NAME", &cfg.LeaderElection.Identity)
+
+	// FEATURE_FLAGS=name=rollout,... where rollout is a percentage, "true" or "false"
+	if value, ok := os.LookupEnv("FEATURE_FLAGS"); ok {
+		for _, entry := range splitList(value) {
+			name, setting, _ := strings.Cut(entry, "=")
+			rollout, err := parseRollout(setting)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("FEATURE_FLAGS: invalid entry %q", entry))
+				continue
+			}
+			flag := cfg.FeatureFlags.Flags[name]
+			flag.Rollout = rollout
+			cfg.FeatureFlags.Flags[name] = flag
+		}
+	}
+	str("UNLEASH_URL", &cfg.FeatureFlags.Unleash.URL)
+	str("UNLEASH_API_TOKEN", &cfg.FeatureFlags.Unleash.APIToken)
+	str("UNLEASH_APP_NAME", &cfg.FeatureFlags.Unleash.AppName)
+	duration("UNLEASH_REFRESH_INTERVAL", &cfg.FeatureFlags.Unleash.RefreshInterval)
+
+	str("DISCOVERY_PROVIDER", &cfg.Discovery.Provider)
+	str("DISCOVERY_NAMESPACE", &cfg.Discovery.Namespace)
+	str("CONSUL_HTTP_ADDR", &cfg.Discovery.ConsulAddr)
+	str("CONSUL_HTTP_TOKEN", &cfg.Discovery.ConsulToken)
+	if value, ok := os.LookupEnv("DISCOVERY_SERVICES"); ok {
+		for _, entry := range splitList(value) {
+			name, setting, _ := strings.Cut(entry, "=")
+			port, err := strconv.Atoi(setting)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("DISCOVERY_SERVICES: invalid entry %q", entry))
+				continue
+			}
+			cfg.Discovery.Services[name] = port
+		}
+	}
+
+	duration("BREAKER_SEND_TIMEOUT", &cfg.CircuitBreakers.Default.SendTimeout)
+	integer("BREAKER_CONSECUTIVE_FAILURES", &cfg.CircuitBreakers.Default.ConsecutiveFailures)
+	duration("BREAKER_OPEN_TIMEOUT", &cfg.CircuitBreakers.Default.OpenTimeout)
+
+	boolean("TEMPLATE_CONTROLLER_ENABLED", &cfg.Templates.ControllerEnabled)
+	str("TEMPLATE_NAMESPACE", &cfg.Templates.Namespace)
+
+	boolean("TYPE_CONTROLLER_ENABLED", &cfg.Types.ControllerEnabled)
+	str("TYPE_NAMESPACE", &cfg.Types.Namespace)
+	str("UNKNOWN_TYPES", &cfg.Types.Unknown)
+
+	boolean("USER_LOOKUP_ENABLED", &cfg.Users.Enabled)
+	duration("USER_CACHE_TTL", &cfg.Users.CacheTTL)
+
+	str("UNSUBSCRIBE_SIGNING_KEY", &cfg.Unsubscribe.SigningKey)
+	str("UNSUBSCRIBE_URL", &cfg.Unsubscribe.URL)
+	duration("UNSUBSCRIBE_MAX_AGE", &cfg.Unsubscribe.MaxAge)
+	str("SUPPRESSIONS_TOPIC", &cfg.Unsubscribe.Topic)
+
+	str("SENDGRID_WEBHOOK_PUBLIC_KEY", &cfg.Webhooks.SendGridPublicKey)
+	str("TWILIO_AUTH_TOKEN", &cfg.Webhooks.TwilioAuthToken)
+	str("TWILIO_WEBHOOK_URL", &cfg.Webhooks.TwilioURL)
+	str("FCM_WEBHOOK_SECRET", &cfg.Webhooks.FCMSecret)
+
+	boolean("SANDBOX_ENABLED", &cfg.Sandbox.Enabled)
+	boolean("CHAOS_ENABLED", &cfg.Chaos.Enabled)
+	integer("SANDBOX_OUTBOX_SIZE", &cfg.Sandbox.OutboxSize)
+
+	str("ADMIN_API_KEY", &cfg.Admin.APIKey)
+
+	boolean("LOAD_SHEDDING_ENABLED", &cfg.LoadShedding.Enabled)
+	float("LOAD_SHEDDING_HIGH_WATER_MARK", &cfg.LoadShedding.HighWaterMark)
+	duration("LOAD_SHEDDING_RETRY_AFTER", &cfg.LoadShedding.RetryAfter)
+	boolean("QUOTAS_ENABLED", &cfg.Quotas.Enabled)
+	boolean("ANOMALIES_ENABLED", &cfg.Anomalies.Enabled)
+	float("ANOMALIES_THRESHOLD", &cfg.Anomalies.Threshold)
+	boolean("ANOMALIES_AUTO_THROTTLE", &cfg.Anomalies.AutoThrottle)
+	if value, ok := os.LookupEnv("ANOMALIES_NOTIFY_USERS"); ok {
+		cfg.Anomalies.NotifyUsers = splitList(value)
+	}
+	boolean("REALTIME_SKIP_PUSH_WHEN_CONNECTED", &cfg.Realtime.SkipPushWhenConnected)
+	if value, ok := os.LookupEnv("REALTIME_ALLOWED_ORIGINS"); ok {
+		cfg.Realtime.AllowedOrigins = splitList(value)
+	}
+	boolean("REPLICATION_ENABLED", &cfg.Replication.Enabled)
+	str("REPLICATION_REGION", &cfg.Replication.Region)
+	if value, ok := os.LookupEnv("REPLICATION_BROKERS"); ok {
+		cfg.Replication.Brokers = splitList(value)
+	}
+	str("REPLICATION_TOPIC", &cfg.Replication.Topic)
+	if value, ok := os.LookupEnv("REPLICATION_PEER_TOPICS"); ok {
+		cfg.Replication.PeerTopics = splitList(value)
+	}
+	boolean("ARCHIVE_ENABLED", &cfg.Archive.Enabled)
+	str("ARCHIVE_ENDPOINT", &cfg.Archive.Endpoint)
+	str("ARCHIVE_BUCKET", &cfg.Archive.Bucket)
+	str("ARCHIVE_ACCESS_KEY_ID", &cfg.Archive.AccessKeyID)
+	str("ARCHIVE_SECRET_ACCESS_KEY", &cfg.Archive.SecretAccessKey)
+
+	str("PROVIDERS", &cfg.Providers.Name)
+	duration("MOCK_PROVIDER_LATENCY", &cfg.Providers.Mock.Latency)
+	duration("MOCK_PROVIDER_JITTER", &cfg.Providers.Mock.Jitter)
+	float("MOCK_PROVIDER_FAILURE_RATE", &cfg.Providers.Mock.FailureRate)
+	duration("MOCK_PROVIDER_CALLBACK_DELAY", &cfg.Providers.Mock.CallbackDelay)
+	float("MOCK_PROVIDER_BOUNCE_RATE", &cfg.Providers.Mock.BounceRate)
+	str("SHADOW_PROVIDER", &cfg.Providers.Shadow.Name)
+	if value, ok := os.LookupEnv("SHADOW_PROVIDER_CHANNELS"); ok {
+		cfg.Providers.Shadow.Channels = splitList(value)
+	}
+	float("SHADOW_PROVIDER_SAMPLE_RATE", &cfg.Providers.Shadow.SampleRate)
+
+	boolean("WRITE_BEHIND_ENABLED", &cfg.WriteBehind.Enabled)
+	str("WRITE_BEHIND_SPOOL_DIR", &cfg.WriteBehind.SpoolDir)
+	integer("WRITE_BATCH_SIZE", &cfg.WriteBehind.BatchSize)
+	duration("WRITE_FLUSH_INTERVAL", &cfg.WriteBehind.FlushInterval)
+	integer("WRITE_BUFFER_SIZE", &cfg.WriteBehind.BufferSize)
+	duration("WRITE_MAX_WAIT", &cfg.WriteBehind.MaxWait)
+
+	if value, ok := os.LookupEnv("STORAGE_SHARDS"); ok {
+		cfg.Storage.Shards = splitList(value)
+	}
+	integer("STORAGE_VIRTUAL_NODES", &cfg.Storage.VirtualNodes)
+
+	integer("RESPONSE_STREAM_THRESHOLD", &cfg.Responses.StreamThreshold)
+	if value, ok := os.LookupEnv("COMPRESSION_ENCODINGS"); ok {
+		cfg.Responses.Compression.Encodings = splitList(value)
+	}
+	integer("COMPRESSION_MIN_SIZE", &cfg.Responses.Compression.MinSize)
+
+	if value, ok := os.LookupEnv("KAFKA_BROKERS"); ok {
+		cfg.Events.Brokers = splitList(value)
+	}
+	str("EVENTS_GROUP_ID", &cfg.Events.GroupID)
+	str("ORDER_EVENTS_TOPIC", &cfg.Events.Orders.Topic)
+	str("PAYMENT_EVENTS_TOPIC", &cfg.Events.Payments.Topic)
+	str("SECURITY_EVENTS_TOPIC", &cfg.Events.Security.Topic)
+	str("LIFECYCLE_TOPIC", &cfg.Events.LifecycleTopic)
+
+	boolean("SEED_DATA", &cfg.SeedData)
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting in cfg
+func (cfg Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %q is not a valid port", cfg.Port))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %w", err))
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout: must be positive"))
+	}
+	if cfg.Server.ReadHeaderTimeout <= 0 {
+		errs = append(errs, errors.New("server.read_header_timeout: must be positive"))
+	}
+	if cfg.Server.ReadTimeout < 0 || cfg.Server.WriteTimeout < 0 || cfg.Server.IdleTimeout < 0 {
+		errs = append(errs, errors.New("server: timeouts must not be negative"))
+	}
+	if tls := cfg.Server.TLS; (tls.CertFile == "") != (tls.KeyFile == "") {
+		errs = append(errs, errors.New("server.tls: cert_file and key_file must be set together"))
+	} else if len(tls.AutocertHosts) > 0 && tls.CertFile != "" {
+		errs = append(errs, errors.New("server.tls: use either cert_file and key_file or autocert_hosts"))
+	} else if len(tls.AutocertHosts) > 0 && tls.AutocertCacheDir == "" {
+		errs = append(errs, errors.New("server.tls.autocert_cache_dir: must be set with autocert_hosts"))
+	}
+
+	if cfg.Delivery.Workers < 1 {
+		errs = append(errs, errors.New("delivery.workers: must be at least 1"))
+	}
+	if cfg.Delivery.QueueSize < 1 {
+		errs = append(errs, errors.New("delivery.queue_size: must be at least 1"))
+	}
+	if cfg.Delivery.MaxAttempts < 1 {
+		errs = append(errs, errors.New("delivery.max_attempts: must be at least 1"))
+	}
+	if cfg.Delivery.RetryDelay < 0 {
+		errs = append(errs, errors.New("delivery.retry_delay: must not be negative"))
+	}
+	for name, lane := range map[string]DeliveryLaneConfig{laneCritical: cfg.Delivery.Critical, laneBulk: cfg.Delivery.Bulk} {
+		if lane.Workers < 0 {
+			errs = append(errs, fmt.Errorf("delivery.%s.workers: must not be negative", name))
+		}
+		if lane.Workers > 0 && lane.QueueSize < 1 {
+			errs = append(errs, fmt.Errorf("delivery.%s.queue_size: must be at least 1", name))
+		}
+		for _, priority := range lane.Priorities {
+			if priority != priorityLow && priority != priorityNormal && priority != priorityHigh && priority != priorityUrgent {
+				errs = append(errs, fmt.Errorf("delivery.%s.priorities: %q must be low, normal, high or urgent", name, priority))
+			}
+		}
+	}
+	if watchdog := cfg.Delivery.Watchdog; watchdog.Deadline < 0 {
+		errs = append(errs, errors.New("delivery.watchdog.deadline: must not be negative"))
+	} else if watchdog.Deadline > 0 {
+		if watchdog.Interval <= 0 {
+			errs = append(errs, errors.New("delivery.watchdog.interval: must be positive"))
+		}
+		if watchdog.Policy != watchdogRetry && watchdog.Policy != watchdogDeadLetter {
+			errs = append(errs, fmt.Errorf("delivery.watchdog.policy: %q must be retry or dead_letter", watchdog.Policy))
+		}
+	}
+
+	if cfg.Health.CheckTimeout <= 0 {
+		errs = append(errs, errors.New("health.check_timeout: must be positive"))
+	}
+	if cfg.Health.MaxQueueBacklog < 0 || cfg.Health.MaxConsumerLag < 0 || cfg.Health.MaxConsumerDelay < 0 {
+		errs = append(errs, errors.New("health: backlog and lag thresholds must not be negative"))
+	}
+	if cfg.Health.MaxQueueBacklog > cfg.Delivery.QueueSize {
+		errs = append(errs, errors.New("health.max_queue_backlog: must not exceed delivery.queue_size"))
+	}
+
+	if cfg.Metrics.MaxSeries < 0 {
+		errs = append(errs, errors.New("metrics.max_series: must not be negative"))
+	}
+	for _, label := range cfg.Metrics.DisabledLabels {
+		switch label {
+		case middleware.LabelMethod, middleware.LabelEndpoint, middleware.LabelStatus:
+		default:
+			errs = append(errs, fmt.Errorf("metrics.disabled_labels: unknown label %q, want method, endpoint or status", label))
+		}
+	}
+
+	if cfg.AccessLog.BodySampleRate < 0 || cfg.AccessLog.BodySampleRate > 1 {
+		errs = append(errs, errors.New("access_log.body_sample_rate: must be between 0 and 1"))
+	}
+	for route, setting := range cfg.AccessLog.Routes {
+		if setting == "off" {
+			continue
+		}
+		if rate, err := strconv.ParseFloat(setting, 64); err != nil || rate < 0 || rate > 1 {
+			errs = append(errs, fmt.Errorf("access_log.routes[%s]: %q must be a rate between 0 and 1 or \"off\"", route, setting))
+		}
+	}
+	if cfg.AccessLog.MaxBodyBytes < 0 {
+		errs = append(errs, errors.New("access_log.max_body_bytes: must not be negative"))
+	}
+
+	if cfg.SLO.Target <= 0 || cfg.SLO.Target >= 1 {
+		errs = append(errs, errors.New("slo.target: must be between 0 and 1 exclusive"))
+	}
+	if cfg.SLO.DefaultObjective <= 0 {
+		errs = append(errs, errors.New("slo.default_objective: must be positive"))
+	}
+	for channel, objective := range cfg.SLO.Objectives {
+		if objective <= 0 {
+			errs = append(errs, fmt.Errorf("slo.objectives[%s]: must be positive", channel))
+		}
+	}
+
+	if cfg.LeaderElection.Enabled {
+		election := cfg.LeaderElection
+		if election.LeaseName == "" {
+			errs = append(errs, errors.New("leader_election.lease_name: must not be empty"))
+		}
+		if election.Identity == "" {
+			errs = append(errs, errors.New("leader_election.identity: must not be empty"))
+		}
+		if election.RetryPeriod <= 0 || election.RetryPeriod >= election.RenewDeadline ||
+			election.RenewDeadline >= election.LeaseDuration {
+			errs = append(errs, errors.New("leader_election: need 0 < retry_period < renew_deadline < lease_duration"))
+		}
+	}
+
+	for name, flag := range cfg.FeatureFlags.Flags {
+		if flag.Rollout < 0 || flag.Rollout > 100 {
+			errs = append(errs, fmt.Errorf("feature_flags.flags[%s].rollout: must be between 0 and 100", name))
+		}
+	}
+	if cfg.FeatureFlags.Unleash.URL != "" && cfg.FeatureFlags.Unleash.RefreshInterval <= 0 {
+		errs = append(errs, errors.New("feature_flags.unleash.refresh_interval: must be positive"))
+	}
+
+	switch cfg.Discovery.Provider {
+	case "kubernetes":
+		for name, port := range cfg.Discovery.Services {
+			if port < 1 || port > 65535 {
+				errs = append(errs, fmt.Errorf("discovery.services[%s]: %d is not a valid port", name, port))
+			}
+		}
+	case "consul":
+		if cfg.Discovery.ConsulAddr == "" {
+			errs = append(errs, errors.New("discovery.consul_addr: required when provider is consul"))
+		}
+		if cfg.Discovery.CacheTTL <= 0 {
+			errs = append(errs, errors.New("discovery.cache_ttl: must be positive"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("discovery.provider: %q must be kubernetes or consul", cfg.Discovery.Provider))
+	}
+	if cfg.Discovery.EjectionPeriod < 0 {
+		errs = append(errs, errors.New("discovery.ejection_period: must not be negative"))
+	}
+
+	for _, channel := range []string{channelEmail, channelSMS, channelPush} {
+		breaker := cfg.CircuitBreakers.For(channel)
+		prefix := "circuit_breakers.providers[" + channel + "]"
+		if breaker.SendTimeout <= 0 {
+			errs = append(errs, errors.New(prefix+".send_timeout: must be positive"))
+		}
+		if breaker.ConsecutiveFailures < 1 || breaker.MinRequests < 1 || breaker.HalfOpenRequests < 1 {
+			errs = append(errs, errors.New(prefix+": consecutive_failures, min_requests and half_open_requests must be at least 1"))
+		}
+		if breaker.FailureRatio <= 0 || breaker.FailureRatio > 1 {
+			errs = append(errs, errors.New(prefix+".failure_ratio: must be between 0 and 1"))
+		}
+		if breaker.Interval < 0 || breaker.OpenTimeout <= 0 {
+			errs = append(errs, errors.New(prefix+": interval must not be negative and open_timeout must be positive"))
+		}
+	}
+
+	switch cfg.Types.Unknown {
+	case unknownTypesAllow, unknownTypesReject, unknownTypesQuarantine:
+	default:
+		errs = append(errs, fmt.Errorf("types.unknown: %q must be allow, reject or quarantine", cfg.Types.Unknown))
+	}
+	if cfg.Types.QuarantineSize < 1 {
+		errs = append(errs, errors.New("types.quarantine_size must be positive"))
+	}
+
+	if cfg.Users.CacheTTL < 0 || cfg.Users.CacheSize < 0 {
+		errs = append(errs, errors.New("users: cache_ttl and cache_size must not be negative"))
+	}
+
+	if wb := cfg.WriteBehind; wb.Enabled && (wb.BatchSize < 1 || wb.FlushInterval <= 0 || wb.BufferSize < 1 || wb.MaxWait <= 0) {
+		errs = append(errs, errors.New("write_behind: batch_size, flush_interval, buffer_size and max_wait must be positive when enabled"))
+	}
+
+	if cfg.Content.MaxActions < 0 || cfg.Content.MaxDataBytes < 0 {
+		errs = append(errs, errors.New("content: max_actions and max_data_bytes must not be negative"))
+	}
+	for notificationType, schema := range cfg.Content.Schemas {
+		for name, field := range schema.Fields {
+			switch field.Type {
+			case fieldString, fieldNumber, fieldBoolean, fieldURL:
+			default:
+				errs = append(errs, fmt.Errorf("content.schemas[%s].fields[%s].type: %q must be string, number, boolean or url", notificationType, name, field.Type))
+			}
+		}
+	}
+	if _, err := compileDataSchemas(cfg.Content.JSONSchemas); err != nil {
+		errs = append(errs, err)
+	}
+
+	for name, segment := range cfg.Segments {
+		if segment.MinAccountAge < 0 || segment.MaxAccountAge < 0 || (segment.MaxAccountAge > 0 && segment.MinAccountAge > segment.MaxAccountAge) {
+			errs = append(errs, fmt.Errorf("segments[%s]: account ages must not be negative and min_account_age must not exceed max_account_age", name))
+		}
+		for _, plan := range segment.Plans {
+			if !slices.Contains(plans, plan) {
+				errs = append(errs, fmt.Errorf("segments[%s].plans: %q must be free, pro or enterprise", name, plan))
+			}
+		}
+	}
+
+	if unsubscribe := cfg.Unsubscribe; unsubscribe.SigningKey != "" {
+		if len(unsubscribe.SigningKey) < minSigningKeyLength {
+			errs = append(errs, fmt.Errorf("unsubscribe: UNSUBSCRIBE_SIGNING_KEY must be at least %d bytes", minSigningKeyLength))
+		}
+		if u, err := url.Parse(unsubscribe.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, errors.New("unsubscribe.url: must be an absolute http or https URL when a signing key is set"))
+		}
+		if unsubscribe.MaxAge < minUnsubscribeMaxAge {
+			errs = append(errs, fmt.Errorf("unsubscribe.max_age: must be at least %s", minUnsubscribeMaxAge))
+		}
+	}
+
+	if key := cfg.Webhooks.SendGridPublicKey; key != "" {
+		if _, err := parseSendGridKey(key); err != nil {
+			errs = append(errs, fmt.Errorf("webhooks: SENDGRID_WEBHOOK_PUBLIC_KEY: %w", err))
+		}
+	}
+	if cfg.Webhooks.TwilioAuthToken != "" {
+		if u, err := url.Parse(cfg.Webhooks.TwilioURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, errors.New("webhooks.twilio_url: must be an absolute http or https URL when TWILIO_AUTH_TOKEN is set"))
+		}
+	}
+
+	if cfg.Sandbox.Enabled && cfg.Sandbox.OutboxSize <= 0 {
+		errs = append(errs, errors.New("sandbox.outbox_size: must be positive when the sandbox is enabled"))
+	}
+
+	if key := cfg.Admin.APIKey; key != "" && len(key) < minAdminKeyLength {
+		errs = append(errs, fmt.Errorf("admin: ADMIN_API_KEY must be at least %d bytes", minAdminKeyLength))
+	}
+	if cfg.Chaos.Enabled && cfg.Admin.APIKey == "" {
+		errs = append(errs, errors.New("chaos.enabled: needs ADMIN_API_KEY, so only operators can inject faults"))
+	}
+
+	if shed := cfg.LoadShedding; shed.Enabled {
+		if shed.HighWaterMark <= 0 || shed.HighWaterMark > 1 {
+			errs = append(errs, errors.New("load_shedding.high_water_mark: must be above 0 and at most 1"))
+		}
+		if shed.RetryAfter < time.Second {
+			errs = append(errs, errors.New("load_shedding.retry_after: must be at least 1s"))
+		}
+		for _, category := range shed.CriticalCategories {
+			if !validCategory(category) {
+				errs = append(errs, fmt.Errorf("load_shedding.critical_categories: unknown category %q", category))
+			}
+		}
+	}
+
+	for _, origin := range cfg.Realtime.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Host == "" || u.Path != "" || (u.Scheme != "https" && u.Scheme != "http") {
+			errs = append(errs, fmt.Errorf("realtime.allowed_origins: %q must be a scheme and host, like https://app.example.com", origin))
+		}
+	}
+
+	if replication := cfg.Replication; replication.Enabled {
+		if replication.Region == "" || replication.Topic == "" || replication.GroupID == "" {
+			errs = append(errs, errors.New("replication: region, topic and group_id must be set"))
+		}
+		if len(replication.Brokers) == 0 {
+			errs = append(errs, errors.New("replication.brokers: must not be empty"))
+		}
+		if len(replication.PeerTopics) == 0 {
+			errs = append(errs, errors.New("replication.peer_topics: must not be empty"))
+		}
+		if slices.Contains(replication.PeerTopics, replication.Topic) {
+			errs = append(errs, fmt.Errorf("replication.peer_topics: must not include this region's topic %q", replication.Topic))
+		}
+	}
+
+	if archive := cfg.Archive; archive.Enabled {
+		if archive.After < 24*time.Hour {
+			errs = append(errs, errors.New("archive.after: must be at least 24h"))
+		}
+		if archive.Interval < time.Minute {
+			errs = append(errs, errors.New("archive.interval: must be at least 1m"))
+		}
+		if u, err := url.Parse(archive.Endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("archive.endpoint: %q must be an http(s) URL", archive.Endpoint))
+		}
+		if archive.Region == "" || archive.Bucket == "" {
+			errs = append(errs, errors.New("archive: region and bucket must be set"))
+		}
+		if archive.AccessKeyID == "" || archive.SecretAccessKey == "" {
+			errs = append(errs, errors.New("archive: ARCHIVE_ACCESS_KEY_ID and ARCHIVE_SECRET_ACCESS_KEY must be set"))
+		}
+	}
+
+	quotas := map[string]QuotaConfig{"default": cfg.Quotas.Default}
+	for tenant, quota := range cfg.Quotas.Tenants {
+		quotas["tenants."+tenant] = quota
+	}
+	for name, quota := range quotas {
+		for period, limits := range map[string]QuotaLimits{quotaDaily: quota.Daily, quotaMonthly: quota.Monthly} {
+			if limits.Notifications < 0 {
+				errs = append(errs, fmt.Errorf("quotas.%s.%s.notifications: must not be negative", name, period))
+			}
+			for channel, limit := range limits.Deliveries {
+				if channel != channelEmail && channel != channelSMS && channel != channelPush {
+					errs = append(errs, fmt.Errorf("quotas.%s.%s.deliveries: unknown channel %q", name, period, channel))
+				}
+				if limit < 0 {
+					errs = append(errs, fmt.Errorf("quotas.%s.%s.deliveries.%s: must not be negative", name, period, channel))
+				}
+			}
+		}
+	}
+
+	if anomalies := cfg.Anomalies; anomalies.Enabled {
+		if anomalies.Interval < time.Second {
+			errs = append(errs, errors.New("anomalies.interval: must be at least 1s"))
+		}
+		if anomalies.Baseline < anomalies.Interval {
+			errs = append(errs, errors.New("anomalies.baseline: must be at least the interval"))
+		}
+		if anomalies.Threshold <= 1 {
+			errs = append(errs, errors.New("anomalies.threshold: must be above 1"))
+		}
+		if anomalies.MinCount < 1 {
+			errs = append(errs, errors.New("anomalies.min_count: must be at least 1"))
+		}
+		if anomalies.AutoThrottle && anomalies.ThrottleFor < anomalies.Interval {
+			errs = append(errs, errors.New("anomalies.throttle_for: must be at least the interval"))
+		}
+	}
+
+	switch cfg.Providers.Name {
+	case providerLog:
+	case providerMock:
+		errs = append(errs, validateMockProvider("providers.mock", cfg.Providers.Mock)...)
+	default:
+		errs = append(errs, fmt.Errorf("providers.name: unknown provider %q, want %s or %s", cfg.Providers.Name, providerLog, providerMock))
+	}
+	if shadow := cfg.Providers.Shadow; shadow.Name != "" {
+		switch shadow.Name {
+		case providerLog:
+		case providerMock:
+			errs = append(errs, validateMockProvider("providers.shadow.mock", shadow.Mock)...)
+		default:
+			errs = append(errs, fmt.Errorf("providers.shadow.name: unknown provider %q, want %s or %s", shadow.Name, providerLog, providerMock))
+		}
+		if len(shadow.Channels) == 0 {
+			errs = append(errs, errors.New("providers.shadow.channels: must not be empty"))
+		}
+		for _, channel := range shadow.Channels {
+			if channel != channelEmail && channel != channelSMS && channel != channelPush {
+				errs = append(errs, fmt.Errorf("providers.shadow.channels: unknown channel %q", channel))
+			}
+		}
+		if shadow.SampleRate <= 0 || shadow.SampleRate > 1 {
+			errs = append(errs, errors.New("providers.shadow.sample_rate: must be above 0 and at most 1"))
+		}
+		if shadow.MaxInFlight < 1 {
+			errs = append(errs, errors.New("providers.shadow.max_in_flight: must be at least 1"))
+		}
+	}
+
+	if len(cfg.Storage.Shards) == 0 {
+		errs = append(errs, errors.New("storage.shards: at least one shard is required"))
+	}
+	seenShards := make(map[string]bool)
+	for _, name := range cfg.Storage.Shards {
+		if name == "" || seenShards[name] {
+			errs = append(errs, fmt.Errorf("storage.shards: %q is empty or listed twice", name))
+		}
+		seenShards[name] = true
+	}
+	if cfg.Storage.VirtualNodes < 1 {
+		errs = append(errs, errors.New("storage.virtual_nodes: must be at least 1"))
+	}
+
+	if cfg.Responses.StreamThreshold < 0 {
+		errs = append(errs, errors.New("responses.stream_threshold: must not be negative"))
+	}
+	for _, encoding := range cfg.Responses.Compression.Encodings {
+		if encoding != encodingGzip && encoding != encodingZstd {
+			errs = append(errs, fmt.Errorf("responses.compression.encodings: unsupported encoding %q", encoding))
+		}
+	}
+	if cfg.Responses.Compression.MinSize < 0 {
+		errs = append(errs, errors.New("responses.compression.min_size: must not be negative"))
+	}
+
+	if len(cfg.Events.Brokers) > 0 && cfg.Events.GroupID == "" {
+		errs = append(errs, errors.New("events.group_id: required when brokers are set"))
+	}
+	for name, pipeline := range map[string]EventPipelineConfig{
+		"orders":   cfg.Events.Orders,
+		"payments": cfg.Events.Payments,
+		"security": cfg.Events.Security,
+	} {
+		prefix := "events." + name
+		if len(pipeline.Mappings) > 0 && pipeline.Topic == "" {
+			errs = append(errs, errors.New(prefix+".topic: required when mappings are set"))
+		}
+		for event, mapping := range pipeline.Mappings {
+			mappingPrefix := prefix + ".mappings[" + event + "]"
+			if mapping.Template == "" || mapping.Type == "" {
+				errs = append(errs, errors.New(mappingPrefix+": template and type are required"))
+			}
+			if mapping.Category != "" && !validCategory(mapping.Category) {
+				errs = append(errs, fmt.Errorf("%s.category: unknown category %q", mappingPrefix, mapping.Category))
+			}
+			if _, err := normalizeTags(mapping.Tags); err != nil {
+				errs = append(errs, fmt.Errorf("%s.tags: %w", mappingPrefix, err))
+			}
+			if len(mapping.Channels)+len(mapping.MandatoryChannels) == 0 {
+				errs = append(errs, errors.New(mappingPrefix+".channels: at least one channel is required"))
+			}
+			for _, channel := range append(append([]string(nil), mapping.Channels...), mapping.MandatoryChannels...) {
+				if channel != channelEmail && channel != channelSMS && channel != channelPush {
+					errs = append(errs, fmt.Errorf("%s: unsupported channel %q", mappingPrefix, channel))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateMockProvider checks the mock provider settings at path
+func validateMockProvider(path string, mock MockProviderConfig) []error {
+	var errs []error
+	if mock.Latency < 0 || mock.Jitter < 0 || mock.CallbackDelay < 0 {
+		errs = append(errs, fmt.Errorf("%s: latency, jitter and callback_delay must not be negative", path))
+	}
+	if mock.FailureRate < 0 || mock.FailureRate > 1 || mock.BounceRate < 0 || mock.BounceRate > 1 {
+		errs = append(errs, fmt.Errorf("%s: failure_rate and bounce_rate must be between 0 and 1", path))
+	}
+	return errs
+}
+
+// parseRollout accepts a percentage or a boolean meaning 100 or 0
+func parseRollout(value string) (int, error) {
+	if enabled, err := strconv.ParseBool(value); err == nil {
+		if enabled {
+			return 100, nil
+		}
+		return 0, nil
+	}
+	return strconv.Atoi(strings.TrimSuffix(value, "%"))
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// watchConfig polls the config file and applies reloadable settings when it changes
+//
+// Polling rather than inotify keeps this working with ConfigMap volumes, which
+// are updated by swapping a symlink. Settings that need a restart are only
+// reported. Polling stops when ctx is cancelled.
+func watchConfig(ctx context.Context, path string, interval time.Duration, current Config, apply func(Config)) {
+	if path == "" {
+		return
+	}
+
+	last, _ := os.ReadFile(path)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			data, err := os.ReadFile(path)
+			if err != nil || bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+
+			next, err := loadConfig(path)
+			if err != nil {
+				slog.Error("ignoring invalid configuration change", "path", path, "error", err)
+				continue
+			}
+
+			if restartRequired(current, next) {
+				slog.Warn("configuration change needs a restart to take full effect", "path", path)
+			}
+			apply(next)
+			current = next
+			slog.Info("configuration reloaded", "path", path)
+		}
+	}()
+}
+
+// restartRequired reports whether next changes settings that are only read at
+// startup, which is every setting not tagged reload:"true"
+func restartRequired(current, next Config) bool {
+	return !equalAtStartup(reflect.ValueOf(current), reflect.ValueOf(next))
+}
+
+// equalAtStartup compares the fields of two structs of the same type, skipping reloadable ones
+func equalAtStartup(current, next reflect.Value) bool {
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		switch {
+		case !field.IsExported() || field.Tag.Get("reload") == "true":
+			continue
+		case field.Type.Kind() == reflect.Struct && hasReloadable(field.Type):
+			if !equalAtStartup(current.Field(i), next.Field(i)) {
+				return false
+			}
+		case !reflect.DeepEqual(current.Field(i).Interface(), next.Field(i).Interface()):
+			return false
+		}
+	}
+	return true
+}
+
+// hasReloadable reports whether any field of the struct type t, however deeply nested, is tagged reload:"true"
+func hasReloadable(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("reload") == "true" || (field.Type.Kind() == reflect.Struct && hasReloadable(field.Type)) {
+			return true
+		}
+	}
+	return false
+}
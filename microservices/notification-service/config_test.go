@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestartRequired(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(*Config)
+		want   bool
+	}{
+		{"nothing", func(*Config) {}, false},
+		{"log level", func(cfg *Config) { cfg.LogLevel = "debug" }, false},
+		{"quotas", func(cfg *Config) { cfg.Quotas.Tenants = map[string]QuotaConfig{"acme": {}} }, false},
+		{"unknown types", func(cfg *Config) { cfg.Types.Unknown = unknownTypesQuarantine }, false},
+		{"anomaly threshold", func(cfg *Config) { cfg.Anomalies.Threshold = 5 }, false},
+		{"skip push", func(cfg *Config) { cfg.Realtime.SkipPushWhenConnected = true }, false},
+		{"port", func(cfg *Config) { cfg.Port = "9090" }, true},
+		{"quarantine size", func(cfg *Config) { cfg.Types.QuarantineSize = 10 }, true},
+		{"anomaly interval", func(cfg *Config) { cfg.Anomalies.Interval = time.Hour }, true},
+		{"allowed origins", func(cfg *Config) { cfg.Realtime.AllowedOrigins = []string{"https://app.example.com"} }, true},
+		// Settings added later need a restart until they are tagged reloadable
+		{"lifecycle topic", func(cfg *Config) { cfg.Events.LifecycleTopic = "lifecycle" }, true},
+		{"spool dir", func(cfg *Config) { cfg.WriteBehind.SpoolDir = "/var/spool" }, true},
+	} {
+		next := defaultConfig()
+		tc.change(&next)
+		if got := restartRequired(defaultConfig(), next); got != tc.want {
+			t.Errorf("%s: restartRequired = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWatchConfigStopsOnShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("log_level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	applied := make(chan Config, 10)
+	watchConfig(ctx, path, 5*time.Millisecond, defaultConfig(), func(next Config) { applied <- next })
+
+	os.WriteFile(path, []byte("log_level: debug\n"), 0o600)
+	select {
+	case next := <-applied:
+		if next.LogLevel != "debug" {
+			t.Errorf("applied log level %q, want debug", next.LogLevel)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not applied")
+	}
+
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	os.WriteFile(path, []byte("log_level: warn\n"), 0o600)
+	select {
+	case next := <-applied:
+		t.Errorf("applied %q after shutdown", next.LogLevel)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
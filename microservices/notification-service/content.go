@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// NotificationAction is a button rendered with a notification
+//
+// It opens URL, a web or app deep link, or hands Intent to the client app;
+// exactly one of the two is set.
+type NotificationAction struct {
+	ID     string `json:"id" yaml:"id"`
+	Label  string `json:"label" yaml:"label"`
+	URL    string `json:"url,omitempty" yaml:"url"`
+	Intent string `json:"intent,omitempty" yaml:"intent"`
+}
+
+// Field types a content schema can require
+const (
+	fieldString  = "string"
+	fieldNumber  = "number"
+	fieldBoolean = "boolean"
+	fieldURL     = "url"
+)
+
+// contentValidator checks the rich content of new notifications
+type contentValidator struct {
+	maxActions   int
+	maxDataBytes int
+	// schemas maps a notification type to the data it must carry
+	schemas map[string]ContentSchema
+	// jsonSchemas maps a notification type to the JSON Schema its data must match
+	jsonSchemas atomic.Pointer[map[string]*jsonschema.Schema]
+}
+
+func newContentValidator(cfg ContentConfig) *contentValidator {
+	v := &contentValidator{maxActions: cfg.MaxActions, maxDataBytes: cfg.MaxDataBytes, schemas: cfg.Schemas}
+	v.SetJSONSchemas(cfg)
+	return v
+}
+
+// SetJSONSchemas replaces the JSON Schemas with those of cfg
+func (v *contentValidator) SetJSONSchemas(cfg ContentConfig) {
+	// The schemas were compiled when the configuration was validated
+	schemas, _ := compileDataSchemas(cfg.JSONSchemas)
+	v.jsonSchemas.Store(&schemas)
+}
+
+// Validate reports the first problem with the content of a notification of type notificationType
+//
+// Types without a schema accept any data within the size limit; types with
+// one reject missing required fields, fields of the wrong type and fields
+// the schema does not list. Data is then checked against the type's JSON
+// Schema, if it has one.
+func (v *contentValidator) Validate(notificationType string, actions []NotificationAction, imageURL string, data map[string]any) error {
+	if len(actions) > v.maxActions {
+		return fmt.Errorf("at most %d actions are allowed", v.maxActions)
+	}
+	seen := make(map[string]bool, len(actions))
+	for i, action := range actions {
+		if action.ID == "" || action.Label == "" {
+			return fmt.Errorf("actions[%d]: id and label are required", i)
+		}
+		if seen[action.ID] {
+			return fmt.Errorf("actions[%d]: duplicate id %q", i, action.ID)
+		}
+		seen[action.ID] = true
+		if (action.URL == "") == (action.Intent == "") {
+			return fmt.Errorf("actions[%d]: exactly one of url and intent is required", i)
+		}
+		if action.URL != "" && !validLink(action.URL) {
+			return fmt.Errorf("actions[%d]: url must be an https URL or an app deep link", i)
+		}
+	}
+
+	if imageURL != "" && !validHTTPS(imageURL) {
+		return errors.New("image_url must be an https URL")
+	}
+
+	if len(data) > 0 {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("data: %w", err)
+		}
+		if len(encoded) > v.maxDataBytes {
+			return fmt.Errorf("data must encode to at most %d bytes", v.maxDataBytes)
+		}
+	}
+	if schema, ok := v.schemas[notificationType]; ok {
+		if err := schema.check(data); err != nil {
+			return err
+		}
+	}
+	return v.ValidateData(notificationType, data)
+}
+
+// ValidateData checks data against the JSON Schema of notificationType,
+// returning a *dataError that lists every problem
+func (v *contentValidator) ValidateData(notificationType string, data map[string]any) error {
+	schema, ok := (*v.jsonSchemas.Load())[notificationType]
+	if !ok {
+		return nil
+	}
+	return validateData(schema, notificationType, data)
+}
+
+// check validates data against the schema, reporting problems in a stable order
+func (schema ContentSchema) check(data map[string]any) error {
+	names := make([]string, 0, len(schema.Fields))
+	for name := range schema.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := schema.Fields[name]
+		value, ok := data[name]
+		if !ok {
+			if field.Required {
+				return fmt.Errorf("data.%s is required", name)
+			}
+			continue
+		}
+		if !field.accepts(value) {
+			return fmt.Errorf("data.%s must be a %s", name, field.Type)
+		}
+	}
+
+	var unknown []string
+	for name := range data {
+		if _, ok := schema.Fields[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("data has unknown fields: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// accepts reports whether a JSON-decoded value has the field's type
+func (field ContentField) accepts(value any) bool {
+	switch field.Type {
+	case fieldString:
+		_, ok := value.(string)
+		return ok
+	case fieldNumber:
+		_, ok := value.(float64)
+		return ok
+	case fieldBoolean:
+		_, ok := value.(bool)
+		return ok
+	case fieldURL:
+		s, ok := value.(string)
+		return ok && validLink(s)
+	}
+	return false
+}
+
+func validHTTPS(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// validLink accepts https URLs and app deep links such as shop://orders/123
+func validLink(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http", "ftp", "javascript", "vbscript", "data", "file":
+		return false
+	}
+	return true
+}
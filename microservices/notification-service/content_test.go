@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestContentValidation(t *testing.T) {
+	v := newContentValidator(defaultConfig().Content)
+	open := NotificationAction{ID: "open", Label: "Open", URL: "shop://orders/123"}
+
+	for _, tc := range []struct {
+		name     string
+		typ      string
+		actions  []NotificationAction
+		imageURL string
+		data     map[string]any
+		wantErr  string
+	}{
+		{name: "plain", typ: "info"},
+		{name: "rich", typ: "info", actions: []NotificationAction{open, {ID: "track", Label: "Track", Intent: "track_order"}},
+			imageURL: "https://cdn.example.com/a.png", data: map[string]any{"anything": 1.0}},
+		{name: "too many actions", typ: "info", actions: []NotificationAction{open, {ID: "b", Label: "B", Intent: "b"}, {ID: "c", Label: "C", Intent: "c"}, {ID: "d", Label: "D", Intent: "d"}},
+			wantErr: "at most 3 actions"},
+		{name: "action without label", typ: "info", actions: []NotificationAction{{ID: "x", URL: "https://example.com"}}, wantErr: "id and label are required"},
+		{name: "duplicate action", typ: "info", actions: []NotificationAction{open, open}, wantErr: "duplicate id"},
+		{name: "url and intent", typ: "info", actions: []NotificationAction{{ID: "x", Label: "X", URL: "https://example.com", Intent: "x"}}, wantErr: "exactly one of url and intent"},
+		{name: "javascript url", typ: "info", actions: []NotificationAction{{ID: "x", Label: "X", URL: "javascript:alert(1)"}}, wantErr: "https URL or an app deep link"},
+		{name: "http image", typ: "info", imageURL: "http://cdn.example.com/a.png", wantErr: "image_url must be an https URL"},
+		{name: "oversized data", typ: "info", data: map[string]any{"blob": strings.Repeat("x", 5000)}, wantErr: "at most 4096 bytes"},
+		{name: "schema satisfied", typ: "order_status", data: map[string]any{"order_id": "123", "tracking_url": "https://track.example.com/123"}},
+		{name: "schema required field", typ: "order_status", data: map[string]any{"tracking_url": "https://track.example.com/123"}, wantErr: "data.order_id is required"},
+		{name: "schema wrong type", typ: "order_status", data: map[string]any{"order_id": 123.0}, wantErr: "data.order_id must be a string"},
+		{name: "schema bad url", typ: "order_status", data: map[string]any{"order_id": "123", "tracking_url": "ftp://x"}, wantErr: "data.tracking_url must be a url"},
+		{name: "schema unknown field", typ: "order_status", data: map[string]any{"order_id": "123", "coupon": "X", "amount": 1.0}, wantErr: "unknown fields: amount, coupon"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.Validate(tc.typ, tc.actions, tc.imageURL, tc.data)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Errorf("error = %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateStoresRichContent(t *testing.T) {
+	store := newNotificationStore()
+	r := listingRouter(t, store, 1000)
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/notifications", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	code := post(`{"user_id":"1","type":"order_status","title":"Shipped","message":"On its way",
+		"actions":[{"id":"track","label":"Track","url":"https://track.example.com/123"}],
+		"image_url":"https://cdn.example.com/box.png","data":{"order_id":"123"}}`)
+	if code != http.StatusCreated {
+		t.Fatalf("create returned %d", code)
+	}
+	stored := store.ListByUser("1")
+	if len(stored) != 1 || len(stored[0].Actions) != 1 || stored[0].ImageURL == "" || stored[0].Data["order_id"] != "123" {
+		t.Errorf("rich content not stored: %+v", stored)
+	}
+
+	if code := post(`{"user_id":"1","type":"order_status","title":"Shipped","message":"On its way","data":{}}`); code != http.StatusBadRequest {
+		t.Errorf("create without required data returned %d, want 400", code)
+	}
+}
+
+func TestJSONSchemaValidation(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Content.JSONSchemas = map[string]map[string]any{
+		"payment": {
+			"type":     "object",
+			"required": []any{"payment_id", "amount"},
+			"properties": map[string]any{
+				"payment_id": map[string]any{"type": "string"},
+				"amount":     map[string]any{"type": "number", "minimum": 0},
+				"items": map[string]any{"type": "array", "items": map[string]any{
+					"type": "object", "required": []any{"sku"},
+				}},
+			},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	content := newContentValidator(cfg.Content)
+
+	store := newNotificationStore()
+	service := testService(store, newBroadcastStore(), systemClock{})
+	service.content = content
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAPIRoutes(r.Group("/api"), context.Background(), service, newTemplateStore(), cfg.Responses.StreamThreshold)
+	post := func(data string) *httptest.ResponseRecorder {
+		body := `{"user_id":"alice","type":"payment","title":"Paid","message":"Thanks","data":` + data + `}`
+		req := httptest.NewRequest(http.MethodPost, "/api/notifications", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post(`{"payment_id":"p1","amount":9.99}`); rec.Code != http.StatusCreated {
+		t.Fatalf("valid create returned %d: %s", rec.Code, rec.Body)
+	}
+	rec := post(`{"amount":-1,"items":[{"sku":"a"},{}]}`)
+	var resp struct {
+		Details []dataProblem `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, len(resp.Details))
+	for i, problem := range resp.Details {
+		got[i] = problem.Path
+	}
+	if rec.Code != http.StatusBadRequest || strings.Join(got, ",") != "data,data.amount,data.items.1" {
+		t.Errorf("invalid create returned %d with problems at %v, want 400 with data, data.amount and data.items.1", rec.Code, got)
+	}
+
+	t.Run("events", func(t *testing.T) {
+		pipeline := eventPipelines(cfg.Events)[1]
+		templates := newTemplateStore()
+		if err := templates.Put(NotificationTemplate{Name: "payment-failed", Subject: "Payment failed", Body: "We could not process {{ .amount }}."}); err != nil {
+			t.Fatal(err)
+		}
+		types := newTypeRegistry(defaultConfig().Types)
+		if err := types.Put(NotificationType{Name: "payment"}); err != nil {
+			t.Fatal(err)
+		}
+		handler := newEventHandler(pipeline, templates, content, types, nil, nil, func(context.Context, Notification, []string, []string) error { return nil })
+		event := platformEvent{ID: "e1", Type: "payment.failed", UserID: "alice", Data: map[string]any{"payment_id": "p1", "amount": "59.98", "currency": "USD"}}
+		if _, err := handler.Handle(context.Background(), event); !errors.Is(err, errEventRejected) || !errors.Is(err, errInvalidData) {
+			t.Errorf("event with a string amount returned %v, want it rejected for invalid data", err)
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		content.SetJSONSchemas(ContentConfig{})
+		if rec := post(`{"amount":-1}`); rec.Code != http.StatusCreated {
+			t.Errorf("create after removing the schema returned %d, want 201", rec.Code)
+		}
+	})
+}
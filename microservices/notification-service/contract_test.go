@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+
+	"platform/pkg/server"
+)
+
+// Contracts are published next to each consumer; see the description in each file
+const (
+	gatewayContract  = "../api-gateway/contracts/notification-service.json"
+	orderContract    = "../order-service/contracts/notification-service.json"
+	exampleTemplates = "../../k8s/examples/notification-template.yaml"
+)
+
+type contract struct {
+	Consumer     string        `json:"consumer"`
+	Provider     string        `json:"provider"`
+	Interactions []interaction `json:"interactions"`
+	Messages     []message     `json:"messages"`
+}
+
+type interaction struct {
+	Description string `json:"description"`
+	// Given names the provider state set up before the request
+	Given   string `json:"given"`
+	Request struct {
+		Method  string            `json:"method"`
+		Path    string            `json:"path"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body"`
+	} `json:"request"`
+	Response struct {
+		Status int `json:"status"`
+		// Headers must be present and start with the given value
+		Headers map[string]string `json:"headers"`
+		Body    any               `json:"body"`
+		// Events are the server-sent events expected in the body
+		Events []any `json:"events"`
+	} `json:"response"`
+}
+
+type message struct {
+	Description string          `json:"description"`
+	Topic       string          `json:"topic"`
+	Event       json.RawMessage `json:"event"`
+}
+
+// notificationShape is what "$notification" stands for in a contract
+var notificationShape = map[string]any{
+	"id":         "$string",
+	"user_id":    "$string",
+	"type":       "$string",
+	"title":      "$string",
+	"message":    "$string",
+	"status":     "$string",
+	"created_at": "$timestamp",
+}
+
+func loadContract(t *testing.T, path string) contract {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading contract: %v", err)
+	}
+	var c contract
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("parsing %s: %v", path, err)
+	}
+	if c.Provider != "notification-service" {
+		t.Fatalf("%s is a contract with %q", path, c.Provider)
+	}
+	return c
+}
+
+// givenState returns a store holding the named provider state, loading templates it needs
+func givenState(t *testing.T, state string, templates *templateStore) *notificationStore {
+	t.Helper()
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	fixture := func(id string) Notification {
+		return Notification{ID: id, UserID: "u-1", Type: "info", Title: "Welcome", Message: "Hello", Status: "unread", CreatedAt: created}
+	}
+
+	store := newNotificationStore()
+	switch state {
+	case "", "no notifications exist":
+	case "a notification exists":
+		store.Add(fixture("n-1"))
+	case "two notifications exist":
+		store.Add(fixture("n-1"))
+		store.Add(fixture("n-2"))
+	case "a template is loaded":
+		err := templates.Put(NotificationTemplate{Name: "welcome", Subject: "Welcome {{ .name }}", Body: "Hello {{ .name }}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("unknown provider state %q", state)
+	}
+	return store
+}
+
+func TestGatewayContract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := loadContract(t, gatewayContract)
+
+	// Already cancelled, so streams end once they have replayed what was missed
+	shutdown, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, in := range c.Interactions {
+		t.Run(in.Description, func(t *testing.T) {
+			templates := newTemplateStore()
+			store := givenState(t, in.Given, templates)
+
+			r := server.NewEngine(server.Options{})
+			registerAPIRoutes(r.Group("/api", requireOwner(store)), shutdown, testService(store, newBroadcastStore(), systemClock{}), templates, defaultConfig().Responses.StreamThreshold)
+
+			var body io.Reader
+			if len(in.Request.Body) > 0 {
+				body = bytes.NewReader(in.Request.Body)
+			}
+			req := httptest.NewRequest(in.Request.Method, in.Request.Path, body)
+			if body != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			for name, value := range in.Request.Headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != in.Response.Status {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, in.Response.Status, rec.Body)
+			}
+			for name, want := range in.Response.Headers {
+				if got := rec.Header().Get(name); !strings.HasPrefix(got, want) {
+					t.Errorf("header %s = %q, want %q", name, got, want)
+				}
+			}
+
+			if in.Response.Body != nil {
+				var actual any
+				if err := json.Unmarshal(rec.Body.Bytes(), &actual); err != nil {
+					t.Fatalf("response is not JSON: %v", err)
+				}
+				if err := matchShape("body", in.Response.Body, actual); err != nil {
+					t.Error(err)
+				}
+			}
+			if in.Response.Events != nil {
+				events, err := parseEvents(rec.Body.String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := matchShape("events", in.Response.Events, events); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderServiceContract(t *testing.T) {
+	c := loadContract(t, orderContract)
+	cfg := defaultConfig()
+	templates := loadExampleTemplates(t)
+
+	for _, msg := range c.Messages {
+		t.Run(msg.Description, func(t *testing.T) {
+			var event platformEvent
+			if err := json.Unmarshal(msg.Event, &event); err != nil {
+				t.Fatalf("event does not decode: %v", err)
+			}
+			if event.ID == "" || event.Type == "" || event.UserID == "" {
+				t.Fatalf("event is missing id, type or user_id: %+v", event)
+			}
+
+			var pipeline *eventPipeline
+			for _, p := range eventPipelines(cfg.Events) {
+				if p.Config.Topic == msg.Topic {
+					pipeline = &p
+					break
+				}
+			}
+			if pipeline == nil {
+				t.Fatalf("no pipeline consumes topic %q", msg.Topic)
+			}
+			mapping, ok := pipeline.Config.Mappings[event.Type]
+			if !ok {
+				t.Fatalf("event type %q is not mapped to a notification", event.Type)
+			}
+			for _, key := range pipeline.RequiredData {
+				if _, ok := event.Data[key]; !ok {
+					t.Errorf("event is missing data.%s", key)
+				}
+			}
+
+			tmpl, err := templates.Get(mapping.Template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := map[string]any{"user_id": event.UserID, "name": "John"}
+			for key, value := range event.Data {
+				data[key] = value
+			}
+			if _, _, err := tmpl.Render(data); err != nil {
+				t.Errorf("template %s cannot render the event: %v", mapping.Template, err)
+			}
+		})
+	}
+}
+
+// loadExampleTemplates loads the NotificationTemplate resources shipped with the manifests
+func loadExampleTemplates(t *testing.T) *templateStore {
+	t.Helper()
+	data, err := os.ReadFile(exampleTemplates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newTemplateStore()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc map[string]any
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("parsing %s: %v", exampleTemplates, err)
+		}
+		if doc["kind"] != "NotificationTemplate" {
+			continue
+		}
+
+		// The resource type carries JSON tags, as the API server speaks JSON
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resource templateResource
+		if err := json.Unmarshal(raw, &resource); err != nil {
+			t.Fatal(err)
+		}
+		tmpl, err := validateTemplate(resource)
+		if err != nil {
+			t.Fatalf("template %s: %v", resource.Metadata.Name, err)
+		}
+		if err := store.Put(tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// parseEvents decodes a server-sent event stream into id, event and JSON data fields
+func parseEvents(stream string) ([]any, error) {
+	var events []any
+	for _, block := range strings.Split(stream, "\n\n") {
+		event := map[string]any{}
+		for _, line := range strings.Split(block, "\n") {
+			field, value, ok := strings.Cut(line, ": ")
+			if !ok || field == "" {
+				continue
+			}
+			if field == "data" {
+				var data any
+				if err := json.Unmarshal([]byte(value), &data); err != nil {
+					return nil, fmt.Errorf("event data is not JSON: %w", err)
+				}
+				event[field] = data
+				continue
+			}
+			event[field] = value
+		}
+		if len(event) > 0 {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// matchShape checks actual against a contract value
+//
+// Strings starting with $ match by type, objects may carry extra fields, and
+// an array with one element matches arrays whose every element matches it.
+// Anything else must be equal.
+func matchShape(path string, expected, actual any) error {
+	switch want := expected.(type) {
+	case string:
+		if !strings.HasPrefix(want, "$") {
+			break
+		}
+		return matchType(path, want, actual)
+	case map[string]any:
+		got, ok := actual.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want an object, got %T", path, actual)
+		}
+		for key, value := range want {
+			nested, ok := got[key]
+			if !ok {
+				return fmt.Errorf("%s.%s: missing", path, key)
+			}
+			if err := matchShape(path+"."+key, value, nested); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		got, ok := actual.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want an array, got %T", path, actual)
+		}
+		if len(want) == 1 {
+			if len(got) == 0 {
+				return fmt.Errorf("%s: want at least one element", path)
+			}
+			for i, element := range got {
+				if err := matchShape(fmt.Sprintf("%s[%d]", path, i), want[0], element); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if len(want) != len(got) {
+			return fmt.Errorf("%s: want %d elements, got %d", path, len(want), len(got))
+		}
+		for i := range want {
+			if err := matchShape(fmt.Sprintf("%s[%d]", path, i), want[i], got[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		return fmt.Errorf("%s: want %v, got %v", path, expected, actual)
+	}
+	return nil
+}
+
+func matchType(path, matcher string, actual any) error {
+	ok := false
+	switch matcher {
+	case "$notification":
+		return matchShape(path, notificationShape, actual)
+	case "$string":
+		_, ok = actual.(string)
+	case "$number":
+		_, ok = actual.(float64)
+	case "$bool":
+		_, ok = actual.(bool)
+	case "$timestamp":
+		if s, isString := actual.(string); isString {
+			_, err := time.Parse(time.RFC3339Nano, s)
+			ok = err == nil
+		}
+	default:
+		return fmt.Errorf("%s: unknown matcher %s", path, matcher)
+	}
+	if !ok {
+		return fmt.Errorf("%s: want %s, got %v", path, matcher, actual)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// errInvalidData is returned for data that does not match its notification type's JSON Schema
+var errInvalidData = errors.New("data does not match the schema")
+
+// dataProblem is one way data fails its schema
+type dataProblem struct {
+	// Path locates the offending value, e.g. data.items.0.sku
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// dataError lists every problem found with one notification's data
+type dataError struct {
+	notificationType string
+	problems         []dataProblem
+}
+
+func (e *dataError) Error() string {
+	parts := make([]string, len(e.problems))
+	for i, problem := range e.problems {
+		parts[i] = problem.Path + ": " + problem.Message
+	}
+	return fmt.Sprintf("%s of %s: %s", errInvalidData, e.notificationType, strings.Join(parts, "; "))
+}
+
+func (e *dataError) Is(target error) bool { return target == errInvalidData }
+
+// compileDataSchemas compiles the JSON Schemas of content.json_schemas
+func compileDataSchemas(documents map[string]map[string]any) (map[string]*jsonschema.Schema, error) {
+	schemas := make(map[string]*jsonschema.Schema, len(documents))
+	for notificationType, document := range documents {
+		schema, err := compileDataSchema(notificationType, document)
+		if err != nil {
+			return nil, fmt.Errorf("content.json_schemas[%s]: %w", notificationType, err)
+		}
+		schemas[notificationType] = schema
+	}
+	return schemas, nil
+}
+
+// compileDataSchema compiles the JSON Schema (draft 2020-12) for the data of notificationType
+func compileDataSchema(notificationType string, document map[string]any) (*jsonschema.Schema, error) {
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	url := "notification-data/" + notificationType + ".json"
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	if err := compiler.AddResource(url, bytes.NewReader(encoded)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(url)
+}
+
+// validateData checks data against schema, collecting every problem rather than the first
+func validateData(schema *jsonschema.Schema, notificationType string, data map[string]any) error {
+	// A missing payload is validated as an empty object, so required properties are reported
+	var instance any = map[string]any{}
+	if data != nil {
+		instance = data
+	}
+	err := schema.Validate(instance)
+	var invalid *jsonschema.ValidationError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	var problems []dataProblem
+	collectProblems(invalid, &problems)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return &dataError{notificationType: notificationType, problems: problems}
+}
+
+// collectProblems gathers the leaves of a validation error, which name the actual failures
+func collectProblems(err *jsonschema.ValidationError, problems *[]dataProblem) {
+	if len(err.Causes) == 0 {
+		*problems = append(*problems, dataProblem{Path: dataPath(err.InstanceLocation), Message: err.Message})
+		return
+	}
+	for _, cause := range err.Causes {
+		collectProblems(cause, problems)
+	}
+}
+
+// dataPath turns a JSON pointer into data, such as /items/0/sku, into data.items.0.sku
+func dataPath(pointer string) string {
+	if pointer == "" {
+		return "data"
+	}
+	segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+	}
+	return "data." + strings.Join(segments, ".")
+}
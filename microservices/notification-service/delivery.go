@@ -0,0 +1,614 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/logging"
+	"platform/pkg/middleware"
+	"platform/pkg/reqctx"
+)
+
+// Delivery channels
+const (
+	channelEmail = "email"
+	channelSMS   = "sms"
+	channelPush  = "push"
+)
+
+// Errors returned when the send queue cannot accept more work
+var (
+	errQueueFull    = errors.New("delivery queue is full")
+	errShuttingDown = errors.New("delivery pipeline is shutting down")
+)
+
+// Delivery pipeline metrics
+var (
+	notificationsCreatedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notifications_created_total",
+			Help: "Total number of notifications created",
+		},
+		[]string{"type"},
+	)
+
+	deliveriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "deliveries_total",
+			Help: "Total number of delivery attempts by outcome",
+		},
+		[]string{"channel", "status"},
+	)
+
+	deliveryLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "delivery_latency_seconds",
+			Help:    "Time spent handing a notification to the channel provider",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"channel"},
+	)
+
+	deliveryQueueWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "delivery_queue_wait_seconds",
+			Help:    "Time deliveries wait in their lane's queue before a worker picks them up",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"lane"},
+	)
+
+	deadLetterTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dead_letter_total",
+			Help: "Total number of deliveries moved to the dead-letter list",
+		},
+		[]string{"channel"},
+	)
+)
+
+// Sender delivers a notification over a single channel
+type Sender interface {
+	Send(ctx context.Context, notification Notification, to recipient) error
+}
+
+// logSender stands in for a real provider and only logs the delivery
+type logSender struct{}
+
+func (s logSender) Send(ctx context.Context, notification Notification, to recipient) error {
+	logging.FromContext(ctx).Info("notification delivered",
+		"notification_id", notification.ID,
+		"user_id", notification.UserID,
+		"title", notification.Title,
+		"actions", len(notification.Actions),
+		"recipients", len(to.Addresses),
+		"locale", to.Locale,
+		"unsubscribe_link", to.UnsubscribeURL != "",
+	)
+	return nil
+}
+
+// deliveryJob is a single notification/channel pair waiting in the send queue
+type deliveryJob struct {
+	Notification Notification `json:"notification"`
+	Channel      string       `json:"channel"`
+	Attempt      int          `json:"attempt"`
+	LastError    string       `json:"last_error,omitempty"`
+	EnqueuedAt   time.Time    `json:"enqueued_at"`
+	// Mandatory deliveries, such as security notices, ignore unsubscribes
+	Mandatory bool `json:"mandatory,omitempty"`
+
+	// queuedAt is when the job last joined a lane's queue, for retries too
+	queuedAt time.Time
+}
+
+// Send queue lanes, by the priority of the notifications they carry
+const (
+	laneCritical = "critical"
+	laneStandard = "standard"
+	laneBulk     = "bulk"
+)
+
+// deliveryLane is a queue and the workers draining it, for one priority class
+type deliveryLane struct {
+	name    string
+	queue   chan deliveryJob
+	workers int
+	cfg     DeliveryLaneConfig
+
+	// mu serializes pushes, so the room one checks for stays free until it has queued
+	mu sync.Mutex
+}
+
+// push queues jobs together, or none of them if the queue has no room for them all
+func (l *deliveryLane) push(jobs ...deliveryJob) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue)+len(jobs) > cap(l.queue) {
+		return false
+	}
+	// Workers only take jobs off the queue, so none of these sends blocks
+	for _, job := range jobs {
+		l.queue <- job
+	}
+	return true
+}
+
+// carries reports whether the lane picks notification
+func (l *deliveryLane) carries(notification Notification) bool {
+	return slices.Contains(l.cfg.Priorities, notification.Priority) ||
+		slices.Contains(l.cfg.Categories, notification.Category) ||
+		(l.cfg.Campaigns && notification.Campaign != "")
+}
+
+// Dispatcher fans notifications out to channel senders through bounded queues
+//
+// Each lane has its own queue and workers; notifications no other lane
+// picks use the standard lane.
+type Dispatcher struct {
+	// lanes are tried in order and end with standard
+	lanes       []*deliveryLane
+	standard    *deliveryLane
+	senders     map[string]Sender
+	recipients  recipientResolver
+	maxAttempts int
+	retryDelay  time.Duration
+	breakers    CircuitBreakerConfig
+	slo         atomic.Pointer[sloPolicy]
+	// onDelivered, if set, is called after every successful delivery
+	onDelivered atomic.Pointer[func(notification Notification, channel string)]
+	// onDeadLettered, if set, is called for every delivery given up on
+	onDeadLettered atomic.Pointer[func(notification Notification, channel string)]
+	// unsubscribes, if set, suppresses deliveries and signs email unsubscribe links
+	unsubscribes atomic.Pointer[unsubscriber]
+	// presence, if set, skips push deliveries to users who are connected
+	presence atomic.Pointer[presenceRegistry]
+	// addresses, if set, holds the email addresses and phone numbers not delivered to
+	addresses *suppressionList
+
+	// pending counts jobs that are queued, in flight or waiting for a retry
+	pending  sync.WaitGroup
+	draining atomic.Bool
+
+	mu          sync.Mutex
+	deadLetters []deliveryJob
+	// failures are the most recent failed attempts, retried or not
+	failures []deliveryJob
+
+	// inFlight holds the deliveries workers are resolving or sending, for the watchdog
+	flightMu sync.Mutex
+	inFlight map[*inFlightDelivery]struct{}
+}
+
+// maxDeadLetters bounds the in-memory dead-letter list
+const maxDeadLetters = 1000
+
+// maxRecentFailures bounds the in-memory list of recent failed attempts
+const maxRecentFailures = 200
+
+// newDispatcher creates a dispatcher; a nil recipients resolver hands senders only the user ID
+func newDispatcher(queueSize, maxAttempts int, retryDelay time.Duration, slo *sloPolicy, breakers CircuitBreakerConfig, recipients recipientResolver) *Dispatcher {
+	standard := &deliveryLane{name: laneStandard, queue: make(chan deliveryJob, queueSize)}
+	d := &Dispatcher{
+		lanes:       []*deliveryLane{standard},
+		standard:    standard,
+		senders:     make(map[string]Sender),
+		recipients:  recipients,
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		breakers:    breakers,
+		inFlight:    make(map[*inFlightDelivery]struct{}),
+	}
+	d.UseProvider(func(string) Sender { return logSender{} })
+	d.slo.Store(slo)
+	return d
+}
+
+// UseProvider delivers on every channel through the sender newSender returns for it, behind the channel's circuit breaker
+//
+// Call it before Sandbox, SuppressAddresses and Start.
+func (d *Dispatcher) UseProvider(newSender func(channel string) Sender) {
+	for _, channel := range []string{channelEmail, channelSMS, channelPush} {
+		d.senders[channel] = newBreakerSender(channel, newSender(channel), d.breakers.For(channel))
+	}
+}
+
+// SetSLOPolicy replaces the latency objectives used for new observations
+func (d *Dispatcher) SetSLOPolicy(slo *sloPolicy) {
+	d.slo.Store(slo)
+}
+
+// OnDelivered registers fn to be called after every successful delivery
+func (d *Dispatcher) OnDelivered(fn func(notification Notification, channel string)) {
+	d.onDelivered.Store(&fn)
+}
+
+// OnDeadLettered registers fn to be called for every delivery given up on
+func (d *Dispatcher) OnDeadLettered(fn func(notification Notification, channel string)) {
+	d.onDeadLettered.Store(&fn)
+}
+
+// SetUnsubscriber honors the suppressions of unsubscribes and adds its links to emails
+func (d *Dispatcher) SetUnsubscriber(unsubscribes *unsubscriber) {
+	d.unsubscribes.Store(unsubscribes)
+}
+
+// SetPresence skips push deliveries to users presence reports as connected, when its policy says so
+func (d *Dispatcher) SetPresence(presence *presenceRegistry) {
+	d.presence.Store(presence)
+}
+
+// Sandbox captures every delivery in outbox instead of sending it; call it before SuppressAddresses and Start
+func (d *Dispatcher) Sandbox(outbox *sandboxOutbox) {
+	for channel := range d.senders {
+		d.senders[channel] = captureSender{channel: channel, outbox: outbox}
+	}
+}
+
+// SuppressAddresses stops email and SMS deliveries to the addresses in list; call it before Start
+func (d *Dispatcher) SuppressAddresses(list *suppressionList) {
+	d.addresses = list
+	for _, channel := range []string{channelEmail, channelSMS} {
+		d.senders[channel] = suppressingSender{channel: channel, list: list, next: d.senders[channel]}
+	}
+}
+
+// AddLane gives the notifications cfg picks a queue and workers of their own; call it before Start
+//
+// A lane without workers is not added. Lanes are tried in the order they are added.
+func (d *Dispatcher) AddLane(name string, cfg DeliveryLaneConfig) {
+	if cfg.Workers < 1 {
+		return
+	}
+	lane := &deliveryLane{name: name, queue: make(chan deliveryJob, cfg.QueueSize), workers: cfg.Workers, cfg: cfg}
+	d.lanes = append(d.lanes[:len(d.lanes)-1], lane, d.standard)
+}
+
+// Lanes returns the names of the lanes, the standard one last
+func (d *Dispatcher) Lanes() []string {
+	names := make([]string, len(d.lanes))
+	for i, lane := range d.lanes {
+		names[i] = lane.name
+	}
+	return names
+}
+
+// laneFor returns the lane notification is delivered through
+func (d *Dispatcher) laneFor(notification Notification) *deliveryLane {
+	for _, lane := range d.lanes[:len(d.lanes)-1] {
+		if lane.carries(notification) {
+			return lane
+		}
+	}
+	return d.standard
+}
+
+// Start launches workers for the standard lane, and each other lane's own workers
+func (d *Dispatcher) Start(workers int) {
+	d.standard.workers = workers
+	for _, lane := range d.lanes {
+		for i := 0; i < lane.workers; i++ {
+			go d.worker(lane)
+		}
+	}
+}
+
+// Supports reports whether a sender is configured for channel
+func (d *Dispatcher) Supports(channel string) bool {
+	_, ok := d.senders[channel]
+	return ok
+}
+
+// Enqueue schedules delivery of notification over each channel
+func (d *Dispatcher) Enqueue(notification Notification, channels []string) error {
+	return d.EnqueueMandatory(notification, channels, nil)
+}
+
+// EnqueueMandatory schedules delivery of notification over each channel,
+// delivering over those also in mandatory even if the user unsubscribed
+func (d *Dispatcher) EnqueueMandatory(notification Notification, channels, mandatory []string) error {
+	if d.draining.Load() {
+		return errShuttingDown
+	}
+	now := time.Now()
+	jobs := make([]deliveryJob, len(channels))
+	for i, channel := range channels {
+		jobs[i] = deliveryJob{
+			Notification: notification,
+			Channel:      channel,
+			Attempt:      1,
+			EnqueuedAt:   now,
+			Mandatory:    slices.Contains(mandatory, channel),
+			queuedAt:     now,
+		}
+	}
+	// Queueing some channels but not others would make the caller's retry
+	// deliver those twice, so every channel is queued or none is
+	d.pending.Add(len(jobs))
+	if !d.laneFor(notification).push(jobs...) {
+		d.pending.Add(-len(jobs))
+		return errQueueFull
+	}
+	return nil
+}
+
+// Drain stops accepting new work and waits until every queued delivery,
+// including scheduled retries, has been delivered or dead-lettered.
+func (d *Dispatcher) Drain(ctx context.Context) error {
+	d.draining.Store(true)
+
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d deliveries still queued: %w", d.QueueDepth(), ctx.Err())
+	}
+}
+
+// QueueDepth returns the number of jobs waiting to be delivered in every lane
+func (d *Dispatcher) QueueDepth() int {
+	depth := 0
+	for _, lane := range d.lanes {
+		depth += len(lane.queue)
+	}
+	return depth
+}
+
+// QueueCapacity returns the maximum number of jobs the lanes' queues can hold together
+func (d *Dispatcher) QueueCapacity() int {
+	capacity := 0
+	for _, lane := range d.lanes {
+		capacity += cap(lane.queue)
+	}
+	return capacity
+}
+
+// Workers returns the number of workers draining every lane
+func (d *Dispatcher) Workers() int {
+	workers := 0
+	for _, lane := range d.lanes {
+		workers += lane.workers
+	}
+	return workers
+}
+
+// LaneDepth returns the number of jobs waiting in the lane called name
+func (d *Dispatcher) LaneDepth(name string) int {
+	for _, lane := range d.lanes {
+		if lane.name == name {
+			return len(lane.queue)
+		}
+	}
+	return 0
+}
+
+// DeadLetters returns a copy of the dead-letter list
+func (d *Dispatcher) DeadLetters() []deliveryJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]deliveryJob(nil), d.deadLetters...)
+}
+
+// RecentFailures returns a copy of the most recent failed attempts, oldest first
+func (d *Dispatcher) RecentFailures() []deliveryJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]deliveryJob(nil), d.failures...)
+}
+
+// recordFailure adds job, carrying its error, to the recent failures
+func (d *Dispatcher) recordFailure(job deliveryJob) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures = append(d.failures, job)
+	if len(d.failures) > maxRecentFailures {
+		d.failures = d.failures[len(d.failures)-maxRecentFailures:]
+	}
+}
+
+// Redrive queues dead-lettered deliveries again with their attempts reset,
+// all of them or only those of notificationID, returning how many it queued
+//
+// It stops at the first delivery the queue has no room for and returns
+// errQueueFull; that delivery and the rest stay dead-lettered.
+func (d *Dispatcher) Redrive(notificationID string) (int, error) {
+	if d.draining.Load() {
+		return 0, errShuttingDown
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var err error
+	redriven := 0
+	kept := d.deadLetters[:0]
+	for _, job := range d.deadLetters {
+		if err != nil || (notificationID != "" && job.Notification.ID != notificationID) {
+			kept = append(kept, job)
+			continue
+		}
+		retry := job
+		retry.Attempt, retry.LastError, retry.EnqueuedAt = 1, "", time.Now()
+		retry.queuedAt = retry.EnqueuedAt
+		d.pending.Add(1)
+		if d.laneFor(retry.Notification).push(retry) {
+			redriven++
+		} else {
+			d.pending.Done()
+			err = errQueueFull
+			kept = append(kept, job)
+		}
+	}
+	clear(d.deadLetters[len(kept):])
+	d.deadLetters = kept
+	return redriven, err
+}
+
+func (d *Dispatcher) worker(lane *deliveryLane) {
+	wait := deliveryQueueWait.WithLabelValues(lane.name)
+	for job := range lane.queue {
+		wait.Observe(time.Since(job.queuedAt).Seconds())
+		if !d.deliver(lane, job) {
+			// The watchdog took the delivery over and started a worker in this one's place
+			return
+		}
+	}
+}
+
+// deliver sends job, returning false if the watchdog reclaimed it while it was in flight
+func (d *Dispatcher) deliver(lane *deliveryLane, job deliveryJob) bool {
+	ctx := reqctx.WithCorrelationID(context.Background(), job.Notification.CorrelationID)
+	logger := logging.FromContext(ctx).With(
+		"request_id", job.Notification.CorrelationID,
+		"channel", job.Channel,
+		"attempt", job.Attempt,
+	)
+	ctx = logging.NewContext(ctx, logger)
+
+	if !job.Mandatory && d.unsubscribed(job.Notification) {
+		deliveriesTotal.WithLabelValues(job.Channel, "suppressed").Inc()
+		logger.Debug("delivery suppressed", "notification_id", job.Notification.ID)
+		d.pending.Done()
+		return true
+	}
+
+	// The user has a stream open on this replica, which the notification is
+	// published to once stored, so a push would notify them twice. Presence
+	// is not shared, so users connected to other replicas still get the push
+	if job.Channel == channelPush && d.presence.Load().SkipPush(job.Notification.UserID) {
+		deliveriesTotal.WithLabelValues(job.Channel, "skipped_connected").Inc()
+		logger.Debug("push skipped for a connected user", "notification_id", job.Notification.ID)
+		d.pending.Done()
+		return true
+	}
+
+	ctx, flight := d.track(ctx, lane, job)
+	to, resolveErr := d.resolve(ctx, job)
+	start := time.Now()
+	var err error
+	if resolveErr == nil {
+		if unsubscribes := d.unsubscribes.Load(); unsubscribes != nil && job.Channel == channelEmail && !job.Mandatory {
+			to.UnsubscribeURL = unsubscribes.Link(job.Notification.UserID, job.Notification.Type)
+		}
+		err = d.senders[job.Channel].Send(ctx, job.Notification, to)
+	}
+	if !d.untrack(flight) {
+		logger.Warn("delivery finished after the watchdog reclaimed it", "notification_id", job.Notification.ID, "error", errors.Join(resolveErr, err))
+		return false
+	}
+
+	if errors.Is(resolveErr, errNoRecipient) {
+		// Retrying cannot conjure up an address, so give up straight away
+		deliveriesTotal.WithLabelValues(job.Channel, "undeliverable").Inc()
+		job.LastError = resolveErr.Error()
+		d.deadLetter(job)
+		return true
+	}
+	if resolveErr != nil {
+		d.fail(ctx, job, fmt.Errorf("resolving recipient: %w", resolveErr))
+		return true
+	}
+
+	// The provider was not called, so keep the job queued without using up an attempt
+	if errors.Is(err, errCircuitOpen) {
+		deliveriesTotal.WithLabelValues(job.Channel, "deferred").Inc()
+		logger.Debug("delivery deferred", "notification_id", job.Notification.ID, "error", err)
+		d.requeue(job, max(d.retryDelay, time.Second))
+		return true
+	}
+	if errors.Is(err, errAddressSuppressed) {
+		deliveriesTotal.WithLabelValues(job.Channel, "suppressed").Inc()
+		logger.Debug("delivery suppressed", "notification_id", job.Notification.ID, "error", err)
+		d.pending.Done()
+		return true
+	}
+	middleware.ObserveWithTrace(deliveryLatency.WithLabelValues(job.Channel), time.Since(start).Seconds(), job.Notification.TraceID)
+
+	if err == nil {
+		deliveriesTotal.WithLabelValues(job.Channel, "delivered").Inc()
+		d.slo.Load().observeDelivered(job.Channel, job.Notification)
+		if onDelivered := d.onDelivered.Load(); onDelivered != nil {
+			(*onDelivered)(job.Notification, job.Channel)
+		}
+		d.pending.Done()
+		return true
+	}
+
+	d.fail(ctx, job, err)
+	return true
+}
+
+// unsubscribed reports whether the user unsubscribed from the notification's type
+func (d *Dispatcher) unsubscribed(notification Notification) bool {
+	unsubscribes := d.unsubscribes.Load()
+	return unsubscribes != nil && unsubscribes.Suppressed(notification.UserID, notification.Type)
+}
+
+// resolve looks up where job should be delivered
+func (d *Dispatcher) resolve(ctx context.Context, job deliveryJob) (recipient, error) {
+	if d.recipients == nil {
+		return recipient{}, nil
+	}
+	return d.recipients.Resolve(ctx, job.Notification.UserID, job.Channel)
+}
+
+// fail records a failed attempt and schedules a retry or dead-letters job
+func (d *Dispatcher) fail(ctx context.Context, job deliveryJob, err error) {
+	deliveriesTotal.WithLabelValues(job.Channel, "failed").Inc()
+	job.LastError = err.Error()
+	logging.FromContext(ctx).Warn("delivery failed", "notification_id", job.Notification.ID, "error", err)
+	d.recordFailure(job)
+
+	if job.Attempt >= d.maxAttempts {
+		d.deadLetter(job)
+		return
+	}
+
+	job.Attempt++
+	d.requeue(job, d.retryDelay*time.Duration(job.Attempt-1))
+}
+
+// requeue puts job back on the queue after delay, dead-lettering it if the queue is full
+func (d *Dispatcher) requeue(job deliveryJob, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		job.queuedAt = time.Now()
+		if !d.laneFor(job.Notification).push(job) {
+			d.deadLetter(job)
+		}
+	})
+}
+
+func (d *Dispatcher) deadLetter(job deliveryJob) {
+	deadLetterTotal.WithLabelValues(job.Channel).Inc()
+	d.slo.Load().observeFailed(job.Channel)
+	if onDeadLettered := d.onDeadLettered.Load(); onDeadLettered != nil {
+		(*onDeadLettered)(job.Notification, job.Channel)
+	}
+	logging.FromContext(context.Background()).Error("delivery dead-lettered",
+		"request_id", job.Notification.CorrelationID,
+		"notification_id", job.Notification.ID,
+		"channel", job.Channel,
+		"attempts", job.Attempt,
+		"error", job.LastError,
+	)
+
+	d.mu.Lock()
+	d.deadLetters = append(d.deadLetters, job)
+	if len(d.deadLetters) > maxDeadLetters {
+		d.deadLetters = d.deadLetters[len(d.deadLetters)-maxDeadLetters:]
+	}
+	d.mu.Unlock()
+
+	d.pending.Done()
+}
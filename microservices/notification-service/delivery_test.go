@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedSender holds campaign deliveries until released and reports the others as they are sent
+type gatedSender struct {
+	release chan struct{}
+	sent    chan string
+}
+
+func (s gatedSender) Send(ctx context.Context, notification Notification, _ recipient) error {
+	if notification.Campaign != "" {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.sent <- notification.ID
+	return nil
+}
+
+func TestDeliveryLanes(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Delivery.Bulk.Workers, cfg.Delivery.Bulk.QueueSize = 1, 5
+	dispatcher := newDispatcher(2, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	dispatcher.AddLane(laneCritical, cfg.Delivery.Critical)
+	dispatcher.AddLane(laneBulk, cfg.Delivery.Bulk)
+	dispatcher.AddLane("off", DeliveryLaneConfig{Priorities: []string{priorityNormal}})
+	sender := gatedSender{release: make(chan struct{}), sent: make(chan string, 20)}
+	dispatcher.senders[channelEmail] = sender
+	dispatcher.Start(1)
+
+	if lanes := dispatcher.Lanes(); len(lanes) != 3 || lanes[0] != laneCritical || lanes[2] != laneStandard {
+		t.Fatalf("lanes = %v, want critical, bulk, standard", lanes)
+	}
+	if workers := dispatcher.Workers(); workers != 4 {
+		t.Errorf("workers = %d, want 2 critical, 1 bulk and 1 standard", workers)
+	}
+
+	// A campaign floods the bulk lane until it is full
+	queued := 0
+	for i := 0; ; i++ {
+		err := dispatcher.Enqueue(Notification{ID: "promo", UserID: "alice", Campaign: "spring-sale", Priority: priorityLow}, []string{channelEmail})
+		if errors.Is(err, errQueueFull) {
+			break
+		}
+		queued++
+		if i > 10 {
+			t.Fatal("the bulk lane never filled up")
+		}
+	}
+	if depth := dispatcher.LaneDepth(laneBulk); depth != 5 {
+		t.Errorf("bulk lane holds %d deliveries, want 5", depth)
+	}
+
+	// Security and everyday notifications are still accepted and delivered
+	for _, notification := range []Notification{
+		{ID: "sign-in", UserID: "alice", Category: categorySecurity},
+		{ID: "shipped", UserID: "alice", Priority: priorityNormal},
+	} {
+		if err := dispatcher.Enqueue(notification, []string{channelEmail}); err != nil {
+			t.Fatalf("enqueueing %s: %v", notification.ID, err)
+		}
+	}
+	delivered := map[string]bool{}
+	for len(delivered) < 2 {
+		select {
+		case id := <-sender.sent:
+			delivered[id] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivered %v behind the campaign, want sign-in and shipped", delivered)
+		}
+	}
+	if delivered["promo"] {
+		t.Error("a held campaign delivery was sent")
+	}
+
+	close(sender.release)
+	drain(t, dispatcher)
+	if len(sender.sent) != queued {
+		t.Errorf("sent %d campaign deliveries, want %d", len(sender.sent), queued)
+	}
+}
+
+func TestEnqueueQueuesEveryChannelOrNone(t *testing.T) {
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(5, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+
+	// Without workers nothing leaves the queue, so only whole notifications may fill it
+	var queued atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if dispatcher.Enqueue(Notification{ID: "n", UserID: "alice"}, []string{channelEmail, channelPush}) == nil {
+				queued.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if depth := dispatcher.QueueDepth(); queued.Load() != 2 || depth != 4 {
+		t.Errorf("queued %d notifications as %d deliveries, want 2 as 4", queued.Load(), depth)
+	}
+}
+
+// hangingSender never returns from its first send, as if the worker had died mid-send
+type hangingSender struct {
+	calls *atomic.Int32
+	hang  chan struct{}
+	sent  chan string
+}
+
+func (s hangingSender) Send(_ context.Context, notification Notification, _ recipient) error {
+	if s.calls.Add(1) == 1 {
+		<-s.hang
+		return nil
+	}
+	s.sent <- notification.ID
+	return nil
+}
+
+func TestDeliveryWatchdog(t *testing.T) {
+	cfg := defaultConfig()
+	for _, policy := range []string{watchdogRetry, watchdogDeadLetter} {
+		t.Run(policy, func(t *testing.T) {
+			dispatcher := newDispatcher(10, 3, 0, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+			sender := hangingSender{calls: new(atomic.Int32), hang: make(chan struct{}), sent: make(chan string, 10)}
+			defer close(sender.hang)
+			dispatcher.senders[channelEmail] = sender
+			dispatcher.Start(1)
+
+			if err := dispatcher.Enqueue(Notification{ID: "stuck", UserID: "alice"}, []string{channelEmail}); err != nil {
+				t.Fatal(err)
+			}
+			for deadline := time.Now().Add(5 * time.Second); dispatcher.InFlight() != 1; time.Sleep(time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("the delivery never went in flight")
+				}
+			}
+
+			watchdog := DeliveryWatchdogConfig{Deadline: time.Minute, Interval: time.Second, Policy: policy}
+			if reclaimed := dispatcher.reclaim(watchdog, time.Now()); reclaimed != 0 {
+				t.Fatalf("reclaimed %d deliveries before the deadline", reclaimed)
+			}
+			if reclaimed := dispatcher.reclaim(watchdog, time.Now().Add(2*time.Minute)); reclaimed != 1 {
+				t.Fatalf("reclaimed %d deliveries past the deadline, want 1", reclaimed)
+			}
+
+			// Another worker takes over the lane while the first is still stuck
+			if err := dispatcher.Enqueue(Notification{ID: "next", UserID: "alice"}, []string{channelEmail}); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]bool{"next": true}
+			if policy == watchdogRetry {
+				want["stuck"] = true
+			}
+			got := map[string]bool{}
+			for len(got) < len(want) {
+				select {
+				case id := <-sender.sent:
+					got[id] = true
+				case <-time.After(5 * time.Second):
+					t.Fatalf("delivered %v, want %v", got, want)
+				}
+			}
+			deadLetters := dispatcher.DeadLetters()
+			if policy == watchdogDeadLetter && (len(deadLetters) != 1 || deadLetters[0].Notification.ID != "stuck") {
+				t.Errorf("dead letters = %+v, want the stuck delivery", deadLetters)
+			}
+			if policy == watchdogRetry && len(deadLetters) != 0 {
+				t.Errorf("dead letters = %+v, want none", deadLetters)
+			}
+		})
+	}
+}
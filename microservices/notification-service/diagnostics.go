@@ -0,0 +1,85 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var startTime = time.Now()
+
+// blockProfileRate mirrors the runtime setting, which has no getter
+var blockProfileRate atomic.Int64
+
+// startDiagnosticsServer serves pprof and expvar on a separate internal listener
+//
+// The listener is only started when diagnostics are enabled, and is never
+// exposed through the Kubernetes Service; reach it with kubectl port-forward.
+func startDiagnosticsServer(cfg DiagnosticsConfig, dispatcher *Dispatcher) {
+	if !cfg.Enabled {
+		return
+	}
+
+	runtime.SetMutexProfileFraction(cfg.MutexFraction)
+	setBlockProfileRate(cfg.BlockRate)
+
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	expvar.Publish("uptime_seconds", expvar.Func(func() any { return time.Since(startTime).Seconds() }))
+	expvar.Publish("delivery_queue_depth", expvar.Func(func() any { return dispatcher.QueueDepth() }))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// Runtime toggles for contention profiling, e.g. POST /debug/profiling/mutex?rate=5
+	mux.HandleFunc("/debug/profiling/mutex", profilingToggle(func(rate int) int {
+		return runtime.SetMutexProfileFraction(rate)
+	}))
+	mux.HandleFunc("/debug/profiling/block", profilingToggle(setBlockProfileRate))
+
+	addr := cfg.Addr
+	go func() {
+		slog.Info("Diagnostics server running", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("diagnostics server stopped", "error", err)
+		}
+	}()
+}
+
+// setBlockProfileRate updates the block profile rate and returns the previous one
+func setBlockProfileRate(rate int) int {
+	runtime.SetBlockProfileRate(rate)
+	return int(blockProfileRate.Swap(int64(rate)))
+}
+
+// profilingToggle adapts a runtime profiling setter into an HTTP handler
+func profilingToggle(set func(rate int) int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rate, err := strconv.Atoi(r.URL.Query().Get("rate"))
+		if err != nil || rate < 0 {
+			http.Error(w, "rate must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+
+		previous := set(rate)
+		slog.Info("profiling rate changed", "path", r.URL.Path, "rate", rate)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success":true,"rate":%d,"previous":%d}`, rate, previous)
+	}
+}
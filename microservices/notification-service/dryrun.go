@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// What a dry run found would happen to a notification on a channel
+const (
+	plannedDeliver       = "deliver"
+	plannedSuppressed    = "suppressed"
+	plannedUndeliverable = "undeliverable"
+	// plannedUnresolved means the user's addresses could not be looked up
+	plannedUnresolved = "unresolved"
+)
+
+// errProfilesUnavailable means a dry run could not list the users to match against the segment
+var errProfilesUnavailable = errors.New("Listing users failed")
+
+// maxPreviewRecipients bounds the recipients listed by a segment or campaign dry run; counts cover every user
+const maxPreviewRecipients = 1000
+
+// plannedDelivery is what would happen to a notification on one channel
+type plannedDelivery struct {
+	Channel        string   `json:"channel"`
+	Outcome        string   `json:"outcome"`
+	Addresses      []string `json:"addresses,omitempty"`
+	UnsubscribeURL string   `json:"unsubscribe_url,omitempty"`
+	Reason         string   `json:"reason,omitempty"`
+}
+
+// sendPreview is what a send would deliver, found without sending or storing anything
+type sendPreview struct {
+	Notification Notification      `json:"notification"`
+	Deliveries   []plannedDelivery `json:"deliveries"`
+}
+
+// segmentPreview is what a segment send would do, found without sending or storing anything
+//
+// Users are matched and their opt-outs applied as in the send itself.
+// Skipped also counts users who unsubscribed from the type: the send would
+// queue their notifications only for delivery to suppress them. Addresses
+// are not looked up, so a user listed here may still be undeliverable.
+type segmentPreview struct {
+	Segment       string             `json:"segment"`
+	Type          string             `json:"type"`
+	Matched       int                `json:"matched"`
+	Sent          int                `json:"sent"`
+	Skipped       int                `json:"skipped"`
+	SentByVariant map[string]int     `json:"sent_by_variant,omitempty"`
+	Recipients    []previewRecipient `json:"recipients"`
+	// Truncated means only the first maxPreviewRecipients recipients are listed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// previewRecipient is a user a segment send would notify, and with what
+type previewRecipient struct {
+	UserID   string   `json:"user_id"`
+	Variant  string   `json:"variant,omitempty"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Channels []string `json:"channels"`
+	// SendAt is when the user's notification would go out, for sends at a local time
+	SendAt *time.Time `json:"send_at,omitempty"`
+}
+
+// campaignPreview is what a campaign would send, and when
+type campaignPreview struct {
+	Name        string         `json:"name"`
+	ScheduledAt time.Time      `json:"scheduled_at"`
+	Send        segmentPreview `json:"send"`
+}
+
+// Preview works out what delivering notification over channels would do, without delivering it
+//
+// It makes the same checks as a delivery worker, in the same order:
+// unsubscribes, the user's addresses, then suppressed addresses.
+func (d *Dispatcher) Preview(ctx context.Context, notification Notification, channels []string) []plannedDelivery {
+	planned := make([]plannedDelivery, 0, len(channels))
+	for _, channel := range channels {
+		delivery := plannedDelivery{Channel: channel, Outcome: plannedDeliver}
+		if d.unsubscribed(notification) {
+			delivery.Outcome, delivery.Reason = plannedSuppressed, "Unsubscribed from "+notification.Type
+			planned = append(planned, delivery)
+			continue
+		}
+
+		to, err := d.resolve(ctx, deliveryJob{Notification: notification, Channel: channel})
+		if err != nil {
+			delivery.Outcome, delivery.Reason = plannedUnresolved, err.Error()
+			if errors.Is(err, errNoRecipient) {
+				delivery.Outcome = plannedUndeliverable
+			}
+			planned = append(planned, delivery)
+			continue
+		}
+
+		delivery.Addresses = to.Addresses
+		if d.addresses != nil && (channel == channelEmail || channel == channelSMS) && len(to.Addresses) > 0 {
+			delivery.Addresses = nil
+			for _, address := range to.Addresses {
+				if !d.addresses.Suppressed(channel, address) {
+					delivery.Addresses = append(delivery.Addresses, address)
+				}
+			}
+			if len(delivery.Addresses) == 0 {
+				delivery.Outcome, delivery.Reason = plannedSuppressed, errAddressSuppressed.Error()
+			}
+		}
+		if unsubscribes := d.unsubscribes.Load(); unsubscribes != nil && channel == channelEmail && delivery.Outcome == plannedDeliver {
+			delivery.UnsubscribeURL = unsubscribes.Link(notification.UserID, notification.Type)
+		}
+		planned = append(planned, delivery)
+	}
+	return planned
+}
+
+// PreviewSend validates req and works out what sending it would deliver
+func (s *notificationService) PreviewSend(ctx context.Context, req SendNotificationRequest) (sendPreview, error) {
+	notification, channels, err := s.prepareSend(ctx, req)
+	if errors.Is(err, errTypeQuarantined) {
+		return sendPreview{}, fmt.Errorf("%w: %s, the notification would be quarantined", errUnknownType, req.Type)
+	}
+	if err != nil {
+		return sendPreview{}, err
+	}
+	return sendPreview{
+		Notification: notification,
+		Deliveries:   s.dispatcher.Preview(ctx, notification, channels),
+	}, nil
+}
+
+// Preview validates req and works out who sending it would notify, and on which channels
+func (s *segmentSender) Preview(ctx context.Context, req segmentSendRequest) (segmentPreview, error) {
+	req, err := s.validate(req)
+	if err != nil {
+		return segmentPreview{}, err
+	}
+	segment := s.segments[req.Segment]
+	users, err := s.profiles.Profiles(ctx)
+	if err != nil {
+		return segmentPreview{}, fmt.Errorf("%w: %v", errProfilesUnavailable, err)
+	}
+
+	preview := segmentPreview{Segment: req.Segment, Type: req.Type, Recipients: []previewRecipient{}}
+	if len(req.variants) > 0 {
+		preview.SentByVariant = make(map[string]int, len(req.variants))
+	}
+	now := time.Now()
+	for _, user := range users {
+		if !segment.matches(user, now) {
+			continue
+		}
+		preview.Matched++
+
+		notification := notificationFor(user, req, now)
+		channels := channelsFor(user, req)
+		if len(channels) == 0 || s.dispatcher.unsubscribed(notification) {
+			preview.Skipped++
+			continue
+		}
+		preview.Sent++
+		if notification.Variant != "" {
+			preview.SentByVariant[notification.Variant]++
+		}
+		if len(preview.Recipients) == maxPreviewRecipients {
+			preview.Truncated = true
+			continue
+		}
+		recipient := previewRecipient{
+			UserID:   user.ID,
+			Variant:  notification.Variant,
+			Title:    notification.Title,
+			Message:  notification.Message,
+			Channels: channels,
+		}
+		if req.LocalTime != "" {
+			at := req.sendAt(user, now)
+			recipient.SendAt = &at
+		}
+		preview.Recipients = append(preview.Recipients, recipient)
+	}
+	return preview, nil
+}
+
+// Preview validates req, renders its templates and works out what the campaign would send
+func (m *campaignManager) Preview(ctx context.Context, req campaignRequest) (campaignPreview, error) {
+	send, err := m.prepare(req)
+	if err != nil {
+		return campaignPreview{}, err
+	}
+	m.mu.Lock()
+	_, taken := m.engagement[req.Name]
+	m.mu.Unlock()
+	if taken {
+		return campaignPreview{}, errors.New("Campaign name is already used: " + req.Name)
+	}
+
+	scheduledAt := scheduleFor(req, time.Now())
+	send.startAt = scheduledAt
+	preview, err := m.sender.Preview(ctx, send)
+	if err != nil {
+		return campaignPreview{}, err
+	}
+	return campaignPreview{
+		Name:        req.Name,
+		ScheduledAt: scheduledAt,
+		Send:        preview,
+	}, nil
+}
+
+// respondPreview writes the result of a segment or campaign dry run
+func respondPreview(c *gin.Context, preview any, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, errUsersDisabled) || errors.Is(err, errProfilesUnavailable) {
+		status = http.StatusServiceUnavailable
+	}
+	if err != nil {
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    preview,
+	})
+}
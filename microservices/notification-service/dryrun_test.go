@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSendDryRun(t *testing.T) {
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, staticRecipients{"gone@example.com", "kept@example.com"})
+	addresses := newSuppressionList()
+	addresses.Add(suppressedAddress{Channel: channelEmail, Address: "gone@example.com", Reason: suppressedBounce, Since: time.Now()})
+	addresses.Add(suppressedAddress{Channel: channelSMS, Address: "gone@example.com", Reason: suppressedComplaint, Since: time.Now()})
+	addresses.Add(suppressedAddress{Channel: channelSMS, Address: "kept@example.com", Reason: suppressedComplaint, Since: time.Now()})
+	dispatcher.SuppressAddresses(addresses)
+	unsubscribes := newUnsubscriber(testUnsubscribeConfig)
+	unsubscribes.Suppress(context.Background(), "alice", "promo", time.Now())
+	dispatcher.SetUnsubscriber(unsubscribes)
+
+	store := newNotificationStore()
+	service := testService(store, newBroadcastStore(), systemClock{})
+	service.dispatcher = dispatcher
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAPIRoutes(r.Group("/api"), context.Background(), service, newTemplateStore(), cfg.Responses.StreamThreshold)
+	send := func(path, body string) (int, sendPreview) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		var resp struct {
+			Data sendPreview `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Data
+	}
+
+	code, preview := send("/api/send?dry_run=true", `{"user_id":"alice","type":"order_status","title":"Shipped","message":"On its way","channels":["email","sms"],"data":{"order_id":"1"}}`)
+	if code != http.StatusOK || preview.Notification.Title != "Shipped" || len(preview.Deliveries) != 2 {
+		t.Fatalf("dry run returned %d, %+v", code, preview)
+	}
+	if email := preview.Deliveries[0]; email.Outcome != plannedDeliver || strings.Join(email.Addresses, ",") != "kept@example.com" || email.UnsubscribeURL == "" {
+		t.Errorf("email delivery = %+v", email)
+	}
+	if sms := preview.Deliveries[1]; sms.Outcome != plannedSuppressed || len(sms.Addresses) != 0 {
+		t.Errorf("sms delivery = %+v", sms)
+	}
+
+	if _, preview = send("/api/send?dry_run=true", `{"user_id":"alice","type":"promo","title":"Sale","message":"Half off","channels":["push"]}`); len(preview.Deliveries) != 1 || preview.Deliveries[0].Outcome != plannedSuppressed {
+		t.Errorf("unsubscribed type deliveries = %+v", preview.Deliveries)
+	}
+	if code, _ := send("/api/send?dry_run=true", `{"user_id":"alice","type":"order_status","title":"Shipped","message":"On its way","data":{}}`); code != http.StatusBadRequest {
+		t.Errorf("dry run with invalid content returned %d, want 400", code)
+	}
+
+	if store.Len() != 0 || dispatcher.QueueDepth() != 0 {
+		t.Errorf("dry runs stored %d notifications and queued %d deliveries", store.Len(), dispatcher.QueueDepth())
+	}
+}
+
+func TestCampaignDryRun(t *testing.T) {
+	now := time.Now()
+	r, campaigns, store := campaignRouter(t, []userProfile{
+		{ID: "pro-1", Plan: planPro, CreatedAt: now},
+		{ID: "pro-2", Plan: planPro, CreatedAt: now, OptOuts: []string{channelEmail}},
+		{ID: "pro-3", Plan: planPro, CreatedAt: now},
+		{ID: "free-1", Plan: planFree, CreatedAt: now},
+	})
+	unsubscribes := newUnsubscriber(UnsubscribeConfig{})
+	unsubscribes.Suppress(context.Background(), "pro-3", "spring-sale", now)
+	campaigns.sender.dispatcher.SetUnsubscriber(unsubscribes)
+
+	body := `{"name":"spring-sale-2026","template":"spring-sale","data":{"discount":20,"until":"Sunday"},"segment":"pro"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/campaigns?dry_run=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var resp struct {
+		Data campaignPreview `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	preview := resp.Data.Send
+	if rec.Code != http.StatusOK || preview.Matched != 3 || preview.Sent != 1 || preview.Skipped != 2 {
+		t.Fatalf("dry run returned %d, %+v", rec.Code, preview)
+	}
+	if len(preview.Recipients) != 1 || preview.Recipients[0].UserID != "pro-1" || preview.Recipients[0].Title != "20% off" {
+		t.Errorf("recipients = %+v", preview.Recipients)
+	}
+
+	if len(campaigns.List()) != 0 || store.Len() != 0 {
+		t.Errorf("dry run created %d campaigns and %d notifications", len(campaigns.List()), store.Len())
+	}
+	// The dry run does not take the name, so the campaign can still be created
+	if code, _ := postCampaign(r, body); code != http.StatusCreated {
+		t.Errorf("creating the campaign after its dry run returned %d", code)
+	}
+}
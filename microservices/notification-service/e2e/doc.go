@@ -0,0 +1,9 @@
+// Package e2e holds end-to-end tests that drive a deployed notification
+// service together with the user service it resolves recipients through.
+//
+// The tests only build with the e2e tag. scripts/e2e-kind.sh deploys the
+// services to a kind cluster and runs them; against an existing deployment:
+//
+//	E2E_NOTIFICATION_URL=http://localhost:3003 E2E_USER_URL=http://localhost:3001 \
+//		go test -tags=e2e -count=1 ./e2e/...
+package e2e
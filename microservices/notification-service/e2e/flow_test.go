@@ -0,0 +1,108 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"platform/pkg/notificationclient"
+)
+
+// TestCreateDeliverRead follows a notification from the send API through
+// delivery to the user's stream, inbox and read state
+func TestCreateDeliverRead(t *testing.T) {
+	userID := registerUser(t)
+	client := newClient(userID)
+
+	delivered := map[string]string{"channel": "email", "status": "delivered"}
+	created := map[string]string{"type": "e2e"}
+	deliveredBefore := metricValue(t, "deliveries_total", delivered)
+	createdBefore := metricValue(t, "notifications_created_total", created)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*eventually)
+	defer cancel()
+
+	streamed := make(chan notificationclient.Notification, 8)
+	go client.WatchStream(ctx, userID, func(n notificationclient.Notification) { streamed <- n })
+	// Give the stream time to subscribe before the notification is created
+	time.Sleep(time.Second)
+
+	sent, err := client.Send(ctx, notificationclient.SendRequest{
+		CreateRequest: notificationclient.CreateRequest{
+			UserID:  userID,
+			Type:    "e2e",
+			Title:   "End to end",
+			Message: "Created by the e2e suite",
+		},
+		Channels: []string{"email"},
+	})
+	if err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+
+	select {
+	case n := <-streamed:
+		if n.ID != sent.ID {
+			t.Errorf("streamed notification %s, want %s", n.ID, sent.ID)
+		}
+	case <-time.After(eventually):
+		t.Error("notification was not streamed")
+	}
+
+	waitFor(t, "email delivery", func() bool {
+		return metricValue(t, "deliveries_total", delivered) >= deliveredBefore+1
+	})
+	if got := metricValue(t, "notifications_created_total", created); got != createdBefore+1 {
+		t.Errorf("notifications_created_total{type=e2e} = %v, want %v", got, createdBefore+1)
+	}
+
+	inbox, err := client.ListByUser(ctx, userID)
+	if err != nil {
+		t.Fatalf("listing: %v", err)
+	}
+	if len(inbox) != 1 || inbox[0].ID != sent.ID {
+		t.Fatalf("inbox = %+v, want only %s", inbox, sent.ID)
+	}
+
+	read, err := client.MarkRead(ctx, sent.ID)
+	if err != nil {
+		t.Fatalf("marking read: %v", err)
+	}
+	if read.Status != "read" || read.ReadAt == nil {
+		t.Errorf("after MarkRead status = %q, read_at = %v", read.Status, read.ReadAt)
+	}
+}
+
+// TestUnknownUserIsDeadLettered checks a notification for a user the user
+// service does not know is dead-lettered rather than retried
+func TestUnknownUserIsDeadLettered(t *testing.T) {
+	client := newClient("e2e")
+	undeliverable := map[string]string{"channel": "email", "status": "undeliverable"}
+	deadLettered := map[string]string{"channel": "email"}
+	undeliverableBefore := metricValue(t, "deliveries_total", undeliverable)
+	deadLetteredBefore := metricValue(t, "dead_letter_total", deadLettered)
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventually)
+	defer cancel()
+	_, err := client.Send(ctx, notificationclient.SendRequest{
+		CreateRequest: notificationclient.CreateRequest{
+			UserID:  "e2e-missing-" + time.Now().Format("150405.000000"),
+			Type:    "e2e",
+			Title:   "Nobody home",
+			Message: "This user does not exist",
+		},
+		Channels: []string{"email"},
+	})
+	if err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+
+	waitFor(t, "undeliverable delivery", func() bool {
+		return metricValue(t, "deliveries_total", undeliverable) >= undeliverableBefore+1
+	})
+	if got := metricValue(t, "dead_letter_total", deadLettered); got < deadLetteredBefore+1 {
+		t.Errorf("dead_letter_total{channel=email} = %v, want at least %v", got, deadLetteredBefore+1)
+	}
+}
@@ -0,0 +1,153 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+
+	"platform/pkg/notificationclient"
+	"platform/pkg/reqctx"
+)
+
+// eventually is how long asynchronous effects such as delivery may take
+const eventually = 30 * time.Second
+
+func env(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+var (
+	notificationURL = env("E2E_NOTIFICATION_URL", "http://localhost:3003")
+	userURL         = env("E2E_USER_URL", "http://localhost:3001")
+)
+
+func TestMain(m *testing.M) {
+	if err := waitReady(notificationURL+"/ready", 2*time.Minute); err != nil {
+		fmt.Fprintln(os.Stderr, "notification service not ready:", err)
+		os.Exit(1)
+	}
+	if err := waitReady(userURL+"/ready", 2*time.Minute); err != nil {
+		fmt.Fprintln(os.Stderr, "user service not ready:", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// waitReady polls url until it answers 200 or timeout passes
+func waitReady(url string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// newClient returns a client calling as userID, as the gateway does once it has verified their token
+func newClient(userID string) *notificationclient.Client {
+	opts := notificationclient.DefaultOptions()
+	opts.Hooks.OnRequest = func(req *http.Request) { req.Header.Set(reqctx.UserIDHeader, userID) }
+	return notificationclient.New(notificationURL, opts)
+}
+
+// registerUser creates a user with a unique email and returns its ID
+func registerUser(t *testing.T) string {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{
+		"name":  "E2E User",
+		"email": fmt.Sprintf("e2e-%d@example.com", time.Now().UnixNano()),
+	})
+	resp, err := http.Post(userURL+"/api/users", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("registering user: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("registering user: status %d", resp.StatusCode)
+	}
+
+	var created struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding user: %v", err)
+	}
+	return created.Data.ID
+}
+
+// metricValue returns the counter or gauge sample of name whose labels
+// include labels, or 0 when it has not been exported yet
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	resp, err := http.Get(notificationURL + "/metrics")
+	if err != nil {
+		t.Fatalf("scraping metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		t.Fatalf("parsing metrics: %v", err)
+	}
+	family, ok := families[name]
+	if !ok {
+		return 0
+	}
+
+	for _, metric := range family.GetMetric() {
+		matched := 0
+		for _, pair := range metric.GetLabel() {
+			if want, ok := labels[pair.GetName()]; ok && want == pair.GetValue() {
+				matched++
+			}
+		}
+		if matched != len(labels) {
+			continue
+		}
+		switch {
+		case metric.GetCounter() != nil:
+			return metric.GetCounter().GetValue()
+		case metric.GetGauge() != nil:
+			return metric.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+// waitFor polls condition until it holds or eventually passes
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), eventually)
+	defer cancel()
+	for !condition() {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s", what)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"platform/pkg/logging"
+	"platform/pkg/reqctx"
+)
+
+// version is the service release, overridable with -ldflags "-X main.version=..."
+var version = "1.0.0"
+
+// ErrorEvent describes a panic or server error raised while handling a request
+type ErrorEvent struct {
+	Message   string
+	Panic     bool
+	Stack     string
+	Method    string
+	Path      string
+	Route     string
+	Status    int
+	RequestID string
+	UserID    string
+}
+
+// ErrorReporter ships error events to an external error tracker
+type ErrorReporter interface {
+	Report(ctx context.Context, event ErrorEvent)
+}
+
+// logReporter is the fallback reporter that only writes events to the log
+type logReporter struct{}
+
+func (logReporter) Report(ctx context.Context, event ErrorEvent) {
+	attrs := []any{
+		"error", event.Message,
+		"status", event.Status,
+		"panic", event.Panic,
+	}
+	if event.Stack != "" {
+		attrs = append(attrs, "stack", event.Stack)
+	}
+	logging.FromContext(ctx).Error("request failed", attrs...)
+}
+
+// sentryReporter sends events to the Sentry store API in the background
+type sentryReporter struct {
+	storeURL    string
+	authHeader  string
+	environment string
+	client      *http.Client
+	events      chan map[string]any
+}
+
+// newErrorReporter returns a Sentry reporter when a DSN is configured, logging either way
+func newErrorReporter(cfg ErrorReportConfig) ErrorReporter {
+	if cfg.SentryDSN == "" {
+		return logReporter{}
+	}
+
+	sentry, err := newSentryReporter(cfg.SentryDSN, cfg.Environment)
+	if err != nil {
+		slog.Error("invalid SENTRY_DSN, falling back to log reporting", "error", err)
+		return logReporter{}
+	}
+	return multiReporter{logReporter{}, sentry}
+}
+
+func newSentryReporter(dsn, environment string) (*sentryReporter, error) {
+	parsed, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	projectID := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.User == nil || projectID == "" {
+		return nil, fmt.Errorf("dsn must look like https://<key>@<host>/<project>")
+	}
+
+	r := &sentryReporter{
+		storeURL: fmt.Sprintf("%s://%s/api/%s/store/", parsed.Scheme, parsed.Host, projectID),
+		authHeader: fmt.Sprintf("Sentry sentry_version=7, sentry_client=notification-service/%s, sentry_key=%s",
+			version, parsed.User.Username()),
+		environment: environment,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		events:      make(chan map[string]any, 100),
+	}
+	go r.run()
+	return r, nil
+}
+
+func (r *sentryReporter) Report(ctx context.Context, event ErrorEvent) {
+	exception := map[string]any{
+		"type":  "error",
+		"value": event.Message,
+	}
+	if event.Panic {
+		exception["type"] = "panic"
+		exception["mechanism"] = map[string]any{"type": "gin.recovery", "handled": false}
+	}
+
+	payload := map[string]any{
+		"event_id":    strings.ReplaceAll(uuid.New().String(), "-", ""),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"level":       "error",
+		"platform":    "go",
+		"logger":      "notification-service",
+		"release":     "notification-service@" + version,
+		"environment": r.environment,
+		"transaction": event.Method + " " + event.Route,
+		"tags": map[string]string{
+			"service":    "notification-service",
+			"version":    version,
+			"route":      event.Route,
+			"status":     fmt.Sprint(event.Status),
+			"request_id": event.RequestID,
+		},
+		"request": map[string]any{
+			"method": event.Method,
+			"url":    event.Path,
+		},
+		"exception": map[string]any{"values": []any{exception}},
+	}
+	if event.UserID != "" {
+		payload["user"] = map[string]string{"id": event.UserID}
+	}
+	if event.Stack != "" {
+		payload["extra"] = map[string]string{"stack": event.Stack}
+	}
+
+	// Never block the request path on the error tracker
+	select {
+	case r.events <- payload:
+	default:
+		logging.FromContext(ctx).Warn("sentry queue full, dropping event")
+	}
+}
+
+func (r *sentryReporter) run() {
+	for payload := range r.events {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			continue
+		}
+
+		req, err := http.NewRequest(http.MethodPost, r.storeURL, bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", r.authHeader)
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			slog.Warn("failed to report error to sentry", "error", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Warn("sentry rejected error event", "status", resp.StatusCode)
+		}
+	}
+}
+
+// multiReporter fans an event out to several reporters
+type multiReporter []ErrorReporter
+
+func (m multiReporter) Report(ctx context.Context, event ErrorEvent) {
+	for _, reporter := range m {
+		reporter.Report(ctx, event)
+	}
+}
+
+// Recovery middleware
+//
+// Converts handler panics into a 500 response and reports them, along with
+// other server errors, to the error reporter.
+func recoveryMiddleware(reporter ErrorReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			event := newErrorEvent(c, http.StatusInternalServerError)
+			event.Message = fmt.Sprint(recovered)
+			event.Panic = true
+			event.Stack = string(debug.Stack())
+			reporter.Report(c.Request.Context(), event)
+
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Internal server error",
+			})
+		}()
+
+		c.Next()
+
+		// 503 is how readiness and back-pressure are signalled, not a failure
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError && status != http.StatusServiceUnavailable {
+			event := newErrorEvent(c, status)
+			event.Message = http.StatusText(status)
+			if len(c.Errors) > 0 {
+				event.Message = c.Errors.String()
+			}
+			reporter.Report(c.Request.Context(), event)
+		}
+	}
+}
+
+func newErrorEvent(c *gin.Context, status int) ErrorEvent {
+	userID := c.Param("user_id")
+	if userID == "" {
+		userID = c.GetHeader("X-User-ID")
+	}
+
+	return ErrorEvent{
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Route:     c.FullPath(),
+		Status:    status,
+		RequestID: reqctx.CorrelationID(c.Request.Context()),
+		UserID:    userID,
+	}
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+
+	"notification-service/internal/featureflags"
+	"platform/pkg/logging"
+	"platform/pkg/reqctx"
+)
+
+// eventsConsumedTotal counts consumed platform events by outcome
+var eventsConsumedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "events_consumed_total",
+		Help: "Total number of platform events consumed by outcome",
+	},
+	[]string{"pipeline", "event", "outcome"},
+)
+
+// eventsDroppedTotal counts events discarded because their tenant was over
+// quota or their type throttled; they are not dead-lettered, so this is the
+// only record of them
+var eventsDroppedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "events_dropped_total",
+		Help: "Total number of platform events dropped by a quota or throttle, by reason",
+	},
+	[]string{"pipeline", "event", "reason"},
+)
+
+// eventConsumerLag is how far each pipeline's consumer is behind its topic
+var eventConsumerLag = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "event_consumer_lag_messages",
+		Help: "Messages the event consumer is behind its topic, as of the last fetch",
+	},
+	[]string{"pipeline"},
+)
+
+// consumerLag tracks how far behind each pipeline's consumer is
+type consumerLag struct {
+	mu        sync.Mutex
+	pipelines map[string]pipelineLag
+}
+
+// pipelineLag is one consumer's lag as of its last fetch
+type pipelineLag struct {
+	messages int64
+	// delay is how long ago the last fetched message was produced, while there is a lag
+	delay time.Duration
+}
+
+func newConsumerLag() *consumerLag {
+	return &consumerLag{pipelines: make(map[string]pipelineLag)}
+}
+
+// Observe records that pipeline fetched msg with messages still behind it
+func (l *consumerLag) Observe(pipeline string, messages int64, msg kafka.Message, now time.Time) {
+	lag := pipelineLag{messages: messages}
+	if messages > 0 && !msg.Time.IsZero() {
+		lag.delay = now.Sub(msg.Time)
+	}
+	eventConsumerLag.WithLabelValues(pipeline).Set(float64(messages))
+	l.mu.Lock()
+	l.pipelines[pipeline] = lag
+	l.mu.Unlock()
+}
+
+// Behind returns the first pipeline more than maxMessages or maxDelay behind; a zero limit is not checked
+func (l *consumerLag) Behind(maxMessages int, maxDelay time.Duration) (string, pipelineLag, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for pipeline, lag := range l.pipelines {
+		if (maxMessages > 0 && lag.messages > int64(maxMessages)) || (maxDelay > 0 && lag.delay > maxDelay) {
+			return pipeline, lag, true
+		}
+	}
+	return "", pipelineLag{}, false
+}
+
+// Pipelines returns every pipeline's lag as of its last fetch
+func (l *consumerLag) Pipelines() map[string]pipelineLag {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return maps.Clone(l.pipelines)
+}
+
+// platformEvent is the envelope services publish for events users are notified about
+type platformEvent struct {
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	UserID     string         `json:"user_id"`
+	TenantID   string         `json:"tenant_id,omitempty"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Data       map[string]any `json:"data"`
+}
+
+// errEventRejected marks events that can never produce a notification, so
+// they are committed instead of retried
+var errEventRejected = errors.New("event rejected")
+
+// eventPipeline describes how the events on one topic become notifications
+type eventPipeline struct {
+	Name   string
+	Config EventPipelineConfig
+	// Flag gates the pipeline per tenant while it is rolled out; empty means always on
+	Flag string
+	// RequiredData lists the data keys every event on the topic must carry
+	RequiredData []string
+}
+
+// eventPipelines returns the pipelines for order, payment and security events
+func eventPipelines(cfg EventsConfig) []eventPipeline {
+	return []eventPipeline{
+		{
+			Name:   "orders",
+			Config: cfg.Orders,
+			// Tenants not yet migrated are still notified by order-service over HTTP
+			Flag:         flagOrderEventConsumer,
+			RequiredData: []string{"order_id"},
+		},
+		{
+			Name:         "payments",
+			Config:       cfg.Payments,
+			RequiredData: []string{"payment_id", "amount", "currency"},
+		},
+		{
+			Name:   "security",
+			Config: cfg.Security,
+		},
+	}
+}
+
+// publishFunc hands a notification to the delivery pipeline, delivering over
+// the channels also in mandatory even if the user unsubscribed from its type
+type publishFunc func(ctx context.Context, notification Notification, channels, mandatory []string) error
+
+// eventHandler turns the events of one pipeline into templated notifications
+type eventHandler struct {
+	pipeline  eventPipeline
+	templates *templateStore
+	// content and types check event data against the JSON Schemas of the mapped notification type
+	content *contentValidator
+	types   *typeRegistry
+	flags   *featureflags.Client
+	// users supplies names and channel opt-outs; nil skips the lookup
+	users   *userDirectory
+	publish publishFunc
+
+	// seen remembers recent event IDs because Kafka delivers at least once
+	seen     map[string]struct{}
+	seenRing []string
+	seenNext int
+}
+
+// maxSeenEvents bounds the event IDs remembered for deduplication
+const maxSeenEvents = 10000
+
+func newEventHandler(pipeline eventPipeline, templates *templateStore, content *contentValidator, types *typeRegistry, flags *featureflags.Client, users *userDirectory, publish publishFunc) *eventHandler {
+	return &eventHandler{
+		pipeline:  pipeline,
+		templates: templates,
+		content:   content,
+		types:     types,
+		flags:     flags,
+		users:     users,
+		publish:   publish,
+		seen:      make(map[string]struct{}),
+		seenRing:  make([]string, maxSeenEvents),
+	}
+}
+
+// Handle processes one event, returning errEventRejected for events that should not be retried
+//
+// Handle is only called from the pipeline's consumer goroutine, so the dedup state needs no lock.
+func (h *eventHandler) Handle(ctx context.Context, event platformEvent) (string, error) {
+	if _, ok := h.seen[event.ID]; ok && event.ID != "" {
+		return "duplicate", nil
+	}
+
+	mapping, ok := h.pipeline.Config.Mappings[event.Type]
+	if !ok {
+		return "unmapped", nil
+	}
+	if event.UserID == "" {
+		return "", fmt.Errorf("%w: missing user_id", errEventRejected)
+	}
+	for _, key := range h.pipeline.RequiredData {
+		if _, ok := event.Data[key]; !ok {
+			return "", fmt.Errorf("%w: missing data.%s", errEventRejected, key)
+		}
+	}
+	kind, typeErr := h.types.Resolve(mapping.Type)
+	if errors.Is(typeErr, errUnknownType) {
+		return "", fmt.Errorf("%w: %w", errEventRejected, typeErr)
+	}
+	err := h.content.ValidateData(mapping.Type, event.Data)
+	if err == nil {
+		err = kind.ValidateData(event.Data)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errEventRejected, err)
+	}
+	if h.pipeline.Flag != "" && !h.flags.Enabled(h.pipeline.Flag, event.TenantID) {
+		return "disabled", nil
+	}
+
+	tmpl, err := h.templates.Get(mapping.Template)
+	if err != nil {
+		// Templates may still be syncing, so retry rather than drop the event
+		return "", err
+	}
+
+	data := make(map[string]any, len(event.Data)+2)
+	for key, value := range event.Data {
+		data[key] = value
+	}
+	data["user_id"] = event.UserID
+
+	channels := mapping.Channels
+	if h.users != nil {
+		contact, err := h.users.Contact(ctx, event.UserID)
+		if errors.Is(err, errNoRecipient) {
+			return "", fmt.Errorf("%w: %v", errEventRejected, err)
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, ok := data["name"]; !ok {
+			data["name"] = contact.Name
+		}
+		channels = h.channelsFor(ctx, mapping, contact)
+	} else {
+		channels = mergeChannels(channels, mapping.MandatoryChannels)
+	}
+	if len(channels) == 0 {
+		return "opted_out", nil
+	}
+
+	title, message, err := tmpl.Render(data)
+	if err != nil {
+		return "", fmt.Errorf("%w: rendering %s: %v", errEventRejected, mapping.Template, err)
+	}
+
+	// Tags were validated with the configuration
+	tags, _ := normalizeTags(mapping.Tags)
+	notification := Notification{
+		ID:              uuid.New().String(),
+		UserID:          event.UserID,
+		Type:            mapping.Type,
+		Title:           title,
+		Message:         message,
+		Status:          "sent",
+		Category:        mappingCategory(mapping),
+		Tags:            tags,
+		Tenant:          event.TenantID,
+		Template:        tmpl.Name,
+		TemplateVersion: tmpl.Version,
+		CorrelationID:   reqctx.CorrelationID(ctx),
+		TraceID:         reqctx.TraceID(ctx),
+		CreatedAt:       time.Now(),
+	}
+	kind.apply(&notification)
+	if typeErr != nil {
+		h.types.Quarantine(notification)
+		h.remember(event.ID)
+		return "quarantined", nil
+	}
+	if err := h.publish(ctx, notification, channels, mapping.MandatoryChannels); err != nil {
+		return "", err
+	}
+
+	h.remember(event.ID)
+	return "notified", nil
+}
+
+// mappingCategory is the category of mapping's notifications
+func mappingCategory(mapping EventMapping) string {
+	if mapping.Category == "" {
+		return categorySystem
+	}
+	return mapping.Category
+}
+
+// channelsFor drops the channels and categories contact opted out of, keeping the mandatory channels
+func (h *eventHandler) channelsFor(ctx context.Context, mapping EventMapping, contact userContact) []string {
+	categoryOptedOut := slices.Contains(contact.CategoryOptOuts, mappingCategory(mapping))
+	var channels []string
+	for _, channel := range mapping.Channels {
+		if !categoryOptedOut && !slices.Contains(contact.OptOuts, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	for _, channel := range mapping.MandatoryChannels {
+		if categoryOptedOut || slices.Contains(contact.OptOuts, channel) {
+			// Kept in the log as evidence for why an opt-out was overridden
+			logging.FromContext(ctx).Info("delivering mandatory notice over opted-out channel", "channel", channel, "user_id", contact.UserID)
+		}
+	}
+	return mergeChannels(channels, mapping.MandatoryChannels)
+}
+
+// mergeChannels appends the channels in extra that are not already in channels
+func mergeChannels(channels, extra []string) []string {
+	merged := append([]string(nil), channels...)
+	for _, channel := range extra {
+		if !slices.Contains(merged, channel) {
+			merged = append(merged, channel)
+		}
+	}
+	return merged
+}
+
+func (h *eventHandler) remember(id string) {
+	if id == "" {
+		return
+	}
+	if old := h.seenRing[h.seenNext]; old != "" {
+		delete(h.seen, old)
+	}
+	h.seenRing[h.seenNext] = id
+	h.seen[id] = struct{}{}
+	h.seenNext = (h.seenNext + 1) % len(h.seenRing)
+}
+
+// runEventConsumer consumes the handler's topic until ctx is cancelled
+//
+// Every replica joins the pipeline's consumer group, so Kafka spreads
+// partitions across them. Offsets are committed only once an event has
+// been handled or rejected, so a failed publish is redelivered after a
+// backoff. Each pipeline has its own group so one stalled topic does not
+// hold up the others.
+func runEventConsumer(ctx context.Context, cfg EventsConfig, handler *eventHandler, lag *consumerLag, chaos *chaosInjector) {
+	pipeline := handler.pipeline
+	logger := slog.Default().With("component", "events", "pipeline", pipeline.Name, "topic", pipeline.Config.Topic)
+	readerConfig := kafka.ReaderConfig{
+		Brokers: cfg.Brokers,
+		Topic:   pipeline.Config.Topic,
+		GroupID: cfg.GroupID + "-" + pipeline.Name,
+		MaxWait: time.Second,
+	}
+	reader := kafka.NewReader(readerConfig)
+	defer func() { reader.Close() }()
+
+	logger.Info("event consumer started", "brokers", cfg.Brokers, "group_id", readerConfig.GroupID)
+	backoff := time.Second
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("fetching event failed", "error", err)
+			if !sleepCtx(ctx, backoff) {
+				return
+			}
+			continue
+		}
+		lag.Observe(pipeline.Name, reader.Stats().Lag, msg, time.Now())
+
+		// Chaos mode may fail the event, or drop it as if the broker had lost it
+		handled := false
+		switch err := chaos.Inject(ctx, chaosEvents); {
+		case err != nil:
+			logger.Warn("handling event failed, will retry", "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		case chaos.Drop(chaosEvents):
+			logger.Warn("event dropped by chaos mode", "partition", msg.Partition, "offset", msg.Offset)
+			handled = true
+		default:
+			handled = handleEventMessage(ctx, logger, handler, msg)
+		}
+		if !handled {
+			// Leave the offset uncommitted and restart from it after a pause
+			if !sleepCtx(ctx, backoff) {
+				return
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			// Group readers cannot seek, so rejoin to resume from the committed offset
+			reader.Close()
+			reader = kafka.NewReader(readerConfig)
+			continue
+		}
+		backoff = time.Second
+
+		if err := reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			logger.Warn("committing event offset failed", "error", err)
+		}
+	}
+}
+
+// handleEventMessage handles msg, reporting false when it should be redelivered
+func handleEventMessage(ctx context.Context, logger *slog.Logger, handler *eventHandler, msg kafka.Message) bool {
+	pipeline := handler.pipeline.Name
+	event, err := decodeEvent(msg)
+	if err != nil {
+		eventsConsumedTotal.WithLabelValues(pipeline, "unknown", "invalid").Inc()
+		logger.Error("discarding malformed event", "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		return true
+	}
+
+	ctx = messageContext(ctx, msg, event)
+	logger = logger.With("request_id", reqctx.CorrelationID(ctx), "event_id", event.ID, "event", event.Type, "tenant_id", reqctx.Tenant(ctx))
+	ctx = logging.NewContext(ctx, logger)
+
+	// Unmapped event types share a label to keep the metric's cardinality bounded
+	label := event.Type
+	if _, ok := handler.pipeline.Config.Mappings[label]; !ok {
+		label = "other"
+	}
+
+	outcome, err := handler.Handle(ctx, event)
+	switch {
+	case errors.Is(err, errThrottled), errors.Is(err, errQuotaExceeded):
+		reason := "quota"
+		if errors.Is(err, errThrottled) {
+			reason = "throttled"
+		}
+		eventsConsumedTotal.WithLabelValues(pipeline, label, "dropped").Inc()
+		eventsDroppedTotal.WithLabelValues(pipeline, label, reason).Inc()
+		logger.Warn("dropping event", "reason", reason, "error", err)
+		return true
+	case errors.Is(err, errEventRejected):
+		eventsConsumedTotal.WithLabelValues(pipeline, label, "rejected").Inc()
+		logger.Error("discarding event", "error", err)
+		return true
+	case err != nil:
+		eventsConsumedTotal.WithLabelValues(pipeline, label, "failed").Inc()
+		logger.Warn("handling event failed, will retry", "error", err)
+		return false
+	}
+
+	eventsConsumedTotal.WithLabelValues(pipeline, label, outcome).Inc()
+	logger.Debug("event handled", "outcome", outcome)
+	return true
+}
+
+// messageContext returns a copy of ctx carrying the correlation ID and tenant of event
+//
+// Producers put the correlation ID of the request that caused the event in
+// the message headers, as services do on HTTP calls; events from producers
+// that do not are correlated by their own ID.
+func messageContext(ctx context.Context, msg kafka.Message, event platformEvent) context.Context {
+	id := messageHeader(msg, reqctx.CorrelationIDHeader)
+	if id == "" {
+		id = messageHeader(msg, reqctx.RequestIDHeader)
+	}
+	if id == "" {
+		id = event.ID
+	}
+	tenant := event.TenantID
+	if tenant == "" {
+		tenant = messageHeader(msg, reqctx.TenantHeader)
+	}
+	return reqctx.WithTenant(reqctx.WithCorrelationID(ctx, id), tenant)
+}
+
+// correlationHeaders returns the message headers carrying correlationID and tenant, empty ones left out
+func correlationHeaders(correlationID, tenant string) []kafka.Header {
+	var headers []kafka.Header
+	if correlationID != "" {
+		headers = append(headers, kafka.Header{Key: reqctx.CorrelationIDHeader, Value: []byte(correlationID)})
+	}
+	if tenant != "" {
+		headers = append(headers, kafka.Header{Key: reqctx.TenantHeader, Value: []byte(tenant)})
+	}
+	return headers
+}
+
+// messageHeader returns the value of msg's header called key, matched case-insensitively like HTTP headers
+func messageHeader(msg kafka.Message, key string) string {
+	for _, header := range msg.Headers {
+		if strings.EqualFold(header.Key, key) {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// sleepCtx waits for d, reporting false if ctx was cancelled first
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+
+	"platform/pkg/reqctx"
+)
+
+func TestMessageContext(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		headers       []kafka.Header
+		event         platformEvent
+		correlationID string
+		tenant        string
+	}{
+		{"headers", correlationHeaders("req-1", "acme"), platformEvent{ID: "e1"}, "req-1", "acme"},
+		{"request id header", []kafka.Header{{Key: "x-request-id", Value: []byte("req-2")}}, platformEvent{ID: "e1"}, "req-2", ""},
+		{"event tenant wins", correlationHeaders("req-1", "acme"), platformEvent{ID: "e1", TenantID: "globex"}, "req-1", "globex"},
+		{"no headers", nil, platformEvent{ID: "e1", TenantID: "globex"}, "e1", "globex"},
+	} {
+		ctx := messageContext(context.Background(), kafka.Message{Headers: tc.headers}, tc.event)
+		if got := reqctx.CorrelationID(ctx); got != tc.correlationID {
+			t.Errorf("%s: correlation ID = %q, want %q", tc.name, got, tc.correlationID)
+		}
+		if got := reqctx.Tenant(ctx); got != tc.tenant {
+			t.Errorf("%s: tenant = %q, want %q", tc.name, got, tc.tenant)
+		}
+	}
+	if headers := correlationHeaders("", ""); len(headers) != 0 {
+		t.Errorf("empty correlation gave headers %v", headers)
+	}
+}
+
+func TestHandleEventMessageCountsDrops(t *testing.T) {
+	cfg := defaultConfig()
+	templates := newTemplateStore()
+	if err := templates.Put(NotificationTemplate{Name: "payment-failed", Subject: "Payment failed", Body: "We could not process {{ .amount }}."}); err != nil {
+		t.Fatal(err)
+	}
+	types := newTypeRegistry(cfg.Types)
+	if err := types.Put(NotificationType{Name: "payment"}); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := json.Marshal(platformEvent{ID: "e1", Type: "payment.failed", UserID: "alice", Data: map[string]any{"payment_id": "p1", "amount": 59.98, "currency": "USD"}})
+
+	for _, tc := range []struct {
+		name    string
+		err     error
+		outcome string
+		reason  string
+	}{
+		{"over quota", &quotaError{tenant: "acme", limit: "notifications", period: "day", max: 10}, "dropped", "quota"},
+		{"throttled", &throttleError{notificationType: "payment"}, "dropped", "throttled"},
+		{"invalid", errInvalidData, "rejected", ""},
+	} {
+		// The publish step in main wraps its admission errors the same way
+		publish := func(context.Context, Notification, []string, []string) error {
+			return fmt.Errorf("%w: %w", errEventRejected, tc.err)
+		}
+		handler := newEventHandler(eventPipelines(cfg.Events)[1], templates, newContentValidator(cfg.Content), types, nil, nil, publish)
+		consumed := testutil.ToFloat64(eventsConsumedTotal.WithLabelValues("payments", "payment.failed", tc.outcome))
+		dropped := testutil.ToFloat64(eventsDroppedTotal.WithLabelValues("payments", "payment.failed", tc.reason))
+
+		if !handleEventMessage(context.Background(), slog.Default(), handler, kafka.Message{Value: value}) {
+			t.Errorf("%s: event left for redelivery", tc.name)
+		}
+		if got := testutil.ToFloat64(eventsConsumedTotal.WithLabelValues("payments", "payment.failed", tc.outcome)); got != consumed+1 {
+			t.Errorf("%s: %s events = %v, want %v", tc.name, tc.outcome, got, consumed+1)
+		}
+		wantDropped := dropped
+		if tc.reason != "" {
+			wantDropped++
+		}
+		if got := testutil.ToFloat64(eventsDroppedTotal.WithLabelValues("payments", "payment.failed", tc.reason)); got != wantDropped {
+			t.Errorf("%s: dropped events = %v, want %v", tc.name, got, wantDropped)
+		}
+	}
+}
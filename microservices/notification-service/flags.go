@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"notification-service/internal/featureflags"
+	"platform/pkg/reqctx"
+)
+
+// Feature flags for behaviors that are rolled out per tenant
+const (
+	flagDigestMode         = "digest_mode"
+	flagOrderEventConsumer = "order_event_consumer"
+)
+
+// newFeatureFlags builds the flag client, polling Unleash until ctx is cancelled when configured
+func newFeatureFlags(ctx context.Context, cfg FeatureFlagConfig, instance string) *featureflags.Client {
+	var remote featureflags.Provider
+	if cfg.Unleash.URL != "" {
+		unleash := featureflags.NewUnleash(cfg.Unleash, instance)
+		go unleash.Run(ctx)
+		remote = unleash
+	}
+	return featureflags.New(cfg.Flags, remote)
+}
+
+// registerFeatureFlagRoutes exposes flag decisions for a tenant, defaulting to the caller's
+func registerFeatureFlagRoutes(admin *gin.RouterGroup, flags *featureflags.Client) {
+	admin.GET("/feature-flags", func(c *gin.Context) {
+		tenant := c.DefaultQuery("tenant", reqctx.Tenant(c.Request.Context()))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"tenant":  tenant,
+			"flags":   flags.Evaluate(tenant),
+		})
+	})
+}
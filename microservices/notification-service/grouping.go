@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groupSummary describes the members of a collapsed group
+type groupSummary struct {
+	Key    string `json:"key"`
+	Count  int    `json:"count"`
+	Unread int    `json:"unread"`
+}
+
+// inboxEntry is a notification in a collapsed inbox
+//
+// Notifications sharing a group key appear once, as the latest of them with
+// Group set; notifications without a group key have no Group.
+type inboxEntry struct {
+	Notification
+	Group *groupSummary `json:"group,omitempty"`
+}
+
+// collapseGroups folds each group of list into its latest member
+//
+// list is in creation order and so is the result; a group takes the
+// position of its latest member.
+func collapseGroups(list []Notification) []inboxEntry {
+	groups := make(map[string]*groupSummary)
+	latest := make(map[string]int)
+	for i, notification := range list {
+		if notification.GroupKey == "" {
+			continue
+		}
+		group, ok := groups[notification.GroupKey]
+		if !ok {
+			group = &groupSummary{Key: notification.GroupKey}
+			groups[notification.GroupKey] = group
+		}
+		group.Count++
+		if notification.Status != "read" {
+			group.Unread++
+		}
+		latest[notification.GroupKey] = i
+	}
+
+	entries := make([]inboxEntry, 0, len(list))
+	for i, notification := range list {
+		key := notification.GroupKey
+		if key == "" {
+			entries = append(entries, inboxEntry{Notification: notification})
+			continue
+		}
+		if latest[key] == i {
+			entries = append(entries, inboxEntry{Notification: notification, Group: groups[key]})
+		}
+	}
+	return entries
+}
+
+// groupMembers returns the notifications of list in the group with the given key
+func groupMembers(list []Notification, key string) []Notification {
+	members := []Notification{}
+	for _, notification := range list {
+		if notification.GroupKey == key {
+			members = append(members, notification)
+		}
+	}
+	return members
+}
+
+// respondCollapsed writes list with its groups collapsed, in the usual envelope
+func respondCollapsed(c *gin.Context, list []Notification) {
+	entries := collapseGroups(list)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entries,
+		"count":   len(entries),
+	})
+}
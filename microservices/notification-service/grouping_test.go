@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCollapsedInbox(t *testing.T) {
+	grouped := func(id, key string) Notification {
+		n := testNotification(id, "alice")
+		n.GroupKey = key
+		return n
+	}
+	store := newNotificationStore(
+		grouped("c1", "comments:42"),
+		grouped("plain", ""),
+		grouped("c2", "comments:42"),
+		grouped("l1", "likes:42"),
+		grouped("c3", "comments:42"),
+	)
+	store.MarkRead("c1", time.Now())
+	r := listingRouter(t, store, 1000)
+
+	var collapsed struct {
+		Data  []inboxEntry `json:"data"`
+		Count int          `json:"count"`
+	}
+	if err := json.Unmarshal(getListing(r, "/api/users/alice/notifications?collapse=true", "").Body.Bytes(), &collapsed); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(notificationsOf(collapsed.Data)); got != "plain,l1,c3" || collapsed.Count != 3 {
+		t.Fatalf("collapsed inbox = %s (count %d), want plain,l1,c3", got, collapsed.Count)
+	}
+	if g := collapsed.Data[0].Group; g != nil {
+		t.Errorf("ungrouped notification has group %+v", g)
+	}
+	if g := collapsed.Data[2].Group; g == nil || *g != (groupSummary{Key: "comments:42", Count: 3, Unread: 2}) {
+		t.Errorf("comments group = %+v", g)
+	}
+
+	var uncollapsed listEnvelope
+	json.Unmarshal(getListing(r, "/api/users/alice/notifications", "").Body.Bytes(), &uncollapsed)
+	if len(uncollapsed.Data) != 5 {
+		t.Errorf("inbox without collapse has %d entries, want 5", len(uncollapsed.Data))
+	}
+
+	var members listEnvelope
+	json.Unmarshal(getListing(r, "/api/users/alice/notifications/groups/comments:42", "").Body.Bytes(), &members)
+	if ids(members.Data) != "c1,c2,c3" {
+		t.Errorf("group members = %s, want c1,c2,c3", ids(members.Data))
+	}
+	if code := getListing(r, "/api/users/bob/notifications/groups/comments:42", "").Code; code != http.StatusNotFound {
+		t.Errorf("another user's group returned %d, want 404", code)
+	}
+}
+
+func notificationsOf(entries []inboxEntry) []Notification {
+	list := make([]Notification, len(entries))
+	for i, entry := range entries {
+		list[i] = entry.Notification
+	}
+	return list
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/reqctx"
+)
+
+// notificationRoute is the route of a single notification; those below it act on it too
+const notificationRoute = "/api/notifications/:id"
+
+// registerAPIRoutes adds the notification API
+//
+// Streams end when shutdown is cancelled.
+func registerAPIRoutes(api *gin.RouterGroup, shutdown context.Context, service *notificationService, templates *templateStore, streamThreshold int) {
+	// List loaded templates
+	api.GET("/templates", listTemplatesHandler(templates))
+
+	// Get all notifications
+	api.GET("/notifications", listNotificationsHandler(service, streamThreshold))
+
+	// Get notification by ID
+	api.GET("/notifications/:id", getNotificationHandler(service))
+
+	// Create new notification
+	api.POST("/notifications", createNotificationHandler(service))
+
+	// Get notifications by user
+	api.GET("/users/:user_id/notifications", inboxHandler(service, streamThreshold))
+
+	// Counts of a user's notifications by category or type, with the latest of each
+	api.GET("/users/:user_id/notifications/summary", summaryHandler(service))
+
+	// List the members of a collapsed group
+	api.GET("/users/:user_id/notifications/groups/:group_key", groupMembersHandler(service))
+
+	// Stream new notifications for a user as server-sent events
+	api.GET("/users/:user_id/notifications/stream", streamHandler(shutdown, service.hub, service.presence, service.repo))
+
+	// Mark notification as read
+	api.PATCH("/notifications/:id/read", markReadHandler(service))
+
+	// Record a tap on one of a notification's actions
+	api.POST("/notifications/:id/actions/:action_id/click", clickHandler(service))
+
+	// Recent clicks on a notification's actions
+	api.GET("/notifications/:id/clicks", clickEventsHandler(service.clicks))
+
+	// Click-through per notification type and campaign
+	api.GET("/clicks/summary", clickSummaryHandler(service.clicks))
+
+	// Mark all of a user's notifications as read, except pinned ones
+	api.PATCH("/users/:user_id/notifications/read", markAllReadHandler(service))
+
+	// Pin a notification so it stays first in listings
+	api.PATCH("/notifications/:id/pin", pinHandler(service, true))
+
+	// Unpin a notification
+	api.PATCH("/notifications/:id/unpin", pinHandler(service, false))
+
+	// Hide a notification from the inbox for a while
+	api.POST("/notifications/:id/snooze", snoozeHandler(service))
+
+	// Delete notification
+	api.DELETE("/notifications/:id", deleteNotificationHandler(service))
+
+	// Send notification (webhook endpoint)
+	api.POST("/send", sendNotificationHandler(service))
+}
+
+// requireOwner answers 401 or 403 on the routes of a single notification
+// unless the caller the gateway verified owns it or is an admin
+//
+// It runs on the whole /api group, so routes below a notification's ID are
+// covered wherever they are registered. Unknown IDs are left to the handler.
+func requireOwner(repo Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route != notificationRoute && !strings.HasPrefix(route, notificationRoute+"/") {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		caller := reqctx.UserID(ctx)
+		if caller == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Authentication required",
+			})
+			return
+		}
+		if notification, ok := repo.Get(c.Param("id")); ok && notification.UserID != caller && !reqctx.IsAdmin(ctx) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error":   "Cannot access another user's notification",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// respondError writes the status and message matching an error from notificationService
+func respondError(c *gin.Context, err error) {
+	status, message := http.StatusBadRequest, err.Error()
+	body := gin.H{"success": false}
+	switch {
+	case errors.Is(err, errNotificationNotFound), errors.Is(err, errActionNotFound), errors.Is(err, errGroupNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errWriteBufferFull):
+		status, message = http.StatusServiceUnavailable, "Write buffer is full"
+	case errors.Is(err, errQueueFull):
+		status, message = http.StatusServiceUnavailable, "Delivery queue is full"
+	case errors.Is(err, errShuttingDown):
+		status, message = http.StatusServiceUnavailable, "Service is shutting down"
+	case errors.Is(err, errOverloaded):
+		status, message = http.StatusServiceUnavailable, errOverloaded.Error()
+		var overloaded *overloadError
+		if errors.As(err, &overloaded) {
+			c.Header("Retry-After", strconv.Itoa(int(overloaded.retryAfter.Seconds())))
+		}
+	case errors.Is(err, errThrottled):
+		status = http.StatusTooManyRequests
+		var throttled *throttleError
+		if errors.As(err, &throttled) {
+			c.Header("Retry-After", strconv.Itoa(int(throttled.retryAfter.Seconds())))
+		}
+	case errors.Is(err, errQuotaExceeded):
+		status = http.StatusTooManyRequests
+		var exceeded *quotaError
+		if errors.As(err, &exceeded) {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(exceeded.resetAt).Seconds())+1))
+			body["reset_at"] = exceeded.resetAt
+		}
+	case errors.Is(err, errInvalidData):
+		// Every problem is listed so a producer can fix its payload in one go
+		var invalid *dataError
+		if errors.As(err, &invalid) {
+			body["details"] = invalid.problems
+		}
+	}
+	body["error"] = message
+	c.JSON(status, body)
+}
+
+// respondNotification writes notification, or the error that stopped it being returned
+func respondNotification(c *gin.Context, status int, notification Notification, err error) {
+	if errors.Is(err, errTypeQuarantined) {
+		// Accepted but held for review rather than delivered
+		c.JSON(http.StatusAccepted, gin.H{
+			"success":     true,
+			"data":        notification,
+			"quarantined": true,
+		})
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(status, gin.H{
+		"success": true,
+		"data":    notification,
+	})
+}
+
+func listTemplatesHandler(templates *templateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list := templates.List()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	}
+}
+
+func listNotificationsHandler(service *notificationService, streamThreshold int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, ok := bindFilter(c)
+		if !ok {
+			return
+		}
+		respondList(c, streamThreshold, service.All(filter))
+	}
+}
+
+func getNotificationHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notification, err := service.Get(c.Param("id"))
+		respondNotification(c, http.StatusOK, notification, err)
+	}
+}
+
+func createNotificationHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateNotificationRequest
+		if err := bindCreateRequest(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		notification, err := service.Create(c.Request.Context(), req)
+		respondNotification(c, http.StatusCreated, notification, err)
+	}
+}
+
+// inboxHandler lists a user's inbox
+//
+// Polling clients revalidate with If-None-Match and usually get a bodiless
+// 304. Notifications sharing a group key fold into one entry with
+// ?collapse=true.
+func inboxHandler(service *notificationService, streamThreshold int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("user_id")
+		filter, ok := bindFilter(c)
+		if !ok {
+			return
+		}
+
+		etag := `W/"` + service.InboxVersion(userID) + `"`
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+		c.Writer.Header().Add("Vary", "Accept")
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		list := service.Inbox(c.Request.Context(), userID, filter, c.Query("include_snoozed") == "true")
+		if c.Query("collapse") == "true" {
+			respondCollapsed(c, list.all())
+			return
+		}
+		respondList(c, streamThreshold, list)
+	}
+}
+
+func groupMembersHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		members, err := service.GroupMembers(c.Param("user_id"), c.Param("group_key"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    members,
+			"count":   len(members),
+		})
+	}
+}
+
+func markReadHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notification, err := service.MarkRead(c.Param("id"))
+		respondNotification(c, http.StatusOK, notification, err)
+	}
+}
+
+func clickHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		event, err := service.Click(c.Param("id"), c.Param("action_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"success": true,
+			"data":    event,
+		})
+	}
+}
+
+func clickEventsHandler(clicks *clickTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events := clicks.Events(c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    events,
+			"count":   len(events),
+		})
+	}
+}
+
+func clickSummaryHandler(clicks *clickTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		summary := clicks.Summary()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    summary,
+			"count":   len(summary),
+		})
+	}
+}
+
+func markAllReadHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"count":   service.MarkAllRead(c.Request.Context(), c.Param("user_id")),
+		})
+	}
+}
+
+// pinHandler pins or unpins the notification named in the path
+func pinHandler(service *notificationService, pinned bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notification, err := service.SetPinned(c.Param("id"), pinned)
+		respondNotification(c, http.StatusOK, notification, err)
+	}
+}
+
+func snoozeHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req snoozeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		notification, err := service.Snooze(c.Param("id"), req)
+		respondNotification(c, http.StatusOK, notification, err)
+	}
+}
+
+func deleteNotificationHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notification, err := service.Delete(c.Param("id"))
+		respondNotification(c, http.StatusOK, notification, err)
+	}
+}
+
+func sendNotificationHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SendNotificationRequest
+		if err := bindSendRequest(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		// A dry run returns what would be delivered, and where, without sending or storing it
+		if c.Query("dry_run") == "true" {
+			preview, err := service.PreviewSend(c.Request.Context(), req)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data":    preview,
+			})
+			return
+		}
+		notification, err := service.Send(c.Request.Context(), req)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Notification sent successfully",
+			"data":    notification,
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"platform/pkg/health"
+)
+
+// queueProbe fails once the send queue is nearly full
+func queueProbe(dispatcher *Dispatcher) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if dispatcher.QueueDepth() >= dispatcher.QueueCapacity()*9/10 {
+			return errors.New("send queue is saturated")
+		}
+		return nil
+	}
+}
+
+// registerBacklogChecks fails readiness while the send queue or an event consumer is past the configured thresholds
+//
+// Consumers keep consuming while the pod is not ready, so it returns to
+// rotation once it has caught up.
+func registerBacklogChecks(probes *health.Registry, cfg HealthConfig, dispatcher *Dispatcher, lag *consumerLag) {
+	if limit := cfg.MaxQueueBacklog; limit > 0 {
+		probes.Register(health.Check{
+			Name:     "queue_backlog",
+			Critical: true,
+			Timeout:  cfg.CheckTimeout,
+			Probe: func(ctx context.Context) error {
+				if depth := dispatcher.QueueDepth(); depth > limit {
+					return fmt.Errorf("%d deliveries queued, more than %d", depth, limit)
+				}
+				return nil
+			},
+		})
+	}
+	if cfg.MaxConsumerLag > 0 || cfg.MaxConsumerDelay > 0 {
+		probes.Register(health.Check{
+			Name:     "consumer_lag",
+			Critical: true,
+			Timeout:  cfg.CheckTimeout,
+			Probe: func(ctx context.Context) error {
+				if pipeline, behind, ok := lag.Behind(cfg.MaxConsumerLag, cfg.MaxConsumerDelay); ok {
+					return fmt.Errorf("%s consumer is %d messages and %s behind", pipeline, behind.messages, behind.delay.Round(time.Second))
+				}
+				return nil
+			},
+		})
+	}
+}
+
+// registerDependencyChecks registers the checks for every configured dependency
+//
+// Backing services are declared by address (host:port) and are probed with a
+// TCP dial.
+func registerDependencyChecks(probes *health.Registry, cfg HealthConfig, dispatcher *Dispatcher) {
+	timeout := cfg.CheckTimeout
+
+	dependencies := []struct {
+		name     string
+		addr     string
+		critical bool
+	}{
+		{name: "database", addr: cfg.DatabaseAddr, critical: true},
+		{name: "cache", addr: cfg.CacheAddr, critical: false},
+		{name: "broker", addr: cfg.BrokerAddr, critical: true},
+	}
+	for _, dep := range dependencies {
+		if addr := dep.addr; addr != "" {
+			probes.Register(health.Check{
+				Name:     dep.name,
+				Critical: dep.critical,
+				Timeout:  timeout,
+				Probe:    health.TCPProbe(addr),
+			})
+		}
+	}
+
+	probes.Register(health.Check{
+		Name:     "send_queue",
+		Critical: false,
+		Timeout:  timeout,
+		Probe:    queueProbe(dispatcher),
+	})
+}
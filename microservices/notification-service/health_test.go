@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"platform/pkg/health"
+)
+
+func TestBacklogReadiness(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Health.MaxQueueBacklog = 2
+	cfg.Health.MaxConsumerLag = 100
+	cfg.Health.MaxConsumerDelay = time.Minute
+	// Without workers, sends stay queued
+	dispatcher := newDispatcher(10, 1, time.Second, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	lag := newConsumerLag()
+	probes := health.NewRegistry()
+	registerBacklogChecks(probes, cfg.Health, dispatcher, lag)
+	ready := func() (string, map[string]health.Result) { return probes.Run(context.Background()) }
+
+	now := time.Now()
+	lag.Observe("orders", 5, kafka.Message{Time: now.Add(-time.Second)}, now)
+	dispatcher.Enqueue(Notification{ID: "n1"}, []string{channelEmail, channelPush})
+	if status, results := ready(); status != health.StatusReady {
+		t.Fatalf("status = %s, %v; want ready within the thresholds", status, results)
+	}
+
+	dispatcher.Enqueue(Notification{ID: "n2"}, []string{channelEmail})
+	if status, results := ready(); status != health.StatusNotReady || results["queue_backlog"].Status != "down" {
+		t.Errorf("status with 3 queued = %s, %v; want not ready", status, results)
+	}
+
+	// A consumer minutes behind keeps the pod out of rotation even with few messages to go
+	dispatcher = newDispatcher(10, 1, time.Second, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	probes = health.NewRegistry()
+	registerBacklogChecks(probes, cfg.Health, dispatcher, lag)
+	lag.Observe("orders", 20, kafka.Message{Time: now.Add(-5 * time.Minute)}, now)
+	if status, results := ready(); status != health.StatusNotReady || results["consumer_lag"].Status != "down" {
+		t.Errorf("status with the consumer 5m behind = %s, %v; want not ready", status, results)
+	}
+	// Caught up, it is ready again
+	lag.Observe("orders", 0, kafka.Message{Time: now.Add(-5 * time.Minute)}, now)
+	if status, results := ready(); status != health.StatusReady {
+		t.Errorf("status once caught up = %s, %v", status, results)
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/logging"
+)
+
+// mimeCSV is the content type of CSV imports; the others are NDJSON
+const mimeCSV = "text/csv"
+
+// Statuses of an import
+const (
+	importRunning     = "running"
+	importCompleted   = "completed"
+	importInterrupted = "interrupted"
+)
+
+const (
+	// importBatchSize is how many rows are written, and committed, at a time
+	importBatchSize = 500
+	// importMaxErrors bounds the row errors an import keeps; Failed counts them all
+	importMaxErrors = 1000
+	// importMaxLine bounds one NDJSON row
+	importMaxLine = 1 << 20
+)
+
+// importNamespace derives the IDs of imported rows without one
+var importNamespace = uuid.MustParse("6f1c2a8e-4b7d-4e0a-9c35-d2a8f0e41b97")
+
+var importRowsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "import_rows_total",
+		Help: "Total number of bulk import rows by format and outcome",
+	},
+	[]string{"format", "outcome"},
+)
+
+var (
+	errImportRunning = errors.New("Import is already running")
+	errImportGap     = errors.New("Import would skip rows that were never committed")
+)
+
+// csvColumns are the columns a CSV import may have; the first four are required
+var csvColumns = []string{"user_id", "type", "title", "message", "id", "category", "tags", "campaign", "group_key", "image_url", "data", "created_at", "read_at"}
+
+// importRow is one notification to import
+//
+// CSV rows hold the same fields in columns of the same names, with tags
+// separated by | and data as a JSON object; actions can only be imported
+// from NDJSON.
+type importRow struct {
+	CreateNotificationRequest
+	// ID keeps the legacy system's ID; rows without one get an ID derived
+	// from the import and the row number
+	ID string `json:"id"`
+	// CreatedAt defaults to the time of the import
+	CreatedAt time.Time `json:"created_at"`
+	// ReadAt imports the notification as read
+	ReadAt *time.Time `json:"read_at"`
+}
+
+// rowError is a problem with one row, after which the import goes on
+type rowError struct{ error }
+
+// importRowError is why a row was not imported
+type importRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// importJob is the progress of one import, over every upload of its rows
+type importJob struct {
+	ID     string `json:"id"`
+	Format string `json:"format"`
+	Status string `json:"status"`
+	// Imported rows were created, Existing ones were already stored, e.g. by
+	// an earlier run of the import, and Failed ones did not validate
+	Imported int `json:"imported"`
+	Existing int `json:"existing"`
+	Failed   int `json:"failed"`
+	// Committed is the last row written; uploads resuming the import skip the rows up to it
+	Committed int              `json:"committed"`
+	Errors    []importRowError `json:"errors,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// importer creates notifications from bulk uploads, e.g. migrations from another system
+//
+// Uploads are read as they stream in and written in batches straight to
+// the repository, without delivering or publishing the notifications. Each
+// batch commits the rows read so far, so an interrupted upload is resumed by
+// uploading the rest under the same import ID, starting at any row after
+// the last committed one; rows up to it are skipped. Row IDs depend only on
+// the import and the row, so rows written but not committed, e.g. on a
+// replica that has restarted and forgotten the import, are recognised as
+// existing. Imports live in memory on the replica that ran them.
+type importer struct {
+	service *notificationService
+	repo    Repository
+
+	mu    sync.Mutex
+	jobs  map[string]*importJob
+	order []string
+}
+
+func newImporter(service *notificationService, repo Repository) *importer {
+	return &importer{service: service, repo: repo, jobs: make(map[string]*importJob)}
+}
+
+// Run imports the rows of body, the first of which is row firstRow of import id
+func (im *importer) Run(ctx context.Context, id, format string, firstRow int, body io.Reader) (importJob, error) {
+	job, err := im.start(id, format, firstRow)
+	if err != nil {
+		return importJob{}, err
+	}
+	logger := logging.FromContext(ctx).With("import_id", id, "format", format)
+
+	batch := importBatch{row: firstRow - 1, ids: make(map[string]bool)}
+	err = im.read(ctx, job, format, body, &batch)
+	im.commit(job, &batch)
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	job.Status = importCompleted
+	if err != nil {
+		job.Status, job.Error = importInterrupted, err.Error()
+		logger.Warn("import interrupted", "committed", job.Committed, "error", err)
+	} else {
+		logger.Info("import completed", "imported", job.Imported, "existing", job.Existing, "failed", job.Failed)
+	}
+	return job.snapshot(), err
+}
+
+// start registers the run of import id, checking it can go on from firstRow
+func (im *importer) start(id, format string, firstRow int) (*importJob, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	job, ok := im.jobs[id]
+	if !ok {
+		job = &importJob{ID: id, CreatedAt: time.Now()}
+		im.jobs[id] = job
+		im.order = append(im.order, id)
+	}
+	if job.Status == importRunning {
+		return nil, errImportRunning
+	}
+	if firstRow > job.Committed+1 {
+		return nil, fmt.Errorf("%w: rows up to %d are committed, so resume from row %d or earlier", errImportGap, job.Committed, job.Committed+1)
+	}
+	job.Format, job.Status, job.Error, job.UpdatedAt = format, importRunning, "", time.Now()
+	return job, nil
+}
+
+// importBatch holds the rows read since the last commit
+type importBatch struct {
+	// row is the number of the last row read
+	row           int
+	notifications []Notification
+	ids           map[string]bool
+	existing      int
+	errors        []importRowError
+}
+
+// read reads the rows of body into batch, committing every importBatchSize rows
+func (im *importer) read(ctx context.Context, job *importJob, format string, body io.Reader, batch *importBatch) error {
+	next := ndjsonRows(body)
+	if format == mimeCSV {
+		var err error
+		if next, err = csvRows(body); err != nil {
+			return err
+		}
+	}
+	for {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var bad rowError
+		if err != nil && !errors.As(err, &bad) {
+			return err
+		}
+		batch.row++
+		if batch.row <= job.Committed {
+			continue
+		}
+		if err == nil {
+			err = im.add(ctx, job.ID, row, batch)
+		}
+		if err != nil {
+			batch.errors = append(batch.errors, importRowError{Row: batch.row, Error: err.Error()})
+		}
+		if batch.row%importBatchSize == 0 {
+			im.commit(job, batch)
+		}
+	}
+}
+
+// add validates row and adds its notification to batch, unless it is already stored
+func (im *importer) add(ctx context.Context, importID string, row importRow, batch *importBatch) error {
+	if err := binding.Validator.ValidateStruct(&row.CreateNotificationRequest); err != nil {
+		return err
+	}
+	notification, err := im.service.newNotification(ctx, row.CreateNotificationRequest, "unread")
+	if errors.Is(err, errTypeQuarantined) {
+		return errors.New("Unknown notification type: " + row.Type)
+	}
+	if err != nil {
+		return err
+	}
+	notification.ID = row.ID
+	if notification.ID == "" {
+		notification.ID = uuid.NewSHA1(importNamespace, []byte(importID+"/"+strconv.Itoa(batch.row))).String()
+	}
+	if !row.CreatedAt.IsZero() {
+		notification.CreatedAt = row.CreatedAt
+	}
+	if row.ReadAt != nil {
+		notification.Status, notification.ReadAt = "read", row.ReadAt
+	}
+
+	if _, ok := im.repo.Get(notification.ID); ok || batch.ids[notification.ID] {
+		batch.existing++
+		return nil
+	}
+	batch.ids[notification.ID] = true
+	batch.notifications = append(batch.notifications, notification)
+	return nil
+}
+
+// commit writes batch's notifications and records its rows in job
+func (im *importer) commit(job *importJob, batch *importBatch) {
+	if len(batch.notifications) > 0 {
+		im.repo.AddBatch(batch.notifications)
+	}
+	importRowsTotal.WithLabelValues(job.Format, "imported").Add(float64(len(batch.notifications)))
+	importRowsTotal.WithLabelValues(job.Format, "existing").Add(float64(batch.existing))
+	importRowsTotal.WithLabelValues(job.Format, "failed").Add(float64(len(batch.errors)))
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	job.Imported += len(batch.notifications)
+	job.Existing += batch.existing
+	job.Failed += len(batch.errors)
+	if room := importMaxErrors - len(job.Errors); room > 0 {
+		job.Errors = append(job.Errors, batch.errors[:min(room, len(batch.errors))]...)
+	}
+	job.Committed = max(job.Committed, batch.row)
+	job.UpdatedAt = time.Now()
+
+	batch.notifications, batch.existing, batch.errors = nil, 0, nil
+	clear(batch.ids)
+}
+
+// Get returns the progress of the import with the given ID
+func (im *importer) Get(id string) (importJob, bool) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	job, ok := im.jobs[id]
+	if !ok {
+		return importJob{}, false
+	}
+	return job.snapshot(), true
+}
+
+// List returns every import, oldest first
+func (im *importer) List() []importJob {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	list := make([]importJob, len(im.order))
+	for i, id := range im.order {
+		list[i] = im.jobs[id].snapshot()
+	}
+	return list
+}
+
+// snapshot copies job, including its errors, for use outside the lock
+func (job *importJob) snapshot() importJob {
+	copied := *job
+	copied.Errors = slices.Clone(job.Errors)
+	return copied
+}
+
+// ndjsonRows reads one row per line of body; blank lines are not rows
+func ndjsonRows(body io.Reader) func() (importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), importMaxLine)
+	return func() (importRow, error) {
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var row importRow
+			if err := json.Unmarshal(line, &row); err != nil {
+				return importRow{}, rowError{err}
+			}
+			return row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return importRow{}, err
+		}
+		return importRow{}, io.EOF
+	}
+}
+
+// csvRows reads the header of body and returns a reader of the rows after it
+func csvRows(body io.Reader) (func() (importRow, error), error) {
+	r := csv.NewReader(body)
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("CSV import has no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Spreadsheet exports often start with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if !slices.Contains(csvColumns, name) {
+			return nil, errors.New("Unknown CSV column: " + name)
+		}
+		columns[name] = i
+	}
+	for _, name := range csvColumns[:4] {
+		if _, ok := columns[name]; !ok {
+			return nil, errors.New("Missing CSV column: " + name)
+		}
+	}
+	r.FieldsPerRecord = len(header)
+	r.ReuseRecord = true
+
+	return func() (importRow, error) {
+		record, err := r.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return importRow{}, rowError{err}
+		}
+		if err != nil {
+			return importRow{}, err
+		}
+		row, err := csvRow(columns, record)
+		if err != nil {
+			return importRow{}, rowError{err}
+		}
+		return row, nil
+	}, nil
+}
+
+// csvRow builds the row record holds in columns
+func csvRow(columns map[string]int, record []string) (importRow, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+	row := importRow{
+		CreateNotificationRequest: CreateNotificationRequest{
+			UserID:   field("user_id"),
+			Type:     field("type"),
+			Title:    field("title"),
+			Message:  field("message"),
+			Category: field("category"),
+			Campaign: field("campaign"),
+			GroupKey: field("group_key"),
+			ImageURL: field("image_url"),
+		},
+		ID: field("id"),
+	}
+	if tags := field("tags"); tags != "" {
+		row.Tags = strings.Split(tags, "|")
+	}
+	if data := field("data"); data != "" {
+		if err := json.Unmarshal([]byte(data), &row.Data); err != nil {
+			return row, fmt.Errorf("data: %w", err)
+		}
+	}
+	if createdAt := field("created_at"); createdAt != "" {
+		at, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return row, fmt.Errorf("created_at: %w", err)
+		}
+		row.CreatedAt = at
+	}
+	if readAt := field("read_at"); readAt != "" {
+		at, err := time.Parse(time.RFC3339, readAt)
+		if err != nil {
+			return row, fmt.Errorf("read_at: %w", err)
+		}
+		row.ReadAt = &at
+	}
+	return row, nil
+}
+
+// registerImportRoutes adds the admin endpoints for bulk imports
+func registerImportRoutes(admin *gin.RouterGroup, im *importer) {
+	// The upload is the body, as text/csv or application/x-ndjson. id names
+	// the import, to resume it; first_row numbers the body's first row when
+	// it holds only the rest of the import.
+	admin.POST("/imports", func(c *gin.Context) {
+		format := c.ContentType()
+		if format != mimeCSV && format != contentTypeNDJSON {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"success": false,
+				"error":   "Imports must be uploaded as " + mimeCSV + " or " + contentTypeNDJSON,
+			})
+			return
+		}
+		id := c.Query("id")
+		if id == "" {
+			id = uuid.New().String()
+		}
+		firstRow := 1
+		if value := c.Query("first_row"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"error":   "first_row must be a positive row number",
+				})
+				return
+			}
+			firstRow = n
+		}
+
+		job, err := im.Run(c.Request.Context(), id, format, firstRow, c.Request.Body)
+		if errors.Is(err, errImportRunning) || errors.Is(err, errImportGap) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("Import %s stopped after row %d: %v", job.ID, job.Committed, err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    job,
+		})
+	})
+
+	admin.GET("/imports", func(c *gin.Context) {
+		list := im.List()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	})
+
+	admin.GET("/imports/:id", func(c *gin.Context) {
+		if job, ok := im.Get(c.Param("id")); ok {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data":    job,
+			})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Import not found",
+		})
+	})
+}
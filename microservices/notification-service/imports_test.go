@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// brokenUpload is an upload cut off by a dropped connection after its content
+func brokenUpload(content string) io.Reader {
+	return io.MultiReader(strings.NewReader(content), iotest.ErrReader(errors.New("connection reset")))
+}
+
+func postImport(r *gin.Engine, query, contentType, body string) (*httptest.ResponseRecorder, importJob) {
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/imports"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var resp struct {
+		Data importJob `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp.Data
+}
+
+func TestImport(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	repo := newNotificationStore()
+	r := gin.New()
+	registerImportRoutes(r.Group("/api/admin"), newImporter(testService(repo, newBroadcastStore(), newFakeClock(now)), repo))
+
+	ndjson := strings.Join([]string{
+		`{"id":"legacy-1","user_id":"alice","type":"info","title":"Welcome","message":"Hi","created_at":"2024-01-02T03:04:05Z","read_at":"2024-01-03T00:00:00Z"}`,
+		`{"user_id":"alice","type":"info","message":"No title"}`,
+		``,
+		`{"user_id":`,
+		`{"user_id":"bob","type":"info","title":"Hello","message":"Hi","tags":["welcome"]}`,
+	}, "\n")
+	rec, job := postImport(r, "?id=legacy", contentTypeNDJSON, ndjson)
+	if rec.Code != http.StatusOK || job.Status != importCompleted || job.Imported != 2 || job.Failed != 2 || job.Committed != 4 {
+		t.Fatalf("NDJSON import returned %d: %s", rec.Code, rec.Body)
+	}
+	if len(job.Errors) != 2 || job.Errors[0].Row != 2 || job.Errors[1].Row != 3 {
+		t.Errorf("row errors = %+v, want rows 2 and 3", job.Errors)
+	}
+	legacy, ok := repo.Get("legacy-1")
+	if !ok || legacy.Status != "read" || !legacy.CreatedAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("legacy-1 = %+v, want it read and created in 2024", legacy)
+	}
+
+	csv := "\ufeffuser_id,type,title,message,tags\n" +
+		"carol,info,Tagged,Hi,a|b\n" +
+		"carol,info,Too,many,fields,here\n"
+	rec, job = postImport(r, "", mimeCSV, csv)
+	if rec.Code != http.StatusOK || job.Imported != 1 || job.Failed != 1 {
+		t.Fatalf("CSV import returned %d: %s", rec.Code, rec.Body)
+	}
+	if carol := repo.ListByUser("carol"); len(carol) != 1 || len(carol[0].Tags) != 2 {
+		t.Errorf("carol's notifications = %+v, want one with two tags", carol)
+	}
+
+	if rec, _ := postImport(r, "", mimeCSV, "user_id,colour\n"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown column returned %d", rec.Code)
+	}
+	if rec, _ := postImport(r, "", "application/json", "[]"); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("JSON upload returned %d", rec.Code)
+	}
+}
+
+func TestImportResume(t *testing.T) {
+	repo := newNotificationStore()
+	service := testService(repo, newBroadcastStore(), newFakeClock(time.Now()))
+	im := newImporter(service, repo)
+	var lines []string
+	for i := 0; i < 5; i++ {
+		lines = append(lines, `{"user_id":"alice","type":"info","title":"Migrated","message":"Hi"}`)
+	}
+	all := strings.Join(lines, "\n")
+
+	// The connection drops after three rows, which are committed
+	job, err := im.Run(context.Background(), "migration", contentTypeNDJSON, 1, brokenUpload(strings.Join(lines[:3], "\n")+"\n"))
+	if err == nil || job.Status != importInterrupted || job.Committed != 3 || repo.Len() != 3 {
+		t.Fatalf("interrupted import = %+v, %v; want 3 rows committed", job, err)
+	}
+
+	// Rows after a gap are refused; the rest of the upload resumes it
+	if _, err := im.Run(context.Background(), "migration", contentTypeNDJSON, 5, strings.NewReader(lines[4])); !errors.Is(err, errImportGap) {
+		t.Errorf("upload after a gap = %v, want errImportGap", err)
+	}
+	job, err = im.Run(context.Background(), "migration", contentTypeNDJSON, 4, strings.NewReader(strings.Join(lines[3:], "\n")))
+	if err != nil || job.Status != importCompleted || job.Imported != 5 || repo.Len() != 5 {
+		t.Fatalf("resumed import = %+v, %v; want 5 imported", job, err)
+	}
+
+	// Uploading everything again skips the committed rows
+	if job, _ = im.Run(context.Background(), "migration", contentTypeNDJSON, 1, strings.NewReader(all)); job.Imported != 5 || job.Existing != 0 || repo.Len() != 5 {
+		t.Errorf("re-uploaded import = %+v, want nothing new", job)
+	}
+
+	// A replica that never saw the import recognises its rows by ID
+	job, _ = newImporter(service, repo).Run(context.Background(), "migration", contentTypeNDJSON, 1, strings.NewReader(all))
+	if job.Imported != 0 || job.Existing != 5 || repo.Len() != 5 {
+		t.Errorf("import on another replica = %+v, want every row existing", job)
+	}
+}
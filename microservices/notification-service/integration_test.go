@@ -0,0 +1,165 @@
+//go:build integration
+
+// Integration tests run the service's components against real dependencies
+// started with testcontainers, so they need Docker but nothing else; they
+// skip when no Docker daemon is reachable:
+//
+//	go test -tags=integration -count=1 -run Integration .
+//
+// Today that is Kafka for the event consumer. Notifications are kept in
+// memory, so there is no database yet; a database-backed Repository adds a
+// test here that starts its database and runs testRepositoryContract on it.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/kafka"
+)
+
+// kafkaImage is the single-node KRaft broker the tests run against
+const kafkaImage = "confluentinc/confluent-local:7.5.0"
+
+// startKafka runs a broker for the test and returns its addresses
+func startKafka(t *testing.T) []string {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+	container, err := kafka.RunContainer(ctx, kafka.WithClusterID("notification-service"), testcontainers.WithImage(kafkaImage))
+	if err != nil {
+		t.Fatalf("starting Kafka: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(context.Background()); err != nil {
+			t.Logf("stopping Kafka: %v", err)
+		}
+	})
+	brokers, err := container.Brokers(ctx)
+	if err != nil {
+		t.Fatalf("Kafka brokers: %v", err)
+	}
+	return brokers
+}
+
+// produce writes values to topic, creating it if needed
+func produce(t *testing.T, brokers []string, topic string, values ...[]byte) {
+	t.Helper()
+	w := &kafkago.Writer{
+		Addr:                   kafkago.TCP(brokers...),
+		Topic:                  topic,
+		AllowAutoTopicCreation: true,
+		RequiredAcks:           kafkago.RequireAll,
+	}
+	defer w.Close()
+	messages := make([]kafkago.Message, len(values))
+	for i, value := range values {
+		messages[i] = kafkago.Message{Value: value}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// The first write can race the topic's creation
+	for {
+		err := w.WriteMessages(ctx, messages...)
+		if err == nil {
+			return
+		}
+		retry := errors.Is(err, kafkago.LeaderNotAvailable) || errors.Is(err, kafkago.UnknownTopicOrPartition)
+		if !retry || ctx.Err() != nil {
+			t.Fatalf("producing to %s: %v", topic, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func paymentEvent(t *testing.T, id, eventType string, data map[string]any) []byte {
+	t.Helper()
+	value, err := json.Marshal(platformEvent{ID: id, Type: eventType, UserID: "alice", OccurredAt: time.Now(), Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// TestIntegrationEventConsumer checks the payments consumer against a real
+// broker: events become notifications once each, events that can never
+// succeed are skipped, and a failed publish is redelivered from the
+// committed offset.
+func TestIntegrationEventConsumer(t *testing.T) {
+	brokers := startKafka(t)
+	cfg := defaultConfig().Events
+	cfg.Brokers = brokers
+	cfg.GroupID = "integration"
+
+	payment := map[string]any{"payment_id": "p1", "amount": "59.98", "currency": "USD", "name": "Alice"}
+	produce(t, brokers, cfg.Payments.Topic,
+		paymentEvent(t, "e1", "payment.failed", payment),
+		paymentEvent(t, "e1", "payment.failed", payment),
+		[]byte("{not json"),
+		paymentEvent(t, "e2", "payment.failed", map[string]any{"payment_id": "p2"}),
+		paymentEvent(t, "e3", "refund.issued", payment),
+	)
+
+	templates := newTemplateStore()
+	for _, tmpl := range []NotificationTemplate{
+		{Name: "payment-failed", Subject: "Payment failed", Body: "Hi {{ .name }}, we could not process {{ .amount }} {{ .currency }}."},
+		{Name: "refund-issued", Subject: "Refund issued", Body: "Hi {{ .name }}, we refunded {{ .amount }} {{ .currency }}."},
+	} {
+		if err := templates.Put(tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	published := make(chan Notification, 8)
+	var failFirst atomic.Bool
+	failFirst.Store(true)
+	publish := func(_ context.Context, notification Notification, _, _ []string) error {
+		if failFirst.CompareAndSwap(true, false) {
+			return errQueueFull
+		}
+		published <- notification
+		return nil
+	}
+	types := newTypeRegistry(defaultConfig().Types)
+	if err := types.Put(NotificationType{Name: "payment"}); err != nil {
+		t.Fatal(err)
+	}
+	handler := newEventHandler(eventPipelines(cfg)[1], templates, newContentValidator(defaultConfig().Content), types, nil, nil, publish)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runEventConsumer(ctx, cfg, handler, newConsumerLag(), nil)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	var got []Notification
+	timeout := time.After(90 * time.Second)
+	for len(got) < 2 {
+		select {
+		case notification := <-published:
+			got = append(got, notification)
+		case <-timeout:
+			t.Fatalf("published %d notifications, want 2", len(got))
+		}
+	}
+	if got[0].CorrelationID != "e1" || got[0].Title != "Payment failed" || got[1].CorrelationID != "e3" || got[1].Title != "Refund issued" {
+		t.Errorf("published %+v, want e1's then e3's notification", got)
+	}
+	// The duplicate, the malformed event and the incomplete one publish nothing
+	select {
+	case extra := <-published:
+		t.Errorf("unexpected notification %+v", extra)
+	case <-time.After(3 * time.Second):
+	}
+}
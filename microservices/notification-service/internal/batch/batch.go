@@ -0,0 +1,191 @@
+// Package batch is a write-behind buffer that groups individual writes
+//
+// Items are flushed together once MaxSize are waiting or Interval has passed
+// since the first of them arrived, whichever comes first. A failed flush is
+// retried with backoff and holds up later items, so when the store behind
+// the writer is slow or down the buffer fills and Add blocks its callers:
+// backpressure instead of unbounded memory.
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Add once Close has been called
+var ErrClosed = errors.New("batch writer closed")
+
+// Options configures a Writer
+type Options struct {
+	// MaxSize is the largest batch handed to the flush function
+	MaxSize int
+	// Interval bounds how long an item waits before being flushed
+	Interval time.Duration
+	// Buffer is how many items may wait for a flush before Add blocks
+	Buffer int
+
+	// OnFlush is called after every flush attempt
+	OnFlush func(size int, duration time.Duration, err error)
+}
+
+// FlushFunc writes a batch, e.g. as a single multi-row statement
+//
+// It must not keep items after returning.
+type FlushFunc[T any] func(ctx context.Context, items []T) error
+
+// Writer buffers items and flushes them in batches from one goroutine
+type Writer[T any] struct {
+	opts  Options
+	flush FlushFunc[T]
+	items chan T
+
+	mu     sync.RWMutex
+	closed bool
+	adding sync.WaitGroup
+
+	// abort gives up on blocked adds and failing flushes when Close runs out of time
+	abort     chan struct{}
+	abortOnce sync.Once
+	done      chan struct{}
+}
+
+// New starts a writer that hands batches to flush
+func New[T any](opts Options, flush FlushFunc[T]) *Writer[T] {
+	w := &Writer[T]{
+		opts:  opts,
+		flush: flush,
+		items: make(chan T, opts.Buffer),
+		abort: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Add queues item for the next batch, blocking while the buffer is full
+//
+// It returns ctx's error if ctx ends first, and ErrClosed after Close.
+func (w *Writer[T]) Add(ctx context.Context, item T) error {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return ErrClosed
+	}
+	w.adding.Add(1)
+	w.mu.RUnlock()
+	defer w.adding.Done()
+
+	select {
+	case w.items <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.abort:
+		return ErrClosed
+	}
+}
+
+// Len returns the number of items waiting for a flush
+func (w *Writer[T]) Len() int {
+	return len(w.items)
+}
+
+// Close stops accepting items and flushes those already buffered
+//
+// If ctx ends first, blocked adds fail, a failing flush stops retrying and
+// the remaining items are dropped.
+func (w *Writer[T]) Close(ctx context.Context) error {
+	w.mu.Lock()
+	alreadyClosed := w.closed
+	w.closed = true
+	w.mu.Unlock()
+
+	if !alreadyClosed {
+		// No send can be in flight once adding is done, so items can be closed
+		added := make(chan struct{})
+		go func() {
+			w.adding.Wait()
+			close(w.items)
+			close(added)
+		}()
+		select {
+		case <-added:
+		case <-ctx.Done():
+			w.abortOnce.Do(func() { close(w.abort) })
+		}
+	}
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.abortOnce.Do(func() { close(w.abort) })
+		<-w.done
+		return ctx.Err()
+	}
+}
+
+func (w *Writer[T]) run() {
+	defer close(w.done)
+
+	batch := make([]T, 0, w.opts.MaxSize)
+	timer := time.NewTimer(w.opts.Interval)
+	timer.Stop()
+	for {
+		select {
+		case item, ok := <-w.items:
+			if !ok {
+				w.write(batch)
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(w.opts.Interval)
+			}
+			batch = append(batch, item)
+			if len(batch) < w.opts.MaxSize {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		}
+		w.write(batch)
+		batch = batch[:0]
+	}
+}
+
+// write flushes batch, retrying until it succeeds or the writer is aborted
+func (w *Writer[T]) write(batch []T) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-w.abort:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := 50 * time.Millisecond
+	for {
+		start := time.Now()
+		err := w.flush(ctx, batch)
+		if w.opts.OnFlush != nil {
+			w.opts.OnFlush(len(batch), time.Since(start), err)
+		}
+		if err == nil {
+			return
+		}
+
+		select {
+		case <-w.abort:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 5*time.Second)
+	}
+}
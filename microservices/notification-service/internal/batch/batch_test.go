@@ -0,0 +1,161 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a flush function remembering every batch it was given
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]int
+	fail    int
+}
+
+func (r *recorder) flush(_ context.Context, items []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail > 0 {
+		r.fail--
+		return errors.New("store unavailable")
+	}
+	r.batches = append(r.batches, append([]int(nil), items...))
+	return nil
+}
+
+func (r *recorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sizes := make([]int, len(r.batches))
+	for i, b := range r.batches {
+		sizes[i] = len(b)
+	}
+	return sizes
+}
+
+func TestFlushesFullBatches(t *testing.T) {
+	rec := &recorder{}
+	w := New(Options{MaxSize: 3, Interval: time.Hour, Buffer: 10}, rec.flush)
+	for i := 0; i < 7; i++ {
+		if err := w.Add(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two full batches, then the remainder on Close
+	if got := rec.sizes(); len(got) != 3 || got[0] != 3 || got[1] != 3 || got[2] != 1 {
+		t.Errorf("batch sizes = %v, want [3 3 1]", got)
+	}
+}
+
+func TestFlushesPartialBatchAfterInterval(t *testing.T) {
+	rec := &recorder{}
+	w := New(Options{MaxSize: 100, Interval: 20 * time.Millisecond, Buffer: 10}, rec.flush)
+	defer w.Close(context.Background())
+
+	w.Add(context.Background(), 1)
+	w.Add(context.Background(), 2)
+	deadline := time.Now().Add(time.Second)
+	for len(rec.sizes()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("partial batch was not flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := rec.sizes(); got[0] != 2 {
+		t.Errorf("batch sizes = %v, want [2]", got)
+	}
+}
+
+func TestRetriesFailedFlush(t *testing.T) {
+	rec := &recorder{fail: 2}
+	attempts := 0
+	w := New(Options{MaxSize: 2, Interval: time.Hour, Buffer: 10, OnFlush: func(int, time.Duration, error) { attempts++ }}, rec.flush)
+	w.Add(context.Background(), 1)
+	w.Add(context.Background(), 2)
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 || len(rec.sizes()) != 1 {
+		t.Errorf("attempts = %d, batches = %v; want 3 attempts and one batch", attempts, rec.sizes())
+	}
+}
+
+func TestAddBlocksWhileBufferIsFull(t *testing.T) {
+	release := make(chan struct{})
+	w := New(Options{MaxSize: 1, Interval: time.Hour, Buffer: 1}, func(ctx context.Context, items []int) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	// The first item is stuck in flush, the second fills the buffer
+	w.Add(context.Background(), 1)
+	w.Add(context.Background(), 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Add(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Add on a full buffer = %v, want deadline exceeded", err)
+	}
+
+	close(release)
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(context.Background(), 4); !errors.Is(err, ErrClosed) {
+		t.Errorf("Add after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestCloseGivesUpWhenContextEnds(t *testing.T) {
+	w := New(Options{MaxSize: 1, Interval: time.Hour, Buffer: 1}, func(context.Context, []int) error {
+		return errors.New("store unavailable")
+	})
+	w.Add(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want deadline exceeded", err)
+	}
+}
+
+func TestConcurrentAdds(t *testing.T) {
+	rec := &recorder{}
+	w := New(Options{MaxSize: 16, Interval: time.Millisecond, Buffer: 8}, rec.flush)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := w.Add(context.Background(), g*100+i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, size := range rec.sizes() {
+		total += size
+	}
+	if total != 800 {
+		t.Errorf("flushed %d items, want 800", total)
+	}
+}
@@ -0,0 +1,110 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Consul resolves services through the Consul health API
+//
+// Results are cached for the TTL; if a refresh fails the last known
+// endpoints keep being used.
+type Consul struct {
+	addr   string
+	token  string
+	ttl    time.Duration
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]consulEntry
+}
+
+type consulEntry struct {
+	endpoints []string
+	expires   time.Time
+}
+
+// NewConsul returns a resolver for the Consul agent at addr, e.g. http://consul:8500
+func NewConsul(addr, token string, ttl time.Duration) *Consul {
+	return &Consul{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+		cache:  make(map[string]consulEntry),
+	}
+}
+
+func (c *Consul) Resolve(ctx context.Context, service string) ([]string, error) {
+	c.mu.Lock()
+	entry, cached := c.cache[service]
+	c.mu.Unlock()
+	if cached && time.Now().Before(entry.expires) {
+		return entry.endpoints, nil
+	}
+
+	endpoints, err := c.fetch(ctx, service)
+	if err != nil {
+		if cached {
+			return entry.endpoints, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache[service] = consulEntry{endpoints: endpoints, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return endpoints, nil
+}
+
+func (c *Consul) fetch(ctx context.Context, service string) ([]string, error) {
+	endpoint := fmt.Sprintf("%s/v1/health/service/%s?passing=true", c.addr, url.PathEscape(service))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: consul lookup failed: %w", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: consul returned %d", service, resp.StatusCode)
+	}
+
+	var instances []struct {
+		Node struct {
+			Address string `json:"Address"`
+		} `json:"Node"`
+		Service struct {
+			Address string `json:"Address"`
+			Port    int    `json:"Port"`
+		} `json:"Service"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
+		return nil, fmt.Errorf("%s: decoding consul response: %w", service, err)
+	}
+
+	endpoints := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		// An empty service address means the service listens on the node address
+		host := instance.Service.Address
+		if host == "" {
+			host = instance.Node.Address
+		}
+		endpoints = append(endpoints, "http://"+net.JoinHostPort(host, strconv.Itoa(instance.Service.Port)))
+	}
+	return endpoints, nil
+}
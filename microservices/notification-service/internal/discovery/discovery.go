@@ -0,0 +1,108 @@
+// Package discovery resolves sibling services to base URLs for outbound calls
+//
+// Kubernetes DNS is the default: the Service name resolves to a ClusterIP
+// that only routes to ready pods. Consul can be used instead, in which case
+// only instances with passing health checks are returned.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoEndpoints is returned when a service has no healthy instances
+var ErrNoEndpoints = errors.New("no healthy endpoints")
+
+// Resolver lists the healthy base URLs of a service
+type Resolver interface {
+	Resolve(ctx context.Context, service string) ([]string, error)
+}
+
+// Kubernetes resolves services through cluster DNS
+type Kubernetes struct {
+	// Namespace qualifies service names; empty means the caller's namespace
+	Namespace string
+	// Ports maps service names to their Service port
+	Ports map[string]int
+}
+
+func (k Kubernetes) Resolve(_ context.Context, service string) ([]string, error) {
+	port, ok := k.Ports[service]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown service", service)
+	}
+	host := service
+	if k.Namespace != "" {
+		host += "." + k.Namespace + ".svc"
+	}
+	return []string{fmt.Sprintf("http://%s:%d", host, port)}, nil
+}
+
+// Client picks an endpoint for each outbound call
+//
+// Endpoints are used round-robin. An endpoint reported as failing is skipped
+// for the ejection period unless no other endpoint is left.
+type Client struct {
+	resolver Resolver
+	ejection time.Duration
+	next     atomic.Uint64
+
+	mu      sync.Mutex
+	ejected map[string]time.Time
+}
+
+// NewClient returns a client resolving through resolver
+func NewClient(resolver Resolver, ejection time.Duration) *Client {
+	return &Client{
+		resolver: resolver,
+		ejection: ejection,
+		ejected:  make(map[string]time.Time),
+	}
+}
+
+// Endpoint returns the base URL to use for the next call to service
+func (c *Client) Endpoint(ctx context.Context, service string) (string, error) {
+	endpoints, err := c.resolver.Resolve(ctx, service)
+	if err != nil {
+		return "", err
+	}
+	if len(endpoints) == 0 {
+		return "", fmt.Errorf("%s: %w", service, ErrNoEndpoints)
+	}
+
+	healthy := c.healthy(endpoints)
+	if len(healthy) == 0 {
+		// Better to retry an ejected endpoint than fail outright
+		healthy = endpoints
+	}
+	return healthy[c.next.Add(1)%uint64(len(healthy))], nil
+}
+
+// ReportFailure ejects endpoint after a connection failure or 5xx response
+func (c *Client) ReportFailure(endpoint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ejected[endpoint] = time.Now().Add(c.ejection)
+}
+
+func (c *Client) healthy(endpoints []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if until, ok := c.ejected[endpoint]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(c.ejected, endpoint)
+		}
+		healthy = append(healthy, endpoint)
+	}
+	return healthy
+}
@@ -0,0 +1,110 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// static resolves every service to the same endpoints
+type static []string
+
+func (s static) Resolve(context.Context, string) ([]string, error) {
+	return s, nil
+}
+
+func TestKubernetes(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		k       Kubernetes
+		service string
+		want    string
+	}{
+		{"same namespace", Kubernetes{Ports: map[string]int{"user-service": 3001}}, "user-service", "http://user-service:3001"},
+		{"namespaced", Kubernetes{Namespace: "platform", Ports: map[string]int{"user-service": 3001}}, "user-service", "http://user-service.platform.svc:3001"},
+		{"unknown", Kubernetes{}, "order-service", ""},
+	} {
+		endpoints, err := tc.k.Resolve(context.Background(), tc.service)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s: resolved %v, want an error", tc.name, endpoints)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(endpoints, []string{tc.want}) {
+			t.Errorf("%s: Resolve = %v, %v; want %s", tc.name, endpoints, err, tc.want)
+		}
+	}
+}
+
+func TestClientEjectsFailingEndpoints(t *testing.T) {
+	c := NewClient(static{"http://a", "http://b"}, time.Hour)
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		endpoint, _ := c.Endpoint(context.Background(), "user-service")
+		seen[endpoint] = true
+	}
+	if !seen["http://a"] || !seen["http://b"] {
+		t.Errorf("round robin used %v, want both endpoints", seen)
+	}
+
+	c.ReportFailure("http://a")
+	for i := 0; i < 4; i++ {
+		if endpoint, _ := c.Endpoint(context.Background(), "user-service"); endpoint != "http://b" {
+			t.Fatalf("picked %s while it was ejected", endpoint)
+		}
+	}
+	// With every endpoint ejected, they are tried anyway
+	c.ReportFailure("http://b")
+	if endpoint, err := c.Endpoint(context.Background(), "user-service"); err != nil || endpoint == "" {
+		t.Errorf("Endpoint = %q, %v with every endpoint ejected", endpoint, err)
+	}
+
+	if _, err := NewClient(static{}, time.Hour).Endpoint(context.Background(), "user-service"); !errors.Is(err, ErrNoEndpoints) {
+		t.Errorf("Endpoint without instances returned %v, want ErrNoEndpoints", err)
+	}
+}
+
+func TestConsul(t *testing.T) {
+	var lookups atomic.Int32
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if fail.Load() || r.URL.Query().Get("passing") != "true" || r.Header.Get("X-Consul-Token") != "secret" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `[
+			{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"","Port":3001}},
+			{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"10.1.0.2","Port":3001}}
+		]`)
+	}))
+	defer srv.Close()
+
+	consul := NewConsul(srv.URL+"/", "secret", time.Hour)
+	want := []string{"http://10.0.0.1:3001", "http://10.1.0.2:3001"}
+	for i := 0; i < 2; i++ {
+		if endpoints, err := consul.Resolve(context.Background(), "user-service"); err != nil || !slices.Equal(endpoints, want) {
+			t.Fatalf("Resolve = %v, %v; want %v", endpoints, err, want)
+		}
+	}
+	if lookups.Load() != 1 {
+		t.Errorf("%d lookups, want the second answered from the cache", lookups.Load())
+	}
+
+	// Once the cache expires a failed lookup keeps the last endpoints
+	consul.ttl = 0
+	fail.Store(true)
+	if endpoints, err := consul.Resolve(context.Background(), "user-service"); err != nil || !slices.Equal(endpoints, want) {
+		t.Errorf("Resolve after a failed refresh = %v, %v; want the cached endpoints", endpoints, err)
+	}
+	if _, err := consul.Resolve(context.Background(), "order-service"); err == nil {
+		t.Error("a failed lookup of an uncached service succeeded")
+	}
+}
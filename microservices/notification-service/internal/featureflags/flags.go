@@ -0,0 +1,125 @@
+// Package featureflags decides which tenants see a gradually rolled out behavior
+//
+// Flags come from the service configuration (environment and ConfigMap) and
+// can optionally be overridden by a remote provider such as Unleash, so a
+// rollout can be widened or rolled back without redeploying.
+package featureflags
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync/atomic"
+)
+
+// Flag describes who a feature is enabled for
+type Flag struct {
+	// Rollout is the percentage (0-100) of tenants the flag is on for
+	Rollout int `yaml:"rollout"`
+	// Tenants always get the flag, regardless of Rollout
+	Tenants []string `yaml:"tenants"`
+	// ExcludedTenants never get the flag
+	ExcludedTenants []string `yaml:"excluded_tenants"`
+}
+
+// Enabled reports whether the flag named name is on for tenant
+func (f Flag) Enabled(name, tenant string) bool {
+	if contains(f.ExcludedTenants, tenant) {
+		return false
+	}
+	if contains(f.Tenants, tenant) {
+		return true
+	}
+	return bucket(name, tenant) < f.Rollout
+}
+
+// Provider is a source of flag decisions
+type Provider interface {
+	// Evaluate returns the decision for tenant; ok is false if the provider does not know the flag
+	Evaluate(name, tenant string) (enabled, ok bool)
+	// Names lists the flags the provider knows about
+	Names() []string
+}
+
+// Static is a Provider backed by a fixed set of flags
+type Static map[string]Flag
+
+func (s Static) Evaluate(name, tenant string) (bool, bool) {
+	flag, ok := s[name]
+	if !ok {
+		return false, false
+	}
+	return flag.Enabled(name, tenant), true
+}
+
+func (s Static) Names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Client evaluates flags against an optional remote provider, falling back to static flags
+//
+// Unknown flags are off.
+type Client struct {
+	static atomic.Pointer[Static]
+	remote Provider
+}
+
+// New returns a client for the given static flags; remote may be nil
+func New(flags Static, remote Provider) *Client {
+	c := &Client{remote: remote}
+	c.SetFlags(flags)
+	return c
+}
+
+// SetFlags replaces the static flags, e.g. after a configuration reload
+func (c *Client) SetFlags(flags Static) {
+	c.static.Store(&flags)
+}
+
+// Enabled reports whether the flag named name is on for tenant
+func (c *Client) Enabled(name, tenant string) bool {
+	if c.remote != nil {
+		if enabled, ok := c.remote.Evaluate(name, tenant); ok {
+			return enabled
+		}
+	}
+	enabled, _ := c.static.Load().Evaluate(name, tenant)
+	return enabled
+}
+
+// Evaluate returns the decision for every known flag for tenant
+func (c *Client) Evaluate(tenant string) map[string]bool {
+	names := c.static.Load().Names()
+	if c.remote != nil {
+		names = append(names, c.remote.Names()...)
+	}
+	sort.Strings(names)
+
+	decisions := make(map[string]bool, len(names))
+	for _, name := range names {
+		decisions[name] = c.Enabled(name, tenant)
+	}
+	return decisions
+}
+
+// bucket maps a tenant to a stable value in [0, 100) per flag, so widening a
+// rollout only ever adds tenants
+func bucket(name, tenant string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(tenant))
+	return int(h.Sum32() % 100)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package featureflags
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFlagEnabled(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		flag   Flag
+		tenant string
+		want   bool
+	}{
+		{"off", Flag{}, "acme", false},
+		{"full rollout", Flag{Rollout: 100}, "acme", true},
+		{"listed tenant", Flag{Tenants: []string{"acme"}}, "acme", true},
+		{"excluded tenant", Flag{Rollout: 100, Tenants: []string{"acme"}, ExcludedTenants: []string{"acme"}}, "acme", false},
+	} {
+		if got := tc.flag.Enabled("orders-via-kafka", tc.tenant); got != tc.want {
+			t.Errorf("%s: Enabled = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Widening a rollout only ever adds tenants
+	for i := 0; i < 200; i++ {
+		tenant := fmt.Sprintf("tenant-%d", i)
+		if (Flag{Rollout: 30}).Enabled("f", tenant) && !(Flag{Rollout: 60}).Enabled("f", tenant) {
+			t.Fatalf("%s lost the flag when the rollout widened", tenant)
+		}
+	}
+}
+
+// remote knows only the flags it is given
+type remote map[string]bool
+
+func (r remote) Evaluate(name, _ string) (bool, bool) {
+	enabled, ok := r[name]
+	return enabled, ok
+}
+
+func (r remote) Names() []string {
+	var names []string
+	for name := range r {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestClient(t *testing.T) {
+	c := New(Static{"static-on": {Rollout: 100}, "overridden": {Rollout: 100}}, remote{"overridden": false, "remote-on": true})
+	want := map[string]bool{"static-on": true, "overridden": false, "remote-on": true, "unknown": false}
+	for name, enabled := range want {
+		if got := c.Enabled(name, "acme"); got != enabled {
+			t.Errorf("Enabled(%s) = %v, want %v", name, got, enabled)
+		}
+	}
+	if decisions := c.Evaluate("acme"); len(decisions) != 3 || !decisions["remote-on"] || decisions["overridden"] {
+		t.Errorf("Evaluate = %v", decisions)
+	}
+
+	c.SetFlags(Static{})
+	if c.Enabled("static-on", "acme") {
+		t.Error("a flag removed by a reload is still on")
+	}
+}
+
+func TestUnleash(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/client/features" || r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"features":[
+			{"name":"disabled","enabled":false,"strategies":[{"name":"default"}]},
+			{"name":"everyone","enabled":true,"strategies":[]},
+			{"name":"listed","enabled":true,"strategies":[{"name":"userWithId","parameters":{"userIds":"globex, acme"}}]},
+			{"name":"rollout","enabled":true,"strategies":[{"name":"flexibleRollout","parameters":{"rollout":"100"}}]},
+			{"name":"unsupported","enabled":true,"strategies":[{"name":"remoteAddress"}]}
+		]}`)
+	}))
+	defer srv.Close()
+
+	u := NewUnleash(UnleashConfig{URL: srv.URL + "/api/", APIToken: "token"}, "pod-1")
+	if _, ok := u.Evaluate("everyone", "acme"); ok {
+		t.Error("flags were known before the first fetch")
+	}
+	if err := u.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"disabled": false, "everyone": true, "listed": true, "rollout": true, "unsupported": false} {
+		if enabled, ok := u.Evaluate(name, "acme"); !ok || enabled != want {
+			t.Errorf("Evaluate(%s) = %v, %v; want %v", name, enabled, ok, want)
+		}
+	}
+	if _, ok := u.Evaluate("missing", "acme"); ok {
+		t.Error("an unknown flag was known")
+	}
+
+	u.cfg.APIToken = "wrong"
+	if err := u.refresh(context.Background()); err == nil {
+		t.Error("a rejected fetch succeeded")
+	}
+	if enabled, ok := u.Evaluate("everyone", "acme"); !ok || !enabled {
+		t.Error("a failed fetch dropped the flags fetched before")
+	}
+}
@@ -0,0 +1,165 @@
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// UnleashConfig points the client at an Unleash server
+type UnleashConfig struct {
+	URL             string        `yaml:"url"`
+	APIToken        string        `yaml:"api_token"`
+	AppName         string        `yaml:"app_name"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// Unleash is a Provider that polls the Unleash client API
+//
+// The tenant ID is used as the Unleash user ID. Only the default,
+// flexibleRollout, gradualRolloutUserId and userWithId strategies are
+// supported; other strategies evaluate to off. Until the first successful
+// fetch it knows no flags, so the static configuration applies.
+type Unleash struct {
+	cfg      UnleashConfig
+	instance string
+	client   *http.Client
+	features atomic.Pointer[map[string]unleashFeature]
+}
+
+type unleashFeature struct {
+	Name       string            `json:"name"`
+	Enabled    bool              `json:"enabled"`
+	Strategies []unleashStrategy `json:"strategies"`
+}
+
+type unleashStrategy struct {
+	Name       string            `json:"name"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+// NewUnleash returns a provider for cfg; call Run to start polling
+func NewUnleash(cfg UnleashConfig, instance string) *Unleash {
+	u := &Unleash{
+		cfg:      cfg,
+		instance: instance,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	u.features.Store(&map[string]unleashFeature{})
+	return u
+}
+
+// Run refreshes the flags every RefreshInterval until ctx is cancelled
+func (u *Unleash) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := u.refresh(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to refresh feature flags from unleash", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (u *Unleash) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(u.cfg.URL, "/")+"/client/features", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", u.cfg.APIToken)
+	req.Header.Set("UNLEASH-APPNAME", u.cfg.AppName)
+	req.Header.Set("UNLEASH-INSTANCEID", u.instance)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unleash returned %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Features []unleashFeature `json:"features"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+
+	features := make(map[string]unleashFeature, len(body.Features))
+	for _, feature := range body.Features {
+		features[feature.Name] = feature
+	}
+	u.features.Store(&features)
+	return nil
+}
+
+func (u *Unleash) Evaluate(name, tenant string) (bool, bool) {
+	feature, ok := (*u.features.Load())[name]
+	if !ok {
+		return false, false
+	}
+	if !feature.Enabled {
+		return false, true
+	}
+	if len(feature.Strategies) == 0 {
+		return true, true
+	}
+	for _, strategy := range feature.Strategies {
+		if strategy.enabled(name, tenant) {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+func (u *Unleash) Names() []string {
+	features := *u.features.Load()
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (s unleashStrategy) enabled(name, tenant string) bool {
+	switch s.Name {
+	case "default":
+		return true
+	case "flexibleRollout", "gradualRolloutUserId":
+		rollout := s.Parameters["rollout"]
+		if rollout == "" {
+			rollout = s.Parameters["percentage"]
+		}
+		percentage, err := strconv.Atoi(rollout)
+		if err != nil {
+			return false
+		}
+		group := s.Parameters["groupId"]
+		if group == "" {
+			group = name
+		}
+		return bucket(group, tenant) < percentage
+	case "userWithId":
+		for _, id := range strings.Split(s.Parameters["userIds"], ",") {
+			if strings.TrimSpace(id) == tenant {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
@@ -0,0 +1,224 @@
+// Package httpclient is the shared client for outbound HTTP calls
+//
+// It bounds connect, header and per-attempt times, retries transient
+// failures with jittered backoff, and caps retries with a budget so a
+// struggling dependency is not hit with a retry storm. Every attempt is
+// tied to the request context, so work stops when the inbound request that
+// caused it goes away.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Options configures a Client
+type Options struct {
+	ConnectTimeout        time.Duration
+	ResponseHeaderTimeout time.Duration
+	// AttemptTimeout bounds a single attempt, including reading the body
+	AttemptTimeout time.Duration
+
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// RetryBudget is the fraction of requests that may be retried
+	RetryBudget float64
+
+	MaxConnsPerHost     int
+	MaxIdleConnsPerHost int
+
+	// Decorate is called on every outgoing request, e.g. to propagate request IDs
+	Decorate func(req *http.Request)
+}
+
+// DefaultOptions returns settings suitable for calls to sibling services
+func DefaultOptions() Options {
+	return Options{
+		ConnectTimeout:        2 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		AttemptTimeout:        10 * time.Second,
+		MaxAttempts:           3,
+		BaseBackoff:           100 * time.Millisecond,
+		MaxBackoff:            2 * time.Second,
+		RetryBudget:           0.2,
+		MaxConnsPerHost:       64,
+		MaxIdleConnsPerHost:   16,
+	}
+}
+
+// Client sends requests with timeouts, retries and a retry budget
+type Client struct {
+	http   *http.Client
+	opts   Options
+	budget *retryBudget
+}
+
+// New returns a client with its own connection pool
+func New(opts Options) *Client {
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+
+	return &Client{
+		http:   &http.Client{Transport: transport},
+		opts:   opts,
+		budget: newRetryBudget(opts.RetryBudget),
+	}
+}
+
+// Do sends req, retrying connection errors and 429/502/503/504 responses
+//
+// Only idempotent requests, or requests carrying an Idempotency-Key header,
+// are retried, and only if their body can be replayed.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	c.budget.deposit()
+	retryable := isIdempotent(req) && (req.Body == nil || req.GetBody != nil)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(req)
+
+		if attempt >= c.opts.MaxAttempts || !retryable || !shouldRetry(resp, err) ||
+			req.Context().Err() != nil || !c.budget.withdraw() {
+			return resp, err
+		}
+
+		wait := c.backoff(attempt)
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 && after <= c.opts.MaxBackoff {
+				wait = after
+			}
+			// Drain so the connection goes back to the pool
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), c.opts.AttemptTimeout)
+	attemptReq := req.Clone(ctx)
+	if c.opts.Decorate != nil {
+		c.opts.Decorate(attemptReq)
+	}
+
+	resp, err := c.http.Do(attemptReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The attempt deadline also covers reading the body
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns a full-jitter delay for the given attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := c.opts.BaseBackoff << (attempt - 1)
+	if ceiling <= 0 || ceiling > c.opts.MaxBackoff {
+		ceiling = c.opts.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// retryBudget allows retries up to a fraction of recent requests
+//
+// Every request deposits ratio tokens and every retry withdraws one, with a
+// small reserve so low-traffic callers can still retry.
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	tokens float64
+	max    float64
+}
+
+func newRetryBudget(ratio float64) *retryBudget {
+	return &retryBudget{ratio: ratio, tokens: 10, max: 10 + 100*ratio}
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.max)
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,110 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.BaseBackoff = time.Millisecond
+	opts.MaxBackoff = time.Millisecond
+	return opts
+}
+
+func TestDoRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		method   string
+		header   string
+		status   int
+		attempts int32
+	}{
+		{"get retried on 503", http.MethodGet, "", http.StatusServiceUnavailable, 3},
+		{"put retried on 429", http.MethodPut, "", http.StatusTooManyRequests, 3},
+		{"post not retried", http.MethodPost, "", http.StatusServiceUnavailable, 1},
+		{"post with an idempotency key retried", http.MethodPost, "key-1", http.StatusBadGateway, 3},
+		{"500 not retried", http.MethodGet, "", http.StatusInternalServerError, 1},
+	} {
+		var attempts atomic.Int32
+		var bodies []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			w.WriteHeader(tc.status)
+		}))
+		req, _ := http.NewRequest(tc.method, srv.URL, strings.NewReader("payload"))
+		if tc.header != "" {
+			req.Header.Set("Idempotency-Key", tc.header)
+		}
+		resp, err := New(testOptions()).Do(req)
+		srv.Close()
+		if err != nil || resp.StatusCode != tc.status {
+			t.Errorf("%s: Do = %v, %v; want the last %d", tc.name, resp, err, tc.status)
+			continue
+		}
+		resp.Body.Close()
+		if got := attempts.Load(); got != tc.attempts {
+			t.Errorf("%s: %d attempts, want %d", tc.name, got, tc.attempts)
+		}
+		for _, body := range bodies {
+			if body != "payload" {
+				t.Errorf("%s: an attempt sent body %q, want it replayed", tc.name, body)
+			}
+		}
+	}
+}
+
+func TestDoDecoratesAndStopsWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Request-ID") != "req-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.BaseBackoff, opts.MaxBackoff = time.Hour, time.Hour
+	opts.Decorate = func(req *http.Request) { req.Header.Set("X-Request-ID", "req-1") }
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := New(opts).Do(req); err != context.DeadlineExceeded {
+		t.Errorf("Do returned %v, want the deadline to end the backoff", err)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		ratio    float64
+		requests int
+		want     int
+	}{
+		// The reserve allows a burst of retries on little traffic
+		{"reserve", 0, 0, 10},
+		{"ratio", 0.5, 10, 15},
+		{"capped", 0.1, 1000, 20},
+	} {
+		b := newRetryBudget(tc.ratio)
+		for i := 0; i < tc.requests; i++ {
+			b.deposit()
+		}
+		retries := 0
+		for b.withdraw() {
+			retries++
+		}
+		if retries != tc.want {
+			t.Errorf("%s: budget allowed %d retries, want %d", tc.name, retries, tc.want)
+		}
+	}
+}
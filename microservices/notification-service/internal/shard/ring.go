@@ -0,0 +1,67 @@
+// Package shard maps keys to shards with a consistent-hash ring
+//
+// Each shard is placed on the ring at many virtual points, and a key belongs
+// to the first shard point at or after the key's hash. Adding or removing a
+// shard therefore only moves the keys between it and its neighbours, about
+// 1/n of them, instead of reshuffling everything as hash-mod-n would.
+package shard
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Ring assigns keys to a fixed set of shards; it is safe for concurrent use
+type Ring struct {
+	names  []string
+	points []uint64
+	// owners[i] is the index in names of the shard owning points[i]
+	owners []int
+}
+
+// New places each named shard at virtualNodes points on the ring
+//
+// Shards are identified by name, not position, so reordering the list does
+// not move any keys.
+func New(names []string, virtualNodes int) *Ring {
+	r := &Ring{names: append([]string(nil), names...)}
+	type point struct {
+		hash  uint64
+		owner int
+	}
+	points := make([]point, 0, len(names)*virtualNodes)
+	for owner, name := range names {
+		for v := 0; v < virtualNodes; v++ {
+			points = append(points, point{xxhash.Sum64String(name + "#" + strconv.Itoa(v)), owner})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+
+	r.points = make([]uint64, len(points))
+	r.owners = make([]int, len(points))
+	for i, p := range points {
+		r.points[i] = p.hash
+		r.owners[i] = p.owner
+	}
+	return r
+}
+
+// Locate returns the index of the shard owning key
+func (r *Ring) Locate(key string) int {
+	if len(r.names) == 1 {
+		return 0
+	}
+	hash := xxhash.Sum64String(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[i]
+}
+
+// Names returns the shard names in the order given to New
+func (r *Ring) Names() []string {
+	return r.names
+}
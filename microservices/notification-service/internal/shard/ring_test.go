@@ -0,0 +1,63 @@
+package shard
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestLocateIsStable(t *testing.T) {
+	a := New([]string{"shard-0", "shard-1", "shard-2"}, 64)
+	b := New([]string{"shard-2", "shard-0", "shard-1"}, 64)
+	for i := 0; i < 1000; i++ {
+		key := "user-" + strconv.Itoa(i)
+		if a.Names()[a.Locate(key)] != b.Names()[b.Locate(key)] {
+			t.Fatalf("%s moved when the shard list was reordered", key)
+		}
+	}
+}
+
+func TestKeysSpreadEvenly(t *testing.T) {
+	const keys = 30000
+	r := New([]string{"shard-0", "shard-1", "shard-2"}, 128)
+	counts := make([]int, 3)
+	for i := 0; i < keys; i++ {
+		counts[r.Locate("user-"+strconv.Itoa(i))]++
+	}
+	for i, count := range counts {
+		// Within 20% of a perfect third
+		if count < keys/3*8/10 || count > keys/3*12/10 {
+			t.Errorf("%s owns %d of %d keys", r.Names()[i], count, keys)
+		}
+	}
+}
+
+func TestAddingAShardMovesFewKeys(t *testing.T) {
+	const keys = 30000
+	before := New([]string{"shard-0", "shard-1", "shard-2"}, 128)
+	after := New([]string{"shard-0", "shard-1", "shard-2", "shard-3"}, 128)
+
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := "user-" + strconv.Itoa(i)
+		from, to := before.Names()[before.Locate(key)], after.Names()[after.Locate(key)]
+		if from != to {
+			if to != "shard-3" {
+				t.Fatalf("%s moved from %s to %s, not to the new shard", key, from, to)
+			}
+			moved++
+		}
+	}
+	// Ideally a quarter of the keys move
+	if moved < keys/4*7/10 || moved > keys/4*13/10 {
+		t.Errorf("%d of %d keys moved, want about a quarter", moved, keys)
+	}
+}
+
+func TestSingleShardOwnsEverything(t *testing.T) {
+	r := New([]string{"only"}, 8)
+	for i := 0; i < 100; i++ {
+		if r.Locate(strconv.Itoa(i)) != 0 {
+			t.Fatal("key located outside the only shard")
+		}
+	}
+}
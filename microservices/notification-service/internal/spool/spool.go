@@ -0,0 +1,191 @@
+// Package spool is a first-in first-out queue of batches kept on local disk
+//
+// Each batch is one JSON file in the queue's directory, named by a sequence
+// number so the files sort in the order they were pushed. A batch is written
+// to a temporary file, synced and then renamed into place, so a crash never
+// leaves a partial batch behind. Open picks up the batches left by a previous
+// process, so whatever was spooled survives a restart of the container.
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const suffix = ".json"
+
+// Batch is a spooled batch of items
+type Batch[T any] struct {
+	// Seq orders batches and identifies one to Remove
+	Seq uint64 `json:"-"`
+	// Queued is when the batch was pushed
+	Queued time.Time `json:"queued"`
+	Items  []T       `json:"items"`
+}
+
+// entry is what the queue keeps in memory about a spooled batch
+type entry struct {
+	seq    uint64
+	queued time.Time
+	items  int
+}
+
+// Queue is a disk-backed queue of batches; it is safe for concurrent use
+type Queue[T any] struct {
+	dir string
+
+	mu      sync.Mutex
+	entries []entry
+	next    uint64
+}
+
+// Open opens the queue in dir, creating the directory if needed
+func Open[T any](dir string) (*Queue[T], error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue[T]{dir: dir}
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, ".") {
+			// A temporary file of a push the previous process did not finish
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, suffix), 10, 64)
+		if err != nil || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		batch, err := q.read(seq)
+		if err != nil {
+			return nil, err
+		}
+		q.entries = append(q.entries, entry{seq: seq, queued: batch.Queued, items: len(batch.Items)})
+	}
+	sort.Slice(q.entries, func(i, j int) bool { return q.entries[i].seq < q.entries[j].seq })
+	if n := len(q.entries); n > 0 {
+		q.next = q.entries[n-1].seq + 1
+	}
+	return q, nil
+}
+
+func (q *Queue[T]) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, suffix))
+}
+
+func (q *Queue[T]) read(seq uint64) (Batch[T], error) {
+	data, err := os.ReadFile(q.path(seq))
+	if err != nil {
+		return Batch[T]{}, err
+	}
+	var batch Batch[T]
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return Batch[T]{}, fmt.Errorf("spooled batch %d: %w", seq, err)
+	}
+	batch.Seq = seq
+	return batch, nil
+}
+
+// Push appends items as one batch, returning once it is on disk
+func (q *Queue[T]) Push(items []T, queued time.Time) error {
+	data, err := json.Marshal(Batch[T]{Queued: queued, Items: items})
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	seq := q.next
+	tmp, err := os.CreateTemp(q.dir, ".push-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), q.path(seq)); err != nil {
+		return err
+	}
+	q.next++
+	q.entries = append(q.entries, entry{seq: seq, queued: queued, items: len(items)})
+	return nil
+}
+
+// Peek returns the oldest batch, and false when the queue is empty
+func (q *Queue[T]) Peek() (Batch[T], bool, error) {
+	q.mu.Lock()
+	if len(q.entries) == 0 {
+		q.mu.Unlock()
+		return Batch[T]{}, false, nil
+	}
+	seq := q.entries[0].seq
+	q.mu.Unlock()
+
+	batch, err := q.read(seq)
+	return batch, err == nil, err
+}
+
+// Remove deletes the batch seq, once it no longer needs to be kept
+func (q *Queue[T]) Remove(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, e := range q.entries {
+		if e.seq != seq {
+			continue
+		}
+		if err := os.Remove(q.path(seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		q.entries = append(q.entries[:i], q.entries[i+1:]...)
+		return nil
+	}
+	return nil
+}
+
+// Len returns the number of spooled batches
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Items returns the number of items across all spooled batches
+func (q *Queue[T]) Items() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := 0
+	for _, e := range q.entries {
+		items += e.items
+	}
+	return items
+}
+
+// Oldest returns when the oldest spooled batch was pushed, and false when the queue is empty
+func (q *Queue[T]) Oldest() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.entries) == 0 {
+		return time.Time{}, false
+	}
+	return q.entries[0].queued, true
+}
@@ -0,0 +1,66 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueueKeepsOrderAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	q, err := Open[int](dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, items := range [][]int{{1, 2}, {3}, {4, 5, 6}} {
+		if err := q.Push(items, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, ok, err := q.Peek()
+	if err != nil || !ok || !reflect.DeepEqual(first.Items, []int{1, 2}) {
+		t.Fatalf("Peek = %+v, %v, %v", first, ok, err)
+	}
+	if err := q.Remove(first.Seq); err != nil {
+		t.Fatal(err)
+	}
+
+	// A push the process did not finish leaves only a temporary file
+	os.WriteFile(filepath.Join(dir, ".push-123"), []byte(`{"items":[`), 0o600)
+
+	reopened, err := Open[int](dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 2 || reopened.Items() != 4 {
+		t.Errorf("reopened queue holds %d batches of %d items, want 2 of 4", reopened.Len(), reopened.Items())
+	}
+	if oldest, ok := reopened.Oldest(); !ok || !oldest.Equal(start.Add(time.Second)) {
+		t.Errorf("Oldest = %v, %v, want the second push", oldest, ok)
+	}
+	if err := reopened.Push([]int{7}, start.Add(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got [][]int
+	for {
+		batch, ok, err := reopened.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, batch.Items)
+		reopened.Remove(batch.Seq)
+	}
+	if want := [][]int{{3}, {4, 5, 6}, {7}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files left in an empty queue", len(files))
+	}
+}
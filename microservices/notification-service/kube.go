@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the pod's API credentials
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeClient is a minimal Kubernetes API client authenticated with the pod's service account
+type kubeClient struct {
+	baseURL   string
+	tokenPath string
+	namespace string
+	http      *http.Client
+}
+
+// kubeAPIError is a non-2xx response from the API server
+type kubeAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *kubeAPIError) Error() string {
+	return fmt.Sprintf("kubernetes API returned %d: %s", e.StatusCode, e.Message)
+}
+
+func isKubeStatus(err error, code int) bool {
+	var apiErr *kubeAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// objectMeta is the subset of Kubernetes object metadata the service uses
+type objectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Generation      int64             `json:"generation,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+
+// newInClusterKubeClient builds a client from the service account mounted into the pod
+func newInClusterKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running inside a Kubernetes cluster")
+	}
+
+	caCert, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("service account CA contains no certificates")
+	}
+
+	namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account namespace: %w", err)
+	}
+
+	return &kubeClient{
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		tokenPath: serviceAccountDir + "/token",
+		namespace: strings.TrimSpace(string(namespace)),
+		// No client timeout: callers bound requests through their context
+		http: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:     &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+				TLSHandshakeTimeout: 10 * time.Second,
+				MaxIdleConnsPerHost: 4,
+			},
+		},
+	}, nil
+}
+
+// do sends a JSON request to the API server and decodes the response into out
+func (k *kubeClient) do(ctx context.Context, method, path string, body, out any) error {
+	resp, err := k.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// request sends a JSON request and returns the raw response for 2xx statuses
+func (k *kubeClient) request(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, k.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound service account tokens rotate, so read the token for every request
+	token, err := os.ReadFile(k.tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		var status struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&status)
+		return nil, &kubeAPIError{StatusCode: resp.StatusCode, Message: status.Message}
+	}
+	return resp, nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// microTimeLayout is the serialization of metav1.MicroTime used by Lease
+const microTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+var leaderElectionIsLeader = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "leader_election_is_leader",
+		Help: "Whether this replica currently holds the leader lease (1) or not (0)",
+	},
+	[]string{"lease"},
+)
+
+// lease mirrors the coordination.k8s.io/v1 Lease resource
+type lease struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       leaseSpec  `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// errNotLeader rejects work that only the replica holding the lease may start
+var errNotLeader = errors.New("This replica is not the leader; retry to reach the leader")
+
+// singletonJob is a background worker that must run on exactly one replica
+type singletonJob struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// LeaderElector runs singleton background jobs only while holding a Kubernetes Lease
+type LeaderElector struct {
+	cfg    LeaderElectionConfig
+	client *kubeClient
+
+	mu     sync.Mutex
+	jobs   []singletonJob
+	term   *leaderTerm
+	leader atomic.Bool
+
+	// Expiry is judged against when this replica last saw the lease change,
+	// not the holder's timestamps, so clock skew between nodes is harmless.
+	observedRecord string
+	observedTime   time.Time
+}
+
+func newLeaderElector(cfg LeaderElectionConfig) *LeaderElector {
+	e := &LeaderElector{cfg: cfg}
+	if !cfg.Enabled {
+		return e
+	}
+
+	client, err := newInClusterKubeClient()
+	if err != nil {
+		slog.Warn("leader election disabled, running singleton jobs locally", "error", err)
+		e.cfg.Enabled = false
+		return e
+	}
+	if e.cfg.Namespace == "" {
+		e.cfg.Namespace = client.namespace
+	}
+	e.client = client
+	return e
+}
+
+// leaderTerm is the jobs running while this replica holds the lease
+type leaderTerm struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+func (t *leaderTerm) start(job singletonJob) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		slog.Info("starting singleton job", "job", job.name)
+		job.run(t.ctx)
+		slog.Info("stopped singleton job", "job", job.name)
+	}()
+}
+
+// AddJob registers a singleton job; jobs must return when their context is cancelled
+//
+// A job added while this replica leads starts right away.
+func (e *LeaderElector) AddJob(name string, run func(ctx context.Context)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	job := singletonJob{name: name, run: run}
+	e.jobs = append(e.jobs, job)
+	if e.term != nil {
+		e.term.start(job)
+	}
+}
+
+// Run campaigns for leadership until ctx is cancelled
+//
+// Without leader election (local development, single replica) this replica
+// always considers itself the leader.
+func (e *LeaderElector) Run(ctx context.Context) {
+	e.setLeader(false)
+
+	if !e.cfg.Enabled {
+		e.setLeader(true)
+		e.runJobs(ctx)
+		e.setLeader(false)
+		return
+	}
+
+	for {
+		if !e.acquire(ctx) {
+			return
+		}
+
+		slog.Info("acquired leader lease", "lease", e.cfg.LeaseName, "identity", e.cfg.Identity)
+		e.setLeader(true)
+
+		leaderCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			e.runJobs(leaderCtx)
+			close(done)
+		}()
+
+		e.renew(leaderCtx)
+		e.setLeader(false)
+		cancel()
+		<-done
+
+		if ctx.Err() != nil {
+			e.release()
+			return
+		}
+		slog.Warn("lost leader lease", "lease", e.cfg.LeaseName, "identity", e.cfg.Identity)
+	}
+}
+
+// IsLeader reports whether this replica currently holds the lease
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+func (e *LeaderElector) setLeader(leader bool) {
+	e.leader.Store(leader)
+	value := 0.0
+	if leader {
+		value = 1
+	}
+	leaderElectionIsLeader.WithLabelValues(e.cfg.LeaseName).Set(value)
+}
+
+// runJobs runs every registered job, and those added meanwhile, until ctx is cancelled and they have returned
+func (e *LeaderElector) runJobs(ctx context.Context) {
+	term := &leaderTerm{ctx: ctx}
+	e.mu.Lock()
+	e.term = term
+	for _, job := range e.jobs {
+		term.start(job)
+	}
+	e.mu.Unlock()
+
+	<-ctx.Done()
+	e.mu.Lock()
+	e.term = nil
+	e.mu.Unlock()
+	term.wg.Wait()
+}
+
+// leaderContext hands work started on demand, such as segment sends, the
+// context of the current leadership term, so that it only starts on the
+// leader and stops when the lease is lost
+type leaderContext struct {
+	mu  sync.Mutex
+	ctx context.Context
+}
+
+// Run holds ctx as the current term until it is cancelled; it is registered with AddJob
+func (l *leaderContext) Run(ctx context.Context) {
+	l.set(ctx)
+	<-ctx.Done()
+	l.set(nil)
+}
+
+func (l *leaderContext) set(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ctx = ctx
+}
+
+// Get returns the context of the current term, or errNotLeader while this replica does not lead
+func (l *leaderContext) Get() (context.Context, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx == nil || l.ctx.Err() != nil {
+		return nil, errNotLeader
+	}
+	return l.ctx, nil
+}
+
+// acquire retries until the lease is held or ctx is cancelled
+func (e *LeaderElector) acquire(ctx context.Context) bool {
+	ticker := time.NewTicker(e.cfg.RetryPeriod)
+	defer ticker.Stop()
+
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, e.cfg.RenewDeadline)
+		acquired, err := e.tryAcquireOrRenew(attemptCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("failed to acquire leader lease", "lease", e.cfg.LeaseName, "error", err)
+		} else if acquired {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// renew keeps the lease until a renewal has not succeeded within RenewDeadline
+func (e *LeaderElector) renew(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.RetryPeriod)
+	defer ticker.Stop()
+
+	lastRenew := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, e.cfg.RetryPeriod)
+		renewed, err := e.tryAcquireOrRenew(attemptCtx)
+		cancel()
+		if renewed {
+			lastRenew = time.Now()
+			continue
+		}
+		if err != nil {
+			slog.Warn("failed to renew leader lease", "lease", e.cfg.LeaseName, "error", err)
+		}
+		if time.Since(lastRenew) > e.cfg.RenewDeadline || (err == nil && !renewed) {
+			return
+		}
+	}
+}
+
+func (e *LeaderElector) leasePath(name string) string {
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", e.cfg.Namespace)
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// tryAcquireOrRenew takes or renews the lease; it returns false when another replica holds it
+func (e *LeaderElector) tryAcquireOrRenew(ctx context.Context) (bool, error) {
+	now := time.Now()
+	durationSeconds := int(e.cfg.LeaseDuration.Seconds())
+
+	var current lease
+	err := e.client.do(ctx, http.MethodGet, e.leasePath(e.cfg.LeaseName), nil, &current)
+	if isKubeStatus(err, http.StatusNotFound) {
+		created := lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   objectMeta{Name: e.cfg.LeaseName, Namespace: e.cfg.Namespace},
+			Spec: leaseSpec{
+				HolderIdentity:       e.cfg.Identity,
+				LeaseDurationSeconds: durationSeconds,
+				AcquireTime:          now.UTC().Format(microTimeLayout),
+				RenewTime:            now.UTC().Format(microTimeLayout),
+			},
+		}
+		if err := e.client.do(ctx, http.MethodPost, e.leasePath(""), created, nil); err != nil {
+			if isKubeStatus(err, http.StatusConflict) {
+				return false, nil
+			}
+			return false, err
+		}
+		e.observe(created.Spec, now)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	record := current.Spec.HolderIdentity + "/" + current.Spec.RenewTime
+	if record != e.observedRecord {
+		e.observedRecord = record
+		e.observedTime = now
+	}
+
+	holder := current.Spec.HolderIdentity
+	expiry := e.observedTime.Add(time.Duration(current.Spec.LeaseDurationSeconds) * time.Second)
+	if holder != "" && holder != e.cfg.Identity && now.Before(expiry) {
+		return false, nil
+	}
+
+	if holder != e.cfg.Identity {
+		current.Spec.AcquireTime = now.UTC().Format(microTimeLayout)
+		current.Spec.LeaseTransitions++
+	}
+	current.Spec.HolderIdentity = e.cfg.Identity
+	current.Spec.LeaseDurationSeconds = durationSeconds
+	current.Spec.RenewTime = now.UTC().Format(microTimeLayout)
+
+	// The resourceVersion makes this a compare-and-swap against other replicas
+	if err := e.client.do(ctx, http.MethodPut, e.leasePath(e.cfg.LeaseName), current, nil); err != nil {
+		if isKubeStatus(err, http.StatusConflict) {
+			return false, nil
+		}
+		return false, err
+	}
+	e.observe(current.Spec, now)
+	return true, nil
+}
+
+func (e *LeaderElector) observe(spec leaseSpec, now time.Time) {
+	e.observedRecord = spec.HolderIdentity + "/" + spec.RenewTime
+	e.observedTime = now
+}
+
+// release gives up the lease on shutdown so another replica can take over immediately
+func (e *LeaderElector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.RetryPeriod)
+	defer cancel()
+
+	var current lease
+	if err := e.client.do(ctx, http.MethodGet, e.leasePath(e.cfg.LeaseName), nil, &current); err != nil {
+		slog.Warn("failed to release leader lease", "lease", e.cfg.LeaseName, "error", err)
+		return
+	}
+	if current.Spec.HolderIdentity != e.cfg.Identity {
+		return
+	}
+
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	current.Spec.RenewTime = time.Now().UTC().Format(microTimeLayout)
+	if err := e.client.do(ctx, http.MethodPut, e.leasePath(e.cfg.LeaseName), current, nil); err != nil {
+		slog.Warn("failed to release leader lease", "lease", e.cfg.LeaseName, "error", err)
+		return
+	}
+	slog.Info("released leader lease", "lease", e.cfg.LeaseName)
+}
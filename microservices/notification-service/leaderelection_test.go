@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeases is an API server holding a single Lease
+type fakeLeases struct {
+	mu    sync.Mutex
+	lease *lease
+}
+
+func (f *fakeLeases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		if f.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.lease)
+	case http.MethodPost, http.MethodPut:
+		var l lease
+		json.NewDecoder(r.Body).Decode(&l)
+		f.lease = &l
+		json.NewEncoder(w).Encode(f.lease)
+	}
+}
+
+// steal hands the lease to another replica
+func (f *fakeLeases) steal(identity string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lease.Spec.HolderIdentity = identity
+	f.lease.Spec.LeaseDurationSeconds = 60
+	f.lease.Spec.RenewTime = time.Now().UTC().Format(microTimeLayout)
+}
+
+func TestLeaderElectorStopsJobsWhenLeaseIsLost(t *testing.T) {
+	leases := &fakeLeases{}
+	srv := httptest.NewServer(leases)
+	defer srv.Close()
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenPath, []byte("token"), 0o600)
+
+	e := &LeaderElector{
+		cfg: LeaderElectionConfig{
+			Enabled:       true,
+			LeaseName:     "notification-service",
+			Namespace:     "platform",
+			Identity:      "pod-0",
+			LeaseDuration: time.Second,
+			RenewDeadline: 50 * time.Millisecond,
+			RetryPeriod:   10 * time.Millisecond,
+		},
+		client: &kubeClient{baseURL: srv.URL, tokenPath: tokenPath, http: srv.Client()},
+	}
+	started := make(chan context.Context, 2)
+	job := func(ctx context.Context) {
+		started <- ctx
+		<-ctx.Done()
+	}
+	e.AddJob("retention", job)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var jobs []context.Context
+	waitForJob := func() {
+		select {
+		case jobCtx := <-started:
+			jobs = append(jobs, jobCtx)
+		case <-time.After(5 * time.Second):
+			t.Fatal("singleton job did not start")
+		}
+	}
+	waitForJob()
+	if !e.IsLeader() {
+		t.Error("running jobs without being the leader")
+	}
+	// A job added while leading starts without waiting for the next term
+	e.AddJob("archive", job)
+	waitForJob()
+
+	leases.steal("pod-1")
+	for i, jobCtx := range jobs {
+		select {
+		case <-jobCtx.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("job %d still running after the lease was lost", i)
+		}
+	}
+	if e.IsLeader() {
+		t.Error("still the leader after the lease was lost")
+	}
+	select {
+	case <-started:
+		t.Error("a job restarted while another replica holds the lease")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLeaderContext(t *testing.T) {
+	var leader leaderContext
+	if _, err := leader.Get(); err != errNotLeader {
+		t.Errorf("Get before leading returned %v, want errNotLeader", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		leader.Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := leader.Get(); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("never led")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+	if _, err := leader.Get(); err != errNotLeader {
+		t.Errorf("Get after the term ended returned %v, want errNotLeader", err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	notificationv1 "platform/api/proto/notification/v1"
+)
+
+var lifecycleEventsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "notification_lifecycle_events_total",
+		Help: "Total number of notification lifecycle events published by outcome",
+	},
+	[]string{"outcome"},
+)
+
+// lifecycleStream publishes NotificationEvent messages as notifications are
+// created, delivered, read and deleted
+//
+// Other services follow notifications through the topic instead of polling
+// the API. Events are written asynchronously, so a slow broker delays them
+// rather than the requests and deliveries that cause them. Purges,
+// retention and archiving are housekeeping and publish nothing. A nil
+// stream publishes nothing, for when no brokers are configured.
+type lifecycleStream struct {
+	writer *kafka.Writer
+	now    func() time.Time
+}
+
+func newLifecycleStream(brokers []string, topic string) *lifecycleStream {
+	return &lifecycleStream{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Async:        true,
+			Completion: func(messages []kafka.Message, err error) {
+				outcome := "published"
+				if err != nil {
+					outcome = "failed"
+					slog.Warn("publishing lifecycle events failed", "topic", topic, "events", len(messages), "error", err)
+				}
+				lifecycleEventsTotal.WithLabelValues(outcome).Add(float64(len(messages)))
+			},
+		},
+		now: time.Now,
+	}
+}
+
+// Created publishes that notification was stored
+func (s *lifecycleStream) Created(notification Notification) {
+	s.publish(notification, &notificationv1.NotificationEvent{Event: &notificationv1.NotificationEvent_Created{Created: &notificationv1.NotificationCreated{
+		Category: notification.Category,
+		Campaign: notification.Campaign,
+		Priority: notification.Priority,
+	}}})
+}
+
+// Delivered publishes that the provider for channel accepted notification
+func (s *lifecycleStream) Delivered(notification Notification, channel string) {
+	s.publish(notification, &notificationv1.NotificationEvent{Event: &notificationv1.NotificationEvent_Delivered{Delivered: &notificationv1.NotificationDelivered{Channel: channel}}})
+}
+
+// Failed publishes that the delivery of notification on channel was given up on
+func (s *lifecycleStream) Failed(notification Notification, channel string) {
+	s.publish(notification, &notificationv1.NotificationEvent{Event: &notificationv1.NotificationEvent_DeliveryFailed{DeliveryFailed: &notificationv1.NotificationDeliveryFailed{Channel: channel}}})
+}
+
+// Read publishes that the user read notification
+func (s *lifecycleStream) Read(notification Notification) {
+	s.publish(notification, &notificationv1.NotificationEvent{Event: &notificationv1.NotificationEvent_Read{Read: &notificationv1.NotificationRead{}}})
+}
+
+// Deleted publishes that notification was deleted through the API
+func (s *lifecycleStream) Deleted(notification Notification) {
+	s.publish(notification, &notificationv1.NotificationEvent{Event: &notificationv1.NotificationEvent_Deleted{Deleted: &notificationv1.NotificationDeleted{}}})
+}
+
+// publish fills in the fields event shares with every other event and queues it
+func (s *lifecycleStream) publish(notification Notification, event *notificationv1.NotificationEvent) {
+	if s == nil {
+		return
+	}
+	msg, err := lifecycleMessage(notification, s.now(), event)
+	if err != nil {
+		lifecycleEventsTotal.WithLabelValues("failed").Inc()
+		return
+	}
+	// Async writers only fail here once closed; delivery errors go to Completion
+	if err := s.writer.WriteMessages(context.Background(), msg); err != nil {
+		lifecycleEventsTotal.WithLabelValues("failed").Inc()
+	}
+}
+
+// lifecycleMessage encodes event, which happened to notification at, as a Kafka message
+func lifecycleMessage(notification Notification, at time.Time, event *notificationv1.NotificationEvent) (kafka.Message, error) {
+	event.Id = uuid.NewString()
+	event.NotificationId = notification.ID
+	event.UserId = notification.UserID
+	event.TenantId = notification.Tenant
+	event.Type = notification.Type
+	event.OccurredAt = timestamppb.New(at)
+	value, err := proto.Marshal(event)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	headers := append(correlationHeaders(notification.CorrelationID, notification.Tenant), kafka.Header{Key: "content-type", Value: []byte(mimeProtobuf)})
+	return kafka.Message{Key: []byte(notification.UserID), Value: value, Time: at, Headers: headers}, nil
+}
+
+// Close publishes the queued events, for use once deliveries have drained
+func (s *lifecycleStream) Close(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.writer.Close() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	notificationv1 "platform/api/proto/notification/v1"
+	"platform/pkg/reqctx"
+)
+
+func TestLifecycleMessage(t *testing.T) {
+	at := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	notification := testNotification("n1", "alice")
+	notification.Tenant = "acme"
+	notification.CorrelationID = "req-1"
+	notification.Category = categoryOrders
+	notification.Priority = "high"
+
+	msg, err := lifecycleMessage(notification, at, &notificationv1.NotificationEvent{Event: &notificationv1.NotificationEvent_Created{Created: &notificationv1.NotificationCreated{
+		Category: notification.Category,
+		Priority: notification.Priority,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keyed by user, so one user's events stay in order on one partition
+	if string(msg.Key) != "alice" {
+		t.Errorf("key = %q, want alice", msg.Key)
+	}
+	headers := map[string]string{}
+	for _, header := range msg.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+	if headers["content-type"] != mimeProtobuf || headers[reqctx.CorrelationIDHeader] != "req-1" || headers[reqctx.TenantHeader] != "acme" {
+		t.Errorf("headers = %v", headers)
+	}
+
+	var event notificationv1.NotificationEvent
+	if err := proto.Unmarshal(msg.Value, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.GetId() == "" || event.GetNotificationId() != "n1" || event.GetUserId() != "alice" || event.GetTenantId() != "acme" || event.GetType() != "info" {
+		t.Errorf("event = %v", &event)
+	}
+	if !event.GetOccurredAt().AsTime().Equal(at) {
+		t.Errorf("occurred_at = %v, want %v", event.GetOccurredAt().AsTime(), at)
+	}
+	if created := event.GetCreated(); created == nil || created.GetCategory() != categoryOrders || created.GetPriority() != "high" {
+		t.Errorf("created = %v", created)
+	}
+
+	// A nil stream, for when no brokers are configured, publishes nothing
+	var lifecycle *lifecycleStream
+	lifecycle.Deleted(notification)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/logging"
+)
+
+const contentTypeNDJSON = "application/x-ndjson"
+
+// listing is a set of notifications that can be returned whole or scanned in order
+type listing struct {
+	count int
+	all   func() []Notification
+	scan  func(fn func(Notification) error) error
+}
+
+// where narrows list to the notifications matching filter
+//
+// count stays the unfiltered count, an upper bound that only decides
+// whether to stream.
+func (list listing) where(filter notificationFilter) listing {
+	if filter.empty() {
+		return list
+	}
+	all, scan := list.all, list.scan
+	return listing{
+		count: list.count,
+		all: func() []Notification {
+			var matched []Notification
+			for _, notification := range all() {
+				if filter.match(notification) {
+					matched = append(matched, notification)
+				}
+			}
+			return matched
+		},
+		scan: func(fn func(Notification) error) error {
+			return scan(func(notification Notification) error {
+				if !filter.match(notification) {
+					return nil
+				}
+				return fn(notification)
+			})
+		},
+	}
+}
+
+// pinnedFirst moves pinned notifications to the front of list, keeping order otherwise
+//
+// Scanning takes two passes: the first collects the pinned notifications,
+// which are few, and the second streams everything else. A notification
+// pinned or unpinned in between still appears exactly once.
+func (list listing) pinnedFirst() listing {
+	all, scan := list.all, list.scan
+	return listing{
+		count: list.count,
+		all: func() []Notification {
+			notifications := all()
+			sort.SliceStable(notifications, func(i, j int) bool { return notifications[i].Pinned && !notifications[j].Pinned })
+			return notifications
+		},
+		scan: func(fn func(Notification) error) error {
+			var pinned []Notification
+			seen := make(map[string]bool)
+			err := scan(func(notification Notification) error {
+				if notification.Pinned {
+					pinned = append(pinned, notification)
+					seen[notification.ID] = true
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, notification := range pinned {
+				if err := fn(notification); err != nil {
+					return err
+				}
+			}
+			return scan(func(notification Notification) error {
+				if seen[notification.ID] {
+					return nil
+				}
+				return fn(notification)
+			})
+		},
+	}
+}
+
+// bindFilter reads the category and tag filters, answering 400 if they are invalid
+func bindFilter(c *gin.Context) (notificationFilter, bool) {
+	filter, err := parseFilter(c.QueryArray("category"), c.QueryArray("tag"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return notificationFilter{}, false
+	}
+	return filter, true
+}
+
+// respondList writes a notification listing in the usual envelope
+//
+// Listings above threshold are streamed as a chunked JSON array, so memory
+// stays flat however large they get; clients see the same document either
+// way. Clients accepting application/x-ndjson always get one notification
+// per line, without the envelope. Once streaming has started the status can
+// no longer change, so a failure part way through ends the response early
+// and clients see truncated JSON.
+func respondList(c *gin.Context, threshold int, list listing) {
+	if strings.Contains(c.GetHeader("Accept"), contentTypeNDJSON) {
+		streamList(c, contentTypeNDJSON, list, writeNDJSON)
+		return
+	}
+	if list.count <= threshold {
+		notifications := list.all()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    notifications,
+			"count":   len(notifications),
+		})
+		return
+	}
+	streamList(c, "application/json; charset=utf-8", list, writeJSONArray)
+}
+
+func streamList(c *gin.Context, contentType string, list listing, write func(*bufio.Writer, listing) error) {
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+
+	w := bufio.NewWriterSize(c.Writer, 32<<10)
+	err := write(w, list)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Warn("streamed listing ended early", "error", err)
+	}
+}
+
+// writeJSONArray writes the {"success","data","count"} envelope one notification at a time
+func writeJSONArray(w *bufio.Writer, list listing) error {
+	encoder := json.NewEncoder(w)
+	w.WriteString(`{"success":true,"data":[`)
+	count := 0
+	err := list.scan(func(notification Notification) error {
+		if count > 0 {
+			w.WriteByte(',')
+		}
+		count++
+		// Encode appends a newline, which is valid whitespace between elements
+		return encoder.Encode(notification)
+	})
+	if err != nil {
+		return err
+	}
+	// count is what was written, which can differ from list.count if
+	// notifications were created or deleted meanwhile
+	_, err = w.WriteString(`],"count":` + strconv.Itoa(count) + "}")
+	return err
+}
+
+// writeNDJSON writes one notification per line
+func writeNDJSON(w *bufio.Writer, list listing) error {
+	encoder := json.NewEncoder(w)
+	return list.scan(func(notification Notification) error {
+		return encoder.Encode(notification)
+	})
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+//
+// Comparison is weak, as RFC 9110 requires for If-None-Match, so W/"x"
+// matches "x".
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
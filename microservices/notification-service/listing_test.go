@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/server"
+)
+
+func listingRouter(t *testing.T, store *notificationStore, threshold int) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := server.NewEngine(server.Options{})
+	registerAPIRoutes(r.Group("/api"), context.Background(), testService(store, newBroadcastStore(), systemClock{}), newTemplateStore(), threshold)
+	return r
+}
+
+func getListing(r *gin.Engine, path, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+type listEnvelope struct {
+	Success bool           `json:"success"`
+	Data    []Notification `json:"data"`
+	Count   int            `json:"count"`
+}
+
+func TestStreamedListingMatchesBufferedListing(t *testing.T) {
+	store := newNotificationStore()
+	for i := 0; i < 3*scanChunk; i++ {
+		store.Add(testNotification("n"+strconv.Itoa(i), "user-"+strconv.Itoa(i%3)))
+	}
+
+	for _, path := range []string{"/api/notifications", "/api/users/user-1/notifications"} {
+		t.Run(path, func(t *testing.T) {
+			var buffered, streamed listEnvelope
+			if err := json.Unmarshal(getListing(listingRouter(t, store, store.Len()), path, "").Body.Bytes(), &buffered); err != nil {
+				t.Fatal(err)
+			}
+			rec := getListing(listingRouter(t, store, 0), path, "")
+			if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+				t.Fatalf("streamed listing: status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &streamed); err != nil {
+				t.Fatalf("streamed listing is not valid JSON: %v", err)
+			}
+
+			if !streamed.Success || streamed.Count != buffered.Count || streamed.Count != len(streamed.Data) {
+				t.Errorf("streamed envelope success=%v count=%d with %d items, buffered count=%d",
+					streamed.Success, streamed.Count, len(streamed.Data), buffered.Count)
+			}
+			if ids(streamed.Data) != ids(buffered.Data) {
+				t.Error("streamed listing differs from buffered listing")
+			}
+		})
+	}
+}
+
+func TestStreamedListingOfNothingIsAnEmptyArray(t *testing.T) {
+	// Everything may be deleted between counting and streaming
+	var body strings.Builder
+	w := bufio.NewWriter(&body)
+	if err := writeJSONArray(w, listing{count: 1, scan: newNotificationStore().Scan}); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if got := body.String(); got != `{"success":true,"data":[],"count":0}` {
+		t.Errorf("body = %s", got)
+	}
+}
+
+func TestNDJSONListing(t *testing.T) {
+	store := newNotificationStore(testNotification("a1", "alice"), testNotification("b1", "bob"), testNotification("a2", "alice"))
+	rec := getListing(listingRouter(t, store, 1000), "/api/users/alice/notifications", contentTypeNDJSON)
+	if ct := rec.Header().Get("Content-Type"); ct != contentTypeNDJSON {
+		t.Errorf("content type = %q", ct)
+	}
+
+	var got []Notification
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var notification Notification
+		if err := json.Unmarshal(scanner.Bytes(), &notification); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, notification)
+	}
+	if ids(got) != "a1,a2" {
+		t.Errorf("NDJSON listing = %s, want a1,a2", ids(got))
+	}
+}
+
+func TestScanSkipsNotificationsDeletedMidScan(t *testing.T) {
+	store := newNotificationStore()
+	for i := 0; i < 2*scanChunk; i++ {
+		store.Add(testNotification("n"+strconv.Itoa(i), "alice"))
+	}
+
+	// Delete the second chunk while the first is being handed out
+	last := "n" + strconv.Itoa(2*scanChunk-1)
+	seen := 0
+	store.ScanUser("alice", func(notification Notification) error {
+		if seen == 0 {
+			for i := scanChunk; i < 2*scanChunk; i++ {
+				store.Delete("n" + strconv.Itoa(i))
+			}
+		}
+		if notification.ID == last {
+			t.Errorf("%s was returned after being deleted", last)
+		}
+		seen++
+		return nil
+	})
+	if seen != scanChunk {
+		t.Errorf("scanned %d notifications, want %d", seen, scanChunk)
+	}
+}
+
+func TestInboxConditionalGet(t *testing.T) {
+	store := newNotificationStore(testNotification("a1", "alice"), testNotification("b1", "bob"))
+	r := listingRouter(t, store, 1000)
+	revalidate := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/alice/notifications", nil)
+		req.Header.Set("If-None-Match", etag)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	etag := getListing(r, "/api/users/alice/notifications", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("inbox listing has no ETag")
+	}
+	rec := revalidate(etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("unchanged inbox: status %d with %d byte body, want an empty 304", rec.Code, rec.Body.Len())
+	}
+	if rec.Header().Get("ETag") != etag {
+		t.Errorf("304 carries ETag %q, want %q", rec.Header().Get("ETag"), etag)
+	}
+
+	// Another user's changes leave alice's inbox version alone
+	store.Add(testNotification("b2", "bob"))
+	store.MarkRead("b1", time.Now())
+	if code := revalidate(etag).Code; code != http.StatusNotModified {
+		t.Errorf("after changes to bob's inbox: status %d, want 304", code)
+	}
+
+	for _, step := range []struct {
+		name   string
+		change func()
+	}{
+		{"create", func() { store.Add(testNotification("a2", "alice")) }},
+		{"read", func() { store.MarkRead("a1", time.Now()) }},
+		{"pin", func() { store.SetPinned("a1", true) }},
+		{"delete", func() { store.Delete("a2") }},
+	} {
+		name := step.name
+		step.change()
+		rec := revalidate(etag)
+		if rec.Code != http.StatusOK {
+			t.Errorf("after %s: status %d, want 200", name, rec.Code)
+		}
+		if rec.Header().Get("ETag") == etag {
+			t.Errorf("after %s: ETag unchanged", name)
+		}
+		etag = rec.Header().Get("ETag")
+	}
+}
+
+func TestPinnedNotificationsListFirst(t *testing.T) {
+	store := newNotificationStore()
+	for _, id := range []string{"a1", "a2", "a3", "a4"} {
+		store.Add(testNotification(id, "alice"))
+	}
+	store.SetPinned("a3", true)
+	store.SetPinned("a2", true)
+
+	for _, threshold := range []int{1000, 0} {
+		r := listingRouter(t, store, threshold)
+		for _, path := range []string{"/api/notifications", "/api/users/alice/notifications"} {
+			var resp listEnvelope
+			if err := json.Unmarshal(getListing(r, path, "").Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(resp.Data); got != "a2,a3,a1,a4" {
+				t.Errorf("threshold %d: GET %s = %s, want a2,a3,a1,a4", threshold, path, got)
+			}
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/users/alice/notifications/read", nil)
+	rec := httptest.NewRecorder()
+	listingRouter(t, store, 1000).ServeHTTP(rec, req)
+	var resp struct {
+		Count int `json:"count"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp.Count != 2 {
+		t.Errorf("mark all read: status %d, count %d, want 200 and 2", rec.Code, resp.Count)
+	}
+	for _, n := range store.ListByUser("alice") {
+		if want := map[bool]string{true: "unread", false: "read"}[n.Pinned]; n.Status != want {
+			t.Errorf("%s (pinned %v) is %s after mark all read, want %s", n.ID, n.Pinned, n.Status, want)
+		}
+	}
+
+	if n, ok := store.SetPinned("a2", false); !ok || n.Pinned {
+		t.Errorf("unpin = %+v, %v", n, ok)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"*", true},
+		{`W/"v-1"`, true},
+		{`"v-1"`, true},
+		{`"v-0", W/"v-1"`, true},
+		{`W/"v-2"`, false},
+	} {
+		if got := etagMatches(tc.header, `W/"v-1"`); got != tc.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Resources whose saturation sheds load
+const (
+	resourceSendQueue   = "send_queue"
+	resourceWriteBuffer = "write_buffer"
+)
+
+var loadShedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "load_shed_total",
+		Help: "Total number of creates and sends rejected to shed load, by saturated resource",
+	},
+	[]string{"resource"},
+)
+
+// errOverloaded is returned for non-critical requests while load is shed
+var errOverloaded = errors.New("Service is overloaded, retry later")
+
+// overloadError says which resource is saturated and when to retry
+type overloadError struct {
+	resource   string
+	saturation float64
+	retryAfter time.Duration
+}
+
+func (e *overloadError) Error() string {
+	return fmt.Sprintf("%s: %s is %.0f%% full", errOverloaded, e.resource, e.saturation*100)
+}
+
+func (e *overloadError) Is(target error) bool { return target == errOverloaded }
+
+// saturationSource reports how full one bounded resource is, from 0 to 1
+type saturationSource struct {
+	name       string
+	saturation func() float64
+}
+
+// loadShedder turns away non-critical creates and sends while a resource is past its high-water mark
+type loadShedder struct {
+	cfg       atomic.Pointer[LoadSheddingConfig]
+	resources []saturationSource
+}
+
+func newLoadShedder(cfg LoadSheddingConfig, dispatcher *Dispatcher, writer *notificationWriter) *loadShedder {
+	l := &loadShedder{resources: []saturationSource{
+		{resourceSendQueue, func() float64 { return float64(dispatcher.QueueDepth()) / float64(dispatcher.QueueCapacity()) }},
+		{resourceWriteBuffer, writer.Saturation},
+	}}
+	l.SetConfig(cfg)
+	return l
+}
+
+// SetConfig replaces the high-water mark, retry hint and critical categories
+func (l *loadShedder) SetConfig(cfg LoadSheddingConfig) {
+	l.cfg.Store(&cfg)
+}
+
+// Admit returns an error matching errOverloaded when a notification in category should be shed
+func (l *loadShedder) Admit(category string) error {
+	if l == nil {
+		return nil
+	}
+	cfg := l.cfg.Load()
+	if !cfg.Enabled || slices.Contains(cfg.CriticalCategories, category) {
+		return nil
+	}
+	for _, resource := range l.resources {
+		if saturation := resource.saturation(); saturation >= cfg.HighWaterMark {
+			loadShedTotal.WithLabelValues(resource.name).Inc()
+			return &overloadError{resource: resource.name, saturation: saturation, retryAfter: cfg.RetryAfter}
+		}
+	}
+	return nil
+}
+
+// Resources lists what Admit watches, for the saturation gauges
+func (l *loadShedder) Resources() []saturationSource {
+	return l.resources
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoadShedding(t *testing.T) {
+	cfg := defaultConfig()
+	store := newNotificationStore()
+	service := testService(store, newBroadcastStore(), systemClock{})
+	// A queue of 10 with no workers, so queued deliveries stay put
+	service.dispatcher = newDispatcher(10, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	service.shedder = newLoadShedder(cfg.LoadShedding, service.dispatcher, service.writer)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAPIRoutes(r.Group("/api"), context.Background(), service, newTemplateStore(), cfg.Responses.StreamThreshold)
+	post := func(path, category string) *httptest.ResponseRecorder {
+		body := `{"user_id":"alice","type":"info","title":"Hi","message":"Hello","category":"` + category + `","channels":["push"]}`
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Seven queued deliveries stay below the 0.8 high-water mark
+	for i := 0; i < 7; i++ {
+		if rec := post("/api/send", categoryPromotions); rec.Code != http.StatusOK {
+			t.Fatalf("send %d below the high-water mark returned %d", i, rec.Code)
+		}
+	}
+	if rec := post("/api/send", categoryPromotions); rec.Code != http.StatusOK {
+		t.Fatalf("send reaching the high-water mark returned %d", rec.Code)
+	}
+
+	for _, path := range []string{"/api/send", "/api/notifications"} {
+		rec := post(path, categoryPromotions)
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "5" {
+			t.Errorf("POST %s past the high-water mark returned %d with Retry-After %q, want 503 and 5",
+				path, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+	// Security notifications are critical and still get through
+	if rec := post("/api/send", categorySecurity); rec.Code != http.StatusOK {
+		t.Errorf("critical send returned %d, want 200", rec.Code)
+	}
+	if store.Len() != 9 {
+		t.Errorf("stored %d notifications, want 9", store.Len())
+	}
+
+	off := cfg.LoadShedding
+	off.Enabled = false
+	service.shedder.SetConfig(off)
+	if rec := post("/api/notifications", categoryPromotions); rec.Code != http.StatusCreated {
+		t.Errorf("create with load shedding off returned %d, want 201", rec.Code)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	// Embedded so user timezones resolve on images without /usr/share/zoneinfo
+	_ "time/tzdata"
+)
+
+var errInvalidLocalTime = errors.New("Invalid local_time, want HH:MM")
+
+// wallClock is a time of day as read off a clock in some timezone, e.g. 09:00
+type wallClock struct {
+	hour, minute int
+}
+
+// parseWallClock parses HH:MM on a 24-hour clock
+func parseWallClock(s string) (wallClock, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return wallClock{}, fmt.Errorf("%w: %s", errInvalidLocalTime, s)
+	}
+	return wallClock{hour: t.Hour(), minute: t.Minute()}, nil
+}
+
+// userLocation returns the user's timezone, or UTC when it is unset or unknown
+func userLocation(timezone string) *time.Location {
+	if timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// nextWallClock returns the first instant at or after from when clocks in loc read at
+//
+// A time skipped when clocks go forward is moved later by the length of the
+// skip, so 02:30 on a day clocks jump from 02:00 to 03:00 is 03:30. A time
+// repeated when clocks go back is its first occurrence, so a daily local
+// time still happens once a day.
+func nextWallClock(from time.Time, at wallClock, loc *time.Location) time.Time {
+	local := from.In(loc)
+	for day := 0; ; day++ {
+		t := wallClockOn(local.Year(), local.Month(), local.Day()+day, at, loc)
+		if !t.Before(from) {
+			return t
+		}
+	}
+}
+
+// wallClockOn returns when clocks in loc read at on the given day
+func wallClockOn(year int, month time.Month, day int, at wallClock, loc *time.Location) time.Time {
+	naive := time.Date(year, month, day, at.hour, at.minute, 0, 0, time.UTC)
+	// The offsets in force a day either side cover any change on the day itself
+	_, before := naive.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := naive.Add(24 * time.Hour).In(loc).Zone()
+	first := naive.Add(-time.Duration(before) * time.Second)
+	second := naive.Add(-time.Duration(after) * time.Second)
+	if second.Before(first) {
+		first, second = second, first
+	}
+	for _, t := range []time.Time{first, second} {
+		if local := t.In(loc); local.Hour() == at.hour && local.Minute() == at.minute {
+			return local
+		}
+	}
+	// Skipped by clocks going forward
+	return naive.Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+// sleepUntil waits until t or until ctx is cancelled
+func sleepUntil(ctx context.Context, t time.Time) error {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextWallClock(t *testing.T) {
+	warsaw := userLocation("Europe/Warsaw")
+	sydney := userLocation("Australia/Sydney")
+	nineAM := wallClock{hour: 9}
+	halfTwo := wallClock{hour: 2, minute: 30}
+
+	for _, tc := range []struct {
+		name string
+		from time.Time
+		at   wallClock
+		loc  *time.Location
+		want string
+	}{
+		{"later today", time.Date(2026, 6, 1, 5, 0, 0, 0, time.UTC), nineAM, warsaw, "2026-06-01T09:00:00+02:00"},
+		{"already past today", time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC), nineAM, warsaw, "2026-06-02T09:00:00+02:00"},
+		{"exactly now", time.Date(2026, 6, 1, 7, 0, 0, 0, time.UTC), nineAM, warsaw, "2026-06-01T09:00:00+02:00"},
+		// Local date is already tomorrow when it is late evening in UTC
+		{"ahead of UTC", time.Date(2026, 6, 1, 22, 0, 0, 0, time.UTC), nineAM, sydney, "2026-06-02T09:00:00+10:00"},
+		{"winter offset", time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), nineAM, warsaw, "2026-01-15T09:00:00+01:00"},
+		// 9:00 stays 9:00 local on the day the clocks change
+		{"spring forward day", time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC), nineAM, warsaw, "2026-03-29T09:00:00+02:00"},
+		{"fall back day", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC), nineAM, warsaw, "2026-10-25T09:00:00+01:00"},
+		// 02:30 does not exist on 29 March in Warsaw and happens twice on 25 October
+		{"skipped time", time.Date(2026, 3, 28, 23, 0, 0, 0, time.UTC), halfTwo, warsaw, "2026-03-29T03:30:00+02:00"},
+		{"repeated time", time.Date(2026, 10, 24, 22, 0, 0, 0, time.UTC), halfTwo, warsaw, "2026-10-25T02:30:00+02:00"},
+		{"between repeats", time.Date(2026, 10, 25, 0, 45, 0, 0, time.UTC), halfTwo, warsaw, "2026-10-26T02:30:00+01:00"},
+		// The southern hemisphere moves its clocks the other way
+		{"southern spring forward", time.Date(2026, 10, 3, 14, 0, 0, 0, time.UTC), halfTwo, sydney, "2026-10-04T03:30:00+11:00"},
+		{"unknown timezone", time.Date(2026, 6, 1, 5, 0, 0, 0, time.UTC), nineAM, userLocation("Mars/Olympus_Mons"), "2026-06-01T09:00:00Z"},
+	} {
+		if got := nextWallClock(tc.from, tc.at, tc.loc).Format(time.RFC3339); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"9am", "24:00", "09:60", ""} {
+		if _, err := parseWallClock(bad); err == nil {
+			t.Errorf("parsed %q", bad)
+		}
+	}
+}
+
+func TestLocalTimeSegmentDryRun(t *testing.T) {
+	now := time.Now()
+	r, campaigns, _ := campaignRouter(t, []userProfile{
+		{ID: "warsaw", Plan: planPro, Timezone: "Europe/Warsaw", CreatedAt: now},
+		{ID: "new-york", Plan: planPro, Timezone: "America/New_York", CreatedAt: now},
+		{ID: "unset", Plan: planPro, CreatedAt: now},
+	})
+	registerSegmentRoutes(r.Group("/api/admin"), campaigns.sender)
+	preview := func(body string) (int, segmentPreview) {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/sends?dry_run=true", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		var resp struct {
+			Data segmentPreview `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Data
+	}
+
+	if code, _ := preview(`{"segment":"pro","type":"promo","title":"T","message":"M","local_time":"9am"}`); code != http.StatusBadRequest {
+		t.Errorf("send with an invalid local time returned %d, want 400", code)
+	}
+
+	code, got := preview(`{"segment":"pro","type":"promo","title":"T","message":"M","local_time":"09:00"}`)
+	if code != http.StatusOK || len(got.Recipients) != 3 {
+		t.Fatalf("dry run returned %d, %+v", code, got)
+	}
+	zones := map[string]string{"warsaw": "Europe/Warsaw", "new-york": "America/New_York", "unset": "UTC"}
+	for _, recipient := range got.Recipients {
+		if recipient.SendAt == nil {
+			t.Errorf("%s has no send time", recipient.UserID)
+			continue
+		}
+		local := recipient.SendAt.In(userLocation(zones[recipient.UserID]))
+		if local.Hour() != 9 || local.Minute() != 0 || recipient.SendAt.Before(now) || recipient.SendAt.Sub(now) > 25*time.Hour {
+			t.Errorf("%s is sent at %s, want the next 09:00 in %s", recipient.UserID, recipient.SendAt, zones[recipient.UserID])
+		}
+	}
+}
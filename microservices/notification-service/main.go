@@ -1,28 +1,56 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/google/uuid"
+
+	"platform/pkg/health"
+	"platform/pkg/logging"
+	"platform/pkg/middleware"
+	"platform/pkg/server"
 )
 
 // Notification represents a notification message
 type Notification struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Type      string    `json:"type"`
-	Title     string    `json:"title"`
-	Message   string    `json:"message"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	ReadAt    *time.Time `json:"read_at,omitempty"`
+	ID            string               `json:"id"`
+	UserID        string               `json:"user_id"`
+	Type          string               `json:"type"`
+	Title         string               `json:"title"`
+	Message       string               `json:"message"`
+	Status        string               `json:"status"`
+	Pinned        bool                 `json:"pinned,omitempty"`
+	Category      string               `json:"category,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	Campaign      string               `json:"campaign,omitempty"`
+	Variant       string               `json:"variant,omitempty"`
+	Tenant        string               `json:"tenant,omitempty"`
+	GroupKey      string               `json:"group_key,omitempty"`
+	Priority      string               `json:"priority,omitempty"`
+	Icon          string               `json:"icon,omitempty"`
+	Actions       []NotificationAction `json:"actions,omitempty"`
+	ImageURL      string               `json:"image_url,omitempty"`
+	Data          map[string]any       `json:"data,omitempty"`
+	CorrelationID string               `json:"correlation_id,omitempty"`
+	TraceID       string               `json:"trace_id,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	ReadAt        *time.Time           `json:"read_at,omitempty"`
+	SnoozedUntil  *time.Time           `json:"snoozed_until,omitempty"`
+
+	// Template and TemplateVersion record what rendered the notification, when a template did
+	Template        string `json:"template,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"`
 }
 
 // CreateNotificationRequest represents the request to create a notification
@@ -31,264 +59,584 @@ type CreateNotificationRequest struct {
 	Type    string `json:"type" binding:"required"`
 	Title   string `json:"title" binding:"required"`
 	Message string `json:"message" binding:"required"`
+	// Category defaults to system
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+	// Campaign groups click-through metrics, e.g. spring-sale-2026
+	Campaign string `json:"campaign"`
+	// GroupKey collapses repeated notifications, e.g. comments:post-42
+	GroupKey string `json:"group_key" binding:"max=128"`
+	// Rich content is validated by contentValidator, Data against Type's schema
+	Actions  []NotificationAction `json:"actions"`
+	ImageURL string               `json:"image_url"`
+	Data     map[string]any       `json:"data"`
 }
 
-// Prometheus metrics
-var (
-	httpRequestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-
-	httpRequestDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint"},
-	)
-)
-
-// In-memory storage (replace with database in production)
-var notifications = []Notification{
-	{
-		ID:        "1",
-		UserID:    "1",
-		Type:      "order_status",
-		Title:     "Order Confirmed",
-		Message:   "Your order #12345 has been confirmed",
-		Status:    "unread",
-		CreatedAt: time.Now(),
-	},
+// SendNotificationRequest represents the request to send a notification
+type SendNotificationRequest struct {
+	CreateNotificationRequest
+	Channels []string `json:"channels"`
 }
 
 func init() {
 	// Register Prometheus metrics
-	prometheus.MustRegister(httpRequestsTotal)
-	prometheus.MustRegister(httpRequestDuration)
-}
-
-// Metrics middleware
-func metricsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
-
-		c.Next()
-
-		duration := time.Since(start).Seconds()
-		status := fmt.Sprintf("%d", c.Writer.Status())
-
-		httpRequestsTotal.WithLabelValues(c.Request.Method, c.FullPath(), status).Inc()
-		httpRequestDuration.WithLabelValues(c.Request.Method, c.FullPath()).Observe(duration)
-	}
+	middleware.MustRegisterMetrics(prometheus.DefaultRegisterer)
+	prometheus.MustRegister(notificationsCreatedTotal)
+	prometheus.MustRegister(deliveriesTotal)
+	prometheus.MustRegister(deliveryLatency)
+	prometheus.MustRegister(deliveryQueueWait)
+	prometheus.MustRegister(deadLetterTotal)
+	prometheus.MustRegister(health.DependencyUp)
+	prometheus.MustRegister(deliveryEndToEndLatency)
+	prometheus.MustRegister(sloEventsTotal)
+	prometheus.MustRegister(sloObjectiveSeconds)
+	prometheus.MustRegister(sloTargetRatio)
+	prometheus.MustRegister(leaderElectionIsLeader)
+	prometheus.MustRegister(circuitBreakerState)
+	prometheus.MustRegister(circuitBreakerTransitionsTotal)
+	prometheus.MustRegister(startupDuration)
+	prometheus.MustRegister(eventsConsumedTotal)
+	prometheus.MustRegister(eventsDroppedTotal)
+	prometheus.MustRegister(eventConsumerLag)
+	prometheus.MustRegister(streamSubscribers)
+	prometheus.MustRegister(writeFlushesTotal)
+	prometheus.MustRegister(writeBatchSize)
+	prometheus.MustRegister(writeFlushDuration)
+	prometheus.MustRegister(writeSpoolTotal)
+	prometheus.MustRegister(writeSpoolBacklog)
+	prometheus.MustRegister(writeSpoolLagSeconds)
+	prometheus.MustRegister(deliveryLogFlushesTotal)
+	prometheus.MustRegister(deliveryLogBatchSize)
+	prometheus.MustRegister(storeShardOperationsTotal)
+	prometheus.MustRegister(storeShardLockWait)
+	prometheus.MustRegister(storeShardErrorsTotal)
+	prometheus.MustRegister(actionsOfferedTotal)
+	prometheus.MustRegister(actionClicksTotal)
+	prometheus.MustRegister(unsubscribesTotal)
+	prometheus.MustRegister(suppressionChangesTotal)
+	prometheus.MustRegister(providerCallbacksTotal)
+	prometheus.MustRegister(addressSuppressionsTotal)
+	prometheus.MustRegister(sandboxCapturedTotal)
+	prometheus.MustRegister(loadShedTotal)
+	prometheus.MustRegister(notificationsQuarantinedTotal)
+	prometheus.MustRegister(notificationsExpiredTotal)
+	prometheus.MustRegister(quotaExceededTotal)
+	prometheus.MustRegister(notificationsArchivedTotal)
+	prometheus.MustRegister(archiveUploadFailuresTotal)
+	prometheus.MustRegister(archiveObjectsExpiredTotal)
+	prometheus.MustRegister(presenceConnectedUsers)
+	prometheus.MustRegister(replicationChangesTotal)
+	prometheus.MustRegister(replicationLagSeconds)
+	prometheus.MustRegister(replicationLagMessages)
+	prometheus.MustRegister(lifecycleEventsTotal)
+	prometheus.MustRegister(shadowDeliveriesTotal)
+	prometheus.MustRegister(shadowDeliveryLatency)
+	prometheus.MustRegister(importRowsTotal)
+	prometheus.MustRegister(deliveriesReclaimedTotal)
+	prometheus.MustRegister(chaosFaultsInjectedTotal)
+	prometheus.MustRegister(volumeAnomaly)
+	prometheus.MustRegister(volumeAnomaliesTotal)
+	prometheus.MustRegister(volumeThrottledTotal)
 }
 
 func main() {
-	// Set Gin to release mode in production
-	if os.Getenv("GIN_MODE") == "release" {
-		gin.SetMode(gin.ReleaseMode)
+	logger := logging.New("notification-service")
+	slog.SetDefault(logger)
+
+	seed := flag.Bool("seed", false, "load fixture notifications, templates and preferences, like SEED_DATA=true")
+	flag.Parse()
+
+	// Load and validate configuration
+	configFile := os.Getenv("CONFIG_FILE")
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
 	}
+	if *seed {
+		cfg.SeedData = true
+	}
+	logging.SetLevel(cfg.LogLevel)
 
-	r := gin.Default()
-
-	// Add metrics middleware
-	r.Use(metricsMiddleware())
+	// Cancelled on SIGTERM/SIGINT to begin graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
 
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":    "healthy",
-			"service":   "notification-service",
-			"timestamp": time.Now().Format(time.RFC3339),
-			"version":   "1.0.0",
-		})
-	})
+	// Sibling services, resolved the same way for every outbound caller
+	services := newServiceDiscovery(cfg.Discovery)
+	outbound := newServiceClient(newOutboundClient(), services)
 
-	// Readiness probe
-	r.GET("/ready", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "ready",
-			"service": "notification-service",
-		})
-	})
+	// Delivery targets come from the user service when lookups are enabled
+	var (
+		users      *userDirectory
+		recipients recipientResolver
+		profiles   profileSource
+	)
+	if cfg.Users.Enabled {
+		users = newUserDirectory(outbound, cfg.Users)
+		recipients = users
+		profiles = users
+	}
 
-	// Metrics endpoint
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
-
-	// API routes
-	api := r.Group("/api")
-	{
-		// Get all notifications
-		api.GET("/notifications", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"success": true,
-				"data":    notifications,
-				"count":   len(notifications),
-			})
-		})
-
-		// Get notification by ID
-		api.GET("/notifications/:id", func(c *gin.Context) {
-			id := c.Param("id")
-			for _, notification := range notifications {
-				if notification.ID == id {
-					c.JSON(http.StatusOK, gin.H{
-						"success": true,
-						"data":    notification,
-					})
-					return
-				}
-			}
-			c.JSON(http.StatusNotFound, gin.H{
-				"success": false,
-				"error":   "Notification not found",
-			})
-		})
-
-		// Create new notification
-		api.POST("/notifications", func(c *gin.Context) {
-			var req CreateNotificationRequest
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"success": false,
-					"error":   "Invalid request data",
-				})
-				return
-			}
+	// Delivery pipeline
+	dispatcher := newDispatcher(
+		cfg.Delivery.QueueSize,
+		cfg.Delivery.MaxAttempts,
+		cfg.Delivery.RetryDelay,
+		newSLOPolicy(cfg.SLO),
+		cfg.CircuitBreakers,
+		recipients,
+	)
+	// Critical and bulk notifications get lanes of their own, so neither waits behind the other
+	dispatcher.AddLane(laneCritical, cfg.Delivery.Critical)
+	dispatcher.AddLane(laneBulk, cfg.Delivery.Bulk)
+	// Receipts reported by providers, and the addresses they report bouncing or complaining
+	deliveries := newDeliveryRecords()
+	suppressions := newSuppressionList()
+	// Local development can simulate a provider to exercise retries and dead letters
+	if cfg.Providers.Name == providerMock {
+		dispatcher.UseProvider(newMockProvider(cfg.Providers.Mock, deliveries, suppressions).Sender)
+		logger.Warn("mock provider: deliveries are simulated, not sent",
+			"latency", cfg.Providers.Mock.Latency, "failure_rate", cfg.Providers.Mock.FailureRate,
+			"bounce_rate", cfg.Providers.Mock.BounceRate)
+	}
+	// A new provider can be trialled on a copy of the traffic before it takes over
+	var shadow *shadowStats
+	if shadowCfg := cfg.Providers.Shadow; shadowCfg.Name != "" {
+		shadow = newShadowStats(shadowCfg.Name, newDeliveryRecords())
+		newSender := func(string) Sender { return logSender{} }
+		if shadowCfg.Name == providerMock {
+			// The shadow's receipts and bounces are kept apart from the real ones
+			newSender = newMockProvider(shadowCfg.Mock, shadow.records, newSuppressionList()).Sender
+		}
+		dispatcher.Shadow(shadowCfg, newSender, shadow)
+		logger.Info("shadow provider: copying deliveries for comparison", "provider", shadowCfg.Name,
+			"channels", shadowCfg.Channels, "sample_rate", shadowCfg.SampleRate)
+	}
+	// Staging and other non-production environments capture deliveries instead of sending them
+	var outbox *sandboxOutbox
+	if cfg.Sandbox.Enabled {
+		outbox = newSandboxOutbox(cfg.Sandbox.OutboxSize)
+		dispatcher.Sandbox(outbox)
+		logger.Warn("sandbox mode: deliveries are captured, not sent", "outbox_size", cfg.Sandbox.OutboxSize)
+	}
+	unsubscribes := newUnsubscriber(cfg.Unsubscribe)
+	// Unsubscribes are kept on a compacted topic every replica reads, so they hold across replicas and restarts
+	var suppressionsTopic *suppressionTopic
+	suppressionsClose := func(context.Context) error { return nil }
+	if len(cfg.Events.Brokers) > 0 && cfg.Unsubscribe.Topic != "" {
+		suppressionsTopic = newSuppressionTopic(cfg.Events.Brokers, cfg.Unsubscribe.Topic)
+		unsubscribes.SetTopic(suppressionsTopic)
+		suppressionsClose = suppressionsTopic.Close
+		go suppressionsTopic.Run(ctx, unsubscribes)
+	} else if unsubscribes.Enabled() {
+		logger.Warn("unsubscribes are only kept in memory until brokers are configured", "topic", cfg.Unsubscribe.Topic)
+	}
+	dispatcher.SetUnsubscriber(unsubscribes)
+	dispatcher.SuppressAddresses(suppressions)
+	// Resilience tests inject faults into requests, deliveries, events and notification writes through the admin API
+	var chaos *chaosInjector
+	if cfg.Chaos.Enabled {
+		chaos = newChaosInjector()
+		dispatcher.Chaos(chaos)
+		logger.Warn("chaos mode: faults set at /api/admin/chaos are injected into requests, deliveries, events and notification writes")
+	}
+	dispatcher.Start(cfg.Delivery.Workers)
+	// Stuck deliveries are reclaimed while the send queue drains at shutdown too
+	go dispatcher.RunWatchdog(context.WithoutCancel(ctx), cfg.Delivery.Watchdog)
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "queue_depth",
+			Help: "Number of deliveries waiting in the send queue",
+		},
+		func() float64 { return float64(dispatcher.QueueDepth()) },
+	))
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "deliveries_in_flight",
+			Help: "Number of deliveries workers are handing to providers",
+		},
+		func() float64 { return float64(dispatcher.InFlight()) },
+	))
+	// What the HPA scales the deployment on, through prometheus-adapter; see monitoring/prometheus/prometheus-adapter.yaml
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "delivery_backlog_per_worker",
+			Help: "Deliveries queued or in flight for each delivery worker of this pod",
+		},
+		func() float64 {
+			return float64(dispatcher.QueueDepth()+dispatcher.InFlight()) / float64(max(dispatcher.Workers(), 1))
+		},
+	))
+	for _, lane := range dispatcher.Lanes() {
+		lane := lane
+		prometheus.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name:        "delivery_lane_depth",
+				Help:        "Number of deliveries waiting in each lane of the send queue",
+				ConstLabels: prometheus.Labels{"lane": lane},
+			},
+			func() float64 { return float64(dispatcher.LaneDepth(lane)) },
+		))
+	}
 
-			newNotification := Notification{
-				ID:        uuid.New().String(),
-				UserID:    req.UserID,
-				Type:      req.Type,
-				Title:     req.Title,
-				Message:   req.Message,
-				Status:    "unread",
-				CreatedAt: time.Now(),
-			}
+	// Internal pprof/expvar listener
+	startDiagnosticsServer(cfg.Diagnostics, dispatcher)
+
+	// Dependency checks backing the readiness probe
+	probes := health.NewRegistry()
+	registerDependencyChecks(probes, cfg.Health, dispatcher)
+	// New pods stay out of rotation while they are too far behind to honor sends in time
+	lag := newConsumerLag()
+	registerBacklogChecks(probes, cfg.Health, dispatcher, lag)
+
+	registerServiceChecks(probes, cfg.Health, services, []string{serviceUser, serviceOrder})
+
+	// Singleton background jobs only run on the replica holding the lease
+	elector := newLeaderElector(cfg.LeaderElection)
+	electorDone := make(chan struct{})
+	go func() {
+		elector.Run(ctx)
+		close(electorDone)
+	}()
+
+	// Templates managed as NotificationTemplate resources
+	templates := newTemplateStore()
+	templatesSynced := startTemplateController(ctx, cfg.Templates, templates, elector)
+
+	// Notification types declared as NotificationType resources
+	types := newTypeRegistry(cfg.Types)
+	typesSynced := startTypeController(ctx, cfg.Types, types, elector)
+
+	// Per-tenant rollout of new behaviors
+	flags := newFeatureFlags(ctx, cfg.FeatureFlags, cfg.LeaderElection.Identity)
+
+	// Notifications served by the API, sharded by user and indexed by ID and user
+	store := newShardedStore(cfg.Storage)
+	store.Chaos(chaos)
+	for i, name := range cfg.Storage.Shards {
+		i, labels := i, prometheus.Labels{"shard": name}
+		prometheus.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name:        "notification_store_shard_notifications",
+				Help:        "Number of notifications held by each store shard",
+				ConstLabels: labels,
+			},
+			func() float64 { return float64(store.ShardStats()[i].Notifications) },
+		))
+		prometheus.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name:        "notification_store_shard_users",
+				Help:        "Number of users whose notifications each store shard holds",
+				ConstLabels: labels,
+			},
+			func() float64 { return float64(store.ShardStats()[i].Users) },
+		))
+	}
 
-			notifications = append(notifications, newNotification)
+	// A populated inbox for frontend development and preview environments
+	if cfg.SeedData {
+		now := time.Now()
+		data, err := loadSeed(now)
+		if err == nil {
+			err = data.apply(store, templates, unsubscribes, now)
+		}
+		if err != nil {
+			logger.Error("loading seed data", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("seed data loaded", "notifications", len(data.Notifications), "templates", len(data.Templates), "preferences", len(data.Preferences))
+	}
 
-			c.JSON(http.StatusCreated, gin.H{
-				"success": true,
-				"data":    newNotification,
-			})
-		})
+	// Announcements to every user, merged into inboxes as they are listed
+	broadcasts := newBroadcastStore()
+
+	// Open notification streams, fed as notifications are created
+	hub := newNotificationHub()
+
+	// Users connected to this replica, whose pushes can be skipped while they are
+	presence := newPresenceRegistry(cfg.LeaderElection.Identity, cfg.Realtime.SkipPushWhenConnected)
+	dispatcher.SetPresence(presence)
+
+	// In an active-active deployment, writes are published to peer regions and theirs applied here
+	var repo Repository = store
+	replication := func(context.Context) error { return nil }
+	if cfg.Replication.Enabled {
+		deleted := newTombstones(replicationTombstones)
+		stream := newReplicationStream(cfg.Replication)
+		repo = newReplicatedRepository(store, cfg.Replication.Region, stream.Publish, deleted)
+		replication = stream.Close
+		applier := newReplicationApplier(cfg.Replication.Region, store, hub, deleted)
+		for _, topic := range cfg.Replication.PeerTopics {
+			go runReplicationConsumer(ctx, cfg.Replication, topic, applier)
+		}
+		logger.Info("replicating notifications", "region", cfg.Replication.Region, "topic", cfg.Replication.Topic, "peer_topics", cfg.Replication.PeerTopics)
+	}
 
-		// Get notifications by user
-		api.GET("/users/:user_id/notifications", func(c *gin.Context) {
-			userID := c.Param("user_id")
-			var userNotifications []Notification
+	// New notifications are written one by one, or in batches under write-behind
+	writer := newNotificationWriter(cfg.WriteBehind, repo, hub)
+	// Batches the store fails to write wait on local disk, in order, until it recovers
+	if cfg.WriteBehind.Enabled && cfg.WriteBehind.SpoolDir != "" {
+		if err := writer.OpenSpool(cfg.WriteBehind.SpoolDir); err != nil {
+			logger.Error("opening write spool", "dir", cfg.WriteBehind.SpoolDir, "error", err)
+			os.Exit(1)
+		}
+		go writer.Replay(ctx)
+	}
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "notification_write_buffer_depth",
+			Help: "Number of notifications waiting to be written",
+		},
+		func() float64 { return float64(writer.Buffered()) },
+	))
+
+	// Actions, images and data of new notifications, and the data of events, are checked against the content config
+	content := newContentValidator(cfg.Content)
+
+	// Past a high-water mark on the send queue or write buffer, non-critical creates are turned away
+	shedder := newLoadShedder(cfg.LoadShedding, dispatcher, writer)
+	for _, resource := range shedder.Resources() {
+		prometheus.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name:        "saturation_ratio",
+				Help:        "How full a bounded queue or buffer is, from 0 to 1",
+				ConstLabels: prometheus.Labels{"resource": resource.name},
+			},
+			resource.saturation,
+		))
+	}
 
-			for _, notification := range notifications {
-				if notification.UserID == userID {
-					userNotifications = append(userNotifications, notification)
-				}
+	// Per-tenant usage, metered for billing and capped by quotas
+	quotas := newQuotaMeter(cfg.Quotas)
+	// Spikes in a type's or tenant's volume, alarmed on and optionally throttled
+	anomalies := newAnomalyDetector(cfg.Anomalies, writer.Save)
+	if cfg.Anomalies.Enabled {
+		elector.AddJob("anomaly-detection", anomalies.Run)
+	}
+	// Lifecycle counts by type, channel and stage, rolled up for GET /api/admin/analytics
+	analytics := newAnalyticsRollups()
+
+	// Order, payment and security events produce notifications without calling the API
+	if len(cfg.Events.Brokers) > 0 {
+		publish := func(ctx context.Context, notification Notification, channels, mandatory []string) error {
+			// Retrying cannot help before the throttle or quota resets, so the
+			// event is dropped and counted in events_dropped_total
+			required := len(mandatory) > 0 || mandatoryCategory(notification.Category)
+			if err := admitVolume(anomalies, quotas, notification, channels, required); err != nil {
+				return fmt.Errorf("%w: %w", errEventRejected, err)
 			}
-
-			c.JSON(http.StatusOK, gin.H{
-				"success": true,
-				"data":    userNotifications,
-				"count":   len(userNotifications),
-			})
-		})
-
-		// Mark notification as read
-		api.PATCH("/notifications/:id/read", func(c *gin.Context) {
-			id := c.Param("id")
-			now := time.Now()
-
-			for i, notification := range notifications {
-				if notification.ID == id {
-					notifications[i].Status = "read"
-					notifications[i].ReadAt = &now
-
-					c.JSON(http.StatusOK, gin.H{
-						"success": true,
-						"data":    notifications[i],
-					})
-					return
-				}
+			// The event is redelivered, and admitted again, when it cannot be queued
+			if err := dispatcher.EnqueueMandatory(notification, channels, mandatory); err != nil {
+				quotas.Refund(notification.Tenant)
+				return err
 			}
-
-			c.JSON(http.StatusNotFound, gin.H{
-				"success": false,
-				"error":   "Notification not found",
-			})
-		})
-
-		// Delete notification
-		api.DELETE("/notifications/:id", func(c *gin.Context) {
-			id := c.Param("id")
-
-			for i, notification := range notifications {
-				if notification.ID == id {
-					deletedNotification := notifications[i]
-					notifications = append(notifications[:i], notifications[i+1:]...)
-
-					c.JSON(http.StatusOK, gin.H{
-						"success": true,
-						"data":    deletedNotification,
-					})
-					return
-				}
+			notificationsCreatedTotal.WithLabelValues(types.MetricLabel(notification.Type)).Inc()
+			// Delivery is already queued, so redelivering the event would send it twice
+			if err := writer.Save(ctx, notification); err != nil {
+				logging.FromContext(ctx).Error("notification queued for delivery but not stored", "notification_id", notification.ID, "error", err)
 			}
-
-			c.JSON(http.StatusNotFound, gin.H{
-				"success": false,
-				"error":   "Notification not found",
-			})
-		})
-
-		// Send notification (webhook endpoint)
-		api.POST("/send", func(c *gin.Context) {
-			var req CreateNotificationRequest
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"success": false,
-					"error":   "Invalid request data",
-				})
-				return
+			return nil
+		}
+		for _, pipeline := range eventPipelines(cfg.Events) {
+			if pipeline.Config.Topic == "" || len(pipeline.Config.Mappings) == 0 {
+				continue
 			}
+			handler := newEventHandler(pipeline, templates, content, types, flags, users, publish)
+			go runEventConsumer(ctx, cfg.Events, handler, lag, chaos)
+		}
+	}
 
-			// In a real application, this would send the notification
-			// via email, SMS, push notification, etc.
-			newNotification := Notification{
-				ID:        uuid.New().String(),
-				UserID:    req.UserID,
-				Type:      req.Type,
-				Title:     req.Title,
-				Message:   req.Message,
-				Status:    "sent",
-				CreatedAt: time.Now(),
-			}
+	// Connections and caches prepared before the startup probe passes
+	warmup := newWarmup()
+	warmup.AddStep("dependencies", health.CriticalProbe(probes))
+	warmup.AddStep("templates", func(ctx context.Context) error {
+		select {
+		case <-templatesSynced:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	// Until the types are loaded every type is unknown
+	warmup.AddStep("types", func(ctx context.Context) error {
+		select {
+		case <-typesSynced:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	// Until the suppressions are loaded, users who unsubscribed would be mailed again
+	if suppressionsTopic != nil {
+		warmup.AddStep("suppressions", suppressionsTopic.Loaded)
+	}
+	go warmup.Run(ctx)
+
+	var accessLog atomic.Pointer[accessLogConfig]
+	accessLog.Store(newAccessLogConfig(cfg.AccessLog))
+
+	// Apply safe settings when the mounted config file changes
+	watchConfig(ctx, configFile, 10*time.Second, cfg, func(next Config) {
+		logging.SetLevel(next.LogLevel)
+		accessLog.Store(newAccessLogConfig(next.AccessLog))
+		dispatcher.SetSLOPolicy(newSLOPolicy(next.SLO))
+		shedder.SetConfig(next.LoadShedding)
+		quotas.SetConfig(next.Quotas)
+		anomalies.SetConfig(next.Anomalies)
+		presence.SetSkipPush(next.Realtime.SkipPushWhenConnected)
+		content.SetJSONSchemas(next.Content)
+		types.SetUnknown(next.Types.Unknown)
+		flags.SetFlags(next.FeatureFlags.Flags)
+	})
 
-			notifications = append(notifications, newNotification)
+	// Shared platform middleware plus error reporting, the access log and, in chaos mode, route faults
+	handlers := []gin.HandlerFunc{accessLogMiddleware(&accessLog), compressionMiddleware(cfg.Responses.Compression)}
+	if chaos != nil {
+		handlers = append(handlers, chaos.Middleware())
+	}
+	r := server.NewEngine(server.Options{
+		Recovery:   recoveryMiddleware(newErrorReporter(cfg.ErrorReporting)),
+		Middleware: handlers,
+		Metrics:    cfg.Metrics.Options(),
+	})
 
-			// Simulate sending notification
-			log.Printf("Sending notification to user %s: %s", req.UserID, req.Title)
+	// Health check endpoint (liveness only, never touches dependencies)
+	r.GET("/health", health.LivenessHandler("notification-service", version))
+
+	// Startup and readiness probes
+	r.GET("/startup", startupHandler(warmup))
+	r.GET("/ready", health.ReadinessHandler(probes, "notification-service", warmup.Started))
+
+	// Metrics endpoint, in OpenMetrics when asked for so latency histograms carry trace exemplars
+	r.GET("/metrics", gin.WrapH(promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))))
+
+	// Triage console for operators, over the admin API
+	registerAdminUI(r)
+
+	// One-click unsubscribe from emails, and the suppressions it creates
+	registerUnsubscribeRoutes(r, unsubscribes)
+
+	// Sends to user segments, and campaigns built on them
+	segments := newSegmentSender(cfg.Segments, profiles, dispatcher, writer, content)
+	campaigns := newCampaignManager(templates, segments)
+	elector.AddJob("segment-sends", segments.leader.Run)
+	elector.AddJob("campaigns", campaigns.leader.Run)
+	// Every accepted send is appended to the delivery log, batched like notification writes
+	deliveryLog := newDeliveryLog(cfg.WriteBehind, deliveries)
+	// Other services follow each notification through the lifecycle topic
+	var lifecycle *lifecycleStream
+	if len(cfg.Events.Brokers) > 0 && cfg.Events.LifecycleTopic != "" {
+		lifecycle = newLifecycleStream(cfg.Events.Brokers, cfg.Events.LifecycleTopic)
+	}
+	dispatcher.OnDelivered(func(notification Notification, channel string) {
+		deliveryLog.Sent(notification.ID, channel, time.Now())
+		campaigns.Delivered(notification)
+		quotas.Delivered(notification, channel)
+		analytics.Delivered(notification, channel)
+		lifecycle.Delivered(notification, channel)
+	})
+	dispatcher.OnDeadLettered(func(notification Notification, channel string) {
+		analytics.Failed(notification, channel)
+		lifecycle.Failed(notification, channel)
+	})
+	writer.OnSaved(func(notification Notification) {
+		analytics.Created(notification)
+		lifecycle.Created(notification)
+	})
+	// Operator endpoints, behind the admin API key when one is set
+	if cfg.Admin.APIKey == "" {
+		logger.Warn("ADMIN_API_KEY is not set; the admin API is open to anyone who can reach the service")
+	}
+	admin := r.Group("/api/admin", adminAuth(cfg.Admin.APIKey))
+	// Runtime log level and feature flag decisions
+	logging.RegisterLevelRoutes(admin)
+	registerFeatureFlagRoutes(admin, flags)
+	registerSegmentRoutes(admin, segments)
+	registerCampaignRoutes(admin, campaigns)
+	registerQuotaRoutes(admin, quotas)
+	registerAnomalyRoutes(admin, anomalies)
+	registerAnalyticsRoutes(admin, analytics)
+
+	// Public API routes; a single notification's are only for its owner and admins
+	api := r.Group("/api", requireOwner(repo))
+
+	// Delivery receipts from providers, and the bounces and complaints they report
+	registerWebhookRoutes(api, cfg.Webhooks, deliveries, suppressions)
+	registerSuppressionRoutes(admin, suppressions)
+
+	// Messages captured in sandbox mode
+	registerSandboxRoutes(admin, outbox)
+	if shadow != nil {
+		registerShadowRoutes(admin, shadow)
+	}
+	if chaos != nil {
+		registerChaosRoutes(admin, chaos)
+	}
 
-			c.JSON(http.StatusOK, gin.H{
-				"success": true,
-				"message": "Notification sent successfully",
-				"data":    newNotification,
-			})
-		})
+	// API routes, served by the notification service over the store
+	service := newNotificationService(repo, broadcasts, writer, dispatcher, hub, presence, content, newClickTracker(), campaigns, shedder, quotas, anomalies, analytics, types, systemClock{})
+	service.SetLifecycle(lifecycle)
+	registerAPIRoutes(api, ctx, service, templates, cfg.Responses.StreamThreshold)
+	registerAdminRoutes(admin, service)
+	// Broadcast announcements, checked like created notifications
+	registerBroadcastRoutes(admin, service)
+	registerTriageRoutes(admin, service, lag)
+	registerTemplatePreviewRoutes(admin, templates)
+	registerTemplateVersionRoutes(admin, templates)
+	registerImportRoutes(admin, newImporter(service, repo))
+	registerTypeRoutes(api, admin, types)
+
+	// Authenticated WebSocket sessions, and who is connected over them or streams
+	registerWebSocketRoutes(api, ctx, service, newUpgrader(cfg.Realtime.AllowedOrigins))
+	registerPresenceRoutes(admin, presence)
+
+	// Each replica holds its own notifications, so each wakes the snoozes in them
+	// whose wake-up was lost with a restart
+	go runSnoozeSweeper(ctx, service, snoozeSweepInterval)
+
+	// Notifications past their type's retention are deleted in the background
+	elector.AddJob("retention", func(ctx context.Context) { runRetention(ctx, service, retentionInterval) })
+
+	// Notifications past the archive window are moved to object storage
+	if cfg.Archive.Enabled {
+		archive := newArchiver(cfg.Archive, newS3Store(cfg.Archive), store, types, cfg.LeaderElection.Identity)
+		elector.AddJob("archive", archive.Run)
+		registerArchiveRoutes(admin, archive)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3003"
+	port := cfg.Port
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	if err := server.ConfigureTLS(srv, cfg.Server.Options()); err != nil {
+		logger.Error("invalid TLS configuration", "error", err)
+		os.Exit(1)
 	}
+	scheme := "http"
+	if srv.TLSConfig != nil {
+		scheme = "https"
+	}
+
+	logger.Info("Notification Service running", "port", port, "tls", srv.TLSConfig != nil, "http2", srv.TLSConfig != nil && cfg.Server.HTTP2)
+	logger.Info("Health check available", "url", scheme+"://localhost:"+port+"/health")
+	logger.Info("Metrics available", "url", scheme+"://localhost:"+port+"/metrics")
 
-	log.Printf("Notification Service running on port %s", port)
-	log.Printf("Health check: http://localhost:%s/health", port)
-	log.Printf("Metrics: http://localhost:%s/metrics", port)
+	// Write buffered notifications, publish their replication changes, drain the send queue, append
+	// the last sends to the delivery log and close the suppressions writer once in-flight requests have finished
+	err = server.Serve(ctx, srv, cfg.ShutdownTimeout, probes, writer.Close, replication, dispatcher.Drain, deliveryLog.Close, lifecycle.Close, suppressionsClose)
 
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal(err)
+	// Stop singleton jobs and hand the lease to another replica
+	stop()
+	<-electorDone
+	if err != nil {
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"platform/pkg/middleware"
+	"platform/pkg/server"
+)
+
+func TestRequestMetricLabels(t *testing.T) {
+	cfg := defaultConfig().Metrics
+	cfg.StatusClasses = true
+	cfg.MaxSeries = 3
+	r := server.NewEngine(server.Options{Metrics: cfg.Options()})
+	r.GET("/metrics-test/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	serve := func(method, path string) {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+	}
+	count := func(method, endpoint, status string) float64 {
+		return testutil.ToFloat64(middleware.HTTPRequestsTotal.WithLabelValues(method, endpoint, status))
+	}
+	before := count("GET", "/metrics-test/:id", "2xx")
+
+	// Scanners probing paths and methods land in a single series
+	for _, path := range []string{"/.env", "/wp-login.php", "/admin/config.php"} {
+		serve(http.MethodGet, path)
+	}
+	serve("PROPFIND", "/.git/config")
+	serve(http.MethodGet, "/metrics-test/1")
+	serve(http.MethodGet, "/metrics-test/2")
+	if got := count("GET", middleware.UnmatchedEndpoint, "4xx"); got < 3 {
+		t.Errorf("unmatched GETs counted %v times, want at least 3", got)
+	}
+	if got := count("GET", "/metrics-test/:id", "2xx") - before; got != 2 {
+		t.Errorf("route counted %v times, want 2", got)
+	}
+
+	// Past the cap, new series are folded into one
+	overflow := count(middleware.OverflowLabel, middleware.OverflowLabel, middleware.OverflowLabel)
+	serve(http.MethodPost, "/metrics-test/3")
+	if got := count(middleware.OverflowLabel, middleware.OverflowLabel, middleware.OverflowLabel) - overflow; got != 1 {
+		t.Errorf("request past the series cap counted %v times in the overflow series, want 1", got)
+	}
+}
+
+func TestMetricsConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Metrics.DisabledLabels = []string{"status", "user_id"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("unknown disabled label accepted")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Providers that can deliver on every channel
+const (
+	providerLog  = "log"
+	providerMock = "mock"
+)
+
+// errMockFailure is a send the mock provider chose to fail
+var errMockFailure = errors.New("mock provider: simulated failure")
+
+// mockProvider simulates a delivery provider for local development
+//
+// Sends take a while and some fail, so retries, circuit breakers and
+// dead letters are exercised. Accepted sends get a receipt after a delay,
+// recorded as a provider webhook would record it; a bounced email or SMS
+// also suppresses its addresses.
+type mockProvider struct {
+	cfg          MockProviderConfig
+	records      *deliveryRecords
+	suppressions *suppressionList
+}
+
+func newMockProvider(cfg MockProviderConfig, records *deliveryRecords, suppressions *suppressionList) *mockProvider {
+	return &mockProvider{cfg: cfg, records: records, suppressions: suppressions}
+}
+
+// Sender returns the mock provider's sender for channel
+func (p *mockProvider) Sender(channel string) Sender {
+	return mockSender{channel: channel, provider: p}
+}
+
+// receipt records the delivery receipt of a send the mock provider accepted
+func (p *mockProvider) receipt(notificationID, channel string, to recipient, record deliveryRecord) {
+	p.records.Update(notificationID, record)
+	providerCallbacksTotal.WithLabelValues(providerMock, record.Status).Inc()
+	if record.Status != deliveryBounced || (channel != channelEmail && channel != channelSMS) {
+		return
+	}
+	for _, address := range to.Addresses {
+		p.suppressions.Add(suppressedAddress{Channel: channel, Address: address, Reason: suppressedBounce, Detail: record.Reason, Since: record.UpdatedAt})
+	}
+}
+
+type mockSender struct {
+	channel  string
+	provider *mockProvider
+}
+
+func (s mockSender) Send(ctx context.Context, notification Notification, to recipient) error {
+	cfg := s.provider.cfg
+	latency := cfg.Latency
+	if cfg.Jitter > 0 {
+		latency += time.Duration(rand.Int63n(int64(cfg.Jitter) + 1))
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if rand.Float64() < cfg.FailureRate {
+		return errMockFailure
+	}
+
+	record := deliveryRecord{Channel: s.channel, Status: deliveryDelivered, ProviderID: "mock-" + uuid.New().String()}
+	if rand.Float64() < cfg.BounceRate {
+		record.Status, record.Reason = deliveryBounced, "Simulated bounce"
+	}
+	time.AfterFunc(cfg.CallbackDelay, func() {
+		record.UpdatedAt = time.Now()
+		s.provider.receipt(notification.ID, s.channel, to, record)
+	})
+	return nil
+}
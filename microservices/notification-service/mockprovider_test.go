@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mockDispatcher(t *testing.T, mock MockProviderConfig, records *deliveryRecords, suppressions *suppressionList) *Dispatcher {
+	t.Helper()
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, 2, time.Millisecond, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, staticRecipients{"alice@example.com"})
+	dispatcher.UseProvider(newMockProvider(mock, records, suppressions).Sender)
+	dispatcher.SuppressAddresses(suppressions)
+	dispatcher.Start(1)
+	return dispatcher
+}
+
+func drain(t *testing.T, dispatcher *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := dispatcher.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMockProviderFailuresAreDeadLettered(t *testing.T) {
+	dispatcher := mockDispatcher(t, MockProviderConfig{FailureRate: 1}, newDeliveryRecords(), newSuppressionList())
+	dispatcher.Enqueue(Notification{ID: "1", UserID: "alice", Type: "order_status"}, []string{channelEmail})
+	drain(t, dispatcher)
+
+	dead := dispatcher.DeadLetters()
+	if len(dead) != 1 || dead[0].Attempt != 2 || !strings.Contains(dead[0].LastError, errMockFailure.Error()) {
+		t.Errorf("dead letters = %+v, want the email after 2 failed attempts", dead)
+	}
+}
+
+func TestMockProviderReceipts(t *testing.T) {
+	records, suppressions := newDeliveryRecords(), newSuppressionList()
+	dispatcher := mockDispatcher(t, MockProviderConfig{BounceRate: 1}, records, suppressions)
+	dispatcher.Enqueue(Notification{ID: "1", UserID: "alice", Type: "order_status"}, []string{channelEmail, channelPush})
+	drain(t, dispatcher)
+
+	// Receipts arrive after the sends return
+	deadline := time.Now().Add(5 * time.Second)
+	for len(records.For("1")) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	list := records.For("1")
+	if len(list) != 2 {
+		t.Fatalf("delivery records = %+v, want email and push", list)
+	}
+	for _, record := range list {
+		if record.Status != deliveryBounced || !strings.HasPrefix(record.ProviderID, "mock-") {
+			t.Errorf("%s record = %+v, want a bounce with a mock provider ID", record.Channel, record)
+		}
+	}
+	if !suppressions.Suppressed(channelEmail, "alice@example.com") {
+		t.Error("bounced email address was not suppressed")
+	}
+	if len(dispatcher.DeadLetters()) != 0 {
+		t.Errorf("dead letters = %+v, want none", dispatcher.DeadLetters())
+	}
+}
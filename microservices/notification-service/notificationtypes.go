@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// NotificationType custom resource, see k8s/base/notificationtype-crd.yaml
+const typeSourcePrefix = "NotificationType/"
+
+// Priorities a notification type can declare; clients use them to order and style notifications
+const (
+	priorityLow    = "low"
+	priorityNormal = "normal"
+	priorityHigh   = "high"
+	priorityUrgent = "urgent"
+)
+
+// What happens to notifications whose type is not registered
+const (
+	unknownTypesAllow      = "allow"
+	unknownTypesReject     = "reject"
+	unknownTypesQuarantine = "quarantine"
+)
+
+var (
+	// errUnknownType is returned for notifications of unregistered types while they are rejected
+	errUnknownType = errors.New("Unknown notification type")
+	// errTypeQuarantined is returned alongside notifications of unregistered types held in quarantine
+	errTypeQuarantined = errors.New("Unknown notification type, notification quarantined")
+)
+
+var (
+	notificationsQuarantinedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notifications_quarantined_total",
+			Help: "Total number of notifications of unregistered types held in quarantine",
+		},
+		[]string{"type"},
+	)
+
+	notificationsExpiredTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notifications_expired_total",
+			Help: "Total number of notifications deleted once past their type's retention",
+		},
+		[]string{"type"},
+	)
+)
+
+// NotificationType declares a kind of notification and what its notifications default to
+type NotificationType struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// DefaultChannels are used by sends that name no channels
+	DefaultChannels []string `json:"default_channels,omitempty"`
+	Priority        string   `json:"priority"`
+	// Retention is how long unpinned notifications are kept, e.g. 720h; empty keeps them
+	Retention string `json:"retention,omitempty"`
+	// TenantRetention overrides Retention for the notifications of some tenants
+	TenantRetention map[string]string `json:"tenant_retention,omitempty"`
+	// Icon is an https URL or the name of an icon bundled with the client apps
+	Icon string `json:"icon,omitempty"`
+	// Schema is a JSON Schema (draft 2020-12) the notifications' data must match
+	Schema map[string]any `json:"schema,omitempty"`
+	// Source records where the type came from, e.g. the CR it was synced from
+	Source string `json:"source"`
+
+	retention       time.Duration
+	tenantRetention map[string]time.Duration
+	schema          *jsonschema.Schema
+}
+
+// compile parses the retention and schema and checks the other fields
+func (t *NotificationType) compile() error {
+	for _, channel := range t.DefaultChannels {
+		if channel != channelEmail && channel != channelSMS && channel != channelPush {
+			return fmt.Errorf("defaultChannels: %q must be email, sms or push", channel)
+		}
+	}
+	switch t.Priority {
+	case "":
+		t.Priority = priorityNormal
+	case priorityLow, priorityNormal, priorityHigh, priorityUrgent:
+	default:
+		return fmt.Errorf("priority: %q must be low, normal, high or urgent", t.Priority)
+	}
+	t.retention = 0
+	if t.Retention != "" {
+		retention, err := time.ParseDuration(t.Retention)
+		if err != nil || retention <= 0 {
+			return fmt.Errorf("retention: %q must be a positive duration such as 720h", t.Retention)
+		}
+		t.retention = retention
+	}
+	t.tenantRetention = nil
+	for tenant, value := range t.TenantRetention {
+		retention, err := time.ParseDuration(value)
+		if tenant == "" || err != nil || retention <= 0 {
+			return fmt.Errorf("tenantRetention: %q for tenant %q must be a positive duration such as 720h", value, tenant)
+		}
+		if t.tenantRetention == nil {
+			t.tenantRetention = make(map[string]time.Duration, len(t.TenantRetention))
+		}
+		t.tenantRetention[tenant] = retention
+	}
+	t.schema = nil
+	if t.Schema != nil {
+		schema, err := compileDataSchema(t.Name, t.Schema)
+		if err != nil {
+			return fmt.Errorf("schema: %w", err)
+		}
+		t.schema = schema
+	}
+	return nil
+}
+
+// ValidateData checks data against the type's schema; a nil type or one without a schema accepts anything
+func (t *NotificationType) ValidateData(data map[string]any) error {
+	if t == nil || t.schema == nil {
+		return nil
+	}
+	return validateData(t.schema, t.Name, data)
+}
+
+// RetentionFor returns how long the type's notifications of tenant are kept, 0 for forever
+func (t *NotificationType) RetentionFor(tenant string) time.Duration {
+	if retention, ok := t.tenantRetention[tenant]; ok {
+		return retention
+	}
+	return t.retention
+}
+
+// apply sets the type's priority and icon on notification; a nil type leaves it unchanged
+func (t *NotificationType) apply(notification *Notification) {
+	if t == nil {
+		return
+	}
+	notification.Priority = t.Priority
+	notification.Icon = t.Icon
+}
+
+// typeRegistry holds the notification types known to this replica and what
+// happens to notifications of other types
+type typeRegistry struct {
+	mu    sync.RWMutex
+	types map[string]*NotificationType
+
+	unknown atomic.Pointer[string]
+
+	quarantineMu   sync.Mutex
+	quarantined    []Notification
+	quarantineSize int
+}
+
+func newTypeRegistry(cfg TypesConfig) *typeRegistry {
+	r := &typeRegistry{types: make(map[string]*NotificationType), quarantineSize: cfg.QuarantineSize}
+	r.SetUnknown(cfg.Unknown)
+	return r
+}
+
+// SetUnknown changes what happens to notifications of unregistered types: allow, reject or quarantine
+func (r *typeRegistry) SetUnknown(policy string) {
+	r.unknown.Store(&policy)
+}
+
+// Put compiles and stores t, replacing any type with the same name
+func (r *typeRegistry) Put(t NotificationType) error {
+	if err := t.compile(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[t.Name] = &t
+	return nil
+}
+
+// Delete removes the type called name
+func (r *typeRegistry) Delete(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.types, name)
+}
+
+// Replace swaps every type whose source starts with sourcePrefix for the given set, e.g. after a relist
+func (r *typeRegistry) Replace(sourcePrefix string, types []NotificationType) {
+	compiled := make(map[string]*NotificationType, len(types))
+	for i := range types {
+		if types[i].compile() == nil {
+			compiled[types[i].Name] = &types[i]
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, t := range r.types {
+		if strings.HasPrefix(t.Source, sourcePrefix) {
+			delete(r.types, name)
+		}
+	}
+	for name, t := range compiled {
+		r.types[name] = t
+	}
+}
+
+// Get returns the type called name
+func (r *typeRegistry) Get(name string) (*NotificationType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.types[name]
+	return t, ok
+}
+
+// List returns every type sorted by name
+func (r *typeRegistry) List() []*NotificationType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]*NotificationType, 0, len(r.types))
+	for _, t := range r.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// Resolve returns the type called name, or nil for an unregistered type that is allowed
+//
+// Unregistered types fail with errUnknownType while they are rejected and
+// with errTypeQuarantined while they are quarantined.
+func (r *typeRegistry) Resolve(name string) (*NotificationType, error) {
+	if t, ok := r.Get(name); ok {
+		return t, nil
+	}
+	switch *r.unknown.Load() {
+	case unknownTypesReject:
+		return nil, fmt.Errorf("%w: %s", errUnknownType, name)
+	case unknownTypesQuarantine:
+		return nil, fmt.Errorf("%w: %s", errTypeQuarantined, name)
+	}
+	return nil, nil
+}
+
+// unregisteredTypeLabel stands in for every unregistered type on metrics, keeping their label values bounded
+const unregisteredTypeLabel = "unregistered"
+
+// MetricLabel returns name for a registered type and unregisteredTypeLabel otherwise
+func (r *typeRegistry) MetricLabel(name string) string {
+	if _, ok := r.Get(name); ok {
+		return name
+	}
+	return unregisteredTypeLabel
+}
+
+// DefaultChannels returns the channels a send of type name uses when it names none, email unless the type says otherwise
+func (r *typeRegistry) DefaultChannels(name string) []string {
+	if t, ok := r.Get(name); ok && len(t.DefaultChannels) > 0 {
+		return slices.Clone(t.DefaultChannels)
+	}
+	return []string{channelEmail}
+}
+
+// Quarantine holds notification for review, dropping the oldest one when the quarantine is full
+func (r *typeRegistry) Quarantine(notification Notification) {
+	r.quarantineMu.Lock()
+	defer r.quarantineMu.Unlock()
+	if len(r.quarantined) == r.quarantineSize {
+		r.quarantined = append(r.quarantined[:0], r.quarantined[1:]...)
+	}
+	r.quarantined = append(r.quarantined, notification)
+	notificationsQuarantinedTotal.WithLabelValues(notification.Type).Inc()
+}
+
+// Quarantined returns the notifications held in quarantine, oldest first
+func (r *typeRegistry) Quarantined() []Notification {
+	r.quarantineMu.Lock()
+	defer r.quarantineMu.Unlock()
+	return append([]Notification{}, r.quarantined...)
+}
+
+// Retention returns how long notification is kept under its type and tenant, 0 for forever
+func (r *typeRegistry) Retention(notification Notification) time.Duration {
+	if t, ok := r.Get(notification.Type); ok {
+		return t.RetentionFor(notification.Tenant)
+	}
+	return 0
+}
+
+// Expired reports whether notification is past its retention; pinned notifications never expire
+func (r *typeRegistry) Expired(notification Notification, now time.Time) bool {
+	retention := r.Retention(notification)
+	return retention > 0 && !notification.Pinned && now.Sub(notification.CreatedAt) > retention
+}
+
+// retentionInterval is how often notifications past their type's retention are looked for
+const retentionInterval = 10 * time.Minute
+
+// runRetention deletes notifications past their type's retention every interval until ctx is cancelled
+func runRetention(ctx context.Context, service *notificationService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.Expire(ctx)
+		}
+	}
+}
+
+// registerTypeRoutes lists the registered types for clients and the quarantine for operators
+func registerTypeRoutes(api, admin *gin.RouterGroup, types *typeRegistry) {
+	api.GET("/types", func(c *gin.Context) {
+		list := types.List()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	})
+
+	admin.GET("/types/quarantine", func(c *gin.Context) {
+		list := types.Quarantined()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	})
+}
+
+// typeResource mirrors the NotificationType custom resource
+type typeResource struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   objectMeta     `json:"metadata"`
+	Spec       typeSpec       `json:"spec"`
+	Status     resourceStatus `json:"status,omitempty"`
+}
+
+type typeSpec struct {
+	// Type names the notification type when it is not a valid resource name, e.g. order_status
+	Type            string            `json:"type,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	DefaultChannels []string          `json:"defaultChannels,omitempty"`
+	Priority        string            `json:"priority,omitempty"`
+	Retention       string            `json:"retention,omitempty"`
+	TenantRetention map[string]string `json:"tenantRetention,omitempty"`
+	Icon            string            `json:"icon,omitempty"`
+	Schema          map[string]any    `json:"schema,omitempty"`
+}
+
+// typeName is spec.type, or the resource name when that is unset
+func (r typeResource) typeName() string {
+	if r.Spec.Type != "" {
+		return r.Spec.Type
+	}
+	return r.Metadata.Name
+}
+
+// typeController syncs NotificationType resources into the type registry
+//
+// Like the template controller, every replica keeps its own registry in sync
+// and only the leader writes status back.
+type typeController struct {
+	client    *kubeClient
+	namespace string
+	registry  *typeRegistry
+	elector   *LeaderElector
+
+	synced     chan struct{}
+	syncedOnce sync.Once
+}
+
+// startTypeController watches NotificationType resources until ctx is cancelled
+//
+// The returned channel is closed once the types have been loaded.
+func startTypeController(ctx context.Context, cfg TypesConfig, registry *typeRegistry, elector *LeaderElector) <-chan struct{} {
+	synced := make(chan struct{})
+	if !cfg.ControllerEnabled {
+		close(synced)
+		return synced
+	}
+
+	client, err := newInClusterKubeClient()
+	if err != nil {
+		slog.Warn("notification type controller disabled", "error", err)
+		close(synced)
+		return synced
+	}
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = client.namespace
+	}
+
+	c := &typeController{client: client, namespace: namespace, registry: registry, elector: elector, synced: synced}
+	go syncResources(ctx, client, c.path(""), "notification type", resourceHandler[typeResource]{
+		listed:  c.listed,
+		changed: c.apply,
+		deleted: func(resource typeResource) {
+			registry.Delete(resource.typeName())
+			slog.Info("notification type removed", "type", resource.typeName())
+		},
+	})
+	return synced
+}
+
+func (c *typeController) path(name string) string {
+	path := fmt.Sprintf("/apis/%s/namespaces/%s/notificationtypes", templateAPIVersion, c.namespace)
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// listed replaces the types with the valid ones of a fresh list
+func (c *typeController) listed(ctx context.Context, resources []typeResource) {
+	valid := make([]NotificationType, 0, len(resources))
+	for _, resource := range resources {
+		t := typeFromResource(resource)
+		err := t.compile()
+		if err == nil {
+			valid = append(valid, t)
+		}
+		c.reportStatus(ctx, resource, err)
+	}
+	c.registry.Replace(typeSourcePrefix, valid)
+	c.syncedOnce.Do(func() { close(c.synced) })
+
+	slog.Info("notification types synced", "count", len(valid), "invalid", len(resources)-len(valid))
+}
+
+// apply stores a changed type, keeping the last good version if it is invalid
+func (c *typeController) apply(ctx context.Context, resource typeResource) {
+	err := c.registry.Put(typeFromResource(resource))
+	if err != nil {
+		slog.Warn("rejected invalid notification type", "type", resource.typeName(), "error", err)
+	} else {
+		slog.Info("notification type updated", "type", resource.typeName(),
+			"generation", resource.Metadata.Generation)
+	}
+	c.reportStatus(ctx, resource, err)
+}
+
+func typeFromResource(resource typeResource) NotificationType {
+	return NotificationType{
+		Name:            resource.typeName(),
+		Description:     resource.Spec.Description,
+		DefaultChannels: resource.Spec.DefaultChannels,
+		Priority:        resource.Spec.Priority,
+		Retention:       resource.Spec.Retention,
+		TenantRetention: resource.Spec.TenantRetention,
+		Icon:            resource.Spec.Icon,
+		Schema:          resource.Spec.Schema,
+		Source:          typeSourcePrefix + resource.Metadata.Namespace + "/" + resource.Metadata.Name,
+	}
+}
+
+// reportStatus sets the Ready condition on the resource when this replica is the leader
+func (c *typeController) reportStatus(ctx context.Context, resource typeResource, syncErr error) {
+	if !c.elector.IsLeader() {
+		return
+	}
+	status, changed := readyStatus(resource.Status, resource.Metadata.Generation, syncErr, "InvalidType", "Type registered")
+	if !changed {
+		return
+	}
+	resource.Status = status
+
+	// A conflict means a newer version is on its way through the watch
+	err := c.client.do(ctx, http.MethodPut, c.path(resource.Metadata.Name)+"/status", resource, nil)
+	if err != nil && !isKubeStatus(err, http.StatusConflict) {
+		slog.Warn("failed to update notification type status", "type", resource.Metadata.Name, "error", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUnknownTypes(t *testing.T) {
+	store := newNotificationStore()
+	service := testService(store, newBroadcastStore(), systemClock{})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAPIRoutes(r.Group("/api"), context.Background(), service, newTemplateStore(), defaultConfig().Responses.StreamThreshold)
+	registerTypeRoutes(r.Group("/api"), r.Group("/admin"), service.types)
+	if err := service.types.Put(NotificationType{Name: "info"}); err != nil {
+		t.Fatal(err)
+	}
+	create := func(notificationType string) int {
+		body, _ := json.Marshal(CreateNotificationRequest{UserID: "alice", Type: notificationType, Title: "Hi", Message: "Hello"})
+		req := httptest.NewRequest(http.MethodPost, "/api/notifications", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := create("mystery"); code != http.StatusCreated {
+		t.Errorf("unknown type while allowed returned %d, want 201", code)
+	}
+
+	// Unless configured otherwise, only declared types are accepted
+	service.types.SetUnknown(defaultConfig().Types.Unknown)
+	if code := create("mystery"); code != http.StatusBadRequest {
+		t.Errorf("unknown type by default returned %d, want 400", code)
+	}
+	if code := create("info"); code != http.StatusCreated {
+		t.Errorf("registered type while rejecting returned %d, want 201", code)
+	}
+
+	service.types.SetUnknown(unknownTypesQuarantine)
+	if code := create("mystery"); code != http.StatusAccepted {
+		t.Errorf("unknown type while quarantined returned %d, want 202", code)
+	}
+	if got := len(store.ListByUser("alice")); got != 2 {
+		t.Errorf("stored %d notifications, want the quarantined one held back", got)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/types/quarantine", nil))
+	var quarantine struct {
+		Data []Notification `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &quarantine); err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantine.Data) != 1 || quarantine.Data[0].Type != "mystery" {
+		t.Errorf("quarantine holds %+v, want the mystery notification", quarantine.Data)
+	}
+}
+
+func TestTypeDefaults(t *testing.T) {
+	service := testService(newNotificationStore(), newBroadcastStore(), systemClock{})
+	err := service.types.Put(NotificationType{
+		Name:            "security",
+		DefaultChannels: []string{channelEmail, channelPush},
+		Priority:        priorityUrgent,
+		Icon:            "shield",
+		Schema: map[string]any{
+			"type":     "object",
+			"required": []any{"ip"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := SendNotificationRequest{CreateNotificationRequest: CreateNotificationRequest{
+		UserID: "alice", Type: "security", Title: "New sign-in", Message: "From a new device",
+		Data: map[string]any{"ip": "203.0.113.7"},
+	}}
+	notification, channels, err := service.prepareSend(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 2 || channels[1] != channelPush {
+		t.Errorf("channels %v, want the type's default channels", channels)
+	}
+	if notification.Priority != priorityUrgent || notification.Icon != "shield" {
+		t.Errorf("priority %q and icon %q, want the type's", notification.Priority, notification.Icon)
+	}
+
+	req.Data = nil
+	if _, _, err := service.prepareSend(context.Background(), req); !errors.Is(err, errInvalidData) {
+		t.Errorf("data failing the type's schema returned %v, want errInvalidData", err)
+	}
+
+	// Types that set no priority are normal
+	if err := service.types.Put(NotificationType{Name: "info"}); err != nil {
+		t.Fatal(err)
+	}
+	if kind, _ := service.types.Get("info"); kind.Priority != priorityNormal {
+		t.Errorf("priority %q, want normal", kind.Priority)
+	}
+	if err := service.types.Put(NotificationType{Name: "bad", Retention: "forever"}); err == nil {
+		t.Error("type with an invalid retention was registered")
+	}
+	if err := service.types.Put(NotificationType{Name: "bad", TenantRetention: map[string]string{"acme": "-1h"}}); err == nil {
+		t.Error("type with an invalid tenant retention was registered")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	store := newNotificationStore()
+	clock := newFakeClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	service := testService(store, newBroadcastStore(), clock)
+	if err := service.types.Put(NotificationType{Name: "order_status", Retention: "24h", TenantRetention: map[string]string{"acme": "48h"}}); err != nil {
+		t.Fatal(err)
+	}
+	old := Notification{ID: "old", UserID: "alice", Type: "order_status", CreatedAt: clock.Now()}
+	// acme keeps its notifications for longer
+	kept := Notification{ID: "kept", UserID: "alice", Type: "order_status", Tenant: "acme", CreatedAt: clock.Now()}
+	pinned := Notification{ID: "pinned", UserID: "alice", Type: "order_status", Pinned: true, CreatedAt: clock.Now()}
+	other := Notification{ID: "other", UserID: "alice", Type: "info", CreatedAt: clock.Now()}
+	for _, notification := range []Notification{old, kept, pinned, other} {
+		store.Add(notification)
+	}
+	clock.Advance(12 * time.Hour)
+	fresh := Notification{ID: "fresh", UserID: "alice", Type: "order_status", CreatedAt: clock.Now()}
+	store.Add(fresh)
+
+	clock.Advance(13 * time.Hour)
+	if deleted := service.Expire(context.Background()); deleted != 1 {
+		t.Errorf("expired %d notifications, want 1", deleted)
+	}
+	if _, ok := store.Get("old"); ok {
+		t.Error("notification past its type's retention was kept")
+	}
+	for _, id := range []string{"kept", "pinned", "other", "fresh"} {
+		if _, ok := store.Get(id); !ok {
+			t.Errorf("notification %s was deleted", id)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"notification-service/internal/httpclient"
+)
+
+// errObjectNotFound is returned for keys missing from the object store
+var errObjectNotFound = errors.New("object not found")
+
+// objectStore keeps archived notifications
+type objectStore interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns every key starting with prefix, in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// s3Store is a minimal client for the S3 API, signed with AWS Signature Version 4
+//
+// Buckets are addressed path-style, so the same client works against AWS,
+// GCS through its S3-compatible XML API with HMAC keys, and MinIO.
+type s3Store struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	http      *httpclient.Client
+	now       func() time.Time
+}
+
+func newS3Store(cfg ArchiveConfig) *s3Store {
+	opts := httpclient.DefaultOptions()
+	// Archive objects are much larger than calls to sibling services
+	opts.AttemptTimeout = time.Minute
+	return &s3Store{
+		endpoint:  strings.TrimSuffix(cfg.Endpoint, "/"),
+		region:    cfg.Region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKeyID,
+		secretKey: cfg.SecretAccessKey,
+		http:      httpclient.New(opts),
+		now:       time.Now,
+	}
+}
+
+// s3APIError is a non-2xx response from the object store
+type s3APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *s3APIError) Error() string {
+	return fmt.Sprintf("object store returned %d: %s", e.StatusCode, e.Message)
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, "/"+key, nil, body, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, "/"+key, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, "/"+key, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "/", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !page.IsTruncated {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// do sends a signed request for path within the bucket, returning non-2xx responses as errors
+func (s *s3Store) do(ctx context.Context, method, path string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	// Keys are sent exactly as they are signed, with everything but unreserved characters escaped
+	u.Path = "/" + s.bucket + path
+	u.RawPath = "/" + s.bucket + s3EscapePath(path)
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body)
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet && path != "/" {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", errObjectNotFound, path)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &s3APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 headers for body to req
+func (s *s3Store) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{"host": req.URL.Host, "x-amz-content-sha256": payloadHash, "x-amz-date": amzDate}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers = append(headers, "content-type")
+		values["content-type"] = contentType
+	}
+	sort.Strings(headers)
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// s3EscapePath escapes each segment of path as Signature Version 4 expects
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		var escaped strings.Builder
+		for _, b := range []byte(segment) {
+			if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || strings.IndexByte("-._~", b) >= 0 {
+				escaped.WriteByte(b)
+			} else {
+				fmt.Fprintf(&escaped, "%%%02X", b)
+			}
+		}
+		segments[i] = escaped.String()
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"notification-service/internal/discovery"
+	"notification-service/internal/httpclient"
+	"platform/pkg/reqctx"
+)
+
+// serviceStatusError is a non-2xx response from a sibling service
+type serviceStatusError struct {
+	Service    string
+	StatusCode int
+}
+
+func (e *serviceStatusError) Error() string {
+	return fmt.Sprintf("%s returned %d", e.Service, e.StatusCode)
+}
+
+// isServiceStatus reports whether err is a response from a sibling service with the given status
+func isServiceStatus(err error, code int) bool {
+	var statusErr *serviceStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == code
+}
+
+// newOutboundClient returns the HTTP client shared by webhook and service calls
+//
+// Requests carry the caller's request ID and tenant so they can be traced
+// through the sibling services.
+func newOutboundClient() *httpclient.Client {
+	opts := httpclient.DefaultOptions()
+	opts.Decorate = func(req *http.Request) {
+		reqctx.SetOutboundHeaders(req.Context(), req)
+	}
+	return httpclient.New(opts)
+}
+
+// serviceClient makes JSON calls to sibling services located through discovery
+type serviceClient struct {
+	http     *httpclient.Client
+	services *discovery.Client
+}
+
+func newServiceClient(outbound *httpclient.Client, services *discovery.Client) *serviceClient {
+	return &serviceClient{http: outbound, services: services}
+}
+
+// doJSON calls path on service, decoding a 2xx JSON response into out
+//
+// ctx should be the inbound request's context so the call is abandoned
+// when the caller gives up.
+func (c *serviceClient) doJSON(ctx context.Context, service, method, path string, body, out any) error {
+	endpoint, err := c.services.Endpoint(ctx, service)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.services.ReportFailure(endpoint)
+		}
+		return fmt.Errorf("%s: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		c.services.ReportFailure(endpoint)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &serviceStatusError{Service: service, StatusCode: resp.StatusCode}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
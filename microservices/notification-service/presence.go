@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Transports a user can be connected over
+const (
+	transportWebSocket = "websocket"
+	transportSSE       = "sse"
+)
+
+var presenceConnectedUsers = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "presence_connected_users",
+		Help: "Number of users with at least one open real-time connection to this replica",
+	},
+)
+
+// presenceSession is one open real-time connection
+type presenceSession struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Transport   string    `json:"transport"`
+	Replica     string    `json:"replica"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// presenceRegistry tracks which users have a stream or WebSocket open on this replica
+//
+// Like the streams themselves, presence is per replica: a user connected
+// to another replica is not seen here, and the admin API lists only this
+// replica's sessions. Only authenticated connections of the user count.
+type presenceRegistry struct {
+	replica string
+	now     func() time.Time
+	// skipPush drops push deliveries to connected users, who already see the notification live
+	skipPush atomic.Bool
+
+	mu       sync.Mutex
+	sessions map[string]map[string]presenceSession
+}
+
+func newPresenceRegistry(replica string, skipPush bool) *presenceRegistry {
+	p := &presenceRegistry{replica: replica, now: time.Now, sessions: make(map[string]map[string]presenceSession)}
+	p.skipPush.Store(skipPush)
+	return p
+}
+
+// SetSkipPush turns the push-skipping policy on or off
+func (p *presenceRegistry) SetSkipPush(skip bool) {
+	p.skipPush.Store(skip)
+}
+
+// Connect records a connection of userID over transport, returning a function that ends it
+func (p *presenceRegistry) Connect(userID, tenant, transport string) func() {
+	session := presenceSession{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Tenant:      tenant,
+		Transport:   transport,
+		Replica:     p.replica,
+		ConnectedAt: p.now(),
+	}
+	p.mu.Lock()
+	if p.sessions[userID] == nil {
+		p.sessions[userID] = make(map[string]presenceSession)
+	}
+	p.sessions[userID][session.ID] = session
+	presenceConnectedUsers.Set(float64(len(p.sessions)))
+	p.mu.Unlock()
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.sessions[userID], session.ID)
+		if len(p.sessions[userID]) == 0 {
+			delete(p.sessions, userID)
+		}
+		presenceConnectedUsers.Set(float64(len(p.sessions)))
+	}
+}
+
+// Connected reports whether userID has a connection open
+func (p *presenceRegistry) Connected(userID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sessions[userID]) > 0
+}
+
+// SkipPush reports whether a push to userID should be skipped because they are connected to this replica
+func (p *presenceRegistry) SkipPush(userID string) bool {
+	return p != nil && p.skipPush.Load() && p.Connected(userID)
+}
+
+// Sessions returns userID's connections, or every connection when userID is empty, oldest first
+func (p *presenceRegistry) Sessions(userID string) []presenceSession {
+	p.mu.Lock()
+	sessions := []presenceSession{}
+	for user, byID := range p.sessions {
+		if userID != "" && user != userID {
+			continue
+		}
+		for _, session := range byID {
+			sessions = append(sessions, session)
+		}
+	}
+	p.mu.Unlock()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ConnectedAt.Before(sessions[j].ConnectedAt) })
+	return sessions
+}
+
+// registerPresenceRoutes lists who is connected to this replica for operators
+func registerPresenceRoutes(admin *gin.RouterGroup, presence *presenceRegistry) {
+	list := func(c *gin.Context) {
+		sessions := presence.Sessions(c.Param("user_id"))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    sessions,
+			"count":   len(sessions),
+		})
+	}
+	admin.GET("/presence", list)
+	admin.GET("/presence/:user_id", list)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits past which a rendered template is likely to be cut short
+const (
+	// emailMaxSubject is where mail clients start truncating subjects
+	emailMaxSubject = 78
+	// pushMaxTitle and pushMaxBody are what devices show before truncating
+	pushMaxTitle = 65
+	pushMaxBody  = 240
+	// pushMaxPayload is the APNs and FCM payload limit in bytes
+	pushMaxPayload = 4096
+)
+
+// GSM 03.38 characters, which SMS packs 160 to a message; the extension
+// characters take two places each. Other text is sent as UCS-2, 70 to a message.
+const (
+	gsm7Basic     = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "^{}\\[~]|€\f"
+)
+
+// emailHTML lays an email's message out as escaped paragraphs, split on blank lines
+var emailHTML = htmltemplate.Must(htmltemplate.New("email").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body>
+{{range .Paragraphs}}<p>{{range $i, $line := .}}{{if $i}}<br>{{end}}{{$line}}{{end}}</p>
+{{end}}</body></html>
+`))
+
+// templatePreviewRequest is the variables a template is previewed with, and on which channels
+type templatePreviewRequest struct {
+	Variables map[string]any `json:"variables"`
+	// Channels default to the template's channel, or every channel when it has none
+	Channels []string `json:"channels"`
+}
+
+// channelPreview is a template as rendered for one channel
+type channelPreview struct {
+	Channel string `json:"channel"`
+	// Subject and HTML are set for email
+	Subject string `json:"subject,omitempty"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+	// Segments is how many messages an SMS is split into
+	Segments int `json:"segments,omitempty"`
+	// Payload is the push notification as handed to the provider
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Warnings []string        `json:"warnings"`
+}
+
+// templatePreview is a template rendered with sample variables on each channel
+type templatePreview struct {
+	Template string           `json:"template"`
+	Title    string           `json:"title"`
+	Message  string           `json:"message"`
+	Channels []channelPreview `json:"channels"`
+}
+
+// previewTemplate renders t with variables for each of channels, warning about what may not come out as intended
+func previewTemplate(t *NotificationTemplate, variables map[string]any, channels []string) (templatePreview, error) {
+	title, message, err := t.Render(variables)
+	if err != nil {
+		return templatePreview{}, err
+	}
+	preview := templatePreview{Template: t.Name, Title: title, Message: message}
+
+	// Warnings about the rendering itself apply on every channel
+	var common []string
+	if title == "" {
+		common = append(common, "subject renders empty")
+	}
+	if message == "" {
+		common = append(common, "body renders empty")
+	}
+	if strings.Contains(title, "<no value>") || strings.Contains(message, "<no value>") {
+		common = append(common, "a variable is null and renders as <no value>")
+	}
+
+	for _, channel := range channels {
+		p := channelPreview{Channel: channel, Warnings: append([]string{}, common...)}
+		if t.Channel != "" && t.Channel != channel {
+			p.Warnings = append(p.Warnings, fmt.Sprintf("template is written for %s", t.Channel))
+		}
+		switch channel {
+		case channelEmail:
+			p.Subject, p.Text = title, message
+			p.HTML, err = renderEmailHTML(title, message)
+			if err != nil {
+				return templatePreview{}, err
+			}
+			if n := utf8.RuneCountInString(title); n > emailMaxSubject {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("subject is %d characters; mail clients may cut it at %d", n, emailMaxSubject))
+			}
+		case channelSMS:
+			p.Text = message
+			segments, gsm7 := smsSegments(message)
+			p.Segments = segments
+			if segments > 1 {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("message is sent as %d SMS segments", segments))
+			}
+			if !gsm7 {
+				p.Warnings = append(p.Warnings, "message has characters outside the GSM 7-bit alphabet, so each segment holds 70 characters")
+			}
+		case channelPush:
+			p.Text = message
+			p.Payload, _ = json.Marshal(map[string]string{"title": title, "body": message})
+			if n := utf8.RuneCountInString(title); n > pushMaxTitle {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("title is %d characters; devices may cut it at %d", n, pushMaxTitle))
+			}
+			if n := utf8.RuneCountInString(message); n > pushMaxBody {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("body is %d characters; devices may cut it at %d", n, pushMaxBody))
+			}
+			if len(p.Payload) > pushMaxPayload {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("payload is %d bytes, over the %d byte limit of push providers", len(p.Payload), pushMaxPayload))
+			}
+		}
+		preview.Channels = append(preview.Channels, p)
+	}
+	return preview, nil
+}
+
+// renderEmailHTML renders the HTML part of an email with subject and message
+func renderEmailHTML(subject, message string) (string, error) {
+	var paragraphs [][]string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			paragraphs = append(paragraphs, strings.Split(paragraph, "\n"))
+		}
+	}
+	var html bytes.Buffer
+	err := emailHTML.Execute(&html, struct {
+		Subject    string
+		Paragraphs [][]string
+	}{subject, paragraphs})
+	return html.String(), err
+}
+
+// smsSegments returns how many SMS messages text is split into, and whether it fits the GSM 7-bit alphabet
+func smsSegments(text string) (int, bool) {
+	septets := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			septets++
+		case strings.ContainsRune(gsm7Extension, r):
+			septets += 2
+		default:
+			units := len(utf16.Encode([]rune(text)))
+			if units <= 70 {
+				return 1, false
+			}
+			return (units + 66) / 67, false
+		}
+	}
+	if septets <= 160 {
+		return 1, true
+	}
+	return (septets + 152) / 153, true
+}
+
+// registerTemplatePreviewRoutes adds the admin endpoint rendering a template for authors to check
+func registerTemplatePreviewRoutes(admin *gin.RouterGroup, templates *templateStore) {
+	admin.POST("/templates/:name/preview", func(c *gin.Context) {
+		var req templatePreviewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		t, err := templates.Get(c.Param("name"))
+		if errors.Is(err, errTemplateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Template not found",
+			})
+			return
+		}
+
+		all := []string{channelEmail, channelSMS, channelPush}
+		channels := req.Channels
+		if len(channels) == 0 && t.Channel != "" {
+			channels = []string{t.Channel}
+		}
+		if len(channels) == 0 {
+			channels = all
+		}
+		for _, channel := range channels {
+			if !slices.Contains(all, channel) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"error":   "Unknown channel: " + channel,
+				})
+				return
+			}
+		}
+
+		preview, err := previewTemplate(t, req.Variables, channels)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    preview,
+		})
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTemplatePreview(t *testing.T) {
+	templates := newTemplateStore()
+	templates.Put(NotificationTemplate{
+		Name:    "order_shipped",
+		Subject: "Order {{.order_id}} has shipped",
+		Body:    "Hi {{.name}},\n\nYour parcel is on its way.\nTrack it with {{.carrier}}.",
+	})
+	r := gin.New()
+	admin := r.Group("/api/admin")
+	registerAdminRoutes(admin, testService(newNotificationStore(), newBroadcastStore(), systemClock{}))
+	registerTemplatePreviewRoutes(admin, templates)
+	preview := func(name, body string) (*httptest.ResponseRecorder, templatePreview) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/admin/templates/"+name+"/preview", strings.NewReader(body)))
+		var resp struct {
+			Data templatePreview `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp.Data
+	}
+
+	rec, p := preview("order_shipped", `{"variables":{"order_id":"A-42","name":"<Alice>","carrier":"Ünïcode Post"}}`)
+	if rec.Code != http.StatusOK || p.Title != "Order A-42 has shipped" || len(p.Channels) != 3 {
+		t.Fatalf("preview returned %d: %s", rec.Code, rec.Body)
+	}
+	email, sms, push := p.Channels[0], p.Channels[1], p.Channels[2]
+	if !strings.Contains(email.HTML, "<p>Hi &lt;Alice&gt;,</p>") || !strings.Contains(email.HTML, "on its way.<br>Track") {
+		t.Errorf("email HTML = %s, want escaped paragraphs", email.HTML)
+	}
+	if sms.Segments != 1 || len(sms.Warnings) != 1 {
+		t.Errorf("sms = %+v, want one segment and a warning about non-GSM characters", sms)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal(push.Payload, &payload); err != nil || payload["title"] != p.Title {
+		t.Errorf("push payload = %s, want the rendered title", push.Payload)
+	}
+
+	// A long SMS is split, and warned about
+	_, p = preview("order_shipped", `{"variables":{"order_id":"A-42","name":"Alice","carrier":"`+strings.Repeat("x", 200)+`"},"channels":["sms"]}`)
+	if len(p.Channels) != 1 || p.Channels[0].Segments != 2 || len(p.Channels[0].Warnings) != 1 {
+		t.Errorf("long SMS = %+v, want 2 segments and a warning", p.Channels)
+	}
+
+	// Missing variables fail the preview as they would fail a send
+	if rec, _ := preview("order_shipped", `{"variables":{"order_id":"A-42"}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing variable returned %d, want 400", rec.Code)
+	}
+	if rec, _ := preview("nope", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown template returned %d, want 404", rec.Code)
+	}
+}
+
+func TestSMSSegments(t *testing.T) {
+	for text, want := range map[string]int{
+		strings.Repeat("a", 160): 1,
+		strings.Repeat("a", 161): 2,
+		strings.Repeat("€", 80):  1,
+		strings.Repeat("é", 160): 1,
+		strings.Repeat("ą", 70):  1,
+		strings.Repeat("ą", 71):  2,
+	} {
+		if got, _ := smsSegments(text); got != want {
+			t.Errorf("%d × %q is %d segments, want %d", len(text), text[:2], got, want)
+		}
+	}
+}
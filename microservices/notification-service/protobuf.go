@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+
+	notificationv1 "platform/api/proto/notification/v1"
+)
+
+// Internal callers may send creates, sends and events as protobuf with this
+// content type, from the shared platform/api/proto module, instead of JSON.
+// Responses are JSON either way.
+const mimeProtobuf = binding.MIMEPROTOBUF
+
+// bindCreateRequest decodes the body of a create as JSON or protobuf
+func bindCreateRequest(c *gin.Context, req *CreateNotificationRequest) error {
+	if c.ContentType() != mimeProtobuf {
+		return c.ShouldBindJSON(req)
+	}
+	var msg notificationv1.CreateNotificationRequest
+	if err := c.ShouldBindWith(&msg, binding.ProtoBuf); err != nil {
+		return err
+	}
+	*req = createRequestFromProto(&msg)
+	return binding.Validator.ValidateStruct(req)
+}
+
+// bindSendRequest decodes the body of a send as JSON or protobuf
+func bindSendRequest(c *gin.Context, req *SendNotificationRequest) error {
+	if c.ContentType() != mimeProtobuf {
+		return c.ShouldBindJSON(req)
+	}
+	var msg notificationv1.SendNotificationRequest
+	if err := c.ShouldBindWith(&msg, binding.ProtoBuf); err != nil {
+		return err
+	}
+	*req = SendNotificationRequest{
+		CreateNotificationRequest: createRequestFromProto(msg.GetNotification()),
+		Channels:                  msg.GetChannels(),
+	}
+	return binding.Validator.ValidateStruct(req)
+}
+
+func createRequestFromProto(msg *notificationv1.CreateNotificationRequest) CreateNotificationRequest {
+	var actions []NotificationAction
+	for _, action := range msg.GetActions() {
+		actions = append(actions, NotificationAction{
+			ID:     action.GetId(),
+			Label:  action.GetLabel(),
+			URL:    action.GetUrl(),
+			Intent: action.GetIntent(),
+		})
+	}
+	req := CreateNotificationRequest{
+		UserID:   msg.GetUserId(),
+		Type:     msg.GetType(),
+		Title:    msg.GetTitle(),
+		Message:  msg.GetMessage(),
+		Category: msg.GetCategory(),
+		Tags:     msg.GetTags(),
+		Campaign: msg.GetCampaign(),
+		GroupKey: msg.GetGroupKey(),
+		Actions:  actions,
+		ImageURL: msg.GetImageUrl(),
+	}
+	// Struct values decode like JSON, so schemas and templates see the same types
+	if msg.GetData() != nil {
+		req.Data = msg.GetData().AsMap()
+	}
+	return req
+}
+
+// decodeEvent decodes a Kafka message as JSON, or as protobuf when its content-type header says so
+func decodeEvent(msg kafka.Message) (platformEvent, error) {
+	var event platformEvent
+	if !isProtobufMessage(msg) {
+		err := json.Unmarshal(msg.Value, &event)
+		return event, err
+	}
+	var pb notificationv1.PlatformEvent
+	if err := proto.Unmarshal(msg.Value, &pb); err != nil {
+		return event, err
+	}
+	event = platformEvent{
+		ID:       pb.GetId(),
+		Type:     pb.GetType(),
+		UserID:   pb.GetUserId(),
+		TenantID: pb.GetTenantId(),
+	}
+	if pb.GetOccurredAt() != nil {
+		event.OccurredAt = pb.GetOccurredAt().AsTime()
+	}
+	if pb.GetData() != nil {
+		event.Data = pb.GetData().AsMap()
+	}
+	return event, nil
+}
+
+func isProtobufMessage(msg kafka.Message) bool {
+	for _, header := range msg.Headers {
+		if strings.EqualFold(header.Key, "content-type") {
+			return string(header.Value) == mimeProtobuf
+		}
+	}
+	return false
+}
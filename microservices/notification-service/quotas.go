@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Periods quotas are counted over, in UTC
+const (
+	quotaDaily   = "daily"
+	quotaMonthly = "monthly"
+)
+
+var quotaExceededTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "quota_exceeded_total",
+		Help: "Total number of creates and sends rejected for exceeding a tenant quota, by limit and period",
+	},
+	[]string{"limit", "period"},
+)
+
+// errQuotaExceeded is returned for creates and sends past one of the tenant's quotas
+var errQuotaExceeded = errors.New("Quota exceeded")
+
+// quotaError says which quota was hit and when it resets
+type quotaError struct {
+	tenant string
+	// limit is notifications, or the channel whose deliveries are capped
+	limit   string
+	period  string
+	max     int
+	resetAt time.Time
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("%s: tenant %s is at its %s %s limit of %d", errQuotaExceeded, e.tenant, e.period, e.limit, e.max)
+}
+
+func (e *quotaError) Is(target error) bool { return target == errQuotaExceeded }
+
+// usageCounts is what one tenant used over one day or month
+type usageCounts struct {
+	// Period is the day, e.g. 2026-10-16, or month, e.g. 2026-10
+	Period        string `json:"period"`
+	Notifications int    `json:"notifications"`
+	// Deliveries counts messages delivered on each channel
+	Deliveries map[string]int `json:"deliveries"`
+}
+
+func newUsageCounts(period string) usageCounts {
+	return usageCounts{Period: period, Deliveries: make(map[string]int)}
+}
+
+// tenantUsage is a tenant's usage so far today and this month
+type tenantUsage struct {
+	Tenant  string      `json:"tenant"`
+	Daily   usageCounts `json:"daily"`
+	Monthly usageCounts `json:"monthly"`
+	// LastMonth is kept through the following month so it can be billed once closed
+	LastMonth *usageCounts `json:"last_month,omitempty"`
+}
+
+// copy returns usage with its maps copied, for use outside the lock
+func (u *tenantUsage) copy() tenantUsage {
+	copied := *u
+	copied.Daily.Deliveries = maps.Clone(u.Daily.Deliveries)
+	copied.Monthly.Deliveries = maps.Clone(u.Monthly.Deliveries)
+	if u.LastMonth != nil {
+		last := *u.LastMonth
+		last.Deliveries = maps.Clone(u.LastMonth.Deliveries)
+		copied.LastMonth = &last
+	}
+	return copied
+}
+
+// roll starts new periods once now has moved past the current ones
+func (u *tenantUsage) roll(now time.Time) {
+	day, month := now.Format(time.DateOnly), now.Format("2006-01")
+	if u.Daily.Period != day {
+		u.Daily = newUsageCounts(day)
+	}
+	if u.Monthly.Period != month {
+		u.LastMonth = nil
+		if u.Monthly.Period == now.AddDate(0, 0, -now.Day()).Format("2006-01") {
+			last := u.Monthly
+			u.LastMonth = &last
+		}
+		u.Monthly = newUsageCounts(month)
+	}
+}
+
+// quotaMeter counts each tenant's notifications and deliveries and enforces their quotas
+//
+// Creates and sends are refused once the tenant has created its quota of
+// notifications, or once a channel it sends on has delivered its quota of
+// messages. Deliveries already queued still go out, so delivery counts can
+// end a little past their limit. Mandatory notices are metered but never
+// refused, and a create or send that fails after being admitted is taken
+// back off the count. Requests without a tenant are neither metered nor
+// limited. Usage lives in memory on each replica, so billing sums it over
+// the replicas and each replica enforces the limits on its own.
+type quotaMeter struct {
+	cfg atomic.Pointer[QuotasConfig]
+	now func() time.Time
+
+	mu    sync.Mutex
+	usage map[string]*tenantUsage
+}
+
+func newQuotaMeter(cfg QuotasConfig) *quotaMeter {
+	m := &quotaMeter{now: time.Now, usage: make(map[string]*tenantUsage)}
+	m.SetConfig(cfg)
+	return m
+}
+
+// SetConfig replaces the quotas; usage so far is kept
+func (m *quotaMeter) SetConfig(cfg QuotasConfig) {
+	m.cfg.Store(&cfg)
+}
+
+// Admit counts a notification for tenant to be delivered over channels, or
+// returns an error matching errQuotaExceeded when that would exceed a quota
+func (m *quotaMeter) Admit(tenant string, channels []string) error {
+	if m == nil || tenant == "" {
+		return nil
+	}
+	cfg := m.cfg.Load()
+	quota := cfg.For(tenant)
+	now := m.now().UTC()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := m.usageLocked(tenant, now)
+	if cfg.Enabled {
+		for _, period := range []struct {
+			name    string
+			limits  QuotaLimits
+			used    usageCounts
+			resetAt time.Time
+		}{
+			{quotaDaily, quota.Daily, usage.Daily, time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)},
+			{quotaMonthly, quota.Monthly, usage.Monthly, time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)},
+		} {
+			exceeded := func(limit string, max int) error {
+				quotaExceededTotal.WithLabelValues(limit, period.name).Inc()
+				return &quotaError{tenant: tenant, limit: limit, period: period.name, max: max, resetAt: period.resetAt}
+			}
+			if max := period.limits.Notifications; max > 0 && period.used.Notifications >= max {
+				return exceeded("notifications", max)
+			}
+			for _, channel := range channels {
+				if max := period.limits.Deliveries[channel]; max > 0 && period.used.Deliveries[channel] >= max {
+					return exceeded(channel+" deliveries", max)
+				}
+			}
+		}
+	}
+	usage.Daily.Notifications++
+	usage.Monthly.Notifications++
+	return nil
+}
+
+// Count counts a notification for tenant without checking its quotas, for
+// mandatory notices that must be delivered even once a quota is used up
+func (m *quotaMeter) Count(tenant string) {
+	if m == nil || tenant == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := m.usageLocked(tenant, m.now().UTC())
+	usage.Daily.Notifications++
+	usage.Monthly.Notifications++
+}
+
+// Refund takes back a notification counted for tenant whose create or send
+// then failed, so a retry of it is not counted twice
+func (m *quotaMeter) Refund(tenant string) {
+	if m == nil || tenant == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := m.usageLocked(tenant, m.now().UTC())
+	usage.Daily.Notifications = max(usage.Daily.Notifications-1, 0)
+	usage.Monthly.Notifications = max(usage.Monthly.Notifications-1, 0)
+}
+
+// admitVolume applies the type throttles and tenant quotas to notification,
+// to be delivered over channels. Mandatory notices are counted but neither
+// throttled nor refused.
+func admitVolume(anomalies *anomalyDetector, quotas *quotaMeter, notification Notification, channels []string, mandatory bool) error {
+	if mandatory {
+		anomalies.Observe(notification)
+		quotas.Count(notification.Tenant)
+		return nil
+	}
+	if err := anomalies.Admit(notification); err != nil {
+		return err
+	}
+	return quotas.Admit(notification.Tenant, channels)
+}
+
+// Delivered counts a message delivered to notification's tenant on channel
+func (m *quotaMeter) Delivered(notification Notification, channel string) {
+	if m == nil || notification.Tenant == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := m.usageLocked(notification.Tenant, m.now().UTC())
+	usage.Daily.Deliveries[channel]++
+	usage.Monthly.Deliveries[channel]++
+}
+
+// Usage returns the usage of tenant
+func (m *quotaMeter) Usage(tenant string) (tenantUsage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage, ok := m.usage[tenant]
+	if !ok {
+		return tenantUsage{}, false
+	}
+	usage.roll(m.now().UTC())
+	return usage.copy(), true
+}
+
+// List returns the usage of every metered tenant, sorted by tenant
+func (m *quotaMeter) List() []tenantUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now().UTC()
+	list := make([]tenantUsage, 0, len(m.usage))
+	for _, usage := range m.usage {
+		usage.roll(now)
+		list = append(list, usage.copy())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Tenant < list[j].Tenant })
+	return list
+}
+
+// usageLocked returns tenant's usage in the periods around now, creating it if needed
+func (m *quotaMeter) usageLocked(tenant string, now time.Time) *tenantUsage {
+	usage, ok := m.usage[tenant]
+	if !ok {
+		usage = &tenantUsage{Tenant: tenant}
+		m.usage[tenant] = usage
+	}
+	usage.roll(now)
+	return usage
+}
+
+// registerQuotaRoutes adds the admin endpoints reporting tenant usage for billing
+func registerQuotaRoutes(admin *gin.RouterGroup, quotas *quotaMeter) {
+	admin.GET("/usage", func(c *gin.Context) {
+		list := quotas.List()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	})
+
+	admin.GET("/usage/:tenant", func(c *gin.Context) {
+		tenant := c.Param("tenant")
+		usage, ok := quotas.Usage(tenant)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "No usage recorded for tenant " + tenant,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    usage,
+		})
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/middleware"
+	"platform/pkg/reqctx"
+)
+
+func TestQuotas(t *testing.T) {
+	service := testService(newNotificationStore(), newBroadcastStore(), systemClock{})
+	service.quotas = newQuotaMeter(QuotasConfig{
+		Enabled: true,
+		Default: QuotaConfig{Daily: QuotaLimits{Notifications: 2}},
+		Tenants: map[string]QuotaConfig{
+			"acme": {Monthly: QuotaLimits{Deliveries: map[string]int{channelSMS: 1}}},
+		},
+	})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Tenant())
+	registerAPIRoutes(r.Group("/api"), context.Background(), service, newTemplateStore(), defaultConfig().Responses.StreamThreshold)
+	admin := r.Group("/api/admin")
+	registerQuotaRoutes(admin, service.quotas)
+	post := func(path, tenant string, body any) *httptest.ResponseRecorder {
+		encoded, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded))
+		req.Header.Set("Content-Type", "application/json")
+		if tenant != "" {
+			req.Header.Set(reqctx.TenantHeader, tenant)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	create := CreateNotificationRequest{UserID: "alice", Type: "info", Title: "Hi", Message: "Hello"}
+
+	for i := 0; i < 2; i++ {
+		if rec := post("/api/notifications", "globex", create); rec.Code != http.StatusCreated {
+			t.Fatalf("create %d within the quota returned %d", i+1, rec.Code)
+		}
+	}
+	rec := post("/api/notifications", "globex", create)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("create past the daily quota returned %d with Retry-After %q, want 429 with a hint", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// Other tenants and untenanted requests are unaffected
+	if rec := post("/api/notifications", "initech", create); rec.Code != http.StatusCreated {
+		t.Errorf("create for another tenant returned %d", rec.Code)
+	}
+	if rec := post("/api/notifications", "", create); rec.Code != http.StatusCreated {
+		t.Errorf("untenanted create returned %d", rec.Code)
+	}
+
+	// Delivery quotas count what was delivered, per channel
+	send := SendNotificationRequest{CreateNotificationRequest: create, Channels: []string{channelSMS}}
+	if rec := post("/api/send", "acme", send); rec.Code != http.StatusOK {
+		t.Fatalf("send within the quota returned %d", rec.Code)
+	}
+	service.quotas.Delivered(Notification{Tenant: "acme"}, channelSMS)
+	if rec := post("/api/send", "acme", send); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("sms send past the monthly quota returned %d, want 429", rec.Code)
+	}
+	send.Channels = []string{channelEmail}
+	if rec := post("/api/send", "acme", send); rec.Code != http.StatusOK {
+		t.Errorf("email send with only sms capped returned %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/usage/acme", nil))
+	var resp struct {
+		Data tenantUsage `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if usage := resp.Data.Monthly; usage.Notifications != 2 || usage.Deliveries[channelSMS] != 1 {
+		t.Errorf("acme used %+v this month, want 2 notifications and 1 sms", usage)
+	}
+}
+
+func TestMandatoryNoticesSkipLimits(t *testing.T) {
+	quotas := newQuotaMeter(QuotasConfig{Enabled: true, Default: QuotaConfig{Daily: QuotaLimits{Notifications: 1}}})
+	cfg := defaultConfig().Anomalies
+	cfg.Enabled = true
+	anomalies := newAnomalyDetector(cfg, nil)
+	anomalies.throttles["security"] = &typeThrottle{limit: 1, until: time.Now().Add(time.Hour), admitted: 1}
+	notice := Notification{Type: "security", Tenant: "acme", Category: categorySecurity}
+
+	if err := admitVolume(anomalies, quotas, notice, []string{channelEmail}, false); err == nil {
+		t.Error("throttled notice admitted without being mandatory")
+	}
+	for i := 0; i < 2; i++ {
+		if err := admitVolume(anomalies, quotas, notice, []string{channelEmail}, true); err != nil {
+			t.Errorf("mandatory notice %d refused: %v", i+1, err)
+		}
+	}
+	if usage, _ := quotas.Usage("acme"); usage.Daily.Notifications != 2 {
+		t.Errorf("acme used %d notifications today, want the 2 mandatory ones metered", usage.Daily.Notifications)
+	}
+}
+
+func TestQuotaRefundsFailedSends(t *testing.T) {
+	service := testService(newNotificationStore(), newBroadcastStore(), systemClock{})
+	service.quotas = newQuotaMeter(QuotasConfig{Enabled: true, Default: QuotaConfig{Daily: QuotaLimits{Notifications: 1}}})
+	ctx := reqctx.WithTenant(context.Background(), "acme")
+	send := SendNotificationRequest{CreateNotificationRequest: CreateNotificationRequest{UserID: "alice", Type: "info", Title: "Hi", Message: "Hello"}}
+
+	// A send the queue turns away is retried without having used up the quota
+	service.dispatcher.draining.Store(true)
+	if _, err := service.Send(ctx, send); !errors.Is(err, errShuttingDown) {
+		t.Fatalf("send while draining returned %v", err)
+	}
+	service.dispatcher.draining.Store(false)
+	if _, err := service.Send(ctx, send); err != nil {
+		t.Errorf("retried send refused: %v", err)
+	}
+	if usage, _ := service.quotas.Usage("acme"); usage.Daily.Notifications != 1 {
+		t.Errorf("acme used %d notifications today, want 1", usage.Daily.Notifications)
+	}
+}
+
+func TestUsageRollsOver(t *testing.T) {
+	now := time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)
+	quotas := newQuotaMeter(QuotasConfig{Enabled: true, Default: QuotaConfig{Daily: QuotaLimits{Notifications: 1}}})
+	quotas.now = func() time.Time { return now }
+
+	if err := quotas.Admit("acme", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := quotas.Admit("acme", nil); err == nil {
+		t.Fatal("second notification of the day was admitted")
+	}
+
+	// A new day resets the daily count, and a new month keeps the closed one for billing
+	now = now.Add(2 * time.Hour)
+	if err := quotas.Admit("acme", nil); err != nil {
+		t.Errorf("first notification of the next day refused: %v", err)
+	}
+	usage, _ := quotas.Usage("acme")
+	if usage.Monthly.Period != "2026-02" || usage.Monthly.Notifications != 1 ||
+		usage.LastMonth == nil || usage.LastMonth.Period != "2026-01" || usage.LastMonth.Notifications != 1 {
+		t.Errorf("usage = %+v, last month %+v", usage, usage.LastMonth)
+	}
+
+	// Only the month just closed is kept
+	now = now.AddDate(0, 2, 0)
+	if usage, _ := quotas.Usage("acme"); usage.LastMonth != nil {
+		t.Errorf("kept %+v two months on", usage.LastMonth)
+	}
+}
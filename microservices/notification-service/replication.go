@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+
+	"platform/pkg/reqctx"
+)
+
+// What a replicated change does to a notification
+const (
+	replicationUpsert = "upsert"
+	replicationDelete = "delete"
+)
+
+// replicationTombstones bounds how many deleted notification IDs are remembered
+const replicationTombstones = 10000
+
+var (
+	replicationChangesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "replication_changes_total",
+			Help: "Total number of notification changes replicated between regions by direction and outcome",
+		},
+		[]string{"region", "direction", "outcome"},
+	)
+	replicationLagSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replication_lag_seconds",
+			Help: "How long after it was made in its region the last change from each peer region was applied",
+		},
+		[]string{"region"},
+	)
+	replicationLagMessages = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replication_lag_messages",
+			Help: "Changes on each peer topic not yet applied, as of the last fetch",
+		},
+		[]string{"topic"},
+	)
+)
+
+// replicationChange is one notification write, as published to a region's topic
+type replicationChange struct {
+	Op     string `json:"op"`
+	Region string `json:"region"`
+	// At is when the write was made in its region
+	At             time.Time `json:"at"`
+	NotificationID string    `json:"notification_id"`
+	UserID         string    `json:"user_id"`
+	// Notification is the notification as written, for upserts
+	Notification *Notification `json:"notification,omitempty"`
+}
+
+// replicatedRepository publishes the writes made through it as replication changes
+//
+// Only writes made by the API and the event consumers go through it.
+// Purges, retention and archiving run in every region on their own, and
+// changes applied from peers are written to the store underneath so they
+// are not published back.
+type replicatedRepository struct {
+	Repository
+	region  string
+	now     func() time.Time
+	publish func(changes ...replicationChange)
+	deleted *tombstones
+}
+
+func newReplicatedRepository(repo Repository, region string, publish func(changes ...replicationChange), deleted *tombstones) *replicatedRepository {
+	return &replicatedRepository{Repository: repo, region: region, now: time.Now, publish: publish, deleted: deleted}
+}
+
+func (r *replicatedRepository) upsert(notification Notification) replicationChange {
+	return replicationChange{
+		Op:             replicationUpsert,
+		Region:         r.region,
+		At:             r.now(),
+		NotificationID: notification.ID,
+		UserID:         notification.UserID,
+		Notification:   &notification,
+	}
+}
+
+// published publishes the upsert of notification when the write found it
+func (r *replicatedRepository) published(notification Notification, ok bool) (Notification, bool) {
+	if ok {
+		r.publish(r.upsert(notification))
+	}
+	return notification, ok
+}
+
+func (r *replicatedRepository) Add(notification Notification) {
+	r.Repository.Add(notification)
+	r.publish(r.upsert(notification))
+}
+
+func (r *replicatedRepository) AddBatch(notifications []Notification) {
+	r.Repository.AddBatch(notifications)
+	r.publishBatch(notifications)
+}
+
+// WriteBatch writes through the repository underneath, publishing the batch only once it is stored
+func (r *replicatedRepository) WriteBatch(ctx context.Context, notifications []Notification) error {
+	if store, ok := r.Repository.(batchStore); ok {
+		if err := store.WriteBatch(ctx, notifications); err != nil {
+			return err
+		}
+	} else {
+		r.Repository.AddBatch(notifications)
+	}
+	r.publishBatch(notifications)
+	return nil
+}
+
+func (r *replicatedRepository) publishBatch(notifications []Notification) {
+	changes := make([]replicationChange, len(notifications))
+	for i, notification := range notifications {
+		changes[i] = r.upsert(notification)
+	}
+	r.publish(changes...)
+}
+
+func (r *replicatedRepository) MarkRead(id string, at time.Time) (Notification, bool) {
+	return r.published(r.Repository.MarkRead(id, at))
+}
+
+func (r *replicatedRepository) SetPinned(id string, pinned bool) (Notification, bool) {
+	return r.published(r.Repository.SetPinned(id, pinned))
+}
+
+func (r *replicatedRepository) Snooze(id string, until time.Time) (Notification, bool) {
+	return r.published(r.Repository.Snooze(id, until))
+}
+
+func (r *replicatedRepository) Wake(id string, until time.Time) (Notification, bool) {
+	return r.published(r.Repository.Wake(id, until))
+}
+
+func (r *replicatedRepository) MarkAllRead(userID string, at time.Time) []Notification {
+	marked := r.Repository.MarkAllRead(userID, at)
+	changes := make([]replicationChange, len(marked))
+	for i, notification := range marked {
+		changes[i] = r.upsert(notification)
+	}
+	r.publish(changes...)
+	return marked
+}
+
+func (r *replicatedRepository) Delete(id string) (Notification, bool) {
+	notification, ok := r.Repository.Delete(id)
+	if ok {
+		r.deleted.Add(id)
+		r.publish(replicationChange{
+			Op:             replicationDelete,
+			Region:         r.region,
+			At:             r.now(),
+			NotificationID: id,
+			UserID:         notification.UserID,
+		})
+	}
+	return notification, ok
+}
+
+// replicationStream publishes a region's changes to its topic
+//
+// Changes are keyed by user, so each user's changes keep their order, and
+// written asynchronously: a slow or unreachable peer link delays
+// replication rather than the API.
+type replicationStream struct {
+	region string
+	writer *kafka.Writer
+}
+
+func newReplicationStream(cfg ReplicationConfig) *replicationStream {
+	s := &replicationStream{region: cfg.Region}
+	s.writer = &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Async:        true,
+		Completion: func(messages []kafka.Message, err error) {
+			outcome := "published"
+			if err != nil {
+				outcome = "failed"
+				slog.Warn("publishing replication changes failed", "topic", cfg.Topic, "changes", len(messages), "error", err)
+			}
+			replicationChangesTotal.WithLabelValues(s.region, "outbound", outcome).Add(float64(len(messages)))
+		},
+	}
+	return s
+}
+
+// Publish queues changes for the region's topic
+func (s *replicationStream) Publish(changes ...replicationChange) {
+	if len(changes) == 0 {
+		return
+	}
+	messages := make([]kafka.Message, 0, len(changes))
+	for _, change := range changes {
+		value, err := json.Marshal(change)
+		if err != nil {
+			replicationChangesTotal.WithLabelValues(s.region, "outbound", "failed").Inc()
+			continue
+		}
+		msg := kafka.Message{Key: []byte(change.UserID), Value: value, Time: change.At}
+		if change.Notification != nil {
+			msg.Headers = correlationHeaders(change.Notification.CorrelationID, change.Notification.Tenant)
+		}
+		messages = append(messages, msg)
+	}
+	// Async writers only fail here once closed; delivery errors go to Completion
+	if err := s.writer.WriteMessages(context.Background(), messages...); err != nil {
+		replicationChangesTotal.WithLabelValues(s.region, "outbound", "failed").Add(float64(len(messages)))
+	}
+}
+
+// Close publishes the queued changes, for use once the server has stopped taking writes
+func (s *replicationStream) Close(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() { done <- s.writer.Close() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tombstones remembers the IDs of recently deleted notifications, forgetting the oldest beyond its size
+type tombstones struct {
+	mu   sync.Mutex
+	ids  map[string]struct{}
+	ring []string
+	next int
+}
+
+func newTombstones(size int) *tombstones {
+	return &tombstones{ids: make(map[string]struct{}, size), ring: make([]string, size)}
+}
+
+func (t *tombstones) Add(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.ids[id]; ok {
+		return
+	}
+	if old := t.ring[t.next]; old != "" {
+		delete(t.ids, old)
+	}
+	t.ring[t.next] = id
+	t.ids[id] = struct{}{}
+	t.next = (t.next + 1) % len(t.ring)
+}
+
+func (t *tombstones) Has(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.ids[id]
+	return ok
+}
+
+// replicationApplier applies changes published by peer regions to this region's store
+//
+// Changes are idempotent: a notification is created once however often it
+// is redelivered, and read state converges on the latest ReadAt whichever
+// order the regions' writes arrive in. Other fields take the value of the
+// last change applied. Recently deleted notifications are remembered so a
+// write racing the delete in another region does not bring them back.
+type replicationApplier struct {
+	region string
+	repo   Repository
+	hub    *notificationHub
+	now    func() time.Time
+	// deleted holds the notifications deleted in any region, shared with the replicated repository
+	deleted *tombstones
+}
+
+func newReplicationApplier(region string, repo Repository, hub *notificationHub, deleted *tombstones) *replicationApplier {
+	return &replicationApplier{region: region, repo: repo, hub: hub, now: time.Now, deleted: deleted}
+}
+
+// Apply applies change, returning the outcome: applied, duplicate, stale or own
+func (a *replicationApplier) Apply(change replicationChange) string {
+	if change.Region == a.region {
+		// Published by this region, e.g. when topics are mirrored both ways
+		return "own"
+	}
+	replicationLagSeconds.WithLabelValues(change.Region).Set(a.now().Sub(change.At).Seconds())
+
+	if change.Op == replicationDelete {
+		a.deleted.Add(change.NotificationID)
+		if _, ok := a.repo.Delete(change.NotificationID); ok {
+			return "applied"
+		}
+		return "duplicate"
+	}
+	if a.deleted.Has(change.NotificationID) {
+		return "stale"
+	}
+
+	incoming := *change.Notification
+	current, ok := a.repo.Get(incoming.ID)
+	if !ok {
+		a.repo.Add(incoming)
+		a.hub.Publish(incoming)
+		return "applied"
+	}
+
+	applied := false
+	// Latest ReadAt wins; an earlier read in another region changes nothing
+	if incoming.ReadAt != nil && (current.ReadAt == nil || incoming.ReadAt.After(*current.ReadAt)) {
+		a.repo.MarkRead(incoming.ID, *incoming.ReadAt)
+		applied = true
+	}
+	if incoming.Pinned != current.Pinned {
+		a.repo.SetPinned(incoming.ID, incoming.Pinned)
+		applied = true
+	}
+	switch {
+	case incoming.SnoozedUntil != nil && (current.SnoozedUntil == nil || !incoming.SnoozedUntil.Equal(*current.SnoozedUntil)):
+		a.repo.Snooze(incoming.ID, *incoming.SnoozedUntil)
+		applied = true
+	case incoming.SnoozedUntil == nil && current.SnoozedUntil != nil:
+		a.repo.Wake(incoming.ID, *current.SnoozedUntil)
+		applied = true
+	}
+	if !applied {
+		return "duplicate"
+	}
+	return "applied"
+}
+
+// runReplicationConsumer applies the changes on a peer region's topic until ctx is cancelled
+//
+// Like the event consumers, the region's replicas share a consumer group,
+// so Kafka spreads the topic's partitions across them.
+func runReplicationConsumer(ctx context.Context, cfg ReplicationConfig, topic string, applier *replicationApplier) {
+	logger := slog.Default().With("component", "replication", "topic", topic)
+	readerConfig := kafka.ReaderConfig{
+		Brokers: cfg.Brokers,
+		Topic:   topic,
+		GroupID: cfg.GroupID + "-" + cfg.Region,
+		MaxWait: time.Second,
+	}
+	reader := kafka.NewReader(readerConfig)
+	defer reader.Close()
+
+	logger.Info("replication consumer started", "brokers", cfg.Brokers, "group_id", readerConfig.GroupID)
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("fetching replication change failed", "error", err)
+			if !sleepCtx(ctx, time.Second) {
+				return
+			}
+			continue
+		}
+		replicationLagMessages.WithLabelValues(topic).Set(float64(reader.Stats().Lag))
+
+		var change replicationChange
+		if err := json.Unmarshal(msg.Value, &change); err != nil || !change.valid() {
+			replicationChangesTotal.WithLabelValues("unknown", "inbound", "invalid").Inc()
+			logger.Error("discarding malformed replication change", "request_id", messageHeader(msg, reqctx.CorrelationIDHeader), "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		} else {
+			replicationChangesTotal.WithLabelValues(change.Region, "inbound", applier.Apply(change)).Inc()
+		}
+
+		if err := reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			logger.Warn("committing replication offset failed", "error", err)
+		}
+	}
+}
+
+// valid reports whether the change can be applied
+func (c replicationChange) valid() bool {
+	switch c.Op {
+	case replicationUpsert:
+		return c.Region != "" && c.Notification != nil && c.Notification.ID != ""
+	case replicationDelete:
+		return c.Region != "" && c.NotificationID != ""
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testRegion is one region of an active-active pair, publishing into a slice instead of Kafka
+type testRegion struct {
+	store     *notificationStore
+	hub       *notificationHub
+	repo      *replicatedRepository
+	applier   *replicationApplier
+	published []replicationChange
+}
+
+func newTestRegion(name string) *testRegion {
+	r := &testRegion{store: newNotificationStore(), hub: newNotificationHub()}
+	deleted := newTombstones(100)
+	r.repo = newReplicatedRepository(r.store, name, func(changes ...replicationChange) {
+		r.published = append(r.published, changes...)
+	}, deleted)
+	r.applier = newReplicationApplier(name, r.store, r.hub, deleted)
+	return r
+}
+
+// replicate applies what from has published since the last call to to, returning the outcomes
+func replicate(from, to *testRegion) []string {
+	var outcomes []string
+	for _, change := range from.published {
+		outcomes = append(outcomes, to.applier.Apply(change))
+	}
+	from.published = nil
+	return outcomes
+}
+
+func TestReplication(t *testing.T) {
+	eu, us := newTestRegion("eu-west-1"), newTestRegion("us-east-1")
+	created := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	eu.repo.Add(Notification{ID: "n1", UserID: "alice", Type: "info", Status: "unread", CreatedAt: created})
+	eu.repo.Add(Notification{ID: "n2", UserID: "alice", Type: "info", Status: "unread", CreatedAt: created})
+
+	// Creates reach the peer's store and open streams, and redelivery changes nothing
+	updates, cancel := us.hub.Subscribe("alice")
+	defer cancel()
+	changes := append([]replicationChange{}, eu.published...)
+	if outcomes := replicate(eu, us); len(outcomes) != 2 || outcomes[0] != "applied" {
+		t.Fatalf("outcomes = %v, want both applied", outcomes)
+	}
+	if notification := <-updates; notification.ID != "n1" {
+		t.Errorf("stream received %s, want n1", notification.ID)
+	}
+	for _, change := range changes {
+		if outcome := us.applier.Apply(change); outcome != "duplicate" {
+			t.Errorf("redelivered change was %s, want duplicate", outcome)
+		}
+	}
+	if us.store.Len() != 2 {
+		t.Fatalf("peer holds %d notifications, want 2", us.store.Len())
+	}
+
+	// Both regions read n1 before hearing from the other; the later read wins in both
+	early, late := created.Add(time.Minute), created.Add(2*time.Minute)
+	eu.repo.MarkRead("n1", late)
+	us.repo.MarkRead("n1", early)
+	replicate(eu, us)
+	if outcomes := replicate(us, eu); len(outcomes) != 1 || outcomes[0] != "duplicate" {
+		t.Errorf("earlier read was %v, want ignored", outcomes)
+	}
+	for name, store := range map[string]*notificationStore{"eu": eu.store, "us": us.store} {
+		if n, _ := store.Get("n1"); n.ReadAt == nil || !n.ReadAt.Equal(late) || n.Status != "read" {
+			t.Errorf("%s read n1 at %v, want %v", name, n.ReadAt, late)
+		}
+	}
+
+	// A pin racing a delete in the other region does not bring the notification back
+	eu.repo.Delete("n2")
+	us.repo.SetPinned("n2", true)
+	replicate(eu, us)
+	if outcomes := replicate(us, eu); len(outcomes) != 1 || outcomes[0] != "stale" {
+		t.Errorf("pin after delete was %v, want stale", outcomes)
+	}
+	for name, store := range map[string]*notificationStore{"eu": eu.store, "us": us.store} {
+		if _, ok := store.Get("n2"); ok {
+			t.Errorf("%s still holds deleted n2", name)
+		}
+	}
+
+	// Changes from the region itself, e.g. mirrored back, are skipped
+	eu.repo.SetPinned("n1", true)
+	if outcome := eu.applier.Apply(eu.published[0]); outcome != "own" {
+		t.Errorf("own change was %s, want own", outcome)
+	}
+	// Applied changes are not published back
+	replicate(eu, us)
+	if len(us.published) != 0 {
+		t.Errorf("peer republished %d applied changes", len(us.published))
+	}
+}
+
+func TestReplicationConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Replication = ReplicationConfig{Enabled: true, Region: "eu-west-1", Brokers: []string{"kafka:9092"}, Topic: "notifications-eu", GroupID: "notification-service-replication"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("replication without peer topics accepted")
+	}
+	cfg.Replication.PeerTopics = []string{"notifications-eu"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("replication consuming its own topic accepted")
+	}
+	cfg.Replication.PeerTopics = []string{"notifications-us"}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import "time"
+
+// Repository stores notifications
+//
+// notificationStore keeps them in memory and is what the service runs on
+// today and what unit tests use; a database-backed implementation only has
+// to satisfy this interface. Implementations return copies, so a returned
+// notification never changes under the caller.
+type Repository interface {
+	Add(notification Notification)
+	AddBatch(notifications []Notification)
+	Get(id string) (Notification, bool)
+	// List and Scan return every notification in creation order
+	List() []Notification
+	Scan(fn func(Notification) error) error
+	// ListByUser, ScanUser and CountByUser cover a single user's inbox
+	ListByUser(userID string) []Notification
+	ScanUser(userID string, fn func(Notification) error) error
+	CountByUser(userID string) int
+	// UserVersion changes whenever the user's inbox changes
+	UserVersion(userID string) string
+	// After returns the user's notifications created after lastID
+	After(userID, lastID string) []Notification
+	MarkRead(id string, at time.Time) (Notification, bool)
+	SetPinned(id string, pinned bool) (Notification, bool)
+	Snooze(id string, until time.Time) (Notification, bool)
+	// Wake ends a snooze, unless it has since been extended past until
+	Wake(id string, until time.Time) (Notification, bool)
+	// MarkAllRead marks the user's unpinned notifications read, returning them
+	MarkAllRead(userID string, at time.Time) []Notification
+	Delete(id string) (Notification, bool)
+	// Purge removes notifications created before cutoff, except pinned ones
+	Purge(cutoff time.Time) int
+	Len() int
+}
+
+var _ Repository = (*notificationStore)(nil)
+
+// clock tells the time and schedules work, so tests can control both
+type clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func())
+}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) { time.AfterFunc(d, f) }
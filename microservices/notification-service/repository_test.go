@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testRepositoryContract checks the behavior every Repository implementation
+// shares; newRepo returns an empty repository
+//
+// The in-memory store runs it as a unit test. A database-backed
+// implementation runs it from an integration test against a real database,
+// see integration_test.go.
+func testRepositoryContract(t *testing.T, newRepo func(t *testing.T) Repository) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(n Notification, minutes int) Notification {
+		n.CreatedAt = base.Add(time.Duration(minutes) * time.Minute)
+		return n
+	}
+
+	t.Run("AddGetDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Add(at(testNotification("a1", "alice"), 0))
+		got, ok := repo.Get("a1")
+		if !ok || got.UserID != "alice" || !got.CreatedAt.Equal(base) {
+			t.Fatalf("Get(a1) = %+v, %v", got, ok)
+		}
+		if _, ok := repo.Get("missing"); ok {
+			t.Error("Get(missing) found a notification")
+		}
+		if deleted, ok := repo.Delete("a1"); !ok || deleted.ID != "a1" {
+			t.Errorf("Delete(a1) = %+v, %v", deleted, ok)
+		}
+		if _, ok := repo.Delete("a1"); ok || repo.Len() != 0 {
+			t.Errorf("after Delete, second Delete = %v and Len = %d", ok, repo.Len())
+		}
+	})
+
+	t.Run("ListsInCreationOrder", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.AddBatch([]Notification{at(testNotification("a1", "alice"), 0), at(testNotification("b1", "bob"), 1)})
+		repo.Add(at(testNotification("a2", "alice"), 2))
+		if got := ids(repo.ListByUser("alice")); got != "a1,a2" {
+			t.Errorf("ListByUser(alice) = %s, want a1,a2", got)
+		}
+		if repo.CountByUser("alice") != 2 || repo.CountByUser("carol") != 0 || repo.Len() != 3 {
+			t.Errorf("counts = %d, %d, %d", repo.CountByUser("alice"), repo.CountByUser("carol"), repo.Len())
+		}
+		if got := ids(repo.After("alice", "a1")); got != "a2" {
+			t.Errorf("After(alice, a1) = %s, want a2", got)
+		}
+		var scanned []Notification
+		repo.ScanUser("alice", func(n Notification) error {
+			scanned = append(scanned, n)
+			return nil
+		})
+		if got := ids(scanned); got != "a1,a2" {
+			t.Errorf("ScanUser(alice) = %s, want a1,a2", got)
+		}
+	})
+
+	t.Run("ReadState", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.AddBatch([]Notification{testNotification("a1", "alice"), testNotification("a2", "alice"), testNotification("a3", "alice")})
+		version := repo.UserVersion("alice")
+		if read, ok := repo.MarkRead("a1", base); !ok || read.Status != "read" || !read.ReadAt.Equal(base) {
+			t.Errorf("MarkRead(a1) = %+v, %v", read, ok)
+		}
+		if repo.UserVersion("alice") == version {
+			t.Error("MarkRead did not change the user's version")
+		}
+		repo.SetPinned("a2", true)
+		if marked := repo.MarkAllRead("alice", base); ids(marked) != "a3" {
+			t.Errorf("MarkAllRead = %s, want a3 as a1 is read and a2 pinned", ids(marked))
+		}
+	})
+
+	t.Run("SnoozeAndWake", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Add(testNotification("a1", "alice"))
+		until := base.Add(time.Hour)
+		repo.Snooze("a1", until)
+		repo.Snooze("a1", until.Add(time.Hour))
+		if _, ok := repo.Wake("a1", until); ok {
+			t.Error("Wake ended a snooze that was extended")
+		}
+		if woken, ok := repo.Wake("a1", until.Add(time.Hour)); !ok || woken.SnoozedUntil != nil {
+			t.Errorf("Wake = %+v, %v", woken, ok)
+		}
+	})
+
+	t.Run("PurgeKeepsPinned", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.AddBatch([]Notification{at(testNotification("old", "alice"), -60), at(testNotification("pinned", "alice"), -60), at(testNotification("new", "bob"), 0)})
+		repo.SetPinned("pinned", true)
+		if purged := repo.Purge(base.Add(-time.Minute)); purged != 1 {
+			t.Errorf("Purge = %d, want 1", purged)
+		}
+		if got := ids(repo.List()); got != "pinned,new" {
+			t.Errorf("List after Purge = %s, want pinned,new", got)
+		}
+	})
+
+	t.Run("ReturnsCopies", func(t *testing.T) {
+		repo := newRepo(t)
+		n := testNotification("a1", "alice")
+		repo.Add(n)
+		got, _ := repo.Get("a1")
+		got.Title = "changed"
+		if again, _ := repo.Get("a1"); again.Title == "changed" {
+			t.Error("changing a returned notification changed the stored one")
+		}
+	})
+}
+
+func TestNotificationStoreConformance(t *testing.T) {
+	t.Run("single", func(t *testing.T) {
+		testRepositoryContract(t, func(*testing.T) Repository { return newNotificationStore() })
+	})
+	t.Run("sharded", func(t *testing.T) {
+		testRepositoryContract(t, func(*testing.T) Repository {
+			return newShardedStore(StorageConfig{Shards: []string{"a", "b", "c"}, VirtualNodes: 16})
+		})
+	})
+}
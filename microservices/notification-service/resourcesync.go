@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// resourceStatus is the status of the service's custom resources
+type resourceStatus struct {
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	Conditions         []condition `json:"conditions,omitempty"`
+}
+
+// condition is a metav1.Condition
+type condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime"`
+	Reason             string `json:"reason"`
+	Message            string `json:"message"`
+}
+
+// readyStatus returns the status recording whether the resource at generation
+// synced, and false when current already records exactly that
+func readyStatus(current resourceStatus, generation int64, syncErr error, invalidReason, readyMessage string) (resourceStatus, bool) {
+	ready := condition{
+		Type:               "Ready",
+		Status:             "True",
+		ObservedGeneration: generation,
+		Reason:             "Synced",
+		Message:            readyMessage,
+	}
+	if syncErr != nil {
+		ready.Status = "False"
+		ready.Reason = invalidReason
+		ready.Message = syncErr.Error()
+	}
+
+	var previous *condition
+	for i := range current.Conditions {
+		if current.Conditions[i].Type == ready.Type {
+			previous = &current.Conditions[i]
+		}
+	}
+	if previous != nil && current.ObservedGeneration == generation &&
+		previous.Status == ready.Status && previous.Reason == ready.Reason && previous.Message == ready.Message {
+		return current, false
+	}
+
+	ready.LastTransitionTime = time.Now().UTC().Format(time.RFC3339)
+	if previous != nil && previous.Status == ready.Status {
+		ready.LastTransitionTime = previous.LastTransitionTime
+	}
+	return resourceStatus{ObservedGeneration: generation, Conditions: []condition{ready}}, true
+}
+
+// resourceHandler receives the custom resources of one kind as they are listed and watched
+type resourceHandler[T any] struct {
+	// listed is called with every resource after each list
+	listed  func(ctx context.Context, items []T)
+	changed func(ctx context.Context, item T)
+	deleted func(item T)
+}
+
+// syncResources lists then watches the resources at path until ctx is
+// cancelled, relisting whenever the watch ends
+func syncResources[T any](ctx context.Context, client *kubeClient, path, kind string, handler resourceHandler[T]) {
+	for ctx.Err() == nil {
+		resourceVersion, err := listResources(ctx, client, path, handler)
+		if err == nil {
+			err = watchResources(ctx, client, path, resourceVersion, handler)
+		}
+		if err != nil && ctx.Err() == nil {
+			slog.Warn(kind+" sync interrupted", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+}
+
+// listResources hands every resource to the handler and returns the resource version to watch from
+func listResources[T any](ctx context.Context, client *kubeClient, path string, handler resourceHandler[T]) (string, error) {
+	var list struct {
+		Metadata objectMeta `json:"metadata"`
+		Items    []T        `json:"items"`
+	}
+	if err := client.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return "", err
+	}
+	handler.listed(ctx, list.Items)
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watchResources applies changes until the API server closes the watch
+func watchResources[T any](ctx context.Context, client *kubeClient, path, resourceVersion string, handler resourceHandler[T]) error {
+	path += "?watch=true&allowWatchBookmarks=true&timeoutSeconds=300&resourceVersion=" + resourceVersion
+	resp, err := client.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			// The server ends watches after timeoutSeconds; relist and carry on
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			var item T
+			if err := json.Unmarshal(event.Object, &item); err != nil {
+				return err
+			}
+			if event.Type == "DELETED" {
+				handler.deleted(item)
+			} else {
+				handler.changed(ctx, item)
+			}
+		case "ERROR":
+			// Typically 410 Gone once the resource version is too old
+			return fmt.Errorf("watch error: %s", event.Object)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var sandboxCapturedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "sandbox_messages_captured_total",
+		Help: "Total number of deliveries captured by the sandbox instead of being sent",
+	},
+	[]string{"channel"},
+)
+
+// capturedMessage is a delivery the sandbox kept instead of sending
+type capturedMessage struct {
+	NotificationID string               `json:"notification_id"`
+	UserID         string               `json:"user_id"`
+	Type           string               `json:"type"`
+	Channel        string               `json:"channel"`
+	Addresses      []string             `json:"addresses,omitempty"`
+	Locale         string               `json:"locale,omitempty"`
+	Title          string               `json:"title"`
+	Message        string               `json:"message"`
+	Actions        []NotificationAction `json:"actions,omitempty"`
+	ImageURL       string               `json:"image_url,omitempty"`
+	UnsubscribeURL string               `json:"unsubscribe_url,omitempty"`
+	CapturedAt     time.Time            `json:"captured_at"`
+}
+
+// sandboxOutbox keeps the latest captured messages, oldest first
+type sandboxOutbox struct {
+	mu       sync.Mutex
+	messages []capturedMessage
+	size     int
+}
+
+func newSandboxOutbox(size int) *sandboxOutbox {
+	return &sandboxOutbox{size: size}
+}
+
+// Capture keeps message, dropping the oldest one when the outbox is full
+func (o *sandboxOutbox) Capture(message capturedMessage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.messages) == o.size {
+		o.messages = append(o.messages[:0], o.messages[1:]...)
+	}
+	o.messages = append(o.messages, message)
+	sandboxCapturedTotal.WithLabelValues(message.Channel).Inc()
+}
+
+// List returns the captured messages for userID on channel, oldest first; empty filters match all
+func (o *sandboxOutbox) List(userID, channel string) []capturedMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	list := []capturedMessage{}
+	for _, message := range o.messages {
+		if (userID == "" || message.UserID == userID) && (channel == "" || message.Channel == channel) {
+			list = append(list, message)
+		}
+	}
+	return list
+}
+
+// Clear empties the outbox, returning how many messages it held
+func (o *sandboxOutbox) Clear() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := len(o.messages)
+	o.messages = nil
+	return n
+}
+
+// captureSender stands in for a channel's provider in the sandbox
+type captureSender struct {
+	channel string
+	outbox  *sandboxOutbox
+}
+
+func (s captureSender) Send(_ context.Context, notification Notification, to recipient) error {
+	s.outbox.Capture(capturedMessage{
+		NotificationID: notification.ID,
+		UserID:         notification.UserID,
+		Type:           notification.Type,
+		Channel:        s.channel,
+		Addresses:      to.Addresses,
+		Locale:         to.Locale,
+		Title:          notification.Title,
+		Message:        notification.Message,
+		Actions:        notification.Actions,
+		ImageURL:       notification.ImageURL,
+		UnsubscribeURL: to.UnsubscribeURL,
+		CapturedAt:     time.Now(),
+	})
+	return nil
+}
+
+// registerSandboxRoutes adds the admin endpoints to inspect and empty the sandbox outbox
+//
+// outbox is nil when the sandbox is off, and the endpoints then return 404.
+func registerSandboxRoutes(admin *gin.RouterGroup, outbox *sandboxOutbox) {
+	disabled := func(c *gin.Context) bool {
+		if outbox != nil {
+			return false
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Sandbox mode is off",
+		})
+		return true
+	}
+
+	admin.GET("/sandbox/outbox", func(c *gin.Context) {
+		if disabled(c) {
+			return
+		}
+		messages := outbox.List(c.Query("user_id"), c.Query("channel"))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    messages,
+			"count":   len(messages),
+		})
+	})
+
+	admin.DELETE("/sandbox/outbox", func(c *gin.Context) {
+		if disabled(c) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"count":   outbox.Clear(),
+		})
+	})
+}
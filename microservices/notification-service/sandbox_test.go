@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSandboxCapturesDeliveries(t *testing.T) {
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, staticRecipients{"alice@example.com"})
+	outbox := newSandboxOutbox(10)
+	dispatcher.Sandbox(outbox)
+	dispatcher.Start(1)
+
+	dispatcher.Enqueue(Notification{ID: "1", UserID: "alice", Type: "order_status", Title: "Shipped", Message: "On its way"}, []string{channelEmail, channelSMS})
+	dispatcher.Enqueue(Notification{ID: "2", UserID: "bob", Type: "promo", Title: "Sale", Message: "Half off"}, []string{channelPush})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := dispatcher.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerSandboxRoutes(r.Group("/api/admin"), outbox)
+	outboxFor := func(query string) []capturedMessage {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/sandbox/outbox"+query, nil))
+		var resp struct {
+			Data []capturedMessage `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.Data
+	}
+
+	if all := outboxFor(""); len(all) != 3 {
+		t.Errorf("captured %d messages, want 3", len(all))
+	}
+	email := outboxFor("?user_id=alice&channel=email")
+	if len(email) != 1 || email[0].Title != "Shipped" || len(email[0].Addresses) != 1 || email[0].Addresses[0] != "alice@example.com" {
+		t.Errorf("alice's emails = %+v", email)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/admin/sandbox/outbox", nil))
+	if rec.Code != http.StatusOK || len(outboxFor("")) != 0 {
+		t.Errorf("clearing the outbox returned %d", rec.Code)
+	}
+
+	off := gin.New()
+	registerSandboxRoutes(off.Group("/api/admin"), nil)
+	rec = httptest.NewRecorder()
+	off.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/sandbox/outbox", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("outbox with the sandbox off returned %d, want 404", rec.Code)
+	}
+}
+
+func TestSandboxOutboxKeepsLatest(t *testing.T) {
+	outbox := newSandboxOutbox(3)
+	for i := 0; i < 5; i++ {
+		outbox.Capture(capturedMessage{NotificationID: strconv.Itoa(i), Channel: channelEmail})
+	}
+	list := outbox.List("", "")
+	if len(list) != 3 || list[0].NotificationID != "2" || list[2].NotificationID != "4" {
+		t.Errorf("outbox = %+v, want the latest 3", list)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// seedSource marks templates loaded from the fixtures
+const seedSource = "seed/"
+
+// fixtures populate a development or preview instance with realistic data
+//
+//go:embed fixtures
+var fixtures embed.FS
+
+// seedNotification is a fixture notification created Age before startup
+type seedNotification struct {
+	Notification
+	Age string `json:"age"`
+}
+
+// seedPreference lists the notification types a user unsubscribed from
+type seedPreference struct {
+	UserID       string   `yaml:"user_id"`
+	Unsubscribed []string `yaml:"unsubscribed"`
+}
+
+// seedData is the parsed content of fixtures
+type seedData struct {
+	Notifications []Notification
+	Templates     []NotificationTemplate
+	Preferences   []seedPreference
+}
+
+// loadSeed reads the embedded fixtures, dating notifications relative to now
+//
+// Unread notifications are the default; read ones are read when created.
+func loadSeed(now time.Time) (seedData, error) {
+	var data seedData
+
+	raw, err := fixtures.ReadFile("fixtures/notifications.json")
+	if err != nil {
+		return data, err
+	}
+	var notifications []seedNotification
+	if err := json.Unmarshal(raw, &notifications); err != nil {
+		return data, fmt.Errorf("notifications.json: %w", err)
+	}
+	for _, seed := range notifications {
+		age, err := time.ParseDuration(seed.Age)
+		if err != nil {
+			return data, fmt.Errorf("notifications.json: %s: age: %w", seed.ID, err)
+		}
+		notification := seed.Notification
+		notification.CreatedAt = now.Add(-age)
+		switch notification.Status {
+		case "":
+			notification.Status = "unread"
+		case "read":
+			readAt := notification.CreatedAt
+			notification.ReadAt = &readAt
+		}
+		data.Notifications = append(data.Notifications, notification)
+	}
+
+	if raw, err = fixtures.ReadFile("fixtures/templates.yaml"); err != nil {
+		return data, err
+	}
+	if err := yaml.Unmarshal(raw, &data.Templates); err != nil {
+		return data, fmt.Errorf("templates.yaml: %w", err)
+	}
+	for i := range data.Templates {
+		data.Templates[i].Source = seedSource + data.Templates[i].Name
+	}
+
+	if raw, err = fixtures.ReadFile("fixtures/preferences.yaml"); err != nil {
+		return data, err
+	}
+	if err := yaml.Unmarshal(raw, &data.Preferences); err != nil {
+		return data, fmt.Errorf("preferences.yaml: %w", err)
+	}
+	return data, nil
+}
+
+// apply adds the fixtures to the store, the templates and the unsubscribes
+//
+// Templates synced from the cluster later win over fixtures of the same name.
+func (data seedData) apply(repo Repository, templates *templateStore, unsubscribes *unsubscriber, now time.Time) error {
+	for _, t := range data.Templates {
+		if err := templates.Put(t); err != nil {
+			return fmt.Errorf("template %s: %w", t.Name, err)
+		}
+	}
+	repo.AddBatch(data.Notifications)
+	for _, preference := range data.Preferences {
+		for _, notificationType := range preference.Unsubscribed {
+			unsubscribes.suppress(preference.UserID, notificationType, now)
+		}
+	}
+	return nil
+}
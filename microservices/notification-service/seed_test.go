@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeedFixturesLoad(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	data, err := loadSeed(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Notifications) == 0 || len(data.Templates) == 0 || len(data.Preferences) == 0 {
+		t.Fatalf("loaded %d notifications, %d templates and %d preferences", len(data.Notifications), len(data.Templates), len(data.Preferences))
+	}
+
+	// Fixtures must pass the checks the API applies to new notifications
+	content := newContentValidator(defaultConfig().Content)
+	seen := make(map[string]bool)
+	for _, n := range data.Notifications {
+		if seen[n.ID] {
+			t.Errorf("duplicate notification ID %s", n.ID)
+		}
+		seen[n.ID] = true
+		if n.UserID == "" || n.Title == "" || n.Message == "" || !validCategory(n.Category) {
+			t.Errorf("%s: incomplete fixture %+v", n.ID, n)
+		}
+		if err := content.Validate(n.Type, n.Actions, n.ImageURL, n.Data); err != nil {
+			t.Errorf("%s: %v", n.ID, err)
+		}
+		if !n.CreatedAt.Before(now) {
+			t.Errorf("%s created at %v, want before %v", n.ID, n.CreatedAt, now)
+		}
+		if (n.Status == "read") != (n.ReadAt != nil) || (n.Status != "read" && n.Status != "unread") {
+			t.Errorf("%s: status %q, read at %v", n.ID, n.Status, n.ReadAt)
+		}
+	}
+
+	store, templates := newNotificationStore(), newTemplateStore()
+	unsubscribes := newUnsubscriber(UnsubscribeConfig{})
+	if err := data.apply(store, templates, unsubscribes, now); err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != len(data.Notifications) || len(templates.List()) != len(data.Templates) {
+		t.Errorf("applied %d notifications and %d templates", store.Len(), len(templates.List()))
+	}
+	if !unsubscribes.Suppressed(data.Preferences[0].UserID, data.Preferences[0].Unsubscribed[0]) {
+		t.Error("preferences were not applied")
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"platform/pkg/logging"
+)
+
+// Plans a user can be on, as kept by the user service
+const (
+	planFree       = "free"
+	planPro        = "pro"
+	planEnterprise = "enterprise"
+)
+
+var plans = []string{planFree, planPro, planEnterprise}
+
+// Statuses of a segment send
+const (
+	sendRunning   = "running"
+	sendCompleted = "completed"
+	sendFailed    = "failed"
+	sendCancelled = "cancelled"
+)
+
+// sendRetryDelay is how long a segment send waits when the send queue is full
+const sendRetryDelay = 100 * time.Millisecond
+
+var errUsersDisabled = errors.New("Segment sends need user lookups to be enabled")
+
+// matches reports whether user is in the segment at now
+func (segment SegmentConfig) matches(user userProfile, now time.Time) bool {
+	if len(segment.Plans) > 0 && !slices.Contains(segment.Plans, user.Plan) {
+		return false
+	}
+	if len(segment.Locales) > 0 && !slices.ContainsFunc(segment.Locales, func(locale string) bool {
+		return strings.EqualFold(user.Locale, locale) || strings.HasPrefix(strings.ToLower(user.Locale), strings.ToLower(locale)+"-")
+	}) {
+		return false
+	}
+	age := now.Sub(user.CreatedAt)
+	if segment.MinAccountAge > 0 && age < segment.MinAccountAge {
+		return false
+	}
+	if segment.MaxAccountAge > 0 && age > segment.MaxAccountAge {
+		return false
+	}
+	return true
+}
+
+// profileSource lists the users segments are evaluated against
+type profileSource interface {
+	Profiles(ctx context.Context) ([]userProfile, error)
+}
+
+// segmentSendRequest is the admin request to notify every user in a segment
+type segmentSendRequest struct {
+	Segment  string               `json:"segment" binding:"required"`
+	Type     string               `json:"type" binding:"required"`
+	Title    string               `json:"title" binding:"required"`
+	Message  string               `json:"message" binding:"required"`
+	Category string               `json:"category"`
+	Campaign string               `json:"campaign" binding:"max=64"`
+	Channels []string             `json:"channels"`
+	Actions  []NotificationAction `json:"actions"`
+	// LocalTime, e.g. 09:00, sends each user's notification the next time it
+	// is that time in the user's timezone instead of straight away
+	LocalTime string `json:"local_time"`
+
+	// variants, when set, replace Title and Message; campaigns set them
+	variants []sendVariant
+	// startAt, when later than now, is when the send will start; campaign dry runs set it
+	startAt time.Time
+	// template and templateVersion rendered Title and Message, when a campaign set them
+	template        string
+	templateVersion int
+}
+
+// sendAt returns when user's notification goes out for a send started at now
+func (req segmentSendRequest) sendAt(user userProfile, now time.Time) time.Time {
+	if req.startAt.After(now) {
+		now = req.startAt
+	}
+	if req.LocalTime == "" {
+		return now
+	}
+	// validate has checked LocalTime
+	at, _ := parseWallClock(req.LocalTime)
+	return nextWallClock(now, at, userLocation(user.Timezone))
+}
+
+// sendVariant is one version of a send's content, shown to a share of its users
+type sendVariant struct {
+	Name    string
+	Weight  int
+	Title   string
+	Message string
+	// Template and TemplateVersion rendered Title and Message
+	Template        string
+	TemplateVersion int
+}
+
+// variantFor assigns userID one of variants in proportion to their weights
+//
+// The assignment depends only on the campaign, the user and the variants, so
+// a user sees the same variant however often the campaign is re-sent.
+func variantFor(variants []sendVariant, campaign, userID string) sendVariant {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	h := fnv.New32a()
+	h.Write([]byte(campaign))
+	h.Write([]byte{0})
+	h.Write([]byte(userID))
+	point := int(h.Sum32() % uint32(total))
+	for _, variant := range variants {
+		if point < variant.Weight {
+			return variant
+		}
+		point -= variant.Weight
+	}
+	return variants[len(variants)-1]
+}
+
+// segmentSend is the progress of one send to a segment
+type segmentSend struct {
+	ID      string `json:"id"`
+	Segment string `json:"segment"`
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	// Matched users are in the segment; Skipped ones opted out of every channel
+	Matched int `json:"matched"`
+	Sent    int `json:"sent"`
+	Skipped int `json:"skipped"`
+	// SentByVariant breaks Sent down by content variant, for campaigns with variants
+	SentByVariant map[string]int `json:"sent_by_variant,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+}
+
+// segmentSender fans notifications out to the users of a segment
+//
+// Sends run in the background: the user list is fetched once, evaluated
+// against the segment, and each matching user's notification is queued
+// for delivery, at the user's local time when the send names one and
+// waiting whenever the send queue is full. Sends only start on the
+// leader and stop when it loses the lease. Their progress is kept in memory.
+type segmentSender struct {
+	segments   map[string]SegmentConfig
+	profiles   profileSource
+	dispatcher *Dispatcher
+	writer     *notificationWriter
+	content    *contentValidator
+	leader     leaderContext
+
+	mu    sync.Mutex
+	sends map[string]*segmentSend
+	order []string
+}
+
+func newSegmentSender(segments map[string]SegmentConfig, profiles profileSource, dispatcher *Dispatcher, writer *notificationWriter, content *contentValidator) *segmentSender {
+	return &segmentSender{
+		segments:   segments,
+		profiles:   profiles,
+		dispatcher: dispatcher,
+		writer:     writer,
+		content:    content,
+		sends:      make(map[string]*segmentSend),
+	}
+}
+
+// validate checks req, filling in the default category and channels
+func (s *segmentSender) validate(req segmentSendRequest) (segmentSendRequest, error) {
+	if s.profiles == nil {
+		return req, errUsersDisabled
+	}
+	if _, ok := s.segments[req.Segment]; !ok {
+		return req, errors.New("Unknown segment: " + req.Segment)
+	}
+	if req.Category == "" {
+		req.Category = categorySystem
+	}
+	if !validCategory(req.Category) {
+		return req, errors.New("Unknown category: " + req.Category)
+	}
+	if len(req.Channels) == 0 {
+		req.Channels = []string{channelEmail}
+	}
+	for _, channel := range req.Channels {
+		if !s.dispatcher.Supports(channel) {
+			return req, errors.New("Unsupported channel: " + channel)
+		}
+	}
+	if req.LocalTime != "" {
+		if _, err := parseWallClock(req.LocalTime); err != nil {
+			return req, err
+		}
+	}
+	if err := s.content.Validate(req.Type, req.Actions, "", nil); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// Start validates req and begins sending it in the background
+func (s *segmentSender) Start(ctx context.Context, req segmentSendRequest) (segmentSend, error) {
+	req, err := s.validate(req)
+	if err != nil {
+		return segmentSend{}, err
+	}
+	segment := s.segments[req.Segment]
+	leaderCtx, err := s.leader.Get()
+	if err != nil {
+		return segmentSend{}, err
+	}
+
+	send := &segmentSend{
+		ID:        uuid.New().String(),
+		Segment:   req.Segment,
+		Type:      req.Type,
+		Status:    sendRunning,
+		CreatedAt: time.Now(),
+	}
+	if len(req.variants) > 0 {
+		send.SentByVariant = make(map[string]int, len(req.variants))
+	}
+	s.mu.Lock()
+	s.sends[send.ID] = send
+	s.order = append(s.order, send.ID)
+	snapshot := send.snapshot()
+	s.mu.Unlock()
+
+	// The send outlives the request but keeps its logger
+	logger := logging.FromContext(ctx).With("send_id", send.ID, "segment", req.Segment)
+	go s.run(logging.NewContext(leaderCtx, logger), send, segment, req)
+	return snapshot, nil
+}
+
+// Get returns the progress of the send with the given ID
+func (s *segmentSender) Get(id string) (segmentSend, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	send, ok := s.sends[id]
+	if !ok {
+		return segmentSend{}, false
+	}
+	return send.snapshot(), true
+}
+
+// List returns every send, oldest first
+func (s *segmentSender) List() []segmentSend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]segmentSend, len(s.order))
+	for i, id := range s.order {
+		list[i] = s.sends[id].snapshot()
+	}
+	return list
+}
+
+// snapshot copies send, including its map, for use outside the lock
+func (send *segmentSend) snapshot() segmentSend {
+	copied := *send
+	if send.SentByVariant != nil {
+		copied.SentByVariant = make(map[string]int, len(send.SentByVariant))
+		for variant, sent := range send.SentByVariant {
+			copied.SentByVariant[variant] = sent
+		}
+	}
+	return copied
+}
+
+func (s *segmentSender) run(ctx context.Context, send *segmentSend, segment SegmentConfig, req segmentSendRequest) {
+	logger := logging.FromContext(ctx)
+	users, err := s.profiles.Profiles(ctx)
+	if err != nil {
+		logger.Error("segment send failed to list users", "error", err)
+		s.finish(send, sendFailed, err)
+		return
+	}
+
+	// Users are notified in the order their local times come round
+	now := time.Now()
+	var due []dueUser
+	for _, user := range users {
+		if !segment.matches(user, now) {
+			continue
+		}
+		s.update(send, func() { send.Matched++ })
+
+		channels := channelsFor(user, req)
+		if len(channels) == 0 {
+			s.update(send, func() { send.Skipped++ })
+			continue
+		}
+		due = append(due, dueUser{user: user, channels: channels, at: req.sendAt(user, now)})
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+
+	for _, next := range due {
+		err := sleepUntil(ctx, next.at)
+		notification := notificationFor(next.user, req, time.Now())
+		if err == nil {
+			err = s.enqueue(ctx, notification, next.channels)
+		}
+		if err != nil {
+			logger.Warn("segment send stopped", "sent", send.Sent, "error", err)
+			s.finish(send, sendCancelled, err)
+			return
+		}
+		notificationsCreatedTotal.WithLabelValues(notification.Type).Inc()
+		// Delivery is already queued, so a failed write does not stop the send
+		if err := s.writer.Save(ctx, notification); err != nil {
+			logger.Error("notification queued for delivery but not stored", "notification_id", notification.ID, "error", err)
+		}
+		s.update(send, func() {
+			send.Sent++
+			if notification.Variant != "" {
+				send.SentByVariant[notification.Variant]++
+			}
+		})
+	}
+	logger.Info("segment send completed", "matched", send.Matched, "sent", send.Sent)
+	s.finish(send, sendCompleted, nil)
+}
+
+// dueUser is a user a segment send notifies, and when
+type dueUser struct {
+	user     userProfile
+	channels []string
+	at       time.Time
+}
+
+// channelsFor returns the channels of req that user has not opted out of
+func channelsFor(user userProfile, req segmentSendRequest) []string {
+	if slices.Contains(user.CategoryOptOuts, req.Category) {
+		return nil
+	}
+	var channels []string
+	for _, channel := range req.Channels {
+		if !slices.Contains(user.OptOuts, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// notificationFor builds user's notification of req, with the user's content variant if it has any
+func notificationFor(user userProfile, req segmentSendRequest, now time.Time) Notification {
+	notification := Notification{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Type:      req.Type,
+		Title:     req.Title,
+		Message:   req.Message,
+		Status:    "sent",
+		Category:  req.Category,
+		Campaign:  req.Campaign,
+		Actions:   req.Actions,
+		CreatedAt: now,
+
+		Template:        req.template,
+		TemplateVersion: req.templateVersion,
+	}
+	if len(req.variants) > 0 {
+		variant := variantFor(req.variants, req.Campaign, user.ID)
+		notification.Variant, notification.Title, notification.Message = variant.Name, variant.Title, variant.Message
+		notification.Template, notification.TemplateVersion = variant.Template, variant.TemplateVersion
+	}
+	return notification
+}
+
+// enqueue queues notification for delivery, waiting while the send queue is full
+func (s *segmentSender) enqueue(ctx context.Context, notification Notification, channels []string) error {
+	for {
+		err := s.dispatcher.Enqueue(notification, channels)
+		if !errors.Is(err, errQueueFull) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sendRetryDelay):
+		}
+	}
+}
+
+func (s *segmentSender) update(send *segmentSend, change func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change()
+}
+
+func (s *segmentSender) finish(send *segmentSend, status string, err error) {
+	now := time.Now()
+	s.update(send, func() {
+		send.Status = status
+		send.FinishedAt = &now
+		if err != nil {
+			send.Error = err.Error()
+		}
+	})
+}
+
+// registerSegmentRoutes adds the admin endpoints for sends to a segment
+func registerSegmentRoutes(admin *gin.RouterGroup, sender *segmentSender) {
+	admin.POST("/sends", func(c *gin.Context) {
+		var req segmentSendRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		if c.Query("dry_run") == "true" {
+			preview, err := sender.Preview(c.Request.Context(), req)
+			respondPreview(c, preview, err)
+			return
+		}
+		send, err := sender.Start(c.Request.Context(), req)
+		if errors.Is(err, errUsersDisabled) || errors.Is(err, errNotLeader) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"success": true,
+			"data":    send,
+		})
+	})
+
+	admin.GET("/sends", func(c *gin.Context) {
+		list := sender.List()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	})
+
+	admin.GET("/sends/:id", func(c *gin.Context) {
+		if send, ok := sender.Get(c.Param("id")); ok {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data":    send,
+			})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Send not found",
+		})
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSegmentMatches(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	user := userProfile{ID: "1", Locale: "en-GB", Plan: planPro, CreatedAt: now.Add(-10 * 24 * time.Hour)}
+
+	for _, tc := range []struct {
+		name    string
+		segment SegmentConfig
+		want    bool
+	}{
+		{"everyone", SegmentConfig{}, true},
+		{"plan", SegmentConfig{Plans: []string{planPro, planEnterprise}}, true},
+		{"other plan", SegmentConfig{Plans: []string{planFree}}, false},
+		{"exact locale", SegmentConfig{Locales: []string{"en-GB"}}, true},
+		{"language", SegmentConfig{Locales: []string{"EN"}}, true},
+		{"other locale", SegmentConfig{Locales: []string{"en-US", "e"}}, false},
+		{"new user", SegmentConfig{MaxAccountAge: 30 * 24 * time.Hour}, true},
+		{"too new", SegmentConfig{MinAccountAge: 30 * 24 * time.Hour}, false},
+		{"too old", SegmentConfig{MaxAccountAge: 7 * 24 * time.Hour}, false},
+		{"all criteria", SegmentConfig{Plans: []string{planPro}, Locales: []string{"en"}, MinAccountAge: 24 * time.Hour, MaxAccountAge: 30 * 24 * time.Hour}, true},
+	} {
+		if got := tc.segment.matches(user, now); got != tc.want {
+			t.Errorf("%s: matches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+type staticProfiles struct {
+	users []userProfile
+	err   error
+}
+
+func (p staticProfiles) Profiles(context.Context) ([]userProfile, error) {
+	return p.users, p.err
+}
+
+func TestSegmentSend(t *testing.T) {
+	now := time.Now()
+	profiles := staticProfiles{users: []userProfile{
+		{ID: "pro-1", Plan: planPro, CreatedAt: now},
+		{ID: "free-1", Plan: planFree, CreatedAt: now},
+		{ID: "pro-2", Plan: planPro, CreatedAt: now, OptOuts: []string{channelEmail}},
+		{ID: "pro-3", Plan: planPro, CreatedAt: now, CategoryOptOuts: []string{categoryPromotions}},
+		{ID: "pro-4", Plan: planPro, CreatedAt: now, OptOuts: []string{channelEmail}},
+	}}
+	segments := map[string]SegmentConfig{"pro": {Plans: []string{planPro}}}
+
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	store := newNotificationStore()
+	writer := newNotificationWriter(WriteBehindConfig{}, store, newNotificationHub())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	sender := newSegmentSender(segments, profiles, dispatcher, writer, newContentValidator(cfg.Content))
+	sender.leader.set(context.Background())
+	registerSegmentRoutes(r.Group("/api/admin"), sender)
+	post := func(body string) (int, segmentSend) {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/sends", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		var resp struct {
+			Data segmentSend `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Data
+	}
+	get := func(id string) segmentSend {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/sends/"+id, nil))
+		var resp struct {
+			Data segmentSend `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.Data
+	}
+
+	for _, body := range []string{
+		`{"segment":"missing","type":"promo","title":"T","message":"M"}`,
+		`{"segment":"pro","type":"promo","title":"T","message":"M","channels":["fax"]}`,
+		`{"segment":"pro","type":"promo","title":"T","message":"M","category":"newsletter"}`,
+	} {
+		if code, _ := post(body); code != http.StatusBadRequest {
+			t.Errorf("send %s returned %d, want 400", body, code)
+		}
+	}
+
+	code, send := post(`{"segment":"pro","type":"promo","title":"Upgrade","message":"New features","category":"promotions","campaign":"pro-launch","channels":["email","push"]}`)
+	if code != http.StatusAccepted || send.Status != sendRunning {
+		t.Fatalf("send returned %d with %+v", code, send)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for send.Status == sendRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		send = get(send.ID)
+	}
+	if send.Status != sendCompleted || send.Matched != 4 || send.Sent != 3 || send.Skipped != 1 || send.FinishedAt == nil {
+		t.Errorf("finished send = %+v, want 4 matched, 3 sent, 1 skipped", send)
+	}
+
+	var users []string
+	for _, n := range store.List() {
+		if n.Campaign != "pro-launch" || n.Category != categoryPromotions {
+			t.Errorf("stored %+v", n)
+		}
+		users = append(users, n.UserID)
+	}
+	if got := strings.Join(users, ","); got != "pro-1,pro-2,pro-4" {
+		t.Errorf("notified %s, want pro-1,pro-2,pro-4", got)
+	}
+}
+
+func TestSegmentSendReportsFailures(t *testing.T) {
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	store := newNotificationStore()
+	writer := newNotificationWriter(WriteBehindConfig{}, store, newNotificationHub())
+	req := segmentSendRequest{Segment: "all", Type: "promo", Title: "T", Message: "M"}
+
+	disabled := newSegmentSender(map[string]SegmentConfig{"all": {}}, nil, dispatcher, writer, newContentValidator(cfg.Content))
+	if _, err := disabled.Start(context.Background(), req); !errors.Is(err, errUsersDisabled) {
+		t.Errorf("send without user lookups: %v", err)
+	}
+
+	failing := newSegmentSender(map[string]SegmentConfig{"all": {}}, staticProfiles{err: errors.New("user service down")}, dispatcher, writer, newContentValidator(cfg.Content))
+	if _, err := failing.Start(context.Background(), req); !errors.Is(err, errNotLeader) {
+		t.Errorf("send on a follower: %v", err)
+	}
+	failing.leader.set(context.Background())
+	send, err := failing.Start(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for send.Status == sendRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		send, _ = failing.Get(send.ID)
+	}
+	if send.Status != sendFailed || send.Error != "user service down" {
+		t.Errorf("send = %+v, want failed with the user service error", send)
+	}
+}
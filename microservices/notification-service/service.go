@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"platform/pkg/logging"
+	"platform/pkg/reqctx"
+)
+
+var (
+	errNotificationNotFound = errors.New("Notification not found")
+	errActionNotFound       = errors.New("Action not found")
+	errGroupNotFound        = errors.New("Group not found")
+)
+
+// notificationService is what the notification API does, apart from HTTP
+//
+// Handlers decode requests and encode responses; everything in between
+// lives here and reaches notifications only through repo. Errors are the
+// sentinels above, errWriteBufferFull, errQueueFull, errShuttingDown,
+// errOverloaded, errThrottled, errQuotaExceeded, errUnknownType and errTypeQuarantined, or a validation
+// error for the client to fix.
+type notificationService struct {
+	repo       Repository
+	broadcasts *broadcastStore
+	writer     *notificationWriter
+	dispatcher *Dispatcher
+	hub        *notificationHub
+	presence   *presenceRegistry
+	content    *contentValidator
+	clicks     *clickTracker
+	campaigns  *campaignManager
+	shedder    *loadShedder
+	quotas     *quotaMeter
+	anomalies  *anomalyDetector
+	analytics  *analyticsRollups
+	types      *typeRegistry
+	lifecycle  *lifecycleStream
+	clock      clock
+}
+
+func newNotificationService(repo Repository, broadcasts *broadcastStore, writer *notificationWriter, dispatcher *Dispatcher, hub *notificationHub, presence *presenceRegistry, content *contentValidator, clicks *clickTracker, campaigns *campaignManager, shedder *loadShedder, quotas *quotaMeter, anomalies *anomalyDetector, analytics *analyticsRollups, types *typeRegistry, clock clock) *notificationService {
+	return &notificationService{
+		repo:       repo,
+		broadcasts: broadcasts,
+		writer:     writer,
+		dispatcher: dispatcher,
+		hub:        hub,
+		presence:   presence,
+		content:    content,
+		clicks:     clicks,
+		campaigns:  campaigns,
+		shedder:    shedder,
+		quotas:     quotas,
+		anomalies:  anomalies,
+		analytics:  analytics,
+		types:      types,
+		clock:      clock,
+	}
+}
+
+// SetLifecycle publishes reads and deletes to lifecycle; call it before serving requests
+func (s *notificationService) SetLifecycle(lifecycle *lifecycleStream) {
+	s.lifecycle = lifecycle
+}
+
+// All lists every notification, pinned ones first
+func (s *notificationService) All(filter notificationFilter) listing {
+	return listing{
+		count: s.repo.Len(),
+		all:   s.repo.List,
+		scan:  s.repo.Scan,
+	}.where(filter).pinnedFirst()
+}
+
+// Get returns the notification with the given ID
+func (s *notificationService) Get(id string) (Notification, error) {
+	notification, ok := s.repo.Get(id)
+	if !ok {
+		return Notification{}, errNotificationNotFound
+	}
+	return notification, nil
+}
+
+// InboxVersion changes whenever anything listed in userID's inbox changes
+func (s *notificationService) InboxVersion(userID string) string {
+	return s.repo.UserVersion(userID) + "." + s.broadcasts.Version()
+}
+
+// Inbox lists userID's notifications and broadcasts, pinned ones first
+//
+// Snoozed notifications are left out unless includeSnoozed is set.
+func (s *notificationService) Inbox(ctx context.Context, userID string, filter notificationFilter, includeSnoozed bool) listing {
+	return s.inbox(ctx, userID, filter, includeSnoozed).pinnedFirst()
+}
+
+// inbox lists userID's notifications and broadcasts in creation order
+func (s *notificationService) inbox(ctx context.Context, userID string, filter notificationFilter, includeSnoozed bool) listing {
+	now := s.clock.Now()
+	if !includeSnoozed {
+		filter.AwakeAt = now
+	}
+	return listing{
+		count: s.repo.CountByUser(userID),
+		all:   func() []Notification { return s.repo.ListByUser(userID) },
+		scan:  func(fn func(Notification) error) error { return s.repo.ScanUser(userID, fn) },
+	}.withBroadcasts(s.broadcasts.For(userID, reqctx.Tenant(ctx), now)).where(filter)
+}
+
+// Summary counts userID's inbox by category or type and status, with the latest notification of each
+//
+// The inbox is scanned once, in the order notifications were created.
+func (s *notificationService) Summary(ctx context.Context, userID string, filter notificationFilter, by string) inboxSummary {
+	summary := newInboxSummary(by)
+	// Only fn can fail the scan, and it never does
+	s.inbox(ctx, userID, filter, false).scan(func(notification Notification) error {
+		summary.add(notification)
+		return nil
+	})
+	return summary.sorted()
+}
+
+// GroupMembers returns userID's notifications sharing groupKey
+func (s *notificationService) GroupMembers(userID, groupKey string) ([]Notification, error) {
+	members := groupMembers(s.repo.ListByUser(userID), groupKey)
+	if len(members) == 0 {
+		return nil, errGroupNotFound
+	}
+	return members, nil
+}
+
+// newNotification builds the notification req asks for, checking its type, classification and content
+//
+// A notification of an unregistered type that is quarantined is returned
+// along with errTypeQuarantined.
+func (s *notificationService) newNotification(ctx context.Context, req CreateNotificationRequest, status string) (Notification, error) {
+	kind, typeErr := s.types.Resolve(req.Type)
+	category, tags, err := req.classification()
+	if err == nil {
+		err = s.content.Validate(req.Type, req.Actions, req.ImageURL, req.Data)
+	}
+	if err == nil {
+		err = kind.ValidateData(req.Data)
+	}
+	if err == nil && !errors.Is(typeErr, errTypeQuarantined) {
+		err = typeErr
+	}
+	if err != nil {
+		return Notification{}, err
+	}
+	notification := Notification{
+		ID:            uuid.New().String(),
+		UserID:        req.UserID,
+		Type:          req.Type,
+		Title:         req.Title,
+		Message:       req.Message,
+		Status:        status,
+		Category:      category,
+		Tags:          tags,
+		Campaign:      req.Campaign,
+		GroupKey:      req.GroupKey,
+		Actions:       req.Actions,
+		ImageURL:      req.ImageURL,
+		Data:          req.Data,
+		Tenant:        reqctx.Tenant(ctx),
+		CorrelationID: reqctx.CorrelationID(ctx),
+		TraceID:       reqctx.TraceID(ctx),
+		CreatedAt:     s.clock.Now(),
+	}
+	kind.apply(&notification)
+	return notification, typeErr
+}
+
+// Create stores a new notification without delivering it
+func (s *notificationService) Create(ctx context.Context, req CreateNotificationRequest) (Notification, error) {
+	notification, err := s.newNotification(ctx, req, "unread")
+	if errors.Is(err, errTypeQuarantined) {
+		s.types.Quarantine(notification)
+		return notification, err
+	}
+	if err == nil {
+		err = s.shedder.Admit(notification.Category)
+	}
+	if err == nil {
+		err = admitVolume(s.anomalies, s.quotas, notification, nil, mandatoryCategory(notification.Category))
+	}
+	if err != nil {
+		return Notification{}, err
+	}
+	if err := s.writer.Save(ctx, notification); err != nil {
+		s.quotas.Refund(notification.Tenant)
+		logging.FromContext(ctx).Warn("create rejected", "error", err)
+		return Notification{}, err
+	}
+	notificationsCreatedTotal.WithLabelValues(s.types.MetricLabel(notification.Type)).Inc()
+	s.clicks.Offered(notification)
+	return notification, nil
+}
+
+// Broadcast announces req to every user, or every user of its tenant
+//
+// It is checked like a created notification: its type against the
+// registry, then load shedding, the anomaly throttle and the tenant's
+// quota. A broadcast of a quarantined type is held for review instead,
+// returned with errTypeQuarantined.
+func (s *notificationService) Broadcast(ctx context.Context, req broadcastRequest) (broadcast, error) {
+	kind, typeErr := s.types.Resolve(req.Type)
+	if typeErr != nil && !errors.Is(typeErr, errTypeQuarantined) {
+		return broadcast{}, typeErr
+	}
+	category := req.Category
+	if category == "" {
+		category = categorySystem
+	}
+	if !validCategory(category) {
+		return broadcast{}, errors.New("Unknown category: " + category)
+	}
+	if err := kind.ValidateData(nil); err != nil {
+		return broadcast{}, err
+	}
+
+	b := broadcast{
+		ID:        broadcastIDPrefix + uuid.New().String(),
+		Tenant:    req.Tenant,
+		Type:      req.Type,
+		Title:     req.Title,
+		Message:   req.Message,
+		Category:  category,
+		CreatedAt: s.clock.Now(),
+		ExpiresAt: req.ExpiresAt,
+	}
+	// Throttles and quotas see the broadcast as a single notification of its tenant
+	announcement := b.copyFor("")
+	announcement.Tenant = b.Tenant
+	if typeErr != nil {
+		s.types.Quarantine(announcement)
+		return b, typeErr
+	}
+
+	err := s.shedder.Admit(category)
+	if err == nil {
+		err = admitVolume(s.anomalies, s.quotas, announcement, nil, mandatoryCategory(category))
+	}
+	if err != nil {
+		return broadcast{}, err
+	}
+	s.broadcasts.Add(b)
+	notificationsCreatedTotal.WithLabelValues(s.types.MetricLabel(b.Type)).Inc()
+	logging.FromContext(ctx).Info("broadcast announced", "broadcast_id", b.ID, "tenant", b.Tenant, "type", b.Type)
+	return b, nil
+}
+
+// prepareSend validates req, returning the notification it sends and the
+// channels to send it on, by default those of its type or email
+func (s *notificationService) prepareSend(ctx context.Context, req SendNotificationRequest) (Notification, []string, error) {
+	channels := req.Channels
+	if len(channels) == 0 {
+		channels = s.types.DefaultChannels(req.Type)
+	}
+	for _, channel := range channels {
+		if !s.dispatcher.Supports(channel) {
+			return Notification{}, nil, errors.New("Unsupported channel: " + channel)
+		}
+	}
+	notification, err := s.newNotification(ctx, req.CreateNotificationRequest, "sent")
+	if err != nil && !errors.Is(err, errTypeQuarantined) {
+		return Notification{}, nil, err
+	}
+	return notification, channels, err
+}
+
+// Send queues a new notification for delivery over req.Channels, by default those of its type or email, and stores it
+func (s *notificationService) Send(ctx context.Context, req SendNotificationRequest) (Notification, error) {
+	notification, channels, err := s.prepareSend(ctx, req)
+	if errors.Is(err, errTypeQuarantined) {
+		s.types.Quarantine(notification)
+		return notification, err
+	}
+	if err == nil {
+		err = s.shedder.Admit(notification.Category)
+	}
+	if err == nil {
+		err = admitVolume(s.anomalies, s.quotas, notification, channels, mandatoryCategory(notification.Category))
+	}
+	if err != nil {
+		return Notification{}, err
+	}
+
+	// Hand the notification to the delivery workers
+	if err := s.dispatcher.Enqueue(notification, channels); err != nil {
+		s.quotas.Refund(notification.Tenant)
+		logging.FromContext(ctx).Warn("send rejected", "error", err)
+		return Notification{}, err
+	}
+
+	notificationsCreatedTotal.WithLabelValues(s.types.MetricLabel(notification.Type)).Inc()
+	s.clicks.Offered(notification)
+	// Delivery is already queued, so failing the request would invite a duplicate send
+	if err := s.writer.Save(ctx, notification); err != nil {
+		logging.FromContext(ctx).Error("notification queued for delivery but not stored", "notification_id", notification.ID, "error", err)
+	}
+
+	logging.FromContext(ctx).Info("sending notification",
+		"notification_id", notification.ID,
+		"type", notification.Type,
+		"channels", channels,
+	)
+	return notification, nil
+}
+
+// MarkRead marks a notification, or a user's copy of a broadcast, as read
+func (s *notificationService) MarkRead(id string) (Notification, error) {
+	now := s.clock.Now()
+	if notification, ok := s.repo.MarkRead(id, now); ok {
+		s.campaigns.Read(notification)
+		s.analytics.Read(notification)
+		s.lifecycle.Read(notification)
+		return notification, nil
+	}
+	// A user's copy of a broadcast only records that the user read it
+	if notification, ok := s.broadcasts.MarkRead(id, now); ok {
+		return notification, nil
+	}
+	return Notification{}, errNotificationNotFound
+}
+
+// MarkAllRead marks userID's notifications and broadcasts as read, except pinned ones, returning how many changed
+func (s *notificationService) MarkAllRead(ctx context.Context, userID string) int {
+	now := s.clock.Now()
+	marked := s.repo.MarkAllRead(userID, now)
+	for _, notification := range marked {
+		s.campaigns.Read(notification)
+		s.analytics.Read(notification)
+		s.lifecycle.Read(notification)
+	}
+	return len(marked) + s.broadcasts.MarkAllRead(userID, reqctx.Tenant(ctx), now)
+}
+
+// Click records a tap on one of a notification's actions
+func (s *notificationService) Click(id, actionID string) (clickEvent, error) {
+	notification, ok := s.repo.Get(id)
+	if !ok {
+		return clickEvent{}, errNotificationNotFound
+	}
+	if !hasAction(notification, actionID) {
+		return clickEvent{}, errActionNotFound
+	}
+	s.campaigns.Clicked(notification)
+	return s.clicks.Click(notification, actionID, s.clock.Now()), nil
+}
+
+// SetPinned pins or unpins a notification
+func (s *notificationService) SetPinned(id string, pinned bool) (Notification, error) {
+	notification, ok := s.repo.SetPinned(id, pinned)
+	if !ok {
+		return Notification{}, errNotificationNotFound
+	}
+	return notification, nil
+}
+
+// Snooze hides a notification from the inbox until the snooze req asks for ends
+//
+// When it ends the notification reappears and is sent again to the user's
+// open streams. Snoozes live with the notifications they apply to, but the
+// wake-up is only scheduled in this process; WakeDue catches the ones a
+// restart lost.
+func (s *notificationService) Snooze(id string, req snoozeRequest) (Notification, error) {
+	now := s.clock.Now()
+	until, err := req.deadline(now)
+	if err != nil {
+		return Notification{}, err
+	}
+	notification, ok := s.repo.Snooze(id, until)
+	if !ok {
+		return Notification{}, errNotificationNotFound
+	}
+	s.clock.AfterFunc(until.Sub(now), func() { s.wake(id, until) })
+	return notification, nil
+}
+
+// WakeDue ends the snoozes that have run out without being woken, returning how many it ended
+//
+// Those are snoozes whose scheduled wake-up was lost with a restart, or that
+// came from seed data or a peer region and never had one.
+func (s *notificationService) WakeDue(ctx context.Context) int {
+	now := s.clock.Now()
+	var due []Notification
+	s.repo.Scan(func(notification Notification) error {
+		if notification.SnoozedUntil != nil && !notification.SnoozedUntil.After(now) {
+			due = append(due, notification)
+		}
+		return nil
+	})
+	woken := 0
+	for _, notification := range due {
+		if s.wake(notification.ID, *notification.SnoozedUntil) {
+			woken++
+		}
+	}
+	if woken > 0 {
+		logging.FromContext(ctx).Info("woke snoozed notifications", "notifications", woken)
+	}
+	return woken
+}
+
+// wake ends the snooze of the notification with the given ID, if it is still snoozed until then
+func (s *notificationService) wake(id string, until time.Time) bool {
+	notification, ok := s.repo.Wake(id, until)
+	if ok {
+		s.hub.Publish(notification)
+	}
+	return ok
+}
+
+// Delete removes a notification, returning it
+func (s *notificationService) Delete(id string) (Notification, error) {
+	notification, ok := s.repo.Delete(id)
+	if !ok {
+		return Notification{}, errNotificationNotFound
+	}
+	s.lifecycle.Deleted(notification)
+	return notification, nil
+}
+
+// purgeResult counts what a purge removed
+type purgeResult struct {
+	Cutoff        time.Time `json:"cutoff"`
+	Notifications int       `json:"notifications"`
+	Broadcasts    int       `json:"broadcasts"`
+}
+
+// Purge removes notifications older than olderThan, except pinned ones, and expired broadcasts
+func (s *notificationService) Purge(ctx context.Context, olderThan time.Duration) (purgeResult, error) {
+	if olderThan <= 0 {
+		return purgeResult{}, errors.New("older_than must be a positive duration")
+	}
+	now := s.clock.Now()
+	cutoff := now.Add(-olderThan)
+	result := purgeResult{
+		Cutoff:        cutoff,
+		Notifications: s.repo.Purge(cutoff),
+		Broadcasts:    s.broadcasts.PurgeExpired(now),
+	}
+	if result.Notifications > 0 || result.Broadcasts > 0 {
+		logging.FromContext(ctx).Info("purged expired data", "cutoff", result.Cutoff,
+			"notifications", result.Notifications, "broadcasts", result.Broadcasts)
+	}
+	return result, nil
+}
+
+// Expire deletes the notifications past their type's retention, except pinned ones, returning how many
+func (s *notificationService) Expire(ctx context.Context) int {
+	now := s.clock.Now()
+	var expired []Notification
+	s.repo.Scan(func(notification Notification) error {
+		if s.types.Expired(notification, now) {
+			expired = append(expired, notification)
+		}
+		return nil
+	})
+	deleted := 0
+	for _, notification := range expired {
+		if _, ok := s.repo.Delete(notification.ID); ok {
+			notificationsExpiredTotal.WithLabelValues(notification.Type).Inc()
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		logging.FromContext(ctx).Info("deleted notifications past their retention", "notifications", deleted)
+	}
+	return deleted
+}
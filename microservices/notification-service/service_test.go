@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"platform/pkg/reqctx"
+)
+
+// fakeClock is a clock that only moves when Advance is called
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	f  func()
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), f: f})
+}
+
+// Advance moves the clock forward by d and runs the timers that became due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []func()
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+		} else {
+			due = append(due, timer.f)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	for _, f := range due {
+		f()
+	}
+}
+
+// testService returns a notification service over repo with the default
+// config, except that it accepts notifications of any type
+func testService(repo Repository, broadcasts *broadcastStore, clock clock) *notificationService {
+	cfg := defaultConfig()
+	cfg.Types.Unknown = unknownTypesAllow
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	hub := newNotificationHub()
+	writer := newNotificationWriter(WriteBehindConfig{}, repo, hub)
+	return newNotificationService(repo, broadcasts, writer, dispatcher, hub, newPresenceRegistry("test", false), newContentValidator(cfg.Content), newClickTracker(), newCampaignManager(newTemplateStore(), nil), newLoadShedder(cfg.LoadShedding, dispatcher, writer), newQuotaMeter(cfg.Quotas), nil, newAnalyticsRollups(), newTypeRegistry(cfg.Types), clock)
+}
+
+func TestServiceUsesClock(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	service := testService(newNotificationStore(testNotification("a1", "alice")), newBroadcastStore(), newFakeClock(now))
+
+	created, err := service.Create(context.Background(), CreateNotificationRequest{UserID: "alice", Type: "info", Title: "Hi", Message: "Hello"})
+	if err != nil || !created.CreatedAt.Equal(now) {
+		t.Errorf("Create = %+v, %v; want created at %v", created, err, now)
+	}
+	read, err := service.MarkRead("a1")
+	if err != nil || read.ReadAt == nil || !read.ReadAt.Equal(now) {
+		t.Errorf("MarkRead = %+v, %v; want read at %v", read, err, now)
+	}
+}
+
+func TestCreateLabelsUnregisteredTypes(t *testing.T) {
+	service := testService(newNotificationStore(), newBroadcastStore(), newFakeClock(time.Now()))
+	unregistered := testutil.ToFloat64(notificationsCreatedTotal.WithLabelValues(unregisteredTypeLabel))
+
+	if _, err := service.Create(context.Background(), CreateNotificationRequest{UserID: "alice", Type: "made-up", Title: "Hi", Message: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(notificationsCreatedTotal.WithLabelValues(unregisteredTypeLabel)); got != unregistered+1 {
+		t.Errorf("unregistered creates = %v, want %v", got, unregistered+1)
+	}
+	if got := testutil.ToFloat64(notificationsCreatedTotal.WithLabelValues("made-up")); got != 0 {
+		t.Errorf("creates labelled with the unregistered type = %v, want 0", got)
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	store := newNotificationStore(testNotification("a1", "alice"))
+	service := testService(store, newBroadcastStore(), systemClock{})
+
+	for name, err := range map[string]error{
+		"get":       second(service.Get("missing")),
+		"mark read": second(service.MarkRead("missing")),
+		"pin":       second(service.SetPinned("missing", true)),
+		"snooze":    second(service.Snooze("missing", snoozeRequest{Duration: "1h"})),
+		"delete":    second(service.Delete("missing")),
+	} {
+		if !errors.Is(err, errNotificationNotFound) {
+			t.Errorf("%s of an unknown notification: %v", name, err)
+		}
+	}
+	if _, err := service.Click("a1", "missing"); !errors.Is(err, errActionNotFound) {
+		t.Errorf("clicking an unknown action: %v", err)
+	}
+	if _, err := service.GroupMembers("alice", "missing"); !errors.Is(err, errGroupNotFound) {
+		t.Errorf("listing an unknown group: %v", err)
+	}
+
+	req := SendNotificationRequest{
+		CreateNotificationRequest: CreateNotificationRequest{UserID: "alice", Type: "info", Title: "Hi", Message: "Hello"},
+		Channels:                  []string{"pigeon"},
+	}
+	if _, err := service.Send(context.Background(), req); err == nil || err.Error() != "Unsupported channel: pigeon" {
+		t.Errorf("sending over an unknown channel: %v", err)
+	}
+	if store.Len() != 1 {
+		t.Errorf("rejected requests stored notifications: %d stored", store.Len())
+	}
+}
+
+// second returns the error of a (Notification, error) result
+func second(_ Notification, err error) error {
+	return err
+}
+
+func TestTraceExemplars(t *testing.T) {
+	service := testService(newNotificationStore(), newBroadcastStore(), systemClock{})
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx := reqctx.WithTraceID(context.Background(), traceID)
+	created, err := service.Create(ctx, CreateNotificationRequest{UserID: "alice", Type: "info", Title: "Hi", Message: "Hello"})
+	if err != nil || created.TraceID != traceID {
+		t.Fatalf("Create = %+v, %v; want the request's trace ID", created, err)
+	}
+
+	// The end-to-end latency of its delivery links back to the trace
+	newSLOPolicy(defaultConfig().SLO).observeDelivered("trace-test", created)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(deliveryEndToEndLatency)
+	families, _ := reg.Gather()
+	var exemplar *dto.Exemplar
+	for _, metric := range families[0].GetMetric() {
+		for _, label := range metric.GetLabel() {
+			if label.GetValue() != "trace-test" {
+				continue
+			}
+			for _, bucket := range metric.GetHistogram().GetBucket() {
+				if bucket.GetExemplar() != nil {
+					exemplar = bucket.GetExemplar()
+				}
+			}
+		}
+	}
+	if exemplar == nil || exemplar.GetLabel()[0].GetValue() != traceID {
+		t.Errorf("exemplar = %v, want trace_id %s", exemplar, traceID)
+	}
+}
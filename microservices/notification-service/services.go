@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/url"
+
+	"notification-service/internal/discovery"
+	"platform/pkg/health"
+)
+
+// Sibling services the notification service calls
+const (
+	serviceUser  = "user-service"
+	serviceOrder = "order-service"
+)
+
+// newServiceDiscovery builds the endpoint picker shared by all outbound callers
+func newServiceDiscovery(cfg DiscoveryConfig) *discovery.Client {
+	var resolver discovery.Resolver = discovery.Kubernetes{
+		Namespace: cfg.Namespace,
+		Ports:     cfg.Services,
+	}
+	if cfg.Provider == "consul" {
+		resolver = discovery.NewConsul(cfg.ConsulAddr, cfg.ConsulToken, cfg.CacheTTL)
+	}
+	return discovery.NewClient(resolver, cfg.EjectionPeriod)
+}
+
+// registerServiceChecks adds a soft readiness check per sibling service
+func registerServiceChecks(probes *health.Registry, cfg HealthConfig, services *discovery.Client, names []string) {
+	for _, name := range names {
+		probes.Register(health.Check{
+			Name:     name,
+			Critical: false,
+			Timeout:  cfg.CheckTimeout,
+			Probe:    serviceProbe(services, name),
+		})
+	}
+}
+
+// serviceProbe dials the endpoint discovery would hand out next
+func serviceProbe(services *discovery.Client, name string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		endpoint, err := services.Endpoint(ctx, name)
+		if err != nil {
+			return err
+		}
+		parsed, err := url.Parse(endpoint)
+		if err != nil {
+			return err
+		}
+		if err := health.TCPProbe(parsed.Host)(ctx); err != nil {
+			services.ReportFailure(endpoint)
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/logging"
+)
+
+// shadowSendTimeout bounds a single shadow send
+const shadowSendTimeout = 30 * time.Second
+
+// Which provider a shadowed delivery went through
+const (
+	shadowRolePrimary = "primary"
+	shadowRoleShadow  = "shadow"
+)
+
+var (
+	shadowDeliveriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shadow_deliveries_total",
+			Help: "Total number of deliveries copied to the shadow provider by outcome",
+		},
+		[]string{"channel", "status"},
+	)
+
+	shadowDeliveryLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "shadow_delivery_latency_seconds",
+			Help:    "Time spent handing a notification to the shadow provider",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"channel"},
+	)
+)
+
+// shadowCounts sums one provider's sends of the shadowed deliveries on a channel
+type shadowCounts struct {
+	Sends    int64 `json:"sends"`
+	Failures int64 `json:"failures"`
+	// Dropped counts deliveries not copied because too many shadow sends were in flight
+	Dropped       int64   `json:"dropped,omitempty"`
+	FailureRate   float64 `json:"failure_rate"`
+	MeanLatencyMS float64 `json:"mean_latency_ms"`
+
+	latency time.Duration
+}
+
+// shadowComparison sets the primary and shadow provider side by side for one channel
+type shadowComparison struct {
+	Channel  string       `json:"channel"`
+	Provider string       `json:"provider"`
+	Primary  shadowCounts `json:"primary"`
+	Shadow   shadowCounts `json:"shadow"`
+}
+
+// shadowStats compares the primary and shadow providers over the same deliveries
+type shadowStats struct {
+	provider string
+	// records holds the shadow provider's receipts, apart from the real ones
+	records *deliveryRecords
+
+	mu       sync.Mutex
+	channels map[string]*shadowComparison
+}
+
+func newShadowStats(provider string, records *deliveryRecords) *shadowStats {
+	return &shadowStats{provider: provider, records: records, channels: make(map[string]*shadowComparison)}
+}
+
+// observe records a send through role's provider
+func (s *shadowStats) observe(channel, role string, err error, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := s.countsLocked(channel, role)
+	counts.Sends++
+	counts.latency += latency
+	if err != nil {
+		counts.Failures++
+	}
+}
+
+// dropped records a delivery that was not copied
+func (s *shadowStats) dropped(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.countsLocked(channel, shadowRoleShadow).Dropped++
+}
+
+func (s *shadowStats) countsLocked(channel, role string) *shadowCounts {
+	comparison, ok := s.channels[channel]
+	if !ok {
+		comparison = &shadowComparison{Channel: channel, Provider: s.provider}
+		s.channels[channel] = comparison
+	}
+	if role == shadowRolePrimary {
+		return &comparison.Primary
+	}
+	return &comparison.Shadow
+}
+
+// Compare returns the comparison of every shadowed channel, sorted by channel
+func (s *shadowStats) Compare() []shadowComparison {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	comparisons := make([]shadowComparison, 0, len(s.channels))
+	for _, comparison := range s.channels {
+		c := *comparison
+		for _, counts := range []*shadowCounts{&c.Primary, &c.Shadow} {
+			if counts.Sends > 0 {
+				counts.FailureRate = float64(counts.Failures) / float64(counts.Sends)
+				counts.MeanLatencyMS = float64(counts.latency.Microseconds()) / 1000 / float64(counts.Sends)
+			}
+		}
+		comparisons = append(comparisons, c)
+	}
+	sort.Slice(comparisons, func(i, j int) bool { return comparisons[i].Channel < comparisons[j].Channel })
+	return comparisons
+}
+
+// shadowSender delivers through primary and copies a sample of deliveries to shadow
+//
+// The copy is sent in the background and its result only recorded, so the
+// shadow provider cannot fail or slow down the real delivery. Every attempt
+// is copied, so both providers are compared over the same sends.
+type shadowSender struct {
+	channel    string
+	primary    Sender
+	shadow     Sender
+	sampleRate float64
+	inFlight   chan struct{}
+	stats      *shadowStats
+}
+
+func (s *shadowSender) Send(ctx context.Context, notification Notification, to recipient) error {
+	if s.sampleRate < 1 && rand.Float64() >= s.sampleRate {
+		return s.primary.Send(ctx, notification, to)
+	}
+	select {
+	case s.inFlight <- struct{}{}:
+		go s.copy(context.WithoutCancel(ctx), notification, to)
+	default:
+		s.stats.dropped(s.channel)
+		shadowDeliveriesTotal.WithLabelValues(s.channel, "dropped").Inc()
+		return s.primary.Send(ctx, notification, to)
+	}
+
+	start := time.Now()
+	err := s.primary.Send(ctx, notification, to)
+	s.stats.observe(s.channel, shadowRolePrimary, err, time.Since(start))
+	return err
+}
+
+// copy sends notification through the shadow provider once
+func (s *shadowSender) copy(ctx context.Context, notification Notification, to recipient) {
+	defer func() { <-s.inFlight }()
+	ctx, cancel := context.WithTimeout(ctx, shadowSendTimeout)
+	defer cancel()
+	// Marks what the shadow provider logs apart from real deliveries
+	ctx = logging.NewContext(ctx, logging.FromContext(ctx).With("shadow", true))
+
+	start := time.Now()
+	err := s.shadow.Send(ctx, notification, to)
+	latency := time.Since(start)
+	s.stats.observe(s.channel, shadowRoleShadow, err, latency)
+	shadowDeliveryLatency.WithLabelValues(s.channel).Observe(latency.Seconds())
+	if err != nil {
+		shadowDeliveriesTotal.WithLabelValues(s.channel, "failed").Inc()
+		logging.FromContext(ctx).Debug("shadow delivery failed", "notification_id", notification.ID, "error", err)
+		return
+	}
+	shadowDeliveriesTotal.WithLabelValues(s.channel, "delivered").Inc()
+}
+
+// Shadow copies deliveries on cfg's channels to the sender newSender returns for each
+//
+// Call it after UseProvider and before SuppressAddresses, so suppressed
+// addresses are not copied either; Sandbox replaces it.
+func (d *Dispatcher) Shadow(cfg ShadowProviderConfig, newSender func(channel string) Sender, stats *shadowStats) {
+	inFlight := make(chan struct{}, cfg.MaxInFlight)
+	for _, channel := range cfg.Channels {
+		d.senders[channel] = &shadowSender{
+			channel:    channel,
+			primary:    d.senders[channel],
+			shadow:     newSender(channel),
+			sampleRate: cfg.SampleRate,
+			inFlight:   inFlight,
+			stats:      stats,
+		}
+	}
+}
+
+// registerShadowRoutes adds the admin endpoints comparing the shadow provider with the primary one
+func registerShadowRoutes(admin *gin.RouterGroup, stats *shadowStats) {
+	admin.GET("/shadow", func(c *gin.Context) {
+		comparisons := stats.Compare()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    comparisons,
+			"count":   len(comparisons),
+		})
+	})
+
+	// Receipts the shadow provider reported, which never reach the real delivery records
+	admin.GET("/shadow/notifications/:id", func(c *gin.Context) {
+		records := stats.records.For(c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    records,
+			"count":   len(records),
+		})
+	})
+}
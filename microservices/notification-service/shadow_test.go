@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestShadowProvider(t *testing.T) {
+	// The real provider delivers; the one on trial fails every send and bounces nothing
+	records := newDeliveryRecords()
+	dispatcher := mockDispatcher(t, MockProviderConfig{}, records, newSuppressionList())
+	cfg := defaultConfig().Providers.Shadow
+	cfg.Name, cfg.Channels = providerMock, []string{channelEmail}
+	shadow := newShadowStats(providerMock, newDeliveryRecords())
+	dispatcher.Shadow(cfg, newMockProvider(MockProviderConfig{FailureRate: 1}, shadow.records, newSuppressionList()).Sender, shadow)
+
+	for _, id := range []string{"1", "2", "3"} {
+		dispatcher.Enqueue(Notification{ID: id, UserID: "alice", Type: "order_status"}, []string{channelEmail, channelPush})
+	}
+	drain(t, dispatcher)
+	waitFor(t, "the shadow sends", func() bool {
+		comparisons := shadow.Compare()
+		return len(comparisons) == 1 && comparisons[0].Shadow.Sends == 3
+	})
+
+	// The shadow's failures are recorded but never reach the real deliveries
+	if dead := dispatcher.DeadLetters(); len(dead) != 0 {
+		t.Errorf("dead letters = %+v, want none", dead)
+	}
+	c := shadow.Compare()[0]
+	if c.Channel != channelEmail || c.Primary.Sends != 3 || c.Primary.Failures != 0 || c.Shadow.FailureRate != 1 {
+		t.Errorf("comparison = %+v, want 3 primary sends and every shadow send failed", c)
+	}
+
+	r := gin.New()
+	registerShadowRoutes(r.Group("/api/admin"), shadow)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/shadow", nil))
+	var resp struct {
+		Data []shadowComparison `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Data) != 1 || resp.Data[0].Provider != providerMock {
+		t.Errorf("GET /shadow returned %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestShadowProviderConfig(t *testing.T) {
+	for name, shadow := range map[string]ShadowProviderConfig{
+		"unknown provider":  {Name: "acme", Channels: []string{channelEmail}, SampleRate: 1, MaxInFlight: 1},
+		"no channels":       {Name: providerLog, SampleRate: 1, MaxInFlight: 1},
+		"unknown channel":   {Name: providerLog, Channels: []string{"fax"}, SampleRate: 1, MaxInFlight: 1},
+		"zero sample rate":  {Name: providerLog, Channels: []string{channelEmail}, MaxInFlight: 1},
+		"nothing in flight": {Name: providerLog, Channels: []string{channelEmail}, SampleRate: 1},
+	} {
+		cfg := defaultConfig()
+		cfg.Providers.Shadow = shadow
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
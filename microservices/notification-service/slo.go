@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/middleware"
+)
+
+// SLO metrics for end-to-end delivery latency
+var (
+	deliveryEndToEndLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "notification_delivery_e2e_seconds",
+			Help:    "Time from notification creation to confirmed delivery",
+			Buckets: []float64{1, 2.5, 5, 10, 15, 30, 60, 120, 300, 600},
+		},
+		[]string{"channel"},
+	)
+
+	sloEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_slo_events_total",
+			Help: "Deliveries counted against the latency SLO; result=bad burns error budget",
+		},
+		[]string{"channel", "result"},
+	)
+
+	sloObjectiveSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "notification_slo_objective_seconds",
+			Help: "Configured end-to-end delivery latency objective",
+		},
+		[]string{"channel"},
+	)
+
+	sloTargetRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "notification_slo_target_ratio",
+			Help: "Fraction of deliveries that must meet the latency objective",
+		},
+		[]string{"channel"},
+	)
+)
+
+// sloPolicy holds the per-channel latency objectives
+type sloPolicy struct {
+	objectives       map[string]time.Duration
+	defaultObjective time.Duration
+	target           float64
+}
+
+// newSLOPolicy builds the policy and publishes its objectives as metrics
+func newSLOPolicy(cfg SLOConfig) *sloPolicy {
+	policy := &sloPolicy{
+		objectives:       cfg.Objectives,
+		defaultObjective: cfg.DefaultObjective,
+		target:           cfg.Target,
+	}
+
+	for _, channel := range []string{channelEmail, channelSMS, channelPush} {
+		sloObjectiveSeconds.WithLabelValues(channel).Set(policy.objective(channel).Seconds())
+		sloTargetRatio.WithLabelValues(channel).Set(policy.target)
+	}
+	return policy
+}
+
+func (p *sloPolicy) objective(channel string) time.Duration {
+	if objective, ok := p.objectives[channel]; ok {
+		return objective
+	}
+	return p.defaultObjective
+}
+
+// observeDelivered records a confirmed delivery of notification
+func (p *sloPolicy) observeDelivered(channel string, notification Notification) {
+	latency := time.Since(notification.CreatedAt)
+	middleware.ObserveWithTrace(deliveryEndToEndLatency.WithLabelValues(channel), latency.Seconds(), notification.TraceID)
+
+	result := "good"
+	if latency > p.objective(channel) {
+		result = "bad"
+	}
+	sloEventsTotal.WithLabelValues(channel, result).Inc()
+}
+
+// observeFailed records a delivery that was given up on, which always burns budget
+func (p *sloPolicy) observeFailed(channel string) {
+	sloEventsTotal.WithLabelValues(channel, "bad").Inc()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// maxSnooze is the longest a notification can be snoozed for
+const maxSnooze = 30 * 24 * time.Hour
+
+// snoozeSweepInterval is how often snoozes that ran out without being woken are looked for
+const snoozeSweepInterval = time.Minute
+
+// snoozeRequest snoozes a notification for Duration, e.g. "2h", or until Until
+type snoozeRequest struct {
+	Duration string     `json:"duration"`
+	Until    *time.Time `json:"until"`
+}
+
+// deadline returns when the snooze requested at now ends
+func (req snoozeRequest) deadline(now time.Time) (time.Time, error) {
+	var until time.Time
+	switch {
+	case req.Duration != "" && req.Until != nil:
+		return time.Time{}, errors.New("Only one of duration and until may be set")
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return time.Time{}, errors.New("Invalid duration: " + req.Duration)
+		}
+		until = now.Add(d)
+	case req.Until != nil:
+		until = *req.Until
+	default:
+		return time.Time{}, errors.New("One of duration and until is required")
+	}
+
+	if !until.After(now) || until.Sub(now) > maxSnooze {
+		return time.Time{}, errors.New("Snooze must end in the future and within 30 days")
+	}
+	return until, nil
+}
+
+// runSnoozeSweeper wakes the notifications whose snooze ran out every interval until ctx is cancelled
+func runSnoozeSweeper(ctx context.Context, service *notificationService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.WakeDue(ctx)
+		}
+	}
+}
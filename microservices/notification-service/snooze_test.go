@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSnoozeDeadline(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+	tooLate := now.Add(maxSnooze + time.Minute)
+
+	for _, tc := range []struct {
+		name string
+		req  snoozeRequest
+		want time.Time
+	}{
+		{"duration", snoozeRequest{Duration: "90m"}, now.Add(90 * time.Minute)},
+		{"until", snoozeRequest{Until: &later}, later},
+		{"neither", snoozeRequest{}, time.Time{}},
+		{"both", snoozeRequest{Duration: "1h", Until: &later}, time.Time{}},
+		{"bad duration", snoozeRequest{Duration: "soon"}, time.Time{}},
+		{"negative duration", snoozeRequest{Duration: "-1h"}, time.Time{}},
+		{"past", snoozeRequest{Until: &past}, time.Time{}},
+		{"too long", snoozeRequest{Until: &tooLate}, time.Time{}},
+	} {
+		got, err := tc.req.deadline(now)
+		if !got.Equal(tc.want) || (err == nil) == tc.want.IsZero() {
+			t.Errorf("%s: deadline = %v, %v; want %v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+func TestSnoozedNotificationReappears(t *testing.T) {
+	store := newNotificationStore(testNotification("a1", "alice"), testNotification("a2", "alice"))
+	clock := newFakeClock(time.Now())
+	service := testService(store, newBroadcastStore(), clock)
+	updates, cancel := service.hub.Subscribe("alice")
+	defer cancel()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAPIRoutes(r.Group("/api"), context.Background(), service, newTemplateStore(), 1000)
+	snooze := func(id, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/notifications/"+id+"/snooze", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	inbox := func(query string) string {
+		var resp listEnvelope
+		json.Unmarshal(getListing(r, "/api/users/alice/notifications"+query, "").Body.Bytes(), &resp)
+		return ids(resp.Data)
+	}
+
+	if code := snooze("missing", `{"duration":"1h"}`); code != http.StatusNotFound {
+		t.Errorf("snoozing an unknown notification returned %d, want 404", code)
+	}
+	if code := snooze("a1", `{"duration":"1h","until":"2030-01-01T00:00:00Z"}`); code != http.StatusBadRequest {
+		t.Errorf("snoozing with duration and until returned %d, want 400", code)
+	}
+	if code := snooze("a1", `{"duration":"1h"}`); code != http.StatusOK {
+		t.Fatalf("snooze returned %d", code)
+	}
+	clock.Advance(59 * time.Minute)
+	if got := inbox(""); got != "a2" {
+		t.Errorf("inbox while snoozed = %s, want a2", got)
+	}
+	if got := inbox("?include_snoozed=true"); got != "a1,a2" {
+		t.Errorf("inbox including snoozed = %s, want a1,a2", got)
+	}
+	select {
+	case n := <-updates:
+		t.Fatalf("%s was re-sent before its snooze ended", n.ID)
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case n := <-updates:
+		if n.ID != "a1" || n.SnoozedUntil != nil {
+			t.Errorf("woken notification = %+v", n)
+		}
+	default:
+		t.Fatal("snoozed notification was not re-sent when its snooze ended")
+	}
+	if got := inbox(""); got != "a1,a2" {
+		t.Errorf("inbox after snooze = %s, want a1,a2", got)
+	}
+}
+
+func TestResnoozeKeepsLaterSnooze(t *testing.T) {
+	store := newNotificationStore(testNotification("a1", "alice"))
+	first := time.Now().Add(time.Minute)
+	second := first.Add(time.Hour)
+	store.Snooze("a1", first)
+	store.Snooze("a1", second)
+
+	if _, ok := store.Wake("a1", first); ok {
+		t.Error("the first snooze's wake-up ended the second snooze")
+	}
+	if n, _ := store.Get("a1"); n.SnoozedUntil == nil || !n.SnoozedUntil.Equal(second) {
+		t.Errorf("snoozed until %v, want %v", n.SnoozedUntil, second)
+	}
+	if n, ok := store.Wake("a1", second); !ok || n.SnoozedUntil != nil {
+		t.Errorf("Wake = %+v, %v", n, ok)
+	}
+}
+
+func TestWakeDueEndsLostSnoozes(t *testing.T) {
+	now := time.Now()
+	// Snoozed before a restart, so no wake-up is scheduled for either
+	store := newNotificationStore(testNotification("a1", "alice"), testNotification("a2", "alice"))
+	store.Snooze("a1", now.Add(-time.Minute))
+	store.Snooze("a2", now.Add(time.Hour))
+	service := testService(store, newBroadcastStore(), newFakeClock(now))
+	updates, cancel := service.hub.Subscribe("alice")
+	defer cancel()
+
+	if woken := service.WakeDue(context.Background()); woken != 1 {
+		t.Errorf("woke %d notifications, want 1", woken)
+	}
+	select {
+	case n := <-updates:
+		if n.ID != "a1" || n.SnoozedUntil != nil {
+			t.Errorf("woken notification = %+v", n)
+		}
+	default:
+		t.Error("woken notification was not re-sent")
+	}
+	if n, _ := store.Get("a2"); n.SnoozedUntil == nil {
+		t.Error("a snooze still running was ended")
+	}
+	if woken := service.WakeDue(context.Background()); woken != 0 {
+		t.Errorf("second sweep woke %d notifications, want 0", woken)
+	}
+}
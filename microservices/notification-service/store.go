@@ -0,0 +1,599 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"notification-service/internal/shard"
+)
+
+var (
+	storeShardOperationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_store_shard_operations_total",
+			Help: "Total number of store operations served by each shard",
+		},
+		[]string{"shard", "op"},
+	)
+
+	storeShardLockWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "notification_store_shard_lock_wait_seconds",
+			Help:    "Time store operations waited for each shard's lock",
+			Buckets: []float64{0.00001, 0.0001, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+		},
+		[]string{"shard", "mode"},
+	)
+
+	storeShardErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_store_shard_errors_total",
+			Help: "Total number of store writes on each shard that lost their notification to a concurrent delete",
+		},
+		[]string{"shard"},
+	)
+)
+
+// storedNotification is a notification plus its position in creation order
+type storedNotification struct {
+	seq          uint64
+	notification Notification
+}
+
+// notificationStore holds notifications in memory, sharded by user ID
+//
+// Each user's notifications live on the shard a consistent-hash ring picks
+// for the user, and each shard has its own lock, so writes for different
+// users rarely contend. Queries by user touch a single shard; lookups by
+// notification ID and full listings fan out to every shard. Notifications
+// are deep-copied on the way in and out, tags, data and actions included, so
+// neither the caller nor the store sees the other's later changes.
+type notificationStore struct {
+	ring   *shard.Ring
+	shards []*storeShard
+	// seq orders notifications across shards
+	seq atomic.Uint64
+	// epoch changes on restart so inbox versions from an earlier process never match
+	epoch int64
+	// chaos, if set, fails batch writes with chaos mode's store faults
+	chaos atomic.Pointer[chaosInjector]
+}
+
+// storeShard holds the notifications of the users the ring assigns to it
+type storeShard struct {
+	name string
+	mu   sync.RWMutex
+	byID map[string]*storedNotification
+	// byUser keeps each user's notifications in creation order
+	byUser map[string][]*storedNotification
+
+	// mutations and userVersions version each user's inbox
+	mutations    uint64
+	userVersions map[string]uint64
+
+	reads, writes       prometheus.Counter
+	readWait, writeWait prometheus.Observer
+	errors              prometheus.Counter
+}
+
+// newNotificationStore returns a single-shard store
+func newNotificationStore(seed ...Notification) *notificationStore {
+	return newShardedStore(StorageConfig{Shards: []string{"shard-0"}, VirtualNodes: 1}, seed...)
+}
+
+// newShardedStore returns a store with the shards named in cfg
+func newShardedStore(cfg StorageConfig, seed ...Notification) *notificationStore {
+	s := &notificationStore{
+		ring:  shard.New(cfg.Shards, cfg.VirtualNodes),
+		epoch: time.Now().UnixNano(),
+	}
+	for _, name := range cfg.Shards {
+		s.shards = append(s.shards, &storeShard{
+			name:         name,
+			byID:         make(map[string]*storedNotification),
+			byUser:       make(map[string][]*storedNotification),
+			userVersions: make(map[string]uint64),
+			reads:        storeShardOperationsTotal.WithLabelValues(name, "read"),
+			writes:       storeShardOperationsTotal.WithLabelValues(name, "write"),
+			readWait:     storeShardLockWait.WithLabelValues(name, "read"),
+			writeWait:    storeShardLockWait.WithLabelValues(name, "write"),
+			errors:       storeShardErrorsTotal.WithLabelValues(name),
+		})
+	}
+	for _, notification := range seed {
+		s.Add(notification)
+	}
+	return s
+}
+
+// shardFor returns the shard holding userID's notifications
+func (s *notificationStore) shardFor(userID string) *storeShard {
+	return s.shards[s.ring.Locate(userID)]
+}
+
+// Add stores notification, replacing any notification with the same ID on the user's shard
+func (s *notificationStore) Add(notification Notification) {
+	sh := s.shardFor(notification.UserID)
+	sh.lock()
+	defer sh.mu.Unlock()
+	sh.addLocked(notification, s.seq.Add(1))
+	sh.writes.Inc()
+}
+
+// AddBatch stores notifications taking each shard's lock once
+//
+// Each user's notifications keep their order in the batch; notifications of
+// users on different shards are ordered shard by shard.
+func (s *notificationStore) AddBatch(notifications []Notification) {
+	byShard := make([][]Notification, len(s.shards))
+	for _, notification := range notifications {
+		i := s.ring.Locate(notification.UserID)
+		byShard[i] = append(byShard[i], notification)
+	}
+	for i, batch := range byShard {
+		if len(batch) == 0 {
+			continue
+		}
+		sh := s.shards[i]
+		sh.lock()
+		for _, notification := range batch {
+			// seq is taken under the lock so each shard's user lists stay sorted by it
+			sh.addLocked(notification, s.seq.Add(1))
+		}
+		sh.mu.Unlock()
+		sh.writes.Add(float64(len(batch)))
+	}
+}
+
+var _ batchStore = (*notificationStore)(nil)
+
+// WriteBatch stores notifications like AddBatch for the write-behind writer
+//
+// It fails once ctx is done, when a flush is abandoned at shutdown, so that
+// batch is spooled for the next start rather than dropped, and when chaos
+// mode injects a store fault.
+func (s *notificationStore) WriteBatch(ctx context.Context, notifications []Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.chaos.Load().Inject(ctx, chaosStore); err != nil {
+		return err
+	}
+	s.AddBatch(notifications)
+	return nil
+}
+
+// Chaos injects chaos's store faults into batch writes
+func (s *notificationStore) Chaos(chaos *chaosInjector) {
+	s.chaos.Store(chaos)
+}
+
+// Get returns the notification with the given ID
+func (s *notificationStore) Get(id string) (Notification, bool) {
+	for _, sh := range s.shards {
+		sh.rlock()
+		stored, ok := sh.byID[id]
+		var notification Notification
+		if ok {
+			notification = cloneNotification(stored.notification)
+		}
+		sh.mu.RUnlock()
+		if ok {
+			sh.reads.Inc()
+			return notification, true
+		}
+	}
+	return Notification{}, false
+}
+
+// List returns every notification in creation order
+func (s *notificationStore) List() []Notification {
+	var all []storedNotification
+	for _, sh := range s.shards {
+		sh.rlock()
+		for _, stored := range sh.byID {
+			all = append(all, storedNotification{seq: stored.seq, notification: cloneNotification(stored.notification)})
+		}
+		sh.mu.RUnlock()
+		sh.reads.Inc()
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].seq < all[j].seq })
+	list := make([]Notification, len(all))
+	for i, stored := range all {
+		list[i] = stored.notification
+	}
+	return list
+}
+
+// ListByUser returns userID's notifications in creation order, nil if there are none
+func (s *notificationStore) ListByUser(userID string) []Notification {
+	sh := s.shardFor(userID)
+	sh.rlock()
+	defer sh.mu.RUnlock()
+	sh.reads.Inc()
+	return copyNotifications(sh.byUser[userID])
+}
+
+// shardRef is a stored notification and the shard whose lock guards it
+type shardRef struct {
+	shard  *storeShard
+	stored *storedNotification
+}
+
+// Scan calls fn with every notification in creation order
+//
+// Unlike List it never copies the whole store: notifications are copied a
+// chunk at a time and fn runs without any lock held, so it may write to a
+// slow client. Notifications deleted during the scan are skipped. Scan stops
+// at the first error from fn and returns it.
+func (s *notificationStore) Scan(fn func(Notification) error) error {
+	var refs []shardRef
+	for _, sh := range s.shards {
+		sh.rlock()
+		for _, stored := range sh.byID {
+			refs = append(refs, shardRef{sh, stored})
+		}
+		sh.mu.RUnlock()
+		sh.reads.Inc()
+	}
+
+	// seq never changes once stored, so sorting outside the locks is safe
+	sort.Slice(refs, func(i, j int) bool { return refs[i].stored.seq < refs[j].stored.seq })
+	return scan(refs, fn)
+}
+
+// ScanUser is Scan restricted to userID's notifications
+func (s *notificationStore) ScanUser(userID string, fn func(Notification) error) error {
+	sh := s.shardFor(userID)
+	sh.rlock()
+	refs := make([]shardRef, len(sh.byUser[userID]))
+	for i, stored := range sh.byUser[userID] {
+		refs[i] = shardRef{sh, stored}
+	}
+	sh.mu.RUnlock()
+	sh.reads.Inc()
+	return scan(refs, fn)
+}
+
+// CountByUser returns the number of notifications stored for userID
+func (s *notificationStore) CountByUser(userID string) int {
+	sh := s.shardFor(userID)
+	sh.rlock()
+	defer sh.mu.RUnlock()
+	return len(sh.byUser[userID])
+}
+
+// UserVersion identifies the current state of userID's notifications
+//
+// It changes whenever one of them is created, read or deleted, so it can
+// serve as an ETag for the user's inbox.
+func (s *notificationStore) UserVersion(userID string) string {
+	sh := s.shardFor(userID)
+	sh.rlock()
+	defer sh.mu.RUnlock()
+	return strconv.FormatInt(s.epoch, 36) + "-" + strconv.FormatUint(sh.userVersions[userID], 10)
+}
+
+// After returns userID's notifications created after the one with ID lastID
+//
+// Nothing is returned when lastID is unknown, e.g. because it was deleted.
+func (s *notificationStore) After(userID, lastID string) []Notification {
+	sh := s.shardFor(userID)
+	sh.rlock()
+	defer sh.mu.RUnlock()
+	sh.reads.Inc()
+	last, ok := sh.byID[lastID]
+	if !ok {
+		return nil
+	}
+	list := sh.byUser[userID]
+	i := sort.Search(len(list), func(i int) bool { return list[i].seq > last.seq })
+	return copyNotifications(list[i:])
+}
+
+// MarkRead marks the notification with the given ID as read at the given time
+func (s *notificationStore) MarkRead(id string, at time.Time) (Notification, bool) {
+	sh := s.locate(id)
+	if sh == nil {
+		return Notification{}, false
+	}
+	sh.lock()
+	defer sh.mu.Unlock()
+	stored, ok := sh.byID[id]
+	if !ok {
+		sh.errors.Inc()
+		return Notification{}, false
+	}
+	stored.notification.Status = "read"
+	stored.notification.ReadAt = &at
+	sh.touchLocked(stored.notification.UserID)
+	sh.writes.Inc()
+	return cloneNotification(stored.notification), true
+}
+
+// SetPinned pins or unpins the notification with the given ID
+func (s *notificationStore) SetPinned(id string, pinned bool) (Notification, bool) {
+	return s.update(id, func(notification *Notification) bool {
+		notification.Pinned = pinned
+		return true
+	})
+}
+
+// Snooze hides the notification with the given ID from the inbox until the given time
+func (s *notificationStore) Snooze(id string, until time.Time) (Notification, bool) {
+	return s.update(id, func(notification *Notification) bool {
+		notification.SnoozedUntil = &until
+		return true
+	})
+}
+
+// Wake ends the snooze of the notification with the given ID if it was snoozed until the given time
+//
+// A notification snoozed again since keeps its later snooze, and Wake reports false.
+func (s *notificationStore) Wake(id string, until time.Time) (Notification, bool) {
+	return s.update(id, func(notification *Notification) bool {
+		if notification.SnoozedUntil == nil || !notification.SnoozedUntil.Equal(until) {
+			return false
+		}
+		notification.SnoozedUntil = nil
+		return true
+	})
+}
+
+// MarkAllRead marks userID's unread notifications as read, returning the ones it changed
+//
+// Pinned notifications stay unread so they remain visible.
+func (s *notificationStore) MarkAllRead(userID string, at time.Time) []Notification {
+	sh := s.shardFor(userID)
+	sh.lock()
+	defer sh.mu.Unlock()
+	var marked []Notification
+	for _, stored := range sh.byUser[userID] {
+		if stored.notification.Pinned || stored.notification.Status == "read" {
+			continue
+		}
+		stored.notification.Status = "read"
+		stored.notification.ReadAt = &at
+		marked = append(marked, cloneNotification(stored.notification))
+	}
+	if len(marked) > 0 {
+		sh.touchLocked(userID)
+		sh.writes.Inc()
+	}
+	return marked
+}
+
+// Delete removes the notification with the given ID, returning it
+func (s *notificationStore) Delete(id string) (Notification, bool) {
+	sh := s.locate(id)
+	if sh == nil {
+		return Notification{}, false
+	}
+	sh.lock()
+	defer sh.mu.Unlock()
+	stored, ok := sh.byID[id]
+	if !ok {
+		sh.errors.Inc()
+		return Notification{}, false
+	}
+	sh.removeLocked(id)
+	sh.writes.Inc()
+	return stored.notification, true
+}
+
+// Purge removes the notifications created before cutoff, except pinned ones, returning how many it removed
+func (s *notificationStore) Purge(cutoff time.Time) int {
+	purged := 0
+	for _, sh := range s.shards {
+		sh.lock()
+		var expired []string
+		for id, stored := range sh.byID {
+			if !stored.notification.Pinned && stored.notification.CreatedAt.Before(cutoff) {
+				expired = append(expired, id)
+			}
+		}
+		for _, id := range expired {
+			sh.removeLocked(id)
+		}
+		if len(expired) > 0 {
+			sh.writes.Inc()
+		}
+		sh.mu.Unlock()
+		purged += len(expired)
+	}
+	return purged
+}
+
+// Len returns the number of stored notifications
+func (s *notificationStore) Len() int {
+	total := 0
+	for _, sh := range s.shards {
+		sh.rlock()
+		total += len(sh.byID)
+		sh.mu.RUnlock()
+	}
+	return total
+}
+
+// shardStats is the size of one shard, for metrics
+type shardStats struct {
+	Name          string
+	Notifications int
+	Users         int
+}
+
+// ShardStats returns the size of every shard in configuration order
+func (s *notificationStore) ShardStats() []shardStats {
+	stats := make([]shardStats, len(s.shards))
+	for i, sh := range s.shards {
+		sh.rlock()
+		stats[i] = shardStats{Name: sh.name, Notifications: len(sh.byID), Users: len(sh.byUser)}
+		sh.mu.RUnlock()
+	}
+	return stats
+}
+
+// locate finds the shard holding the notification with the given ID, nil if none does
+//
+// The notification may be gone by the time the caller takes the shard's
+// write lock, so callers look it up again.
+func (s *notificationStore) locate(id string) *storeShard {
+	for _, sh := range s.shards {
+		sh.rlock()
+		_, ok := sh.byID[id]
+		sh.mu.RUnlock()
+		if ok {
+			return sh
+		}
+	}
+	return nil
+}
+
+// update applies change to the notification with the given ID, reporting whether it changed it
+func (s *notificationStore) update(id string, change func(*Notification) bool) (Notification, bool) {
+	sh := s.locate(id)
+	if sh == nil {
+		return Notification{}, false
+	}
+	sh.lock()
+	defer sh.mu.Unlock()
+	stored, ok := sh.byID[id]
+	if !ok {
+		sh.errors.Inc()
+		return Notification{}, false
+	}
+	if !change(&stored.notification) {
+		return Notification{}, false
+	}
+	sh.touchLocked(stored.notification.UserID)
+	sh.writes.Inc()
+	return cloneNotification(stored.notification), true
+}
+
+func (sh *storeShard) addLocked(notification Notification, seq uint64) {
+	if _, ok := sh.byID[notification.ID]; ok {
+		sh.removeLocked(notification.ID)
+	}
+	stored := &storedNotification{seq: seq, notification: cloneNotification(notification)}
+	sh.byID[notification.ID] = stored
+	sh.byUser[notification.UserID] = append(sh.byUser[notification.UserID], stored)
+	sh.touchLocked(notification.UserID)
+}
+
+func (sh *storeShard) removeLocked(id string) {
+	stored := sh.byID[id]
+	delete(sh.byID, id)
+
+	userID := stored.notification.UserID
+	sh.touchLocked(userID)
+	list := sh.byUser[userID]
+	for i, candidate := range list {
+		if candidate == stored {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		// The version stays, so an emptied inbox never repeats an earlier ETag
+		delete(sh.byUser, userID)
+		return
+	}
+	sh.byUser[userID] = list
+}
+
+// lock takes the shard's write lock, recording how long it waited
+func (sh *storeShard) lock() {
+	start := time.Now()
+	sh.mu.Lock()
+	sh.writeWait.Observe(time.Since(start).Seconds())
+}
+
+// rlock takes the shard's read lock, recording how long it waited
+func (sh *storeShard) rlock() {
+	start := time.Now()
+	sh.mu.RLock()
+	sh.readWait.Observe(time.Since(start).Seconds())
+}
+
+func (sh *storeShard) touchLocked(userID string) {
+	sh.mutations++
+	sh.userVersions[userID] = sh.mutations
+}
+
+// scanChunk is how many notifications Scan copies per lock acquisition
+const scanChunk = 256
+
+func scan(refs []shardRef, fn func(Notification) error) error {
+	chunk := make([]Notification, 0, scanChunk)
+	for start := 0; start < len(refs); start += scanChunk {
+		chunk = chunk[:0]
+		end := min(start+scanChunk, len(refs))
+		// Consecutive refs on the same shard share one lock acquisition
+		for i := start; i < end; {
+			sh := refs[i].shard
+			sh.rlock()
+			for ; i < end && refs[i].shard == sh; i++ {
+				if stored := refs[i].stored; sh.byID[stored.notification.ID] == stored {
+					chunk = append(chunk, cloneNotification(stored.notification))
+				}
+			}
+			sh.mu.RUnlock()
+		}
+
+		for _, notification := range chunk {
+			if err := fn(notification); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func copyNotifications(list []*storedNotification) []Notification {
+	if len(list) == 0 {
+		return nil
+	}
+	copied := make([]Notification, len(list))
+	for i, stored := range list {
+		copied[i] = cloneNotification(stored.notification)
+	}
+	return copied
+}
+
+// cloneNotification copies notification along with its tags, actions and data
+func cloneNotification(notification Notification) Notification {
+	notification.Tags = slices.Clone(notification.Tags)
+	notification.Actions = slices.Clone(notification.Actions)
+	if notification.Data != nil {
+		notification.Data = cloneValue(notification.Data).(map[string]any)
+	}
+	return notification
+}
+
+// cloneValue deep-copies the maps and slices of decoded JSON
+func cloneValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(value))
+		for k, v := range value {
+			copied[k] = cloneValue(v)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(value))
+		for i, v := range value {
+			copied[i] = cloneValue(v)
+		}
+		return copied
+	default:
+		return value
+	}
+}
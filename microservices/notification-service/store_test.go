@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/reqctx"
+	"platform/pkg/server"
+)
+
+// The concurrency tests are only meaningful under the race detector:
+//
+//	go test -race ./...
+
+func testNotification(id, userID string) Notification {
+	return Notification{ID: id, UserID: userID, Type: "info", Title: "Test", Message: "Test", Status: "unread", CreatedAt: time.Now()}
+}
+
+func ids(list []Notification) string {
+	parts := make([]string, len(list))
+	for i, n := range list {
+		parts[i] = n.ID
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestStoreIndexes(t *testing.T) {
+	s := newNotificationStore(testNotification("a1", "alice"), testNotification("b1", "bob"))
+	s.Add(testNotification("a2", "alice"))
+	s.Add(testNotification("a3", "alice"))
+
+	if got := ids(s.List()); got != "a1,b1,a2,a3" {
+		t.Errorf("List = %s, want creation order", got)
+	}
+	if got := ids(s.ListByUser("alice")); got != "a1,a2,a3" {
+		t.Errorf("ListByUser(alice) = %s", got)
+	}
+	if got := s.ListByUser("carol"); got != nil {
+		t.Errorf("ListByUser(carol) = %v, want nil", got)
+	}
+	if got := ids(s.After("alice", "a1")); got != "a2,a3" {
+		t.Errorf("After(alice, a1) = %s", got)
+	}
+	if got := s.After("alice", "unknown"); got != nil {
+		t.Errorf("After(alice, unknown) = %v, want nil", got)
+	}
+
+	at := time.Now()
+	read, ok := s.MarkRead("a2", at)
+	if !ok || read.Status != "read" || !read.ReadAt.Equal(at) {
+		t.Errorf("MarkRead = %+v, %v", read, ok)
+	}
+	if got, _ := s.Get("a2"); got.Status != "read" {
+		t.Errorf("Get after MarkRead has status %q", got.Status)
+	}
+
+	if _, ok := s.Delete("a2"); !ok {
+		t.Fatal("Delete(a2) found nothing")
+	}
+	if _, ok := s.Get("a2"); ok {
+		t.Error("a2 still stored after Delete")
+	}
+	if got := ids(s.ListByUser("alice")); got != "a1,a3" {
+		t.Errorf("ListByUser(alice) after Delete = %s", got)
+	}
+	s.Delete("b1")
+	if _, ok := s.shardFor("bob").byUser["bob"]; ok {
+		t.Error("empty user index kept after deleting bob's last notification")
+	}
+	if s.Len() != 2 {
+		t.Errorf("Len = %d, want 2", s.Len())
+	}
+}
+
+func TestStoreReturnsCopies(t *testing.T) {
+	n := testNotification("a1", "alice")
+	n.Tags = []string{"billing"}
+	n.Actions = []NotificationAction{{ID: "pay", Label: "Pay"}}
+	n.Data = map[string]any{"order": map[string]any{"id": "o1"}, "items": []any{"sku-1"}}
+	s := newNotificationStore(n)
+	// The caller's values are copied on the way in
+	n.Tags[0] = "tampered"
+	n.Data["order"].(map[string]any)["id"] = "tampered"
+
+	list := s.ListByUser("alice")
+	list[0].Status = "tampered"
+	list[0].Actions[0].Label = "tampered"
+	list[0].Data["items"].([]any)[0] = "tampered"
+	got, _ := s.Get("a1")
+	if got.Status != "unread" || got.Tags[0] != "billing" || got.Actions[0].Label != "Pay" ||
+		got.Data["order"].(map[string]any)["id"] != "o1" || got.Data["items"].([]any)[0] != "sku-1" {
+		t.Errorf("mutation leaked into the store: %+v", got)
+	}
+}
+
+func TestStoreUserVersionsNeverRepeat(t *testing.T) {
+	s := newNotificationStore()
+	seen := map[string]bool{s.UserVersion("alice"): true}
+	for _, change := range []func(){
+		func() { s.Add(testNotification("a1", "alice")) },
+		func() { s.Delete("a1") },
+		func() { s.Add(testNotification("a2", "alice")) },
+		func() { s.Delete("a2") },
+	} {
+		change()
+		version := s.UserVersion("alice")
+		if seen[version] {
+			t.Fatalf("version %s repeated after the inbox changed", version)
+		}
+		seen[version] = true
+	}
+}
+
+func TestStoreConcurrentCreateReadDelete(t *testing.T) {
+	t.Run("single shard", func(t *testing.T) { testConcurrentCreateReadDelete(t, newNotificationStore()) })
+	t.Run("sharded", func(t *testing.T) {
+		testConcurrentCreateReadDelete(t, newShardedStore(StorageConfig{Shards: []string{"a", "b", "c"}, VirtualNodes: 16}))
+	})
+}
+
+func testConcurrentCreateReadDelete(t *testing.T, s *notificationStore) {
+	const (
+		writers = 8
+		perUser = 200
+		users   = 4
+	)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perUser; i++ {
+				id := strconv.Itoa(w) + "-" + strconv.Itoa(i)
+				s.Add(testNotification(id, "user-"+strconv.Itoa(w%users)))
+				if i%2 == 1 {
+					// Delete every other notification, and mark the survivors read
+					s.Delete(id)
+					s.MarkRead(strconv.Itoa(w)+"-"+strconv.Itoa(i-1), time.Now())
+				}
+			}
+		}(w)
+	}
+
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func(r int) {
+			defer readers.Done()
+			userID := "user-" + strconv.Itoa(r%users)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s.List()
+				list := s.ListByUser(userID)
+				if len(list) > 0 {
+					s.After(userID, list[0].ID)
+					s.Get(list[len(list)-1].ID)
+				}
+				s.Len()
+			}
+		}(r)
+	}
+
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	want := writers * perUser / 2
+	if s.Len() != want {
+		t.Fatalf("Len = %d, want %d", s.Len(), want)
+	}
+	total := 0
+	for u := 0; u < users; u++ {
+		for _, n := range s.ListByUser("user-" + strconv.Itoa(u)) {
+			if n.Status != "read" {
+				t.Errorf("%s was not marked read", n.ID)
+			}
+			if _, ok := s.Get(n.ID); !ok {
+				t.Errorf("%s is in the user index but not the ID index", n.ID)
+			}
+			total++
+		}
+	}
+	if total != want {
+		t.Errorf("user indexes hold %d notifications, want %d", total, want)
+	}
+}
+
+func TestAPIConcurrentRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newNotificationStore()
+	r := server.NewEngine(server.Options{})
+	registerAPIRoutes(r.Group("/api"), context.Background(), testService(store, newBroadcastStore(), systemClock{}), newTemplateStore(), defaultConfig().Responses.StreamThreshold)
+
+	serve := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	const clients, perClient = 8, 50
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			userID := "user-" + strconv.Itoa(c)
+			body := `{"user_id":"` + userID + `","type":"info","title":"Test","message":"Test"}`
+			for i := 0; i < perClient; i++ {
+				if code := serve(http.MethodPost, "/api/notifications", body); code != http.StatusCreated {
+					t.Errorf("create returned %d", code)
+					return
+				}
+				serve(http.MethodGet, "/api/notifications", "")
+				serve(http.MethodGet, "/api/users/"+userID+"/notifications", "")
+				for _, n := range store.ListByUser(userID) {
+					serve(http.MethodPatch, "/api/notifications/"+n.ID+"/read", "")
+				}
+			}
+			for _, n := range store.ListByUser(userID)[:perClient/2] {
+				if code := serve(http.MethodDelete, "/api/notifications/"+n.ID, ""); code != http.StatusOK {
+					t.Errorf("delete returned %d", code)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if want := clients * perClient / 2; store.Len() != want {
+		t.Errorf("Len = %d, want %d", store.Len(), want)
+	}
+}
+
+func TestShardedStore(t *testing.T) {
+	s := newShardedStore(StorageConfig{Shards: []string{"a", "b", "c", "d"}, VirtualNodes: 64})
+	var want []string
+	for i := 0; i < 40; i++ {
+		id := "n" + strconv.Itoa(i)
+		want = append(want, id)
+		s.Add(testNotification(id, "user-"+strconv.Itoa(i%8)))
+	}
+	s.AddBatch([]Notification{testNotification("n40", "user-0"), testNotification("n41", "user-0")})
+	want = append(want, "n40", "n41")
+
+	used := 0
+	for _, stats := range s.ShardStats() {
+		if stats.Notifications > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Fatalf("8 users landed on %d of 4 shards", used)
+	}
+
+	if got := ids(s.List()); got != strings.Join(want, ",") {
+		t.Errorf("List = %s, want creation order across shards", got)
+	}
+	var scanned []Notification
+	s.Scan(func(n Notification) error {
+		scanned = append(scanned, n)
+		return nil
+	})
+	if ids(scanned) != strings.Join(want, ",") {
+		t.Errorf("Scan = %s, want creation order across shards", ids(scanned))
+	}
+	if got := ids(s.ListByUser("user-0")); got != "n0,n8,n16,n24,n32,n40,n41" {
+		t.Errorf("ListByUser(user-0) = %s", got)
+	}
+
+	// ID lookups find notifications whichever shard holds them
+	for _, id := range want {
+		if _, ok := s.Get(id); !ok {
+			t.Fatalf("Get(%s) found nothing", id)
+		}
+	}
+	if _, ok := s.MarkRead("n13", time.Now()); !ok {
+		t.Error("MarkRead(n13) found nothing")
+	}
+	if _, ok := s.Delete("n14"); !ok {
+		t.Error("Delete(n14) found nothing")
+	}
+	if _, ok := s.MarkRead("missing", time.Now()); ok {
+		t.Error("MarkRead(missing) found something")
+	}
+	if s.Len() != len(want)-1 {
+		t.Errorf("Len = %d, want %d", s.Len(), len(want)-1)
+	}
+}
+
+func TestRequireOwner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newNotificationStore(testNotification("n1", "alice"))
+	r := server.NewEngine(server.Options{})
+	api := r.Group("/api", requireOwner(store))
+	registerAPIRoutes(api, context.Background(), testService(store, newBroadcastStore(), systemClock{}), newTemplateStore(), defaultConfig().Responses.StreamThreshold)
+	registerWebhookRoutes(api, WebhookConfig{}, newDeliveryRecords(), newSuppressionList())
+
+	serve := func(method, path, caller string, admin bool) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"for":"1h"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if caller != "" {
+			req.Header.Set(reqctx.UserIDHeader, caller)
+		}
+		if admin {
+			req.Header.Set(reqctx.AdminHeader, "true")
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Every route of a single notification is closed to other users
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/api/notifications/n1"},
+		{http.MethodPatch, "/api/notifications/n1/read"},
+		{http.MethodPatch, "/api/notifications/n1/pin"},
+		{http.MethodPatch, "/api/notifications/n1/unpin"},
+		{http.MethodPost, "/api/notifications/n1/snooze"},
+		{http.MethodPost, "/api/notifications/n1/actions/open/click"},
+		{http.MethodGet, "/api/notifications/n1/clicks"},
+		{http.MethodGet, "/api/notifications/n1/deliveries"},
+		{http.MethodDelete, "/api/notifications/n1"},
+	} {
+		if code := serve(route.method, route.path, "bob", false); code != http.StatusForbidden {
+			t.Errorf("%s %s by another user = %d, want 403", route.method, route.path, code)
+		}
+		if code := serve(route.method, route.path, "", false); code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a caller = %d, want 401", route.method, route.path, code)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		caller string
+		admin  bool
+		want   int
+	}{
+		{"owner", "/api/notifications/n1", "alice", false, http.StatusOK},
+		{"admin", "/api/notifications/n1", "ops", true, http.StatusOK},
+		{"unknown", "/api/notifications/n2", "bob", false, http.StatusNotFound},
+	} {
+		if code := serve(http.MethodGet, tc.path, tc.caller, tc.admin); code != tc.want {
+			t.Errorf("%s: GET %s = %d, want %d", tc.name, tc.path, code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/reqctx"
+)
+
+// streamSubscribers tracks open notification streams
+var streamSubscribers = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "notification_stream_subscribers",
+		Help: "Number of open notification streams",
+	},
+)
+
+// streamBuffer is how many notifications a slow stream may fall behind by
+// before it is closed; the client then reconnects and replays from Last-Event-ID
+const streamBuffer = 32
+
+// streamHeartbeat keeps idle streams from being closed by proxies
+const streamHeartbeat = 15 * time.Second
+
+// notificationHub fans newly created notifications out to open streams
+type notificationHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan Notification]struct{}
+}
+
+func newNotificationHub() *notificationHub {
+	return &notificationHub{subs: make(map[string]map[chan Notification]struct{})}
+}
+
+// Subscribe returns a channel receiving userID's new notifications
+//
+// The channel is closed when the subscriber falls behind or cancel is called.
+func (h *notificationHub) Subscribe(userID string) (<-chan Notification, func()) {
+	ch := make(chan Notification, streamBuffer)
+
+	h.mu.Lock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan Notification]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	h.mu.Unlock()
+	streamSubscribers.Inc()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.removeLocked(userID, ch)
+	}
+}
+
+// Publish hands notification to every stream open for its user
+func (h *notificationHub) Publish(notification Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[notification.UserID] {
+		select {
+		case ch <- notification:
+		default:
+			h.removeLocked(notification.UserID, ch)
+		}
+	}
+}
+
+func (h *notificationHub) removeLocked(userID string, ch chan Notification) {
+	if _, ok := h.subs[userID][ch]; !ok {
+		return
+	}
+	delete(h.subs[userID], ch)
+	if len(h.subs[userID]) == 0 {
+		delete(h.subs, userID)
+	}
+	close(ch)
+	streamSubscribers.Dec()
+}
+
+// authorizeSubscriber answers 401 or 403 and returns false unless the caller
+// the gateway verified is userID
+//
+// Only the user may follow their notifications live, and an open connection
+// counts as the user's presence, which can hold back their pushes.
+func authorizeSubscriber(c *gin.Context, userID string) bool {
+	switch caller := reqctx.UserID(c.Request.Context()); {
+	case caller == "":
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Authentication required",
+		})
+		return false
+	case caller != userID:
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "Cannot subscribe to another user's notifications",
+		})
+		return false
+	}
+	return true
+}
+
+// streamHandler streams a user's new notifications as server-sent events
+//
+// The caller must be the user. A reconnecting client sends Last-Event-ID and
+// first receives what it missed. Streams end when shutdown is cancelled so
+// they do not hold up graceful shutdown.
+func streamHandler(shutdown context.Context, hub *notificationHub, presence *presenceRegistry, store Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("user_id")
+		if !authorizeSubscriber(c, userID) {
+			return
+		}
+		updates, cancel := hub.Subscribe(userID)
+		defer cancel()
+		disconnect := presence.Connect(userID, reqctx.Tenant(c.Request.Context()), transportSSE)
+		defer disconnect()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		if lastID := c.GetHeader("Last-Event-ID"); lastID != "" {
+			for _, notification := range store.After(userID, lastID) {
+				if writeEvent(c.Writer, notification) != nil {
+					return
+				}
+			}
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case notification, ok := <-updates:
+				if !ok {
+					return
+				}
+				if writeEvent(c.Writer, notification) != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+					return
+				}
+			case <-c.Request.Context().Done():
+				return
+			case <-shutdown.Done():
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeEvent writes notification as a single server-sent event
+func writeEvent(w io.Writer, notification Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: notification\ndata: %s\n\n", notification.ID, data)
+	return err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// What an inbox summary groups notifications by
+const (
+	summaryByCategory = "category"
+	summaryByType     = "type"
+)
+
+// summaryGroup counts the notifications of one category or type
+type summaryGroup struct {
+	Key    string `json:"key"`
+	Count  int    `json:"count"`
+	Unread int    `json:"unread"`
+	// ByStatus counts the group's notifications by status, e.g. unread, read or sent
+	ByStatus map[string]int `json:"by_status"`
+	Latest   Notification   `json:"latest"`
+}
+
+// inboxSummary is an overview of a user's inbox, for rendering without listing it
+type inboxSummary struct {
+	By     string `json:"by"`
+	Count  int    `json:"count"`
+	Unread int    `json:"unread"`
+	// Groups are ordered by their latest notification, newest first
+	Groups []*summaryGroup `json:"groups"`
+
+	groups map[string]*summaryGroup
+}
+
+func newInboxSummary(by string) *inboxSummary {
+	return &inboxSummary{By: by, Groups: []*summaryGroup{}, groups: make(map[string]*summaryGroup)}
+}
+
+// add counts notification in its group
+func (s *inboxSummary) add(notification Notification) {
+	key := notification.Category
+	if s.By == summaryByType {
+		key = notification.Type
+	}
+	group, ok := s.groups[key]
+	if !ok {
+		group = &summaryGroup{Key: key, ByStatus: make(map[string]int)}
+		s.groups[key] = group
+		s.Groups = append(s.Groups, group)
+	}
+	s.Count++
+	group.Count++
+	group.ByStatus[notification.Status]++
+	if notification.Status != "read" {
+		s.Unread++
+		group.Unread++
+	}
+	// Notifications are added in creation order, so the last one is the latest
+	group.Latest = notification
+}
+
+// sorted returns the summary with its groups in order
+func (s *inboxSummary) sorted() inboxSummary {
+	sort.SliceStable(s.Groups, func(i, j int) bool { return s.Groups[i].Latest.CreatedAt.After(s.Groups[j].Latest.CreatedAt) })
+	return *s
+}
+
+// summaryHandler summarises a user's inbox by category, or by type with ?by=type
+//
+// Like the inbox it revalidates with If-None-Match, and it takes the same
+// category and tag filters. Snoozed notifications are left out.
+func summaryHandler(service *notificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("user_id")
+		by := c.DefaultQuery("by", summaryByCategory)
+		if by != summaryByCategory && by != summaryByType {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "by must be category or type",
+			})
+			return
+		}
+		filter, ok := bindFilter(c)
+		if !ok {
+			return
+		}
+
+		etag := `W/"` + service.InboxVersion(userID) + `"`
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    service.Summary(c.Request.Context(), userID, filter, by),
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInboxSummary(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	var list []Notification
+	for i, n := range []struct{ id, category, kind string }{
+		{"s1", categorySecurity, "sign_in"},
+		{"o1", categorySystem, "order_status"},
+		{"s2", categorySecurity, "password_changed"},
+		{"o2", categorySystem, "order_status"},
+	} {
+		notification := testNotification(n.id, "alice")
+		notification.Category, notification.Type = n.category, n.kind
+		notification.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		list = append(list, notification)
+	}
+	store := newNotificationStore(list...)
+	store.MarkRead("s1", time.Now())
+	r := listingRouter(t, store, 1000)
+
+	var resp struct {
+		Data inboxSummary `json:"data"`
+	}
+	rec := getListing(r, "/api/users/alice/notifications/summary", "")
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	summary := resp.Data
+	if rec.Code != http.StatusOK || summary.Count != 4 || summary.Unread != 3 || len(summary.Groups) != 2 {
+		t.Fatalf("summary returned %d: %s", rec.Code, rec.Body)
+	}
+	// The group with the newest notification comes first
+	system, security := summary.Groups[0], summary.Groups[1]
+	if system.Key != categorySystem || system.Count != 2 || system.Latest.ID != "o2" {
+		t.Errorf("system group = %+v, want 2 notifications, latest o2", system)
+	}
+	if security.Key != categorySecurity || security.Unread != 1 || security.ByStatus["read"] != 1 || security.Latest.ID != "s2" {
+		t.Errorf("security group = %+v, want s1 read and s2 latest", security)
+	}
+
+	json.Unmarshal(getListing(r, "/api/users/alice/notifications/summary?by=type", "").Body.Bytes(), &resp)
+	if len(resp.Data.Groups) != 3 || resp.Data.Groups[0].Key != "order_status" || resp.Data.Groups[0].Count != 2 {
+		t.Errorf("summary by type = %+v, want order_status first of 3", resp.Data.Groups)
+	}
+
+	// Polling clients revalidate like they do the inbox
+	req := httptest.NewRequest(http.MethodGet, "/api/users/alice/notifications/summary", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	revalidated := httptest.NewRecorder()
+	r.ServeHTTP(revalidated, req)
+	if revalidated.Code != http.StatusNotModified {
+		t.Errorf("revalidation returned %d, want 304", revalidated.Code)
+	}
+
+	if code := getListing(r, "/api/users/alice/notifications/summary?by=tag", "").Code; code != http.StatusBadRequest {
+		t.Errorf("by=tag returned %d, want 400", code)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Why an address is suppressed
+const (
+	suppressedBounce    = "bounce"
+	suppressedComplaint = "complaint"
+)
+
+var addressSuppressionsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "address_suppressions_total",
+		Help: "Total number of email addresses and phone numbers suppressed after a bounce or complaint",
+	},
+	[]string{"channel", "reason"},
+)
+
+// errAddressSuppressed means every address of the recipient is suppressed,
+// so retrying the delivery cannot succeed
+var errAddressSuppressed = errors.New("recipient addresses are suppressed")
+
+// twilioSuppressions maps the Twilio error codes that mean a number must not
+// be messaged again to why: the number does not exist or cannot receive SMS,
+// or its owner replied STOP
+var twilioSuppressions = map[string]string{
+	"21211": suppressedBounce,
+	"21614": suppressedBounce,
+	"30005": suppressedBounce,
+	"30006": suppressedBounce,
+	"21610": suppressedComplaint,
+}
+
+// suppressedAddress is an email address or phone number no longer delivered to
+type suppressedAddress struct {
+	Channel string `json:"channel"`
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+	// Detail is the provider's explanation, e.g. the bounce message
+	Detail string    `json:"detail,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// suppressionList holds the addresses that bounced or complained
+//
+// Providers penalize senders who keep mailing hard bounces and spam
+// complainers, so the email and SMS senders drop suppressed addresses
+// before handing a notification over. Entries stay until an admin clears
+// them.
+type suppressionList struct {
+	mu        sync.RWMutex
+	addresses map[string]map[string]suppressedAddress
+}
+
+func newSuppressionList() *suppressionList {
+	return &suppressionList{addresses: make(map[string]map[string]suppressedAddress)}
+}
+
+// normalizeAddress makes addresses that reach the same mailbox compare equal
+func normalizeAddress(channel, address string) string {
+	address = strings.TrimSpace(address)
+	if channel == channelEmail {
+		return strings.ToLower(address)
+	}
+	return address
+}
+
+// Add suppresses address on channel, keeping the original entry if it is already suppressed
+func (l *suppressionList) Add(entry suppressedAddress) {
+	entry.Address = normalizeAddress(entry.Channel, entry.Address)
+	if entry.Address == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	addresses, ok := l.addresses[entry.Channel]
+	if !ok {
+		addresses = make(map[string]suppressedAddress)
+		l.addresses[entry.Channel] = addresses
+	}
+	if _, ok := addresses[entry.Address]; ok {
+		return
+	}
+	addresses[entry.Address] = entry
+	addressSuppressionsTotal.WithLabelValues(entry.Channel, entry.Reason).Inc()
+}
+
+// Remove clears the suppression of address on channel, reporting whether there was one
+func (l *suppressionList) Remove(channel, address string) bool {
+	address = normalizeAddress(channel, address)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.addresses[channel][address]; !ok {
+		return false
+	}
+	delete(l.addresses[channel], address)
+	return true
+}
+
+// Suppressed reports whether address is suppressed on channel
+func (l *suppressionList) Suppressed(channel, address string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.addresses[channel][normalizeAddress(channel, address)]
+	return ok
+}
+
+// List returns the suppressed addresses on channel, or on every channel if it is empty, newest first
+func (l *suppressionList) List(channel string) []suppressedAddress {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var list []suppressedAddress
+	for ch, addresses := range l.addresses {
+		if channel != "" && ch != channel {
+			continue
+		}
+		for _, entry := range addresses {
+			list = append(list, entry)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Since.Equal(list[j].Since) {
+			return list[i].Since.After(list[j].Since)
+		}
+		return list[i].Address < list[j].Address
+	})
+	return list
+}
+
+// suppressingSender drops suppressed addresses before handing a delivery to next
+type suppressingSender struct {
+	channel string
+	list    *suppressionList
+	next    Sender
+}
+
+func (s suppressingSender) Send(ctx context.Context, notification Notification, to recipient) error {
+	// A nil resolver hands over no addresses at all, leaving nothing to check
+	if len(to.Addresses) == 0 {
+		return s.next.Send(ctx, notification, to)
+	}
+	addresses := make([]string, 0, len(to.Addresses))
+	for _, address := range to.Addresses {
+		if !s.list.Suppressed(s.channel, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	if len(addresses) == 0 {
+		return errAddressSuppressed
+	}
+	to.Addresses = addresses
+	return s.next.Send(ctx, notification, to)
+}
+
+// registerSuppressionRoutes adds the admin endpoints to inspect and clear suppressed addresses
+func registerSuppressionRoutes(admin *gin.RouterGroup, list *suppressionList) {
+	admin.GET("/suppressions", func(c *gin.Context) {
+		entries := list.List(c.Query("channel"))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    entries,
+			"count":   len(entries),
+		})
+	})
+
+	admin.DELETE("/suppressions/:channel/:address", func(c *gin.Context) {
+		if !list.Remove(c.Param("channel"), c.Param("address")) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Suppression not found",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticRecipients resolves every user to the same addresses
+type staticRecipients []string
+
+func (r staticRecipients) Resolve(context.Context, string, string) (recipient, error) {
+	return recipient{Addresses: r}, nil
+}
+
+func TestSuppressedAddressesAreSkipped(t *testing.T) {
+	list := newSuppressionList()
+	list.Add(suppressedAddress{Channel: channelEmail, Address: "Gone@Example.com", Reason: suppressedBounce, Since: time.Now()})
+
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, staticRecipients{"gone@example.com", "kept@example.com"})
+	sender := recordingSender{sent: make(chan recipient, 10)}
+	dispatcher.senders[channelEmail] = sender
+	dispatcher.senders[channelPush] = sender
+	dispatcher.SuppressAddresses(list)
+	dispatcher.Start(1)
+
+	dispatcher.Enqueue(Notification{ID: "1", UserID: "user-1", Type: "promo"}, []string{channelEmail, channelPush})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := dispatcher.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	close(sender.sent)
+	var sent [][]string
+	for to := range sender.sent {
+		sent = append(sent, to.Addresses)
+	}
+	// The bounced email address is dropped; push tokens are never suppressed
+	if len(sent) != 2 || len(sent[0]) != 1 || sent[0][0] != "kept@example.com" || len(sent[1]) != 2 {
+		t.Errorf("sent email then push to %v", sent)
+	}
+
+	only := suppressingSender{channel: channelEmail, list: list, next: sender}
+	if err := only.Send(ctx, Notification{}, recipient{Addresses: []string{"GONE@example.com "}}); err != errAddressSuppressed {
+		t.Errorf("send to a suppressed address returned %v", err)
+	}
+}
+
+func TestSuppressionAdmin(t *testing.T) {
+	list := newSuppressionList()
+	list.Add(suppressedAddress{Channel: channelEmail, Address: "gone@example.com", Reason: suppressedBounce, Since: time.Now().Add(-time.Hour)})
+	list.Add(suppressedAddress{Channel: channelSMS, Address: "+15550100", Reason: suppressedComplaint, Since: time.Now()})
+	list.Add(suppressedAddress{Channel: channelEmail, Address: "GONE@example.com", Reason: suppressedComplaint, Since: time.Now()})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerSuppressionRoutes(r.Group("/api/admin"), list)
+	do := func(method, path string) (int, []suppressedAddress) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		var resp struct {
+			Data []suppressedAddress `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Data
+	}
+
+	if _, all := do(http.MethodGet, "/api/admin/suppressions"); len(all) != 2 || all[0].Channel != channelSMS {
+		t.Errorf("suppressions = %+v, want the SMS one first", all)
+	}
+	if _, email := do(http.MethodGet, "/api/admin/suppressions?channel=email"); len(email) != 1 || email[0].Reason != suppressedBounce {
+		t.Errorf("email suppressions = %+v, want the first bounce kept", email)
+	}
+	if code, _ := do(http.MethodDelete, "/api/admin/suppressions/email/Gone@example.com"); code != http.StatusOK || list.Suppressed(channelEmail, "gone@example.com") {
+		t.Errorf("clearing a suppression returned %d", code)
+	}
+	if code, _ := do(http.MethodDelete, "/api/admin/suppressions/email/gone@example.com"); code != http.StatusNotFound {
+		t.Errorf("clearing it again returned %d, want 404", code)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// NotificationTemplate custom resource, see k8s/base/notificationtemplate-crd.yaml
+const (
+	templateAPIVersion   = "notifications.platform.io/v1alpha1"
+	templateSourcePrefix = "NotificationTemplate/"
+)
+
+// templateResource mirrors the NotificationTemplate custom resource
+type templateResource struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   objectMeta     `json:"metadata"`
+	Spec       templateSpec   `json:"spec"`
+	Status     resourceStatus `json:"status,omitempty"`
+}
+
+type templateSpec struct {
+	Channel string `json:"channel,omitempty"`
+	Locale  string `json:"locale,omitempty"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	// SampleData is rendered on every change to catch templates that fail at send time
+	SampleData map[string]any `json:"sampleData,omitempty"`
+}
+
+// templateController syncs NotificationTemplate resources into the template store
+//
+// Every replica keeps its own store in sync; only the leader writes status
+// back to the resources so replicas do not fight over them.
+type templateController struct {
+	client    *kubeClient
+	namespace string
+	store     *templateStore
+	elector   *LeaderElector
+
+	synced     chan struct{}
+	syncedOnce sync.Once
+}
+
+// startTemplateController watches NotificationTemplate resources until ctx is cancelled
+//
+// The returned channel is closed once the templates have been loaded.
+func startTemplateController(ctx context.Context, cfg TemplateConfig, store *templateStore, elector *LeaderElector) <-chan struct{} {
+	synced := make(chan struct{})
+	if !cfg.ControllerEnabled {
+		close(synced)
+		return synced
+	}
+
+	client, err := newInClusterKubeClient()
+	if err != nil {
+		slog.Warn("template controller disabled", "error", err)
+		close(synced)
+		return synced
+	}
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = client.namespace
+	}
+
+	c := &templateController{client: client, namespace: namespace, store: store, elector: elector, synced: synced}
+	go c.run(ctx)
+	return synced
+}
+
+func (c *templateController) path(name string) string {
+	path := fmt.Sprintf("/apis/%s/namespaces/%s/notificationtemplates", templateAPIVersion, c.namespace)
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// run syncs the templates, relisting whenever the watch ends
+func (c *templateController) run(ctx context.Context) {
+	syncResources(ctx, c.client, c.path(""), "notification template", resourceHandler[templateResource]{
+		listed:  c.listed,
+		changed: c.apply,
+		deleted: func(resource templateResource) {
+			c.store.Delete(resource.Metadata.Name)
+			slog.Info("notification template removed", "template", resource.Metadata.Name)
+		},
+	})
+}
+
+// listed replaces the templates with the valid ones of a fresh list
+func (c *templateController) listed(ctx context.Context, resources []templateResource) {
+	valid := make([]NotificationTemplate, 0, len(resources))
+	for _, resource := range resources {
+		t, err := validateTemplate(resource)
+		if err == nil {
+			valid = append(valid, t)
+		}
+		c.reportStatus(ctx, resource, err)
+	}
+	c.store.Replace(templateSourcePrefix, valid)
+	c.syncedOnce.Do(func() { close(c.synced) })
+
+	slog.Info("notification templates synced", "count", len(valid), "invalid", len(resources)-len(valid))
+}
+
+// apply stores a changed template, keeping the last good version if it is invalid
+func (c *templateController) apply(ctx context.Context, resource templateResource) {
+	t, err := validateTemplate(resource)
+	if err == nil {
+		err = c.store.Put(t)
+	}
+	if err != nil {
+		slog.Warn("rejected invalid notification template", "template", resource.Metadata.Name, "error", err)
+	} else {
+		slog.Info("notification template updated", "template", resource.Metadata.Name,
+			"generation", resource.Metadata.Generation)
+	}
+	c.reportStatus(ctx, resource, err)
+}
+
+// validateTemplate compiles the resource and renders it against its sample data
+func validateTemplate(resource templateResource) (NotificationTemplate, error) {
+	t := NotificationTemplate{
+		Name:    resource.Metadata.Name,
+		Channel: resource.Spec.Channel,
+		Locale:  resource.Spec.Locale,
+		Subject: resource.Spec.Subject,
+		Body:    resource.Spec.Body,
+		Source:  templateSourcePrefix + resource.Metadata.Namespace + "/" + resource.Metadata.Name,
+	}
+	if err := t.compile(); err != nil {
+		return t, err
+	}
+	if resource.Spec.SampleData != nil {
+		if _, _, err := t.Render(resource.Spec.SampleData); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// reportStatus sets the Ready condition on the resource when this replica is the leader
+func (c *templateController) reportStatus(ctx context.Context, resource templateResource, syncErr error) {
+	if !c.elector.IsLeader() {
+		return
+	}
+
+	status, changed := readyStatus(resource.Status, resource.Metadata.Generation, syncErr, "InvalidTemplate", "Template loaded")
+	if !changed {
+		return
+	}
+	resource.Status = status
+
+	// A conflict means a newer version is on its way through the watch
+	err := c.client.do(ctx, http.MethodPut, c.path(resource.Metadata.Name)+"/status", resource, nil)
+	if err != nil && !isKubeStatus(err, http.StatusConflict) {
+		slog.Warn("failed to update notification template status", "template", resource.Metadata.Name, "error", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	// errTemplateNotFound is returned when rendering an unknown template
+	errTemplateNotFound = errors.New("template not found")
+	// errTemplateVersionNotFound is returned for a version a template never had
+	errTemplateVersionNotFound = errors.New("template version not found")
+)
+
+// NotificationTemplate renders the title and message of a notification
+type NotificationTemplate struct {
+	Name    string `json:"name"`
+	Channel string `json:"channel,omitempty"`
+	Locale  string `json:"locale,omitempty"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	// Source records where the template came from, e.g. the CR it was synced from
+	Source string `json:"source"`
+	// Version numbers the edits of the template from 1; the store keeps each one
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// RolledBackFrom is the earlier version this one restores, when a rollback made it
+	RolledBackFrom int `json:"rolled_back_from,omitempty"`
+
+	subject *template.Template
+	body    *template.Template
+}
+
+// compile parses the subject and body; missing data keys are rendering errors
+func (t *NotificationTemplate) compile() error {
+	var err error
+	if t.subject, err = template.New(t.Name + ".subject").Option("missingkey=error").Parse(t.Subject); err != nil {
+		return fmt.Errorf("subject: %w", err)
+	}
+	if t.body, err = template.New(t.Name + ".body").Option("missingkey=error").Parse(t.Body); err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+	return nil
+}
+
+// sameContent reports whether t renders like other and came from the same place
+func (t *NotificationTemplate) sameContent(other *NotificationTemplate) bool {
+	return t.Channel == other.Channel && t.Locale == other.Locale &&
+		t.Subject == other.Subject && t.Body == other.Body && t.Source == other.Source
+}
+
+// Render executes the template against data, returning the title and message
+func (t *NotificationTemplate) Render(data map[string]any) (string, string, error) {
+	var title, message bytes.Buffer
+	if err := t.subject.Execute(&title, data); err != nil {
+		return "", "", fmt.Errorf("subject: %w", err)
+	}
+	if err := t.body.Execute(&message, data); err != nil {
+		return "", "", fmt.Errorf("body: %w", err)
+	}
+	return strings.TrimSpace(title.String()), strings.TrimSpace(message.String()), nil
+}
+
+// templateStore holds the compiled templates available to this replica
+//
+// Every edit of a template is kept as an immutable version, so the version a
+// notification was rendered with can be looked up and a bad edit rolled back.
+// Deleting a template keeps its versions.
+type templateStore struct {
+	mu        sync.RWMutex
+	templates map[string]*NotificationTemplate
+	// versions holds each template's versions, oldest first
+	versions map[string][]*NotificationTemplate
+}
+
+func newTemplateStore() *templateStore {
+	return &templateStore{
+		templates: make(map[string]*NotificationTemplate),
+		versions:  make(map[string][]*NotificationTemplate),
+	}
+}
+
+// Put compiles and stores t as the next version of the template with its name
+func (s *templateStore) Put(t NotificationTemplate) error {
+	if err := t.compile(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(&t)
+	return nil
+}
+
+// add makes t the current template, as a new version unless it is what was last put
+//
+// Putting the same content again, as a relist does, keeps the current
+// version, so a rollback holds until the template's source is edited.
+func (s *templateStore) add(t *NotificationTemplate) {
+	versions := s.versions[t.Name]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].RolledBackFrom != 0 {
+			continue
+		}
+		if versions[i].sameContent(t) {
+			if _, ok := s.templates[t.Name]; !ok {
+				s.templates[t.Name] = versions[len(versions)-1]
+			}
+			return
+		}
+		break
+	}
+	t.Version = len(versions) + 1
+	t.CreatedAt = time.Now()
+	t.RolledBackFrom = 0
+	s.versions[t.Name] = append(versions, t)
+	s.templates[t.Name] = t
+}
+
+// Versions returns every version of the template called name, oldest first
+func (s *templateStore) Versions(name string) ([]*NotificationTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions, ok := s.versions[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, errTemplateNotFound)
+	}
+	return append([]*NotificationTemplate(nil), versions...), nil
+}
+
+// Version returns the given version of the template called name
+func (s *templateStore) Version(name string, version int) (*NotificationTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version(name, version)
+}
+
+func (s *templateStore) version(name string, version int) (*NotificationTemplate, error) {
+	versions, ok := s.versions[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, errTemplateNotFound)
+	}
+	if version < 1 || version > len(versions) {
+		return nil, fmt.Errorf("%s version %d: %w", name, version, errTemplateVersionNotFound)
+	}
+	return versions[version-1], nil
+}
+
+// Rollback makes the content of an earlier version current again, as a new version
+func (s *templateStore) Rollback(name string, version int) (*NotificationTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, err := s.version(name, version)
+	if err != nil {
+		return nil, err
+	}
+	restored := *previous
+	restored.Version = len(s.versions[name]) + 1
+	restored.CreatedAt = time.Now()
+	restored.RolledBackFrom = version
+	s.versions[name] = append(s.versions[name], &restored)
+	s.templates[name] = &restored
+	return &restored, nil
+}
+
+// Delete removes the template called name, keeping its versions
+func (s *templateStore) Delete(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.templates, name)
+}
+
+// Get returns the template called name
+func (s *templateStore) Get(name string) (*NotificationTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, errTemplateNotFound)
+	}
+	return t, nil
+}
+
+// List returns every template sorted by name
+func (s *templateStore) List() []*NotificationTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	templates := make([]*NotificationTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+// Replace swaps every template whose source starts with sourcePrefix for the given set, e.g. after a relist
+func (s *templateStore) Replace(sourcePrefix string, templates []NotificationTemplate) {
+	compiled := make(map[string]*NotificationTemplate, len(templates))
+	for i := range templates {
+		if templates[i].compile() == nil {
+			compiled[templates[i].Name] = &templates[i]
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, t := range s.templates {
+		if strings.HasPrefix(t.Source, sourcePrefix) {
+			delete(s.templates, name)
+		}
+	}
+	for _, t := range compiled {
+		s.add(t)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/logging"
+)
+
+// templateDiff compares two versions of a template
+type templateDiff struct {
+	Template string `json:"template"`
+	From     int    `json:"from"`
+	To       int    `json:"to"`
+	// Changed names the fields that differ: channel, locale, subject and body
+	Changed []string `json:"changed"`
+	// Subject and Body are line diffs, each line prefixed with " ", "-" or "+"
+	Subject []string `json:"subject"`
+	Body    []string `json:"body"`
+}
+
+// diffTemplates compares version from of a template with version to
+func diffTemplates(from, to *NotificationTemplate) templateDiff {
+	diff := templateDiff{
+		Template: to.Name,
+		From:     from.Version,
+		To:       to.Version,
+		Changed:  []string{},
+		Subject:  diffLines(from.Subject, to.Subject),
+		Body:     diffLines(from.Body, to.Body),
+	}
+	for _, field := range []struct {
+		name     string
+		from, to string
+	}{
+		{"channel", from.Channel, to.Channel},
+		{"locale", from.Locale, to.Locale},
+		{"subject", from.Subject, to.Subject},
+		{"body", from.Body, to.Body},
+	} {
+		if field.from != field.to {
+			diff.Changed = append(diff.Changed, field.name)
+		}
+	}
+	return diff
+}
+
+// diffLines returns the lines of a and b as a minimal diff from their longest common subsequence
+func diffLines(a, b string) []string {
+	from := strings.Split(strings.ReplaceAll(a, "\r\n", "\n"), "\n")
+	to := strings.Split(strings.ReplaceAll(b, "\r\n", "\n"), "\n")
+
+	// common[i][j] is the length of the longest common subsequence of from[i:] and to[j:]
+	common := make([][]int, len(from)+1)
+	for i := range common {
+		common[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]string, 0, max(len(from), len(to)))
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			lines = append(lines, " "+from[i])
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			lines = append(lines, "-"+from[i])
+			i++
+		default:
+			lines = append(lines, "+"+to[j])
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		lines = append(lines, "-"+from[i])
+	}
+	for ; j < len(to); j++ {
+		lines = append(lines, "+"+to[j])
+	}
+	return lines
+}
+
+// respondTemplateError answers a lookup of a template or one of its versions that failed
+func respondTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Template not found",
+		})
+	case errors.Is(err, errTemplateVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Template version not found",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// registerTemplateVersionRoutes adds the admin endpoints listing, comparing and rolling back template versions
+func registerTemplateVersionRoutes(admin *gin.RouterGroup, templates *templateStore) {
+	// Every version of a template, oldest first
+	admin.GET("/templates/:name/versions", func(c *gin.Context) {
+		versions, err := templates.Versions(c.Param("name"))
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    versions,
+			"count":   len(versions),
+		})
+	})
+
+	// One version, e.g. the one a notification's template_version names
+	admin.GET("/templates/:name/versions/:version", func(c *gin.Context) {
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid version",
+			})
+			return
+		}
+		t, err := templates.Version(c.Param("name"), version)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    t,
+		})
+	})
+
+	// Compare two versions; to defaults to the latest and from to the one before it
+	admin.GET("/templates/:name/diff", func(c *gin.Context) {
+		name := c.Param("name")
+		versions, err := templates.Versions(name)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		to, toErr := strconv.Atoi(c.DefaultQuery("to", strconv.Itoa(len(versions))))
+		from, fromErr := strconv.Atoi(c.DefaultQuery("from", strconv.Itoa(max(to-1, 1))))
+		if toErr != nil || fromErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "from and to must be version numbers",
+			})
+			return
+		}
+		fromVersion, err := templates.Version(name, from)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		toVersion, err := templates.Version(name, to)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    diffTemplates(fromVersion, toVersion),
+		})
+	})
+
+	// Restore an earlier version as a new one; it holds until the template's source is edited again
+	admin.POST("/templates/:name/rollback", func(c *gin.Context) {
+		var req struct {
+			Version int `json:"version" binding:"required,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		t, err := templates.Rollback(c.Param("name"), req.Version)
+		if err != nil {
+			respondTemplateError(c, err)
+			return
+		}
+		logging.FromContext(c.Request.Context()).Info("notification template rolled back",
+			"template", t.Name, "version", t.Version, "restored", req.Version)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    t,
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTemplateVersions(t *testing.T) {
+	templates := newTemplateStore()
+	source := templateSourcePrefix + "default/welcome"
+	put := func(body string) {
+		t.Helper()
+		if err := templates.Put(NotificationTemplate{Name: "welcome", Subject: "Welcome", Body: body, Source: source}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("Hi {{.name}},\nthanks for joining.")
+	put("Hi {{.name}},\nthanks for joining.")
+	put("Hi {{.name}},\nthanks for joining {{.product}}.")
+	if current, _ := templates.Get("welcome"); current.Version != 2 {
+		t.Fatalf("version after an edit and an unchanged put = %d, want 2", current.Version)
+	}
+
+	r := gin.New()
+	registerTemplateVersionRoutes(r.Group("/api/admin"), templates)
+	do := func(method, path, body string) (*httptest.ResponseRecorder, json.RawMessage) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp.Data
+	}
+
+	rec, data := do(http.MethodGet, "/api/admin/templates/welcome/diff", "")
+	var diff templateDiff
+	json.Unmarshal(data, &diff)
+	if rec.Code != http.StatusOK || diff.From != 1 || diff.To != 2 || !slices.Equal(diff.Changed, []string{"body"}) {
+		t.Fatalf("diff returned %d: %s", rec.Code, rec.Body)
+	}
+	want := []string{" Hi {{.name}},", "-thanks for joining.", "+thanks for joining {{.product}}."}
+	if !slices.Equal(diff.Body, want) {
+		t.Errorf("body diff = %q, want %q", diff.Body, want)
+	}
+
+	// Rolling back restores version 1 as version 3, and renders with it
+	rec, data = do(http.MethodPost, "/api/admin/templates/welcome/rollback", `{"version":1}`)
+	var restored NotificationTemplate
+	json.Unmarshal(data, &restored)
+	if rec.Code != http.StatusOK || restored.Version != 3 || restored.RolledBackFrom != 1 {
+		t.Fatalf("rollback returned %d: %s", rec.Code, rec.Body)
+	}
+	current, _ := templates.Get("welcome")
+	if _, message, err := current.Render(map[string]any{"name": "Ada"}); err != nil || message != "Hi Ada,\nthanks for joining." {
+		t.Errorf("rendered %q, %v after rollback, want version 1's body", message, err)
+	}
+
+	// A relist with the unchanged resource keeps the rollback; editing it makes a new version
+	templates.Replace(templateSourcePrefix, []NotificationTemplate{{Name: "welcome", Subject: "Welcome", Body: "Hi {{.name}},\nthanks for joining {{.product}}.", Source: source}})
+	if current, _ := templates.Get("welcome"); current.Version != 3 {
+		t.Errorf("version after relist = %d, want the rollback to hold", current.Version)
+	}
+	put("Hello {{.name}}")
+	if current, _ := templates.Get("welcome"); current.Version != 4 {
+		t.Errorf("version after editing the resource = %d, want 4", current.Version)
+	}
+
+	rec, data = do(http.MethodGet, "/api/admin/templates/welcome/versions", "")
+	var versions []NotificationTemplate
+	json.Unmarshal(data, &versions)
+	if rec.Code != http.StatusOK || len(versions) != 4 {
+		t.Errorf("versions returned %d: %s", rec.Code, rec.Body)
+	}
+	if rec, _ := do(http.MethodGet, "/api/admin/templates/welcome/versions/9", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown version returned %d, want 404", rec.Code)
+	}
+	if rec, _ := do(http.MethodPost, "/api/admin/templates/missing/rollback", `{"version":1}`); rec.Code != http.StatusNotFound {
+		t.Errorf("rollback of an unknown template returned %d, want 404", rec.Code)
+	}
+}
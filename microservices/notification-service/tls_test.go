@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"platform/pkg/server"
+)
+
+// writeCertificate writes a self-signed certificate for localhost with the given serial number
+func writeCertificate(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+}
+
+func TestTLSListener(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCertificate(t, certFile, keyFile, 1)
+
+	cfg := defaultConfig().Server
+	cfg.TLS.CertFile, cfg.TLS.KeyFile = certFile, keyFile
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})}
+	if err := server.ConfigureTLS(srv, cfg.Options()); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(listener, "", "")
+	defer srv.Close()
+
+	get := func() *http.Response {
+		t.Helper()
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		}}
+		resp, err := client.Get("https://" + listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	resp := get()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("served %s, want HTTP/2", resp.Proto)
+	}
+
+	// A rotated certificate is served without a restart
+	later := time.Now().Add(time.Minute)
+	writeCertificate(t, certFile, keyFile, 2)
+	os.Chtimes(certFile, later, later)
+	if serial := get().TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 2 {
+		t.Errorf("served certificate %d after rotation, want 2", serial)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	for name, tls := range map[string]TLSConfig{
+		"cert without key":         {CertFile: "/tls/tls.crt"},
+		"files and autocert":       {CertFile: "/tls/tls.crt", KeyFile: "/tls/tls.key", AutocertHosts: []string{"example.com"}},
+		"autocert without a cache": {AutocertHosts: []string{"example.com"}},
+	} {
+		cfg := defaultConfig()
+		cfg.Server.TLS = tls
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// minSigningKeyLength is the shortest accepted unsubscribe signing key, in bytes
+const minSigningKeyLength = 32
+
+// minUnsubscribeMaxAge is the shortest accepted token lifetime: CAN-SPAM
+// requires an unsubscribe link to work for 30 days after the email is sent
+const minUnsubscribeMaxAge = 30 * 24 * time.Hour
+
+var (
+	unsubscribesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_unsubscribes_total",
+			Help: "Total number of users who unsubscribed from a notification type through a signed link",
+		},
+		[]string{"type"},
+	)
+	suppressionChangesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "suppression_changes_total",
+			Help: "Total number of suppression changes published to and applied from the suppressions topic by outcome",
+		},
+		[]string{"direction", "outcome"},
+	)
+)
+
+var (
+	errInvalidUnsubscribeToken = errors.New("Invalid unsubscribe token")
+	errExpiredUnsubscribeToken = errors.New("Unsubscribe link has expired")
+)
+
+// suppression is a notification type a user unsubscribed from
+type suppression struct {
+	Type  string    `json:"type"`
+	Since time.Time `json:"since"`
+}
+
+// unsubscriber signs unsubscribe links and keeps the resulting suppressions
+//
+// A token is "<payload>.<signature>", both base64url encoded, where the
+// payload is the user ID, notification type and issue time in Unix seconds
+// separated by NUL bytes and the signature is its HMAC-SHA256 under the
+// signing key. Tokens are accepted for MaxAge after they were issued, so a
+// leaked link stops working eventually. Rotating the key invalidates every
+// link sent so far.
+//
+// Suppressed types are not delivered to the user on any channel; they are
+// still stored, so they show in the inbox. With a suppressions topic every
+// change is written to it before it is acknowledged, and each replica
+// applies the whole topic, so suppressions survive restarts and hold on
+// every replica.
+type unsubscriber struct {
+	key    []byte
+	url    string
+	maxAge time.Duration
+	now    func() time.Time
+	topic  *suppressionTopic
+
+	mu         sync.RWMutex
+	suppressed map[string]map[string]time.Time
+}
+
+func newUnsubscriber(cfg UnsubscribeConfig) *unsubscriber {
+	return &unsubscriber{
+		key:        []byte(cfg.SigningKey),
+		url:        cfg.URL,
+		maxAge:     cfg.MaxAge,
+		now:        time.Now,
+		suppressed: make(map[string]map[string]time.Time),
+	}
+}
+
+// SetTopic keeps suppressions on topic; call it before the unsubscriber is used
+func (u *unsubscriber) SetTopic(topic *suppressionTopic) {
+	u.topic = topic
+}
+
+// Enabled reports whether unsubscribe links can be signed and verified
+func (u *unsubscriber) Enabled() bool {
+	return len(u.key) > 0
+}
+
+// Token returns the signed token unsubscribing userID from notificationType, issued now
+func (u *unsubscriber) Token(userID, notificationType string) string {
+	payload := []byte(userID + "\x00" + notificationType + "\x00" + strconv.FormatInt(u.now().Unix(), 10))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(u.sign(payload))
+}
+
+// Link returns the unsubscribe URL for userID and notificationType, or "" when links are disabled
+func (u *unsubscriber) Link(userID, notificationType string) string {
+	if !u.Enabled() {
+		return ""
+	}
+	return u.url + "?token=" + url.QueryEscape(u.Token(userID, notificationType))
+}
+
+// Verify returns the user ID and notification type token unsubscribes
+func (u *unsubscriber) Verify(token string) (string, string, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok || !u.Enabled() {
+		return "", "", errInvalidUnsubscribeToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", "", errInvalidUnsubscribeToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, u.sign(payload)) {
+		return "", "", errInvalidUnsubscribeToken
+	}
+	fields := strings.Split(string(payload), "\x00")
+	if len(fields) != 3 || fields[0] == "" || fields[1] == "" {
+		return "", "", errInvalidUnsubscribeToken
+	}
+	issued, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", "", errInvalidUnsubscribeToken
+	}
+	if u.now().Sub(time.Unix(issued, 0)) > u.maxAge {
+		return "", "", errExpiredUnsubscribeToken
+	}
+	return fields[0], fields[1], nil
+}
+
+func (u *unsubscriber) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, u.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Suppress stops notificationType being delivered to userID, returning when it was first suppressed
+//
+// The suppression is on the topic, when there is one, before Suppress returns.
+func (u *unsubscriber) Suppress(ctx context.Context, userID, notificationType string, at time.Time) (time.Time, error) {
+	u.mu.RLock()
+	since, ok := u.suppressed[userID][notificationType]
+	u.mu.RUnlock()
+	if ok {
+		return since, nil
+	}
+	if u.topic != nil {
+		if err := u.topic.Publish(ctx, userID, notificationType, &at); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return u.suppress(userID, notificationType, at), nil
+}
+
+// Resubscribe lifts the suppression of notificationType for userID, reporting whether there was one
+func (u *unsubscriber) Resubscribe(ctx context.Context, userID, notificationType string) (bool, error) {
+	if !u.Suppressed(userID, notificationType) {
+		return false, nil
+	}
+	if u.topic != nil {
+		if err := u.topic.Publish(ctx, userID, notificationType, nil); err != nil {
+			return false, err
+		}
+	}
+	return u.resubscribe(userID, notificationType), nil
+}
+
+// suppress records a suppression on this replica only, keeping the earliest time
+func (u *unsubscriber) suppress(userID, notificationType string, at time.Time) time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	types, ok := u.suppressed[userID]
+	if !ok {
+		types = make(map[string]time.Time)
+		u.suppressed[userID] = types
+	}
+	if since, ok := types[notificationType]; ok {
+		return since
+	}
+	types[notificationType] = at
+	return at
+}
+
+// resubscribe lifts a suppression on this replica only
+func (u *unsubscriber) resubscribe(userID, notificationType string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.suppressed[userID][notificationType]; !ok {
+		return false
+	}
+	delete(u.suppressed[userID], notificationType)
+	if len(u.suppressed[userID]) == 0 {
+		delete(u.suppressed, userID)
+	}
+	return true
+}
+
+// Suppressed reports whether userID unsubscribed from notificationType
+func (u *unsubscriber) Suppressed(userID, notificationType string) bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	_, ok := u.suppressed[userID][notificationType]
+	return ok
+}
+
+// Suppressions returns the types userID unsubscribed from, by type
+func (u *unsubscriber) Suppressions(userID string) []suppression {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	list := make([]suppression, 0, len(u.suppressed[userID]))
+	for notificationType, since := range u.suppressed[userID] {
+		list = append(list, suppression{Type: notificationType, Since: since})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Type < list[j].Type })
+	return list
+}
+
+// suppressionTopic keeps suppressions on a compacted Kafka topic
+//
+// Each suppression is a message keyed by user and type holding when it
+// started; lifting it writes a tombstone, so compaction keeps exactly the
+// current suppressions. Every replica reads every partition from the start
+// rather than sharing a consumer group, since each needs all of them.
+type suppressionTopic struct {
+	brokers []string
+	topic   string
+	writer  *kafka.Writer
+	loaded  chan struct{}
+}
+
+func newSuppressionTopic(brokers []string, topic string) *suppressionTopic {
+	return &suppressionTopic{
+		brokers: brokers,
+		topic:   topic,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+		loaded: make(chan struct{}),
+	}
+}
+
+// suppressionKey is the message key of a user's suppression of a type
+func suppressionKey(userID, notificationType string) []byte {
+	return []byte(userID + "\x00" + notificationType)
+}
+
+// Publish writes the suppression of notificationType for userID since the given time, or its removal when since is nil
+func (t *suppressionTopic) Publish(ctx context.Context, userID, notificationType string, since *time.Time) error {
+	msg := kafka.Message{Key: suppressionKey(userID, notificationType)}
+	if since != nil {
+		value, err := json.Marshal(suppression{Type: notificationType, Since: *since})
+		if err != nil {
+			return err
+		}
+		msg.Value = value
+	}
+	if err := t.writer.WriteMessages(ctx, msg); err != nil {
+		suppressionChangesTotal.WithLabelValues("outbound", "failed").Inc()
+		return fmt.Errorf("storing suppression: %w", err)
+	}
+	suppressionChangesTotal.WithLabelValues("outbound", "published").Inc()
+	return nil
+}
+
+// Loaded waits until the suppressions on the topic when Run started are applied
+func (t *suppressionTopic) Loaded(ctx context.Context) error {
+	select {
+	case <-t.loaded:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run applies the topic to u, then follows it until ctx is cancelled
+func (t *suppressionTopic) Run(ctx context.Context, u *unsubscriber) {
+	logger := slog.Default().With("component", "suppressions", "topic", t.topic)
+	var ends map[int]int64
+	for {
+		var err error
+		if ends, err = t.endOffsets(ctx); err == nil {
+			break
+		}
+		logger.Warn("listing suppression partitions failed", "error", err)
+		if !sleepCtx(ctx, time.Second) {
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	var pending sync.WaitGroup
+	for partition, end := range ends {
+		wg.Add(1)
+		pending.Add(1)
+		go func(partition int, end int64) {
+			defer wg.Done()
+			t.follow(ctx, logger, u, partition, end, pending.Done)
+		}(partition, end)
+	}
+	go func() {
+		pending.Wait()
+		close(t.loaded)
+		logger.Info("suppressions loaded", "partitions", len(ends))
+	}()
+	wg.Wait()
+}
+
+// Close flushes the writer, for use once the server has stopped taking unsubscribes
+func (t *suppressionTopic) Close(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() { done <- t.writer.Close() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// endOffsets returns the offset after the last message of each partition, or 0 for empty partitions
+func (t *suppressionTopic) endOffsets(ctx context.Context) (map[int]int64, error) {
+	client := &kafka.Client{Addr: kafka.TCP(t.brokers...), Timeout: 10 * time.Second}
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{t.topic}})
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata.Topics) != 1 {
+		return nil, fmt.Errorf("topic %s not found", t.topic)
+	}
+	if err := metadata.Topics[0].Error; err != nil {
+		return nil, err
+	}
+	var requests []kafka.OffsetRequest
+	for _, p := range metadata.Topics[0].Partitions {
+		requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{t.topic: requests}})
+	if err != nil {
+		return nil, err
+	}
+	ends := make(map[int]int64, len(metadata.Topics[0].Partitions))
+	for _, p := range offsets.Topics[t.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("partition %d: %w", p.Partition, p.Error)
+		}
+		ends[p.Partition] = 0
+		if p.LastOffset > p.FirstOffset {
+			ends[p.Partition] = p.LastOffset
+		}
+	}
+	return ends, nil
+}
+
+// follow applies one partition from its first offset, calling caughtUp once it has applied everything before end
+func (t *suppressionTopic) follow(ctx context.Context, logger *slog.Logger, u *unsubscriber, partition int, end int64, caughtUp func()) {
+	var once sync.Once
+	defer once.Do(caughtUp)
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   t.brokers,
+		Topic:     t.topic,
+		Partition: partition,
+		MaxWait:   time.Second,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(kafka.FirstOffset); err != nil {
+		logger.Error("seeking suppression partition failed", "partition", partition, "error", err)
+		return
+	}
+	if end == 0 {
+		once.Do(caughtUp)
+	}
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("reading suppression failed", "partition", partition, "error", err)
+			if !sleepCtx(ctx, time.Second) {
+				return
+			}
+			continue
+		}
+		suppressionChangesTotal.WithLabelValues("inbound", applySuppression(u, msg)).Inc()
+		if msg.Offset+1 >= end {
+			once.Do(caughtUp)
+		}
+	}
+}
+
+// applySuppression applies one message of the suppressions topic, returning the outcome: applied or invalid
+func applySuppression(u *unsubscriber, msg kafka.Message) string {
+	userID, notificationType, ok := strings.Cut(string(msg.Key), "\x00")
+	if !ok || userID == "" || notificationType == "" {
+		return "invalid"
+	}
+	if msg.Value == nil {
+		u.resubscribe(userID, notificationType)
+		return "applied"
+	}
+	var s suppression
+	if err := json.Unmarshal(msg.Value, &s); err != nil {
+		return "invalid"
+	}
+	u.suppress(userID, notificationType, s.Since)
+	return "applied"
+}
+
+// unsubscribePage asks the user to confirm an unsubscribe, or tells them how it went
+//
+// Action is relative, so the form posts back to wherever the page was served.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Unsubscribe</title></head>
+<body>
+{{- if .Error}}
+<p>{{.Error}}</p>
+{{- else if .Done}}
+<p>You will no longer receive {{.Type}} notifications by email or push.</p>
+{{- else}}
+<form method="post" action="{{.Action}}">
+<p>Stop receiving {{.Type}} notifications by email or push?</p>
+<input type="hidden" name="List-Unsubscribe" value="One-Click">
+<button type="submit">Unsubscribe</button>
+</form>
+{{- end}}
+</body>
+</html>
+`))
+
+type unsubscribePageData struct {
+	Type   string
+	Action string
+	Done   bool
+	Error  string
+}
+
+func renderUnsubscribePage(c *gin.Context, status int, data unsubscribePageData) {
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	// The page carries the token, so keep it out of caches and other sites' Referer headers
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	if err := unsubscribePage.Execute(c.Writer, data); err != nil {
+		slog.Error("rendering unsubscribe page failed", "error", err)
+	}
+}
+
+// registerUnsubscribeRoutes adds the public unsubscribe endpoint and the suppression API
+//
+// The unsubscribe endpoint needs no login: the signed token is the proof.
+// GET only shows a confirmation page, since link scanners and mail
+// previews follow links in emails; POST unsubscribes, both from that page
+// and as an RFC 8058 one-click unsubscribe from mail clients.
+func registerUnsubscribeRoutes(r *gin.Engine, unsubscribes *unsubscriber) {
+	disabled := func(c *gin.Context) bool {
+		if unsubscribes.Enabled() {
+			return false
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Unsubscribe links are disabled",
+		})
+		return true
+	}
+
+	r.GET("/unsubscribe", func(c *gin.Context) {
+		if disabled(c) {
+			return
+		}
+		token := c.Query("token")
+		_, notificationType, err := unsubscribes.Verify(token)
+		if err != nil {
+			renderUnsubscribePage(c, http.StatusBadRequest, unsubscribePageData{Error: err.Error()})
+			return
+		}
+		renderUnsubscribePage(c, http.StatusOK, unsubscribePageData{
+			Type:   notificationType,
+			Action: "?token=" + url.QueryEscape(token),
+		})
+	})
+
+	r.POST("/unsubscribe", func(c *gin.Context) {
+		if disabled(c) {
+			return
+		}
+		// Browsers submitting the confirmation page get a page back, mail clients JSON
+		page := c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+		userID, notificationType, err := unsubscribes.Verify(c.Query("token"))
+		if err != nil {
+			if page {
+				renderUnsubscribePage(c, http.StatusBadRequest, unsubscribePageData{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		since, err := unsubscribes.Suppress(c.Request.Context(), userID, notificationType, time.Now())
+		if err != nil {
+			slog.Error("storing unsubscribe failed", "user_id", userID, "type", notificationType, "error", err)
+			if page {
+				renderUnsubscribePage(c, http.StatusServiceUnavailable, unsubscribePageData{Error: "Unsubscribing failed, please try again later"})
+				return
+			}
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"error":   "Unsubscribing failed, please try again later",
+			})
+			return
+		}
+		unsubscribesTotal.WithLabelValues(notificationType).Inc()
+		if page {
+			renderUnsubscribePage(c, http.StatusOK, unsubscribePageData{Type: notificationType, Done: true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"user_id": userID,
+				"type":    notificationType,
+				"since":   since,
+			},
+		})
+	})
+
+	r.GET("/api/users/:user_id/suppressions", func(c *gin.Context) {
+		list := unsubscribes.Suppressions(c.Param("user_id"))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	})
+
+	r.DELETE("/api/users/:user_id/suppressions/:type", func(c *gin.Context) {
+		found, err := unsubscribes.Resubscribe(c.Request.Context(), c.Param("user_id"), c.Param("type"))
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"error":   "Resubscribing failed, please try again later",
+			})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Suppression not found",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+}
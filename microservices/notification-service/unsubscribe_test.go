@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+)
+
+const testSigningKey = "0123456789abcdef0123456789abcdef"
+
+var testUnsubscribeConfig = UnsubscribeConfig{SigningKey: testSigningKey, URL: "https://example.com/unsubscribe", MaxAge: 90 * 24 * time.Hour}
+
+func TestUnsubscribeTokens(t *testing.T) {
+	unsubscribes := newUnsubscriber(testUnsubscribeConfig)
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	unsubscribes.now = func() time.Time { return now }
+
+	token := unsubscribes.Token("user-1", "order_status")
+	if userID, notificationType, err := unsubscribes.Verify(token); err != nil || userID != "user-1" || notificationType != "order_status" {
+		t.Errorf("Verify = %q, %q, %v", userID, notificationType, err)
+	}
+
+	link, err := url.Parse(unsubscribes.Link("user-1", "order_status"))
+	if err != nil || link.Host != "example.com" || link.Query().Get("token") != token {
+		t.Errorf("Link = %v, %v", link, err)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	otherPayload, _, _ := strings.Cut(unsubscribes.Token("user-2", "order_status"), ".")
+	other := newUnsubscriber(UnsubscribeConfig{SigningKey: strings.Repeat("x", 32)})
+	// Tokens from before issue times were signed carry none
+	legacy := []byte("user-1\x00order_status")
+	for name, bad := range map[string]string{
+		"empty":         "",
+		"unsigned":      payload,
+		"other key":     other.Token("user-1", "order_status"),
+		"other payload": otherPayload + "." + signature,
+		"not base64":    payload + ".!!",
+		"no type":       unsubscribes.Token("user-1", ""),
+		"no issue time": base64.RawURLEncoding.EncodeToString(legacy) + "." + base64.RawURLEncoding.EncodeToString(unsubscribes.sign(legacy)),
+	} {
+		if _, _, err := unsubscribes.Verify(bad); err == nil {
+			t.Errorf("%s token verified", name)
+		}
+	}
+
+	now = now.Add(90 * 24 * time.Hour)
+	if _, _, err := unsubscribes.Verify(token); err != nil {
+		t.Errorf("token at its max age returned %v", err)
+	}
+	now = now.Add(time.Second)
+	if _, _, err := unsubscribes.Verify(token); err != errExpiredUnsubscribeToken {
+		t.Errorf("expired token returned %v, want errExpiredUnsubscribeToken", err)
+	}
+	if _, _, err := newUnsubscriber(UnsubscribeConfig{}).Verify(token); err == nil {
+		t.Error("token verified without a signing key")
+	}
+	if link := newUnsubscriber(UnsubscribeConfig{}).Link("user-1", "order_status"); link != "" {
+		t.Errorf("Link without a signing key = %q", link)
+	}
+}
+
+func TestUnsubscribeEndpoint(t *testing.T) {
+	unsubscribes := newUnsubscriber(testUnsubscribeConfig)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerUnsubscribeRoutes(r, unsubscribes)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	token := url.QueryEscape(unsubscribes.Token("user-1", "promo"))
+	if code := do(http.MethodGet, "/unsubscribe?token=forged."+token).Code; code != http.StatusBadRequest {
+		t.Errorf("forged token returned %d, want 400", code)
+	}
+	// Following the link, as link scanners do, only asks for confirmation
+	page := do(http.MethodGet, "/unsubscribe?token="+token)
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), `<form method="post" action="?token=`+token+`"`) {
+		t.Fatalf("confirmation page returned %d: %s", page.Code, page.Body)
+	}
+	if unsubscribes.Suppressed("user-1", "promo") {
+		t.Fatal("opening the link unsubscribed")
+	}
+
+	// Confirming on the page
+	form := httptest.NewRequest(http.MethodPost, "/unsubscribe?token="+token, strings.NewReader("List-Unsubscribe=One-Click"))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	confirmed := httptest.NewRecorder()
+	r.ServeHTTP(confirmed, form)
+	if confirmed.Code != http.StatusOK || !strings.Contains(confirmed.Body.String(), "no longer receive promo") {
+		t.Errorf("confirming returned %d: %s", confirmed.Code, confirmed.Body)
+	}
+	// Mail clients POST one-click unsubscribes; repeating one is harmless
+	if rec := do(http.MethodPost, "/unsubscribe?token="+token); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"success":true`) {
+		t.Errorf("one-click unsubscribe returned %d: %s", rec.Code, rec.Body)
+	}
+	if !unsubscribes.Suppressed("user-1", "promo") || unsubscribes.Suppressed("user-1", "order_status") || unsubscribes.Suppressed("user-2", "promo") {
+		t.Error("unsubscribing suppressed the wrong user or type")
+	}
+
+	var resp struct {
+		Data []suppression `json:"data"`
+	}
+	json.Unmarshal(do(http.MethodGet, "/api/users/user-1/suppressions").Body.Bytes(), &resp)
+	if len(resp.Data) != 1 || resp.Data[0].Type != "promo" {
+		t.Errorf("suppressions = %+v", resp.Data)
+	}
+	if code := do(http.MethodDelete, "/api/users/user-1/suppressions/promo").Code; code != http.StatusOK || unsubscribes.Suppressed("user-1", "promo") {
+		t.Errorf("resubscribe returned %d", code)
+	}
+	if code := do(http.MethodDelete, "/api/users/user-1/suppressions/promo").Code; code != http.StatusNotFound {
+		t.Errorf("resubscribing twice returned %d, want 404", code)
+	}
+
+	disabled := gin.New()
+	registerUnsubscribeRoutes(disabled, newUnsubscriber(UnsubscribeConfig{}))
+	rec := httptest.NewRecorder()
+	disabled.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unsubscribe?token="+token, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unsubscribe without a signing key returned %d, want 404", rec.Code)
+	}
+}
+
+func TestApplySuppression(t *testing.T) {
+	unsubscribes := newUnsubscriber(testUnsubscribeConfig)
+	since := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	value, _ := json.Marshal(suppression{Type: "promo", Since: since})
+
+	// Replicas replay the topic from the start, so each change may be applied more than once
+	for _, tc := range []struct {
+		name       string
+		msg        kafka.Message
+		outcome    string
+		suppressed bool
+	}{
+		{"suppress", kafka.Message{Key: suppressionKey("user-1", "promo"), Value: value}, "applied", true},
+		{"suppress again", kafka.Message{Key: suppressionKey("user-1", "promo"), Value: value}, "applied", true},
+		{"no type", kafka.Message{Key: []byte("user-1"), Value: value}, "invalid", true},
+		{"malformed", kafka.Message{Key: suppressionKey("user-1", "promo"), Value: []byte("{")}, "invalid", true},
+		{"tombstone", kafka.Message{Key: suppressionKey("user-1", "promo")}, "applied", false},
+		{"tombstone again", kafka.Message{Key: suppressionKey("user-1", "promo")}, "applied", false},
+	} {
+		if outcome := applySuppression(unsubscribes, tc.msg); outcome != tc.outcome {
+			t.Errorf("%s: outcome = %s, want %s", tc.name, outcome, tc.outcome)
+		}
+		if got := unsubscribes.Suppressed("user-1", "promo"); got != tc.suppressed {
+			t.Errorf("%s: suppressed = %v, want %v", tc.name, got, tc.suppressed)
+		}
+	}
+	applySuppression(unsubscribes, kafka.Message{Key: suppressionKey("user-1", "promo"), Value: value})
+	if list := unsubscribes.Suppressions("user-1"); len(list) != 1 || !list[0].Since.Equal(since) {
+		t.Errorf("suppressions = %+v, want the one since %s", list, since)
+	}
+}
+
+// recordingSender remembers the recipients it was asked to deliver to
+type recordingSender struct {
+	sent chan recipient
+}
+
+func (s recordingSender) Send(_ context.Context, _ Notification, to recipient) error {
+	s.sent <- to
+	return nil
+}
+
+func TestDispatcherHonorsSuppressions(t *testing.T) {
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	sender := recordingSender{sent: make(chan recipient, 10)}
+	dispatcher.senders[channelEmail] = sender
+	dispatcher.senders[channelPush] = sender
+	unsubscribes := newUnsubscriber(testUnsubscribeConfig)
+	// Links carry their issue time, so the expected one must be signed at the same moment
+	now := time.Now()
+	unsubscribes.now = func() time.Time { return now }
+	unsubscribes.Suppress(context.Background(), "user-1", "promo", now)
+	dispatcher.SetUnsubscriber(unsubscribes)
+	dispatcher.Start(1)
+
+	dispatcher.Enqueue(Notification{ID: "1", UserID: "user-1", Type: "promo"}, []string{channelEmail, channelPush})
+	dispatcher.Enqueue(Notification{ID: "2", UserID: "user-1", Type: "order_status"}, []string{channelEmail})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := dispatcher.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	close(sender.sent)
+	var delivered []recipient
+	for to := range sender.sent {
+		delivered = append(delivered, to)
+	}
+	if len(delivered) != 1 {
+		t.Fatalf("delivered %d notifications, want only the unsuppressed one", len(delivered))
+	}
+	if want := unsubscribes.Link("user-1", "order_status"); delivered[0].UnsubscribeURL != want {
+		t.Errorf("email unsubscribe link = %q, want %q", delivered[0].UnsubscribeURL, want)
+	}
+}
+
+func TestMandatoryDeliveryIgnoresUnsubscribe(t *testing.T) {
+	cfg := defaultConfig()
+	dispatcher := newDispatcher(cfg.Delivery.QueueSize, cfg.Delivery.MaxAttempts, cfg.Delivery.RetryDelay, newSLOPolicy(cfg.SLO), cfg.CircuitBreakers, nil)
+	sender := recordingSender{sent: make(chan recipient, 10)}
+	dispatcher.senders[channelEmail] = sender
+	unsubscribes := newUnsubscriber(testUnsubscribeConfig)
+	unsubscribes.Suppress(context.Background(), "user-1", "security", time.Now())
+	dispatcher.SetUnsubscriber(unsubscribes)
+	dispatcher.Start(1)
+
+	templates := newTemplateStore()
+	if err := templates.Put(NotificationTemplate{Name: "password-changed", Subject: "Password changed", Body: "Your password was changed."}); err != nil {
+		t.Fatal(err)
+	}
+	types := newTypeRegistry(cfg.Types)
+	if err := types.Put(NotificationType{Name: "security"}); err != nil {
+		t.Fatal(err)
+	}
+	publish := func(_ context.Context, notification Notification, channels, mandatory []string) error {
+		return dispatcher.EnqueueMandatory(notification, channels, mandatory)
+	}
+	handler := newEventHandler(eventPipelines(cfg.Events)[2], templates, newContentValidator(cfg.Content), types, nil, nil, publish)
+	value, _ := json.Marshal(platformEvent{ID: "e1", Type: "security.password_changed", UserID: "user-1"})
+	if !handleEventMessage(context.Background(), slog.Default(), handler, kafka.Message{Value: value}) {
+		t.Fatal("security event left for redelivery")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := dispatcher.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	close(sender.sent)
+	var delivered []recipient
+	for to := range sender.sent {
+		delivered = append(delivered, to)
+	}
+	if len(delivered) != 1 {
+		t.Fatalf("delivered %d security emails after an unsubscribe, want 1", len(delivered))
+	}
+	if delivered[0].UnsubscribeURL != "" {
+		t.Errorf("security email unsubscribe link = %q, want none", delivered[0].UnsubscribeURL)
+	}
+}
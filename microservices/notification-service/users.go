@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// errNoRecipient means the user has no address for the requested channel,
+// so retrying the delivery cannot succeed
+var errNoRecipient = errors.New("user has no address for channel")
+
+// userContact is the user service's view of where a user can be reached
+type userContact struct {
+	UserID       string   `json:"userId"`
+	Name         string   `json:"name"`
+	Email        string   `json:"email"`
+	Phone        string   `json:"phone"`
+	DeviceTokens []string `json:"deviceTokens"`
+	Locale       string   `json:"locale"`
+	Timezone     string   `json:"timezone"`
+	// OptOuts lists the channels the user no longer wants notifications on
+	OptOuts []string `json:"optOuts"`
+	// CategoryOptOuts lists the notification categories the user no longer wants on any channel
+	CategoryOptOuts []string `json:"categoryOptOuts"`
+}
+
+// userProfile is the user service's view of a user's attributes, for segmentation
+type userProfile struct {
+	ID        string    `json:"id"`
+	Locale    string    `json:"locale"`
+	Timezone  string    `json:"timezone"`
+	Plan      string    `json:"plan"`
+	CreatedAt time.Time `json:"createdAt"`
+	// OptOuts and CategoryOptOuts are as in userContact
+	OptOuts         []string `json:"optOuts"`
+	CategoryOptOuts []string `json:"categoryOptOuts"`
+}
+
+// recipient is the resolved delivery target handed to a channel sender
+type recipient struct {
+	// Addresses are the email address, phone number or device tokens for the channel
+	Addresses []string
+	Locale    string
+	Timezone  string
+	// UnsubscribeURL is the one-click unsubscribe link for emails, if links are enabled
+	UnsubscribeURL string
+}
+
+// recipientFor picks the addresses in contact that channel delivers to
+func recipientFor(contact userContact, channel string) (recipient, error) {
+	to := recipient{Locale: contact.Locale, Timezone: contact.Timezone}
+	switch channel {
+	case channelEmail:
+		if contact.Email != "" {
+			to.Addresses = []string{contact.Email}
+		}
+	case channelSMS:
+		if contact.Phone != "" {
+			to.Addresses = []string{contact.Phone}
+		}
+	case channelPush:
+		to.Addresses = contact.DeviceTokens
+	}
+	if len(to.Addresses) == 0 {
+		return recipient{}, fmt.Errorf("%s: %w", channel, errNoRecipient)
+	}
+	return to, nil
+}
+
+// recipientResolver finds the delivery target for a user on a channel
+type recipientResolver interface {
+	Resolve(ctx context.Context, userID, channel string) (recipient, error)
+}
+
+// cachedContact is a user contact and when it stops being served from the cache
+type cachedContact struct {
+	contact   userContact
+	expiresAt time.Time
+}
+
+// userDirectory resolves delivery targets through the user service
+//
+// Contacts are cached briefly because a single notification fans out to
+// several channels and bursts often target the same users.
+type userDirectory struct {
+	client  *serviceClient
+	ttl     time.Duration
+	maxSize int
+
+	mu    sync.Mutex
+	cache map[string]cachedContact
+}
+
+func newUserDirectory(client *serviceClient, cfg UserLookupConfig) *userDirectory {
+	return &userDirectory{
+		client:  client,
+		ttl:     cfg.CacheTTL,
+		maxSize: cfg.CacheSize,
+		cache:   make(map[string]cachedContact),
+	}
+}
+
+// Resolve implements recipientResolver
+func (d *userDirectory) Resolve(ctx context.Context, userID, channel string) (recipient, error) {
+	contact, err := d.Contact(ctx, userID)
+	if err != nil {
+		return recipient{}, err
+	}
+	return recipientFor(contact, channel)
+}
+
+// Contact returns the contact details for userID
+//
+// A user the user service does not know is reported as errNoRecipient.
+func (d *userDirectory) Contact(ctx context.Context, userID string) (userContact, error) {
+	d.mu.Lock()
+	cached, ok := d.cache[userID]
+	d.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.contact, nil
+	}
+
+	var resp struct {
+		Data userContact `json:"data"`
+	}
+	err := d.client.doJSON(ctx, serviceUser, http.MethodGet, "/api/users/"+url.PathEscape(userID)+"/contact", nil, &resp)
+	if isServiceStatus(err, http.StatusNotFound) {
+		return userContact{}, fmt.Errorf("user %s not found: %w", userID, errNoRecipient)
+	}
+	if err != nil {
+		return userContact{}, err
+	}
+
+	if d.ttl > 0 && d.maxSize > 0 {
+		d.mu.Lock()
+		if len(d.cache) >= d.maxSize {
+			d.evictLocked()
+		}
+		d.cache[userID] = cachedContact{contact: resp.Data, expiresAt: time.Now().Add(d.ttl)}
+		d.mu.Unlock()
+	}
+	return resp.Data, nil
+}
+
+// Profiles returns every user known to the user service
+//
+// Profiles are not cached: they are only read by segment sends, each of
+// which wants the current set of users.
+func (d *userDirectory) Profiles(ctx context.Context) ([]userProfile, error) {
+	var resp struct {
+		Data []userProfile `json:"data"`
+	}
+	if err := d.client.doJSON(ctx, serviceUser, http.MethodGet, "/api/users", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// evictLocked drops expired entries, or an arbitrary one if none have expired
+func (d *userDirectory) evictLocked() {
+	now := time.Now()
+	for id, entry := range d.cache {
+		if now.After(entry.expiresAt) {
+			delete(d.cache, id)
+		}
+	}
+	if len(d.cache) < d.maxSize {
+		return
+	}
+	for id := range d.cache {
+		delete(d.cache, id)
+		return
+	}
+}
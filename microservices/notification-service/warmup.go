@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var startupDuration = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "startup_duration_seconds",
+		Help: "Time the warmup phase took before the service reported started",
+	},
+)
+
+// warmupStep prepares one part of the service before it takes traffic
+type warmupStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Warmup runs the startup steps that must succeed before the pod is started and ready
+//
+// Steps are retried until they succeed, so a dependency that is still coming
+// up delays startup rather than failing the first requests. The startup
+// probe's failure threshold bounds how long that may take.
+type Warmup struct {
+	steps   []warmupStep
+	started atomic.Bool
+
+	mu     sync.Mutex
+	status map[string]string
+}
+
+func newWarmup() *Warmup {
+	return &Warmup{status: make(map[string]string)}
+}
+
+// AddStep registers a step; steps must be added before Run
+func (w *Warmup) AddStep(name string, run func(ctx context.Context) error) {
+	w.steps = append(w.steps, warmupStep{name: name, run: run})
+	w.setStatus(name, "pending")
+}
+
+// Started reports whether every step has completed
+func (w *Warmup) Started() bool {
+	return w.started.Load()
+}
+
+// Run executes all steps concurrently, retrying each until it succeeds or ctx is cancelled
+func (w *Warmup) Run(ctx context.Context) {
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for _, step := range w.steps {
+		wg.Add(1)
+		go func(step warmupStep) {
+			defer wg.Done()
+			w.runStep(ctx, step)
+		}(step)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+	w.started.Store(true)
+	startupDuration.Set(time.Since(start).Seconds())
+	slog.Info("warmup complete", "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (w *Warmup) runStep(ctx context.Context, step warmupStep) {
+	for {
+		err := step.run(ctx)
+		if err == nil {
+			w.setStatus(step.name, "done")
+			return
+		}
+		w.setStatus(step.name, err.Error())
+		slog.Info("warmup step not ready yet", "step", step.name, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (w *Warmup) setStatus(name, status string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status[name] = status
+}
+
+func (w *Warmup) snapshot() map[string]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := make(map[string]string, len(w.status))
+	for name, s := range w.status {
+		status[name] = s
+	}
+	return status
+}
+
+// startupHandler answers the startup probe
+func startupHandler(warmup *Warmup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code, status := http.StatusOK, "started"
+		if !warmup.Started() {
+			code, status = http.StatusServiceUnavailable, "starting"
+		}
+		c.JSON(code, gin.H{
+			"status":  status,
+			"service": "notification-service",
+			"steps":   warmup.snapshot(),
+		})
+	}
+}
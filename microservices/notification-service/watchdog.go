@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/logging"
+)
+
+// deliveriesReclaimedTotal counts stuck deliveries by what the watchdog did with them
+var deliveriesReclaimedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "deliveries_reclaimed_total",
+		Help: "Deliveries the watchdog took back from a worker stuck past the processing deadline, by whether they were retried or dead-lettered",
+	},
+	[]string{"channel", "action"},
+)
+
+// inFlightDelivery is a delivery a worker is resolving the recipient of or handing to a provider
+type inFlightDelivery struct {
+	job     deliveryJob
+	lane    *deliveryLane
+	started time.Time
+	// cancel gives up on the provider call
+	cancel context.CancelFunc
+}
+
+// track records job as in flight on lane, returning the context its provider call runs in
+func (d *Dispatcher) track(ctx context.Context, lane *deliveryLane, job deliveryJob) (context.Context, *inFlightDelivery) {
+	ctx, cancel := context.WithCancel(ctx)
+	flight := &inFlightDelivery{job: job, lane: lane, started: time.Now(), cancel: cancel}
+	d.flightMu.Lock()
+	d.inFlight[flight] = struct{}{}
+	d.flightMu.Unlock()
+	return ctx, flight
+}
+
+// untrack ends flight, returning false if the watchdog reclaimed it first
+func (d *Dispatcher) untrack(flight *inFlightDelivery) bool {
+	flight.cancel()
+	d.flightMu.Lock()
+	defer d.flightMu.Unlock()
+	_, ok := d.inFlight[flight]
+	delete(d.inFlight, flight)
+	return ok
+}
+
+// InFlight returns the number of deliveries workers are sending
+func (d *Dispatcher) InFlight() int {
+	d.flightMu.Lock()
+	defer d.flightMu.Unlock()
+	return len(d.inFlight)
+}
+
+// RunWatchdog reclaims deliveries stuck in flight past cfg's deadline until ctx is cancelled
+//
+// A worker that dies or hangs mid-send would otherwise hold its delivery,
+// and the slot in its lane, forever. Does nothing when the watchdog is off.
+func (d *Dispatcher) RunWatchdog(ctx context.Context, cfg DeliveryWatchdogConfig) {
+	if cfg.Deadline <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if reclaimed := d.reclaim(cfg, now); reclaimed > 0 {
+				logging.FromContext(ctx).Warn("reclaimed stuck deliveries", "count", reclaimed, "deadline", cfg.Deadline)
+			}
+		}
+	}
+}
+
+// reclaim takes the deliveries in flight for longer than cfg's deadline at now
+// away from their workers, and retries or dead-letters them by cfg's policy
+//
+// Each stuck worker is replaced, so its lane keeps its capacity; the stuck
+// one exits if its provider call ever returns.
+func (d *Dispatcher) reclaim(cfg DeliveryWatchdogConfig, now time.Time) int {
+	var stuck []*inFlightDelivery
+	d.flightMu.Lock()
+	for flight := range d.inFlight {
+		if now.Sub(flight.started) > cfg.Deadline {
+			stuck = append(stuck, flight)
+			delete(d.inFlight, flight)
+		}
+	}
+	d.flightMu.Unlock()
+
+	for _, flight := range stuck {
+		flight.cancel()
+		go d.worker(flight.lane)
+
+		job := flight.job
+		err := fmt.Errorf("delivery stuck in flight for %s, past the %s deadline", now.Sub(flight.started).Round(time.Second), cfg.Deadline)
+		ctx := logging.NewContext(context.Background(), logging.FromContext(context.Background()).With(
+			"request_id", job.Notification.CorrelationID,
+			"channel", job.Channel,
+			"attempt", job.Attempt,
+		))
+		if cfg.Policy == watchdogDeadLetter || job.Attempt >= d.maxAttempts {
+			deliveriesReclaimedTotal.WithLabelValues(job.Channel, "dead_lettered").Inc()
+		} else {
+			deliveriesReclaimedTotal.WithLabelValues(job.Channel, "retried").Inc()
+		}
+		if cfg.Policy == watchdogDeadLetter {
+			job.LastError = err.Error()
+			d.recordFailure(job)
+			d.deadLetter(job)
+			continue
+		}
+		d.fail(ctx, job, err)
+	}
+	return len(stuck)
+}
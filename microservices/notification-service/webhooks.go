@@ -0,0 +1,421 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Statuses of a delivery record; sent means the provider accepted the
+// notification, the others are reported back by the provider
+const (
+	deliverySent      = "sent"
+	deliveryDelivered = "delivered"
+	deliveryBounced   = "bounced"
+	deliveryFailed    = "failed"
+)
+
+// Delivery providers calling back with receipts
+const (
+	providerSendGrid = "sendgrid"
+	providerTwilio   = "twilio"
+	providerFCM      = "fcm"
+)
+
+var providerCallbacksTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "provider_callbacks_total",
+		Help: "Total number of delivery receipts from providers by resulting status",
+	},
+	[]string{"provider", "status"},
+)
+
+// maxDeliveryRecords is how many notifications' delivery records are kept
+const maxDeliveryRecords = 100000
+
+// maxWebhookBodyBytes bounds a receipt request; SendGrid batches stay under 768KB
+const maxWebhookBodyBytes = 1 << 20
+
+// sendGridTimestampTolerance is how far a signed SendGrid timestamp may be
+// from now, so a captured batch cannot be replayed later
+const sendGridTimestampTolerance = 5 * time.Minute
+
+// deliveryRecord is what is known about a notification's delivery on one channel
+type deliveryRecord struct {
+	Channel string `json:"channel"`
+	Status  string `json:"status"`
+	// ProviderID is the provider's message ID, once a receipt reported it
+	ProviderID string    `json:"provider_id,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// deliveryRecords tracks deliveries from the provider accepting them to the
+// provider's receipt
+//
+// Records are kept for the most recent maxDeliveryRecords notifications.
+// Receipts may arrive before the dispatcher records the send, so a receipt
+// is never overwritten by it.
+type deliveryRecords struct {
+	mu      sync.Mutex
+	records map[string]map[string]*deliveryRecord
+	order   []string
+	next    int
+}
+
+func newDeliveryRecords() *deliveryRecords {
+	return &deliveryRecords{records: make(map[string]map[string]*deliveryRecord)}
+}
+
+// Sent records that the provider for channel accepted notificationID
+func (r *deliveryRecords) Sent(notificationID, channel string, at time.Time) {
+	r.SentBatch([]deliverySend{{NotificationID: notificationID, Channel: channel, At: at}})
+}
+
+// SentBatch records a batch of accepted sends at once
+func (r *deliveryRecords) SentBatch(sends []deliverySend) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, send := range sends {
+		channels := r.channelsLocked(send.NotificationID)
+		if _, ok := channels[send.Channel]; !ok {
+			channels[send.Channel] = &deliveryRecord{Channel: send.Channel, Status: deliverySent, UpdatedAt: send.At}
+		}
+	}
+}
+
+// Update records a provider receipt for notificationID on channel
+func (r *deliveryRecords) Update(notificationID string, record deliveryRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.channelsLocked(notificationID)[record.Channel] = &record
+}
+
+// For returns the delivery records of notificationID, by channel
+func (r *deliveryRecords) For(notificationID string) []deliveryRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]deliveryRecord, 0, len(r.records[notificationID]))
+	for _, record := range r.records[notificationID] {
+		list = append(list, *record)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Channel < list[j].Channel })
+	return list
+}
+
+// channelsLocked returns the records of notificationID, evicting the oldest notification to make room
+func (r *deliveryRecords) channelsLocked(notificationID string) map[string]*deliveryRecord {
+	if channels, ok := r.records[notificationID]; ok {
+		return channels
+	}
+	if len(r.order) < maxDeliveryRecords {
+		r.order = append(r.order, notificationID)
+	} else {
+		delete(r.records, r.order[r.next])
+		r.order[r.next] = notificationID
+	}
+	r.next = (r.next + 1) % maxDeliveryRecords
+	channels := make(map[string]*deliveryRecord)
+	r.records[notificationID] = channels
+	return channels
+}
+
+// Receipt statuses of each provider that map to a delivery status; others,
+// such as SendGrid opens or Twilio's queued, are acknowledged and ignored
+var (
+	sendGridStatuses = map[string]string{
+		"delivered": deliveryDelivered,
+		"bounce":    deliveryBounced,
+		"dropped":   deliveryFailed,
+	}
+	twilioStatuses = map[string]string{
+		"delivered":   deliveryDelivered,
+		"undelivered": deliveryBounced,
+		"failed":      deliveryFailed,
+	}
+	fcmStatuses = map[string]string{
+		deliveryDelivered: deliveryDelivered,
+		deliveryBounced:   deliveryBounced,
+		deliveryFailed:    deliveryFailed,
+	}
+)
+
+// sendGridEvent is one event of a SendGrid event webhook batch
+//
+// notification_id is a custom argument set on the message when it is sent.
+type sendGridEvent struct {
+	Event string `json:"event"`
+	Email string `json:"email"`
+	// Type tells hard bounces ("bounce") from temporary blocks ("blocked")
+	Type           string `json:"type"`
+	NotificationID string `json:"notification_id"`
+	MessageID      string `json:"sg_message_id"`
+	Reason         string `json:"reason"`
+	Timestamp      int64  `json:"timestamp"`
+}
+
+// fcmReceipt is a push delivery receipt
+//
+// FCM has no delivery callbacks of its own, so receipts come from a relay
+// fed by the client apps, signed with the shared FCM webhook secret.
+type fcmReceipt struct {
+	NotificationID string `json:"notification_id"`
+	MessageID      string `json:"message_id"`
+	Status         string `json:"status"`
+	Error          string `json:"error"`
+}
+
+// parseSendGridKey decodes the public key SendGrid shows for a signed event webhook
+func parseSendGridKey(encoded string) (*ecdsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA public key")
+	}
+	return ecdsaKey, nil
+}
+
+// verifySendGrid checks SendGrid's ECDSA signature over the timestamp and body,
+// and that the timestamp is within sendGridTimestampTolerance of now
+func verifySendGrid(key *ecdsa.PublicKey, signature, timestamp string, body []byte, now time.Time) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > sendGridTimestampTolerance || age < -sendGridTimestampTolerance {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+	return ecdsa.VerifyASN1(key, digest[:], decoded)
+}
+
+// verifyTwilio checks Twilio's HMAC-SHA1 signature over the callback URL and
+// the form parameters, sorted by name
+func verifyTwilio(authToken, callbackURL string, form url.Values, signature string) bool {
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(callbackURL))
+	for _, name := range names {
+		for _, value := range form[name] {
+			mac.Write([]byte(name + value))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	return err == nil && hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// verifyFCM checks the relay's "sha256=<hex HMAC-SHA256 of the body>" signature
+func verifyFCM(secret string, body []byte, signature string) bool {
+	decoded, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// registerWebhookRoutes adds the provider receipt webhooks and the delivery record API
+//
+// The webhooks are public: each is authenticated by its provider's
+// signature instead, and answers 404 until its secret is configured.
+//
+// Hard bounces and complaints also add the address to suppressions.
+func registerWebhookRoutes(api *gin.RouterGroup, cfg WebhookConfig, records *deliveryRecords, suppressions *suppressionList) {
+	// Bodies are read before the signature can be checked, so anyone could otherwise send gigabytes
+	limitBody := func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodyBytes)
+	}
+	// unreadable answers a body that could not be read, reporting whether it was too large
+	unreadable := func(c *gin.Context, provider string, err error) bool {
+		var tooLarge *http.MaxBytesError
+		if !errors.As(err, &tooLarge) {
+			return false
+		}
+		providerCallbacksTotal.WithLabelValues(provider, "too_large").Inc()
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"error":   "Request body too large",
+		})
+		return true
+	}
+	notConfigured := func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Webhook is not configured",
+		})
+	}
+	invalidSignature := func(c *gin.Context, provider string) {
+		providerCallbacksTotal.WithLabelValues(provider, "invalid_signature").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Invalid signature",
+		})
+	}
+	// receipt records a provider receipt, reporting whether its status is one that is tracked
+	receipt := func(provider, notificationID string, statuses map[string]string, providerStatus string, record deliveryRecord) bool {
+		status, ok := statuses[providerStatus]
+		if !ok || notificationID == "" {
+			providerCallbacksTotal.WithLabelValues(provider, "ignored").Inc()
+			return false
+		}
+		record.Status = status
+		records.Update(notificationID, record)
+		providerCallbacksTotal.WithLabelValues(provider, status).Inc()
+		return true
+	}
+
+	sendGridKey, _ := parseSendGridKey(cfg.SendGridPublicKey)
+	api.POST("/webhooks/sendgrid", limitBody, func(c *gin.Context) {
+		if sendGridKey == nil {
+			notConfigured(c)
+			return
+		}
+		body, err := c.GetRawData()
+		if err != nil && unreadable(c, providerSendGrid, err) {
+			return
+		}
+		if err != nil || !verifySendGrid(sendGridKey,
+			c.GetHeader("X-Twilio-Email-Event-Webhook-Signature"),
+			c.GetHeader("X-Twilio-Email-Event-Webhook-Timestamp"), body, time.Now()) {
+			invalidSignature(c, providerSendGrid)
+			return
+		}
+		var events []sendGridEvent
+		if err := json.Unmarshal(body, &events); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		updated := 0
+		for _, event := range events {
+			switch {
+			case strings.TrimSpace(event.Email) == "":
+				// Nothing to suppress; the receipt is still recorded
+			case event.Event == "bounce" && event.Type != "blocked":
+				suppressions.Add(suppressedAddress{Channel: channelEmail, Address: event.Email, Reason: suppressedBounce, Detail: event.Reason, Since: time.Now()})
+			case event.Event == "spamreport":
+				suppressions.Add(suppressedAddress{Channel: channelEmail, Address: event.Email, Reason: suppressedComplaint, Since: time.Now()})
+			}
+			if receipt(providerSendGrid, event.NotificationID, sendGridStatuses, event.Event, deliveryRecord{
+				Channel:    channelEmail,
+				ProviderID: event.MessageID,
+				Reason:     event.Reason,
+				UpdatedAt:  time.Unix(event.Timestamp, 0),
+			}) {
+				updated++
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"count":   updated,
+		})
+	})
+
+	api.POST("/webhooks/twilio", limitBody, func(c *gin.Context) {
+		if cfg.TwilioAuthToken == "" {
+			notConfigured(c)
+			return
+		}
+		callbackURL := cfg.TwilioURL
+		if c.Request.URL.RawQuery != "" {
+			callbackURL += "?" + c.Request.URL.RawQuery
+		}
+		err := c.Request.ParseForm()
+		if err != nil && unreadable(c, providerTwilio, err) {
+			return
+		}
+		if err != nil || !verifyTwilio(cfg.TwilioAuthToken, callbackURL, c.Request.PostForm, c.GetHeader("X-Twilio-Signature")) {
+			invalidSignature(c, providerTwilio)
+			return
+		}
+		if reason, ok := twilioSuppressions[c.PostForm("ErrorCode")]; ok && strings.TrimSpace(c.PostForm("To")) != "" {
+			suppressions.Add(suppressedAddress{Channel: channelSMS, Address: c.PostForm("To"), Reason: reason, Detail: "Twilio error " + c.PostForm("ErrorCode"), Since: time.Now()})
+		}
+		// The notification ID is a parameter of the status callback URL set when sending
+		receipt(providerTwilio, c.Query("notification_id"), twilioStatuses, c.PostForm("MessageStatus"), deliveryRecord{
+			Channel:    channelSMS,
+			ProviderID: c.PostForm("MessageSid"),
+			Reason:     c.PostForm("ErrorCode"),
+			UpdatedAt:  time.Now(),
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+
+	api.POST("/webhooks/fcm", limitBody, func(c *gin.Context) {
+		if cfg.FCMSecret == "" {
+			notConfigured(c)
+			return
+		}
+		body, err := c.GetRawData()
+		if err != nil && unreadable(c, providerFCM, err) {
+			return
+		}
+		if err != nil || !verifyFCM(cfg.FCMSecret, body, c.GetHeader("X-FCM-Signature")) {
+			invalidSignature(c, providerFCM)
+			return
+		}
+		var report fcmReceipt
+		if err := json.Unmarshal(body, &report); err != nil || report.NotificationID == "" || report.Status == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+		receipt(providerFCM, report.NotificationID, fcmStatuses, report.Status, deliveryRecord{
+			Channel:    channelPush,
+			ProviderID: report.MessageID,
+			Reason:     report.Error,
+			UpdatedAt:  time.Now(),
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+
+	api.GET("/notifications/:id/deliveries", func(c *gin.Context) {
+		list := records.For(c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    list,
+			"count":   len(list),
+		})
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProviderWebhooks(t *testing.T) {
+	sendGridKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&sendGridKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := WebhookConfig{
+		SendGridPublicKey: base64.StdEncoding.EncodeToString(der),
+		TwilioAuthToken:   "twilio-token",
+		TwilioURL:         "https://example.com/api/webhooks/twilio",
+		FCMSecret:         "fcm-secret",
+	}
+	records := newDeliveryRecords()
+	records.Sent("n1", channelEmail, time.Now())
+	records.Sent("n1", channelSMS, time.Now())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	suppressions := newSuppressionList()
+	registerWebhookRoutes(r.Group("/api"), cfg, records, suppressions)
+	post := func(path, contentType, body string, headers map[string]string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// SendGrid signs the timestamp followed by the body
+	events := `[
+		{"event":"open","notification_id":"n1"},
+		{"event":"bounce","type":"bounce","email":"Gone@Example.com","notification_id":"n1","sg_message_id":"sg-1","reason":"mailbox full","timestamp":1767225600},
+		{"event":"bounce","type":"blocked","email":"busy@example.com","notification_id":"n3"},
+		{"event":"spamreport","email":"angry@example.com","notification_id":"n4"},
+		{"event":"bounce","type":"bounce","email":" ","notification_id":"n6"}
+	]`
+	sendGridHeaders := func(at time.Time, body string) map[string]string {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		digest := sha256.Sum256([]byte(timestamp + body))
+		signature, err := ecdsa.SignASN1(rand.Reader, sendGridKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{
+			"X-Twilio-Email-Event-Webhook-Signature": base64.StdEncoding.EncodeToString(signature),
+			"X-Twilio-Email-Event-Webhook-Timestamp": timestamp,
+		}
+	}
+	if code := post("/api/webhooks/sendgrid", "application/json", strings.Replace(events, "bounce", "delivered", 1), sendGridHeaders(time.Now(), events)); code != http.StatusUnauthorized {
+		t.Errorf("tampered SendGrid events returned %d, want 401", code)
+	}
+	// A captured batch replayed later is refused although its signature holds
+	if code := post("/api/webhooks/sendgrid", "application/json", events, sendGridHeaders(time.Now().Add(-time.Hour), events)); code != http.StatusUnauthorized {
+		t.Errorf("replayed SendGrid events returned %d, want 401", code)
+	}
+	oversized := "[" + strings.Repeat(" ", maxWebhookBodyBytes) + "]"
+	if code := post("/api/webhooks/sendgrid", "application/json", oversized, sendGridHeaders(time.Now(), oversized)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized SendGrid batch returned %d, want 413", code)
+	}
+	if code := post("/api/webhooks/sendgrid", "application/json", events, sendGridHeaders(time.Now(), events)); code != http.StatusOK {
+		t.Errorf("SendGrid events returned %d", code)
+	}
+
+	// Twilio signs the callback URL followed by each form parameter name and value, sorted by name
+	form := url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"delivered"}, "AccountSid": {"AC1"}}
+	mac := hmac.New(sha1.New, []byte("twilio-token"))
+	mac.Write([]byte(cfg.TwilioURL + "?notification_id=n1" + "AccountSidAC1" + "MessageSidSM1" + "MessageStatusdelivered"))
+	twilioSignature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if code := post("/api/webhooks/twilio?notification_id=n2", "application/x-www-form-urlencoded", form.Encode(), map[string]string{"X-Twilio-Signature": twilioSignature}); code != http.StatusUnauthorized {
+		t.Errorf("Twilio callback for another notification returned %d, want 401", code)
+	}
+	if code := post("/api/webhooks/twilio?notification_id=n1", "application/x-www-form-urlencoded", form.Encode(), map[string]string{"X-Twilio-Signature": twilioSignature}); code != http.StatusOK {
+		t.Errorf("Twilio callback returned %d", code)
+	}
+	stop := url.Values{"MessageSid": {"SM2"}, "MessageStatus": {"failed"}, "ErrorCode": {"21610"}, "To": {"+15550100"}}
+	mac = hmac.New(sha1.New, []byte("twilio-token"))
+	mac.Write([]byte(cfg.TwilioURL + "?notification_id=n5" + "ErrorCode21610" + "MessageSidSM2" + "MessageStatusfailed" + "To+15550100"))
+	if code := post("/api/webhooks/twilio?notification_id=n5", "application/x-www-form-urlencoded", stop.Encode(), map[string]string{"X-Twilio-Signature": base64.StdEncoding.EncodeToString(mac.Sum(nil))}); code != http.StatusOK {
+		t.Errorf("Twilio STOP callback returned %d", code)
+	}
+
+	receipt := `{"notification_id":"n2","message_id":"projects/p/messages/1","status":"failed","error":"UNREGISTERED"}`
+	mac = hmac.New(sha256.New, []byte("fcm-secret"))
+	mac.Write([]byte(receipt))
+	if code := post("/api/webhooks/fcm", "application/json", receipt, map[string]string{"X-FCM-Signature": "sha256=" + hex.EncodeToString(mac.Sum(nil))}); code != http.StatusOK {
+		t.Errorf("FCM receipt returned %d", code)
+	}
+	if code := post("/api/webhooks/fcm", "application/json", receipt, map[string]string{"X-FCM-Signature": "sha256=00"}); code != http.StatusUnauthorized {
+		t.Errorf("unsigned FCM receipt returned %d, want 401", code)
+	}
+
+	// A send recorded after its receipt does not hide the receipt
+	records.Sent("n2", channelPush, time.Now())
+
+	deliveries := func(id string) []deliveryRecord {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/notifications/"+id+"/deliveries", nil))
+		var resp struct {
+			Data []deliveryRecord `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.Data
+	}
+	n1 := deliveries("n1")
+	if len(n1) != 2 || n1[0].Channel != channelEmail || n1[0].Status != deliveryBounced || n1[0].ProviderID != "sg-1" || n1[0].Reason != "mailbox full" {
+		t.Errorf("n1 email delivery = %+v", n1)
+	}
+	if len(n1) == 2 && (n1[1].Status != deliveryDelivered || n1[1].ProviderID != "SM1") {
+		t.Errorf("n1 sms delivery = %+v", n1[1])
+	}
+	if n2 := deliveries("n2"); len(n2) != 1 || n2[0].Status != deliveryFailed || n2[0].Reason != "UNREGISTERED" {
+		t.Errorf("n2 deliveries = %+v", n2)
+	}
+
+	var suppressed []string
+	for _, entry := range suppressions.List("") {
+		suppressed = append(suppressed, entry.Channel+":"+entry.Address+":"+entry.Reason)
+	}
+	sort.Strings(suppressed)
+	if got := strings.Join(suppressed, ","); got != "email:angry@example.com:complaint,email:gone@example.com:bounce,sms:+15550100:complaint" {
+		t.Errorf("suppressed %s", got)
+	}
+
+	unconfigured := gin.New()
+	registerWebhookRoutes(unconfigured.Group("/api"), WebhookConfig{}, records, newSuppressionList())
+	for _, provider := range []string{providerSendGrid, providerTwilio, providerFCM} {
+		rec := httptest.NewRecorder()
+		unconfigured.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks/"+provider, strings.NewReader("{}")))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("unconfigured %s webhook returned %d, want 404", provider, rec.Code)
+		}
+	}
+}
+
+func TestDeliveryRecordsEvictOldest(t *testing.T) {
+	records := newDeliveryRecords()
+	for i := 0; i <= maxDeliveryRecords; i++ {
+		records.Sent(strconv.Itoa(i), channelEmail, time.Now())
+	}
+	if len(records.records) != maxDeliveryRecords || len(records.For("0")) != 0 || len(records.For("1")) != 1 {
+		t.Errorf("kept %d notifications, want the latest %d", len(records.records), maxDeliveryRecords)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"platform/pkg/logging"
+	"platform/pkg/reqctx"
+)
+
+// tokenExpiresHeader is set by the gateway to the Unix time the caller's token expires
+const tokenExpiresHeader = "X-Token-Expires"
+
+// webSocketWriteTimeout bounds a single write to a WebSocket client
+const webSocketWriteTimeout = 10 * time.Second
+
+// webSocketMessage is what the server sends over a WebSocket session
+type webSocketMessage struct {
+	Type string        `json:"type"`
+	Data *Notification `json:"data,omitempty"`
+}
+
+// newUpgrader accepts WebSocket handshakes from allowedOrigins, or only from the
+// service's own host when there are none
+func newUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	upgrader := &websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+	if len(allowedOrigins) > 0 {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				// Not a browser, so there is no cross-site request to guard against
+				return true
+			}
+			u, err := url.Parse(origin)
+			return err == nil && slices.Contains(allowedOrigins, u.Scheme+"://"+u.Host)
+		}
+	}
+	return upgrader
+}
+
+// registerWebSocketRoutes serves notification sessions over WebSocket alongside the event stream
+func registerWebSocketRoutes(api *gin.RouterGroup, shutdown context.Context, service *notificationService, upgrader *websocket.Upgrader) {
+	api.GET("/users/:user_id/notifications/ws", webSocketHandler(shutdown, service, upgrader))
+}
+
+// webSocketHandler sends a user's new notifications over a WebSocket session
+//
+// Each session is authenticated: the caller the gateway verified must be the
+// user whose notifications are sent, and the session is closed when the
+// caller's token expires so the client reconnects with a fresh one. A
+// reconnecting client passes last_event_id and first receives what it missed.
+func webSocketHandler(shutdown context.Context, service *notificationService, upgrader *websocket.Upgrader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID := c.Param("user_id")
+		if !authorizeSubscriber(c, userID) {
+			return
+		}
+		var expiry <-chan time.Time
+		if expires, err := strconv.ParseInt(c.GetHeader(tokenExpiresHeader), 10, 64); err == nil {
+			timer := time.NewTimer(time.Until(time.Unix(expires, 0)))
+			defer timer.Stop()
+			expiry = timer.C
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// The upgrader has already answered the handshake
+			return
+		}
+		defer conn.Close()
+
+		updates, cancel := service.hub.Subscribe(userID)
+		defer cancel()
+		disconnect := service.presence.Connect(userID, reqctx.Tenant(ctx), transportWebSocket)
+		defer disconnect()
+
+		closed := readWebSocket(conn)
+		send := func(notification Notification) error {
+			conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+			return conn.WriteJSON(webSocketMessage{Type: "notification", Data: &notification})
+		}
+		closeWith := func(code int, reason string) {
+			message := websocket.FormatCloseMessage(code, reason)
+			conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(webSocketWriteTimeout))
+		}
+
+		if lastID := c.Query("last_event_id"); lastID != "" {
+			for _, notification := range service.repo.After(userID, lastID) {
+				if send(notification) != nil {
+					return
+				}
+			}
+		}
+
+		ping := time.NewTicker(streamHeartbeat)
+		defer ping.Stop()
+		for {
+			select {
+			case notification, ok := <-updates:
+				if !ok {
+					// Fell too far behind; the client reconnects and replays
+					closeWith(websocket.CloseTryAgainLater, "too far behind")
+					return
+				}
+				if err := send(notification); err != nil {
+					logging.FromContext(ctx).Debug("websocket write failed", "error", err)
+					return
+				}
+			case <-ping.C:
+				if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketWriteTimeout)) != nil {
+					return
+				}
+			case <-expiry:
+				closeWith(websocket.ClosePolicyViolation, "token expired")
+				return
+			case <-closed:
+				return
+			case <-shutdown.Done():
+				closeWith(websocket.CloseGoingAway, "shutting down")
+				return
+			}
+		}
+	}
+}
+
+// readWebSocket reads conn until the client goes away, returning a channel closed then
+//
+// Clients only send control frames; anything else is discarded. A client
+// that stops answering pings is treated as gone.
+func readWebSocket(conn *websocket.Conn) <-chan struct{} {
+	closed := make(chan struct{})
+	conn.SetReadLimit(4096)
+	deadline := func() time.Time { return time.Now().Add(2 * streamHeartbeat) }
+	conn.SetReadDeadline(deadline())
+	conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(deadline()) })
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return closed
+}
+
+// isWebSocketUpgrade reports whether r asks to switch to the WebSocket protocol
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"platform/pkg/middleware"
+	"platform/pkg/reqctx"
+)
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebSocketSession(t *testing.T) {
+	service := testService(newNotificationStore(), newBroadcastStore(), systemClock{})
+	r := gin.New()
+	r.Use(middleware.Identity())
+	registerWebSocketRoutes(r.Group("/api"), context.Background(), service, newUpgrader(nil))
+	registerPresenceRoutes(r.Group("/admin"), service.presence)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/users/alice/notifications/ws"
+	dial := func(caller string) (*websocket.Conn, *http.Response, error) {
+		header := http.Header{}
+		if caller != "" {
+			header.Set(reqctx.UserIDHeader, caller)
+		}
+		return websocket.DefaultDialer.Dial(url, header)
+	}
+
+	for caller, want := range map[string]int{"": http.StatusUnauthorized, "bob": http.StatusForbidden} {
+		if _, resp, err := dial(caller); err == nil || resp == nil || resp.StatusCode != want {
+			t.Errorf("caller %q: dial error %v, want status %d", caller, err, want)
+		}
+	}
+
+	conn, _, err := dial("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "alice to be connected", func() bool { return service.presence.Connected("alice") })
+
+	service.hub.Publish(Notification{ID: "n1", UserID: "alice", Title: "Shipped"})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message webSocketMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Type != "notification" || message.Data == nil || message.Data.ID != "n1" {
+		t.Errorf("received %+v, want notification n1", message)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/presence/alice", nil))
+	var listed struct {
+		Data []presenceSession `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed.Data) != 1 || listed.Data[0].Transport != transportWebSocket || listed.Data[0].Replica != "test" {
+		t.Errorf("presence = %s, want one websocket session on replica test", w.Body)
+	}
+
+	conn.Close()
+	waitFor(t, "alice to disconnect", func() bool { return !service.presence.Connected("alice") })
+}
+
+func TestStreamRequiresTheUser(t *testing.T) {
+	service := testService(newNotificationStore(), newBroadcastStore(), systemClock{})
+	// A cancelled shutdown ends accepted streams as soon as they start
+	shutdown, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := gin.New()
+	r.Use(middleware.Identity())
+	r.GET("/api/users/:user_id/notifications/stream", streamHandler(shutdown, service.hub, service.presence, service.repo))
+
+	for _, tc := range []struct {
+		caller string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		// Someone else's stream would also hold back the user's pushes
+		{"bob", http.StatusForbidden},
+		{"alice", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/alice/notifications/stream", nil)
+		if tc.caller != "" {
+			req.Header.Set(reqctx.UserIDHeader, tc.caller)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("caller %q: stream returned %d, want %d", tc.caller, w.Code, tc.want)
+		}
+	}
+	if service.presence.Connected("alice") {
+		t.Error("alice still connected after the stream ended")
+	}
+}
+
+func TestPushSkippedWhileConnected(t *testing.T) {
+	presence := newPresenceRegistry("test", true)
+	dispatcher := mockDispatcher(t, MockProviderConfig{}, newDeliveryRecords(), newSuppressionList())
+	dispatcher.SetPresence(presence)
+	skipped := func() float64 {
+		return testutil.ToFloat64(deliveriesTotal.WithLabelValues(channelPush, "skipped_connected"))
+	}
+	before := skipped()
+
+	disconnect := presence.Connect("alice", "", transportSSE)
+	dispatcher.Enqueue(Notification{ID: "1", UserID: "alice", Type: "order_status"}, []string{channelEmail, channelPush})
+	drain(t, dispatcher)
+	if got := skipped() - before; got != 1 {
+		t.Errorf("skipped %v pushes while connected, want 1", got)
+	}
+
+	// Once disconnected, or with the policy off, pushes go out again
+	disconnect()
+	dispatcher.Enqueue(Notification{ID: "2", UserID: "alice", Type: "order_status"}, []string{channelPush})
+	drain(t, dispatcher)
+	defer presence.Connect("alice", "", transportWebSocket)()
+	presence.SetSkipPush(false)
+	dispatcher.Enqueue(Notification{ID: "3", UserID: "alice", Type: "order_status"}, []string{channelPush})
+	drain(t, dispatcher)
+	if got := skipped() - before; got != 1 {
+		t.Errorf("skipped %v pushes in total, want 1", got)
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"notification-service/internal/batch"
+	"notification-service/internal/spool"
+)
+
+// spoolReplayInterval is how often spooled batches are retried while the store is down
+const spoolReplayInterval = time.Second
+
+var (
+	writeFlushesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_write_flushes_total",
+			Help: "Total number of batched notification writes by outcome",
+		},
+		[]string{"outcome"},
+	)
+
+	writeBatchSize = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "notification_write_batch_size",
+			Help:    "Number of notifications written per batch",
+			Buckets: []float64{1, 10, 50, 100, 250, 500, 1000, 2500},
+		},
+	)
+
+	writeFlushDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "notification_write_flush_duration_seconds",
+			Help:    "Time taken to write a batch of notifications",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+
+	writeSpoolTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_write_spool_batches_total",
+			Help: "Total number of notification batches spooled to disk after a failed write, replayed from it, or failing to spool",
+		},
+		[]string{"outcome"},
+	)
+
+	writeSpoolBacklog = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "notification_write_spool_backlog",
+			Help: "Notifications spooled to disk and not yet written to the store",
+		},
+	)
+
+	writeSpoolLagSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "notification_write_spool_lag_seconds",
+			Help: "Age of the oldest spooled batch, or 0 when the spool is empty",
+		},
+	)
+
+	deliveryLogFlushesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "delivery_log_flushes_total",
+			Help: "Total number of batched delivery log appends by outcome",
+		},
+		[]string{"outcome"},
+	)
+
+	deliveryLogBatchSize = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "delivery_log_batch_size",
+			Help:    "Number of sends appended to the delivery log per batch",
+			Buckets: []float64{1, 10, 50, 100, 250, 500, 1000, 2500},
+		},
+	)
+)
+
+// errWriteBufferFull is returned when a create waited too long for buffer space
+var errWriteBufferFull = errors.New("write buffer is full")
+
+// batchStore is a Repository whose batch writes can fail, such as one backed
+// by a database
+type batchStore interface {
+	WriteBatch(ctx context.Context, notifications []Notification) error
+}
+
+// notificationWriter saves new notifications and then announces them to open streams
+//
+// With write-behind enabled, saves are buffered and written in batches, so a
+// notification may be missing from reads for up to the flush interval.
+//
+// With a spool, a batch the store fails to write goes to a queue on local
+// disk, and so does every later batch until the spool has drained, which
+// keeps notifications in order. Replay writes the spooled batches back once
+// the store recovers and announces them only then. Without a spool a failed
+// batch is retried in memory, holding up later ones until the buffer fills.
+type notificationWriter struct {
+	store   Repository
+	hub     *notificationHub
+	batch   *batch.Writer[Notification]
+	maxWait time.Duration
+	size    int
+	spool   atomic.Pointer[spool.Queue[Notification]]
+	// onSaved, if set, is called for every notification accepted for writing
+	onSaved atomic.Pointer[func(notification Notification)]
+}
+
+func newNotificationWriter(cfg WriteBehindConfig, store Repository, hub *notificationHub) *notificationWriter {
+	w := &notificationWriter{store: store, hub: hub, maxWait: cfg.MaxWait, size: cfg.BufferSize}
+	if !cfg.Enabled {
+		return w
+	}
+
+	w.batch = batch.New(batch.Options{
+		MaxSize:  cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+		Buffer:   cfg.BufferSize,
+		OnFlush: func(size int, duration time.Duration, err error) {
+			if err != nil {
+				writeFlushesTotal.WithLabelValues("error").Inc()
+				return
+			}
+			writeFlushesTotal.WithLabelValues("success").Inc()
+			writeBatchSize.Observe(float64(size))
+			writeFlushDuration.Observe(duration.Seconds())
+		},
+	}, w.flush)
+	return w
+}
+
+// OpenSpool keeps batches the store fails to write in dir, picking up those
+// a previous process left there; call it before Replay
+func (w *notificationWriter) OpenSpool(dir string) error {
+	queue, err := spool.Open[Notification](dir)
+	if err != nil {
+		return err
+	}
+	w.spool.Store(queue)
+	w.observeSpool(queue)
+	return nil
+}
+
+// flush writes a batch, or spools it while the store is failing or earlier batches are still spooled
+func (w *notificationWriter) flush(ctx context.Context, notifications []Notification) error {
+	queue := w.spool.Load()
+	if queue == nil {
+		return w.write(ctx, notifications)
+	}
+	if queue.Len() == 0 {
+		err := w.write(ctx, notifications)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("writing notifications failed, spooling them to disk", "notifications", len(notifications), "error", err)
+	}
+	if err := queue.Push(notifications, time.Now()); err != nil {
+		// Retried in memory by the batch writer
+		writeSpoolTotal.WithLabelValues("failed").Inc()
+		return err
+	}
+	writeSpoolTotal.WithLabelValues("spooled").Inc()
+	w.observeSpool(queue)
+	return nil
+}
+
+// write stores a batch and announces it to open streams
+func (w *notificationWriter) write(ctx context.Context, notifications []Notification) error {
+	if store, ok := w.store.(batchStore); ok {
+		if err := store.WriteBatch(ctx, notifications); err != nil {
+			return err
+		}
+	} else {
+		w.store.AddBatch(notifications)
+	}
+	for _, notification := range notifications {
+		w.hub.Publish(notification)
+	}
+	return nil
+}
+
+// Replay writes spooled batches to the store, oldest first, until ctx is cancelled
+//
+// A failed write is retried every spoolReplayInterval; batches left at
+// shutdown stay on disk for the next start.
+func (w *notificationWriter) Replay(ctx context.Context) {
+	queue := w.spool.Load()
+	if queue == nil {
+		return
+	}
+	for {
+		w.replay(ctx, queue)
+		if !sleepCtx(ctx, spoolReplayInterval) {
+			return
+		}
+	}
+}
+
+// replay writes spooled batches until the spool is empty or a write fails
+func (w *notificationWriter) replay(ctx context.Context, queue *spool.Queue[Notification]) {
+	defer w.observeSpool(queue)
+	for ctx.Err() == nil {
+		spooled, ok, err := queue.Peek()
+		if err != nil {
+			slog.Error("reading spooled notifications failed", "error", err)
+			return
+		}
+		if !ok {
+			return
+		}
+		if err := w.write(ctx, spooled.Items); err != nil {
+			return
+		}
+		if err := queue.Remove(spooled.Seq); err != nil {
+			// The store must tolerate the batch being written again on the next replay
+			slog.Error("removing replayed notifications from the spool failed", "error", err)
+			return
+		}
+		writeSpoolTotal.WithLabelValues("replayed").Inc()
+		w.observeSpool(queue)
+	}
+}
+
+// observeSpool exports how far behind the spool is
+func (w *notificationWriter) observeSpool(queue *spool.Queue[Notification]) {
+	lag := 0.0
+	if oldest, ok := queue.Oldest(); ok {
+		lag = time.Since(oldest).Seconds()
+	}
+	writeSpoolLagSeconds.Set(lag)
+	writeSpoolBacklog.Set(float64(queue.Items()))
+}
+
+// OnSaved registers fn to be called for every notification accepted for writing
+func (w *notificationWriter) OnSaved(fn func(notification Notification)) {
+	w.onSaved.Store(&fn)
+}
+
+// Save writes notification, waiting at most maxWait for room in a full buffer
+func (w *notificationWriter) Save(ctx context.Context, notification Notification) error {
+	if w.batch == nil {
+		w.store.Add(notification)
+		w.hub.Publish(notification)
+		w.saved(notification)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.maxWait)
+	defer cancel()
+	err := w.batch.Add(ctx, notification)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errWriteBufferFull
+	}
+	if err == nil {
+		w.saved(notification)
+	}
+	return err
+}
+
+func (w *notificationWriter) saved(notification Notification) {
+	if onSaved := w.onSaved.Load(); onSaved != nil {
+		(*onSaved)(notification)
+	}
+}
+
+// Buffered returns the number of notifications waiting to be written
+func (w *notificationWriter) Buffered() int {
+	if w.batch == nil {
+		return 0
+	}
+	return w.batch.Len()
+}
+
+// Saturation returns how full the buffer is, from 0 to 1; always 0 without write-behind
+func (w *notificationWriter) Saturation() float64 {
+	if w.batch == nil {
+		return 0
+	}
+	return float64(w.batch.Len()) / float64(w.size)
+}
+
+// Close writes out buffered notifications; it runs as a shutdown drain step
+func (w *notificationWriter) Close(ctx context.Context) error {
+	if w.batch == nil {
+		return nil
+	}
+	return w.batch.Close(ctx)
+}
+
+// deliverySend is a delivery log append: the provider for Channel accepted NotificationID at At
+type deliverySend struct {
+	NotificationID string
+	Channel        string
+	At             time.Time
+}
+
+// deliveryLog appends every accepted send to the delivery records
+//
+// With write-behind enabled the appends are batched like notification
+// writes. A send that finds the buffer full for longer than max_wait is
+// appended directly rather than lost, so a burst slows the delivery
+// workers down without dropping records. Provider receipts are far fewer
+// and are written as they arrive.
+type deliveryLog struct {
+	records *deliveryRecords
+	batch   *batch.Writer[deliverySend]
+	maxWait time.Duration
+}
+
+func newDeliveryLog(cfg WriteBehindConfig, records *deliveryRecords) *deliveryLog {
+	l := &deliveryLog{records: records, maxWait: cfg.MaxWait}
+	if !cfg.Enabled {
+		return l
+	}
+
+	l.batch = batch.New(batch.Options{
+		MaxSize:  cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+		Buffer:   cfg.BufferSize,
+		OnFlush: func(size int, _ time.Duration, err error) {
+			if err != nil {
+				deliveryLogFlushesTotal.WithLabelValues("error").Inc()
+				return
+			}
+			deliveryLogFlushesTotal.WithLabelValues("success").Inc()
+			deliveryLogBatchSize.Observe(float64(size))
+		},
+	}, func(_ context.Context, sends []deliverySend) error {
+		records.SentBatch(sends)
+		return nil
+	})
+	return l
+}
+
+// Sent appends that the provider for channel accepted notificationID
+func (l *deliveryLog) Sent(notificationID, channel string, at time.Time) {
+	if l.batch != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), l.maxWait)
+		defer cancel()
+		if l.batch.Add(ctx, deliverySend{NotificationID: notificationID, Channel: channel, At: at}) == nil {
+			return
+		}
+		deliveryLogFlushesTotal.WithLabelValues("direct").Inc()
+	}
+	l.records.Sent(notificationID, channel, at)
+}
+
+// Close appends buffered sends; it runs as a shutdown drain step after the send queue has drained
+func (l *deliveryLog) Close(ctx context.Context) error {
+	if l.batch == nil {
+		return nil
+	}
+	return l.batch.Close(ctx)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotificationWriterSpoolsFailedBatches(t *testing.T) {
+	dir := t.TempDir()
+	cfg := WriteBehindConfig{Enabled: true, BatchSize: 2, FlushInterval: time.Millisecond, BufferSize: 10, MaxWait: time.Second}
+	store := newNotificationStore()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	writer := newNotificationWriter(cfg, store, newNotificationHub())
+	if err := writer.OpenSpool(dir); err != nil {
+		t.Fatal(err)
+	}
+	// A flush abandoned at shutdown fails to write, so its batch is spooled rather than dropped
+	abandoned, abandon := context.WithCancel(ctx)
+	abandon()
+	if err := writer.flush(abandoned, []Notification{testNotification("1", "user-1"), testNotification("2", "user-1")}); err != nil {
+		t.Fatal(err)
+	}
+	// Later batches queue behind it on disk, keeping notifications in order
+	for i := 3; i <= 5; i++ {
+		if err := writer.Save(ctx, testNotification(strconv.Itoa(i), "user-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 0 {
+		t.Errorf("%d notifications written while earlier ones were spooled", store.Len())
+	}
+	if got := writer.spool.Load().Items(); got != 5 {
+		t.Errorf("%d notifications spooled, want 5", got)
+	}
+
+	// The next process replays them ahead of its own writes
+	next := newNotificationWriter(cfg, store, newNotificationHub())
+	if err := next.OpenSpool(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := next.Save(ctx, testNotification("6", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	go next.Replay(ctx)
+	for store.Len() < 6 || next.spool.Load().Items() != 0 {
+		if ctx.Err() != nil {
+			t.Fatalf("%d of 6 notifications written after the replay", store.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := ids(store.List()); got != "1,2,3,4,5,6" {
+		t.Errorf("notifications written as %s, want in the order they were saved", got)
+	}
+	if _, ok := next.spool.Load().Oldest(); ok {
+		t.Error("spool still has batches after the replay")
+	}
+	next.Close(ctx)
+}
+
+func TestDeliveryLog(t *testing.T) {
+	records := newDeliveryRecords()
+	log := newDeliveryLog(WriteBehindConfig{Enabled: true, BatchSize: 10, FlushInterval: time.Hour, BufferSize: 10, MaxWait: time.Millisecond}, records)
+
+	for i := 0; i < 3; i++ {
+		log.Sent("n1", []string{channelEmail, channelSMS, channelPush}[i], time.Now())
+	}
+	if got := records.For("n1"); len(got) != 0 {
+		t.Errorf("%d sends appended before the flush, want them buffered", len(got))
+	}
+	// A receipt that arrived first is not overwritten by the buffered send
+	records.Update("n2", deliveryRecord{Channel: channelEmail, Status: deliveryDelivered})
+	log.Sent("n2", channelEmail, time.Now())
+
+	if err := log.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := records.For("n1"); len(got) != 3 || got[0].Status != deliverySent {
+		t.Errorf("n1 records after the flush = %+v", got)
+	}
+	if got := records.For("n2"); len(got) != 1 || got[0].Status != deliveryDelivered {
+		t.Errorf("n2 records = %+v, want the receipt kept", got)
+	}
+
+	// Once closed, sends are appended directly instead of being lost
+	log.Sent("n3", channelEmail, time.Now())
+	if got := records.For("n3"); len(got) != 1 {
+		t.Errorf("send after close left %d records, want 1", len(got))
+	}
+}
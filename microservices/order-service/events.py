@@ -0,0 +1,74 @@
+"""Publishes order state changes to Kafka for downstream consumers."""
+import json
+import logging
+import os
+import uuid
+from datetime import datetime, timezone
+
+from aiokafka import AIOKafkaProducer
+
+logger = logging.getLogger("order-service.events")
+
+# Order statuses that other services react to
+STATUS_EVENTS = {
+    "processing": "order.confirmed",
+    "shipped": "order.shipped",
+    "delivered": "order.delivered",
+}
+
+
+class OrderEventPublisher:
+    """Publishes order events when KAFKA_BROKERS is set, otherwise does nothing."""
+
+    def __init__(self):
+        self.brokers = os.getenv("KAFKA_BROKERS", "")
+        self.topic = os.getenv("ORDER_EVENTS_TOPIC", "order-events")
+        self.producer = None
+
+    async def start(self):
+        if not self.brokers:
+            return
+        self.producer = AIOKafkaProducer(
+            bootstrap_servers=self.brokers.split(","),
+            acks="all",
+            enable_idempotence=True,
+        )
+        await self.producer.start()
+
+    async def stop(self):
+        if self.producer:
+            await self.producer.stop()
+
+    async def publish_status_change(self, order, tenant_id=None, correlation_id=None):
+        event_type = STATUS_EVENTS.get(order["status"])
+        if not event_type or not self.producer:
+            return
+
+        event = {
+            "id": str(uuid.uuid4()),
+            "type": event_type,
+            "user_id": order["user_id"],
+            "tenant_id": tenant_id,
+            "occurred_at": datetime.now(timezone.utc).isoformat(),
+            "data": {
+                "order_id": order["id"],
+                "total_amount": order["total_amount"],
+                "shipping_address": order["shipping_address"],
+            },
+        }
+        # The request's correlation ID travels in the headers, as it does between services over HTTP
+        headers = []
+        if correlation_id:
+            headers.append(("X-Correlation-ID", correlation_id.encode()))
+        if tenant_id:
+            headers.append(("X-Tenant-ID", tenant_id.encode()))
+        # Keyed by order so every event for an order lands on the same partition, in order
+        try:
+            await self.producer.send_and_wait(
+                self.topic,
+                json.dumps(event).encode(),
+                key=order["id"].encode(),
+                headers=headers,
+            )
+        except Exception:
+            logger.exception("failed to publish %s for order %s", event_type, order["id"])
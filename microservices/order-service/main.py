@@ -1,4 +1,4 @@
-from fastapi import FastAPI, HTTPException, Depends
+from fastapi import FastAPI, HTTPException, Depends, Header
 from fastapi.middleware.cors import CORSMiddleware
 from fastapi.middleware.trustedhost import TrustedHostMiddleware
 from pydantic import BaseModel
@@ -11,6 +11,8 @@ from prometheus_client import Counter, Histogram, generate_latest, CONTENT_TYPE_
 from starlette.requests import Request
 from starlette.responses import Response
 
+from events import OrderEventPublisher
+
 # FastAPI app
 app = FastAPI(
     title="Order Service",
@@ -18,6 +20,17 @@ app = FastAPI(
     version="1.0.0"
 )
 
+# Order events for the notification service
+events = OrderEventPublisher()
+
+@app.on_event("startup")
+async def start_events():
+    await events.start()
+
+@app.on_event("shutdown")
+async def stop_events():
+    await events.stop()
+
 # Middleware
 app.add_middleware(
     CORSMiddleware,
@@ -175,7 +188,13 @@ async def create_order(order_data: OrderCreate):
 
 # Update order status
 @app.patch("/api/orders/{order_id}")
-async def update_order_status(order_id: str, status: str):
+async def update_order_status(
+    order_id: str,
+    status: str,
+    x_tenant_id: Optional[str] = Header(None),
+    x_correlation_id: Optional[str] = Header(None),
+    x_request_id: Optional[str] = Header(None),
+):
     try:
         order = next((o for o in orders if o["id"] == order_id), None)
         if not order:
@@ -185,8 +204,12 @@ async def update_order_status(order_id: str, status: str):
         if status not in valid_statuses:
             raise HTTPException(status_code=400, detail="Invalid status")
         
+        changed = order["status"] != status
         order["status"] = status
         order["updated_at"] = datetime.now()
+
+        if changed:
+            await events.publish_status_change(order, x_tenant_id, x_request_id or x_correlation_id)
         
         return {"success": True, "data": order}
     except HTTPException:
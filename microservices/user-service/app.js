@@ -35,10 +35,67 @@ let users = [
     id: '1',
     name: 'John Doe',
     email: 'john@example.com',
+    phone: '+48500100200',
+    locale: 'en-US',
+    timezone: 'Europe/Warsaw',
+    plan: 'free',
+    deviceTokens: [],
+    optOuts: [],
+    categoryOptOuts: [],
     createdAt: new Date().toISOString()
   }
 ];
 
+const EMAIL_PATTERN = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
+const PHONE_PATTERN = /^\+[1-9]\d{6,14}$/; // E.164
+const DEVICE_PLATFORMS = ['ios', 'android', 'web'];
+const CHANNELS = ['email', 'sms', 'push'];
+const CATEGORIES = ['orders', 'payments', 'promotions', 'security', 'system'];
+const PLANS = ['free', 'pro', 'enterprise'];
+
+const isValidTimezone = (timezone) => {
+  try {
+    new Intl.DateTimeFormat('en-US', { timeZone: timezone });
+    return true;
+  } catch (error) {
+    return false;
+  }
+};
+
+const isValidLocale = (locale) => {
+  try {
+    return Intl.getCanonicalLocales(locale).length === 1;
+  } catch (error) {
+    return false;
+  }
+};
+
+// Validate profile fields; returns an error message or null
+const validateProfile = ({ email, phone, locale, timezone, plan, optOuts, categoryOptOuts }) => {
+  if (email !== undefined && !EMAIL_PATTERN.test(email)) {
+    return 'Invalid email address';
+  }
+  if (phone !== undefined && phone !== null && !PHONE_PATTERN.test(phone)) {
+    return 'Phone must be in E.164 format, e.g. +48500100200';
+  }
+  if (locale !== undefined && !isValidLocale(locale)) {
+    return 'Invalid locale';
+  }
+  if (timezone !== undefined && !isValidTimezone(timezone)) {
+    return 'Invalid timezone';
+  }
+  if (plan !== undefined && !PLANS.includes(plan)) {
+    return `Plan must be one of ${PLANS.join(', ')}`;
+  }
+  if (optOuts !== undefined && (!Array.isArray(optOuts) || !optOuts.every(c => CHANNELS.includes(c)))) {
+    return `Opt-outs must be a list of channels (${CHANNELS.join(', ')})`;
+  }
+  if (categoryOptOuts !== undefined && (!Array.isArray(categoryOptOuts) || !categoryOptOuts.every(c => CATEGORIES.includes(c)))) {
+    return `Category opt-outs must be a list of categories (${CATEGORIES.join(', ')})`;
+  }
+  return null;
+};
+
 // Middleware for metrics
 app.use((req, res, next) => {
   const start = Date.now();
@@ -120,7 +177,7 @@ app.get('/api/users/:id', (req, res) => {
 // Create new user
 app.post('/api/users', (req, res) => {
   try {
-    const { name, email } = req.body;
+    const { name, email, phone, locale, timezone, plan, optOuts, categoryOptOuts } = req.body;
     
     if (!name || !email) {
       return res.status(400).json({
@@ -129,10 +186,32 @@ app.post('/api/users', (req, res) => {
       });
     }
 
+    const validationError = validateProfile({ email, phone, locale, timezone, plan, optOuts, categoryOptOuts });
+    if (validationError) {
+      return res.status(400).json({
+        success: false,
+        error: validationError
+      });
+    }
+
+    if (users.some(u => u.email.toLowerCase() === email.toLowerCase())) {
+      return res.status(409).json({
+        success: false,
+        error: 'Email is already registered'
+      });
+    }
+
     const newUser = {
       id: uuidv4(),
       name,
       email,
+      phone: phone || null,
+      locale: locale || 'en-US',
+      timezone: timezone || 'UTC',
+      plan: plan || 'free',
+      deviceTokens: [],
+      optOuts: optOuts || [],
+      categoryOptOuts: categoryOptOuts || [],
       createdAt: new Date().toISOString()
     };
 
@@ -153,7 +232,7 @@ app.post('/api/users', (req, res) => {
 // Update user
 app.put('/api/users/:id', (req, res) => {
   try {
-    const { name, email } = req.body;
+    const { name, email, phone, locale, timezone, plan, optOuts, categoryOptOuts } = req.body;
     const userIndex = users.findIndex(u => u.id === req.params.id);
     
     if (userIndex === -1) {
@@ -163,10 +242,24 @@ app.put('/api/users/:id', (req, res) => {
       });
     }
 
+    const validationError = validateProfile({ email, phone, locale, timezone, plan, optOuts, categoryOptOuts });
+    if (validationError) {
+      return res.status(400).json({
+        success: false,
+        error: validationError
+      });
+    }
+
     users[userIndex] = {
       ...users[userIndex],
       name: name || users[userIndex].name,
       email: email || users[userIndex].email,
+      phone: phone !== undefined ? phone : users[userIndex].phone,
+      locale: locale || users[userIndex].locale,
+      timezone: timezone || users[userIndex].timezone,
+      plan: plan || users[userIndex].plan,
+      optOuts: optOuts || users[userIndex].optOuts,
+      categoryOptOuts: categoryOptOuts || users[userIndex].categoryOptOuts,
       updatedAt: new Date().toISOString()
     };
 
@@ -208,6 +301,108 @@ app.delete('/api/users/:id', (req, res) => {
   }
 });
 
+// Get delivery targets for a user (used by the notification service)
+app.get('/api/users/:id/contact', (req, res) => {
+  try {
+    const user = users.find(u => u.id === req.params.id);
+    if (!user) {
+      return res.status(404).json({
+        success: false,
+        error: 'User not found'
+      });
+    }
+    res.json({
+      success: true,
+      data: {
+        userId: user.id,
+        name: user.name,
+        email: user.email,
+        phone: user.phone,
+        deviceTokens: user.deviceTokens.map(d => d.token),
+        locale: user.locale,
+        timezone: user.timezone,
+        optOuts: user.optOuts,
+        categoryOptOuts: user.categoryOptOuts
+      }
+    });
+  } catch (error) {
+    res.status(500).json({
+      success: false,
+      error: 'Internal server error'
+    });
+  }
+});
+
+// Register a push device token
+app.post('/api/users/:id/devices', (req, res) => {
+  try {
+    const { token, platform } = req.body;
+    const user = users.find(u => u.id === req.params.id);
+
+    if (!user) {
+      return res.status(404).json({
+        success: false,
+        error: 'User not found'
+      });
+    }
+
+    if (!token || !DEVICE_PLATFORMS.includes(platform)) {
+      return res.status(400).json({
+        success: false,
+        error: `Token and platform (${DEVICE_PLATFORMS.join(', ')}) are required`
+      });
+    }
+
+    // Re-registering a token only refreshes it
+    user.deviceTokens = user.deviceTokens.filter(d => d.token !== token);
+    const device = { token, platform, createdAt: new Date().toISOString() };
+    user.deviceTokens.push(device);
+
+    res.status(201).json({
+      success: true,
+      data: device
+    });
+  } catch (error) {
+    res.status(500).json({
+      success: false,
+      error: 'Internal server error'
+    });
+  }
+});
+
+// Remove a push device token
+app.delete('/api/users/:id/devices/:token', (req, res) => {
+  try {
+    const user = users.find(u => u.id === req.params.id);
+    if (!user) {
+      return res.status(404).json({
+        success: false,
+        error: 'User not found'
+      });
+    }
+
+    const deviceIndex = user.deviceTokens.findIndex(d => d.token === req.params.token);
+    if (deviceIndex === -1) {
+      return res.status(404).json({
+        success: false,
+        error: 'Device not found'
+      });
+    }
+
+    const deletedDevice = user.deviceTokens.splice(deviceIndex, 1)[0];
+
+    res.json({
+      success: true,
+      data: deletedDevice
+    });
+  } catch (error) {
+    res.status(500).json({
+      success: false,
+      error: 'Internal server error'
+    });
+  }
+});
+
 // Error handling middleware
 app.use((err, req, res, next) => {
   console.error(err.stack);
@@ -0,0 +1,222 @@
+// Package health runs dependency checks for liveness, startup and
+// readiness probes.
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DependencyUp reports the result of the last probe of each dependency
+var DependencyUp = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "dependency_up",
+		Help: "Whether the last readiness probe of a dependency succeeded (1) or failed (0)",
+	},
+	[]string{"dependency", "critical"},
+)
+
+// Overall statuses reported by Registry.Run
+const (
+	StatusReady    = "ready"
+	StatusDegraded = "degraded"
+	StatusNotReady = "not_ready"
+)
+
+// Check probes a single dependency
+type Check struct {
+	Name string
+	// Critical dependencies take the pod out of rotation when they fail;
+	// the others only mark readiness as degraded.
+	Critical bool
+	Timeout  time.Duration
+	Probe    func(ctx context.Context) error
+}
+
+// Result is the outcome of a single Check run
+type Result struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Registry runs the registered dependency checks for the readiness probe
+type Registry struct {
+	mu       sync.RWMutex
+	checks   []Check
+	draining atomic.Bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a dependency check
+func (r *Registry) Register(check Check) {
+	if check.Timeout <= 0 {
+		check.Timeout = 2 * time.Second
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check)
+}
+
+// SetDraining permanently fails readiness so the pod leaves the Service endpoints
+func (r *Registry) SetDraining() {
+	r.draining.Store(true)
+}
+
+// Draining reports whether shutdown has begun
+func (r *Registry) Draining() bool {
+	return r.draining.Load()
+}
+
+// Run probes every dependency concurrently and reports the overall status:
+// "ready", "degraded" (a soft dependency is down) or "not_ready".
+func (r *Registry) Run(ctx context.Context) (string, map[string]Result) {
+	r.mu.RLock()
+	checks := append([]Check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make(map[string]Result, len(checks))
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	status := StatusReady
+	for _, result := range results {
+		if result.Status == "up" {
+			continue
+		}
+		if result.Critical {
+			return StatusNotReady, results
+		}
+		status = StatusDegraded
+	}
+	return status, results
+}
+
+func runCheck(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Probe(ctx)
+	result := Result{
+		Status:    "up",
+		Critical:  check.Critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+
+	critical := "false"
+	if check.Critical {
+		critical = "true"
+	}
+	if err != nil {
+		result.Status = "down"
+		result.Error = err.Error()
+		DependencyUp.WithLabelValues(check.Name, critical).Set(0)
+	} else {
+		DependencyUp.WithLabelValues(check.Name, critical).Set(1)
+	}
+	return result
+}
+
+// TCPProbe checks that addr accepts TCP connections
+func TCPProbe(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// CriticalProbe succeeds once no critical dependency in r is down, e.g. for a warmup phase
+func CriticalProbe(r *Registry) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		status, results := r.Run(ctx)
+		if status != StatusNotReady {
+			return nil
+		}
+		var errs []error
+		for name, result := range results {
+			if result.Critical && result.Status != "up" {
+				errs = append(errs, errors.New(name+": "+result.Error))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// LivenessHandler reports that the process is up; it never touches dependencies
+func LivenessHandler(service, version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":    "healthy",
+			"service":   service,
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   version,
+		})
+	}
+}
+
+// ReadinessHandler reports per-dependency status for the readiness probe
+//
+// The probe fails while draining, and while started (if set) reports false.
+func ReadinessHandler(r *Registry, service string, started func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if r.Draining() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":  "shutting_down",
+				"service": service,
+			})
+			return
+		}
+		if started != nil && !started() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":  "starting",
+				"service": service,
+			})
+			return
+		}
+
+		status, checks := r.Run(c.Request.Context())
+
+		code := http.StatusOK
+		if status == StatusNotReady {
+			code = http.StatusServiceUnavailable
+		}
+
+		c.JSON(code, gin.H{
+			"status":  status,
+			"service": service,
+			"checks":  checks,
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func probe(err error) func(context.Context) error {
+	return func(context.Context) error { return err }
+}
+
+func TestRegistryRun(t *testing.T) {
+	down := errors.New("connection refused")
+	for _, tc := range []struct {
+		name   string
+		checks []Check
+		want   string
+	}{
+		{"no checks", nil, StatusReady},
+		{"all up", []Check{{Name: "db", Critical: true, Probe: probe(nil)}, {Name: "cache", Probe: probe(nil)}}, StatusReady},
+		{"soft down", []Check{{Name: "db", Critical: true, Probe: probe(nil)}, {Name: "cache", Probe: probe(down)}}, StatusDegraded},
+		{"critical down", []Check{{Name: "db", Critical: true, Probe: probe(down)}, {Name: "cache", Probe: probe(nil)}}, StatusNotReady},
+		{"critical timeout", []Check{{Name: "db", Critical: true, Timeout: time.Millisecond, Probe: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}}, StatusNotReady},
+	} {
+		r := NewRegistry()
+		for _, check := range tc.checks {
+			r.Register(check)
+		}
+		status, results := r.Run(context.Background())
+		if status != tc.want || len(results) != len(tc.checks) {
+			t.Errorf("%s: status %s with %d results, want %s", tc.name, status, len(results), tc.want)
+		}
+	}
+
+	r := NewRegistry()
+	r.Register(Check{Name: "db", Critical: true, Probe: probe(down)})
+	if err := CriticalProbe(r)(context.Background()); err == nil {
+		t.Error("critical probe passed with a critical dependency down")
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		name     string
+		check    error
+		started  bool
+		draining bool
+		want     int
+	}{
+		{"ready", nil, true, false, http.StatusOK},
+		{"not ready", errors.New("down"), true, false, http.StatusServiceUnavailable},
+		{"starting", nil, false, false, http.StatusServiceUnavailable},
+		{"draining", nil, true, true, http.StatusServiceUnavailable},
+	} {
+		probes := NewRegistry()
+		probes.Register(Check{Name: "db", Critical: true, Probe: probe(tc.check)})
+		if tc.draining {
+			probes.SetDraining()
+		}
+		r := gin.New()
+		started := tc.started
+		r.GET("/ready", ReadinessHandler(probes, "test", func() bool { return started }))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
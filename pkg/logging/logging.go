@@ -0,0 +1,88 @@
+// Package logging builds the JSON logger shared by the platform services
+// and carries request-scoped loggers through a context.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type loggerKey struct{}
+
+// Level holds the active log level so it can be changed at runtime
+var Level = new(slog.LevelVar)
+
+// New builds the JSON logger used for all output of service
+func New(service string) *slog.Logger {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: Level})
+	return slog.New(handler).With("service", service)
+}
+
+// SetLevel changes the active log level, ignoring unknown levels
+func SetLevel(level string) {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err == nil {
+		Level.Set(parsed)
+	}
+}
+
+// FromContext returns the request-scoped logger stored in ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// NewContext returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// RegisterLevelRoutes exposes the active log level for inspection and runtime changes at /log-level
+//
+// Anyone who can change the level can flood the logs, so r should be a
+// group behind the service's admin authentication.
+func RegisterLevelRoutes(r gin.IRoutes) {
+	r.GET("/log-level", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"level":   strings.ToLower(Level.Level().String()),
+		})
+	})
+
+	r.PUT("/log-level", func(c *gin.Context) {
+		var req struct {
+			Level string `json:"level" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request data",
+			})
+			return
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Unknown log level",
+			})
+			return
+		}
+
+		Level.Set(level)
+		FromContext(c.Request.Context()).Info("log level changed", "level", level.String())
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"level":   strings.ToLower(level.String()),
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetLevel(t *testing.T) {
+	defer Level.Set(slog.LevelInfo)
+	for _, tc := range []struct {
+		level string
+		want  slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{"WARN", slog.LevelWarn},
+		{"error", slog.LevelError},
+		// Unknown levels leave the active one alone
+		{"verbose", slog.LevelError},
+		{"info", slog.LevelInfo},
+	} {
+		SetLevel(tc.level)
+		if got := Level.Level(); got != tc.want {
+			t.Errorf("after SetLevel(%q) level = %s, want %s", tc.level, got, tc.want)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("a context without a logger did not return the default logger")
+	}
+	logger := slog.Default().With("request_id", "req-1")
+	if FromContext(NewContext(context.Background(), logger)) != logger {
+		t.Error("the logger stored in the context was not returned")
+	}
+}
+
+func TestLevelRoutes(t *testing.T) {
+	defer Level.Set(slog.LevelInfo)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterLevelRoutes(r.Group("/api/admin"))
+
+	for _, tc := range []struct {
+		method string
+		body   string
+		want   int
+		level  slog.Level
+	}{
+		{http.MethodPut, `{"level":"debug"}`, http.StatusOK, slog.LevelDebug},
+		{http.MethodGet, ``, http.StatusOK, slog.LevelDebug},
+		{http.MethodPut, `{"level":"loud"}`, http.StatusBadRequest, slog.LevelDebug},
+		{http.MethodPut, `{}`, http.StatusBadRequest, slog.LevelDebug},
+		{http.MethodPut, `{"level":"warn"}`, http.StatusOK, slog.LevelWarn},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, "/api/admin/log-level", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(rec, req)
+		if rec.Code != tc.want || Level.Level() != tc.level {
+			t.Errorf("%s %s returned %d with level %s, want %d with %s", tc.method, tc.body, rec.Code, Level.Level(), tc.want, tc.level)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"platform/pkg/reqctx"
+)
+
+// HTTP metrics recorded by Metrics
+var (
+	HTTPRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests",
+		},
+		[]string{"method", "endpoint", "status"},
+	)
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "endpoint"},
+	)
+)
+
+// MustRegisterMetrics registers the HTTP metrics with reg
+func MustRegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(HTTPRequestsTotal, HTTPRequestDuration)
+}
+
+// Label values recorded in place of unbounded ones
+const (
+	// UnmatchedEndpoint is the endpoint of requests that matched no route
+	UnmatchedEndpoint = "unmatched"
+	// OverflowLabel replaces every label of a series past MetricsOptions.MaxSeries
+	OverflowLabel = "other"
+)
+
+// Labels of the HTTP metrics that can be disabled
+const (
+	LabelMethod   = "method"
+	LabelEndpoint = "endpoint"
+	LabelStatus   = "status"
+)
+
+// MetricsOptions bounds the label values the metrics middleware records
+//
+// The zero value records exact status codes and every series seen.
+type MetricsOptions struct {
+	// StatusClasses records status as 2xx, 3xx, 4xx or 5xx instead of the exact code
+	StatusClasses bool
+	// MaxSeries caps the method, endpoint and status combinations recorded;
+	// later ones are all counted as one series labelled OverflowLabel. 0 means no cap
+	MaxSeries int
+	// DisabledLabels are recorded as empty, which drops them from every series
+	DisabledLabels []string
+}
+
+// standardMethods are the methods recorded as sent; scanners try anything else
+var standardMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// metricLabels turns requests into bounded label values
+type metricLabels struct {
+	opts     MetricsOptions
+	disabled map[string]bool
+
+	mu   sync.Mutex
+	seen map[[3]string]bool
+}
+
+func newMetricLabels(opts MetricsOptions) *metricLabels {
+	l := &metricLabels{opts: opts, disabled: make(map[string]bool), seen: make(map[[3]string]bool)}
+	for _, label := range opts.DisabledLabels {
+		l.disabled[label] = true
+	}
+	return l
+}
+
+// values returns the method, endpoint and status to record for a request
+func (l *metricLabels) values(method, endpoint string, status int) (string, string, string) {
+	if !standardMethods[method] {
+		method = "OTHER"
+	}
+	if endpoint == "" {
+		endpoint = UnmatchedEndpoint
+	}
+	code := strconv.Itoa(status)
+	if l.opts.StatusClasses {
+		code = code[:1] + "xx"
+	}
+	labels := [3]string{method, endpoint, code}
+	for i, name := range []string{LabelMethod, LabelEndpoint, LabelStatus} {
+		if l.disabled[name] {
+			labels[i] = ""
+		}
+	}
+
+	if l.opts.MaxSeries > 0 {
+		l.mu.Lock()
+		if !l.seen[labels] {
+			if len(l.seen) < l.opts.MaxSeries {
+				l.seen[labels] = true
+			} else {
+				labels = [3]string{OverflowLabel, OverflowLabel, OverflowLabel}
+			}
+		}
+		l.mu.Unlock()
+	}
+	return labels[0], labels[1], labels[2]
+}
+
+// Metrics middleware
+//
+// Records request counts and latency by route template, so path parameters
+// do not blow up label cardinality. Requests matching no route are recorded
+// as UnmatchedEndpoint and non-standard methods as OTHER, so scanning
+// traffic cannot add series; opts bounds what remains.
+func Metrics(opts MetricsOptions) gin.HandlerFunc {
+	labels := newMetricLabels(opts)
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		duration := time.Since(start).Seconds()
+		method, endpoint, status := labels.values(c.Request.Method, c.FullPath(), c.Writer.Status())
+
+		HTTPRequestsTotal.WithLabelValues(method, endpoint, status).Inc()
+		ObserveWithTrace(HTTPRequestDuration.WithLabelValues(method, endpoint), duration, reqctx.TraceID(c.Request.Context()))
+	}
+}
+
+// ObserveWithTrace records v, attaching traceID as an exemplar when it is set
+//
+// Exemplars let a dashboard jump from a latency bucket to a trace that
+// landed in it. They are only exposed when /metrics serves OpenMetrics.
+func ObserveWithTrace(obs prometheus.Observer, v float64, traceID string) {
+	if exemplars, ok := obs.(prometheus.ExemplarObserver); ok && traceID != "" {
+		exemplars.ObserveWithExemplar(v, prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	obs.Observe(v)
+}
@@ -0,0 +1,125 @@
+// Package middleware is the gin middleware set shared by the platform services.
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"platform/pkg/logging"
+	"platform/pkg/reqctx"
+)
+
+// Correlation ID middleware
+//
+// Accepts the ID set by the gateway (Kong uses X-Correlation-ID, other callers
+// X-Request-ID), generates one when absent and echoes it on the response.
+func Correlation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(reqctx.RequestIDHeader)
+		if id == "" {
+			id = c.GetHeader(reqctx.CorrelationIDHeader)
+		}
+		if id == "" {
+			id = uuid.New().String()
+		}
+
+		c.Request = c.Request.WithContext(reqctx.WithCorrelationID(c.Request.Context(), id))
+		c.Header(reqctx.RequestIDHeader, id)
+		c.Header(reqctx.CorrelationIDHeader, id)
+
+		c.Next()
+	}
+}
+
+// Trace middleware
+//
+// Stores the ID of the trace the mesh started for the request, if any, in
+// the request context so metrics can link to it.
+func Trace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id := reqctx.TraceIDFromHeader(c.Request.Header); id != "" {
+			c.Request = c.Request.WithContext(reqctx.WithTraceID(c.Request.Context(), id))
+		}
+		c.Next()
+	}
+}
+
+// Tenant middleware
+//
+// Stores the tenant set by the gateway in the request context.
+func Tenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tenant := c.GetHeader(reqctx.TenantHeader); tenant != "" {
+			c.Request = c.Request.WithContext(reqctx.WithTenant(c.Request.Context(), tenant))
+		}
+		c.Next()
+	}
+}
+
+// Identity middleware
+//
+// Stores the caller the gateway authenticated, and whether they are an
+// admin, in the request context. The headers are trusted because the
+// gateway strips them from client requests and only the mesh can reach
+// services directly.
+func Identity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id := c.GetHeader(reqctx.UserIDHeader); id != "" {
+			c.Request = c.Request.WithContext(reqctx.WithUserID(c.Request.Context(), id))
+		}
+		if c.GetHeader(reqctx.AdminHeader) == "true" {
+			c.Request = c.Request.WithContext(reqctx.WithAdmin(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
+
+// RequireUser rejects requests that did not pass gateway authentication
+//
+// It must run after Identity.
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if reqctx.UserID(c.Request.Context()) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Authentication required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Logging middleware
+//
+// Injects a request-scoped logger carrying the request ID, route, caller and
+// tenant into the request context; services write their own access log line.
+func Logging() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID := c.Param("user_id")
+		if userID == "" {
+			userID = reqctx.UserID(ctx)
+		}
+
+		logger := slog.Default().With(
+			"request_id", reqctx.CorrelationID(ctx),
+			"route", c.FullPath(),
+		)
+		if traceID := reqctx.TraceID(ctx); traceID != "" {
+			logger = logger.With("trace_id", traceID)
+		}
+		if userID != "" {
+			logger = logger.With("user_id", userID)
+		}
+		if tenant := reqctx.Tenant(ctx); tenant != "" {
+			logger = logger.With("tenant_id", tenant)
+		}
+		c.Request = c.Request.WithContext(logging.NewContext(ctx, logger))
+
+		c.Next()
+	}
+}
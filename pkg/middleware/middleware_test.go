@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/logging"
+	"platform/pkg/reqctx"
+)
+
+func TestCorrelation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Correlation())
+	var seen string
+	r.GET("/", func(c *gin.Context) { seen = reqctx.CorrelationID(c.Request.Context()) })
+
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"request id", map[string]string{reqctx.RequestIDHeader: "req-1"}, "req-1"},
+		{"correlation id", map[string]string{reqctx.CorrelationIDHeader: "corr-1"}, "corr-1"},
+		{"request id wins", map[string]string{reqctx.RequestIDHeader: "req-1", reqctx.CorrelationIDHeader: "corr-1"}, "req-1"},
+		{"generated", nil, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for key, value := range tc.headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if tc.want != "" && seen != tc.want {
+			t.Errorf("%s: correlation ID = %q, want %q", tc.name, seen, tc.want)
+		}
+		if seen == "" || rec.Header().Get(reqctx.RequestIDHeader) != seen || rec.Header().Get(reqctx.CorrelationIDHeader) != seen {
+			t.Errorf("%s: response echoed %q, %q for %q", tc.name, rec.Header().Get(reqctx.RequestIDHeader), rec.Header().Get(reqctx.CorrelationIDHeader), seen)
+		}
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Trace(), Tenant(), Identity(), Logging())
+	r.GET("/api/users/:user_id", RequireUser(), func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if reqctx.Tenant(ctx) != "acme" || reqctx.UserID(ctx) != "alice" || reqctx.TraceID(ctx) != "a3ce929d0e0e4736" {
+			t.Errorf("context carries tenant %q, user %q, trace %q", reqctx.Tenant(ctx), reqctx.UserID(ctx), reqctx.TraceID(ctx))
+		}
+		if logging.FromContext(ctx) == nil {
+			t.Error("no request-scoped logger")
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, tc := range []struct {
+		name   string
+		caller string
+		want   int
+	}{
+		{"authenticated", "alice", http.StatusNoContent},
+		{"anonymous", "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/alice", nil)
+		req.Header.Set(reqctx.TenantHeader, "acme")
+		req.Header.Set(reqctx.B3TraceIDHeader, "a3ce929d0e0e4736")
+		if tc.caller != "" {
+			req.Header.Set(reqctx.UserIDHeader, tc.caller)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestMetricLabels(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opts     MetricsOptions
+		method   string
+		endpoint string
+		status   int
+		want     [3]string
+	}{
+		{"exact", MetricsOptions{}, http.MethodGet, "/api/notifications/:id", 404, [3]string{"GET", "/api/notifications/:id", "404"}},
+		{"unmatched", MetricsOptions{}, http.MethodGet, "", 404, [3]string{"GET", UnmatchedEndpoint, "404"}},
+		{"nonstandard method", MetricsOptions{}, "PROPFIND", "", 405, [3]string{"OTHER", UnmatchedEndpoint, "405"}},
+		{"status classes", MetricsOptions{StatusClasses: true}, http.MethodPost, "/api/send", 503, [3]string{"POST", "/api/send", "5xx"}},
+		{"disabled label", MetricsOptions{DisabledLabels: []string{LabelMethod}}, http.MethodPost, "/api/send", 201, [3]string{"", "/api/send", "201"}},
+	} {
+		method, endpoint, status := newMetricLabels(tc.opts).values(tc.method, tc.endpoint, tc.status)
+		if got := [3]string{method, endpoint, status}; got != tc.want {
+			t.Errorf("%s: labels = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	labels := newMetricLabels(MetricsOptions{MaxSeries: 1})
+	labels.values(http.MethodGet, "/a", 200)
+	if method, _, _ := labels.values(http.MethodGet, "/a", 200); method != "GET" {
+		t.Error("a series seen before the cap was folded into the overflow")
+	}
+	if method, endpoint, status := labels.values(http.MethodGet, "/b", 200); method != OverflowLabel || endpoint != OverflowLabel || status != OverflowLabel {
+		t.Errorf("series past the cap = %q, %q, %q, want the overflow labels", method, endpoint, status)
+	}
+}
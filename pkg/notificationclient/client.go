@@ -0,0 +1,331 @@
+// Package notificationclient is the Go client for the notification service API.
+//
+// Calls take a context, carry the caller's correlation ID and tenant, and
+// retry transient failures. Requests that create notifications are only
+// retried when the service provably did not act on them, so a retry never
+// delivers a notification twice.
+package notificationclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"platform/pkg/reqctx"
+)
+
+// Notification is a notification as returned by the service
+type Notification struct {
+	ID            string         `json:"id"`
+	UserID        string         `json:"user_id"`
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Message       string         `json:"message"`
+	Status        string         `json:"status"`
+	Pinned        bool           `json:"pinned,omitempty"`
+	Category      string         `json:"category,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Campaign      string         `json:"campaign,omitempty"`
+	Variant       string         `json:"variant,omitempty"`
+	Tenant        string         `json:"tenant,omitempty"`
+	GroupKey      string         `json:"group_key,omitempty"`
+	Priority      string         `json:"priority,omitempty"`
+	Icon          string         `json:"icon,omitempty"`
+	Actions       []Action       `json:"actions,omitempty"`
+	ImageURL      string         `json:"image_url,omitempty"`
+	Data          map[string]any `json:"data,omitempty"`
+	CorrelationID string         `json:"correlation_id,omitempty"`
+	TraceID       string         `json:"trace_id,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	ReadAt        *time.Time     `json:"read_at,omitempty"`
+	SnoozedUntil  *time.Time     `json:"snoozed_until,omitempty"`
+}
+
+// CreateRequest stores a notification without delivering it
+type CreateRequest struct {
+	UserID  string `json:"user_id"`
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	// Category is one of orders, payments, promotions, security or
+	// system, the default
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// Campaign groups the service's click-through metrics
+	Campaign string `json:"campaign,omitempty"`
+	// GroupKey collapses repeated notifications in the user's inbox
+	GroupKey string   `json:"group_key,omitempty"`
+	Actions  []Action `json:"actions,omitempty"`
+	// ImageURL must be https, and Data must match the service's content
+	// schema for Type if one is configured
+	ImageURL string         `json:"image_url,omitempty"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+// Action is a button rendered with a notification; set exactly one of URL and Intent
+type Action struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	URL    string `json:"url,omitempty"`
+	Intent string `json:"intent,omitempty"`
+}
+
+// SendRequest stores a notification and delivers it over Channels
+type SendRequest struct {
+	CreateRequest
+	// Channels defaults to email on the service side
+	Channels []string `json:"channels,omitempty"`
+}
+
+// APIError is a non-2xx response from the service
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is the delay the service asked for on 429 and 503 responses
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("notification service returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the service
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Hooks instrument every attempt the client makes
+type Hooks struct {
+	// OnRequest is called before each attempt, e.g. to add auth headers
+	OnRequest func(req *http.Request)
+	// OnResponse is called after each attempt; status is 0 when err is set
+	OnResponse func(req *http.Request, status int, duration time.Duration, err error)
+}
+
+// Options configures a Client
+type Options struct {
+	// HTTPClient defaults to a client with a 10s timeout; streams use it without its timeout
+	HTTPClient  *http.Client
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Hooks       Hooks
+}
+
+// DefaultOptions returns settings suitable for calls between platform services
+func DefaultOptions() Options {
+	return Options{
+		HTTPClient:  &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 3,
+		BaseBackoff: 100 * time.Millisecond,
+		MaxBackoff:  2 * time.Second,
+	}
+}
+
+// Client calls the notification service
+type Client struct {
+	baseURL string
+	opts    Options
+}
+
+// New returns a client for the service at baseURL, e.g. http://notification-service:3003
+func New(baseURL string, opts Options) *Client {
+	defaults := DefaultOptions()
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = defaults.HTTPClient
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = defaults.BaseBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaults.MaxBackoff
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), opts: opts}
+}
+
+// Create stores a notification for the user without delivering it
+func (c *Client) Create(ctx context.Context, req CreateRequest) (*Notification, error) {
+	var notification Notification
+	if err := c.do(ctx, http.MethodPost, "/api/notifications", req, &notification); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// Send stores a notification and queues it for delivery
+func (c *Client) Send(ctx context.Context, req SendRequest) (*Notification, error) {
+	var notification Notification
+	if err := c.do(ctx, http.MethodPost, "/api/send", req, &notification); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// ListByUser returns every notification for userID
+func (c *Client) ListByUser(ctx context.Context, userID string) ([]Notification, error) {
+	var notifications []Notification
+	path := "/api/users/" + url.PathEscape(userID) + "/notifications"
+	if err := c.do(ctx, http.MethodGet, path, nil, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// MarkRead marks the notification with the given ID as read
+func (c *Client) MarkRead(ctx context.Context, id string) (*Notification, error) {
+	var notification Notification
+	path := "/api/notifications/" + url.PathEscape(id) + "/read"
+	if err := c.do(ctx, http.MethodPatch, path, nil, &notification); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// Click reports a tap on the action with ID actionID of the notification with the given ID
+func (c *Client) Click(ctx context.Context, id, actionID string) error {
+	path := "/api/notifications/" + url.PathEscape(id) + "/actions/" + url.PathEscape(actionID) + "/click"
+	return c.do(ctx, http.MethodPost, path, nil, nil)
+}
+
+// envelope is the {"success", "data", "error"} shape of every response
+type envelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error"`
+}
+
+// do sends a JSON request, retrying when it is safe, and decodes data into out
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		status, err := c.attempt(ctx, method, path, payload, out)
+		if err == nil || attempt >= c.opts.MaxAttempts || ctx.Err() != nil || !retryable(method, status, err) {
+			return err
+		}
+
+		delay := c.backoff(attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > delay {
+			delay = min(apiErr.RetryAfter, c.opts.MaxBackoff)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, out any) (int, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	c.decorate(req)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	start := time.Now()
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		c.observe(req, 0, start, err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var env envelope
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(&env)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = &APIError{StatusCode: resp.StatusCode, Message: env.Error, RetryAfter: retryAfter(resp)}
+	} else if decodeErr != nil {
+		err = fmt.Errorf("decoding response: %w", decodeErr)
+	} else if out != nil && len(env.Data) > 0 {
+		err = json.Unmarshal(env.Data, out)
+	}
+	c.observe(req, resp.StatusCode, start, err)
+	return resp.StatusCode, err
+}
+
+// decorate sets the headers shared by every request
+func (c *Client) decorate(req *http.Request) {
+	req.Header.Set("Accept", "application/json")
+	reqctx.SetOutboundHeaders(req.Context(), req)
+	if c.opts.Hooks.OnRequest != nil {
+		c.opts.Hooks.OnRequest(req)
+	}
+}
+
+func (c *Client) observe(req *http.Request, status int, start time.Time, err error) {
+	if c.opts.Hooks.OnResponse != nil {
+		c.opts.Hooks.OnResponse(req, status, time.Since(start), err)
+	}
+}
+
+// retryable reports whether an attempt may be repeated
+//
+// Reads and mark-read are idempotent. Creating requests are only retried
+// when the connection was never established or the service rejected the
+// request before acting on it (429, or 503 while draining or when the send
+// queue is full).
+func retryable(method string, status int, err error) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return method != http.MethodPost
+	case 0:
+		if errors.Is(err, context.Canceled) {
+			return false
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return true
+		}
+		return method != http.MethodPost
+	}
+	return false
+}
+
+// backoff returns a full-jitter delay for the given attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := c.opts.BaseBackoff << (attempt - 1)
+	if ceiling <= 0 || ceiling > c.opts.MaxBackoff {
+		ceiling = c.opts.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,136 @@
+package notificationclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"platform/pkg/reqctx"
+)
+
+func testClient(url string) *Client {
+	return New(url, Options{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+}
+
+func TestRetryable(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	read := &net.OpError{Op: "read", Err: errors.New("connection reset")}
+	for _, tc := range []struct {
+		method string
+		status int
+		err    error
+		want   bool
+	}{
+		{http.MethodPost, http.StatusServiceUnavailable, nil, true},
+		{http.MethodPost, http.StatusTooManyRequests, nil, true},
+		{http.MethodPost, http.StatusBadGateway, nil, false},
+		{http.MethodGet, http.StatusBadGateway, nil, true},
+		{http.MethodPost, 0, dial, true},
+		{http.MethodPost, 0, read, false},
+		{http.MethodGet, 0, read, true},
+		{http.MethodGet, 0, context.Canceled, false},
+		{http.MethodGet, http.StatusInternalServerError, nil, false},
+	} {
+		if got := retryable(tc.method, tc.status, tc.err); got != tc.want {
+			t.Errorf("retryable(%s, %d, %v) = %v, want %v", tc.method, tc.status, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   int
+		call     func(*Client) error
+		attempts int32
+	}{
+		{"send retried while draining", http.StatusServiceUnavailable, func(c *Client) error {
+			_, err := c.Send(context.Background(), SendRequest{CreateRequest: CreateRequest{UserID: "alice"}})
+			return err
+		}, 2},
+		{"send not retried on a bad gateway", http.StatusBadGateway, func(c *Client) error {
+			_, err := c.Send(context.Background(), SendRequest{CreateRequest: CreateRequest{UserID: "alice"}})
+			return err
+		}, 1},
+		{"list retried on a bad gateway", http.StatusBadGateway, func(c *Client) error {
+			_, err := c.ListByUser(context.Background(), "alice")
+			return err
+		}, 2},
+	} {
+		var attempts atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) == 1 {
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, `{"success":false,"error":"unavailable"}`)
+				return
+			}
+			fmt.Fprint(w, `{"success":true,"data":{"id":"n1"}}`)
+		}))
+		err := tc.call(testClient(srv.URL))
+		srv.Close()
+		if got := attempts.Load(); got != tc.attempts {
+			t.Errorf("%s: %d attempts, want %d", tc.name, got, tc.attempts)
+		}
+		var apiErr *APIError
+		if tc.attempts == 1 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tc.status) {
+			t.Errorf("%s: returned %v, want the %d", tc.name, err, tc.status)
+		}
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(reqctx.CorrelationIDHeader) != "req-1" || r.Header.Get(reqctx.TenantHeader) != "acme" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"success":false,"error":"missing headers"}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"success":false,"error":"Notification not found"}`)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, Options{Hooks: Hooks{OnRequest: func(req *http.Request) { req.Header.Set("Authorization", "Bearer token") }}})
+	ctx := reqctx.WithTenant(reqctx.WithCorrelationID(context.Background(), "req-1"), "acme")
+	if _, err := c.MarkRead(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("MarkRead returned %v, want a 404 carrying the request headers", err)
+	}
+}
+
+func TestWatchStream(t *testing.T) {
+	var lastEventIDs []string
+	var connections atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		if connections.Add(1) > 2 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keepalive\n\n")
+		fmt.Fprintf(w, "id: n%d\nevent: notification\ndata: {\"id\":\"n%d\",\n", connections.Load(), connections.Load())
+		fmt.Fprint(w, "data: \"user_id\":\"alice\"}\n\n")
+	}))
+	defer srv.Close()
+
+	var received []string
+	err := testClient(srv.URL).WatchStream(context.Background(), "alice", func(n Notification) {
+		received = append(received, n.ID)
+	})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("WatchStream returned %v, want the 403 that ended it", err)
+	}
+	if len(received) != 2 || received[0] != "n1" || received[1] != "n2" {
+		t.Errorf("received %v, want n1 and n2", received)
+	}
+	if len(lastEventIDs) != 3 || lastEventIDs[0] != "" || lastEventIDs[1] != "n1" || lastEventIDs[2] != "n2" {
+		t.Errorf("reconnected with Last-Event-ID %q, want to resume after each notification", lastEventIDs)
+	}
+}
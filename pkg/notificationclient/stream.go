@@ -0,0 +1,120 @@
+package notificationclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WatchStream calls handle with each new notification for userID until ctx is cancelled
+//
+// Dropped streams are reopened with backoff, resuming from the last
+// notification seen so none are missed. WatchStream only returns on
+// cancellation or when the service rejects the stream with a 4xx; handle
+// runs on the calling goroutine and should not block for long.
+func (c *Client) WatchStream(ctx context.Context, userID string, handle func(Notification)) error {
+	// Streams stay open far longer than any request timeout
+	httpClient := *c.opts.HTTPClient
+	httpClient.Timeout = 0
+
+	path := "/api/users/" + url.PathEscape(userID) + "/notifications/stream"
+	lastID := ""
+	failures := 0
+	for {
+		received, err := c.stream(ctx, &httpClient, path, &lastID, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+
+		if received {
+			failures = 0
+		}
+		failures++
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.backoff(failures)):
+		}
+	}
+}
+
+// stream reads one connection's events, reporting whether any arrived
+func (c *Client) stream(ctx context.Context, httpClient *http.Client, path string, lastID *string, handle func(Notification)) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return false, err
+	}
+	c.decorate(req)
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastID != "" {
+		req.Header.Set("Last-Event-ID", *lastID)
+	}
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		c.observe(req, 0, start, err)
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = &APIError{StatusCode: resp.StatusCode, Message: "stream rejected", RetryAfter: retryAfter(resp)}
+		c.observe(req, resp.StatusCode, start, err)
+		return false, err
+	}
+	c.observe(req, resp.StatusCode, start, nil)
+
+	received := false
+	var id, event string
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line ends the event
+			if event == "notification" && data.Len() > 0 {
+				var notification Notification
+				if err := json.Unmarshal([]byte(data.String()), &notification); err != nil {
+					return received, fmt.Errorf("decoding stream event: %w", err)
+				}
+				if id != "" {
+					*lastID = id
+				}
+				received = true
+				handle(notification)
+			}
+			id, event = "", ""
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+	return received, scanner.Err()
+}
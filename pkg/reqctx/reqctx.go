@@ -0,0 +1,127 @@
+// Package reqctx carries request-scoped identifiers through a context and
+// onto outbound calls.
+package reqctx
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Headers set by the gateway and propagated between services
+const (
+	RequestIDHeader     = "X-Request-ID"
+	CorrelationIDHeader = "X-Correlation-ID"
+	// TenantHeader identifies the tenant a request is made on behalf of
+	TenantHeader = "X-Tenant-ID"
+	// UserIDHeader is the authenticated caller, set by the gateway from the token's subject
+	UserIDHeader = "X-User-ID"
+	// AdminHeader is "true" when the gateway verified the caller's token carries the admin role
+	AdminHeader = "X-User-Admin"
+	// TraceparentHeader and B3TraceIDHeader carry the trace started by the mesh, in W3C and Zipkin B3 form
+	TraceparentHeader = "traceparent"
+	B3TraceIDHeader   = "X-B3-TraceId"
+)
+
+type (
+	correlationIDKey struct{}
+	tenantKey        struct{}
+	userIDKey        struct{}
+	adminKey         struct{}
+	traceIDKey       struct{}
+)
+
+// CorrelationID returns the correlation ID carried by ctx, if any
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// WithCorrelationID returns a copy of ctx carrying id
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// Tenant returns the tenant carried by ctx, or "" for untenanted requests
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// WithTenant returns a copy of ctx carrying tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// UserID returns the authenticated caller carried by ctx, if any
+func UserID(ctx context.Context) string {
+	id, _ := ctx.Value(userIDKey{}).(string)
+	return id
+}
+
+// WithUserID returns a copy of ctx carrying the authenticated caller
+func WithUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, id)
+}
+
+// IsAdmin reports whether ctx carries an admin caller, who may act on any user's data
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
+
+// WithAdmin returns a copy of ctx whose caller is an admin
+func WithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+// TraceID returns the ID of the trace ctx is part of, if any
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+// WithTraceID returns a copy of ctx carrying the trace ID
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// TraceIDFromHeader returns the trace ID in h, from traceparent or else X-B3-TraceId, or "" when there is no valid one
+func TraceIDFromHeader(h http.Header) string {
+	// traceparent is version-traceid-parentid-flags
+	if parts := strings.Split(h.Get(TraceparentHeader), "-"); len(parts) >= 4 && len(parts[0]) == 2 && parts[0] != "ff" {
+		if id := strings.ToLower(parts[1]); len(id) == 32 && validTraceID(id) {
+			return id
+		}
+	}
+	if id := strings.ToLower(h.Get(B3TraceIDHeader)); (len(id) == 16 || len(id) == 32) && validTraceID(id) {
+		return id
+	}
+	return ""
+}
+
+// validTraceID reports whether id is lowercase hex and not all zeros, which marks an invalid trace
+func validTraceID(id string) bool {
+	nonZero := false
+	for _, c := range id {
+		switch {
+		case c == '0':
+		case '1' <= c && c <= '9', 'a' <= c && c <= 'f':
+			nonZero = true
+		default:
+			return false
+		}
+	}
+	return nonZero
+}
+
+// SetOutboundHeaders copies the correlation ID and tenant from ctx onto an outbound request
+func SetOutboundHeaders(ctx context.Context, req *http.Request) {
+	if id := CorrelationID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+		req.Header.Set(CorrelationIDHeader, id)
+	}
+	if tenant := Tenant(ctx); tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+}
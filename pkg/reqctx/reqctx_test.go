@@ -0,0 +1,70 @@
+package reqctx
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestTraceIDFromHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"traceparent", map[string]string{TraceparentHeader: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"b3 64-bit", map[string]string{B3TraceIDHeader: "a3ce929d0e0e4736"}, "a3ce929d0e0e4736"},
+		{"traceparent wins", map[string]string{TraceparentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", B3TraceIDHeader: "a3ce929d0e0e4736"}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"invalid version", map[string]string{TraceparentHeader: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, ""},
+		{"all zeros", map[string]string{TraceparentHeader: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}, ""},
+		{"not hex falls back to b3", map[string]string{TraceparentHeader: "00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", B3TraceIDHeader: "a3ce929d0e0e4736"}, "a3ce929d0e0e4736"},
+		{"b3 wrong length", map[string]string{B3TraceIDHeader: "a3ce929d"}, ""},
+		{"none", nil, ""},
+	} {
+		h := http.Header{}
+		for key, value := range tc.headers {
+			h.Set(key, value)
+		}
+		if got := TraceIDFromHeader(h); got != tc.want {
+			t.Errorf("%s: TraceIDFromHeader = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSetOutboundHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		ctx           context.Context
+		correlationID string
+		tenant        string
+	}{
+		{"empty", context.Background(), "", ""},
+		{"correlation", WithCorrelationID(context.Background(), "req-1"), "req-1", ""},
+		{"both", WithTenant(WithCorrelationID(context.Background(), "req-1"), "acme"), "req-1", "acme"},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://user-service/api/users/1", nil)
+		SetOutboundHeaders(tc.ctx, req)
+		if got := req.Header.Get(CorrelationIDHeader); got != tc.correlationID {
+			t.Errorf("%s: %s = %q, want %q", tc.name, CorrelationIDHeader, got, tc.correlationID)
+		}
+		if got := req.Header.Get(RequestIDHeader); got != tc.correlationID {
+			t.Errorf("%s: %s = %q, want %q", tc.name, RequestIDHeader, got, tc.correlationID)
+		}
+		if got := req.Header.Get(TenantHeader); got != tc.tenant {
+			t.Errorf("%s: %s = %q, want %q", tc.name, TenantHeader, got, tc.tenant)
+		}
+	}
+}
+
+func TestContextValues(t *testing.T) {
+	ctx := WithTraceID(WithUserID(WithTenant(WithCorrelationID(context.Background(), "req-1"), "acme"), "alice"), "a3ce929d0e0e4736")
+	if CorrelationID(ctx) != "req-1" || Tenant(ctx) != "acme" || UserID(ctx) != "alice" || TraceID(ctx) != "a3ce929d0e0e4736" {
+		t.Errorf("context carries %q, %q, %q, %q", CorrelationID(ctx), Tenant(ctx), UserID(ctx), TraceID(ctx))
+	}
+	if IsAdmin(ctx) || !IsAdmin(WithAdmin(ctx)) {
+		t.Error("admin callers are not told apart")
+	}
+	if empty := context.Background(); CorrelationID(empty) != "" || Tenant(empty) != "" || UserID(empty) != "" || TraceID(empty) != "" || IsAdmin(empty) {
+		t.Error("an empty context carries values")
+	}
+}
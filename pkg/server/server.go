@@ -0,0 +1,104 @@
+// Package server bootstraps the HTTP server of a platform service.
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"platform/pkg/health"
+	"platform/pkg/middleware"
+)
+
+// Options configures the engine built by NewEngine
+type Options struct {
+	// Recovery replaces gin's default panic recovery, e.g. to report panics
+	Recovery gin.HandlerFunc
+	// Middleware runs once the request context carries the correlation ID,
+	// trace ID, tenant, caller and logger, before the metrics middleware
+	Middleware []gin.HandlerFunc
+	// Metrics bounds the labels of the HTTP metrics
+	Metrics middleware.MetricsOptions
+}
+
+// NewEngine returns a gin engine with the shared middleware installed
+//
+// Gin runs in release mode when GIN_MODE=release.
+func NewEngine(opts Options) *gin.Engine {
+	if os.Getenv("GIN_MODE") == "release" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	recovery := opts.Recovery
+	if recovery == nil {
+		recovery = gin.Recovery()
+	}
+
+	r := gin.New()
+	r.Use(recovery)
+	r.Use(middleware.Correlation())
+	r.Use(middleware.Trace())
+	r.Use(middleware.Tenant())
+	r.Use(middleware.Identity())
+	r.Use(middleware.Logging())
+	r.Use(opts.Middleware...)
+	r.Use(middleware.Metrics(opts.Metrics))
+	return r
+}
+
+// Serve runs srv until ctx is cancelled by SIGTERM or SIGINT, then shuts down gracefully
+//
+// srv serves HTTPS when ConfigureTLS has set it up.
+//
+// On a signal the pod first reports not ready, stops accepting connections and
+// waits for in-flight requests, then runs each drain function in order, e.g.
+// to empty a work queue. Everything must finish within timeout, which should
+// stay below the pod's terminationGracePeriodSeconds.
+func Serve(ctx context.Context, srv *http.Server, timeout time.Duration, probes *health.Registry, drain ...func(context.Context) error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			// Certificates come from TLSConfig, set up by ConfigureTLS
+			errCh <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutdown signal received, draining", "timeout", timeout.String())
+	probes.SetDraining()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var shutdownErr error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("HTTP server did not shut down cleanly", "error", err)
+		shutdownErr = err
+	}
+
+	for _, fn := range drain {
+		if err := fn(shutdownCtx); err != nil {
+			slog.Error("drain did not complete", "error", err)
+			shutdownErr = errors.Join(shutdownErr, err)
+		}
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		shutdownErr = errors.Join(shutdownErr, err)
+	}
+
+	slog.Info("shutdown complete")
+	return shutdownErr
+}
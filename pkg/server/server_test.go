@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"platform/pkg/health"
+)
+
+func TestServeDrains(t *testing.T) {
+	probes := health.NewRegistry()
+	srv := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	ctx, stop := context.WithCancel(context.Background())
+	var order []string
+	drain := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			if !probes.Draining() {
+				t.Errorf("%s ran before readiness started failing", name)
+			}
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, srv, time.Second, probes, drain("queue"), drain("writer")) }()
+	stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Serve returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after the signal")
+	}
+	if !slices.Equal(order, []string{"queue", "writer"}) {
+		t.Errorf("drained %v, want queue then writer", order)
+	}
+}
+
+func TestConfigureTLS(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "tls.crt")
+	for _, tc := range []struct {
+		name    string
+		opts    TLSOptions
+		wantErr bool
+		tls     bool
+	}{
+		{"plain http", TLSOptions{}, false, false},
+		{"cert file and autocert", TLSOptions{CertFile: missing, KeyFile: missing, AutocertHosts: []string{"example.com"}, AutocertCacheDir: t.TempDir()}, true, false},
+		{"autocert without cache", TLSOptions{AutocertHosts: []string{"example.com"}}, true, false},
+		{"missing certificate", TLSOptions{CertFile: missing, KeyFile: missing}, true, false},
+		{"autocert", TLSOptions{AutocertHosts: []string{"example.com"}, AutocertCacheDir: t.TempDir()}, false, true},
+	} {
+		srv := &http.Server{}
+		err := ConfigureTLS(srv, tc.opts)
+		if (err != nil) != tc.wantErr || (srv.TLSConfig != nil) != tc.tls {
+			t.Errorf("%s: ConfigureTLS = %v with TLS config %v", tc.name, err, srv.TLSConfig != nil)
+		}
+	}
+}
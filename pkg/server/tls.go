@@ -0,0 +1,127 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSOptions configures HTTPS for deployments that terminate TLS at the pod
+//
+// Certificates come either from CertFile and KeyFile or, when AutocertHosts
+// is set, from an ACME CA such as Let's Encrypt. The zero value serves plain
+// HTTP.
+type TLSOptions struct {
+	// CertFile and KeyFile are PEM files, reread when they change so rotated
+	// certificates (e.g. from a cert-manager Secret) are picked up
+	CertFile string
+	KeyFile  string
+	// AutocertHosts are the host names to obtain certificates for; challenges
+	// are answered with TLS-ALPN-01 on the listener itself
+	AutocertHosts []string
+	// AutocertCacheDir keeps obtained certificates across restarts
+	AutocertCacheDir string
+	// AutocertEmail is the ACME account contact, told about expiring certificates
+	AutocertEmail string
+	// DisableHTTP2 serves HTTP/1.1 only; HTTP/2 is otherwise negotiated over TLS
+	DisableHTTP2 bool
+}
+
+// Enabled reports whether opts asks for TLS
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != "" || len(o.AutocertHosts) > 0
+}
+
+// ConfigureTLS sets srv up to serve HTTPS as opts says, after which Serve listens with TLS
+func ConfigureTLS(srv *http.Server, opts TLSOptions) error {
+	if !opts.Enabled() {
+		return nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch {
+	case len(opts.AutocertHosts) > 0:
+		if opts.CertFile != "" {
+			return errors.New("tls: use either a certificate file or autocert, not both")
+		}
+		if opts.AutocertCacheDir == "" {
+			return errors.New("tls: autocert needs a cache directory")
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(opts.AutocertHosts...),
+			Cache:      autocert.DirCache(opts.AutocertCacheDir),
+			Email:      opts.AutocertEmail,
+		}
+		config.GetCertificate = manager.GetCertificate
+		config.NextProtos = []string{acme.ALPNProto}
+	default:
+		certificate := &certificateFile{certFile: opts.CertFile, keyFile: opts.KeyFile}
+		if _, err := certificate.load(); err != nil {
+			return err
+		}
+		config.GetCertificate = certificate.get
+	}
+	srv.TLSConfig = config
+	if opts.DisableHTTP2 {
+		// A non-nil, empty map keeps net/http from setting up HTTP/2
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return nil
+}
+
+// certificateFile is a certificate and key on disk, reloaded when either changes
+type certificateFile struct {
+	certFile, keyFile string
+
+	mu          sync.Mutex
+	modTime     time.Time
+	certificate *tls.Certificate
+}
+
+// load returns the certificate, reading the files again if they changed since the last read
+func (f *certificateFile) load() (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var modTime time.Time
+	for _, name := range []string{f.certFile, f.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return f.certificate, fmt.Errorf("tls: %w", err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if f.certificate != nil && modTime.Equal(f.modTime) {
+		return f.certificate, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return f.certificate, fmt.Errorf("tls: %w", err)
+	}
+	if f.certificate != nil {
+		slog.Info("reloaded TLS certificate", "cert_file", f.certFile)
+	}
+	f.certificate, f.modTime = &certificate, modTime
+	return f.certificate, nil
+}
+
+// get serves the certificate to handshakes, keeping the last good one while the files are being replaced
+func (f *certificateFile) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificate, err := f.load()
+	if certificate != nil {
+		if err != nil {
+			slog.Warn("keeping the current TLS certificate", "error", err)
+		}
+		return certificate, nil
+	}
+	return nil, err
+}
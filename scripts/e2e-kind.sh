@@ -0,0 +1,55 @@
+#!/usr/bin/env bash
+# Deploys user-service and notification-service to a kind cluster and runs
+# the notification-service e2e suite against them.
+#
+# KIND_CLUSTER names the cluster (default platform-e2e). It is deleted
+# afterwards unless KEEP_CLUSTER=1; an existing cluster is reused.
+set -euo pipefail
+
+CLUSTER="${KIND_CLUSTER:-platform-e2e}"
+NAMESPACE=microservices-platform
+ROOT="$(cd "$(dirname "$0")/.." && pwd)"
+cd "$ROOT"
+
+PIDS=()
+cleanup() {
+  for pid in "${PIDS[@]}"; do kill "$pid" 2>/dev/null || true; done
+  if [ "${KEEP_CLUSTER:-0}" != "1" ]; then
+    kind delete cluster --name "$CLUSTER"
+  fi
+}
+trap cleanup EXIT
+
+if ! kind get clusters | grep -qx "$CLUSTER"; then
+  kind create cluster --name "$CLUSTER" --wait 120s
+fi
+kubectl config use-context "kind-$CLUSTER"
+
+echo "Building images..."
+docker build -t user-service:latest microservices/user-service/
+docker build -t notification-service:latest -f microservices/notification-service/Dockerfile .
+kind load docker-image user-service:latest notification-service:latest --name "$CLUSTER"
+
+echo "Deploying..."
+kubectl apply -f k8s/base/namespace.yaml -f k8s/base/notificationtemplate-crd.yaml -f k8s/base/notificationtype-crd.yaml
+kubectl wait --for condition=established --timeout=60s crd/notificationtemplates.notifications.platform.io crd/notificationtypes.notifications.platform.io
+kubectl apply -f k8s/base/user-service.yaml -f k8s/base/notification-service.yaml
+kubectl apply -f k8s/examples/notification-template.yaml -f k8s/examples/notification-types.yaml
+
+# Both services keep their data in memory, so pin each to one replica to keep
+# the users and notifications the suite creates visible to every request
+kubectl -n "$NAMESPACE" delete hpa user-service-hpa notification-service-hpa --ignore-not-found
+kubectl -n "$NAMESPACE" scale deployment/user-service deployment/notification-service --replicas=1
+kubectl -n "$NAMESPACE" rollout status deployment/user-service --timeout=180s
+kubectl -n "$NAMESPACE" rollout status deployment/notification-service --timeout=180s
+
+kubectl -n "$NAMESPACE" port-forward svc/user-service 13001:3001 >/dev/null &
+PIDS+=($!)
+kubectl -n "$NAMESPACE" port-forward svc/notification-service 13003:3003 >/dev/null &
+PIDS+=($!)
+
+echo "Running e2e tests..."
+cd microservices/notification-service
+E2E_USER_URL=http://localhost:13001 \
+E2E_NOTIFICATION_URL=http://localhost:13003 \
+  go test -tags=e2e -count=1 -v ./e2e/...